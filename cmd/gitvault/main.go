@@ -2,15 +2,111 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/aatuh/gitvault/internal/cli"
+	"github.com/aatuh/gitvault/internal/cmdenv"
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/gitsync"
+	"github.com/aatuh/gitvault/internal/identity"
+	"github.com/aatuh/gitvault/internal/opaque"
+	"github.com/aatuh/gitvault/internal/ratelimit"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/telemetry"
+	"github.com/aatuh/gitvault/internal/timing"
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/gitvault/internal/vaultfs"
 	"github.com/aatuh/sealr"
+	executil "github.com/aatuh/sealr/infra/exec"
+	"github.com/aatuh/sealr/infra/git"
 )
 
 func main() {
 	ctx := context.Background()
-	system := sealr.NewDefaultSystem()
+	deps := sealr.DefaultDependencies()
+	secureFS := vaultfs.SecureFS{Base: deps.FS}
+	timings := &timing.Log{}
+	// A config that does not parse would silently drop its limits,
+	// identities, and sops settings, so refuse to run without it.
+	cfg, err := userconfig.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	timeouts, err := timing.ParseTimeouts(cfg.Timeouts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	telemetryConfig := cfg.Telemetry
+	if enabled, err := strconv.ParseBool(os.Getenv("GITVAULT_OTEL")); err == nil {
+		telemetryConfig.Enabled = enabled
+	}
+	if names, err := strconv.ParseBool(os.Getenv("GITVAULT_OTEL_NAMES")); err == nil {
+		telemetryConfig.IncludeNames = names
+	}
+	var recorder *telemetry.Recorder
+	if telemetryConfig.Enabled {
+		if recorder, err = telemetry.New(telemetryConfig.Endpoint, telemetryConfig.Headers); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(2)
+		}
+		recorder.IncludeNames = telemetryConfig.IncludeNames
+	}
+	runner := timing.Runner{Base: timing.Limited{Base: cmdenv.Runner{Base: executil.ExecRunner{}}, Timeouts: timeouts}, Log: timings}
+	deps.Git = git.Client{Runner: runner}
+	keyring := identity.SystemKeyring()
+	sops := encryption.NewSops(runner)
+	secureFS.Fsync = cfg.Storage.Fsync
+	sops.Identities = &identity.Source{
+		Files:      identity.SearchFiles(cfg.Identity.Files),
+		Keyring:    keyring,
+		UseKeyring: cfg.Identity.Keyring,
+	}
+	sops.ExtraArgs = append(encryption.KeyserviceArgs(cfg.Sops.Keyservices, cfg.Sops.LocalKeyservice), cfg.Sops.Args...)
+	sops.ExtraEnv = encryption.EnvList(cfg.Sops.Env)
+	deps.FS = secureFS
+	envArgs, err := encryption.SplitArgs(os.Getenv("GITVAULT_SOPS_ARGS"))
+	if err != nil {
+		err = fmt.Errorf("GITVAULT_SOPS_ARGS: %w", err)
+	} else {
+		sops.ExtraArgs = append(sops.ExtraArgs, envArgs...)
+		err = encryption.ValidateExtraArgs(sops.ExtraArgs)
+	}
+	if err == nil {
+		for _, addr := range encryption.Keyservices(sops.ExtraArgs) {
+			if _, _, err = encryption.ParseKeyservice(addr); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+	syncGit := &gitsync.Git{Git: deps.Git, Runner: runner}
+	deps.Git = syncGit
+	stable := encryption.NewStable(sops)
+	limiter := &ratelimit.Limiter{
+		PerMinute:    cfg.Limits.DecryptsPerMinute,
+		WarnDistinct: cfg.Limits.WarnDistinct,
+		WarnEvery:    cfg.Limits.WarnEveryEnv,
+		Alert:        cfg.Limits.Alert,
+		Warn:         os.Stderr,
+	}
+	if limiter.Active() {
+		stable.Admit = limiter.Allow
+	}
+	layout := &opaque.FS{Base: deps.FS, Encrypter: stable}
+	deps.FS = layout
+	deps.Encrypter = opaque.Encrypter{Encrypter: stable, Layout: layout}
+	system, err := sealr.NewSystem(deps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
 
 	app := cli.App{
 		Out:           os.Stdout,
@@ -23,8 +119,47 @@ func main() {
 		Listing:       system.ListingService,
 		Sync:          system.SyncService,
 		Store:         system.Store,
+		Keyring:       keyring,
+		Runner:        runner,
+		Timings:       timings,
+		Telemetry:     recorder,
+		OpenVault: func(root string) error {
+			vaultSettings, err := settings.Load(layout, root)
+			if err != nil {
+				return err
+			}
+			if vaultSettings.ObfuscateNames {
+				layout.Enable(root)
+				// Without an identity sealed settings stay unread. Commands
+				// that write decrypt the index first and fail there, so
+				// nothing is encrypted without the key groups.
+				if unsealed, err := settings.Load(layout, root); err == nil {
+					vaultSettings = unsealed
+					// Seal settings edited by hand or written before the
+					// vault had recipients.
+					if raw, err := os.ReadFile(settings.Path(root)); err == nil && !opaque.Sealed(raw) {
+						_ = settings.Save(layout, root, vaultSettings)
+					}
+				}
+			}
+			if defaults := vaultSettings.Sync; defaults != nil {
+				syncGit.Defaults = gitsync.Target{Remote: defaults.Remote, Branch: defaults.Branch, Mirrors: defaults.Mirrors}
+			}
+			if groups := vaultSettings.KeyGroups; groups != nil {
+				sops.KeyGroups = groups.Groups
+				sops.Threshold = groups.Threshold
+				stable.Base = sops
+			}
+			if limiter.WarnEvery {
+				if idx, err := system.Store.LoadIndex(root); err == nil {
+					limiter.Total = ratelimit.Ciphertexts(idx)
+				}
+			}
+			return nil
+		},
 	}
 
 	exitCode := app.Run(ctx, os.Args[1:])
+	stable.Wipe()
 	os.Exit(exitCode)
 }
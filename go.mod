@@ -2,4 +2,9 @@ module github.com/aatuh/gitvault
 
 go 1.25.1
 
-require github.com/aatuh/sealr v0.1.0
+require (
+	github.com/aatuh/sealr v0.1.0
+	golang.org/x/crypto v0.45.0
+)
+
+require golang.org/x/sys v0.38.0 // indirect
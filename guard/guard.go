@@ -0,0 +1,143 @@
+// Package guard decides whether plaintext may be written to a path and
+// writes it owner-only. Every command that writes decrypted content goes
+// through it, so the rules hold for any caller, not only the CLI.
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/vaultfs"
+	"github.com/aatuh/sealr/ports"
+)
+
+var (
+	// ErrInsideVault refuses plaintext inside the vault repository, where it
+	// could be committed next to the ciphertext.
+	ErrInsideVault = errors.New("path is inside the vault repository")
+	// ErrGitTracked refuses paths git tracks, unless Policy.AllowGit.
+	ErrGitTracked = errors.New("path is tracked by git")
+	// ErrExists refuses to replace a file, unless Policy.Overwrite.
+	ErrExists = errors.New("file already exists")
+)
+
+// Policy relaxes the default rules. Writing inside the vault is never
+// allowed.
+type Policy struct {
+	// AllowGit permits writing to a path git tracks.
+	AllowGit bool
+	// Overwrite permits replacing an existing file.
+	Overwrite bool
+}
+
+// Guard checks plaintext writes. Without Git, tracked paths go undetected.
+type Guard struct {
+	Git ports.Git
+}
+
+// Output checks path before a new plaintext file is written there.
+func (g Guard) Output(ctx context.Context, root, path string, policy Policy) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if Within(root, absPath) {
+		return refuse(path, ErrInsideVault)
+	}
+	exists := false
+	if !policy.Overwrite {
+		if _, err := os.Stat(absPath); err == nil {
+			exists = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	tracked := !policy.AllowGit && g.tracked(ctx, absPath)
+	switch {
+	case tracked && exists:
+		return fmt.Errorf("refusing to write plaintext to %s: %w and %w", path, ErrExists, ErrGitTracked)
+	case tracked:
+		return refuse(path, ErrGitTracked)
+	case exists:
+		return refuse(path, ErrExists)
+	}
+	return nil
+}
+
+// Update checks a plaintext file that is rewritten in place.
+func (g Guard) Update(ctx context.Context, root, path string, policy Policy) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if Within(root, absPath) {
+		return refuse(path, ErrInsideVault)
+	}
+	if !policy.AllowGit && g.tracked(ctx, absPath) {
+		return refuse(path, ErrGitTracked)
+	}
+	return nil
+}
+
+// WriteFile checks path with Output, then writes data with Write.
+func (g Guard) WriteFile(ctx context.Context, root, path string, data []byte, policy Policy) error {
+	if err := g.Output(ctx, root, path, policy); err != nil {
+		return err
+	}
+	return Write(path, data)
+}
+
+// Write stores plaintext owner-only, creating parent directories. Callers
+// check the path with Output or Update first.
+func Write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Truncating frees the old blocks without clearing them; zero them first.
+	if err := vaultfs.Overwrite(path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return vaultfs.Restrict(path, false)
+}
+
+// Within reports whether path lies strictly inside root.
+func Within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// tracked reports whether git tracks absPath; git errors (no repository,
+// no git) count as untracked.
+func (g Guard) tracked(ctx context.Context, absPath string) bool {
+	if g.Git == nil {
+		return false
+	}
+	repoRoot, err := g.Git.TopLevel(ctx, filepath.Dir(absPath))
+	if err != nil {
+		return false
+	}
+	tracked, err := g.Git.IsPathTracked(ctx, repoRoot, absPath)
+	return err == nil && tracked
+}
+
+func refuse(path string, reason error) error {
+	return fmt.Errorf("refusing to write plaintext to %s: %w", path, reason)
+}
@@ -3,26 +3,57 @@ package integration_test
 import (
 	"bytes"
 	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"testing/quick"
 	"time"
 
+	"github.com/aatuh/gitvault/guard"
+	"github.com/aatuh/gitvault/internal/agekey"
+	"github.com/aatuh/gitvault/internal/dotenv"
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/redact"
 	"github.com/aatuh/gitvault/internal/testutil"
+	"github.com/aatuh/gitvault/internal/vaultfs"
+	"github.com/aatuh/gitvault/testsupport"
+	"github.com/aatuh/sealr/domain"
+	fsinfra "github.com/aatuh/sealr/infra/fs"
+	"github.com/aatuh/sealr/services"
+	"golang.org/x/crypto/nacl/box"
 )
 
 var (
 	gitvaultBin string
 	sopsBin     string
 	ageKeyFile  string
+	userConfig  string
 	repoRoot    string
 	useRealSops = flag.Bool("real-sops", false, "use real sops binary instead of stub")
 	sopsPath    = flag.String("sops-path", "sops", "path to sops binary when -real-sops is set")
@@ -46,6 +77,7 @@ func TestMain(m *testing.M) {
 	defer os.RemoveAll(tmpDir)
 
 	gitvaultBin = filepath.Join(tmpDir, "gitvault")
+	userConfig = filepath.Join(tmpDir, "user-config.json")
 	sopsBin = filepath.Join(tmpDir, "sops")
 	if runtime.GOOS == "windows" {
 		gitvaultBin += ".exe"
@@ -115,9 +147,15 @@ type commandResult struct {
 }
 
 func runGitvault(t *testing.T, env map[string]string, args ...string) commandResult {
+	t.Helper()
+	return runGitvaultIn(t, "", env, args...)
+}
+
+func runGitvaultIn(t *testing.T, dir string, env map[string]string, args ...string) commandResult {
 	t.Helper()
 	cmd := exec.Command(gitvaultBin, args...)
-	cmd.Env = append(os.Environ(), "GITVAULT_SOPS_PATH="+sopsBin)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GITVAULT_SOPS_PATH="+sopsBin, "GITVAULT_CONFIG="+userConfig)
 	if ageKeyFile != "" {
 		cmd.Env = append(cmd.Env, "SOPS_AGE_KEY_FILE="+ageKeyFile)
 	}
@@ -245,7 +283,7 @@ func TestKeysLifecycle(t *testing.T) {
 		t.Fatalf("expected recipient in list")
 	}
 
-	newRecipient := "age1" + testutil.RandomString(t, 10)
+	newRecipient := randomRecipient(t)
 	add := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", newRecipient)
 	if add.ExitCode != 0 {
 		t.Fatalf("keys add failed: %s", add.Stderr)
@@ -256,7 +294,7 @@ func TestKeysLifecycle(t *testing.T) {
 		t.Fatalf("expected new recipient in list")
 	}
 
-	remove := runGitvault(t, nil, "--vault", vaultDir, "keys", "remove", recipient)
+	remove := runGitvault(t, nil, "--vault", vaultDir, "keys", "remove", "--force", recipient)
 	if remove.ExitCode != 0 {
 		t.Fatalf("keys remove failed: %s", remove.Stderr)
 	}
@@ -308,6 +346,18 @@ func TestSecretWorkflowAndListing(t *testing.T) {
 	if !strings.Contains(list.Stdout, "last_updated") {
 		t.Fatalf("expected last_updated header")
 	}
+	if strings.Contains(list.Stdout, value3) {
+		t.Fatalf("secret list leaked a value: %s", list.Stdout)
+	}
+
+	unconfirmed := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", project, envName, "--values")
+	if unconfirmed.ExitCode != 2 || strings.Contains(unconfirmed.Stdout, value3) {
+		t.Fatalf("expected --values to require confirmation, got %d: %s", unconfirmed.ExitCode, unconfirmed.Stdout)
+	}
+	withValues := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", project, envName, "--values", "--yes")
+	if withValues.ExitCode != 0 || !strings.Contains(withValues.Stdout, value3) {
+		t.Fatalf("expected values in output: %s %s", withValues.Stdout, withValues.Stderr)
+	}
 
 	allList := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--show-last-changed")
 	if allList.ExitCode != 0 {
@@ -320,6 +370,23 @@ func TestSecretWorkflowAndListing(t *testing.T) {
 		t.Fatalf("expected entries in list all output")
 	}
 
+	recent := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--since", "1h", "--sort", "last_updated")
+	if recent.ExitCode != 0 || !strings.Contains(recent.Stdout, key1) {
+		t.Fatalf("expected recent keys: %s %s", recent.Stdout, recent.Stderr)
+	}
+	old := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", project, envName, "--before", "2000-01-01")
+	if old.ExitCode != 0 || strings.Contains(old.Stdout, key1) {
+		t.Fatalf("expected no keys before 2000: %s %s", old.Stdout, old.Stderr)
+	}
+	paged := runGitvault(t, nil, "--vault", vaultDir, "--json", "secret", "list", project, envName, "--limit", "1", "--offset", "1")
+	if paged.ExitCode != 0 || !strings.Contains(paged.Stdout, `"data":[["`+key3+`"]]`) {
+		t.Fatalf("expected second key only: %s %s", paged.Stdout, paged.Stderr)
+	}
+	badWindow := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--since", "soon")
+	if badWindow.ExitCode != 2 {
+		t.Fatalf("expected usage error for invalid --since, got %d", badWindow.ExitCode)
+	}
+
 	find := runGitvault(t, nil, "--vault", vaultDir, "secret", "find", project)
 	if find.ExitCode != 0 {
 		t.Fatalf("secret find failed: %s", find.Stderr)
@@ -327,6 +394,14 @@ func TestSecretWorkflowAndListing(t *testing.T) {
 	if !strings.Contains(find.Stdout, project+"/"+envName+"/"+key1) {
 		t.Fatalf("secret find missing reference")
 	}
+	globFind := runGitvault(t, nil, "--vault", vaultDir, "secret", "find", "--glob", project+"/*/"+key1)
+	if globFind.ExitCode != 0 || !strings.Contains(globFind.Stdout, key1) || strings.Contains(globFind.Stdout, key3) {
+		t.Fatalf("secret find --glob mismatch: %s %s", globFind.Stdout, globFind.Stderr)
+	}
+	regexFind := runGitvault(t, nil, "--vault", vaultDir, "secret", "find", "--regex", "FLAG_KEY$")
+	if regexFind.ExitCode != 0 || !strings.Contains(regexFind.Stdout, key3) || strings.Contains(regexFind.Stdout, key1) {
+		t.Fatalf("secret find --regex mismatch: %s %s", regexFind.Stdout, regexFind.Stderr)
+	}
 
 	projectList := runGitvault(t, nil, "--vault", vaultDir, "project", "list")
 	if projectList.ExitCode != 0 {
@@ -605,6 +680,29 @@ func TestFileWorkflow(t *testing.T) {
 	if !strings.Contains(list.Stdout, "photo.jpg") {
 		t.Fatalf("expected file listed")
 	}
+	stats := runGitvault(t, nil, "--vault", vaultDir, "--json", "stats")
+	if stats.ExitCode != 0 {
+		t.Fatalf("stats failed: %s", stats.Stderr)
+	}
+	var statsPayload struct {
+		Data struct {
+			Files        int `json:"files"`
+			Recipients   int `json:"recipients"`
+			LargestFiles []struct {
+				Ref string `json:"ref"`
+			} `json:"largest_files"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(stats.Stdout), &statsPayload); err != nil {
+		t.Fatalf("parse stats json: %v", err)
+	}
+	if statsPayload.Data.Files != 1 || statsPayload.Data.Recipients != 1 || len(statsPayload.Data.LargestFiles) != 1 {
+		t.Fatalf("unexpected stats: %s", stats.Stdout)
+	}
+	find := runGitvault(t, nil, "--vault", vaultDir, "secret", "find", "--files", "--glob", project+"/*/*.jpg")
+	if find.ExitCode != 0 || !strings.Contains(find.Stdout, "file") || !strings.Contains(find.Stdout, "photo.jpg") {
+		t.Fatalf("expected typed file ref: %s %s", find.Stdout, find.Stderr)
+	}
 
 	outputPath := filepath.Join(t.TempDir(), "out.jpg")
 	get := runGitvault(t, nil, "--vault", vaultDir, "file", "get", "--project", project, "--env", envName, "--name", "photo.jpg", "--out", outputPath, "--force")
@@ -744,129 +842,5633 @@ func TestExportGuardrailsGitTracked(t *testing.T) {
 	}
 }
 
-func gitEnv() []string {
-	base := os.Environ()
-	base = append(base,
-		"GIT_AUTHOR_NAME=GitVault",
-		"GIT_AUTHOR_EMAIL=gitvault@example.com",
-		"GIT_COMMITTER_NAME=GitVault",
-		"GIT_COMMITTER_EMAIL=gitvault@example.com",
-	)
-	return base
-}
+func TestDoctorFixPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions only")
+	}
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
 
-func runGit(t *testing.T, dir string, env []string, args ...string) error {
-	t.Helper()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Dir = dir
-	cmd.Env = env
-	output, err := cmd.CombinedOutput()
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	set := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value")
+	if set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	secretPath := filepath.Join(vaultDir, "secrets", project, envName+".env")
+	for _, path := range []string{secretPath, filepath.Join(vaultDir, ".gitvault", "index.json")} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected 0600 for %s, got %04o", path, info.Mode().Perm())
+		}
+	}
+
+	if err := os.Chmod(secretPath, 0644); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	doctor := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if !strings.Contains(doctor.Stdout, "too permissive") || !strings.Contains(doctor.Stderr, "doctor --fix") {
+		t.Fatalf("expected permission warning, got: %s %s", doctor.Stdout, doctor.Stderr)
+	}
+	fixed := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--fix")
+	if fixed.ExitCode != 0 {
+		t.Fatalf("doctor --fix failed: %s", fixed.Stderr)
+	}
+	info, err := os.Stat(secretPath)
 	if err != nil {
-		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected permissions to be repaired, got %04o", info.Mode().Perm())
 	}
-	return nil
 }
 
-func randomIdentifier(t *testing.T) string {
-	t.Helper()
-	value := testutil.RandomString(t, 6)
-	value = strings.ReplaceAll(value, "-", "")
-	value = strings.ReplaceAll(value, "_", "")
-	return "p" + value
+func TestSecureFSRenameKeepsDirectoriesTraversable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions only")
+	}
+	secure := vaultfs.SecureFS{Base: fsinfra.OSFileSystem{}}
+	base := t.TempDir()
+	from := filepath.Join(base, "from")
+	if err := os.Mkdir(from, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(from, "file"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	to := filepath.Join(base, "to")
+	if err := secure.Rename(from, to); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	info, err := os.Stat(to)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != vaultfs.DirPerm {
+		t.Fatalf("expected %04o for a renamed directory, got %04o", vaultfs.DirPerm, info.Mode().Perm())
+	}
+	if _, err := os.ReadFile(filepath.Join(to, "file")); err != nil {
+		t.Fatalf("expected the renamed directory to stay traversable: %v", err)
+	}
 }
 
-func testRecipient(t *testing.T) string {
-	t.Helper()
-	if !*useRealSops {
-		return "age1" + testutil.RandomString(t, 8)
+func TestExportedFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions only")
 	}
-	if strings.TrimSpace(*sopsRecip) != "" {
-		return *sopsRecip
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
 	}
-	path := strings.TrimSpace(*sopsKeyFile)
-	if path == "" {
-		path = strings.TrimSpace(os.Getenv("SOPS_AGE_KEY_FILE"))
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
 	}
-	if path == "" {
-		home, err := os.UserHomeDir()
-		if err == nil {
-			path = filepath.Join(home, ".config", "sops", "age", "keys.txt")
+	outDir := t.TempDir()
+	fresh := filepath.Join(outDir, "fresh.env")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--out", fresh); result.ExitCode != 0 {
+		t.Fatalf("export failed: %s", result.Stderr)
+	}
+	loose := filepath.Join(outDir, "loose.env")
+	if err := os.WriteFile(loose, []byte("OLD=1\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.Chmod(loose, 0o644); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--out", loose, "--force"); result.ExitCode != 0 {
+		t.Fatalf("export --force failed: %s", result.Stderr)
+	}
+	for _, path := range []string{fresh, loose} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat %s: %v", path, err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected 0600 for exported %s, got %04o", path, info.Mode().Perm())
 		}
 	}
-	if path == "" {
-		t.Fatalf("real-sops requires -sops-recipient or a readable age key file")
+}
+
+func TestDoctorTempDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG_RUNTIME_DIR is unix only")
 	}
-	recipient, err := readAgeRecipient(path)
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	runtimeDir := t.TempDir()
+	private := runGitvault(t, map[string]string{"XDG_RUNTIME_DIR": runtimeDir}, "--vault", vaultDir, "--json", "doctor")
+	wantDir := filepath.Join(runtimeDir, "gitvault")
+	if !strings.Contains(private.Stdout, `"temp dir"`) || !strings.Contains(private.Stdout, wantDir) || strings.Contains(private.Stdout, "shared;") {
+		t.Fatalf("expected doctor to report %s as the temp dir, got: %s", wantDir, private.Stdout)
+	}
+	info, err := os.Stat(wantDir)
 	if err != nil {
-		t.Fatalf("resolve recipient: %v", err)
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode().Perm() != 0o700 {
+		t.Fatalf("expected 0700 for %s, got %04o", wantDir, info.Mode().Perm())
+	}
+	shared := runGitvault(t, map[string]string{"XDG_RUNTIME_DIR": ""}, "--vault", vaultDir, "--json", "doctor")
+	if !strings.Contains(shared.Stdout, "shared; plaintext temp files are owner-only") {
+		t.Fatalf("expected doctor to flag the shared temp dir, got: %s", shared.Stdout)
 	}
-	return recipient
 }
 
-func readAgeRecipient(path string) (string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", err
+func TestIdentityCommands(t *testing.T) {
+	if *useRealSops {
+		t.Skip("uses a fixed test identity")
 	}
-	for _, line := range strings.Split(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if !strings.HasPrefix(line, "#") {
-			continue
+	const (
+		identityKey       = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+		identityRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+	)
+	workDir := t.TempDir()
+	keyPath := filepath.Join(workDir, "work-keys.txt")
+	if err := os.WriteFile(keyPath, []byte(identityKey+"\n"), 0600); err != nil {
+		t.Fatalf("write identity: %v", err)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": filepath.Join(workDir, "config.json")}
+
+	add := runGitvault(t, env, "identity", "add", keyPath)
+	if add.ExitCode != 0 {
+		t.Fatalf("identity add failed: %s", add.Stderr)
+	}
+	list := runGitvault(t, env, "--json", "identity", "list")
+	if list.ExitCode != 0 {
+		t.Fatalf("identity list failed: %s", list.Stderr)
+	}
+	if !strings.Contains(list.Stdout, identityRecipient) {
+		t.Fatalf("expected derived recipient in list, got: %s", list.Stdout)
+	}
+
+	vaultDir := t.TempDir()
+	result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", identityRecipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	check := runGitvault(t, env, "--vault", vaultDir, "identity", "check")
+	if check.ExitCode != 0 {
+		t.Fatalf("identity check failed: %s %s", check.Stdout, check.Stderr)
+	}
+	if !strings.Contains(check.Stdout, "matches "+identityRecipient) {
+		t.Fatalf("expected recipient match, got: %s", check.Stdout)
+	}
+
+	other := t.TempDir()
+	result = runGitvault(t, nil, "init", "--path", other, "--name", "vault", "--recipient", testRecipient(t), "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	mismatch := runGitvault(t, env, "--vault", other, "identity", "check")
+	if mismatch.ExitCode == 0 {
+		t.Fatalf("expected identity check to fail for foreign recipients")
+	}
+}
+
+func TestObfuscatedNames(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git", "--obfuscate-names")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	value := "v" + testutil.RandomString(t, 12)
+	set := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", value)
+	if set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	inputPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(inputPath, []byte("certificate"), 0600); err != nil {
+		t.Fatalf("write input file: %v", err)
+	}
+	put := runGitvault(t, nil, "--vault", vaultDir, "file", "put", project, envName, "--path", inputPath)
+	if put.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", put.Stderr)
+	}
+	rotate := runGitvault(t, nil, "--vault", vaultDir, "keys", "rotate")
+	if rotate.ExitCode != 0 {
+		t.Fatalf("rotate failed: %s", rotate.Stderr)
+	}
+
+	err := filepath.Walk(vaultDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
-		lower := strings.ToLower(line)
-		const marker = "public key:"
-		idx := strings.Index(lower, marker)
-		if idx == -1 {
-			continue
+		if strings.Contains(path, project) || strings.Contains(path, envName) || strings.Contains(path, "cert.pem") {
+			t.Errorf("path reveals a name: %s", path)
 		}
-		return strings.TrimSpace(line[idx+len(marker):]), nil
+		if info.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), project) || strings.Contains(string(data), "API_KEY") {
+			t.Errorf("file %s reveals a name", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk vault: %v", err)
+	}
+
+	list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", project, envName)
+	if list.ExitCode != 0 || !strings.Contains(list.Stdout, "API_KEY") {
+		t.Fatalf("secret list failed: %s %s", list.Stdout, list.Stderr)
+	}
+	files := runGitvault(t, nil, "--vault", vaultDir, "file", "list", "--project", project, "--env", envName)
+	if files.ExitCode != 0 || !strings.Contains(files.Stdout, "cert.pem") {
+		t.Fatalf("file list failed: %s %s", files.Stdout, files.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export", project, envName)
+	if export.ExitCode != 0 || !strings.Contains(export.Stdout, value) {
+		t.Fatalf("export failed: %s %s", export.Stdout, export.Stderr)
 	}
-	return "", fmt.Errorf("no public key in %s; set -sops-recipient", path)
 }
 
-const sopsStubSource = `package main
+func TestSecretSetUnchanged(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
 
-import (
-	"encoding/base64"
-	"fmt"
-	"os"
-	"strings"
-)
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	value := "v" + testutil.RandomString(t, 12)
+	set := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", value)
+	if set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	meta, err := os.ReadFile(filepath.Join(vaultDir, ".gitvault", "meta.json"))
+	if err != nil || !strings.Contains(string(meta), "hmac-sha256:") {
+		t.Fatalf("expected content digest in meta.json: %v %s", err, meta)
+	}
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "missing args")
-		os.Exit(2)
+	paths := []string{
+		filepath.Join(vaultDir, "secrets", project, envName+".env"),
+		filepath.Join(vaultDir, ".gitvault", "index.json"),
+		filepath.Join(vaultDir, ".gitvault", "meta.json"),
+	}
+	before := map[string]string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		before[path] = string(data)
 	}
-	for _, arg := range os.Args[1:] {
-		if arg == "--version" {
-			fmt.Println("sops 0.0.0-test")
-			return
+	again := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", value)
+	if again.ExitCode != 0 || !strings.Contains(again.Stdout, "secret unchanged") {
+		t.Fatalf("expected unchanged set, got: %s %s", again.Stdout, again.Stderr)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if string(data) != before[path] {
+			t.Fatalf("expected %s to be untouched", path)
 		}
 	}
-	mode := ""
-	for _, arg := range os.Args[1:] {
-		switch arg {
-		case "--encrypt":
-			mode = "encrypt"
-		case "--decrypt":
-			mode = "decrypt"
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export", project, envName, "--out", envFile)
+	if export.ExitCode != 0 {
+		t.Fatalf("export failed: %s", export.Stderr)
+	}
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	logEnv := map[string]string{"GITVAULT_TEST_SOPS_LOG": sopsLog}
+	importResult := runGitvault(t, logEnv, "--vault", vaultDir, "--json", "secret", "import", project, envName, "--file", envFile)
+	if importResult.ExitCode != 0 || !strings.Contains(importResult.Stdout, `"unchanged":true`) {
+		t.Fatalf("expected unchanged import, got: %s %s", importResult.Stdout, importResult.Stderr)
+	}
+	apply := runGitvault(t, logEnv, "--vault", vaultDir, "--json", "secret", "apply", project, envName, "--file", envFile)
+	if apply.ExitCode != 0 || !strings.Contains(apply.Stdout, `"unchanged":true`) {
+		t.Fatalf("expected unchanged apply, got: %s %s", apply.Stdout, apply.Stderr)
+	}
+	if _, err := os.Stat(sopsLog); err == nil {
+		t.Fatalf("expected no sops calls for unchanged import/apply")
+	}
+}
+
+func TestDoctorDeep(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	good := randomIdentifier(t)
+	bad := randomIdentifier(t)
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, envName := range []string{good, bad} {
+		set := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value")
+		if set.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", set.Stderr)
 		}
 	}
-	file := os.Args[len(os.Args)-1]
-	data, err := os.ReadFile(file)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	inputPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(inputPath, []byte("certificate"), 0600); err != nil {
+		t.Fatalf("write input: %v", err)
 	}
-	switch mode {
-	case "encrypt":
-		encoded := base64.StdEncoding.EncodeToString(data)
-		fmt.Printf("ENC:%s", encoded)
-	case "decrypt":
-		text := string(data)
+	put := runGitvault(t, nil, "--vault", vaultDir, "file", "put", project, good, "--path", inputPath)
+	if put.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", put.Stderr)
+	}
+
+	deep := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--deep", "--parallel", "2")
+	if deep.ExitCode != 0 || !strings.Contains(deep.Stdout, "decrypted 3 path(s)") {
+		t.Fatalf("expected deep doctor to pass, got %d: %s %s", deep.ExitCode, deep.Stdout, deep.Stderr)
+	}
+
+	if err := os.WriteFile(filepath.Join(vaultDir, "secrets", project, bad+".env"), []byte("garbage"), 0600); err != nil {
+		t.Fatalf("corrupt secret: %v", err)
+	}
+	if err := os.Remove(filepath.Join(vaultDir, "files", project, good, "cert.pem")); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	deep = runGitvault(t, nil, "--vault", vaultDir, "--json", "doctor", "--deep")
+	if deep.ExitCode != 1 {
+		t.Fatalf("expected deep doctor to fail, got %d: %s", deep.ExitCode, deep.Stdout)
+	}
+	for _, want := range []string{
+		"decrypt " + project + "/" + bad,
+		"corrupt (secrets/" + project + "/" + bad + ".env)",
+		"missing ciphertext (files/" + project + "/" + good + "/cert.pem)",
+		"2 of 3 path(s) failed to decrypt",
+	} {
+		if !strings.Contains(deep.Stdout, want) {
+			t.Fatalf("expected %q in deep doctor output: %s", want, deep.Stdout)
+		}
+	}
+
+	invalid := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--deep", "--parallel", "0")
+	if invalid.ExitCode != 2 {
+		t.Fatalf("expected usage error for --parallel 0, got %d", invalid.ExitCode)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+	orphanEnv := randomIdentifier(t)
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	set := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value")
+	if set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	inputPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(inputPath, []byte("certificate"), 0600); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	put := runGitvault(t, nil, "--vault", vaultDir, "file", "put", project, envName, "--path", inputPath)
+	if put.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", put.Stderr)
+	}
+	clean := runGitvault(t, nil, "--vault", vaultDir, "fsck")
+	if clean.ExitCode != 0 || !strings.Contains(clean.Stdout, "consistent") {
+		t.Fatalf("expected consistent vault, got %d: %s %s", clean.ExitCode, clean.Stdout, clean.Stderr)
+	}
+
+	secretPath := filepath.Join(vaultDir, "secrets", project, envName+".env")
+	data, err := os.ReadFile(secretPath)
+	if err != nil {
+		t.Fatalf("read secret: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultDir, "secrets", project, orphanEnv+".env"), data, 0600); err != nil {
+		t.Fatalf("write orphan: %v", err)
+	}
+	if err := os.WriteFile(secretPath+".123.tmp", data, 0600); err != nil {
+		t.Fatalf("write temp: %v", err)
+	}
+	if err := os.Remove(filepath.Join(vaultDir, "files", project, envName, "cert.pem")); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+
+	doctor := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if !strings.Contains(doctor.Stdout, "index consistency") || !strings.Contains(doctor.Stderr, "gitvault fsck") {
+		t.Fatalf("expected doctor to report drift, got: %s %s", doctor.Stdout, doctor.Stderr)
+	}
+	drift := runGitvault(t, nil, "--vault", vaultDir, "fsck")
+	if drift.ExitCode != 1 {
+		t.Fatalf("expected fsck to fail, got %d: %s", drift.ExitCode, drift.Stdout)
+	}
+	for _, want := range []string{"orphan", "missing", "stale temp", project + "/" + orphanEnv} {
+		if !strings.Contains(drift.Stdout, want) {
+			t.Fatalf("expected %q in fsck output: %s", want, drift.Stdout)
+		}
+	}
+
+	fixed := runGitvault(t, nil, "--vault", vaultDir, "fsck", "--fix")
+	if fixed.ExitCode != 0 {
+		t.Fatalf("fsck --fix failed: %s %s", fixed.Stdout, fixed.Stderr)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", project, orphanEnv)
+	if list.ExitCode != 0 || !strings.Contains(list.Stdout, "API_KEY") {
+		t.Fatalf("expected orphan to be reindexed, got: %s %s", list.Stdout, list.Stderr)
+	}
+	files := runGitvault(t, nil, "--vault", vaultDir, "file", "list", project, envName)
+	if strings.Contains(files.Stdout, "cert.pem") {
+		t.Fatalf("expected missing file to be pruned: %s", files.Stdout)
+	}
+	if _, err := os.Stat(secretPath + ".123.tmp"); !os.IsNotExist(err) {
+		t.Fatalf("expected stale temp file to be removed, got %v", err)
+	}
+	clean = runGitvault(t, nil, "--vault", vaultDir, "fsck")
+	if clean.ExitCode != 0 {
+		t.Fatalf("expected consistent vault after fix, got %d: %s", clean.ExitCode, clean.Stdout)
+	}
+}
+
+func TestSopsVersionDetection(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	current := map[string]string{"GITVAULT_TEST_SOPS_LOG": sopsLog}
+	if set := runGitvault(t, current, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	legacy := map[string]string{"GITVAULT_TEST_SOPS_LOG": sopsLog, "GITVAULT_TEST_SOPS_VERSION": "3.7.3"}
+	if export := runGitvault(t, legacy, "--vault", vaultDir, "secret", "export", project, envName); export.ExitCode != 0 {
+		t.Fatalf("export with sops 3.7.3 failed: %s", export.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	if log := string(data); !strings.HasPrefix(log, "encrypt ") || !strings.Contains(log, "\n--decrypt ") {
+		t.Fatalf("expected subcommand for 3.9 and flag for 3.7, got:\n%s", log)
+	}
+
+	doctor := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if doctor.ExitCode != 0 || !strings.Contains(doctor.Stdout, "sops version") {
+		t.Fatalf("expected sops version check to pass, got %d: %s", doctor.ExitCode, doctor.Stdout)
+	}
+	old := map[string]string{"GITVAULT_TEST_SOPS_VERSION": "3.6.1"}
+	doctor = runGitvault(t, old, "--vault", vaultDir, "doctor")
+	if doctor.ExitCode != 1 || !strings.Contains(doctor.Stdout, "older than 3.7.0") {
+		t.Fatalf("expected old sops to fail doctor, got %d: %s", doctor.ExitCode, doctor.Stdout)
+	}
+	set := runGitvault(t, old, "--vault", vaultDir, "secret", "set", project, envName, "OTHER", "value")
+	if set.ExitCode == 0 || !strings.Contains(set.Stderr, "older than the minimum supported") {
+		t.Fatalf("expected old sops to be rejected, got %d: %s", set.ExitCode, set.Stderr)
+	}
+}
+
+func TestSopsExtraArgs(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := `{"sops":{"args":["--keyservice","tcp://localhost:5000"],"env":{"GITVAULT_TEST_SOPS_MARK":"from-config"}}}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	env := map[string]string{
+		"GITVAULT_CONFIG":        configPath,
+		"GITVAULT_TEST_SOPS_LOG": sopsLog,
+		"GITVAULT_SOPS_ARGS":     `--aws-profile "dev team"`,
+	}
+	if set := runGitvault(t, env, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	if want := "--keyservice tcp://localhost:5000 --aws-profile dev team mark=from-config"; !strings.Contains(string(data), want) {
+		t.Fatalf("expected %q in sops invocations, got:\n%s", want, data)
+	}
+
+	reserved := runGitvault(t, map[string]string{"GITVAULT_SOPS_ARGS": "--output /tmp/leak"}, "--vault", vaultDir, "secret", "list", project, envName)
+	if reserved.ExitCode != 2 || !strings.Contains(reserved.Stderr, "managed by gitvault") {
+		t.Fatalf("expected reserved sops argument to be rejected, got %d: %s", reserved.ExitCode, reserved.Stderr)
+	}
+}
+
+func TestSopsKeyservice(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedAddr := "tcp://" + closed.Addr().String()
+	closed.Close()
+
+	liveAddr := "tcp://" + listener.Addr().String()
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(config string) {
+		t.Helper()
+		if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	writeConfig(`{"sops":{"keyservices":["` + liveAddr + `"],"localKeyservice":false}}`)
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	env := map[string]string{"GITVAULT_CONFIG": configPath, "GITVAULT_TEST_SOPS_LOG": sopsLog}
+	if set := runGitvault(t, env, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	if want := "--keyservice " + liveAddr + " --enable-local-keyservice=false"; !strings.Contains(string(data), want) {
+		t.Fatalf("expected %q in sops invocations, got:\n%s", want, data)
+	}
+	doctor := runGitvault(t, env, "--vault", vaultDir, "doctor", "--no-remote")
+	if !strings.Contains(doctor.Stdout, "1 keyservice(s) reachable") {
+		t.Fatalf("expected reachable keyservice, got %d: %s", doctor.ExitCode, doctor.Stdout)
+	}
+
+	writeConfig(`{"sops":{"keyservices":["` + liveAddr + `","` + closedAddr + `"]}}`)
+	doctor = runGitvault(t, env, "--vault", vaultDir, "doctor", "--no-remote")
+	if doctor.ExitCode != 1 || !strings.Contains(doctor.Stdout, closedAddr+": unreachable") {
+		t.Fatalf("expected unreachable keyservice to fail doctor, got %d: %s", doctor.ExitCode, doctor.Stdout)
+	}
+
+	writeConfig(`{"sops":{"keyservices":["localhost:5000"]}}`)
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "list", project, envName); result.ExitCode != 2 || !strings.Contains(result.Stderr, "scheme must be tcp or unix") {
+		t.Fatalf("expected malformed keyservice to be rejected, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestRunnerTimeouts(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"timeouts":{"decrypt":"300ms"}}`), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": configPath, "GITVAULT_TEST_SOPS_DECRYPT_DELAY": "10s"}
+	start := time.Now()
+	result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", project, envName)
+	if result.ExitCode != 1 || !strings.Contains(result.Stderr, "sops decrypt timed out after 300ms") {
+		t.Fatalf("expected decrypt timeout, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the hung sops to be stopped, took %s", elapsed)
+	}
+	env["GITVAULT_TEST_SOPS_DECRYPT_DELAY"] = "100ms"
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", project, envName); result.ExitCode != 0 || !strings.Contains(result.Stdout, "API_KEY=value") {
+		t.Fatalf("expected decrypt within the limit, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"timeouts":{"network":"1m"}}`), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "list", project, envName); result.ExitCode != 2 || !strings.Contains(result.Stderr, "unknown timeout") {
+		t.Fatalf("expected unknown timeout to be rejected, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestSopsEnvironment(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	env := map[string]string{
+		"GITVAULT_TEST_SOPS_LOG":   sopsLog,
+		"GITVAULT_TEST_SOPS_PROBE": "LEAKY_TOKEN,AWS_PROFILE,SOPS_AGE_RECIPIENTS,PATH",
+		"LEAKY_TOKEN":              "should-not-reach-sops",
+		"AWS_PROFILE":              "dev",
+		"SOPS_AGE_RECIPIENTS":      recipient,
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", project, envName); result.ExitCode != 0 {
+		t.Fatalf("export-env failed: %s", result.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.Contains(line, "env=LEAKY_TOKEN") {
+			t.Fatalf("expected unrelated variables to be dropped, got %q", line)
+		}
+		if !strings.Contains(line, "env=AWS_PROFILE env=SOPS_AGE_RECIPIENTS env=PATH") {
+			t.Fatalf("expected sops, cloud, and PATH variables to be passed, got %q", line)
+		}
+	}
+}
+
+func TestErrorRedaction(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	fail := map[string]string{"GITVAULT_TEST_SOPS_FAIL": "encrypt"}
+	set := runGitvault(t, fail, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "hunter2-secret")
+	if set.ExitCode != 1 || strings.Contains(set.Stderr, "hunter2-secret") || !strings.Contains(set.Stderr, "API_KEY=[redacted]") {
+		t.Fatalf("expected the value to be masked in the sops error, got %d: %s", set.ExitCode, set.Stderr)
+	}
+	jsonSet := runGitvault(t, fail, "--json", "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", `quoted"secret`)
+	if jsonSet.ExitCode != 1 || strings.Contains(jsonSet.Stderr, "quoted") || !strings.Contains(jsonSet.Stderr, "[redacted]") {
+		t.Fatalf("expected the value to be masked in JSON errors, got %d: %s", jsonSet.ExitCode, jsonSet.Stderr)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "hunter2-secret"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	run := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", project, envName, "--", "sh", "-c", "echo $API_KEY >&2")
+	if run.ExitCode != 0 || !strings.Contains(run.Stderr, "hunter2-secret") {
+		t.Fatalf("expected the child's own stderr to pass through, got %d: %s", run.ExitCode, run.Stderr)
+	}
+}
+
+func TestPlaintextTempFiles(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	inputs := filepath.Join(t.TempDir(), "inputs.log")
+	env := map[string]string{"GITVAULT_TEST_SOPS_INPUTS": inputs}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", project, envName); result.ExitCode != 0 || !strings.Contains(result.Stdout, "API_KEY=value") {
+		t.Fatalf("export-env failed: %d %s", result.ExitCode, result.Stderr)
+	}
+	data, err := os.ReadFile(inputs)
+	if err != nil {
+		t.Fatalf("read inputs: %v", err)
+	}
+	paths := strings.Fields(string(data))
+	if len(paths) == 0 {
+		t.Fatal("expected sops to be handed input files")
+	}
+	for _, path := range paths {
+		if runtime.GOOS == "linux" && !strings.HasPrefix(path, "/proc/") {
+			t.Fatalf("expected an unnamed temp file on linux, got %s", path)
+		}
+		if runtime.GOOS != "linux" {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("expected %s to be removed, got %v", path, err)
+			}
+		}
+	}
+
+	outPath := filepath.Join(t.TempDir(), "app.env")
+	if err := os.WriteFile(outPath, []byte("OLD_SECRET=a-much-longer-previous-value\n"), 0600); err != nil {
+		t.Fatalf("write export: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, envName, "--out", outPath, "--force"); result.ExitCode != 0 {
+		t.Fatalf("export-env --force failed: %s", result.Stderr)
+	}
+	exported, err := os.ReadFile(outPath)
+	if err != nil || string(exported) != "API_KEY=value\n" {
+		t.Fatalf("expected the overwritten export to hold only the new values, got %q (%v)", exported, err)
+	}
+}
+
+// dotenvValue generates values built from the characters dotenv quoting and
+// comments trip over.
+type dotenvValue string
+
+var dotenvRunes = []rune("aZ09=$ \t\n\r#\"'\\\v\f\u00a0\u2028é😀")
+
+func (dotenvValue) Generate(r *mathrand.Rand, size int) reflect.Value {
+	runes := make([]rune, r.Intn(size+1))
+	for i := range runes {
+		runes[i] = dotenvRunes[r.Intn(len(dotenvRunes))]
+	}
+	return reflect.ValueOf(dotenvValue(runes))
+}
+
+func TestDotenvRoundTrip(t *testing.T) {
+	property := func(generated dotenvValue) bool {
+		value := string(generated)
+		values := map[string]string{"KEY": value}
+		rendered := dotenv.Render(values, []string{"KEY"})
+		loose, issues := domain.ParseDotenv(rendered)
+		if len(issues) > 0 || loose.Values["KEY"] != value {
+			t.Logf("sealr read %q back as %q (%v)", rendered, loose.Values["KEY"], issues)
+			return false
+		}
+		strict, issues := dotenv.ParseStrict(rendered)
+		if len(issues) > 0 || strict.Values["KEY"] != value {
+			t.Logf("strict parse read %q back as %q (%v)", rendered, strict.Values["KEY"], issues)
+			return false
+		}
+		stored, issues := domain.ParseDotenv(dotenv.Canonical(domain.RenderDotenv(values)))
+		if len(issues) > 0 || stored.Values["KEY"] != value {
+			t.Logf("canonical payload read back as %q (%v)", stored.Values["KEY"], issues)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportEnvStrict(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	dir := t.TempDir()
+	loose := filepath.Join(dir, "loose.env")
+	content := "HASH=abc #def\nPADDED=value \nESCAPE=\"C:\\dir\"\nOK=fine\n"
+	if err := os.WriteFile(loose, []byte(content), 0600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	rejected := runGitvault(t, nil, "--vault", vaultDir, "secret", "import-env", project, envName, "--file", loose, "--strict")
+	if rejected.ExitCode != 1 || !strings.Contains(rejected.Stderr, "line 1: HASH") || !strings.Contains(rejected.Stderr, "line 2: PADDED") || !strings.Contains(rejected.Stderr, `line 3: ESCAPE: unknown escape \d`) {
+		t.Fatalf("expected each ambiguous line to be reported, got %d: %s", rejected.ExitCode, rejected.Stderr)
+	}
+	if list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", project, envName); strings.Contains(list.Stdout, "OK") {
+		t.Fatalf("expected nothing imported, got %s", list.Stdout)
+	}
+
+	want := map[string]string{
+		"HASH":    "abc #def",
+		"PADDED":  "\u00a0value\u00a0",
+		"QUOTES":  `say "hi" it's`,
+		"SLASHES": `C:\dir\`,
+		"SPACES":  "  both  ",
+	}
+	exact := filepath.Join(dir, "exact.env")
+	content = "HASH=\"abc #def\" # kept as written\n" + string(dotenv.Render(want, []string{"PADDED", "QUOTES", "SLASHES", "SPACES"}))
+	if err := os.WriteFile(exact, []byte(content), 0600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "import-env", project, envName, "--file", exact, "--strict"); result.ExitCode != 0 {
+		t.Fatalf("strict import failed: %s", result.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, envName)
+	if export.ExitCode != 0 {
+		t.Fatalf("export-env failed: %s", export.Stderr)
+	}
+	got, issues := dotenv.ParseStrict([]byte(export.Stdout))
+	if len(issues) > 0 || !reflect.DeepEqual(got.Values, want) {
+		t.Fatalf("expected values to round-trip, got %q (%v) from:\n%s", got.Values, issues, export.Stdout)
+	}
+}
+
+func TestDockerEntrypoint(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "prod", "API_KEY", "from-vault"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	commitEnv := gitEnv()
+	if err := runGit(t, vaultDir, commitEnv, "add", "."); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, vaultDir, commitEnv, "commit", "-m", "init"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	runtimeDir := t.TempDir()
+	env := map[string]string{
+		"GITVAULT_REPO":      "file://" + vaultDir,
+		"GITVAULT_PROJECT":   "api",
+		"GITVAULT_ENV":       "prod",
+		"GITVAULT_GIT_TOKEN": "read-only-token",
+		"XDG_RUNTIME_DIR":    runtimeDir,
+	}
+	run := runGitvaultIn(t, t.TempDir(), env, "docker-entrypoint", "sh", "-c", `echo "$API_KEY ${GITVAULT_GIT_TOKEN:-unset} $1"`, "sh", "--port")
+	if run.ExitCode != 0 || strings.TrimSpace(run.Stdout) != "from-vault unset --port" {
+		t.Fatalf("expected the command to run with the vault env and its own args, got %d: %q %s", run.ExitCode, run.Stdout, run.Stderr)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(runtimeDir, "gitvault")); len(entries) != 0 {
+		t.Fatalf("expected the clone to be removed, found %d entries", len(entries))
+	}
+
+	mounted := runGitvaultIn(t, t.TempDir(), map[string]string{"GITVAULT_VAULT": vaultDir}, "docker-entrypoint", "--project", "api", "--env", "prod", "--", "sh", "-c", "echo $API_KEY")
+	if mounted.ExitCode != 0 || strings.TrimSpace(mounted.Stdout) != "from-vault" {
+		t.Fatalf("expected a mounted vault to work without cloning, got %d: %q %s", mounted.ExitCode, mounted.Stdout, mounted.Stderr)
+	}
+	if result := runGitvaultIn(t, t.TempDir(), map[string]string{"GITVAULT_VAULT": vaultDir}, "docker-entrypoint", "true"); result.ExitCode != 2 || !strings.Contains(result.Stderr, "GITVAULT_PROJECT") {
+		t.Fatalf("expected a usage error without project/env, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	missing := runGitvaultIn(t, t.TempDir(), map[string]string{"GITVAULT_REPO": "file://" + filepath.Join(vaultDir, "missing"), "GITVAULT_PROJECT": "api", "GITVAULT_ENV": "prod"}, "docker-entrypoint", "true")
+	if missing.ExitCode != 1 || !strings.Contains(missing.Stderr, "clone") {
+		t.Fatalf("expected a clone failure, got %d: %s", missing.ExitCode, missing.Stderr)
+	}
+}
+
+func TestK8sSidecar(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for key, value := range map[string]string{"API_KEY": "first", "DB_URL": "postgres://db"} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", key, value); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	commitEnv := gitEnv()
+	commit := func(message string) {
+		t.Helper()
+		if err := runGit(t, vaultDir, commitEnv, "add", "."); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if err := runGit(t, vaultDir, commitEnv, "commit", "-m", message); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+	commit("init")
+	env := map[string]string{"GITVAULT_REPO": "file://" + vaultDir, "GITVAULT_PROJECT": "app", "GITVAULT_ENV": "prod"}
+
+	onceDir := t.TempDir()
+	once := runGitvault(t, env, "k8s-sidecar", "--once", "--format", "files", "--key", "DB_URL", "--out", onceDir)
+	if once.ExitCode != 0 {
+		t.Fatalf("k8s-sidecar --once failed: %s", once.Stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(onceDir, "DB_URL")); err != nil || string(data) != "postgres://db" {
+		t.Fatalf("expected DB_URL written as a file, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(onceDir, "API_KEY")); !os.IsNotExist(err) {
+		t.Fatalf("expected unselected keys to be left out, got %v", err)
+	}
+	if result := runGitvault(t, env, "k8s-sidecar", "--once", "--key", "MISSING", "--out", t.TempDir()); result.ExitCode != 1 || !strings.Contains(result.Stderr, "MISSING") {
+		t.Fatalf("expected a missing key to fail, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if result := runGitvault(t, env, "k8s-sidecar", "--once"); result.ExitCode != 2 {
+		t.Fatalf("expected a usage error without --out, got %d", result.ExitCode)
+	}
+
+	outDir := t.TempDir()
+	cmd := exec.Command(gitvaultBin, "k8s-sidecar", "--interval", "100ms", "--out", outDir)
+	cmd.Env = append(os.Environ(), "GITVAULT_SOPS_PATH="+sopsBin, "GITVAULT_CONFIG="+userConfig, "SOPS_AGE_KEY_FILE="+ageKeyFile)
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start k8s-sidecar: %v", err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			data, _ := os.ReadFile(filepath.Join(outDir, ".env"))
+			if strings.Contains(string(data), want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected .env to contain %q, got %q: %s", want, data, stderr.String())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	waitFor("API_KEY=first")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", "API_KEY", "rotated"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	commit("rotate")
+	waitFor("API_KEY=rotated")
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("expected a clean exit on SIGTERM, got %v: %s", err, stderr.String())
+	}
+}
+
+func TestTelemetryExport(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	var mu sync.Mutex
+	bodies := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], string(data))
+		mu.Unlock()
+	}))
+	defer server.Close()
+	env := map[string]string{"GITVAULT_OTEL": "1", "OTEL_EXPORTER_OTLP_ENDPOINT": server.URL}
+
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "telemetry-value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	mu.Lock()
+	traces, metrics := strings.Join(bodies["/v1/traces"], ""), strings.Join(bodies["/v1/metrics"], "")
+	mu.Unlock()
+	if !strings.Contains(traces, `"gitvault secret set"`) || !strings.Contains(traces, `"sops encrypt"`) {
+		t.Fatalf("expected command and sops spans, got %s", traces)
+	}
+	if !strings.Contains(metrics, "gitvault.command.duration") || !strings.Contains(metrics, "gitvault.call.duration") {
+		t.Fatalf("expected duration histograms, got %s", metrics)
+	}
+	for _, leak := range []string{"telemetry-value", "API_KEY", project, envName} {
+		if strings.Contains(traces+metrics, leak) {
+			t.Fatalf("expected %q to stay out of telemetry, got %s", leak, traces)
+		}
+	}
+
+	env["GITVAULT_OTEL_NAMES"] = "1"
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", project, envName, "--format", "bogus"); result.ExitCode != 2 {
+		t.Fatalf("expected a usage error, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	mu.Lock()
+	last := bodies["/v1/traces"][len(bodies["/v1/traces"])-1]
+	mu.Unlock()
+	if !strings.Contains(last, project) || !strings.Contains(last, `"usage"`) {
+		t.Fatalf("expected names and the failure type with GITVAULT_OTEL_NAMES, got %s", last)
+	}
+
+	dead := map[string]string{"GITVAULT_OTEL": "1", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://127.0.0.1:1"}
+	list := runGitvault(t, dead, "--vault", vaultDir, "secret", "list", project, envName)
+	if list.ExitCode != 0 || !strings.Contains(list.Stderr, "warning: telemetry") {
+		t.Fatalf("expected an unreachable collector to only warn, got %d: %s", list.ExitCode, list.Stderr)
+	}
+}
+
+func TestDecryptRateLimit(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, envName := range []string{"dev", "stage", "prod"} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", envName, "API_KEY", "value-"+envName); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	configDir := t.TempDir()
+	configPath := filepath.Join(configDir, "config.json")
+	alertLog := filepath.Join(configDir, "alert.txt")
+	config := fmt.Sprintf(`{"limits": {"decryptsPerMinute": 3, "warnEveryEnv": true, "alert": ["sh", "-c", "echo \"$GITVAULT_ALERT\" > %s"]}}`, alertLog)
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": configPath}
+	for i, envName := range []string{"dev", "stage", "prod"} {
+		result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", envName)
+		if result.ExitCode != 0 {
+			t.Fatalf("export-env %s failed: %s", envName, result.Stderr)
+		}
+		if warned := strings.Contains(result.Stderr, "3 different envs and files were decrypted within a minute"); warned != (i == 2) {
+			t.Fatalf("expected the anomaly warning only once every env was decrypted, got %q after %s", result.Stderr, envName)
+		}
+	}
+	if data, err := os.ReadFile(alertLog); err != nil || !strings.Contains(string(data), "decrypted within a minute") {
+		t.Fatalf("expected the alert command to run, got %q (%v)", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(configDir, "anomalies.log")); err != nil || !strings.Contains(string(data), "decrypted within a minute") {
+		t.Fatalf("expected the anomaly to be logged, got %q (%v)", data, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(configDir, "decrypts.log")); err != nil || strings.Contains(string(data), "app") || strings.Contains(string(data), "value-") {
+		t.Fatalf("expected a decrypt log without names or values, got %q (%v)", data, err)
+	}
+
+	limited := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if limited.ExitCode != 1 || !strings.Contains(limited.Stderr, "decryption rate limit reached") || strings.Contains(limited.Stdout, "value-dev") {
+		t.Fatalf("expected the fourth decryption within a minute to be refused, got %d: %s", limited.ExitCode, limited.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev"); result.ExitCode != 0 {
+		t.Fatalf("expected no limit without the config, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestSecretExportExecutable(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	value := "it's $HOME `id`"
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", value); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": filepath.Join(t.TempDir(), "config.json")}
+	script := filepath.Join(t.TempDir(), "dev.sh")
+	source := func() (string, error) {
+		output, err := exec.Command("sh", "-c", `. "$1" && printf %s "$TOKEN"`, "sh", script).CombinedOutput()
+		return string(output), err
+	}
+
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--executable", "--out", script); result.ExitCode != 0 {
+		t.Fatalf("export failed: %s", result.Stderr)
+	}
+	if got, err := source(); err != nil || got != value {
+		t.Fatalf("expected the script to export %q, got %q (%v)", value, got, err)
+	}
+	if err := os.Chmod(script, 0o644); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	if got, err := source(); err == nil || !strings.Contains(got, "readable by other users") || strings.Contains(got, value) {
+		t.Fatalf("expected a world-readable script to refuse, got %q (%v)", got, err)
+	}
+
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--executable", "--max-age", "1s", "--force", "--out", script); result.ExitCode != 0 {
+		t.Fatalf("export failed: %s", result.Stderr)
+	}
+	time.Sleep(2100 * time.Millisecond)
+	if got, err := source(); err == nil || !strings.Contains(got, "export it again") {
+		t.Fatalf("expected a stale script to refuse, got %q (%v)", got, err)
+	}
+
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--executable", "--format", "json", "--out", script); result.ExitCode != 2 {
+		t.Fatalf("expected --executable with json to be a usage error, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestExportPolicies(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, project := range []string{"app", "docs"} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "prod", "TOKEN", "prod-token"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	policies := `{"exportPolicies": [{"env": "prod", "export": "run"}, {"project": "docs", "env": "prod", "export": "any"}]}`
+	if err := os.MkdirAll(filepath.Join(vaultDir, ".gitvault"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitvault", "settings.json"), []byte(policies), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	outDir := t.TempDir()
+
+	refused := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "prod", "--out", filepath.Join(outDir, "app.env"))
+	if refused.ExitCode != 1 || !strings.Contains(refused.Stderr, "--allow-export-override") {
+		t.Fatalf("expected the export to be refused, got %d: %s", refused.ExitCode, refused.Stderr)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "app.env")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file to be written, got %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "get", "app", "prod", "cert.pem"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "export policy") {
+		t.Fatalf("expected file get to be refused, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "app", "prod", "--", "sh", "-c", "printf %s \"$TOKEN\""); result.ExitCode != 0 || result.Stdout != "prod-token" {
+		t.Fatalf("expected secret run to be allowed, got %d: %q %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "docs", "prod"); result.ExitCode != 0 || !strings.Contains(result.Stdout, "prod-token") {
+		t.Fatalf("expected the more specific policy to allow docs/prod, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	override := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "prod", "--allow-export-override")
+	if override.ExitCode != 0 || !strings.Contains(override.Stdout, "prod-token") || !strings.Contains(override.Stderr, "warning") {
+		t.Fatalf("expected the override to export with a warning, got %d: %s", override.ExitCode, override.Stderr)
+	}
+}
+
+func TestKeysListIdentity(t *testing.T) {
+	if *useRealSops {
+		t.Skip("uses a fixed test identity")
+	}
+	const (
+		identityKey       = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+		identityRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+	)
+	workDir := t.TempDir()
+	keyPath := filepath.Join(workDir, "work-keys.txt")
+	if err := os.WriteFile(keyPath, []byte(identityKey+"\n"), 0600); err != nil {
+		t.Fatalf("write identity: %v", err)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": filepath.Join(workDir, "config.json")}
+	if result := runGitvault(t, env, "identity", "add", keyPath); result.ExitCode != 0 {
+		t.Fatalf("identity add failed: %s", result.Stderr)
+	}
+	teammate := testRecipient(t)
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", teammate, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	missing := runGitvault(t, env, "--vault", vaultDir, "keys", "list", "--identity")
+	if missing.ExitCode != 0 || !strings.Contains(missing.Stderr, "keys add "+identityRecipient) {
+		t.Fatalf("expected a warning naming the recipient to add, got %d: %s", missing.ExitCode, missing.Stderr)
+	}
+
+	if result := runGitvault(t, env, "--vault", vaultDir, "keys", "add", identityRecipient); result.ExitCode != 0 {
+		t.Fatalf("keys add failed: %s", result.Stderr)
+	}
+	list := runGitvault(t, env, "--vault", vaultDir, "--json", "keys", "list", "--identity")
+	if list.ExitCode != 0 || strings.Contains(list.Stderr, "warning") {
+		t.Fatalf("keys list --identity failed: %d: %s", list.ExitCode, list.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(list.Stdout), &payload); err != nil {
+		t.Fatalf("parse keys list: %v: %s", err, list.Stdout)
+	}
+	identities := map[string]string{}
+	for _, row := range payload.Data {
+		identities[row[0]] = row[len(row)-1]
+	}
+	if identities[identityRecipient] != keyPath || identities[teammate] != "" {
+		t.Fatalf("expected only %s to be marked with %s, got %v", identityRecipient, keyPath, identities)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	workDir := t.TempDir()
+	keyPath := filepath.Join(workDir, "age", "keys.txt")
+	env := map[string]string{
+		"GITVAULT_CONFIG":   filepath.Join(workDir, "config.json"),
+		"HOME":              workDir,
+		"SOPS_AGE_KEY_FILE": keyPath,
+	}
+	first := runGitvaultIn(t, workDir, env, "setup")
+	if first.ExitCode != 0 || !strings.Contains(first.Stdout, "generated "+keyPath) {
+		t.Fatalf("expected setup to generate an identity, got %d: %s %s", first.ExitCode, first.Stdout, first.Stderr)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("stat identity: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected an owner-only identity file, got %v", info.Mode().Perm())
+	}
+	_, after, ok := strings.Cut(first.Stderr, "gitvault keys add ")
+	recipient := strings.TrimSpace(strings.SplitN(after, "\n", 2)[0])
+	if !ok || !strings.HasPrefix(recipient, "age1") {
+		t.Fatalf("expected the public key to send, got: %s", first.Stderr)
+	}
+	if list := runGitvaultIn(t, workDir, env, "identity", "list"); !strings.Contains(list.Stdout, recipient) {
+		t.Fatalf("expected the generated identity to derive %s, got: %s", recipient, list.Stdout)
+	}
+
+	vaultDir := filepath.Join(workDir, "vault")
+	if result := runGitvaultIn(t, workDir, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvaultIn(t, workDir, env, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	pending := runGitvaultIn(t, workDir, env, "--vault", vaultDir, "setup")
+	if pending.ExitCode != 0 || !strings.Contains(pending.Stdout, "not a recipient") || !strings.Contains(pending.Stdout, "using "+keyPath) {
+		t.Fatalf("expected setup to reuse the identity and report pending access, got %d: %s %s", pending.ExitCode, pending.Stdout, pending.Stderr)
+	}
+
+	if result := runGitvaultIn(t, workDir, env, "--vault", vaultDir, "keys", "add", recipient); result.ExitCode != 0 {
+		t.Fatalf("keys add failed: %s", result.Stderr)
+	}
+	if result := runGitvaultIn(t, workDir, env, "--vault", vaultDir, "keys", "rotate"); result.ExitCode != 0 {
+		t.Fatalf("keys rotate failed: %s", result.Stderr)
+	}
+	done := runGitvaultIn(t, workDir, env, "--json", "--vault", vaultDir, "setup")
+	if done.ExitCode != 0 || !strings.Contains(done.Stdout, `["vault access","ok","decrypted`) {
+		t.Fatalf("expected setup to confirm decryption, got %d: %s %s", done.ExitCode, done.Stdout, done.Stderr)
+	}
+}
+
+func TestDoctorTimestamps(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	timestamps := func() string {
+		t.Helper()
+		result := runGitvault(t, nil, "--vault", vaultDir, "--json", "doctor", "--no-remote")
+		var payload struct {
+			Data [][]string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+			t.Fatalf("parse doctor: %v: %s", err, result.Stdout)
+		}
+		for _, row := range payload.Data {
+			if row[0] == "timestamps" {
+				return row[1] + ": " + row[2]
+			}
+		}
+		t.Fatalf("expected a timestamps check, got: %s", result.Stdout)
+		return ""
+	}
+	if got := timestamps(); !strings.HasPrefix(got, "ok: ") {
+		t.Fatalf("expected consistent timestamps, got %q", got)
+	}
+
+	// A commit whose clock ran a day behind the machine that set the key.
+	env := append(gitEnv(), "GIT_COMMITTER_DATE="+time.Now().Add(-24*time.Hour).Format(time.RFC3339))
+	if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, vaultDir, env, "commit", "-q", "-m", "set TOKEN"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	if got := timestamps(); !strings.Contains(got, "app/dev/TOKEN") || !strings.Contains(got, "after the commit that recorded it") {
+		t.Fatalf("expected a timestamp later than its commit, got %q", got)
+	}
+
+	indexPath := filepath.Join(vaultDir, ".gitvault", "index.json")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	future := regexp.MustCompile(`"lastUpdated": "[^"]+"`).ReplaceAll(data, []byte(`"lastUpdated": "2099-01-01T00:00:00Z"`))
+	if err := os.WriteFile(indexPath, future, 0o600); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	if got := timestamps(); !strings.HasPrefix(got, "warn: ") || !strings.Contains(got, "1 timestamp(s) in the future") {
+		t.Fatalf("expected a future timestamp warning, got %q", got)
+	}
+}
+
+func TestVaultPathPointer(t *testing.T) {
+	parent := t.TempDir()
+	vaultDir := filepath.Join(parent, "vault")
+	appDir := filepath.Join(parent, "app")
+	nested := filepath.Join(appDir, "src")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, ".gitvault-path"), []byte("# shared vault checkout\n../vault\n"), 0o644); err != nil {
+		t.Fatalf("write pointer: %v", err)
+	}
+	if result := runGitvaultIn(t, nested, nil, "secret", "set", "myapp", "dev", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set through the pointer failed: %s", result.Stderr)
+	}
+	if list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "myapp", "dev"); !strings.Contains(list.Stdout, "API_KEY") {
+		t.Fatalf("expected the key in the pointed-to vault: %s %s", list.Stdout, list.Stderr)
+	}
+	if result := runGitvaultIn(t, appDir, nil, "link", "--map", "src=myapp"); result.ExitCode != 1 || !strings.Contains(result.Stderr, ".gitvault.ref") {
+		t.Fatalf("expected mappings on a pointer to be refused, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	if err := os.WriteFile(filepath.Join(appDir, ".gitvault-path"), []byte("../missing\n"), 0o644); err != nil {
+		t.Fatalf("write pointer: %v", err)
+	}
+	if result := runGitvaultIn(t, nested, nil, "secret", "list", "myapp", "dev"); result.ExitCode == 0 || !strings.Contains(result.Stderr, ".gitvault-path") {
+		t.Fatalf("expected a broken pointer to be reported, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestSecretImportCompose(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "PORT", "9000"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	compose := `services:
+  api:
+    image: example/api
+    environment:
+      - PORT=8080
+      - "GREETING=hello # world"
+      - PRICE=$$5
+      - HOST_TOKEN
+      - DATABASE_URL=${DATABASE_URL}
+  worker:
+    environment:
+      QUEUE: 'jobs'  # comment
+      RETRIES: 3
+  db:
+    image: postgres
+`
+	workDir := t.TempDir()
+	composePath := filepath.Join(workDir, "docker-compose.yml")
+	if err := os.WriteFile(composePath, []byte(compose), 0o600); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+
+	result := runGitvaultIn(t, workDir, nil, "--vault", vaultDir, "secret", "import-compose", "--env", "dev", "--service", "api", "--service", "worker=jobs")
+	if result.ExitCode != 0 {
+		t.Fatalf("import-compose failed: %s", result.Stderr)
+	}
+	if !strings.Contains(result.Stderr, "HOST_TOKEN") || !strings.Contains(result.Stderr, "DATABASE_URL") {
+		t.Fatalf("expected warnings for skipped entries, got: %s", result.Stderr)
+	}
+	exported := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev")
+	if exported.ExitCode != 0 {
+		t.Fatalf("export failed: %s", exported.Stderr)
+	}
+	for _, want := range []string{"PORT=9000", "hello # world", "$5"} {
+		if !strings.Contains(exported.Stdout, want) {
+			t.Fatalf("expected %q in export, got:\n%s", want, exported.Stdout)
+		}
+	}
+	if strings.Contains(exported.Stdout, "DATABASE_URL") || strings.Contains(exported.Stdout, "HOST_TOKEN") {
+		t.Fatalf("expected skipped entries to stay out of the vault, got:\n%s", exported.Stdout)
+	}
+	if jobs := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "jobs", "dev"); jobs.ExitCode != 0 || !strings.Contains(jobs.Stdout, "QUEUE=jobs") || !strings.Contains(jobs.Stdout, "RETRIES=3") {
+		t.Fatalf("expected the worker service in project jobs, got %d: %s %s", jobs.ExitCode, jobs.Stdout, jobs.Stderr)
+	}
+
+	preferFile := runGitvaultIn(t, workDir, nil, "--vault", vaultDir, "secret", "import-compose", "--env", "dev", "--service", "api", "--strategy", "prefer-file")
+	if preferFile.ExitCode != 0 {
+		t.Fatalf("import-compose prefer-file failed: %s", preferFile.Stderr)
+	}
+	if exported := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev"); !strings.Contains(exported.Stdout, "PORT=8080") {
+		t.Fatalf("expected prefer-file to take the compose value, got:\n%s", exported.Stdout)
+	}
+
+	if missing := runGitvaultIn(t, workDir, nil, "--vault", vaultDir, "secret", "import-compose", "--env", "dev", "--service", "nope"); missing.ExitCode != 1 || !strings.Contains(missing.Stderr, "no service named nope") {
+		t.Fatalf("expected an unknown service to fail, got %d: %s", missing.ExitCode, missing.Stderr)
+	}
+	anchored := filepath.Join(workDir, "anchored.yml")
+	if err := os.WriteFile(anchored, []byte("services:\n  api:\n    environment: *common\n"), 0o600); err != nil {
+		t.Fatalf("write compose: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "import-compose", "--env", "dev", "--file", anchored); result.ExitCode != 1 || !strings.Contains(result.Stderr, "docker compose config") {
+		t.Fatalf("expected aliases to be rejected, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestSecretExportForShellEval(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", "it's-secret"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+
+	exports := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--for-shell", "sh")
+	if exports.ExitCode != 0 || exports.Stdout != "export TOKEN='it'\\''s-secret'\n" {
+		t.Fatalf("unexpected sh output, got %d: %q %s", exports.ExitCode, exports.Stdout, exports.Stderr)
+	}
+	loader := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--for-shell", "eval")
+	if loader.ExitCode != 0 {
+		t.Fatalf("for-shell eval failed: %s", loader.Stderr)
+	}
+	if strings.Contains(loader.Stdout, "s-secret") {
+		t.Fatalf("expected the loader to hold no values, got:\n%s", loader.Stdout)
+	}
+	shellEnv := append(os.Environ(), "GITVAULT_SOPS_PATH="+sopsBin, "GITVAULT_CONFIG="+userConfig)
+	if ageKeyFile != "" {
+		shellEnv = append(shellEnv, "SOPS_AGE_KEY_FILE="+ageKeyFile)
+	}
+	evalIn := func(script string, args ...string) (string, error) {
+		cmd := exec.Command("sh", append([]string{"-c", script, "sh", loader.Stdout}, args...)...)
+		cmd.Env = shellEnv
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}
+	if output, err := evalIn(`eval "$1" && printf %s "$TOKEN"`); err != nil || output != "it's-secret" {
+		t.Fatalf("expected eval to load the value, got %v: %s", err, output)
+	}
+	output, err := evalIn(`set -x; eval "$1" && printf %s "$TOKEN"`)
+	if err == nil || !strings.Contains(output, "set -x") || strings.Contains(output, "s-secret") {
+		t.Fatalf("expected eval under set -x to refuse without tracing values, got %v: %s", err, output)
+	}
+	logPath := filepath.Join(t.TempDir(), "log")
+	if output, err := evalIn(`eval "$1" > "$2" && printf %s "$TOKEN"`, logPath); err == nil || !strings.Contains(output, "redirected to a file") {
+		t.Fatalf("expected eval with stdout in a file to refuse, got %v: %s", err, output)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--for-shell", "eval", "--out", filepath.Join(t.TempDir(), "x")); result.ExitCode != 2 {
+		t.Fatalf("expected --for-shell with --out to be a usage error, got %d", result.ExitCode)
+	}
+}
+
+func TestIdentityImportKeyring(t *testing.T) {
+	if *useRealSops {
+		t.Skip("checks the identities the sops stub receives")
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("fakes the secret-tool backend")
+	}
+	const identityKey = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+	workDir := t.TempDir()
+	binDir := filepath.Join(workDir, "bin")
+	if err := os.Mkdir(binDir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	store := filepath.Join(workDir, "keyring")
+	fakeSecretTool := `#!/bin/sh
+case "$1" in
+store) cat > "$FAKE_KEYRING" ;;
+lookup) [ -f "$FAKE_KEYRING" ] && cat "$FAKE_KEYRING" ;;
+*) exit 2 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "secret-tool"), []byte(fakeSecretTool), 0o700); err != nil {
+		t.Fatalf("write secret-tool: %v", err)
+	}
+	keyPath := filepath.Join(workDir, "keys.txt")
+	if err := os.WriteFile(keyPath, []byte("# public key: unused\n"+identityKey+"\n"), 0o600); err != nil {
+		t.Fatalf("write identity: %v", err)
+	}
+	env := map[string]string{
+		"PATH":              binDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"FAKE_KEYRING":      store,
+		"GITVAULT_CONFIG":   filepath.Join(workDir, "config.json"),
+		"SOPS_AGE_KEY_FILE": filepath.Join(workDir, "missing.txt"),
+	}
+
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", "from-keyring"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	env["GITVAULT_TEST_SOPS_REQUIRE_KEYS"] = identityKey
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev"); result.ExitCode == 0 {
+		t.Fatalf("expected decrypt to fail before the identity is imported, got: %s", result.Stdout)
+	}
+
+	imported := runGitvault(t, env, "identity", "import", "--keyring", "--file", keyPath)
+	if imported.ExitCode != 0 {
+		t.Fatalf("identity import failed: %s", imported.Stderr)
+	}
+	stored, err := os.ReadFile(store)
+	if err != nil || strings.TrimSpace(string(stored)) != identityKey {
+		t.Fatalf("expected the identity in the keyring, got %q (%v)", stored, err)
+	}
+	exported := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if exported.ExitCode != 0 || !strings.Contains(exported.Stdout, "from-keyring") {
+		t.Fatalf("expected decrypt through the keyring identity, got %d: %s %s", exported.ExitCode, exported.Stdout, exported.Stderr)
+	}
+	env["GITVAULT_TEST_SOPS_VERSION"] = "3.7.3"
+	if legacy := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev"); legacy.ExitCode != 0 || !strings.Contains(legacy.Stdout, "from-keyring") {
+		t.Fatalf("expected older sops to get the keyring identity through a key file, got %d: %s", legacy.ExitCode, legacy.Stderr)
+	}
+}
+
+func TestAgeKeyFilesMergeWithOwnKeyFile(t *testing.T) {
+	if *useRealSops {
+		t.Skip("checks the identities the sops stub receives")
+	}
+	const (
+		ownKey   = "AGE-SECRET-KEY-1OWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWNOWN"
+		extraKey = "AGE-SECRET-KEY-1EXTRAEXTRAEXTRAEXTRAEXTRAEXTRAEXTRAEXTRAEXTRAEXTRAEXTRAEXTRA"
+	)
+	workDir := t.TempDir()
+	ownPath := filepath.Join(workDir, "own.txt")
+	extraPath := filepath.Join(workDir, "extra.txt")
+	placeholder := filepath.Join(workDir, "placeholder.txt")
+	for path, content := range map[string]string{ownPath: ownKey + "\n", extraPath: extraKey + "\n", placeholder: "# add a key here\n"} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	env := map[string]string{
+		"GITVAULT_CONFIG":        filepath.Join(workDir, "config.json"),
+		"SOPS_AGE_KEY_FILE":      ownPath,
+		"GITVAULT_AGE_KEY_FILES": placeholder + string(os.PathListSeparator) + extraPath,
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", "merged"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	env["GITVAULT_TEST_SOPS_REQUIRE_KEYS"] = ownKey + "," + extraKey
+	for _, version := range []string{"3.9.1", "3.7.3"} {
+		env["GITVAULT_TEST_SOPS_VERSION"] = version
+		result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+		if result.ExitCode != 0 || !strings.Contains(result.Stdout, "merged") {
+			t.Fatalf("sops %s: expected both the own and the extra identity, got %d: %s", version, result.ExitCode, result.Stderr)
+		}
+	}
+}
+
+func TestObfuscatedVaultSealsSettings(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git", "--obfuscate-names"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "prod", "TOKEN", "prod-token"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	settingsPath := filepath.Join(vaultDir, ".gitvault", "settings.json")
+	policies := `{"obfuscateNames": true, "exportPolicies": [{"project": "` + project + `", "env": "prod", "export": "run"}]}`
+	if err := os.WriteFile(settingsPath, []byte(policies), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+
+	refused := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "prod")
+	if refused.ExitCode != 1 || !strings.Contains(refused.Stderr, "export policy") {
+		t.Fatalf("expected the export policy to apply, got %d: %s", refused.ExitCode, refused.Stderr)
+	}
+	raw, err := os.ReadFile(settingsPath)
+	if err != nil {
+		t.Fatalf("read settings: %v", err)
+	}
+	if strings.Contains(string(raw), project) || json.Valid(raw) && !strings.Contains(string(raw), `"sops"`) {
+		t.Fatalf("expected settings to be sealed on disk, got: %s", raw)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "prod"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "export policy") {
+		t.Fatalf("expected the sealed export policy to still apply, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	check := runGitvault(t, nil, "--vault", vaultDir, "--json", "ci", "check")
+	var report struct {
+		Data []struct {
+			Check  string `json:"check"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(check.Stdout), &report); err != nil {
+		t.Fatalf("parse ci check: %v: %s", err, check.Stdout)
+	}
+	for _, row := range report.Data {
+		if row.Check == "vault settings" && row.Status == "fail" {
+			t.Fatalf("expected sealed settings to pass ci check, got: %s", check.Stdout)
+		}
+	}
+}
+
+func TestFilePutDirectory(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	certs := t.TempDir()
+	for _, name := range []string{"ca.pem", "server.key"} {
+		if err := os.WriteFile(filepath.Join(certs, name), []byte(name+" contents"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(certs, "old"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "prod", "--path", certs, "--name", "x"); result.ExitCode != 2 {
+		t.Fatalf("expected --name with a directory to be a usage error, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	put := runGitvault(t, nil, "--vault", vaultDir, "--json", "file", "put", "app", "prod", "--path", certs)
+	if put.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", put.Stderr)
+	}
+	var response struct {
+		Data struct {
+			Files []struct {
+				Name string `json:"name"`
+			} `json:"files"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(put.Stdout), &response); err != nil {
+		t.Fatalf("parse file put: %v: %s", err, put.Stdout)
+	}
+	if len(response.Data.Files) != 2 || response.Data.Files[0].Name != "ca.pem" || response.Data.Files[1].Name != "server.key" {
+		t.Fatalf("expected both files to be stored, got: %s", put.Stdout)
+	}
+	for _, name := range []string{"ca.pem", "server.key"} {
+		get := runGitvault(t, nil, "--vault", vaultDir, "file", "get", "app", "prod", name)
+		if get.ExitCode != 0 || get.Stdout != name+" contents" {
+			t.Fatalf("file get %s: %d %q %s", name, get.ExitCode, get.Stdout, get.Stderr)
+		}
+	}
+}
+
+func TestDigestKeyStaysOutOfVault(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	metaPath := filepath.Join(vaultDir, ".gitvault", "meta.json")
+	legacy := `{"version": 1, "salt": "00112233", "projects": {"old": {"envs": {"prod": {"digest": "hmac-sha256:aa", "keys": {"TOKEN": "hmac-sha256:bb"}, "audiences": {"TOKEN": ["ci"]}}}}}}`
+	if err := os.WriteFile(metaPath, []byte(legacy), 0o600); err != nil {
+		t.Fatalf("write meta: %v", err)
+	}
+	for _, kv := range [][2]string{{"DB_PASSWORD", "shared-password-123"}, {"OTHER_PASSWORD", "shared-password-123"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "prod", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	meta, err := os.ReadFile(metaPath)
+	if err != nil {
+		t.Fatalf("read meta: %v", err)
+	}
+	if strings.Contains(string(meta), "salt") || !strings.Contains(string(meta), `"digestKey"`) {
+		t.Fatalf("expected digests tagged with a key kept outside the vault: %s", meta)
+	}
+	if strings.Contains(string(meta), "hmac-sha256:aa") || strings.Contains(string(meta), "hmac-sha256:bb") || !strings.Contains(string(meta), `"ci"`) {
+		t.Fatalf("expected salted legacy digests dropped and audiences kept: %s", meta)
+	}
+	key, err := os.ReadFile(filepath.Join(filepath.Dir(userConfig), "digest.key"))
+	if err != nil || bytes.Contains(meta, bytes.TrimSpace(key)) {
+		t.Fatalf("expected the digest key next to the user config only: %v", err)
+	}
+
+	same := runGitvault(t, nil, "--vault", vaultDir, "secret", "dedup-report", "--from-index")
+	if same.ExitCode != 0 || !strings.Contains(same.Stdout, "api/prod/OTHER_PASSWORD") {
+		t.Fatalf("expected duplicates from the index, got %d: %s %s", same.ExitCode, same.Stdout, same.Stderr)
+	}
+	elsewhere := map[string]string{"GITVAULT_CONFIG": filepath.Join(t.TempDir(), "config.json")}
+	other := runGitvault(t, elsewhere, "--vault", vaultDir, "secret", "dedup-report", "--from-index")
+	if other.ExitCode != 1 || !strings.Contains(other.Stderr, "skipped api/prod") {
+		t.Fatalf("expected another machine's digests to be untrusted, got %d: %s %s", other.ExitCode, other.Stdout, other.Stderr)
+	}
+}
+
+func TestRedactMasksByFingerprint(t *testing.T) {
+	redact.Add("hunter2-secret", "hunter2-secret-longer", "tiny", "  padded-value  ")
+	cases := map[string]string{
+		"sops: API_KEY=hunter2-secret failed":          "sops: API_KEY=[redacted] failed",
+		"got hunter2-secret-longer and hunter2-secret": "got [redacted] and [redacted]",
+		"xxhunter2-secretxx padded-value":              "xx[redacted]xx [redacted]",
+		"a tiny word stays":                            "a tiny word stays",
+		"hunter2-secre":                                "hunter2-secre",
+	}
+	for in, want := range cases {
+		if got := redact.String(in); got != want {
+			t.Fatalf("redact.String(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// recordingEncrypter hands out a fresh plaintext buffer per decrypt and
+// keeps it, so a test can see what the caller's memo did with it.
+type recordingEncrypter struct {
+	plaintext string
+	returned  [][]byte
+}
+
+func (r *recordingEncrypter) EncryptDotenv(context.Context, []byte, []string) ([]byte, error) {
+	return []byte("ENC"), nil
+}
+
+func (r *recordingEncrypter) DecryptDotenv(context.Context, []byte) ([]byte, error) {
+	buf := []byte(r.plaintext)
+	r.returned = append(r.returned, buf)
+	return buf, nil
+}
+
+func (r *recordingEncrypter) EncryptBinary(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	return r.EncryptDotenv(ctx, plaintext, recipients)
+}
+
+func (r *recordingEncrypter) DecryptBinary(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return r.DecryptDotenv(ctx, ciphertext)
+}
+
+func (r *recordingEncrypter) Version(context.Context) (string, error) {
+	return "3.9.0", nil
+}
+
+func TestStableWipeZeroesMemoizedPlaintext(t *testing.T) {
+	ctx := context.Background()
+	base := &recordingEncrypter{plaintext: "API_KEY=memoized-secret\n"}
+	stable := encryption.NewStable(base)
+	ciphertext := []byte("ENC:api")
+
+	first, err := stable.DecryptDotenv(ctx, ciphertext)
+	if err != nil || string(first) != base.plaintext {
+		t.Fatalf("decrypt: %q %v", first, err)
+	}
+	if again, err := stable.DecryptDotenv(ctx, ciphertext); err != nil || string(again) != base.plaintext || len(base.returned) != 1 {
+		t.Fatalf("expected a memoized second read, got %q %v after %d decrypt(s)", again, err, len(base.returned))
+	}
+
+	stable.Wipe()
+	if memo := base.returned[0]; !bytes.Equal(memo, make([]byte, len(memo))) {
+		t.Fatalf("expected the memoized plaintext to be zeroed, got %q", memo)
+	}
+	if string(first) != base.plaintext {
+		t.Fatalf("expected the caller's copy to survive the wipe, got %q", first)
+	}
+	after, err := stable.DecryptDotenv(ctx, ciphertext)
+	if err != nil || string(after) != base.plaintext || len(base.returned) != 2 {
+		t.Fatalf("expected a fresh decrypt after the wipe, got %q %v after %d decrypt(s)", after, err, len(base.returned))
+	}
+}
+
+func TestKeysRotateObfuscatedSnapshot(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	oldRecipient := testRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", oldRecipient, "--skip-git", "--obfuscate-names"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, env := range []string{"dev", "prod"} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", env, "TOKEN", "value"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	result := runGitvault(t, nil, "--json", "--vault", vaultDir, "keys", "rotate", "--details")
+	if result.ExitCode != 0 {
+		t.Fatalf("keys rotate failed: %s", result.Stderr)
+	}
+	if strings.Contains(result.Stdout, `"updated"`) || strings.Count(result.Stdout, `"skipped"`) != 2 {
+		t.Fatalf("expected both unchanged secrets to be skipped, got %s", result.Stdout)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "secrets", "api")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no directory under the real project name, got %v", err)
+	}
+
+	var physical []string
+	err := filepath.WalkDir(filepath.Join(vaultDir, "secrets"), func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.HasSuffix(path, ".env") {
+			physical = append(physical, path)
+		}
+		return err
+	})
+	if err != nil || len(physical) != 2 {
+		t.Fatalf("expected two stored envs, got %v: %v", physical, err)
+	}
+	original, err := os.ReadFile(physical[0])
+	if err != nil {
+		t.Fatalf("read secret: %v", err)
+	}
+	marked := []byte("sops_stub=" + string(original) + "\nmarker=1\n")
+	if err := os.WriteFile(physical[0], marked, 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.WriteFile(physical[1], []byte("not a ciphertext"), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	result = runGitvault(t, nil, "--vault", vaultDir, "keys", "rotate", "--replace", oldRecipient, randomRecipient(t))
+	if result.ExitCode != 1 || !strings.Contains(result.Stderr, "were restored") {
+		t.Fatalf("expected the failed swap to be rolled back, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if data, err := os.ReadFile(physical[0]); err != nil || string(data) != string(marked) {
+		t.Fatalf("expected the rewritten secret to be restored, got %q: %v", data, err)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if list.ExitCode != 0 || !strings.Contains(list.Stdout, oldRecipient) {
+		t.Fatalf("expected the old recipient back, got %d: %s %s", list.ExitCode, list.Stdout, list.Stderr)
+	}
+}
+
+func TestExportPolicyEveryOutput(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, ref := range [][3]string{{"dev", "K", "valuevalue"}, {"stage", "OTHER", "stagevalue"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", ref[0], ref[1], ref[2]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "alias", "app", "stage", "K", "--to", "app/dev/K"); result.ExitCode != 0 {
+		t.Fatalf("secret alias failed: %s", result.Stderr)
+	}
+	settingsPath := filepath.Join(vaultDir, ".gitvault", "settings.json")
+	if err := os.WriteFile(settingsPath, []byte(`{"exportPolicies":[{"env":"dev","export":"run"}]}`), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+
+	list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--values", "--yes")
+	if list.ExitCode != 1 || strings.Contains(list.Stdout, "valuevalue") || !strings.Contains(list.Stderr, "export policy") {
+		t.Fatalf("expected list --values to be refused, got %d: %s %s", list.ExitCode, list.Stdout, list.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "app", "stage", "--values", "--yes"); result.ExitCode != 1 || strings.Contains(result.Stdout, "valuevalue") {
+		t.Fatalf("expected an alias into dev to be refused, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	grep := runGitvault(t, nil, "--vault", vaultDir, "secret", "grep", "value", "--show-values", "--yes")
+	if grep.ExitCode != 1 || strings.Contains(grep.Stdout, "valuevalue") || !strings.Contains(grep.Stdout, "stagevalue") || !strings.Contains(grep.Stderr, "skipped app/dev") {
+		t.Fatalf("expected grep --show-values to skip app/dev, got %d: %s %s", grep.ExitCode, grep.Stdout, grep.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "grep", "valuevalue"); result.ExitCode != 0 || !strings.Contains(result.Stdout, "app/dev/K") {
+		t.Fatalf("expected grep without values to search app/dev, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "stage"); result.ExitCode != 1 || strings.Contains(result.Stdout, "valuevalue") {
+		t.Fatalf("expected exporting an alias into dev to be refused, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	local := filepath.Join(t.TempDir(), "dev.env")
+	if err := os.WriteFile(local, []byte("K=old\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--out", local, "--diff", "--show-values", "--yes"); result.ExitCode != 1 || strings.Contains(result.Stdout, "valuevalue") {
+		t.Fatalf("expected --diff --show-values to be refused, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--out", local, "--check"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "out of date") {
+		t.Fatalf("expected --check to stay allowed, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "env", "clone", "--project", "app", "--from", "dev", "--to", "tmp"); result.ExitCode != 0 {
+		t.Fatalf("env clone failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "tmp"); result.ExitCode != 1 || strings.Contains(result.Stdout, "valuevalue") {
+		t.Fatalf("expected the clone to keep the policy, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "env", "rename", "--project", "app", "tmp", "scratch"); result.ExitCode != 0 {
+		t.Fatalf("env rename failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "scratch"); result.ExitCode != 1 || strings.Contains(result.Stdout, "valuevalue") {
+		t.Fatalf("expected the rename to keep the policy, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "app", "scratch", "--", "sh", "-c", "printf %s \"$K\""); result.ExitCode != 0 || result.Stdout != "valuevalue" {
+		t.Fatalf("expected secret run to stay allowed, got %d: %q %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+}
+
+func TestMalformedUserConfig(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "TOKEN", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"limits": {"decryptsPerMinute": 1},}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": configPath}
+	result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if result.ExitCode != 2 || !strings.Contains(result.Stderr, configPath) || strings.Contains(result.Stdout, "TOKEN") {
+		t.Fatalf("expected a malformed config to stop the command, got %d: %s %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+}
+
+func TestK8sSidecarObfuscatedRefresh(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--obfuscate-names"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", "API_KEY", "first"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	commitEnv := gitEnv()
+	commit := func(message string) {
+		t.Helper()
+		if err := runGit(t, vaultDir, commitEnv, "add", "-A"); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if err := runGit(t, vaultDir, commitEnv, "commit", "-m", message); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+	commit("init")
+	env := map[string]string{"GITVAULT_REPO": "file://" + vaultDir, "GITVAULT_PROJECT": "app", "GITVAULT_ENV": "prod"}
+	if result := runGitvault(t, env, "k8s-sidecar", "--once", "--mode", "0644", "--out", t.TempDir()); result.ExitCode != 2 || !strings.Contains(result.Stderr, "--mode") {
+		t.Fatalf("expected a writable --mode to be refused, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	gid := strconv.Itoa(os.Getgid())
+	outDir := filepath.Join(t.TempDir(), "secrets")
+	cmd := exec.Command(gitvaultBin, "k8s-sidecar", "--interval", "100ms", "--mode", "0440", "--group", gid, "--out", outDir)
+	cmd.Env = append(os.Environ(), "GITVAULT_SOPS_PATH="+sopsBin, "GITVAULT_CONFIG="+userConfig, "SOPS_AGE_KEY_FILE="+ageKeyFile)
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start k8s-sidecar: %v", err)
+	}
+	defer func() { _ = cmd.Process.Kill() }()
+	waitFor := func(name string) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			if _, err := os.Stat(filepath.Join(outDir, name)); err == nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to be written: %s", name, stderr.String())
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	waitFor(".env")
+	info, err := os.Stat(filepath.Join(outDir, ".env"))
+	if err != nil || info.Mode().Perm() != 0440 {
+		t.Fatalf("expected .env with mode 0440, got %v (%v)", info.Mode().Perm(), err)
+	}
+	if info, err := os.Stat(outDir); err != nil || info.Mode().Perm() != 0710 {
+		t.Fatalf("expected the created directory with mode 0710, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// A file added upstream is only listed in the pulled index, so the
+	// sidecar has to reload the obfuscated layout to find it.
+	inputPath := filepath.Join(t.TempDir(), "tls.crt")
+	if err := os.WriteFile(inputPath, []byte("certificate"), 0600); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "prod", "--path", inputPath); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+	commit("add certificate")
+	waitFor("tls.crt")
+	if data, err := os.ReadFile(filepath.Join(outDir, "tls.crt")); err != nil || string(data) != "certificate" {
+		t.Fatalf("expected the new file written, got %q (%v)", data, err)
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("signal: %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("expected a clean exit on SIGTERM, got %v: %s", err, stderr.String())
+	}
+}
+
+func TestVaultGCKeepsBranchBlobs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	env := gitEnv()
+	setAndCommit := func(value string) {
+		t.Helper()
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", value); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+		if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if err := runGit(t, vaultDir, env, "commit", "-m", "set "+value); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+	obsolete := func() int {
+		t.Helper()
+		result := runGitvault(t, nil, "--json", "--vault", vaultDir, "gc", "--larger-than", "0")
+		if result.ExitCode != 0 {
+			t.Fatalf("gc failed: %s", result.Stderr)
+		}
+		var payload struct {
+			Data [][]string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+			t.Fatalf("parse gc: %v: %s", err, result.Stdout)
+		}
+		count := 0
+		for _, row := range payload.Data {
+			if row[0] == "secrets/api/dev.env" && row[1] == "obsolete" {
+				count++
+			}
+		}
+		return count
+	}
+	setAndCommit("first")
+	if err := runGit(t, vaultDir, env, "branch", "release"); err != nil {
+		t.Fatalf("git branch: %v", err)
+	}
+	setAndCommit("second")
+	if got := obsolete(); got != 0 {
+		t.Fatalf("expected the env file on the release branch to stay current, got %d obsolete version(s)", got)
+	}
+	setAndCommit("third")
+	if got := obsolete(); got != 1 {
+		t.Fatalf("expected only the version no ref uses to be obsolete, got %d", got)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	// "a-b/..." sorts before "a/...", so pages must follow full refs, not
+	// project names.
+	for _, ref := range [][]string{{"a", "dev", "K1"}, {"a", "dev", "K2"}, {"a-b", "dev", "K3"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", ref[0], ref[1], ref[2], "value"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	inputPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(inputPath, []byte("certificate"), 0600); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	for _, project := range []string{"a", "b"} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", project, "dev", "--path", inputPath); result.ExitCode != 0 {
+			t.Fatalf("file put failed: %s", result.Stderr)
+		}
+	}
+	data := func(args ...string) string {
+		t.Helper()
+		result := runGitvault(t, nil, append([]string{"--vault", vaultDir, "--json"}, args...)...)
+		if result.ExitCode != 0 {
+			t.Fatalf("%v failed: %s", args, result.Stderr)
+		}
+		var payload struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+			t.Fatalf("parse %v: %v: %s", args, err, result.Stdout)
+		}
+		return string(payload.Data)
+	}
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"secret", "list", "--limit", "2"}, `[["a-b/dev/K3"],["a/dev/K1"]]`},
+		{[]string{"secret", "list", "--limit", "2", "--offset", "2"}, `[["a/dev/K2"]]`},
+		{[]string{"secret", "list", "--offset", "5"}, `[]`},
+		{[]string{"secret", "list", "a", "dev", "--offset", "1"}, `[["K2"]]`},
+		{[]string{"secret", "list", "--sort", "last_updated", "--limit", "1"}, `[["a-b/dev/K3"]]`},
+		{[]string{"secret", "find", "--files", "--limit", "2", "--offset", "2"}, `[["key","a/dev/K2"],["file","a/dev/cert.pem"]]`},
+		{[]string{"find", "dev", "--limit", "1", "--offset", "3"}, `[["file:a/dev/cert.pem",`},
+		{[]string{"file", "list", "--limit", "1", "--offset", "1"}, `[["b/dev/cert.pem"]]`},
+	} {
+		// find rows end in a timestamp, so compare up to the first one.
+		if got := data(tc.args...); !strings.HasPrefix(got, tc.want) {
+			t.Fatalf("%v: expected %s, got %s", tc.args, tc.want, got)
+		}
+	}
+
+	first := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--limit", "2")
+	if first.ExitCode != 0 || !strings.Contains(first.Stderr, "use --offset 2 for more") {
+		t.Fatalf("expected a hint for the next page, got %d: %s", first.ExitCode, first.Stderr)
+	}
+	last := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--limit", "1", "--offset", "2")
+	if last.ExitCode != 0 || strings.Contains(last.Stderr, "for more") {
+		t.Fatalf("expected no hint on the last page, got %d: %s", last.ExitCode, last.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "--limit", "-1"); result.ExitCode != 2 {
+		t.Fatalf("expected a negative --limit to be rejected, got %d", result.ExitCode)
+	}
+}
+
+func TestPGPRecipients(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+	fingerprint := "85D77543B3D624B63CEA9E6DBC17301B491B3F21"
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	add := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", "pgp:"+strings.ToLower(fingerprint[:20])+" "+fingerprint[20:])
+	if add.ExitCode != 0 || !strings.Contains(add.Stdout, "pgp:"+fingerprint) {
+		t.Fatalf("expected normalized pgp recipient, got %d: %s %s", add.ExitCode, add.Stdout, add.Stderr)
+	}
+	invalid := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", "pgp:not-a-fingerprint")
+	if invalid.ExitCode != 2 {
+		t.Fatalf("expected invalid pgp recipient to be rejected, got %d", invalid.ExitCode)
+	}
+
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	if set := runGitvault(t, map[string]string{"GITVAULT_TEST_SOPS_LOG": sopsLog}, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	if want := "--age " + recipient + " --pgp " + fingerprint; !strings.Contains(string(data), want) {
+		t.Fatalf("expected %q in sops invocation, got:\n%s", want, data)
+	}
+
+	doctor := runGitvault(t, map[string]string{"SOPS_GPG_EXEC": "gitvault-missing-gpg"}, "--vault", vaultDir, "doctor")
+	if doctor.ExitCode != 1 || !strings.Contains(doctor.Stdout, "needed for pgp recipients") {
+		t.Fatalf("expected missing gpg to fail doctor, got %d: %s", doctor.ExitCode, doctor.Stdout)
+	}
+
+	remove := runGitvault(t, nil, "--vault", vaultDir, "keys", "remove", "pgp:"+strings.ToLower(fingerprint))
+	if remove.ExitCode != 0 {
+		t.Fatalf("keys remove failed: %s", remove.Stderr)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if strings.Contains(list.Stdout, fingerprint) {
+		t.Fatalf("expected pgp recipient to be removed: %s", list.Stdout)
+	}
+}
+
+func TestAgePluginRecipients(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+	plugin := "age1gvtest1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqe7kf2"
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if add := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", plugin); add.ExitCode != 0 {
+		t.Fatalf("keys add failed: %s", add.Stderr)
+	}
+
+	old := runGitvault(t, map[string]string{"GITVAULT_TEST_SOPS_VERSION": "3.9.1"}, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value")
+	if old.ExitCode == 0 || !strings.Contains(old.Stderr, "need sops 3.10.0") {
+		t.Fatalf("expected plugin recipients to need a newer sops, got %d: %s", old.ExitCode, old.Stderr)
+	}
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	env := map[string]string{"GITVAULT_TEST_SOPS_VERSION": "3.10.2", "GITVAULT_TEST_SOPS_LOG": sopsLog}
+	if set := runGitvault(t, env, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	if want := "--age " + recipient + "," + plugin; !strings.Contains(string(data), want) {
+		t.Fatalf("expected %q in sops invocation, got:\n%s", want, data)
+	}
+
+	doctor := runGitvault(t, map[string]string{"PATH": t.TempDir()}, "--vault", vaultDir, "doctor")
+	if !strings.Contains(doctor.Stdout, "age-plugin-gvtest") || !strings.Contains(doctor.Stdout, "not found in PATH") {
+		t.Fatalf("expected missing plugin check, got: %s", doctor.Stdout)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "age-plugin-gvtest"), []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	doctor = runGitvault(t, map[string]string{"PATH": binDir}, "--vault", vaultDir, "doctor")
+	if strings.Contains(doctor.Stdout, "not found in PATH") {
+		t.Fatalf("expected plugin to be found, got: %s", doctor.Stdout)
+	}
+}
+
+func TestKeyGroups(t *testing.T) {
+	vaultDir := t.TempDir()
+	first := testRecipient(t)
+	second := testRecipient(t)
+	third := testRecipient(t)
+	project := randomIdentifier(t)
+	envName := randomIdentifier(t)
+
+	result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", first, "--skip-git")
+	if result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	single := runGitvault(t, nil, "--vault", vaultDir, "keys", "groups", "set", "--group", first)
+	if single.ExitCode != 2 {
+		t.Fatalf("expected a single group to be rejected, got %d", single.ExitCode)
+	}
+	set := runGitvault(t, nil, "--vault", vaultDir, "keys", "groups", "set", "--threshold", "2", "--group", first, "--group", second+","+third)
+	if set.ExitCode != 0 {
+		t.Fatalf("keys groups set failed: %s", set.Stderr)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if !strings.Contains(list.Stdout, second) || !strings.Contains(list.Stdout, third) {
+		t.Fatalf("expected group members to become recipients: %s", list.Stdout)
+	}
+	groups := runGitvault(t, nil, "--vault", vaultDir, "keys", "groups")
+	if !strings.Contains(groups.Stdout, "threshold: 2 of 2 groups") {
+		t.Fatalf("expected threshold in groups list: %s", groups.Stdout)
+	}
+
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	logEnv := map[string]string{"GITVAULT_TEST_SOPS_LOG": sopsLog}
+	if set := runGitvault(t, logEnv, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "value"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	data, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	want := `"key_groups":[{"age":["` + first + `"]},{"age":["` + second + `","` + third + `"]}],"shamir_threshold":2`
+	if log := string(data); !strings.Contains(log, want) || strings.Contains(log, "--age") {
+		t.Fatalf("expected key groups config instead of --age, got:\n%s", log)
+	}
+
+	remove := runGitvault(t, nil, "--vault", vaultDir, "keys", "remove", first)
+	if remove.ExitCode != 1 || !strings.Contains(remove.Stderr, "leave key group 1 empty") {
+		t.Fatalf("expected removal of the last group member to be refused, got %d: %s", remove.ExitCode, remove.Stderr)
+	}
+	doctor := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if !strings.Contains(doctor.Stdout, "2 of 2 groups required") {
+		t.Fatalf("expected key groups doctor check: %s", doctor.Stdout)
+	}
+
+	if clear := runGitvault(t, nil, "--vault", vaultDir, "keys", "groups", "clear"); clear.ExitCode != 0 {
+		t.Fatalf("keys groups clear failed: %s", clear.Stderr)
+	}
+	if err := os.Remove(sopsLog); err != nil {
+		t.Fatalf("remove sops log: %v", err)
+	}
+	if set := runGitvault(t, logEnv, "--vault", vaultDir, "secret", "set", project, envName, "API_KEY", "other"); set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	data, err = os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	if !strings.Contains(string(data), "--age ") {
+		t.Fatalf("expected flat recipients after clearing groups, got:\n%s", data)
+	}
+}
+
+func TestKeysRemoveSafeguards(t *testing.T) {
+	vaultDir := t.TempDir()
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	identity, err := agekey.Encode("age-secret-key-", secret)
+	if err != nil {
+		t.Fatalf("encode identity: %v", err)
+	}
+	identity = strings.ToUpper(identity)
+	localRecipient, err := agekey.RecipientFromIdentity(identity)
+	if err != nil {
+		t.Fatalf("recipient: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte(identity+"\n"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	env := map[string]string{"SOPS_AGE_KEY_FILE": keyFile}
+	other := randomRecipient(t)
+
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", other, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	last := runGitvault(t, env, "--vault", vaultDir, "keys", "remove", other)
+	if last.ExitCode != 1 || !strings.Contains(last.Stderr, "last recipient") || !strings.Contains(last.Stderr, "--force") {
+		t.Fatalf("expected last recipient refusal, got %d: %s", last.ExitCode, last.Stderr)
+	}
+
+	if result := runGitvault(t, env, "--vault", vaultDir, "keys", "add", localRecipient); result.ExitCode != 0 {
+		t.Fatalf("keys add failed: %s", result.Stderr)
+	}
+	own := runGitvault(t, env, "--vault", vaultDir, "keys", "remove", localRecipient)
+	if own.ExitCode != 1 || !strings.Contains(own.Stderr, "local identity") {
+		t.Fatalf("expected local identity refusal, got %d: %s", own.ExitCode, own.Stderr)
+	}
+	forced := runGitvault(t, env, "--vault", vaultDir, "keys", "remove", "--force", localRecipient)
+	if forced.ExitCode != 0 || !strings.Contains(forced.Stderr, "matches your local identity; you lose access") {
+		t.Fatalf("expected forced removal with warning, got %d: %s", forced.ExitCode, forced.Stderr)
+	}
+	list := runGitvault(t, env, "--vault", vaultDir, "keys", "list")
+	if strings.Contains(list.Stdout, localRecipient) || !strings.Contains(list.Stdout, other) {
+		t.Fatalf("unexpected recipients after removal: %s", list.Stdout)
+	}
+}
+
+func TestKeysAddFromSources(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ssh key: %v", err)
+	}
+	var blob []byte
+	for _, field := range [][]byte{[]byte("ssh-ed25519"), pub} {
+		blob = binary.BigEndian.AppendUint32(blob, uint32(len(field)))
+		blob = append(blob, field...)
+	}
+	sshLine := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(blob) + " teammate@laptop"
+	hash := sha512.Sum512(priv.Seed())
+	x25519, err := ecdh.X25519().NewPrivateKey(hash[:32])
+	if err != nil {
+		t.Fatalf("x25519: %v", err)
+	}
+	sshRecipient, err := agekey.Encode("age", x25519.PublicKey().Bytes())
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	ageRecipient := randomRecipient(t)
+	keyFile := filepath.Join(t.TempDir(), "teammate.pub")
+	content := "# teammate keys\n" + sshLine + "\nssh-rsa AAAAB3NzaC1yc2E teammate@old\n# public key: " + ageRecipient + "\n"
+	if err := os.WriteFile(keyFile, []byte(content), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	add := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", "--from-file", keyFile)
+	if add.ExitCode != 0 {
+		t.Fatalf("keys add --from-file failed: %s", add.Stderr)
+	}
+	if !strings.Contains(add.Stderr, "skipped line 3") || !strings.Contains(add.Stderr, "ssh-rsa") {
+		t.Fatalf("expected ssh-rsa line to be skipped, got: %s", add.Stderr)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if !strings.Contains(list.Stdout, sshRecipient) || !strings.Contains(list.Stdout, ageRecipient) {
+		t.Fatalf("expected converted and age recipients in list: %s", list.Stdout)
+	}
+
+	plain := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", "--from-url", "http://example.com/user.keys")
+	if plain.ExitCode != 1 || !strings.Contains(plain.Stderr, "https") {
+		t.Fatalf("expected http URL to be rejected, got %d: %s", plain.ExitCode, plain.Stderr)
+	}
+	both := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", "--from-file", keyFile, ageRecipient)
+	if both.ExitCode != 2 {
+		t.Fatalf("expected usage error for two sources, got %d", both.ExitCode)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	urlRecipient := randomRecipient(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/teammate.keys" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, urlRecipient)
+	}))
+	defer server.Close()
+	certFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	env := map[string]string{"SSL_CERT_FILE": certFile}
+	fetched := runGitvault(t, env, "--vault", vaultDir, "keys", "add", "--from-url", server.URL+"/teammate.keys")
+	if fetched.ExitCode != 0 {
+		t.Fatalf("keys add --from-url failed: %s", fetched.Stderr)
+	}
+	list = runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if !strings.Contains(list.Stdout, urlRecipient) {
+		t.Fatalf("expected fetched recipient in list: %s", list.Stdout)
+	}
+	missing := runGitvault(t, env, "--vault", vaultDir, "keys", "add", "--from-url", server.URL+"/nobody.keys")
+	if missing.ExitCode != 1 || !strings.Contains(missing.Stderr, "404") {
+		t.Fatalf("expected 404 failure, got %d: %s", missing.ExitCode, missing.Stderr)
+	}
+}
+
+func TestTeamRoster(t *testing.T) {
+	vaultDir := t.TempDir()
+	owner := testRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", owner, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	alice := randomRecipient(t)
+	add := runGitvault(t, nil, "--vault", vaultDir, "team", "add", "alice", alice)
+	if add.ExitCode != 0 {
+		t.Fatalf("team add failed: %s", add.Stderr)
+	}
+	if !strings.Contains(add.Stderr, "1 configured recipient(s) are not in the new roster") {
+		t.Fatalf("expected unnamed recipient warning, got: %s", add.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "team", "add", "ops", owner); result.ExitCode != 0 {
+		t.Fatalf("team add ops failed: %s", result.Stderr)
+	}
+	taken := runGitvault(t, nil, "--vault", vaultDir, "team", "add", "mallory", alice)
+	if taken.ExitCode != 1 || !strings.Contains(taken.Stderr, "already belongs to alice") {
+		t.Fatalf("expected duplicate recipient refusal, got %d: %s", taken.ExitCode, taken.Stderr)
+	}
+
+	keys := runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if !strings.Contains(keys.Stdout, "member") || !strings.Contains(keys.Stdout, alice) || !strings.Contains(keys.Stdout, "alice") {
+		t.Fatalf("expected keys list to show member names: %s", keys.Stdout)
+	}
+
+	var roster struct {
+		Members []struct {
+			Name       string   `json:"name"`
+			Recipients []string `json:"recipients"`
+		} `json:"members"`
+	}
+	rosterPath := filepath.Join(vaultDir, ".gitvault", "team.json")
+	data, err := os.ReadFile(rosterPath)
+	if err != nil {
+		t.Fatalf("read roster: %v", err)
+	}
+	if err := json.Unmarshal(data, &roster); err != nil {
+		t.Fatalf("parse roster: %v", err)
+	}
+	bob := randomRecipient(t)
+	roster.Members = append(roster.Members, struct {
+		Name       string   `json:"name"`
+		Recipients []string `json:"recipients"`
+	}{Name: "bob", Recipients: []string{bob}})
+	data, _ = json.Marshal(roster)
+	if err := os.WriteFile(rosterPath, data, 0o600); err != nil {
+		t.Fatalf("write roster: %v", err)
+	}
+
+	dry := runGitvault(t, nil, "--vault", vaultDir, "team", "sync", "--dry-run")
+	if dry.ExitCode != 0 || !strings.Contains(dry.Stdout, "add") || !strings.Contains(dry.Stdout, bob) {
+		t.Fatalf("expected dry run to list bob, got %d: %s %s", dry.ExitCode, dry.Stdout, dry.Stderr)
+	}
+	if keys := runGitvault(t, nil, "--vault", vaultDir, "keys", "list"); strings.Contains(keys.Stdout, bob) {
+		t.Fatalf("dry run should not add recipients")
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "team", "sync"); result.ExitCode != 0 {
+		t.Fatalf("team sync failed: %s", result.Stderr)
+	}
+	if keys := runGitvault(t, nil, "--vault", vaultDir, "keys", "list"); !strings.Contains(keys.Stdout, bob) {
+		t.Fatalf("expected bob after sync: %s", keys.Stdout)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "team", "remove", "alice"); result.ExitCode != 0 {
+		t.Fatalf("team remove failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "team", "remove", "bob"); result.ExitCode != 0 {
+		t.Fatalf("team remove bob failed: %s", result.Stderr)
+	}
+	keys = runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if strings.Contains(keys.Stdout, alice) || strings.Contains(keys.Stdout, bob) || !strings.Contains(keys.Stdout, owner) {
+		t.Fatalf("unexpected recipients after removal: %s", keys.Stdout)
+	}
+	last := runGitvault(t, nil, "--vault", vaultDir, "team", "remove", "ops")
+	if last.ExitCode != 1 || !strings.Contains(last.Stderr, "last recipient") {
+		t.Fatalf("expected last recipient refusal, got %d: %s", last.ExitCode, last.Stderr)
+	}
+}
+
+func TestDoctorGitRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	noOrigin := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if !strings.Contains(noOrigin.Stdout, "git remote") || !strings.Contains(noOrigin.Stdout, "no origin remote") {
+		t.Fatalf("expected missing origin warning, got: %s", noOrigin.Stdout)
+	}
+
+	env := gitEnv()
+	missingRemote := filepath.Join(t.TempDir(), "missing.git")
+	if err := runGit(t, vaultDir, env, "remote", "add", "origin", missingRemote); err != nil {
+		t.Fatalf("git remote add: %v", err)
+	}
+	broken := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if broken.ExitCode != 1 || !strings.Contains(broken.Stdout, "repository not found") {
+		t.Fatalf("expected unreachable origin failure, got %d: %s %s", broken.ExitCode, broken.Stdout, broken.Stderr)
+	}
+	if !strings.Contains(broken.Stderr, "git remote -v") {
+		t.Fatalf("expected remote hint, got: %s", broken.Stderr)
+	}
+	skipped := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--no-remote")
+	if strings.Contains(skipped.Stdout, "git remote") {
+		t.Fatalf("expected --no-remote to skip the check: %s", skipped.Stdout)
+	}
+
+	if err := runGit(t, filepath.Dir(missingRemote), env, "init", "--bare", missingRemote); err != nil {
+		t.Fatalf("git init --bare: %v", err)
+	}
+	healthy := runGitvault(t, nil, "--vault", vaultDir, "doctor")
+	if !strings.Contains(healthy.Stdout, "origin reachable") {
+		t.Fatalf("expected reachable origin, got: %s %s", healthy.Stdout, healthy.Stderr)
+	}
+}
+
+func TestSyncRemoteBranchAndMirror(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	env := gitEnv()
+	commit := func(message string) {
+		t.Helper()
+		if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if err := runGit(t, vaultDir, env, "commit", "-m", message); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+	commit("init")
+
+	remotes := t.TempDir()
+	primary := filepath.Join(remotes, "primary.git")
+	backup := filepath.Join(remotes, "backup.git")
+	for _, dir := range []string{primary, backup} {
+		if err := runGit(t, remotes, env, "init", "--bare", dir); err != nil {
+			t.Fatalf("git init --bare: %v", err)
+		}
+	}
+	if err := runGit(t, vaultDir, env, "remote", "add", "primary", primary); err != nil {
+		t.Fatalf("git remote add: %v", err)
+	}
+	if err := runGit(t, vaultDir, env, "remote", "add", "backup", backup); err != nil {
+		t.Fatalf("git remote add: %v", err)
+	}
+	head := func(dir, ref string) string {
+		t.Helper()
+		cmd := exec.Command("git", "-C", dir, "rev-parse", ref)
+		output, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	push := runGitvault(t, nil, "--vault", vaultDir, "sync", "push", "--remote", "primary", "--branch", "vault")
+	if push.ExitCode != 0 {
+		t.Fatalf("sync push failed: %s", push.Stderr)
+	}
+	if head(primary, "refs/heads/vault") != head(vaultDir, "HEAD") {
+		t.Fatalf("expected primary vault branch at local HEAD")
+	}
+	if bad := runGitvault(t, nil, "--vault", vaultDir, "sync", "push", "--remote", "--upload-pack=evil"); bad.ExitCode != 2 {
+		t.Fatalf("expected option-like remote to be rejected, got %d", bad.ExitCode)
+	}
+
+	config := runGitvault(t, nil, "--vault", vaultDir, "sync", "config", "--remote", "primary", "--branch", "vault", "--mirror", "backup")
+	if config.ExitCode != 0 || !strings.Contains(config.Stdout, "backup") {
+		t.Fatalf("sync config failed: %s %s", config.Stdout, config.Stderr)
+	}
+	commit("sync defaults")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "sync", "push"); result.ExitCode != 0 {
+		t.Fatalf("sync push with defaults failed: %s", result.Stderr)
+	}
+	local := head(vaultDir, "HEAD")
+	if head(primary, "refs/heads/vault") != local || head(backup, "refs/heads/vault") != local {
+		t.Fatalf("expected primary and mirror at local HEAD")
+	}
+
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	if err := runGit(t, filepath.Dir(cloneDir), env, "clone", "--branch", "vault", primary, cloneDir); err != nil {
+		t.Fatalf("git clone: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cloneDir, "REMOTE.md"), []byte("remote"), 0o600); err != nil {
+		t.Fatalf("write remote file: %v", err)
+	}
+	if err := runGit(t, cloneDir, env, "add", "REMOTE.md"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, cloneDir, env, "commit", "-m", "remote change"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	if err := runGit(t, cloneDir, env, "push", "origin", "HEAD"); err != nil {
+		t.Fatalf("git push: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "sync", "pull"); result.ExitCode != 0 {
+		t.Fatalf("sync pull with defaults failed: %s", result.Stderr)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "REMOTE.md")); err != nil {
+		t.Fatalf("expected pulled file: %v", err)
+	}
+
+	failed := runGitvault(t, nil, "--vault", vaultDir, "sync", "push", "--mirror", filepath.Join(remotes, "missing.git"))
+	if failed.ExitCode != 1 || !strings.Contains(failed.Stderr, "pushed, but mirror") {
+		t.Fatalf("expected mirror failure, got %d: %s", failed.ExitCode, failed.Stderr)
+	}
+}
+
+func TestLinkedAppRepository(t *testing.T) {
+	parent := t.TempDir()
+	vaultDir := filepath.Join(parent, "vault")
+	appDir := filepath.Join(parent, "app")
+	nested := filepath.Join(appDir, "src", "api")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	link := runGitvaultIn(t, appDir, nil, "link", "../vault", "--project", "myapp", "--env", "dev")
+	if link.ExitCode != 0 {
+		t.Fatalf("link failed: %s", link.Stderr)
+	}
+	data, err := os.ReadFile(filepath.Join(appDir, ".gitvault.ref"))
+	if err != nil || !strings.Contains(string(data), `"vault": "../vault"`) {
+		t.Fatalf("expected relative vault in ref, got %q (%v)", data, err)
+	}
+	again := runGitvaultIn(t, appDir, nil, "link", "../vault")
+	if again.ExitCode != 1 || !strings.Contains(again.Stderr, "--force") {
+		t.Fatalf("expected existing link refusal, got %d: %s", again.ExitCode, again.Stderr)
+	}
+
+	value := testutil.RandomString(t, 12)
+	if result := runGitvaultIn(t, nested, nil, "secret", "set", "API_KEY", value); result.ExitCode != 0 {
+		t.Fatalf("linked secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvaultIn(t, nested, nil, "secret", "set", "other", "prod", "TOKEN", value); result.ExitCode != 0 {
+		t.Fatalf("explicit secret set failed: %s", result.Stderr)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "myapp", "dev")
+	if list.ExitCode != 0 || !strings.Contains(list.Stdout, "API_KEY") {
+		t.Fatalf("expected linked key in myapp/dev: %s %s", list.Stdout, list.Stderr)
+	}
+	other := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "other", "prod")
+	if !strings.Contains(other.Stdout, "TOKEN") {
+		t.Fatalf("expected positional project/env to win over the link: %s", other.Stdout)
+	}
+	linkedList := runGitvaultIn(t, nested, nil, "secret", "list")
+	if !strings.Contains(linkedList.Stdout, "API_KEY") || strings.Contains(linkedList.Stdout, "TOKEN") {
+		t.Fatalf("expected linked list scoped to myapp/dev: %s", linkedList.Stdout)
+	}
+
+	show := runGitvaultIn(t, nested, nil, "link")
+	if !strings.Contains(show.Stdout, "myapp") || !strings.Contains(show.Stdout, "dev") {
+		t.Fatalf("expected link details, got: %s", show.Stdout)
+	}
+	if result := runGitvaultIn(t, appDir, nil, "link", "--remove"); result.ExitCode != 0 {
+		t.Fatalf("link --remove failed: %s", result.Stderr)
+	}
+	if _, err := os.Stat(filepath.Join(appDir, ".gitvault.ref")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ref removed, got %v", err)
+	}
+}
+
+func TestLinkPathMappings(t *testing.T) {
+	parent := t.TempDir()
+	vaultDir := filepath.Join(parent, "vault")
+	appDir := filepath.Join(parent, "app")
+	apiDir := filepath.Join(appDir, "services", "api", "cmd")
+	webDir := filepath.Join(appDir, "services", "web")
+	for _, dir := range []string{apiDir, webDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvaultIn(t, appDir, nil, "link", "../vault", "--project", "shared", "--env", "dev", "--map", "services/api=api"); result.ExitCode != 0 {
+		t.Fatalf("link failed: %s", result.Stderr)
+	}
+	if result := runGitvaultIn(t, webDir, nil, "link", "--map", "services/web=web/staging"); result.ExitCode != 0 {
+		t.Fatalf("link --map failed: %s", result.Stderr)
+	}
+	if result := runGitvaultIn(t, appDir, nil, "link", "--map", "../outside=api"); result.ExitCode != 2 {
+		t.Fatalf("expected path outside the repository to be rejected, got %d", result.ExitCode)
+	}
+
+	for _, dir := range []string{apiDir, webDir, appDir} {
+		if result := runGitvaultIn(t, dir, nil, "secret", "set", "KEY", "value"); result.ExitCode != 0 {
+			t.Fatalf("secret set in %s failed: %s", dir, result.Stderr)
+		}
+	}
+	for _, target := range [][2]string{{"api", "dev"}, {"web", "staging"}, {"shared", "dev"}} {
+		list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", target[0], target[1])
+		if list.ExitCode != 0 || !strings.Contains(list.Stdout, "KEY") {
+			t.Fatalf("expected KEY in %s/%s: %s %s", target[0], target[1], list.Stdout, list.Stderr)
+		}
+	}
+
+	if result := runGitvaultIn(t, appDir, nil, "link", "--unmap", "services/web"); result.ExitCode != 0 {
+		t.Fatalf("link --unmap failed: %s", result.Stderr)
+	}
+	show := runGitvaultIn(t, appDir, nil, "link")
+	if !strings.Contains(show.Stdout, "services/api") || strings.Contains(show.Stdout, "services/web") {
+		t.Fatalf("expected only the api mapping, got: %s", show.Stdout)
+	}
+}
+
+func TestSecretStatusWithExportHeader(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	for _, pair := range [][2]string{{"API_KEY", "one"}, {"TOKEN", "two"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", pair[0], pair[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev", "--out", envFile, "--header"); result.ExitCode != 0 {
+		t.Fatalf("export failed: %s", result.Stderr)
+	}
+	data, err := os.ReadFile(envFile)
+	if err != nil || !strings.HasPrefix(string(data), "# gitvault-export: vault=vault project="+project+" env=dev exported=") {
+		t.Fatalf("expected provenance header, got %q (%v)", data, err)
+	}
+
+	clean := runGitvault(t, nil, "--vault", vaultDir, "secret", "status", "--file", envFile)
+	if clean.ExitCode != 0 || !strings.Contains(clean.Stdout, "up to date") {
+		t.Fatalf("expected up to date, got %d: %s %s", clean.ExitCode, clean.Stdout, clean.Stderr)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", "TOKEN", "rotated"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", "NEW_KEY", "three"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if err := os.WriteFile(envFile, append(data, []byte("LOCAL_ONLY=x\n")...), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	drift := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "status", "--file", envFile)
+	if drift.ExitCode != 1 {
+		t.Fatalf("expected drift exit 1, got %d: %s", drift.ExitCode, drift.Stderr)
+	}
+	for _, want := range []string{`["LOCAL_ONLY","extra"]`, `["NEW_KEY","missing"]`, `["TOKEN","changed"]`} {
+		if !strings.Contains(strings.ReplaceAll(drift.Stdout, " ", ""), want) {
+			t.Fatalf("expected %s in status output: %s", want, drift.Stdout)
+		}
+	}
+	if strings.Contains(drift.Stdout, "API_KEY") {
+		t.Fatalf("expected unchanged key omitted: %s", drift.Stdout)
+	}
+}
+
+func TestSecretApplyGlob(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", "API_KEY", "fresh"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	workDir := t.TempDir()
+	files := []string{
+		filepath.Join(workDir, "deploy", "api", ".env"),
+		filepath.Join(workDir, "deploy", "jobs", "nightly", ".env"),
+	}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(file, []byte("API_KEY=stale\nLOCAL=1\n"), 0o600); err != nil {
+			t.Fatalf("write env: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "deploy", "api", "other.txt"), []byte("API_KEY=stale\n"), 0o600); err != nil {
+		t.Fatalf("write other: %v", err)
+	}
+
+	apply := runGitvaultIn(t, workDir, nil, "--json", "--vault", vaultDir, "secret", "apply-env", project, "dev", "--file", "deploy/**/.env")
+	if apply.ExitCode != 0 {
+		t.Fatalf("apply-env glob failed: %s", apply.Stderr)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil || !strings.Contains(string(data), "API_KEY=fresh") || !strings.Contains(string(data), "LOCAL=1") {
+			t.Fatalf("expected %s updated, got %q (%v)", file, data, err)
+		}
+	}
+	for _, dir := range []string{"api", "nightly"} {
+		if !strings.Contains(apply.Stdout, dir) {
+			t.Fatalf("expected %s in report: %s", dir, apply.Stdout)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(workDir, "deploy", "api", "other.txt")); !strings.Contains(string(data), "stale") {
+		t.Fatalf("expected non-matching file untouched, got %q", data)
+	}
+
+	missing := runGitvaultIn(t, workDir, nil, "--vault", vaultDir, "secret", "apply-env", project, "dev", "--file", "nothing/**/.env")
+	if missing.ExitCode != 1 || !strings.Contains(missing.Stderr, "no files match") {
+		t.Fatalf("expected no-match error, got %d: %s", missing.ExitCode, missing.Stderr)
+	}
+}
+
+func TestSecretImportPreferNewer(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", "API_KEY", "vault"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_KEY=file\nNEW_KEY=added\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+
+	older := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "import-env", project, "dev", "--file", envFile, "--strategy", "prefer-newer", "--file-timestamp", "2000-01-01")
+	if older.ExitCode != 0 || !strings.Contains(older.Stdout, "API_KEY: kept vault") {
+		t.Fatalf("expected vault kept for older file, got %d: %s %s", older.ExitCode, older.Stdout, older.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev")
+	if !strings.Contains(export.Stdout, "API_KEY=vault") || !strings.Contains(export.Stdout, "NEW_KEY=added") {
+		t.Fatalf("expected vault value kept and new key added: %s", export.Stdout)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(envFile, future, future); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	newer := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "import-env", project, "dev", "--file", envFile, "--strategy", "prefer-newer")
+	if newer.ExitCode != 0 || !strings.Contains(newer.Stdout, "API_KEY: kept file") {
+		t.Fatalf("expected file kept for newer mtime, got %d: %s %s", newer.ExitCode, newer.Stdout, newer.Stderr)
+	}
+	export = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev")
+	if !strings.Contains(export.Stdout, "API_KEY=file") {
+		t.Fatalf("expected file value imported: %s", export.Stdout)
+	}
+
+	misuse := runGitvault(t, nil, "--vault", vaultDir, "secret", "import-env", project, "dev", "--file", envFile, "--file-timestamp", "2d")
+	if misuse.ExitCode != 2 {
+		t.Fatalf("expected --file-timestamp without prefer-newer to be rejected, got %d", misuse.ExitCode)
+	}
+}
+
+func TestSecretImportInteractive(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	for _, key := range []string{"ONE", "TWO"} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", key, "vault"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("ONE=file\nTWO=file\nTHREE=new\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	importArgs := []string{"--vault", vaultDir, "secret", "import-env", project, "dev", "--file", envFile, "--strategy", "interactive"}
+
+	abort := runGitvault(t, map[string]string{"GITVAULT_TEST_STDIN": "a\n"}, importArgs...)
+	if abort.ExitCode != 1 || !strings.Contains(abort.Stderr, "import aborted") {
+		t.Fatalf("expected abort, got %d: %s", abort.ExitCode, abort.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev")
+	if strings.Contains(export.Stdout, "file") || strings.Contains(export.Stdout, "THREE") {
+		t.Fatalf("expected no partial changes after abort: %s", export.Stdout)
+	}
+
+	all := runGitvault(t, map[string]string{"GITVAULT_TEST_STDIN": "F\n"}, importArgs...)
+	if all.ExitCode != 0 || strings.Count(all.Stdout, "conflict for") != 1 {
+		t.Fatalf("expected a single prompt with file-for-all, got %d: %s %s", all.ExitCode, all.Stdout, all.Stderr)
+	}
+	export = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev")
+	if !strings.Contains(export.Stdout, "ONE=file") || !strings.Contains(export.Stdout, "TWO=file") {
+		t.Fatalf("expected file values for all conflicts: %s", export.Stdout)
+	}
+
+	if err := os.WriteFile(envFile, []byte("ONE=changed\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	edit := runGitvault(t, map[string]string{"GITVAULT_TEST_STDIN": "d\nx\ne\nedited\n"}, importArgs...)
+	if edit.ExitCode != 0 {
+		t.Fatalf("edit import failed: %s", edit.Stderr)
+	}
+	for _, want := range []string{"- file", "+ changed", "unknown choice"} {
+		if !strings.Contains(edit.Stdout, want) {
+			t.Fatalf("expected %q in prompt output: %s", want, edit.Stdout)
+		}
+	}
+	export = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev")
+	if !strings.Contains(export.Stdout, "ONE=edited") {
+		t.Fatalf("expected edited value: %s", export.Stdout)
+	}
+}
+
+func TestDetailedReports(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", project, "dev", "API_KEY", "vault"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	type detail struct {
+		File   string `json:"file"`
+		Key    string `json:"key"`
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+	}
+	parseDetails := func(t *testing.T, stdout string) map[string]detail {
+		t.Helper()
+		var payload struct {
+			Data struct {
+				Details []detail `json:"details"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(stdout), &payload); err != nil {
+			t.Fatalf("parse details: %v: %s", err, stdout)
+		}
+		byName := map[string]detail{}
+		for _, d := range payload.Data.Details {
+			byName[d.Key+d.File] = d
+		}
+		return byName
+	}
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("API_KEY=file\nNEW_KEY=added\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	imported := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "import-env", project, "dev", "--file", envFile, "--details")
+	if imported.ExitCode != 0 {
+		t.Fatalf("import failed: %s", imported.Stderr)
+	}
+	details := parseDetails(t, imported.Stdout)
+	if d := details["API_KEY"]; d.Action != "skipped" || !strings.Contains(d.Reason, "prefer-vault") {
+		t.Fatalf("expected API_KEY skipped by prefer-vault, got %+v", d)
+	}
+	if d := details["NEW_KEY"]; d.Action != "added" {
+		t.Fatalf("expected NEW_KEY added, got %+v", d)
+	}
+
+	if err := os.WriteFile(envFile, []byte("API_KEY=stale\nLOCAL=1\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	applied := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "apply-env", project, "dev", "--file", envFile, "--details")
+	if applied.ExitCode != 0 {
+		t.Fatalf("apply failed: %s", applied.Stderr)
+	}
+	details = parseDetails(t, applied.Stdout)
+	for key, want := range map[string]string{"API_KEY": "updated", "NEW_KEY": "added", "LOCAL": "skipped"} {
+		if d := details[key+envFile]; d.Action != want {
+			t.Fatalf("expected %s %s, got %+v", key, want, d)
+		}
+	}
+
+	rotate := runGitvault(t, nil, "--json", "--vault", vaultDir, "keys", "rotate", "--details")
+	if rotate.ExitCode != 0 {
+		t.Fatalf("rotate failed: %s", rotate.Stderr)
+	}
+	details = parseDetails(t, rotate.Stdout)
+	if len(details) != 1 {
+		t.Fatalf("expected one file in rotate details, got %+v", details)
+	}
+	for _, d := range details {
+		if d.Action != "skipped" || !strings.HasPrefix(d.File, "secrets/") {
+			t.Fatalf("expected unchanged ciphertext kept, got %+v", d)
+		}
+	}
+	text := runGitvault(t, nil, "--vault", vaultDir, "keys", "rotate", "--details")
+	if text.ExitCode != 0 || !strings.Contains(text.Stdout, "rotation complete") || !strings.Contains(text.Stdout, "ciphertext kept") {
+		t.Fatalf("expected summary and detail table, got: %s", text.Stdout)
+	}
+}
+
+func TestSecretImportFromStdin(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	project := randomIdentifier(t)
+	stdin := map[string]string{"GITVAULT_TEST_STDIN": "API_KEY=piped\nTOKEN=also-piped\n"}
+	result := runGitvault(t, stdin, "--vault", vaultDir, "secret", "import-env", project, "dev", "--file", "-")
+	if result.ExitCode != 0 {
+		t.Fatalf("import from stdin failed: %s", result.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", project, "dev")
+	if !strings.Contains(export.Stdout, "API_KEY=piped") || !strings.Contains(export.Stdout, "TOKEN=also-piped") {
+		t.Fatalf("expected piped values imported: %s", export.Stdout)
+	}
+	interactive := runGitvault(t, stdin, "--vault", vaultDir, "secret", "import-env", project, "dev", "--file", "-", "--strategy", "interactive")
+	if interactive.ExitCode != 2 {
+		t.Fatalf("expected interactive with stdin input to be rejected, got %d", interactive.ExitCode)
+	}
+}
+
+func TestSecretGrep(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, entry := range [][4]string{
+		{"billing", "prod", "STRIPE_KEY", "sk_live_leaked"},
+		{"shop", "dev", "PAYMENTS", "prefix-sk_live_leaked"},
+		{"shop", "prod", "OTHER", "unrelated"},
+	} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", entry[0], entry[1], entry[2], entry[3]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	grep := runGitvault(t, nil, "--vault", vaultDir, "secret", "grep", "sk_live")
+	if grep.ExitCode != 0 || !strings.Contains(grep.Stdout, "billing/prod/STRIPE_KEY") || !strings.Contains(grep.Stdout, "shop/dev/PAYMENTS") {
+		t.Fatalf("expected both refs, got %d: %s %s", grep.ExitCode, grep.Stdout, grep.Stderr)
+	}
+	if strings.Contains(grep.Stdout, "leaked") || strings.Contains(grep.Stdout, "OTHER") {
+		t.Fatalf("expected refs only, got: %s", grep.Stdout)
+	}
+	scoped := runGitvault(t, nil, "--vault", vaultDir, "secret", "grep", "--project", "shop", "--regex", "^prefix-")
+	if !strings.Contains(scoped.Stdout, "shop/dev/PAYMENTS") || strings.Contains(scoped.Stdout, "billing") {
+		t.Fatalf("expected project-scoped regex match, got: %s", scoped.Stdout)
+	}
+	values := runGitvault(t, nil, "--vault", vaultDir, "secret", "grep", "--env", "prod", "--show-values", "--yes", "SK_LIVE", "--ignore-case")
+	if !strings.Contains(values.Stdout, "sk_live_leaked") || strings.Contains(values.Stdout, "shop/dev") {
+		t.Fatalf("expected env-scoped values, got: %s", values.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "grep", "sk_live", "--show-values"); result.ExitCode != 2 {
+		t.Fatalf("expected --show-values without confirmation to be refused, got %d", result.ExitCode)
+	}
+}
+
+func TestSecretDedupReport(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, entry := range [][4]string{
+		{"api", "prod", "DB_PASSWORD", "shared-password-123"},
+		{"worker", "prod", "DATABASE_PASS", "shared-password-123"},
+		{"api", "dev", "DEBUG", "true"},
+		{"worker", "dev", "VERBOSE", "true"},
+		{"api", "prod", "UNIQUE", "only-here-456789"},
+	} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", entry[0], entry[1], entry[2], entry[3]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	report := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "dedup-report")
+	if report.ExitCode != 0 {
+		t.Fatalf("dedup-report failed: %s", report.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(report.Stdout), &payload); err != nil {
+		t.Fatalf("parse report: %v: %s", err, report.Stdout)
+	}
+	if len(payload.Data) != 2 || len(payload.Data[0]) != 2 || payload.Data[0][1] != "api/prod/DB_PASSWORD" || payload.Data[1][1] != "worker/prod/DATABASE_PASS" || payload.Data[0][0] != payload.Data[1][0] {
+		t.Fatalf("expected one group with the shared password, got %v", payload.Data)
+	}
+	sum := sha256.Sum256([]byte("shared-password-123"))
+	if strings.Contains(report.Stdout, "shared-password") || strings.Contains(report.Stdout, hex.EncodeToString(sum[:])[:12]) {
+		t.Fatalf("expected values and their plain digests to stay hidden: %s", report.Stdout)
+	}
+
+	short := runGitvault(t, nil, "--vault", vaultDir, "secret", "dedup-report", "--env", "dev", "--min-length", "1")
+	if !strings.Contains(short.Stdout, "api/dev/DEBUG") || !strings.Contains(short.Stdout, "worker/dev/VERBOSE") || strings.Contains(short.Stdout, "prod") {
+		t.Fatalf("expected dev-scoped short values grouped, got: %s", short.Stdout)
+	}
+}
+
+func TestFileListVerify(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, name := range []string{"a.pem", "b.pem", "c.pem"} {
+		src := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(src, []byte("contents of "+name), 0o600); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+		if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "dev", "--path", src); result.ExitCode != 0 {
+			t.Fatalf("file put failed: %s", result.Stderr)
+		}
+	}
+	clean := runGitvault(t, nil, "--vault", vaultDir, "file", "list", "--verify")
+	if clean.ExitCode != 0 || strings.Contains(clean.Stdout, "missing") {
+		t.Fatalf("expected a clean verify, got %d: %s %s", clean.ExitCode, clean.Stdout, clean.Stderr)
+	}
+
+	dir := filepath.Join(vaultDir, "files", "app", "dev")
+	if err := os.Remove(filepath.Join(dir, "a.pem")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.pem"), nil, 0o600); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stray.pem"), []byte("ciphertext"), 0o600); err != nil {
+		t.Fatalf("write orphan: %v", err)
+	}
+	drift := runGitvault(t, nil, "--json", "--vault", vaultDir, "file", "list", "app", "dev", "--verify")
+	if drift.ExitCode != 1 {
+		t.Fatalf("expected drift to exit 1, got %d: %s", drift.ExitCode, drift.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(drift.Stdout), &payload); err != nil {
+		t.Fatalf("parse list: %v: %s", err, drift.Stdout)
+	}
+	got := map[string]string{}
+	for _, row := range payload.Data {
+		got[row[0]] = row[len(row)-1]
+	}
+	want := map[string]string{"a.pem": "missing", "b.pem": "truncated", "c.pem": "ok", "stray.pem": "orphan"}
+	for name, status := range want {
+		if got[name] != status {
+			t.Fatalf("expected %s to be %s, got %v", name, status, got)
+		}
+	}
+}
+
+func TestVaultWideFind(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "STRIPE_KEY", "sk"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "OTHER", "x"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	cert := filepath.Join(t.TempDir(), "stripe.pem")
+	if err := os.WriteFile(cert, []byte("certificate"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "dev", "--path", cert); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+
+	find := runGitvault(t, nil, "--json", "--vault", vaultDir, "find", "stripe")
+	if find.ExitCode != 0 {
+		t.Fatalf("find failed: %s", find.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(find.Stdout), &payload); err != nil {
+		t.Fatalf("parse find: %v: %s", err, find.Stdout)
+	}
+	if len(payload.Data) != 2 || payload.Data[0][0] != "secret:app/dev/STRIPE_KEY" || payload.Data[1][0] != "file:app/dev/stripe.pem" || payload.Data[1][1] != "11" {
+		t.Fatalf("expected the typed secret and file refs, got %v", payload.Data)
+	}
+
+	files := runGitvault(t, nil, "--vault", vaultDir, "find", "--glob", "app/dev/*", "--type", "file")
+	if !strings.Contains(files.Stdout, "file:app/dev/stripe.pem") || strings.Contains(files.Stdout, "secret:") {
+		t.Fatalf("expected only files, got: %s", files.Stdout)
+	}
+	if bad := runGitvault(t, nil, "--vault", vaultDir, "find", "--type", "key"); bad.ExitCode != 2 {
+		t.Fatalf("expected usage error for an unknown type, got %d", bad.ExitCode)
+	}
+}
+
+func TestPlaintextGuard(t *testing.T) {
+	ctx := context.Background()
+	vaultDir := t.TempDir()
+	appDir := t.TempDir()
+	tracked := filepath.Join(appDir, "tracked.env")
+	git := &testsupport.Git{Repos: map[string]bool{appDir: true}, Tracked: map[string]bool{tracked: true}}
+	g := guard.Guard{Git: git}
+
+	for _, check := range []struct {
+		path   string
+		policy guard.Policy
+		want   error
+	}{
+		{filepath.Join(vaultDir, "leak.env"), guard.Policy{AllowGit: true, Overwrite: true}, guard.ErrInsideVault},
+		{tracked, guard.Policy{}, guard.ErrGitTracked},
+		{tracked, guard.Policy{AllowGit: true}, nil},
+		{filepath.Join(appDir, "new.env"), guard.Policy{}, nil},
+	} {
+		if err := g.Output(ctx, vaultDir, check.path, check.policy); !errors.Is(err, check.want) || (check.want == nil && err != nil) {
+			t.Fatalf("Output(%s, %+v): expected %v, got %v", check.path, check.policy, check.want, err)
+		}
+	}
+
+	out := filepath.Join(appDir, "nested", "out.env")
+	if err := g.WriteFile(ctx, vaultDir, out, []byte("KEY=value\n"), guard.Policy{}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(out); err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected an owner-only file, got %v %v", info, err)
+		}
+	}
+	if err := g.WriteFile(ctx, vaultDir, out, []byte("KEY=other\n"), guard.Policy{}); !errors.Is(err, guard.ErrExists) {
+		t.Fatalf("expected an existing file to be refused, got %v", err)
+	}
+	if err := g.Update(ctx, vaultDir, out, guard.Policy{}); err != nil {
+		t.Fatalf("expected an in-place update of an untracked file, got %v", err)
+	}
+}
+
+func TestSecretRunEnvFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "DB_PASSWORD", "from-vault"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	if err := os.WriteFile(base, []byte("LOG_LEVEL=info\nPORT=8080\nDB_PASSWORD=local\n"), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+	if err := os.WriteFile(local, []byte("LOG_LEVEL=debug\n"), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+	run := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "api", "dev", "--env-file", base, "--env-file", local, "--", "sh", "-c", `echo "$LOG_LEVEL $PORT $DB_PASSWORD"`)
+	if run.ExitCode != 0 {
+		t.Fatalf("secret run failed: %s", run.Stderr)
+	}
+	if got := strings.TrimSpace(run.Stdout); got != "debug 8080 from-vault" {
+		t.Fatalf("expected later files and the vault to win, got %q", got)
+	}
+	missing := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "api", "dev", "--env-file", filepath.Join(dir, "missing.env"), "--", "sh", "-c", "true")
+	if missing.ExitCode != 1 {
+		t.Fatalf("expected a missing env file to fail, got %d", missing.ExitCode)
+	}
+}
+
+func TestSecretRunCollisions(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"GITVAULT_TEST_SHADOWED", "vault"}, {"GITVAULT_TEST_FRESH", "vault"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	env := map[string]string{"GITVAULT_TEST_SHADOWED": "local"}
+
+	run := runGitvault(t, env, "--vault", vaultDir, "secret", "run", "api", "dev", "--", gitvaultBin, "help")
+	if run.ExitCode != 0 {
+		t.Fatalf("secret run failed: %s", run.Stderr)
+	}
+	if !strings.Contains(run.Stderr, "override existing environment variables: GITVAULT_TEST_SHADOWED\n") {
+		t.Fatalf("expected a collision warning naming only the shadowed key, got %q", run.Stderr)
+	}
+
+	strict := runGitvault(t, env, "--vault", vaultDir, "secret", "run", "api", "dev", "--strict", "--", gitvaultBin, "help")
+	if strict.ExitCode != 1 || !strings.Contains(strict.Stderr, "GITVAULT_TEST_SHADOWED") || strict.Stdout != "" {
+		t.Fatalf("expected --strict to fail before running, got %d: %q %q", strict.ExitCode, strict.Stdout, strict.Stderr)
+	}
+
+	quiet := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "api", "dev", "--strict", "--", gitvaultBin, "help")
+	if quiet.ExitCode != 0 || strings.Contains(quiet.Stderr, "warning") {
+		t.Fatalf("expected no collisions, got %d: %s", quiet.ExitCode, quiet.Stderr)
+	}
+}
+
+func TestSecretRunRestarts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", "old"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+
+	// The first attempt rotates the token and fails; the restart must see
+	// the new value.
+	marker := filepath.Join(t.TempDir(), "attempted")
+	script := `if [ ! -f "$MARKER" ]; then touch "$MARKER"; "$GITVAULT" --vault "$VAULT" secret set api dev TOKEN new >/dev/null; exit 3; fi; echo "token=$TOKEN"`
+	env := map[string]string{"MARKER": marker, "GITVAULT": gitvaultBin, "VAULT": vaultDir}
+	run := runGitvault(t, env, "--vault", vaultDir, "secret", "run", "api", "dev", "--restart-on-failure", "2", "--refresh-env", "--", "sh", "-c", script)
+	if run.ExitCode != 0 {
+		t.Fatalf("expected the restart to succeed, got %d: %s", run.ExitCode, run.Stderr)
+	}
+	if strings.TrimSpace(run.Stdout) != "token=new" || !strings.Contains(run.Stderr, "restarting") {
+		t.Fatalf("expected a restart with the refreshed env, got %q %q", run.Stdout, run.Stderr)
+	}
+
+	failing := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "api", "dev", "--", "sh", "-c", "exit 3")
+	if failing.ExitCode != 1 || strings.Contains(failing.Stderr, "restarting") {
+		t.Fatalf("expected no restarts by default, got %d: %s", failing.ExitCode, failing.Stderr)
+	}
+
+	slow := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "api", "dev", "--timeout", "200ms", "--", "sleep", "10")
+	if slow.ExitCode != 1 || !strings.Contains(slow.Stderr, "timed out after 200ms") {
+		t.Fatalf("expected a timeout, got %d: %s", slow.ExitCode, slow.Stderr)
+	}
+}
+
+func TestCommandTiming(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	set := runGitvault(t, nil, "--verbose", "--vault", vaultDir, "secret", "set", "api", "prod", "TOKEN", "value")
+	if set.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", set.Stderr)
+	}
+	if !strings.Contains(set.Stderr, "timing: sops encrypt") || !strings.Contains(set.Stderr, "call(s),") {
+		t.Fatalf("expected per-call timings on stderr, got: %s", set.Stderr)
+	}
+	if strings.Contains(set.Stdout, "timing:") {
+		t.Fatalf("expected timings to stay off stdout: %s", set.Stdout)
+	}
+
+	doctor := runGitvault(t, nil, "--json", "--vault", vaultDir, "doctor", "--no-remote")
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(doctor.Stdout), &payload); err != nil {
+		t.Fatalf("parse doctor: %v: %s", err, doctor.Stdout)
+	}
+	found := false
+	for _, row := range payload.Data {
+		if row[0] == "command timing" {
+			found = true
+			if !strings.Contains(row[2], "sops:") {
+				t.Fatalf("expected sops calls in the timing check, got %v", row)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected a command timing check, got %v", payload.Data)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+	gitVault := filepath.Join(t.TempDir(), "git-vault")
+	if result := runGitvault(t, nil, "init", "--path", gitVault, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if err := runGit(t, "", gitEnv(), "init", "-q", "--bare", remote); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	if err := runGit(t, gitVault, gitEnv(), "remote", "add", "origin", remote); err != nil {
+		t.Fatalf("git remote add: %v", err)
+	}
+	remoteCheck := runGitvault(t, nil, "--verbose", "--vault", gitVault, "doctor")
+	for _, call := range []string{"timing: git remote", "timing: git ls-remote"} {
+		if !strings.Contains(remoteCheck.Stderr, call) {
+			t.Fatalf("expected %q among the timings, got: %s", call, remoteCheck.Stderr)
+		}
+	}
+}
+
+func TestTestsupportFakes(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "vault")
+	mem := testsupport.NewMemFS(map[string][]byte{filepath.Join(root, "secrets", "api", "prod.env"): []byte("old")})
+	store := services.VaultStore{FS: mem}
+	if err := store.EnsureLayout(root); err != nil {
+		t.Fatalf("ensure layout: %v", err)
+	}
+	entries, err := mem.ReadDir(root)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != ".gitvault,files,secrets" {
+		t.Fatalf("expected the vault layout in memory, got %v", names)
+	}
+
+	tmp := store.SecretFilePath(root, "api", "prod") + ".tmp"
+	if err := mem.WriteFile(tmp, []byte("new"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := mem.Rename(tmp, store.SecretFilePath(root, "api", "prod")); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if data, _ := mem.ReadFile(store.SecretFilePath(root, "api", "prod")); string(data) != "new" {
+		t.Fatalf("expected rename to replace the file, got %q", data)
+	}
+	if _, err := mem.Stat(tmp); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the temp file gone, got %v", err)
+	}
+	if err := mem.Remove(store.SecretsDir(root)); err == nil {
+		t.Fatalf("expected removing a non-empty dir to fail")
+	}
+	if err := mem.RemoveAll(store.SecretsDir(root)); err != nil || len(mem.Files()) != 0 {
+		t.Fatalf("expected RemoveAll to drop every file, got %v %v", err, mem.Files())
+	}
+	if err := mem.WriteFile(filepath.Join(root, "missing", "x"), nil, 0o600); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing parent to fail, got %v", err)
+	}
+
+	git := &testsupport.Git{Repos: map[string]bool{root: true}, PushErr: errors.New("offline")}
+	if top, err := git.TopLevel(context.Background(), filepath.Join(root, "secrets")); err != nil || top != root {
+		t.Fatalf("expected the repo root, got %q %v", top, err)
+	}
+	if err := git.Push(context.Background(), root); err == nil || git.Calls[len(git.Calls)-1] != "push "+root {
+		t.Fatalf("expected a recorded failing push, got %v %v", err, git.Calls)
+	}
+
+	runner := &testsupport.Runner{Handle: func(call testsupport.Call) ([]byte, []byte, error) {
+		return []byte(call.Name + " " + strings.Join(call.Args, " ")), nil, nil
+	}}
+	stdout, _, err := runner.Run(context.Background(), "sops", []string{"--version"}, nil, nil, "")
+	if err != nil || string(stdout) != "sops --version" || len(runner.Calls) != 1 {
+		t.Fatalf("expected a scripted run, got %q %v %v", stdout, err, runner.Calls)
+	}
+}
+
+func TestFsyncStorage(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"storage": {"fsync": true}}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	env := map[string]string{"GITVAULT_CONFIG": config}
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", "api", "prod", "TOKEN", "synced"); result.ExitCode != 0 {
+		t.Fatalf("secret set with fsync failed: %s", result.Stderr)
+	}
+	export := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", "api", "prod")
+	if !strings.Contains(export.Stdout, "TOKEN=synced") {
+		t.Fatalf("expected the value written with fsync, got %q", export.Stdout)
+	}
+	matches, _ := filepath.Glob(filepath.Join(vaultDir, "secrets", "api", "*.tmp"))
+	if len(matches) > 0 {
+		t.Fatalf("expected no temp files left, got %v", matches)
+	}
+}
+
+func TestStatsGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	env := gitEnv()
+	for i, value := range []string{"first", strings.Repeat("x", 4096)} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", value); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+		if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if err := runGit(t, vaultDir, env, "commit", "-m", fmt.Sprintf("change %d", i)); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+	}
+	result := runGitvault(t, nil, "--json", "--vault", vaultDir, "stats", "--git")
+	if result.ExitCode != 0 {
+		t.Fatalf("stats --git failed: %s", result.Stderr)
+	}
+	var payload struct {
+		Data struct {
+			Git struct {
+				Commits       int   `json:"commits"`
+				SecretCommits int   `json:"secret_commits"`
+				HistoryBytes  int64 `json:"history_bytes"`
+				LargestDeltas []struct {
+					Path  string `json:"path"`
+					Bytes int64  `json:"bytes"`
+				} `json:"largest_deltas"`
+				Growth []struct {
+					TotalBytes int64 `json:"total_bytes"`
+				} `json:"growth"`
+			} `json:"git"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+		t.Fatalf("parse stats: %v: %s", err, result.Stdout)
+	}
+	git := payload.Data.Git
+	if git.Commits != 2 || git.SecretCommits != 2 || git.HistoryBytes == 0 {
+		t.Fatalf("unexpected git stats: %+v", git)
+	}
+	if len(git.LargestDeltas) == 0 || git.LargestDeltas[0].Path != "secrets/api/dev.env" || git.LargestDeltas[0].Bytes < 4096 {
+		t.Fatalf("expected the large rewrite as the biggest delta, got %+v", git.LargestDeltas)
+	}
+	if len(git.Growth) == 0 || git.Growth[len(git.Growth)-1].TotalBytes != git.HistoryBytes {
+		t.Fatalf("expected growth to add up to the history, got %+v", git.Growth)
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain")
+	if result := runGitvault(t, nil, "init", "--path", plain, "--name", "plain", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", plain, "stats", "--git"); result.ExitCode != 1 {
+		t.Fatalf("expected stats --git to fail outside git, got %d", result.ExitCode)
+	}
+}
+
+func TestVaultGC(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if err := os.MkdirAll(filepath.Join(vaultDir, "deploy"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultDir, "deploy", "prod.env"), []byte("TOKEN=leaked\n"), 0o600); err != nil {
+		t.Fatalf("write plaintext: %v", err)
+	}
+	env := gitEnv()
+	if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, vaultDir, env, "commit", "-m", "oops"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	result := runGitvault(t, nil, "--json", "--vault", vaultDir, "gc")
+	if result.ExitCode != 0 {
+		t.Fatalf("gc failed: %s", result.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+		t.Fatalf("parse gc: %v: %s", err, result.Stdout)
+	}
+	if len(payload.Data) != 1 || payload.Data[0][0] != "deploy/prod.env" || payload.Data[0][1] != "plaintext" {
+		t.Fatalf("expected the committed plaintext as the only candidate, got %v", payload.Data)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "gc", "--path", "secrets/api/dev.env", "--yes"); result.ExitCode != 2 {
+		t.Fatalf("expected managed paths to be rejected, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "gc", "--larger-than", "lots"); result.ExitCode != 2 {
+		t.Fatalf("expected an invalid size to be rejected, got %d", result.ExitCode)
+	}
+	if err := exec.Command("git", "filter-repo", "--version").Run(); err != nil {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "gc", "--path", "deploy/prod.env", "--yes"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "filter-repo") {
+			t.Fatalf("expected gc to require git filter-repo, got %d: %s", result.ExitCode, result.Stderr)
+		}
+	}
+
+	plain := filepath.Join(t.TempDir(), "plain")
+	if result := runGitvault(t, nil, "init", "--path", plain, "--name", "plain", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", plain, "gc"); result.ExitCode != 1 {
+		t.Fatalf("expected gc to fail outside git, got %d", result.ExitCode)
+	}
+}
+
+func TestKeysRotateReplace(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	oldRecipient := testRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", oldRecipient); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	inputPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(inputPath, []byte("certificate"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "api", "dev", "--path", inputPath); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "team", "add", "alice", oldRecipient); result.ExitCode != 0 {
+		t.Fatalf("team add failed: %s", result.Stderr)
+	}
+	env := gitEnv()
+	if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, vaultDir, env, "commit", "-m", "initial"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	newRecipient := randomRecipient(t)
+	unknown := randomRecipient(t)
+	if result := runGitvault(t, nil, "--vault", vaultDir, "keys", "rotate", "--replace", unknown, newRecipient); result.ExitCode != 1 || !strings.Contains(result.Stderr, "not a configured recipient") {
+		t.Fatalf("expected an unknown old recipient to fail, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "keys", "rotate", "--replace", oldRecipient); result.ExitCode != 2 {
+		t.Fatalf("expected --replace without a new recipient to be rejected, got %d", result.ExitCode)
+	}
+	identity := map[string]string{
+		"GIT_AUTHOR_NAME": "GitVault", "GIT_AUTHOR_EMAIL": "gitvault@example.com",
+		"GIT_COMMITTER_NAME": "GitVault", "GIT_COMMITTER_EMAIL": "gitvault@example.com",
+	}
+	sopsLog := filepath.Join(t.TempDir(), "sops.log")
+	identity["GITVAULT_TEST_SOPS_LOG"] = sopsLog
+	result := runGitvault(t, identity, "--vault", vaultDir, "keys", "rotate", "--replace", oldRecipient, newRecipient, "--commit")
+	if result.ExitCode != 0 {
+		t.Fatalf("keys rotate --replace failed: %s", result.Stderr)
+	}
+	list := runGitvault(t, nil, "--vault", vaultDir, "keys", "list")
+	if !strings.Contains(list.Stdout, newRecipient) || strings.Contains(list.Stdout, oldRecipient) {
+		t.Fatalf("expected only the new recipient, got %q", list.Stdout)
+	}
+	logData, err := os.ReadFile(sopsLog)
+	if err != nil {
+		t.Fatalf("read sops log: %v", err)
+	}
+	encryptedFile := false
+	for _, line := range strings.Split(string(logData), "\n") {
+		if strings.Contains(line, "encrypt") && strings.Contains(line, "--input-type binary") && strings.Contains(line, "--age "+newRecipient) {
+			encryptedFile = true
+		}
+	}
+	if !encryptedFile {
+		t.Fatalf("expected the stored file to be re-encrypted for the new recipient, got %s", logData)
+	}
+	if get := runGitvault(t, nil, "--vault", vaultDir, "file", "get", "api", "dev", "cert.pem"); get.ExitCode != 0 || get.Stdout != "certificate" {
+		t.Fatalf("expected the file to survive the swap, got %d: %q %s", get.ExitCode, get.Stdout, get.Stderr)
+	}
+	roster, err := os.ReadFile(filepath.Join(vaultDir, ".gitvault", "team.json"))
+	if err != nil {
+		t.Fatalf("read roster: %v", err)
+	}
+	if !strings.Contains(string(roster), newRecipient) || strings.Contains(string(roster), oldRecipient) {
+		t.Fatalf("expected the roster to list the new recipient, got %s", roster)
+	}
+	if strings.Contains(result.Stderr, "team roster") || strings.Contains(result.Stderr, "file put") {
+		t.Fatalf("expected no follow-up warnings, got %s", result.Stderr)
+	}
+	subject, err := exec.Command("git", "-C", vaultDir, "log", "-1", "--format=%s").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	if got := strings.TrimSpace(string(subject)); got != "Replace recipient "+oldRecipient+" with "+newRecipient {
+		t.Fatalf("expected one replace commit, got %q", got)
+	}
+	if status, _ := exec.Command("git", "-C", vaultDir, "status", "--porcelain").Output(); len(strings.TrimSpace(string(status))) != 0 {
+		t.Fatalf("expected a clean vault after the commit, got %q", status)
+	}
+}
+
+func TestCommitTemplate(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	settingsPath := filepath.Join(vaultDir, ".gitvault", "settings.json")
+	template := `{"commit": {"template": "chore(vault): {action} {refs} by {author}"}}`
+	if err := os.WriteFile(settingsPath, []byte(template), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	identity := map[string]string{
+		"GIT_AUTHOR_NAME": "Vault Bot", "GIT_AUTHOR_EMAIL": "bot@example.com",
+		"GIT_COMMITTER_NAME": "Vault Bot", "GIT_COMMITTER_EMAIL": "bot@example.com",
+	}
+	if result := runGitvault(t, identity, "--vault", vaultDir, "env", "clone", "--project", "api", "--from", "dev", "--to", "stage", "--commit"); result.ExitCode != 0 {
+		t.Fatalf("env clone failed: %s", result.Stderr)
+	}
+	subject, err := exec.Command("git", "-C", vaultDir, "log", "-1", "--format=%s").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	if got := strings.TrimSpace(string(subject)); got != "chore(vault): clone-env api/dev, api/stage by Vault Bot" {
+		t.Fatalf("expected the templated message, got %q", got)
+	}
+}
+
+func TestInitGitFiles(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if err := os.MkdirAll(vaultDir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	custom := "# team rules\n*.log\n"
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitignore"), []byte(custom), 0o600); err != nil {
+		t.Fatalf("write gitignore: %v", err)
+	}
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	attributes, err := os.ReadFile(filepath.Join(vaultDir, ".gitattributes"))
+	if err != nil || !strings.Contains(string(attributes), "secrets/** binary") {
+		t.Fatalf("expected .gitattributes marking secrets binary, got %q (%v)", attributes, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(vaultDir, ".gitignore")); string(data) != custom {
+		t.Fatalf("expected the existing .gitignore to be kept, got %q", data)
+	}
+
+	doctorCheck := func(args ...string) string {
+		t.Helper()
+		result := runGitvault(t, nil, append([]string{"--json", "--vault", vaultDir, "doctor", "--no-remote"}, args...)...)
+		var payload struct {
+			Data [][]string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+			t.Fatalf("parse doctor: %v: %s", err, result.Stdout)
+		}
+		for _, row := range payload.Data {
+			if row[0] == "git hygiene" {
+				return row[1]
+			}
+		}
+		t.Fatalf("no git hygiene check in %s", result.Stdout)
+		return ""
+	}
+	if got := doctorCheck(); got != "ok" {
+		t.Fatalf("expected git hygiene ok, got %s", got)
+	}
+	if err := os.Remove(filepath.Join(vaultDir, ".gitattributes")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if got := doctorCheck(); got != "warn" {
+		t.Fatalf("expected a warning without .gitattributes, got %s", got)
+	}
+	if got := doctorCheck("--fix"); got != "ok" {
+		t.Fatalf("expected --fix to restore .gitattributes, got %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, ".gitattributes")); err != nil {
+		t.Fatalf("expected .gitattributes after --fix: %v", err)
+	}
+}
+
+func TestExportFreshness(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, ref := range [][2]string{{"api", "dev"}, {"web", "dev"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", ref[0], ref[1], "TOKEN", "one"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	// Isolate the per-user state from other tests.
+	env := map[string]string{"GITVAULT_CONFIG": filepath.Join(t.TempDir(), "config.json")}
+	checkouts := t.TempDir()
+	apiEnv := filepath.Join(checkouts, "api", ".env")
+	webEnv := filepath.Join(checkouts, "web", ".env")
+	for _, target := range [][3]string{{"api", "dev", apiEnv}, {"web", "dev", webEnv}} {
+		if err := os.MkdirAll(filepath.Dir(target[2]), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if result := runGitvault(t, env, "--vault", vaultDir, "secret", "export-env", target[0], target[1], "--out", target[2]); result.ExitCode != 0 {
+			t.Fatalf("export failed: %s", result.Stderr)
+		}
+	}
+	statuses := func(wantExit int, args ...string) map[string]string {
+		t.Helper()
+		result := runGitvault(t, env, append([]string{"--json", "status"}, args...)...)
+		if result.ExitCode != wantExit {
+			t.Fatalf("status %v: expected exit %d, got %d: %s", args, wantExit, result.ExitCode, result.Stderr)
+		}
+		var payload struct {
+			Data [][]string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+			t.Fatalf("parse status: %v: %s", err, result.Stdout)
+		}
+		got := map[string]string{}
+		for _, row := range payload.Data {
+			got[row[0]] = row[len(row)-1]
+		}
+		return got
+	}
+	if got := statuses(0); got[apiEnv] != "fresh" || got[webEnv] != "fresh" {
+		t.Fatalf("expected fresh exports, got %v", got)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", "TOKEN", "two"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if err := os.WriteFile(webEnv, []byte("TOKEN=edited\n"), 0o600); err != nil {
+		t.Fatalf("edit export: %v", err)
+	}
+	if got := statuses(1, "--stale"); got[apiEnv] != "stale" || got[webEnv] != "modified" {
+		t.Fatalf("expected stale and modified exports, got %v", got)
+	}
+
+	if err := os.Remove(webEnv); err != nil {
+		t.Fatalf("remove export: %v", err)
+	}
+	if got := statuses(1, "--prune"); len(got) != 1 || got[apiEnv] != "stale" {
+		t.Fatalf("expected the deleted export to be pruned, got %v", got)
+	}
+}
+
+func TestSecretExportDiff(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"API_KEY", "vault-key"}, {"PORT", "8080"}, {"NEW_KEY", "added"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "dev", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	target := filepath.Join(t.TempDir(), ".env")
+	original := "API_KEY=stale-key\nPORT=8080\nOLD_KEY=gone\n"
+	if err := os.WriteFile(target, []byte(original), 0o600); err != nil {
+		t.Fatalf("write env file: %v", err)
+	}
+
+	diff := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "export-env", "api", "dev", "--out", target, "--diff")
+	if diff.ExitCode != 0 {
+		t.Fatalf("export --diff failed: %s", diff.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(diff.Stdout), &payload); err != nil {
+		t.Fatalf("parse diff: %v: %s", err, diff.Stdout)
+	}
+	want := [][]string{{"API_KEY", "changed"}, {"NEW_KEY", "added"}, {"OLD_KEY", "removed"}}
+	if fmt.Sprint(payload.Data) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, payload.Data)
+	}
+	if strings.Contains(diff.Stdout, "stale-key") || strings.Contains(diff.Stdout, "vault-key") {
+		t.Fatalf("expected masked values, got %s", diff.Stdout)
+	}
+	if data, _ := os.ReadFile(target); string(data) != original {
+		t.Fatalf("--diff must not write, got %q", data)
+	}
+
+	if check := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev", "--out", target, "--check"); check.ExitCode != 1 {
+		t.Fatalf("expected --check to fail for a stale file, got %d", check.ExitCode)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev", "--out", target, "--force"); result.ExitCode != 0 {
+		t.Fatalf("export failed: %s", result.Stderr)
+	}
+	if check := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev", "--out", target, "--check"); check.ExitCode != 0 {
+		t.Fatalf("expected --check to pass after export, got %d: %s", check.ExitCode, check.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev", "--diff"); result.ExitCode != 2 {
+		t.Fatalf("expected usage error for --diff to stdout, got %d", result.ExitCode)
+	}
+}
+
+func TestSecretAlias(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][3]string{{"dev", "DB_URL", "postgres://one"}, {"staging", "PORT", "8080"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", kv[0], kv[1], kv[2]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "alias", "app", "staging", "DB_URL", "--to", "app/dev/DB_URL"); result.ExitCode != 0 {
+		t.Fatalf("secret alias failed: %s", result.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "staging")
+	if export.ExitCode != 0 || !strings.Contains(export.Stdout, "DB_URL=postgres://one") || !strings.Contains(export.Stdout, "PORT=8080") {
+		t.Fatalf("expected the aliased value in the export, got %d: %q %s", export.ExitCode, export.Stdout, export.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "DB_URL", "postgres://two"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	run := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "app", "staging", "--", "sh", "-c", `echo "$DB_URL"`)
+	if run.ExitCode != 0 || strings.TrimSpace(run.Stdout) != "postgres://two" {
+		t.Fatalf("expected run to see the rotated target, got %d: %q %s", run.ExitCode, run.Stdout, run.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "alias", "app", "staging", "PORT", "--to", "app/dev/DB_URL"); result.ExitCode != 1 {
+		t.Fatalf("expected aliasing a stored key to fail, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "alias", "app", "prod", "DB_URL", "--to", "app/dev/MISSING"); result.ExitCode != 1 {
+		t.Fatalf("expected a missing target to fail, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "alias", "app", "prod", "DB_URL", "--to", "app/dev"); result.ExitCode != 2 {
+		t.Fatalf("expected an invalid target to be rejected, got %d", result.ExitCode)
+	}
+	list := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "alias", "app", "staging")
+	if !strings.Contains(list.Stdout, `["DB_URL","app/dev/DB_URL"]`) {
+		t.Fatalf("expected the alias listed, got %q", list.Stdout)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "staging", "DB_URL", "postgres://own"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	list = runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "alias", "app", "staging")
+	if strings.Contains(list.Stdout, "DB_URL") {
+		t.Fatalf("expected setting the key to replace its alias, got %q", list.Stdout)
+	}
+	export = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "staging")
+	if !strings.Contains(export.Stdout, "DB_URL=postgres://own") {
+		t.Fatalf("expected the stored value, got %q", export.Stdout)
+	}
+}
+
+func TestRotationReminders(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, ref := range [][3]string{{"api", "prod", "DB_PASSWORD"}, {"api", "prod", "STRIPE_KEY"}, {"api", "dev", "DB_PASSWORD"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", ref[0], ref[1], ref[2], "value"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "reminders"); result.ExitCode != 0 || !strings.Contains(result.Stdout, "no rotation rules") {
+		t.Fatalf("expected a note without rules, got %d: %s", result.ExitCode, result.Stdout)
+	}
+
+	indexPath := filepath.Join(vaultDir, ".gitvault", "index.json")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	var index map[string]any
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("parse index: %v", err)
+	}
+	envs := index["projects"].(map[string]any)["api"].(map[string]any)["envs"].(map[string]any)
+	for _, env := range []string{"prod", "dev"} {
+		keys := envs[env].(map[string]any)["keys"].(map[string]any)
+		keys["DB_PASSWORD"].(map[string]any)["lastUpdated"] = "2020-01-01T00:00:00Z"
+	}
+	if data, err = json.Marshal(index); err != nil {
+		t.Fatalf("encode index: %v", err)
+	}
+	if err := os.WriteFile(indexPath, data, 0o600); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	rules := `{"rotation": [{"env": "prod", "rotateEvery": "90d"}, {"project": "api", "env": "prod", "key": "STRIPE_KEY", "rotateEvery": "30d"}]}`
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitvault", "settings.json"), []byte(rules), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+
+	result := runGitvault(t, nil, "--json", "--vault", vaultDir, "reminders")
+	if result.ExitCode != 1 {
+		t.Fatalf("expected overdue keys to exit 1, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	var payload struct {
+		Data [][]string `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+		t.Fatalf("parse reminders: %v: %s", err, result.Stdout)
+	}
+	if len(payload.Data) != 1 || payload.Data[0][0] != "api" || payload.Data[0][1] != "prod" || payload.Data[0][2] != "DB_PASSWORD" || payload.Data[0][4] != "90d" || payload.Data[0][6] != "overdue" {
+		t.Fatalf("expected only the prod password overdue, got %v", payload.Data)
+	}
+	soon := runGitvault(t, nil, "--json", "--vault", vaultDir, "reminders", "--within", "60d")
+	if !strings.Contains(soon.Stdout, `"STRIPE_KEY"`) || !strings.Contains(soon.Stdout, `"due"]`) {
+		t.Fatalf("expected the stripe key due within 60d, got %s", soon.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "reminders", "--env", "dev"); result.ExitCode != 0 {
+		t.Fatalf("expected dev to have no reminders, got %d: %s", result.ExitCode, result.Stdout)
+	}
+	doctor := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--no-remote")
+	if !strings.Contains(doctor.Stdout, "1 key(s) past their rotation window") {
+		t.Fatalf("expected doctor to warn about rotation, got %s", doctor.Stdout)
+	}
+
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitvault", "settings.json"), []byte(`{"rotation": [{"rotateEvery": "soon"}]}`), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "reminders"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "rotateEvery") {
+		t.Fatalf("expected an invalid rule to fail, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestSecretDeprecate(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"DB_PASS", "old"}, {"DB_PASSWORD", "new"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "deprecate", "app", "prod", "DB_PASS", "--replacement", "DB_PASSWORD", "--note", "remove after 2.0"); result.ExitCode != 0 {
+		t.Fatalf("secret deprecate failed: %s", result.Stderr)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "prod")
+	if export.ExitCode != 0 || !strings.Contains(export.Stdout, "DB_PASS=old") {
+		t.Fatalf("expected the deprecated key exported, got %d: %q", export.ExitCode, export.Stdout)
+	}
+	if !strings.Contains(export.Stderr, "app/prod DB_PASS is deprecated; use DB_PASSWORD (remove after 2.0)") {
+		t.Fatalf("expected a deprecation warning, got %q", export.Stderr)
+	}
+	run := runGitvault(t, nil, "--vault", vaultDir, "secret", "run", "app", "prod", "--", "sh", "-c", "true")
+	if run.ExitCode != 0 || !strings.Contains(run.Stderr, "DB_PASS is deprecated") {
+		t.Fatalf("expected run to warn, got %d: %q", run.ExitCode, run.Stderr)
+	}
+	list := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "list", "app", "prod")
+	if !strings.Contains(list.Stdout, `["DB_PASS","deprecated, use DB_PASSWORD"]`) || !strings.Contains(list.Stdout, `["DB_PASSWORD",""]`) {
+		t.Fatalf("expected the deprecated status in the list, got %q", list.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "deprecate", "app", "prod", "MISSING"); result.ExitCode != 1 {
+		t.Fatalf("expected deprecating a missing key to fail, got %d", result.ExitCode)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "deprecate", "app", "prod", "DB_PASS", "--undo"); result.ExitCode != 0 {
+		t.Fatalf("secret deprecate --undo failed: %s", result.Stderr)
+	}
+	export = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "prod")
+	if strings.Contains(export.Stderr, "deprecated") {
+		t.Fatalf("expected no warning after --undo, got %q", export.Stderr)
+	}
+	list = runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "list", "app", "prod")
+	if !strings.Contains(list.Stdout, `["DB_PASS"]`) {
+		t.Fatalf("expected no status column without deprecations, got %q", list.Stdout)
+	}
+}
+
+func TestSecretAudiences(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"DEPLOY_TOKEN", "deploy-1"}, {"DEBUG_PASSWORD", "debug-1"}, {"NEW_KEY", "new-1"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "prod", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	for _, mark := range [][2]string{{"DEPLOY_TOKEN", "ci-only,deploy"}, {"DEBUG_PASSWORD", "human-only"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "audience", "api", "prod", mark[0], "--set", mark[1]); result.ExitCode != 0 {
+			t.Fatalf("secret audience failed: %s", result.Stderr)
+		}
+	}
+	ci := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "prod", "--audience", "ci")
+	if ci.ExitCode != 0 {
+		t.Fatalf("export --audience failed: %s", ci.Stderr)
+	}
+	if !strings.Contains(ci.Stdout, "DEPLOY_TOKEN=deploy-1") || strings.Contains(ci.Stdout, "DEBUG_PASSWORD") || strings.Contains(ci.Stdout, "NEW_KEY") {
+		t.Fatalf("expected only the ci key, got %q", ci.Stdout)
+	}
+	shown := runGitvault(t, nil, "--json", "--vault", vaultDir, "secret", "audience", "api", "prod", "DEPLOY_TOKEN")
+	if !strings.Contains(shown.Stdout, `"audiences":"ci,deploy"`) {
+		t.Fatalf("expected stored audiences, got %q", shown.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "prod", "DEPLOY_TOKEN", "deploy-2"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	deploy := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "prod", "--audience", "deploy")
+	if !strings.Contains(deploy.Stdout, "DEPLOY_TOKEN=deploy-2") {
+		t.Fatalf("expected audiences to survive a rewrite, got %q", deploy.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "audience", "api", "prod", "MISSING", "--set", "ci"); result.ExitCode != 1 {
+		t.Fatalf("expected missing key to fail, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "prod", "--audience", "ops"); result.ExitCode != 2 {
+		t.Fatalf("expected usage error for unknown audience, got %d", result.ExitCode)
+	}
+}
+
+func TestSecretSetConditional(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	status := func(args ...string) string {
+		t.Helper()
+		result := runGitvault(t, nil, append([]string{"--json", "--vault", vaultDir, "secret", "set", "api", "prod"}, args...)...)
+		if result.ExitCode != 0 {
+			t.Fatalf("secret set %v failed: %s", args, result.Stderr)
+		}
+		var payload struct {
+			Data map[string]string `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+			t.Fatalf("parse set: %v: %s", err, result.Stdout)
+		}
+		return payload.Data["status"]
+	}
+	for _, step := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"DB_PASSWORD", "first", "--if-absent"}, "created"},
+		{[]string{"DB_PASSWORD", "second", "--if-absent"}, "skipped"},
+		{[]string{"DB_PASSWORD", "first", "--if-changed"}, "unchanged"},
+		{[]string{"DB_PASSWORD", "third", "--if-changed"}, "updated"},
+	} {
+		if got := status(step.args...); got != step.want {
+			t.Fatalf("secret set %v: expected %s, got %q", step.args, step.want, got)
+		}
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "prod")
+	if !strings.Contains(export.Stdout, "DB_PASSWORD=third") {
+		t.Fatalf("expected the changed value, got %q", export.Stdout)
+	}
+	both := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "api", "prod", "X", "y", "--if-absent", "--if-changed")
+	if both.ExitCode != 2 {
+		t.Fatalf("expected usage error for both flags, got %d", both.ExitCode)
+	}
+}
+
+func TestValueDigestsAvoidDecrypt(t *testing.T) {
+	vaultDir := filepath.Join(t.TempDir(), "vault")
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, entry := range [][4]string{
+		{"api", "prod", "DB_PASSWORD", "shared-password-123"},
+		{"api", "prod", "PORT", "8080"},
+		{"worker", "prod", "DATABASE_PASS", "shared-password-123"},
+	} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", entry[0], entry[1], entry[2], entry[3]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	meta, err := os.ReadFile(filepath.Join(vaultDir, ".gitvault", "meta.json"))
+	if err != nil {
+		t.Fatalf("read meta: %v", err)
+	}
+	if !strings.Contains(string(meta), "DB_PASSWORD") || strings.Contains(string(meta), "shared-password") {
+		t.Fatalf("expected per-key digests without values: %s", meta)
+	}
+
+	// Without a working sops every command below must avoid decrypting.
+	noSops := map[string]string{"GITVAULT_SOPS_PATH": filepath.Join(t.TempDir(), "missing-sops")}
+	set := runGitvault(t, noSops, "--vault", vaultDir, "secret", "set", "api", "prod", "PORT", "8080")
+	if set.ExitCode != 0 || !strings.Contains(set.Stdout, "unchanged") {
+		t.Fatalf("expected no-op set without decrypting, got %d: %s %s", set.ExitCode, set.Stdout, set.Stderr)
+	}
+
+	report := runGitvault(t, noSops, "--vault", vaultDir, "secret", "dedup-report", "--from-index")
+	if report.ExitCode != 0 || !strings.Contains(report.Stdout, "api/prod/DB_PASSWORD") || !strings.Contains(report.Stdout, "worker/prod/DATABASE_PASS") || strings.Contains(report.Stdout, "PORT") {
+		t.Fatalf("expected the shared password grouped from the index, got %d: %s %s", report.ExitCode, report.Stdout, report.Stderr)
+	}
+
+	local := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(local, []byte("DB_PASSWORD=shared-password-123\nPORT=9090\nEXTRA=1\n"), 0o600); err != nil {
+		t.Fatalf("write env: %v", err)
+	}
+	status := runGitvault(t, noSops, "--vault", vaultDir, "secret", "status", "api", "prod", "--file", local)
+	if status.ExitCode != 1 || !strings.Contains(status.Stdout, "PORT") || !strings.Contains(status.Stdout, "EXTRA") || strings.Contains(status.Stdout, "DB_PASSWORD") {
+		t.Fatalf("expected drift from digests, got %d: %s %s", status.ExitCode, status.Stdout, status.Stderr)
+	}
+}
+
+func TestProjectAndEnvRename(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "billing", "stage", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "billing", "prod", "API_KEY", "prod-value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	photo := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(photo, []byte("certificate"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "billing", "stage", "--path", photo); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+	env := gitEnv()
+	if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, vaultDir, env, "commit", "-m", "init"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "env", "rename", "--project", "billing", "stage", "prod"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "already exists") {
+		t.Fatalf("expected rename onto an existing env to fail, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "env", "rename", "--project", "billing", "stage", "staging"); result.ExitCode != 0 {
+		t.Fatalf("env rename failed: %s", result.Stderr)
+	}
+	identity := map[string]string{
+		"GIT_AUTHOR_NAME": "GitVault", "GIT_AUTHOR_EMAIL": "gitvault@example.com",
+		"GIT_COMMITTER_NAME": "GitVault", "GIT_COMMITTER_EMAIL": "gitvault@example.com",
+	}
+	if result := runGitvault(t, identity, "--vault", vaultDir, "project", "rename", "billing", "payments", "--commit"); result.ExitCode != 0 {
+		t.Fatalf("project rename failed: %s", result.Stderr)
+	}
+
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "payments", "staging")
+	if export.ExitCode != 0 || !strings.Contains(export.Stdout, "API_KEY=value") {
+		t.Fatalf("expected renamed env readable, got %d: %s %s", export.ExitCode, export.Stdout, export.Stderr)
+	}
+	fileOut := filepath.Join(t.TempDir(), "cert.pem")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "get", "payments", "staging", "--name", "cert.pem", "--out", fileOut); result.ExitCode != 0 {
+		t.Fatalf("expected renamed file readable: %s", result.Stderr)
+	}
+	if projects := runGitvault(t, nil, "--vault", vaultDir, "project", "list"); strings.Contains(projects.Stdout, "billing") {
+		t.Fatalf("expected old project gone: %s", projects.Stdout)
+	}
+	if _, err := os.Stat(filepath.Join(vaultDir, "secrets", "billing")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected old secrets dir removed, got %v", err)
+	}
+	if fsck := runGitvault(t, nil, "--vault", vaultDir, "fsck"); fsck.ExitCode != 0 {
+		t.Fatalf("expected consistent vault after rename: %s %s", fsck.Stdout, fsck.Stderr)
+	}
+	cmd := exec.Command("git", "-C", vaultDir, "status", "--porcelain")
+	if output, err := cmd.Output(); err != nil || len(strings.TrimSpace(string(output))) != 0 {
+		t.Fatalf("expected clean worktree after --commit, got %q (%v)", output, err)
+	}
+
+	opaqueDir := filepath.Join(t.TempDir(), "opaque")
+	if result := runGitvault(t, nil, "init", "--path", opaqueDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git", "--obfuscate-names"); result.ExitCode != 0 {
+		t.Fatalf("init obfuscated failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", opaqueDir, "secret", "set", "hidden", "dev", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", opaqueDir, "project", "rename", "hidden", "renamed"); result.ExitCode != 0 {
+		t.Fatalf("obfuscated rename failed: %s", result.Stderr)
+	}
+	if export := runGitvault(t, nil, "--vault", opaqueDir, "secret", "export-env", "renamed", "dev"); !strings.Contains(export.Stdout, "API_KEY=value") {
+		t.Fatalf("expected renamed obfuscated env readable: %s %s", export.Stdout, export.Stderr)
+	}
+	if fsck := runGitvault(t, nil, "--vault", opaqueDir, "fsck"); fsck.ExitCode != 0 {
+		t.Fatalf("expected consistent obfuscated vault: %s %s", fsck.Stdout, fsck.Stderr)
+	}
+}
+
+func TestEnvClone(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "staging", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(cert, []byte("certificate"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "staging", "--path", cert); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "env", "clone", "--project", "app", "--from", "staging"); result.ExitCode != 2 {
+		t.Fatalf("expected usage error without --to, got %d", result.ExitCode)
+	}
+	clone := runGitvault(t, nil, "--vault", vaultDir, "env", "clone", "--project", "app", "--from", "staging", "--to", "staging-eu")
+	if clone.ExitCode != 0 || !strings.Contains(clone.Stdout, "1 key(s), 1 file(s)") {
+		t.Fatalf("env clone failed: %s %s", clone.Stdout, clone.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "env", "clone", "--project", "app", "--from", "staging", "--to", "staging-eu"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "already exists") {
+		t.Fatalf("expected clone onto an existing env to fail, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "staging-eu", "API_KEY", "eu-value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "staging"); !strings.Contains(export.Stdout, "API_KEY=value") {
+		t.Fatalf("expected source env unchanged, got %s %s", export.Stdout, export.Stderr)
+	}
+	if export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "staging-eu"); !strings.Contains(export.Stdout, "API_KEY=eu-value") {
+		t.Fatalf("expected cloned env writable, got %s %s", export.Stdout, export.Stderr)
+	}
+	fileOut := filepath.Join(t.TempDir(), "cert.pem")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "get", "app", "staging-eu", "--name", "cert.pem", "--out", fileOut); result.ExitCode != 0 {
+		t.Fatalf("expected cloned file readable: %s", result.Stderr)
+	}
+	if fsck := runGitvault(t, nil, "--vault", vaultDir, "fsck"); fsck.ExitCode != 0 {
+		t.Fatalf("expected consistent vault after clone: %s %s", fsck.Stdout, fsck.Stderr)
+	}
+}
+
+func TestProjectNewFromTemplate(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "project", "new", "api", "--template", "web-service", "--envs", "dev"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "not found") {
+		t.Fatalf("expected missing template error, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	templates := filepath.Join(vaultDir, ".gitvault", "templates")
+	if err := os.MkdirAll(templates, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	template := `{
+  "envs": ["dev", "prod"],
+  "keys": [
+    {"name": "DATABASE_URL", "value": "postgres://localhost/{project}_{env}"},
+    {"name": "SESSION_SECRET", "generate": "hex", "length": 16}
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(templates, "web-service.json"), []byte(template), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	result := runGitvault(t, nil, "--vault", vaultDir, "--json", "project", "new", "api", "--template", "web-service", "--envs", "dev,staging")
+	if result.ExitCode != 0 {
+		t.Fatalf("project new failed: %s", result.Stderr)
+	}
+	var payload struct {
+		Data struct {
+			Generated    int      `json:"generated"`
+			Placeholders []string `json:"placeholders"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &payload); err != nil {
+		t.Fatalf("parse json: %v (%s)", err, result.Stdout)
+	}
+	if payload.Data.Generated != 1 || strings.Join(payload.Data.Placeholders, ",") != "DATABASE_URL" {
+		t.Fatalf("unexpected payload: %s", result.Stdout)
+	}
+
+	dev := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "dev")
+	staging := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "api", "staging")
+	if !strings.Contains(dev.Stdout, "DATABASE_URL=postgres://localhost/api_dev") || !strings.Contains(staging.Stdout, "api_staging") {
+		t.Fatalf("expected expanded placeholders, got %q and %q", dev.Stdout, staging.Stdout)
+	}
+	devSecret := regexp.MustCompile(`SESSION_SECRET=([0-9a-f]{16})\n`).FindStringSubmatch(dev.Stdout)
+	stagingSecret := regexp.MustCompile(`SESSION_SECRET=([0-9a-f]{16})\n`).FindStringSubmatch(staging.Stdout)
+	if devSecret == nil || stagingSecret == nil || devSecret[1] == stagingSecret[1] {
+		t.Fatalf("expected distinct generated secrets, got %q and %q", dev.Stdout, staging.Stdout)
+	}
+	if envs := runGitvault(t, nil, "--vault", vaultDir, "env", "list", "--project", "api"); strings.Contains(envs.Stdout, "prod") {
+		t.Fatalf("expected --envs to replace the template envs, got %s", envs.Stdout)
+	}
+	if again := runGitvault(t, nil, "--vault", vaultDir, "project", "new", "api", "--template", "web-service"); again.ExitCode != 1 || !strings.Contains(again.Stderr, "already exists") {
+		t.Fatalf("expected existing project to be refused, got %d: %s", again.ExitCode, again.Stderr)
+	}
+}
+
+func TestInitWithRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if result := runGitvault(t, nil, "init", "--path", t.TempDir(), "--skip-git", "--remote", "https://example.com/vault.git"); result.ExitCode != 2 {
+		t.Fatalf("expected --remote with --skip-git to be rejected, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, nil, "init", "--path", t.TempDir(), "--push"); result.ExitCode != 2 {
+		t.Fatalf("expected --push without --remote to be rejected, got %d", result.ExitCode)
+	}
+
+	bare := filepath.Join(t.TempDir(), "vault.git")
+	if err := runGit(t, "", gitEnv(), "init", "-q", "--bare", bare); err != nil {
+		t.Fatalf("git init --bare: %v", err)
+	}
+	identity := map[string]string{
+		"GIT_AUTHOR_NAME": "GitVault", "GIT_AUTHOR_EMAIL": "gitvault@example.com",
+		"GIT_COMMITTER_NAME": "GitVault", "GIT_COMMITTER_EMAIL": "gitvault@example.com",
+	}
+	vaultDir := t.TempDir()
+	result := runGitvault(t, identity, "init", "--path", vaultDir, "--recipient", testRecipient(t), "--remote", bare, "--push")
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "(pushed)") {
+		t.Fatalf("init --remote --push failed: %s %s", result.Stdout, result.Stderr)
+	}
+	output, err := exec.Command("git", "-C", bare, "ls-tree", "-r", "--name-only", "HEAD").Output()
+	if err != nil || !strings.Contains(string(output), ".gitvault/config.json") {
+		t.Fatalf("expected vault pushed to the remote, got %q (%v)", output, err)
+	}
+	upstream, err := exec.Command("git", "-C", vaultDir, "rev-parse", "--abbrev-ref", "@{upstream}").Output()
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(string(upstream)), "origin/") {
+		t.Fatalf("expected origin as upstream, got %q (%v)", upstream, err)
+	}
+
+	other := runGitvault(t, nil, "init", "--path", vaultDir, "--force", "--recipient", testRecipient(t), "--remote", "https://example.com/other.git")
+	if other.ExitCode != 1 || !strings.Contains(other.Stderr, "origin already points to") {
+		t.Fatalf("expected a different existing origin to be refused, got %d: %s", other.ExitCode, other.Stderr)
+	}
+}
+
+func TestSecretTemplate(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", "DATABASE_URL", "postgres://db/app"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", "TOKEN", "token"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	work := t.TempDir()
+	tmplPath := filepath.Join(work, "config.tmpl")
+	tmpl := "env: {{ env }}\ndatabase: {{ .DATABASE_URL | quote }}\ntoken: {{ .TOKEN | b64enc }}\nregion: {{ default \"eu\" \"\" }}\n"
+	if err := os.WriteFile(tmplPath, []byte(tmpl), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	rendered := runGitvault(t, nil, "--vault", vaultDir, "secret", "template", "app", "prod", "--in", tmplPath)
+	want := "env: prod\ndatabase: \"postgres://db/app\"\ntoken: dG9rZW4=\nregion: eu\n"
+	if rendered.ExitCode != 0 || rendered.Stdout != want {
+		t.Fatalf("unexpected render (%d): %q %s", rendered.ExitCode, rendered.Stdout, rendered.Stderr)
+	}
+
+	outPath := filepath.Join(work, "config.yaml")
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "template", "app", "prod", "--in", tmplPath, "--out", outPath); result.ExitCode != 0 {
+		t.Fatalf("template --out failed: %s", result.Stderr)
+	}
+	if info, err := os.Stat(outPath); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0o600) {
+		t.Fatalf("expected 0600 output, got %v (%v)", info, err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "template", "app", "prod", "--in", tmplPath, "--out", outPath); result.ExitCode != 1 {
+		t.Fatalf("expected existing output to need --force, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "template", "app", "prod", "--in", tmplPath, "--out", filepath.Join(vaultDir, "config.yaml")); result.ExitCode != 1 || !strings.Contains(result.Stderr, "inside the vault") {
+		t.Fatalf("expected output inside the vault to be refused, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	if err := os.WriteFile(tmplPath, []byte("{{ .MISSING }}"), 0o600); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "template", "app", "prod", "--in", tmplPath); result.ExitCode != 1 || !strings.Contains(result.Stderr, "MISSING") {
+		t.Fatalf("expected missing key error, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestSecretExportNestedJSON(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"DB_HOST", "db.internal"}, {"DB_PORT", "5432"}, {"API_KEY", "key"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	flat := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--format", "json")
+	var flatDoc map[string]string
+	if err := json.Unmarshal([]byte(flat.Stdout), &flatDoc); err != nil || flatDoc["DB_HOST"] != "db.internal" {
+		t.Fatalf("unexpected flat json: %s %s (%v)", flat.Stdout, flat.Stderr, err)
+	}
+
+	nested := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--format", "json", "--nest-by", "_")
+	var doc map[string]map[string]string
+	if err := json.Unmarshal([]byte(nested.Stdout), &doc); err != nil {
+		t.Fatalf("parse nested json: %v (%s %s)", err, nested.Stdout, nested.Stderr)
+	}
+	if doc["db"]["host"] != "db.internal" || doc["db"]["port"] != "5432" || doc["api"]["key"] != "key" {
+		t.Fatalf("unexpected nested json: %s", nested.Stdout)
+	}
+
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "DB", "conflict"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--format", "json", "--nest-by", "_"); result.ExitCode != 1 || !strings.Contains(result.Stderr, "both map to db") {
+		t.Fatalf("expected nesting conflict, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev", "--nest-by", "_"); result.ExitCode != 2 {
+		t.Fatalf("expected --nest-by without --format json to be rejected, got %d", result.ExitCode)
+	}
+}
+
+func TestSecretReportCSV(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", "API_KEY", "super-secret-value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "API_KEY", "dev-value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "audience", "app", "prod", "API_KEY", "--set", "ci,deploy"); result.ExitCode != 0 {
+		t.Fatalf("secret audience failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "deprecate", "app", "prod", "API_KEY"); result.ExitCode != 0 {
+		t.Fatalf("secret deprecate failed: %s", result.Stderr)
+	}
+	rotation := `{"rotation": [{"project": "app", "env": "prod", "rotateEvery": "30d"}]}`
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitvault", "settings.json"), []byte(rotation), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	env := gitEnv()
+	if err := runGit(t, vaultDir, env, "add", "-A"); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if err := runGit(t, vaultDir, env, "commit", "-m", "add key"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	report := runGitvault(t, nil, "--vault", vaultDir, "secret", "report", "--format", "csv")
+	if report.ExitCode != 0 {
+		t.Fatalf("secret report failed: %s", report.Stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(report.Stdout), "\n")
+	if len(lines) != 3 || lines[0] != "ref,last_updated,author,tags,expiry" {
+		t.Fatalf("unexpected csv: %q", report.Stdout)
+	}
+	if !strings.HasPrefix(lines[1], "app/dev/API_KEY,") || !strings.HasSuffix(lines[1], ",GitVault,,") {
+		t.Fatalf("expected no tags or expiry without metadata or a rotation rule, got: %q", lines[1])
+	}
+	fields := strings.Split(lines[2], ",")
+	if len(fields) != 5 || fields[0] != "app/prod/API_KEY" || fields[2] != "GitVault" {
+		t.Fatalf("unexpected csv row: %q", lines[2])
+	}
+	if fields[3] != "ci;deploy;deprecated" {
+		t.Fatalf("expected audiences and deprecation as tags, got %q", fields[3])
+	}
+	updated, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		t.Fatalf("parse last_updated: %v", err)
+	}
+	if want := updated.AddDate(0, 0, 30).Format("2006-01-02"); fields[4] != want {
+		t.Fatalf("expected expiry %s, got %q", want, fields[4])
+	}
+	if strings.Contains(report.Stdout, "super-secret-value") {
+		t.Fatalf("report must not contain values: %s", report.Stdout)
+	}
+	if tsv := runGitvault(t, nil, "--vault", vaultDir, "secret", "report", "--format", "tsv"); !strings.HasPrefix(tsv.Stdout, "ref\tlast_updated\t") {
+		t.Fatalf("unexpected tsv: %q", tsv.Stdout)
+	}
+}
+
+func TestColorOutput(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	green := "\x1b[32mok\x1b[0m"
+
+	piped := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--no-remote")
+	if strings.Contains(piped.Stdout, "\x1b[") || strings.Contains(piped.Stdout, "-----") {
+		t.Fatalf("expected plain output when piped, got %q", piped.Stdout)
+	}
+	forced := runGitvault(t, map[string]string{"CLICOLOR_FORCE": "1"}, "--vault", vaultDir, "doctor", "--no-remote")
+	if !strings.Contains(forced.Stdout, green) {
+		t.Fatalf("expected colored statuses with CLICOLOR_FORCE, got %q", forced.Stdout)
+	}
+	for name, env := range map[string]map[string]string{
+		"NO_COLOR":   {"CLICOLOR_FORCE": "1", "NO_COLOR": "1"},
+		"--no-color": {"CLICOLOR_FORCE": "1"},
+	} {
+		args := []string{"--vault", vaultDir, "doctor", "--no-remote"}
+		if name == "--no-color" {
+			args = append([]string{"--no-color"}, args...)
+		}
+		if result := runGitvault(t, env, args...); strings.Contains(result.Stdout, "\x1b[") {
+			t.Fatalf("expected %s to disable colors, got %q", name, result.Stdout)
+		}
+	}
+}
+
+func TestProgressSilentWhenPiped(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	certs := t.TempDir()
+	for _, name := range []string{"ca.pem", "server.pem"} {
+		if err := os.WriteFile(filepath.Join(certs, name), []byte(name+" contents"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	for _, args := range [][]string{
+		{"keys", "rotate"},
+		{"doctor", "--deep", "--no-remote"},
+		{"file", "put", "app", "dev", "--path", certs},
+	} {
+		result := runGitvault(t, nil, append([]string{"--vault", vaultDir}, args...)...)
+		if result.ExitCode != 0 {
+			t.Fatalf("%v failed: %s", args, result.Stderr)
+		}
+		if strings.Contains(result.Stderr, "\r") || strings.Contains(result.Stdout, "\r") {
+			t.Fatalf("expected no progress output when piped for %v, got %q %q", args, result.Stdout, result.Stderr)
+		}
+	}
+}
+
+func TestQuietOutput(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "--quiet", "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 || result.Stdout != "" {
+		t.Fatalf("expected silent init, got %d: %q %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "-q", "project", "list"); result.Stdout != "" {
+		t.Fatalf("expected no output for an empty list, got %q", result.Stdout)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "--quiet", "secret", "set", "app", "dev", "API_KEY", "value"); result.ExitCode != 0 || result.Stdout != "" || result.Stderr != "" {
+		t.Fatalf("expected silent set, got %d: %q %q", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if list := runGitvault(t, nil, "--vault", vaultDir, "--quiet", "secret", "list", "app", "dev"); strings.Join(strings.Fields(list.Stdout), " ") != "app dev API_KEY" {
+		t.Fatalf("expected bare rows, got %q", list.Stdout)
+	}
+	if export := runGitvault(t, nil, "--vault", vaultDir, "--quiet", "secret", "export-env", "app", "dev"); export.Stdout != "API_KEY=value\n" {
+		t.Fatalf("expected only the payload, got %q", export.Stdout)
+	}
+	missing := runGitvault(t, nil, "--vault", vaultDir, "--quiet", "secret", "list", "--project", "app")
+	if missing.ExitCode == 0 || !strings.Contains(missing.Stderr, "error:") || strings.Contains(missing.Stderr, "hint:") {
+		t.Fatalf("expected errors without hints, got %d: %q", missing.ExitCode, missing.Stderr)
+	}
+}
+
+func TestDocsGenerate(t *testing.T) {
+	mdDir := t.TempDir()
+	if result := runGitvault(t, nil, "docs", "generate", "--out", mdDir); result.ExitCode != 0 {
+		t.Fatalf("docs generate failed: %s", result.Stderr)
+	}
+	index, err := os.ReadFile(filepath.Join(mdDir, "gitvault.md"))
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	if !strings.Contains(string(index), "[gitvault secret](gitvault-secret.md)") {
+		t.Fatalf("expected index to link commands, got:\n%s", index)
+	}
+	page, err := os.ReadFile(filepath.Join(mdDir, "gitvault-secret-set.md"))
+	if err != nil {
+		t.Fatalf("read secret set page: %v", err)
+	}
+	help := runGitvault(t, nil, "secret", "set", "--help")
+	for _, want := range []string{"# gitvault secret set", "Set a key value", "-stdin", "gitvault secret set myapp dev API_KEY value"} {
+		if !strings.Contains(string(page), want) {
+			t.Fatalf("expected %q in page:\n%s", want, page)
+		}
+	}
+	if !strings.Contains(help.Stdout, "Read value from stdin") || !strings.Contains(string(page), "Read value from stdin") {
+		t.Fatalf("expected page flags to match --help")
+	}
+
+	manDir := t.TempDir()
+	if result := runGitvault(t, nil, "docs", "generate", "--format", "man", "--out", manDir); result.ExitCode != 0 {
+		t.Fatalf("docs generate --format man failed: %s", result.Stderr)
+	}
+	man, err := os.ReadFile(filepath.Join(manDir, "gitvault-keys-add.1"))
+	if err != nil {
+		t.Fatalf("read man page: %v", err)
+	}
+	if !strings.HasPrefix(string(man), ".TH GITVAULT-KEYS-ADD 1") || !strings.Contains(string(man), `\-\-from\-url`) {
+		t.Fatalf("unexpected man page:\n%s", man)
+	}
+	if result := runGitvault(t, nil, "docs", "generate", "--format", "pdf", "--out", manDir); result.ExitCode != 2 {
+		t.Fatalf("expected exit 2 for unknown format, got %d", result.ExitCode)
+	}
+}
+
+func TestAliasExpandsBeforeDispatch(t *testing.T) {
+	vaultDir := t.TempDir()
+	env := map[string]string{"GITVAULT_CONFIG": filepath.Join(t.TempDir(), "config.json")}
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", "app", "dev", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "alias", "add", "devenv", "secret", "export-env", "app", "dev", "--format", "json"); result.ExitCode != 0 {
+		t.Fatalf("alias add failed: %s", result.Stderr)
+	}
+	expanded := runGitvault(t, env, "--vault", vaultDir, "devenv", "--nest-by", "_")
+	if expanded.ExitCode != 0 || !strings.Contains(expanded.Stdout, `"key": "value"`) {
+		t.Fatalf("expected alias to run with appended args, got %d: %s %s", expanded.ExitCode, expanded.Stdout, expanded.Stderr)
+	}
+	list := runGitvault(t, env, "alias", "list")
+	if !strings.Contains(list.Stdout, "devenv") || !strings.Contains(list.Stdout, "secret export-env app dev --format json") {
+		t.Fatalf("expected alias in list, got %q", list.Stdout)
+	}
+	if result := runGitvault(t, env, "alias", "add", "devenv", "secret list"); result.ExitCode != 1 {
+		t.Fatalf("expected replacing without --force to fail, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, env, "alias", "add", "secret", "secret list"); result.ExitCode != 2 {
+		t.Fatalf("expected shadowing a command to fail, got %d", result.ExitCode)
+	}
+	if result := runGitvault(t, env, "alias", "remove", "devenv"); result.ExitCode != 0 {
+		t.Fatalf("alias remove failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "devenv"); result.ExitCode != 2 || !strings.Contains(result.Stderr, "unknown command: devenv") {
+		t.Fatalf("expected removed alias to be unknown, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestPluginsAndHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	binDir := t.TempDir()
+	plugin := "#!/bin/sh\necho \"hello $* from $GITVAULT_VAULT\"\nexit 3\n"
+	if err := os.WriteFile(filepath.Join(binDir, "gitvault-hello"), []byte(plugin), 0o755); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	vaultDir := t.TempDir()
+	env := map[string]string{
+		"GITVAULT_CONFIG": filepath.Join(t.TempDir(), "config.json"),
+		"PATH":            binDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+	}
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--recipient", testRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	vaultRoot, _ := filepath.Abs(vaultDir)
+	result := runGitvault(t, env, "--vault", vaultDir, "hello", "world")
+	if result.ExitCode != 3 || strings.TrimSpace(result.Stdout) != "hello world from "+vaultRoot {
+		t.Fatalf("expected plugin output and exit code, got %d: %q %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+
+	hooks := `{"hooks": [
+  {"when": "pre", "command": "secret set", "run": "echo pre >> hooks.log"},
+  {"when": "post", "command": "secret", "env": "prod", "run": "echo post $GITVAULT_COMMAND $GITVAULT_PROJECT/$GITVAULT_ENV >> hooks.log"},
+  {"when": "pre", "command": "secret unset", "run": "echo blocked >&2; exit 1"}
+]}`
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitvault", "settings.json"), []byte(hooks), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	logPath := filepath.Join(vaultDir, "hooks.log")
+	untrusted := runGitvault(t, env, "--vault", vaultDir, "secret", "set", "app", "prod", "API_KEY", "value")
+	if untrusted.ExitCode != 0 || !strings.Contains(untrusted.Stderr, "untrusted vault hook") {
+		t.Fatalf("expected untrusted hooks to be skipped with a warning, got %d: %s", untrusted.ExitCode, untrusted.Stderr)
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatalf("expected untrusted hooks not to run")
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "hooks", "trust"); result.ExitCode != 0 {
+		t.Fatalf("hooks trust failed: %s", result.Stderr)
+	}
+	for _, envName := range []string{"dev", "prod"} {
+		if result := runGitvault(t, env, "--vault", vaultDir, "secret", "set", "app", envName, "API_KEY", "value"); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read hook log: %v", err)
+	}
+	if string(log) != "pre\npre\npost secret set app/prod\n" {
+		t.Fatalf("unexpected hook log: %q", log)
+	}
+	blocked := runGitvault(t, env, "--vault", vaultDir, "secret", "unset", "app", "prod", "API_KEY")
+	if blocked.ExitCode != 1 || !strings.Contains(blocked.Stderr, "blocked") || !strings.Contains(blocked.Stderr, "pre hook") {
+		t.Fatalf("expected pre hook to stop unset, got %d: %s", blocked.ExitCode, blocked.Stderr)
+	}
+	if list := runGitvault(t, env, "--vault", vaultDir, "secret", "list", "app", "prod"); !strings.Contains(list.Stdout, "API_KEY") {
+		t.Fatalf("expected key to survive a blocked unset, got %q", list.Stdout)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(cert, []byte("certificate"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	input := strings.Join([]string{
+		`{"op": "set", "project": "app", "env": "dev", "key": "API_KEY", "value": "one"}`,
+		`{"op": "set", "project": "app", "env": "dev", "key": "DB_PASSWORD", "value": "two"}`,
+		``,
+		`{"op": "file-put", "project": "app", "env": "dev", "path": ` + strconv.Quote(cert) + `}`,
+		`{"op": "unset", "project": "app", "env": "dev", "key": "DB_PASSWORD"}`,
+	}, "\n")
+	env := map[string]string{
+		"GITVAULT_TEST_STDIN": input,
+		"GIT_AUTHOR_NAME":     "GitVault", "GIT_AUTHOR_EMAIL": "gitvault@example.com",
+		"GIT_COMMITTER_NAME": "GitVault", "GIT_COMMITTER_EMAIL": "gitvault@example.com",
+	}
+	batch := runGitvault(t, env, "--vault", vaultDir, "batch", "--commit", "--message", "Provision app")
+	if batch.ExitCode != 0 {
+		t.Fatalf("batch failed: %s %s", batch.Stdout, batch.Stderr)
+	}
+	if strings.Contains(batch.Stdout, "one") || strings.Count(batch.Stdout, " ok ") != 4 {
+		t.Fatalf("expected four ok results without values, got:\n%s", batch.Stdout)
+	}
+	export := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if export.Stdout != "API_KEY=one\n" {
+		t.Fatalf("unexpected env after batch: %q", export.Stdout)
+	}
+	if fsck := runGitvault(t, nil, "--vault", vaultDir, "fsck"); fsck.ExitCode != 0 {
+		t.Fatalf("expected consistent index after batch: %s %s", fsck.Stdout, fsck.Stderr)
+	}
+	log, err := exec.Command("git", "-C", vaultDir, "log", "--format=%s").Output()
+	if err != nil || strings.TrimSpace(string(log)) != "Provision app" {
+		t.Fatalf("expected one batch commit, got %q (%v)", log, err)
+	}
+
+	failing := map[string]string{"GITVAULT_TEST_STDIN": strings.Join([]string{
+		`{"op": "rename", "project": "app", "env": "dev"}`,
+		`{"op": "set", "project": "app", "env": "dev", "key": "LATER", "value": "x"}`,
+	}, "\n")}
+	result := runGitvault(t, failing, "--vault", vaultDir, "batch")
+	if result.ExitCode != 1 || !strings.Contains(result.Stdout, "unknown op") || !strings.Contains(result.Stdout, "skipped") {
+		t.Fatalf("expected failure and skipped rest, got %d: %s %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if list := runGitvault(t, nil, "--vault", vaultDir, "secret", "list", "app", "dev"); strings.Contains(list.Stdout, "LATER") {
+		t.Fatalf("expected skipped operation not to run, got %q", list.Stdout)
+	}
+}
+
+func TestDumpIndex(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", testRecipient(t)); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, args := range [][]string{
+		{"secret", "set", "app", "dev", "API_KEY", "dump-secret"},
+		{"secret", "set", "app", "prod", "API_KEY", "dump-secret"},
+		{"secret", "set", "billing", "dev", "TOKEN", "dump-secret"},
+	} {
+		if result := runGitvault(t, nil, append([]string{"--vault", vaultDir}, args...)...); result.ExitCode != 0 {
+			t.Fatalf("%v failed: %s", args, result.Stderr)
+		}
+	}
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(cert, []byte("certificate"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "dev", "--path", cert); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+
+	dump := runGitvault(t, nil, "--vault", vaultDir, "dump-index")
+	if dump.ExitCode != 0 || strings.Contains(dump.Stdout, "dump-secret") {
+		t.Fatalf("expected dump without values, got %d: %s %s", dump.ExitCode, dump.Stdout, dump.Stderr)
+	}
+	var doc struct {
+		Version  int `json:"version"`
+		Projects []struct {
+			Name string `json:"name"`
+			Envs []struct {
+				Name string `json:"name"`
+				Keys []struct {
+					Name string `json:"name"`
+				} `json:"keys"`
+				Files []struct {
+					Name string `json:"name"`
+					Size int64  `json:"size"`
+				} `json:"files"`
+			} `json:"envs"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal([]byte(dump.Stdout), &doc); err != nil {
+		t.Fatalf("invalid dump JSON: %v\n%s", err, dump.Stdout)
+	}
+	if doc.Version != 1 || len(doc.Projects) != 2 || doc.Projects[0].Name != "app" || len(doc.Projects[0].Envs) != 2 {
+		t.Fatalf("unexpected dump structure: %s", dump.Stdout)
+	}
+	devEnv := doc.Projects[0].Envs[0]
+	if devEnv.Name != "dev" || len(devEnv.Keys) != 1 || len(devEnv.Files) != 1 || devEnv.Files[0].Size != int64(len("certificate")) {
+		t.Fatalf("unexpected app/dev entry: %s", dump.Stdout)
+	}
+	if again := runGitvault(t, nil, "--vault", vaultDir, "dump-index"); again.Stdout != dump.Stdout {
+		t.Fatalf("expected identical dumps of an unchanged vault")
+	}
+
+	yaml := runGitvault(t, nil, "--vault", vaultDir, "dump-index", "--env", "prod", "--format", "yaml")
+	if yaml.ExitCode != 0 || !strings.Contains(yaml.Stdout, `- name: "prod"`) || strings.Contains(yaml.Stdout, "billing") || strings.Contains(yaml.Stdout, `"dev"`) {
+		t.Fatalf("unexpected filtered YAML dump: %s %s", yaml.Stdout, yaml.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "dump-index", "--format", "xml"); result.ExitCode != 2 {
+		t.Fatalf("expected usage error for unknown format, got %d", result.ExitCode)
+	}
+}
+
+func TestDoctorIdentityMatch(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	identity, err := agekey.Encode("age-secret-key-", secret)
+	if err != nil {
+		t.Fatalf("encode identity: %v", err)
+	}
+	identity = strings.ToUpper(identity)
+	localRecipient, err := agekey.RecipientFromIdentity(identity)
+	if err != nil {
+		t.Fatalf("recipient: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte(identity+"\n"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	env := map[string]string{"SOPS_AGE_KEY_FILE": keyFile}
+	vaultDir := t.TempDir()
+	other := randomRecipient(t)
+	if result := runGitvault(t, env, "init", "--path", vaultDir, "--name", "vault", "--recipient", other, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+
+	mismatch := runGitvault(t, env, "--vault", vaultDir, "doctor", "--no-remote")
+	if mismatch.ExitCode != 1 || !strings.Contains(mismatch.Stdout, "does not match any configured recipient") || !strings.Contains(mismatch.Stderr, "keys add") {
+		t.Fatalf("expected identity mismatch failure, got %d: %s %s", mismatch.ExitCode, mismatch.Stdout, mismatch.Stderr)
+	}
+	if result := runGitvault(t, env, "--vault", vaultDir, "keys", "add", localRecipient); result.ExitCode != 0 {
+		t.Fatalf("keys add failed: %s", result.Stderr)
+	}
+	matched := runGitvault(t, env, "--vault", vaultDir, "doctor", "--no-remote")
+	if matched.ExitCode != 0 || !strings.Contains(matched.Stdout, "identity matches "+localRecipient) {
+		t.Fatalf("expected identity match, got %d: %s %s", matched.ExitCode, matched.Stdout, matched.Stderr)
+	}
+}
+
+func TestRecipientValidation(t *testing.T) {
+	vaultDir := t.TempDir()
+	valid := randomRecipient(t)
+	// Changing the last character breaks the bech32 checksum.
+	last := "q"
+	if strings.HasSuffix(valid, last) {
+		last = "p"
+	}
+	typo := valid[:len(valid)-1] + last
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", typo, "--skip-git"); result.ExitCode != 2 || !strings.Contains(result.Stderr, "malformed age recipient") {
+		t.Fatalf("expected init to reject a malformed recipient, got %d: %s", result.ExitCode, result.Stderr)
+	}
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", valid, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "keys", "add", typo); result.ExitCode != 2 || !strings.Contains(result.Stderr, "invalid checksum") {
+		t.Fatalf("expected keys add to reject a typo, got %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	configPath := filepath.Join(vaultDir, ".gitvault", "config.json")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	config["recipients"] = []string{valid, "age1handedited"}
+	if data, err = json.Marshal(config); err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	if err := os.WriteFile(configPath, data, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	doctor := runGitvault(t, nil, "--vault", vaultDir, "doctor", "--no-remote")
+	if doctor.ExitCode != 1 || !strings.Contains(doctor.Stdout, "1 malformed recipient(s): age1handedited") {
+		t.Fatalf("expected doctor to flag the malformed recipient, got %d: %s %s", doctor.ExitCode, doctor.Stdout, doctor.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "keys", "remove", "age1handedited"); result.ExitCode != 0 {
+		t.Fatalf("expected malformed recipient to stay removable: %s", result.Stderr)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := randomRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	dotenv := func(recipients ...string) string {
+		lines := []string{"API_KEY=ENC[AES256_GCM,data:abc,iv:def,tag:ghi,type:str]"}
+		for i, r := range recipients {
+			lines = append(lines, fmt.Sprintf("sops_age__list_%d__map_recipient=%s", i, r))
+		}
+		return strings.Join(append(lines, "sops_mac=ENC[AES256_GCM,data:mac,type:str]", "sops_version=3.9.1"), "\n") + "\n"
+	}
+	write := func(rel, content string) {
+		path := filepath.Join(vaultDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", rel, err)
+		}
+	}
+	write("secrets/app/dev.env", dotenv(recipient))
+	write("files/app/dev/cert.pem", `{"data":"ENC[AES256_GCM,data:abc,type:str]","sops":{"age":[{"recipient":"`+recipient+`"}],"mac":"ENC[x]","version":"3.9.1"}}`)
+	ok := runGitvault(t, nil, "--vault", vaultDir, "verify")
+	if ok.ExitCode != 0 || !strings.Contains(ok.Stdout, "2 ciphertext(s) match") {
+		t.Fatalf("expected clean verify, got %d: %s %s", ok.ExitCode, ok.Stdout, ok.Stderr)
+	}
+
+	removed := randomRecipient(t)
+	write("secrets/app/prod.env", dotenv(recipient, removed))
+	write("secrets/app/stage.env", "API_KEY=plaintext\n")
+	drift := runGitvault(t, nil, "--vault", vaultDir, "verify")
+	if drift.ExitCode != 1 || !strings.Contains(drift.Stdout, "extra "+removed) || !strings.Contains(drift.Stdout, "value of API_KEY is not encrypted") {
+		t.Fatalf("expected drift and invalid file, got %d: %s %s", drift.ExitCode, drift.Stdout, drift.Stderr)
+	}
+	if strings.Contains(drift.Stdout, "secrets/app/dev.env") || !strings.Contains(drift.Stderr, "keys rotate") {
+		t.Fatalf("expected only problem files and a rotate hint, got: %s %s", drift.Stdout, drift.Stderr)
+	}
+}
+
+func TestAutoHeal(t *testing.T) {
+	if *useRealSops {
+		t.Skip("writes stub ciphertexts")
+	}
+	vaultDir := t.TempDir()
+	recipient := randomRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	removed := randomRecipient(t)
+	secretPath := filepath.Join(vaultDir, "secrets", "app", "dev.env")
+	if err := os.MkdirAll(filepath.Dir(secretPath), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	stale := strings.Join([]string{
+		"API_KEY=ENC[AES256_GCM,data:abc,iv:def,tag:ghi,type:str]",
+		"sops_age__list_0__map_recipient=" + removed,
+		"sops_mac=ENC[AES256_GCM,data:mac,type:str]",
+		"sops_stub=ENC:" + base64.StdEncoding.EncodeToString([]byte("API_KEY=value\n")),
+		"sops_version=3.9.1",
+	}, "\n") + "\n"
+	if err := os.WriteFile(secretPath, []byte(stale), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+
+	result := runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "API_KEY=value") {
+		t.Fatalf("export-env failed: %d %s", result.ExitCode, result.Stderr)
+	}
+	if data, _ := os.ReadFile(secretPath); string(data) != stale {
+		t.Fatalf("expected the secret untouched without autoHeal")
+	}
+
+	if err := os.WriteFile(filepath.Join(vaultDir, ".gitvault", "settings.json"), []byte(`{"autoHeal": true}`), 0o600); err != nil {
+		t.Fatalf("write settings: %v", err)
+	}
+	result = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "API_KEY=value") {
+		t.Fatalf("export-env failed: %d %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stderr, "re-encrypted app/dev") {
+		t.Fatalf("expected a heal note, got %q", result.Stderr)
+	}
+	if data, _ := os.ReadFile(secretPath); string(data) == stale {
+		t.Fatalf("expected the secret re-encrypted for the configured recipients")
+	}
+	result = runGitvault(t, nil, "--vault", vaultDir, "secret", "export-env", "app", "dev")
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "API_KEY=value") || strings.Contains(result.Stderr, "re-encrypted") {
+		t.Fatalf("expected a plain read after the heal, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestCICheck(t *testing.T) {
+	vaultDir := t.TempDir()
+	recipient := randomRecipient(t)
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", recipient, "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "API_KEY", "value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	// The stub sops writes no metadata, so store what real sops would.
+	ciphertext := "API_KEY=ENC[AES256_GCM,data:abc,type:str]\nsops_age__list_0__map_recipient=" + recipient + "\nsops_mac=ENC[x]\nsops_version=3.9.1\n"
+	if err := os.WriteFile(filepath.Join(vaultDir, "secrets", "app", "dev.env"), []byte(ciphertext), 0o600); err != nil {
+		t.Fatalf("write ciphertext: %v", err)
+	}
+	var response struct {
+		OK   bool `json:"ok"`
+		Data []struct {
+			Check  string `json:"check"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	pass := runGitvault(t, nil, "--vault", vaultDir, "--json", "ci", "check", "--strict")
+	if pass.ExitCode != 0 || json.Unmarshal([]byte(pass.Stdout), &response) != nil || !response.OK || len(response.Data) == 0 {
+		t.Fatalf("expected ci check to pass, got %d: %s %s", pass.ExitCode, pass.Stdout, pass.Stderr)
+	}
+
+	if err := os.WriteFile(filepath.Join(vaultDir, "keys.txt"), []byte("AGE-SECRET-KEY-1QQQQ\n"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	fail := runGitvault(t, nil, "--vault", vaultDir, "--json", "ci", "check")
+	if fail.ExitCode != 1 || json.Unmarshal([]byte(fail.Stdout), &response) != nil || response.OK {
+		t.Fatalf("expected ci check to fail on a leaked key, got %d: %s %s", fail.ExitCode, fail.Stdout, fail.Stderr)
+	}
+	for _, check := range response.Data {
+		if check.Status == "fail" && check.Check != "plaintext scan" {
+			t.Fatalf("unexpected failing check %s: %s", check.Check, fail.Stdout)
+		}
+	}
+	if text := runGitvault(t, nil, "--vault", vaultDir, "ci", "check"); !strings.Contains(text.Stdout, "keys.txt (private key)") {
+		t.Fatalf("expected the leaked file to be named, got: %s", text.Stdout)
+	}
+}
+
+func TestSyncGitHubSecrets(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", randomRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"API_KEY", "new-value"}, {"DB_URL", "postgres://db"}, {"GITHUB_SHA", "reserved"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "prod", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	serverPublic, serverPrivate, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var mu sync.Mutex
+	puts := map[string]map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		base := "/repos/org/app/environments/production/actions/secrets"
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == base:
+			_, _ = w.Write([]byte(`{"total_count":1,"secrets":[{"name":"DB_URL"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == base+"/public-key":
+			_ = json.NewEncoder(w).Encode(map[string]string{"key_id": "kid-1", "key": base64.StdEncoding.EncodeToString(serverPublic[:])})
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, base+"/"):
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			puts[strings.TrimPrefix(r.URL.Path, base+"/")] = body
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	env := map[string]string{"GITHUB_API_URL": server.URL, "GITHUB_TOKEN": "test-token", "GH_TOKEN": ""}
+	args := []string{"--vault", vaultDir, "--json", "sync", "github-secrets", "app", "prod", "--repo", "org/app", "--environment", "production"}
+
+	var response struct {
+		OK   bool `json:"ok"`
+		Data []struct {
+			Key    string `json:"key"`
+			Action string `json:"action"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	dry := runGitvault(t, env, append(args, "--dry-run")...)
+	if dry.ExitCode != 0 || json.Unmarshal([]byte(dry.Stdout), &response) != nil || !response.OK {
+		t.Fatalf("dry run failed: %d %s %s", dry.ExitCode, dry.Stdout, dry.Stderr)
+	}
+	actions := map[string]string{}
+	for _, row := range response.Data {
+		actions[row.Key] = row.Action
+	}
+	if actions["API_KEY"] != "create" || actions["DB_URL"] != "update" || actions["GITHUB_SHA"] != "skip" {
+		t.Fatalf("unexpected plan: %s", dry.Stdout)
+	}
+	if len(puts) != 0 {
+		t.Fatalf("dry run uploaded secrets: %v", puts)
+	}
+
+	if result := runGitvault(t, env, args...); result.ExitCode != 0 {
+		t.Fatalf("sync github-secrets failed: %d %s %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if len(puts) != 2 || puts["GITHUB_SHA"] != nil {
+		t.Fatalf("expected API_KEY and DB_URL uploads, got %v", puts)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(puts["API_KEY"]["encrypted_value"])
+	if err != nil || puts["API_KEY"]["key_id"] != "kid-1" || len(sealed) != len("new-value")+48 {
+		t.Fatalf("unexpected upload: %v", puts["API_KEY"])
+	}
+	if bytes.Contains(sealed, []byte("new-value")) {
+		t.Fatal("secret uploaded in plaintext")
+	}
+	if opened, ok := box.OpenAnonymous(nil, sealed, serverPublic, serverPrivate); !ok || string(opened) != "new-value" {
+		t.Fatalf("expected the upload to open to the secret value, got %q (ok=%v)", opened, ok)
+	}
+
+	noToken := runGitvault(t, map[string]string{"GITHUB_API_URL": server.URL, "GITHUB_TOKEN": "", "GH_TOKEN": ""}, args...)
+	if noToken.ExitCode != 1 || !strings.Contains(noToken.Stderr, "GITHUB_TOKEN") {
+		t.Fatalf("expected missing token error, got %d: %s", noToken.ExitCode, noToken.Stderr)
+	}
+}
+
+func TestSyncPlatforms(t *testing.T) {
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", randomRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	for _, kv := range [][2]string{{"API_KEY", "new"}, {"DB_URL", "postgres://db"}, {"SAME", "same"}} {
+		if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "web", "prod", kv[0], kv[1]); result.ExitCode != 0 {
+			t.Fatalf("secret set failed: %s", result.Stderr)
+		}
+	}
+
+	var mu sync.Mutex
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			writes = append(writes, r.Method+" "+r.URL.Path+" "+string(body))
+			mu.Unlock()
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/apps/web-prod/config-vars":
+			_, _ = w.Write([]byte(`{"DB_URL":"postgres://old","SAME":"same","LEGACY":"x"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v9/projects/web/env":
+			_, _ = w.Write([]byte(`{"envs":[{"id":"e1","key":"DB_URL","value":"postgres://db","type":"encrypted","target":["production"]},{"id":"e2","key":"API_KEY","value":"old","type":"encrypted","target":["preview"]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	var response struct {
+		OK   bool `json:"ok"`
+		Data []struct {
+			Key    string `json:"key"`
+			Action string `json:"action"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	plan := func(result commandResult) map[string]string {
+		t.Helper()
+		if result.ExitCode != 0 || json.Unmarshal([]byte(result.Stdout), &response) != nil || !response.OK {
+			t.Fatalf("sync failed: %d %s %s", result.ExitCode, result.Stdout, result.Stderr)
+		}
+		actions := map[string]string{}
+		for _, row := range response.Data {
+			actions[row.Key] = row.Action
+		}
+		return actions
+	}
+
+	heroku := map[string]string{"HEROKU_API_URL": server.URL, "HEROKU_API_KEY": "token"}
+	herokuArgs := []string{"--vault", vaultDir, "--json", "sync", "heroku", "web", "prod", "--app", "web-prod"}
+	actions := plan(runGitvault(t, heroku, append(herokuArgs, "--dry-run")...))
+	if actions["API_KEY"] != "create" || actions["DB_URL"] != "update" || actions["SAME"] != "unchanged" || actions["LEGACY"] != "extra" {
+		t.Fatalf("unexpected heroku plan: %v", actions)
+	}
+	if len(writes) != 0 {
+		t.Fatalf("dry run changed the platform: %v", writes)
+	}
+	if actions := plan(runGitvault(t, heroku, append(herokuArgs, "--prune")...)); actions["LEGACY"] != "remove" {
+		t.Fatalf("expected LEGACY to be removed: %v", actions)
+	}
+	if len(writes) != 1 || !strings.HasPrefix(writes[0], "PATCH /apps/web-prod/config-vars") ||
+		!strings.Contains(writes[0], `"LEGACY":null`) || !strings.Contains(writes[0], `"API_KEY":"new"`) || strings.Contains(writes[0], "SAME") {
+		t.Fatalf("unexpected heroku writes: %v", writes)
+	}
+
+	writes = nil
+	vercel := map[string]string{"VERCEL_API_URL": server.URL, "VERCEL_TOKEN": "token"}
+	actions = plan(runGitvault(t, vercel, "--vault", vaultDir, "--json", "sync", "vercel", "web", "prod", "--vercel-project", "web"))
+	if actions["API_KEY"] != "create" || actions["DB_URL"] != "unchanged" || actions["SAME"] != "create" {
+		t.Fatalf("unexpected vercel plan: %v", actions)
+	}
+	if len(writes) != 2 || !strings.HasPrefix(writes[0], "POST /v10/projects/web/env") || !strings.Contains(writes[0], `"target":["production"]`) {
+		t.Fatalf("unexpected vercel writes: %v", writes)
+	}
+
+	if result := runGitvault(t, map[string]string{"HEROKU_API_KEY": ""}, "--vault", vaultDir, "sync", "heroku", "web", "prod"); result.ExitCode != 2 || !strings.Contains(result.Stderr, "--app is required") {
+		t.Fatalf("expected a usage error, got %d: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestMount(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("FUSE mounts are Linux-only")
+	}
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("no /dev/fuse")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", randomRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "secret", "set", "app", "dev", "API_KEY", "mounted-value"); result.ExitCode != 0 {
+		t.Fatalf("secret set failed: %s", result.Stderr)
+	}
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(certPath, []byte("CERT"), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "dev", "--path", certPath, "--name", "cert.pem"); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+
+	mountpoint := t.TempDir()
+	cmd := exec.Command(gitvaultBin, "--vault", vaultDir, "mount", "--project", "app", mountpoint)
+	cmd.Env = append(os.Environ(), "GITVAULT_SOPS_PATH="+sopsBin, "GITVAULT_CONFIG="+userConfig)
+	if ageKeyFile != "" {
+		cmd.Env = append(cmd.Env, "SOPS_AGE_KEY_FILE="+ageKeyFile)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start mount: %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	envPath := filepath.Join(mountpoint, "dev", ".env")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(envPath); err == nil {
+			break
+		}
+		select {
+		case <-exited:
+			t.Skipf("mount unavailable here: %s", stderr.String())
+		default:
+		}
+		if time.Now().After(deadline) {
+			_ = cmd.Process.Kill()
+			t.Fatalf("mount did not appear: %s", stderr.String())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	data, err := os.ReadFile(envPath)
+	if err != nil || !strings.Contains(string(data), "API_KEY=mounted-value") {
+		t.Fatalf("unexpected .env: %q %v", data, err)
+	}
+	if cert, err := os.ReadFile(filepath.Join(mountpoint, "dev", "cert.pem")); err != nil || string(cert) != "CERT" {
+		t.Fatalf("unexpected cert.pem: %q %v", cert, err)
+	}
+	if err := os.WriteFile(envPath, []byte("X=1\n"), 0o600); err == nil {
+		t.Fatal("expected the mount to be read-only")
+	}
+
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatalf("signal mount: %v", err)
+	}
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("mount exited with %v: %s", err, stderr.String())
+		}
+	case <-time.After(10 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatalf("mount did not exit: %s", stderr.String())
+	}
+	if entries, err := os.ReadDir(mountpoint); err != nil || len(entries) != 0 {
+		t.Fatalf("expected an empty mountpoint after unmount, got %v %v", entries, err)
+	}
+}
+
+func TestFileExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are not supported on Windows")
+	}
+	vaultDir := t.TempDir()
+	if result := runGitvault(t, nil, "init", "--path", vaultDir, "--name", "vault", "--recipient", randomRecipient(t), "--skip-git"); result.ExitCode != 0 {
+		t.Fatalf("init failed: %s", result.Stderr)
+	}
+	keyPath := filepath.Join(t.TempDir(), "tls.key")
+	if err := os.WriteFile(keyPath, []byte("PRIVATE-KEY-BYTES"), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	if result := runGitvault(t, nil, "--vault", vaultDir, "file", "put", "app", "prod", "--path", keyPath, "--name", "tls.key"); result.ExitCode != 0 {
+		t.Fatalf("file put failed: %s", result.Stderr)
+	}
+
+	result := runGitvault(t, nil, "--vault", vaultDir, "file", "exec", "app", "prod", "tls.key", "--", "cat", "{}")
+	if result.ExitCode != 0 || result.Stdout != "PRIVATE-KEY-BYTES" {
+		t.Fatalf("file exec failed: %d %q %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+
+	result = runGitvault(t, nil, "--vault", vaultDir, "file", "exec", "--var", "KEY_FILE", "app", "prod", "tls.key", "--",
+		"sh", "-c", `test -p "$KEY_FILE" && echo "$KEY_FILE" && cat "$KEY_FILE"`)
+	lines := strings.SplitN(result.Stdout, "\n", 2)
+	if result.ExitCode != 0 || len(lines) != 2 || lines[1] != "PRIVATE-KEY-BYTES" {
+		t.Fatalf("file exec via env var failed: %d %q %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if _, err := os.Stat(lines[0]); !os.IsNotExist(err) {
+		t.Fatalf("expected the pipe to be removed, got %v", err)
+	}
+
+	if unread := runGitvault(t, nil, "--vault", vaultDir, "file", "exec", "app", "prod", "tls.key", "--", "true"); unread.ExitCode != 0 {
+		t.Fatalf("expected an unread pipe not to block, got %d: %s", unread.ExitCode, unread.Stderr)
+	}
+	if missing := runGitvault(t, nil, "--vault", vaultDir, "file", "exec", "app", "prod", "tls.key"); missing.ExitCode != 2 {
+		t.Fatalf("expected a usage error without a command, got %d", missing.ExitCode)
+	}
+}
+
+func gitEnv() []string {
+	base := os.Environ()
+	base = append(base,
+		"GIT_AUTHOR_NAME=GitVault",
+		"GIT_AUTHOR_EMAIL=gitvault@example.com",
+		"GIT_COMMITTER_NAME=GitVault",
+		"GIT_COMMITTER_EMAIL=gitvault@example.com",
+	)
+	return base
+}
+
+func runGit(t *testing.T, dir string, env []string, args ...string) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func randomIdentifier(t *testing.T) string {
+	t.Helper()
+	value := testutil.RandomString(t, 6)
+	value = strings.ReplaceAll(value, "-", "")
+	value = strings.ReplaceAll(value, "_", "")
+	return "p" + value
+}
+
+// randomRecipient returns a well-formed age recipient nobody holds the key to.
+func randomRecipient(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	recipient, err := agekey.Encode("age", key)
+	if err != nil {
+		t.Fatalf("encode recipient: %v", err)
+	}
+	return recipient
+}
+
+func testRecipient(t *testing.T) string {
+	t.Helper()
+	if !*useRealSops {
+		return randomRecipient(t)
+	}
+	if strings.TrimSpace(*sopsRecip) != "" {
+		return *sopsRecip
+	}
+	path := strings.TrimSpace(*sopsKeyFile)
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("SOPS_AGE_KEY_FILE"))
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			path = filepath.Join(home, ".config", "sops", "age", "keys.txt")
+		}
+	}
+	if path == "" {
+		t.Fatalf("real-sops requires -sops-recipient or a readable age key file")
+	}
+	recipient, err := readAgeRecipient(path)
+	if err != nil {
+		t.Fatalf("resolve recipient: %v", err)
+	}
+	return recipient
+}
+
+func readAgeRecipient(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		lower := strings.ToLower(line)
+		const marker = "public key:"
+		idx := strings.Index(lower, marker)
+		if idx == -1 {
+			continue
+		}
+		return strings.TrimSpace(line[idx+len(marker):]), nil
+	}
+	return "", fmt.Errorf("no public key in %s; set -sops-recipient", path)
+}
+
+const sopsStubSource = `package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "missing args")
+		os.Exit(2)
+	}
+	for _, arg := range os.Args[1:] {
+		if arg == "--version" {
+			version := os.Getenv("GITVAULT_TEST_SOPS_VERSION")
+			if version == "" {
+				version = "3.9.1"
+			}
+			fmt.Printf("sops %s (latest)\n", version)
+			return
+		}
+	}
+	mode := ""
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--encrypt", "encrypt":
+			mode = "encrypt"
+		case "--decrypt", "decrypt":
+			mode = "decrypt"
+		}
+	}
+	if logPath := os.Getenv("GITVAULT_TEST_SOPS_LOG"); logPath != "" {
+		if f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			line := strings.Join(os.Args[1:len(os.Args)-1], " ")
+			if mark := os.Getenv("GITVAULT_TEST_SOPS_MARK"); mark != "" {
+				line += " mark=" + mark
+			}
+			for _, name := range strings.Split(os.Getenv("GITVAULT_TEST_SOPS_PROBE"), ",") {
+				if _, ok := os.LookupEnv(name); ok && name != "" {
+					line += " env=" + name
+				}
+			}
+			for i, arg := range os.Args[1 : len(os.Args)-1] {
+				if arg == "--config" {
+					config, _ := os.ReadFile(os.Args[i+2])
+					line += " config=" + string(config)
+				}
+			}
+			fmt.Fprintln(f, line)
+			f.Close()
+		}
+	}
+	file := os.Args[len(os.Args)-1]
+	if inputs := os.Getenv("GITVAULT_TEST_SOPS_INPUTS"); inputs != "" {
+		if f, err := os.OpenFile(inputs, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			fmt.Fprintln(f, file)
+			f.Close()
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if os.Getenv("GITVAULT_TEST_SOPS_FAIL") == mode {
+		fmt.Fprintf(os.Stderr, "cannot %s line: %s\n", mode, strings.SplitN(string(data), "\n", 2)[0])
+		os.Exit(1)
+	}
+	switch mode {
+	case "encrypt":
+		encoded := base64.StdEncoding.EncodeToString(data)
+		fmt.Printf("ENC:%s", encoded)
+	case "decrypt":
+		if delay, err := time.ParseDuration(os.Getenv("GITVAULT_TEST_SOPS_DECRYPT_DELAY")); err == nil {
+			time.Sleep(delay)
+		}
+		// Like sops, read identities from SOPS_AGE_KEY and SOPS_AGE_KEY_FILE.
+		if required := os.Getenv("GITVAULT_TEST_SOPS_REQUIRE_KEYS"); required != "" {
+			available := os.Getenv("SOPS_AGE_KEY")
+			if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+				keyFile, _ := os.ReadFile(path)
+				available += "\n" + string(keyFile)
+			}
+			for _, key := range strings.Split(required, ",") {
+				if !strings.Contains(available, key) {
+					fmt.Fprintln(os.Stderr, "no identity matched any of the recipients")
+					os.Exit(1)
+				}
+			}
+		}
+		text := string(data)
+		// Files with SOPS-style metadata carry the stub payload in sops_stub.
+		for _, line := range strings.Split(text, "\n") {
+			if payload, ok := strings.CutPrefix(line, "sops_stub="); ok {
+				text = payload
+			}
+		}
 		if !strings.HasPrefix(text, "ENC:") {
 			fmt.Fprintln(os.Stderr, "invalid ciphertext")
 			os.Exit(1)
@@ -0,0 +1,64 @@
+package agekey
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	recipientHRP = "age"
+	identityHRP  = "age-secret-key-"
+)
+
+// RecipientFromIdentity derives the age1... recipient for an
+// AGE-SECRET-KEY-1... identity.
+func RecipientFromIdentity(secret string) (string, error) {
+	hrp, data, err := Decode(strings.TrimSpace(secret))
+	if err != nil {
+		return "", fmt.Errorf("malformed age identity: %w", err)
+	}
+	if hrp != identityHRP {
+		return "", fmt.Errorf("malformed age identity: unexpected prefix %q", hrp)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return "", fmt.Errorf("malformed age identity: %w", err)
+	}
+	return Encode(recipientHRP, key.PublicKey().Bytes())
+}
+
+// Generate creates a new X25519 identity, returning it in the
+// AGE-SECRET-KEY-1... form age-keygen writes along with its recipient.
+func Generate() (string, string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := Encode(identityHRP, key.Bytes())
+	if err != nil {
+		return "", "", err
+	}
+	recipient, err := Encode(recipientHRP, key.PublicKey().Bytes())
+	if err != nil {
+		return "", "", err
+	}
+	return strings.ToUpper(secret), recipient, nil
+}
+
+// ValidateRecipient checks that value is a well-formed X25519 age recipient.
+func ValidateRecipient(value string) error {
+	hrp, data, err := Decode(value)
+	if err != nil {
+		return fmt.Errorf("malformed age recipient: %w", err)
+	}
+	if hrp != recipientHRP {
+		return fmt.Errorf("malformed age recipient: unexpected prefix %q", hrp)
+	}
+	if len(data) != 32 {
+		return errors.New("malformed age recipient: invalid key length")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package agekey
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const sshEd25519 = "ssh-ed25519"
+
+// curve25519P is the field prime 2^255 - 19 shared by Ed25519 and X25519.
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// RecipientFromSSH converts an authorized_keys style "ssh-ed25519 AAAA..."
+// line to the equivalent age1... recipient, the same mapping ssh-to-age
+// uses. The owner decrypts with their SSH key converted to an age identity.
+func RecipientFromSSH(line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return "", errors.New("malformed ssh public key")
+	}
+	if fields[0] != sshEd25519 {
+		return "", fmt.Errorf("unsupported ssh key type %s; only ssh-ed25519 keys can be converted", fields[0])
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed ssh public key: %w", err)
+	}
+	keyType, rest, err := sshString(blob)
+	if err != nil || string(keyType) != sshEd25519 {
+		return "", errors.New("malformed ssh public key: key type mismatch")
+	}
+	point, rest, err := sshString(rest)
+	if err != nil || len(point) != 32 || len(rest) != 0 {
+		return "", errors.New("malformed ssh public key: invalid ed25519 key")
+	}
+	montgomery, err := edwardsToMontgomery(point)
+	if err != nil {
+		return "", err
+	}
+	return Encode(recipientHRP, montgomery)
+}
+
+// sshString reads one length-prefixed string from the SSH wire format.
+func sshString(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("short ssh key")
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint32(len(data)-4) < n {
+		return nil, nil, errors.New("short ssh key")
+	}
+	return data[4 : 4+n], data[4+n:], nil
+}
+
+// edwardsToMontgomery maps an Ed25519 public key to its X25519 form using
+// u = (1 + y) / (1 - y) mod p.
+func edwardsToMontgomery(point []byte) ([]byte, error) {
+	le := make([]byte, 32)
+	copy(le, point)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverse(le))
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, errors.New("malformed ssh public key: invalid ed25519 point")
+	}
+	one := big.NewInt(1)
+	denominator := new(big.Int).Sub(one, y)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 {
+		return nil, errors.New("malformed ssh public key: invalid ed25519 point")
+	}
+	u := new(big.Int).Add(one, y)
+	u.Mul(u, denominator.ModInverse(denominator, curve25519P))
+	u.Mod(u, curve25519P)
+	out := make([]byte, 32)
+	u.FillBytes(out)
+	return reverse(out), nil
+}
+
+func reverse(b []byte) []byte {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
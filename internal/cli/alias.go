@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/sealr/domain"
+)
+
+func isCommand(name string) bool {
+	if name == "help" {
+		return true
+	}
+	for _, cmd := range commandSummaries {
+		if cmd.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// expandAlias replaces a leading alias from the user config with its command
+// line. Aliases expand once and cannot shadow built-in commands, so an alias
+// never changes what a plain command does.
+func expandAlias(args []string) ([]string, error) {
+	cfg, err := userconfig.Load()
+	if err != nil {
+		return nil, err
+	}
+	line, ok := cfg.Aliases[args[0]]
+	if !ok {
+		return args, nil
+	}
+	expanded, err := encryption.SplitArgs(line)
+	if err != nil {
+		return nil, fmt.Errorf("alias %s: %w", args[0], err)
+	}
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("alias %s is empty", args[0])
+	}
+	return append(expanded, args[1:]...), nil
+}
+
+func (a App) runAlias(out ui.Output, args []string) int {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printAliasUsage(out.Out)
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		if isHelpRequest(args[1:]) {
+			printAliasUsage(out.Out)
+			return 0
+		}
+		return a.runAliasList(out)
+	case "add":
+		return a.runAliasAdd(out, args[1:])
+	case "remove":
+		return a.runAliasRemove(out, args[1:])
+	default:
+		out.Error(fmt.Errorf("unknown alias subcommand: %s", args[0]))
+		printAliasUsage(out.Err)
+		return 2
+	}
+}
+
+func (a App) runAliasList(out ui.Output) int {
+	cfg, err := userconfig.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if len(cfg.Aliases) == 0 {
+		out.Info("no aliases yet")
+		out.Info("hint: add one with `gitvault alias add <name> <command> [args...]`")
+		return 0
+	}
+	names := make([]string, 0, len(cfg.Aliases))
+	for name := range cfg.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, []string{name, cfg.Aliases[name]})
+	}
+	out.Table([]string{"alias", "command"}, rows)
+	return 0
+}
+
+func (a App) runAliasAdd(out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("alias add", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setAliasAddUsage(fs)
+	force := fs.Bool("force", false, "Replace an existing alias")
+	// Plain Parse stops at the alias name, so the command keeps its own
+	// flags and a trailing "--".
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() < 2 {
+		out.Error(errors.New("alias name and command are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	name := fs.Arg(0)
+	if err := domain.ValidateIdentifier(name, "alias name"); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if isCommand(name) {
+		out.Error(fmt.Errorf("%s is a built-in command", name))
+		return 2
+	}
+	line := fs.Arg(1)
+	if fs.NArg() > 2 {
+		line = joinArgs(fs.Args()[1:])
+	}
+	expanded, err := encryption.SplitArgs(line)
+	if err != nil {
+		out.Error(err)
+		return 2
+	}
+	if fs.NArg() > 2 && !slices.Equal(expanded, fs.Args()[1:]) {
+		out.Error(errors.New("an argument mixes single and double quotes; pass the command as one quoted string"))
+		return 2
+	}
+	if len(expanded) == 0 || !isCommand(expanded[0]) {
+		out.Error(errors.New("an alias must start with a gitvault command, e.g. `secret run app prod --`"))
+		return 2
+	}
+	cfg, err := userconfig.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if existing, ok := cfg.Aliases[name]; ok && existing != line && !*force {
+		out.Error(fmt.Errorf("alias %s already runs %q; pass --force to replace it", name, existing))
+		return 1
+	}
+	if cfg.Aliases == nil {
+		cfg.Aliases = map[string]string{}
+	}
+	cfg.Aliases[name] = line
+	if err := userconfig.Save(cfg); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("alias added", map[string]string{"alias": name, "command": line})
+	return 0
+}
+
+func (a App) runAliasRemove(out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("alias remove", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setAliasRemoveUsage(fs)
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 1 {
+		out.Error(errors.New("alias name is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	name := fs.Arg(0)
+	cfg, err := userconfig.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if _, ok := cfg.Aliases[name]; !ok {
+		out.Error(fmt.Errorf("no alias named %s", name))
+		return 1
+	}
+	delete(cfg.Aliases, name)
+	if err := userconfig.Save(cfg); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("alias removed", map[string]string{"alias": name})
+	return 0
+}
+
+// joinArgs quotes arguments with spaces so SplitArgs gives them back.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case strings.Contains(arg, "'"):
+			quoted[i] = `"` + arg + `"`
+		case arg == "" || strings.ContainsAny(arg, " \t\n\""):
+			quoted[i] = "'" + arg + "'"
+		default:
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " ")
+}
@@ -9,9 +9,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/aatuh/gitvault/internal/identity"
+	"github.com/aatuh/gitvault/internal/telemetry"
+	"github.com/aatuh/gitvault/internal/timing"
 	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/vaultref"
 	"github.com/aatuh/sealr/domain"
+	executil "github.com/aatuh/sealr/infra/exec"
 	"github.com/aatuh/sealr/services"
 )
 
@@ -27,14 +33,38 @@ type App struct {
 	Listing       services.ListingService
 	Sync          services.SyncService
 	Store         services.VaultStore
+	Keyring       identity.Keyring
+	// Runner runs the git commands the CLI makes itself, with the timeouts
+	// and timings of the adapters' calls.
+	Runner executil.Runner
+	// Timings collects the sops and git calls made through the adapters,
+	// for doctor and --verbose; nil when not recorded.
+	Timings *timing.Log
+	// Telemetry exports command and call timings when the user opted in;
+	// nil otherwise.
+	Telemetry *telemetry.Recorder
+
+	// OpenVault is called once the vault root is known, before any command
+	// touches it, so adapters can apply per-vault settings.
+	OpenVault func(root string) error
+
+	// link is filled in when a .gitvault.ref resolved the vault.
+	link *vaultLink
+	// scope is filled in with the project and env a command acts on.
+	scope *commandScope
 }
 
 func (a App) Run(ctx context.Context, args []string) int {
+	start := time.Now()
 	global := flag.NewFlagSet("gitvault", flag.ContinueOnError)
 	global.SetOutput(io.Discard)
 	vaultPath := global.String("vault", "", "Vault root path")
 	jsonOut := global.Bool("json", false, "Output JSON")
 	help := global.Bool("help", false, "Show help")
+	noColor := global.Bool("no-color", false, "Disable colored output")
+	quiet := global.Bool("quiet", false, "Print only results and errors")
+	global.BoolVar(quiet, "q", false, "Shorthand for --quiet")
+	verbose := global.Bool("verbose", false, "Print how long each sops and git call took")
 	if err := global.Parse(args); err != nil {
 		o := ui.Output{JSON: *jsonOut, Out: a.Out, Err: a.Err}
 		o.Error(err)
@@ -46,13 +76,59 @@ func (a App) Run(ctx context.Context, args []string) int {
 		return 0
 	}
 
-	o := ui.Output{JSON: *jsonOut, Out: a.Out, Err: a.Err}
+	if *quiet {
+		a.Err = ui.QuietWriter(a.Err)
+	}
+	a.Err = ui.RedactWriter(a.Err)
+	o := ui.Output{
+		JSON:     *jsonOut,
+		Quiet:    *quiet,
+		Color:    !*jsonOut && ui.ColorEnabled(a.Out, *noColor),
+		Decorate: ui.IsTerminal(a.Out),
+		Out:      a.Out,
+		Err:      a.Err,
+	}
+	a.link = &vaultLink{}
+	a.scope = &commandScope{}
+	if !isCommand(remaining[0]) {
+		expanded, err := expandAlias(remaining)
+		if err != nil {
+			o.Error(err)
+			return 2
+		}
+		remaining = expanded
+	}
+	if !isCommand(remaining[0]) {
+		if path, ok := lookupPlugin(remaining[0]); ok {
+			code := a.runPlugin(ctx, o, path, *vaultPath, remaining[1:])
+			a.reportTelemetry(ctx, "plugin", start, code)
+			return code
+		}
+	}
+	hooks := a.loadHooks(*vaultPath, remaining, a.Err)
+	if err := hooks.pre(ctx, a.Err); err != nil {
+		o.Error(err)
+		return 1
+	}
+	code := a.dispatch(ctx, o, *vaultPath, remaining)
+	hooks.post(ctx, a.scope, code, a.Err)
+	if *verbose {
+		printTimings(a.Err, a.Timings)
+	}
+	a.reportTelemetry(ctx, telemetryName(remaining), start, code)
+	return code
+}
+
+func (a App) dispatch(ctx context.Context, o ui.Output, vaultPath string, remaining []string) int {
 	cmd := remaining[0]
 	switch cmd {
 	case "init":
 		return a.runInit(ctx, o, remaining[1:])
 	case "doctor":
-		root, err := a.resolveRoot(*vaultPath)
+		if isHelpRequest(remaining[1:]) {
+			return a.runDoctor(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
@@ -63,7 +139,7 @@ func (a App) Run(ctx context.Context, args []string) int {
 		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
 			return a.runSecret(ctx, o, "", remaining[1:])
 		}
-		root, err := a.resolveRoot(*vaultPath)
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
@@ -74,7 +150,7 @@ func (a App) Run(ctx context.Context, args []string) int {
 		if isHelpRequest(remaining[1:]) {
 			return a.runProject(ctx, o, "", remaining[1:])
 		}
-		root, err := a.resolveRoot(*vaultPath)
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
@@ -85,7 +161,7 @@ func (a App) Run(ctx context.Context, args []string) int {
 		if isHelpRequest(remaining[1:]) {
 			return a.runEnv(ctx, o, "", remaining[1:])
 		}
-		root, err := a.resolveRoot(*vaultPath)
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
@@ -96,18 +172,29 @@ func (a App) Run(ctx context.Context, args []string) int {
 		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
 			return a.runKeys(ctx, o, "", remaining[1:])
 		}
-		root, err := a.resolveRoot(*vaultPath)
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
 			return 1
 		}
 		return a.runKeys(ctx, o, root, remaining[1:])
+	case "team":
+		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
+			return a.runTeam(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runTeam(ctx, o, root, remaining[1:])
 	case "sync":
 		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
 			return a.runSync(ctx, o, "", remaining[1:])
 		}
-		root, err := a.resolveRoot(*vaultPath)
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
@@ -118,13 +205,150 @@ func (a App) Run(ctx context.Context, args []string) int {
 		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
 			return a.runFile(ctx, o, "", remaining[1:])
 		}
-		root, err := a.resolveRoot(*vaultPath)
+		root, err := a.resolveRoot(vaultPath)
 		if err != nil {
 			o.Error(err)
 			printVaultNotFoundHint(err, a.Err)
 			return 1
 		}
 		return a.runFile(ctx, o, root, remaining[1:])
+	case "find":
+		if isHelpRequest(remaining[1:]) {
+			return a.runFind(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runFind(ctx, o, root, remaining[1:])
+	case "stats":
+		if isHelpRequest(remaining[1:]) {
+			return a.runStats(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runStats(ctx, o, root, remaining[1:])
+	case "status":
+		return a.runStatus(o, remaining[1:])
+	case "fsck":
+		if isHelpRequest(remaining[1:]) {
+			return a.runFsck(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runFsck(ctx, o, root, remaining[1:])
+	case "reminders":
+		if isHelpRequest(remaining[1:]) {
+			return a.runReminders(o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runReminders(o, root, remaining[1:])
+	case "gc":
+		if isHelpRequest(remaining[1:]) {
+			return a.runGC(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runGC(ctx, o, root, remaining[1:])
+	case "batch":
+		if isHelpRequest(remaining[1:]) {
+			return a.runBatch(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runBatch(ctx, o, root, remaining[1:])
+	case "verify":
+		if isHelpRequest(remaining[1:]) {
+			return a.runVerify(o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runVerify(o, root, remaining[1:])
+	case "mount":
+		if isHelpRequest(remaining[1:]) {
+			return a.runMount(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runMount(ctx, o, root, remaining[1:])
+	case "docker-entrypoint":
+		return a.runDockerEntrypoint(ctx, o, vaultPath, remaining[1:])
+	case "k8s-sidecar":
+		return a.runK8sSidecar(ctx, o, vaultPath, remaining[1:])
+	case "ci":
+		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
+			return a.runCI(o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runCI(o, root, remaining[1:])
+	case "dump-index":
+		if isHelpRequest(remaining[1:]) {
+			return a.runDumpIndex(ctx, o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runDumpIndex(ctx, o, root, remaining[1:])
+	case "identity":
+		return a.runIdentity(ctx, o, vaultPath, remaining[1:])
+	case "setup":
+		return a.runSetup(ctx, o, vaultPath, remaining[1:])
+	case "link":
+		return a.runLink(ctx, o, remaining[1:])
+	case "hooks":
+		if len(remaining) == 1 || isHelpRequest(remaining[1:]) {
+			return a.runHooks(o, "", remaining[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			o.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runHooks(o, root, remaining[1:])
+	case "alias":
+		return a.runAlias(o, remaining[1:])
+	case "docs":
+		return a.runDocs(ctx, o, remaining[1:])
 	case "help":
 		printUsage(a.Out)
 		return 0
@@ -136,16 +360,50 @@ func (a App) Run(ctx context.Context, args []string) int {
 }
 
 func (a App) resolveRoot(override string) (string, error) {
-	if strings.TrimSpace(override) != "" {
-		return filepath.Abs(override)
+	root, err := a.findRoot(override)
+	if err != nil {
+		return "", err
+	}
+	if err := a.openVault(root); err != nil {
+		return "", err
 	}
+	return root, nil
+}
+
+func (a App) findRoot(override string) (string, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", err
 	}
+	ref, refPath, refErr := vaultref.Find(cwd)
+	if strings.TrimSpace(override) != "" {
+		root, err := filepath.Abs(override)
+		if err == nil && refErr == nil && refPath != "" && ref.Root(refPath) == root {
+			a.useLink(ref, refPath, cwd)
+		}
+		return root, err
+	}
+	if refErr != nil {
+		return "", refErr
+	}
+	if refPath != "" {
+		root := ref.Root(refPath)
+		if _, err := a.Store.FS.Stat(filepath.Join(root, ".gitvault", "config.json")); err != nil {
+			return "", fmt.Errorf("vault %s linked from %s not found; run `git submodule update --init` or fix the link with `gitvault link`", root, refPath)
+		}
+		a.useLink(ref, refPath, cwd)
+		return root, nil
+	}
 	return services.FindVaultRoot(cwd, a.Store.FS)
 }
 
+func (a App) openVault(root string) error {
+	if a.OpenVault == nil {
+		return nil
+	}
+	return a.OpenVault(root)
+}
+
 func formatWarnings(warnings []string) string {
 	if len(warnings) == 0 {
 		return ""
@@ -161,6 +419,8 @@ func parseStrategy(value string) (services.MergeStrategy, error) {
 		return services.MergePreferFile, nil
 	case string(services.MergeInteractive):
 		return services.MergeInteractive, nil
+	case string(mergePreferNewer):
+		return mergePreferNewer, nil
 	default:
 		return "", errors.New("invalid merge strategy")
 	}
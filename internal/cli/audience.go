@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/keymeta"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+var audienceNames = []string{"ci", "deploy", "human"}
+
+// parseAudience accepts a canonical audience name or its "-only" spelling,
+// so ci-only and ci mean the same thing.
+func parseAudience(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), "-only")
+	for _, known := range audienceNames {
+		if name == known {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown audience %q (use %s)", name, strings.Join(audienceNames, ", "))
+}
+
+func parseAudiences(list string) ([]string, error) {
+	seen := map[string]bool{}
+	var audiences []string
+	for _, part := range strings.Split(list, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		audience, err := parseAudience(part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[audience] {
+			seen[audience] = true
+			audiences = append(audiences, audience)
+		}
+	}
+	sort.Strings(audiences)
+	return audiences, nil
+}
+
+func (a App) runSecretAudience(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret audience", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretAudienceUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	set := fs.String("set", "", "Comma-separated audiences for the key: ci, deploy, human")
+	clearAudiences := fs.Bool("clear", false, "Remove the key's audiences")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 1)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) < 1 {
+		out.Error(errors.New("key is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 1 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *set != "" && *clearAudiences {
+		out.Error(errors.New("--set and --clear are mutually exclusive"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	audiences, err := parseAudiences(*set)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	key := remaining[0]
+
+	store := a.metaStore()
+	meta, err := store.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *set == "" && !*clearAudiences {
+		var current []string
+		if entry, ok := meta.Lookup(*project, *env); ok {
+			current = entry.Audiences[key]
+		}
+		out.Success("audiences", map[string]string{"project": *project, "env": *env, "key": key, "audiences": strings.Join(current, ",")})
+		return 0
+	}
+
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	entry := meta.Env(*project, *env)
+	if envIndex := indexEnv(idx, *project, *env); (envIndex == nil || envIndex.Keys[key] == nil) && entry.Aliases[key] == "" {
+		out.Error(fmt.Errorf("key %s not found in %s/%s", key, *project, *env))
+		return 1
+	}
+	if *clearAudiences || len(audiences) == 0 {
+		delete(entry.Audiences, key)
+	} else {
+		if entry.Audiences == nil {
+			entry.Audiences = map[string][]string{}
+		}
+		entry.Audiences[key] = audiences
+	}
+	if err := store.Save(root, meta); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("audiences updated", map[string]string{"project": *project, "env": *env, "key": key, "audiences": strings.Join(audiences, ",")})
+	return 0
+}
+
+// filterAudience keeps only the keys of a dotenv payload that are marked
+// for audience. Keys without any audience are left out, so a new key is
+// never handed to CI before someone decides it belongs there.
+func filterAudience(payload []byte, entry *keymeta.Env, audience string) []byte {
+	parsed, _ := domain.ParseDotenv(payload)
+	values := map[string]string{}
+	var order []string
+	for _, key := range parsed.Order {
+		if entry == nil || !hasAudience(entry.Audiences[key], audience) {
+			continue
+		}
+		values[key] = parsed.Values[key]
+		order = append(order, key)
+	}
+	return domain.RenderDotenvOrdered(values, order)
+}
+
+func hasAudience(audiences []string, audience string) bool {
+	for _, candidate := range audiences {
+		if candidate == audience {
+			return true
+		}
+	}
+	return false
+}
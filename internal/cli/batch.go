@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/ports"
+)
+
+// batchOp is one line of `gitvault batch` input.
+type batchOp struct {
+	Op      string  `json:"op"`
+	Project string  `json:"project"`
+	Env     string  `json:"env"`
+	Key     string  `json:"key,omitempty"`
+	Value   *string `json:"value,omitempty"`
+	Path    string  `json:"path,omitempty"`
+	Name    string  `json:"name,omitempty"`
+}
+
+// indexBufferFS keeps index writes in memory, so a batch of operations saves
+// the index once instead of once per operation.
+type indexBufferFS struct {
+	ports.FileSystem
+	index   string
+	pending []byte
+}
+
+func (f *indexBufferFS) ReadFile(path string) ([]byte, error) {
+	if path == f.index && f.pending != nil {
+		return f.pending, nil
+	}
+	return f.FileSystem.ReadFile(path)
+}
+
+// Rename catches the atomic temp-file-then-rename that saves the index.
+func (f *indexBufferFS) Rename(oldpath, newpath string) error {
+	if newpath != f.index {
+		return f.FileSystem.Rename(oldpath, newpath)
+	}
+	data, err := os.ReadFile(oldpath)
+	if err != nil {
+		return err
+	}
+	f.pending = data
+	return os.Remove(oldpath)
+}
+
+func (a App) runBatch(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setBatchUsage(fs)
+	file := fs.String("file", "-", "NDJSON input path or - for stdin")
+	keepGoing := fs.Bool("keep-going", false, "Run the remaining operations after one fails")
+	commit := fs.Bool("commit", false, "Commit all changes in one git commit")
+	message := fs.String("message", "", "Commit message for --commit")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *message != "" && !*commit {
+		out.Error(errors.New("--message requires --commit"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	input, err := readInputFile(*file)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	buffer := &indexBufferFS{FileSystem: a.Store.FS, index: a.Store.IndexPath(root)}
+	batch := a
+	batch.Store.FS = buffer
+	batch.SecretService.Store.FS = buffer
+	batch.FileService.Store.FS = buffer
+
+	rows := [][]string{}
+	touched := map[envRef]bool{}
+	failed, changed := 0, 0
+	reader := bufio.NewReader(bytes.NewReader(input))
+	for line := 1; ; line++ {
+		raw, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			if failed > 0 && !*keepGoing {
+				rows = append(rows, []string{strconv.Itoa(line), "", "", "skipped", ""})
+			} else {
+				op, target, detail, err := batch.runBatchOp(ctx, root, raw, touched)
+				status := "ok"
+				if err != nil {
+					status, detail = "failed", err.Error()
+					failed++
+				} else if detail != "unchanged" {
+					changed++
+				}
+				rows = append(rows, []string{strconv.Itoa(line), op, target, status, detail})
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			out.Error(readErr)
+			return 1
+		}
+	}
+
+	// Ciphertexts of the successful operations are already written, so the
+	// index is saved even when an operation failed.
+	if buffer.pending != nil {
+		idx, err := batch.Store.LoadIndex(root)
+		if err == nil {
+			err = a.Store.SaveIndex(root, idx)
+		}
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	for ref := range touched {
+		if err := a.recordDigest(ctx, root, ref.project, ref.env); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	out.Table([]string{"line", "op", "target", "status", "detail"}, rows)
+	if failed > 0 {
+		out.Error(fmt.Errorf("%d operation(s) failed", failed))
+		if *commit {
+			fmt.Fprintln(out.Err, "hint: nothing was committed; fix the input and rerun, or commit with git")
+		}
+		return 1
+	}
+	if *commit && changed > 0 {
+		if *message == "" {
+			*message = fmt.Sprintf("Apply %d batch operation(s)", changed)
+		}
+		refs := make([]string, 0, len(touched))
+		for ref := range touched {
+			refs = append(refs, ref.String())
+		}
+		sort.Strings(refs)
+		if err := a.commitVault(ctx, root, commitInfo{action: "batch", summary: *message, refs: refs}); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// runBatchOp runs one input line and returns the op, its target, and a
+// short detail for the results table. Values never appear in the results.
+func (a App) runBatchOp(ctx context.Context, root string, raw []byte, touched map[envRef]bool) (string, string, string, error) {
+	var op batchOp
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&op); err != nil {
+		return "", "", "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	if op.Project == "" && op.Env == "" {
+		op.Project, op.Env, _ = a.linkedEnv()
+	}
+	if err := validateProjectEnv(op.Project, op.Env); err != nil {
+		return op.Op, "", "", err
+	}
+	ref := envRef{project: op.Project, env: op.Env}
+	if (op.Op == "set" || op.Op == "unset") && !domain.IsValidEnvKey(op.Key) {
+		return op.Op, ref.String() + "/" + op.Key, "", fmt.Errorf("invalid key '%s'", op.Key)
+	}
+	switch op.Op {
+	case "set":
+		target := ref.String() + "/" + op.Key
+		if op.Value == nil {
+			return op.Op, target, "", errors.New("value is required")
+		}
+		current, exists, err := a.currentValue(ctx, root, op.Project, op.Env, op.Key)
+		if err != nil {
+			return op.Op, target, "", err
+		}
+		if exists && current == *op.Value {
+			return op.Op, target, "unchanged", nil
+		}
+		if err := a.SecretService.Set(ctx, root, op.Project, op.Env, op.Key, *op.Value); err != nil {
+			return op.Op, target, "", err
+		}
+		touched[ref] = true
+		return op.Op, target, "updated", nil
+	case "unset":
+		target := ref.String() + "/" + op.Key
+		if err := a.SecretService.Unset(ctx, root, op.Project, op.Env, op.Key); err != nil {
+			return op.Op, target, "", err
+		}
+		touched[ref] = true
+		return op.Op, target, "removed", nil
+	case "file-put":
+		if strings.TrimSpace(op.Path) == "" {
+			return op.Op, ref.String(), "", errors.New("path is required")
+		}
+		if strings.TrimSpace(op.Name) == "" {
+			op.Name = filepath.Base(op.Path)
+		}
+		target := ref.String() + "/" + op.Name
+		data, err := os.ReadFile(op.Path)
+		if err != nil {
+			return op.Op, target, "", err
+		}
+		meta, err := a.FileService.Put(ctx, root, op.Project, op.Env, op.Name, data)
+		if err != nil {
+			return op.Op, target, "", err
+		}
+		return op.Op, target, fmt.Sprintf("stored %d bytes", meta.Size), nil
+	case "":
+		return "", ref.String(), "", errors.New("op is required (set, unset, or file-put)")
+	default:
+		return op.Op, ref.String(), "", fmt.Errorf("unknown op %q (use set, unset, or file-put)", op.Op)
+	}
+}
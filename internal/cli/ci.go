@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/opaque"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/services"
+)
+
+// ciCheck is one result of `ci check` in --json output.
+type ciCheck struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// plaintextMarkers are strings that never belong in a vault repository
+// outside SOPS ciphertexts.
+var plaintextMarkers = []string{"AGE-SECRET-KEY-1", "PRIVATE KEY-----"}
+
+func (a App) runCI(out ui.Output, root string, args []string) int {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printCIUsage(out.Out)
+		return 0
+	}
+	switch args[0] {
+	case "check":
+		return a.runCICheck(out, root, args[1:])
+	default:
+		out.Error(fmt.Errorf("unknown ci subcommand: %s", args[0]))
+		printCIUsage(out.Err)
+		return 2
+	}
+}
+
+func (a App) runCICheck(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("ci check", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setCICheckUsage(fs)
+	strict := fs.Bool("strict", false, "Fail on warnings too")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	checks := a.ciChecks(root)
+	failed := 0
+	for _, check := range checks {
+		if check.Status == services.CheckFail || (*strict && check.Status == services.CheckWarn) {
+			failed++
+		}
+	}
+	summary := fmt.Sprintf("%d check(s) passed", len(checks))
+	if failed > 0 {
+		summary = fmt.Sprintf("%d of %d check(s) failed", failed, len(checks))
+	}
+	if out.JSON {
+		results := make([]ciCheck, 0, len(checks))
+		for _, check := range checks {
+			results = append(results, ciCheck{Check: check.Name, Status: string(check.Status), Message: check.Message})
+		}
+		_ = json.NewEncoder(out.Out).Encode(ui.Response{OK: failed == 0, Message: summary, Data: results})
+	} else {
+		rows := make([][]string, 0, len(checks))
+		for _, check := range checks {
+			rows = append(rows, []string{check.Name, string(check.Status), check.Message})
+		}
+		out.Table([]string{"check", "status", "message"}, rows)
+		if failed > 0 {
+			fmt.Fprintln(out.Err, "error: "+summary)
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// ciChecks runs the checks that need no identity: the vault's own files,
+// the ciphertexts' metadata, and a scan for leaked plaintext.
+func (a App) ciChecks(root string) []services.CheckResult {
+	checks := []services.CheckResult{a.checkRecipients(root)}
+	vaultSettings, settingsCheck := a.checkSettings(root)
+	checks = append(checks, settingsCheck)
+	checks = append(checks, a.checkCiphertexts(root))
+	if vaultSettings.ObfuscateNames {
+		checks = append(checks, services.CheckResult{Name: "index consistency", Status: services.CheckWarn, Message: "skipped: the index of an obfuscated vault is encrypted"})
+	} else {
+		checks = append(checks, a.checkConsistency(root))
+	}
+	if settingsCheck.Status != services.CheckWarn {
+		checks = append(checks, a.checkKeyGroups(root)...)
+	}
+	checks = append(checks, a.checkTeamRoster(root)...)
+	return append(checks, checkPlaintext(root))
+}
+
+func (a App) checkSettings(root string) (settings.Settings, services.CheckResult) {
+	result := services.CheckResult{Name: "vault settings"}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		if raw, readErr := os.ReadFile(settings.Path(root)); readErr == nil && opaque.Sealed(raw) {
+			result.Status = services.CheckWarn
+			result.Message = "skipped: the settings of an obfuscated vault are encrypted"
+			return settings.Settings{ObfuscateNames: true}, result
+		}
+	}
+	if err == nil {
+		err = validateHooks(vaultSettings.Hooks)
+	}
+	if err == nil {
+		err = validateRotation(vaultSettings.Rotation)
+	}
+	if err == nil {
+		err = validateExportPolicies(vaultSettings.ExportPolicies)
+	}
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return vaultSettings, result
+	}
+	result.Status = services.CheckOK
+	result.Message = "valid"
+	return vaultSettings, result
+}
+
+func (a App) checkCiphertexts(root string) services.CheckResult {
+	result := services.CheckResult{Name: "ciphertexts"}
+	verified, issues, err := a.verifyCiphertexts(root, nil)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(issues) > 0 {
+		first := issues[0]
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%d of %d with problems (e.g. %s: %s %s); run `gitvault verify` for all", len(issues), verified, first.path, first.problem, first.detail)
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("%d encrypted to the configured recipients", verified)
+	return result
+}
+
+// checkPlaintext looks for secret material outside the ciphertexts: private
+// keys anywhere, and dotenv files outside secrets/ (which verify covers).
+func checkPlaintext(root string) services.CheckResult {
+	result := services.CheckResult{Name: "plaintext scan"}
+	var found []string
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			if rel == ".git" || rel == "secrets" || rel == "files" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := entry.Name()
+		if name == ".env" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env") {
+			found = append(found, rel+" (dotenv file)")
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, marker := range plaintextMarkers {
+			if bytes.Contains(data, []byte(marker)) {
+				found = append(found, rel+" (private key)")
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(found) > 0 {
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%d suspicious file(s): %s", len(found), strings.Join(found, ", "))
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = "no plaintext secrets found"
+	return result
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aatuh/sealr/services"
+)
+
+// clockTolerance is how far a timestamp may lead the local clock or the
+// commit that recorded it before it counts as skew.
+const clockTolerance = 5 * time.Minute
+
+// checkTimestamps looks for index timestamps written by a machine with a
+// wrong clock: ones in the future, ones before the vault was created, and
+// ones later than the commit that recorded them. Rotation reminders and
+// freshness checks trust these times.
+func (a App) checkTimestamps(ctx context.Context, root string) services.CheckResult {
+	result := services.CheckResult{Name: "timestamps"}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		result.Status = services.CheckWarn
+		result.Message = "skipped: " + err.Error()
+		return result
+	}
+	now := time.Now()
+	var created time.Time
+	if cfg, err := a.Store.LoadConfig(root); err == nil {
+		created = cfg.CreatedAt
+	}
+
+	var newest time.Time
+	var newestRef string
+	total, future, early := 0, 0, 0
+	note := func(ref string, updated time.Time) {
+		if updated.IsZero() {
+			return
+		}
+		total++
+		if updated.After(now.Add(clockTolerance)) {
+			future++
+		}
+		if !created.IsZero() && updated.Before(created.Add(-clockTolerance)) {
+			early++
+		}
+		if updated.After(newest) {
+			newest, newestRef = updated, ref
+		}
+	}
+	for projectName, project := range idx.Projects {
+		if project == nil {
+			continue
+		}
+		for envName, env := range project.Envs {
+			if env == nil {
+				continue
+			}
+			for key, meta := range env.Keys {
+				if meta != nil {
+					note(projectName+"/"+envName+"/"+key, meta.LastUpdated)
+				}
+			}
+			for name, meta := range env.Files {
+				if meta != nil {
+					note(projectName+"/"+envName+"/"+name, meta.LastUpdated)
+				}
+			}
+		}
+	}
+
+	var problems []string
+	if future > 0 {
+		problems = append(problems, fmt.Sprintf("%d timestamp(s) in the future (latest %s on %s)", future, newest.UTC().Format(time.RFC3339), newestRef))
+	}
+	if early > 0 {
+		problems = append(problems, fmt.Sprintf("%d timestamp(s) before the vault was created (%s)", early, created.UTC().Format(time.RFC3339)))
+	}
+	if committed, ok := a.indexCommitTime(ctx, root); ok {
+		if committed.After(now.Add(clockTolerance)) {
+			problems = append(problems, fmt.Sprintf("the last index commit is dated %s, in the future", committed.UTC().Format(time.RFC3339)))
+		} else if newest.After(committed.Add(clockTolerance)) {
+			problems = append(problems, fmt.Sprintf("%s is dated %s, after the commit that recorded it (%s)", newestRef, newest.UTC().Format(time.RFC3339), committed.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(problems) > 0 {
+		result.Status = services.CheckWarn
+		result.Message = strings.Join(problems, "; ")
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("%d timestamp(s) consistent with this clock", total)
+	return result
+}
+
+// indexCommitTime returns the committer date of the last commit that
+// changed the index, when the index on disk is that commit's version.
+func (a App) indexCommitTime(ctx context.Context, root string) (time.Time, bool) {
+	if a.Sync.Git == nil {
+		return time.Time{}, false
+	}
+	if isRepo, err := a.Sync.Git.IsRepo(ctx, root); err != nil || !isRepo {
+		return time.Time{}, false
+	}
+	rel, err := filepath.Rel(root, a.Store.IndexPath(root))
+	if err != nil {
+		return time.Time{}, false
+	}
+	rel = filepath.ToSlash(rel)
+	// Uncommitted edits carry times no commit has seen yet.
+	if status, err := a.vaultGitOutput(ctx, root, nil, "status", "--porcelain", "--", rel); err != nil || len(strings.TrimSpace(string(status))) > 0 {
+		return time.Time{}, false
+	}
+	output, err := a.vaultGitOutput(ctx, root, nil, "log", "-1", "--format=%ct", "--", rel)
+	if err != nil {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
@@ -1,17 +1,28 @@
 package cli
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aatuh/gitvault/guard"
+	"github.com/aatuh/gitvault/internal/agekey"
+	"github.com/aatuh/gitvault/internal/dotenv"
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/gitsync"
+	"github.com/aatuh/gitvault/internal/securemem"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/team"
 	"github.com/aatuh/gitvault/internal/ui"
 	"github.com/aatuh/sealr/domain"
 	"github.com/aatuh/sealr/services"
@@ -39,6 +50,9 @@ func (a App) runInit(ctx context.Context, out ui.Output, args []string) int {
 	name := fs.String("name", "", "Vault name")
 	force := fs.Bool("force", false, "Overwrite existing config")
 	skipGit := fs.Bool("skip-git", false, "Skip git init")
+	obfuscate := fs.Bool("obfuscate-names", false, "Hash project, env, and file names on disk")
+	remote := fs.String("remote", "", "Git URL to add as origin")
+	push := fs.Bool("push", false, "Commit the new vault and push it to --remote")
 	var recipients stringSliceFlag
 	fs.Var(&recipients, "recipient", "Age recipient (repeatable)")
 	if err := fs.Parse(args); err != nil {
@@ -50,6 +64,16 @@ func (a App) runInit(ctx context.Context, out ui.Output, args []string) int {
 		return 2
 	}
 
+	for i, value := range recipients {
+		recipient, err := normalizeRecipient(value)
+		if err != nil {
+			out.Error(fmt.Errorf("--recipient %s: %w", value, err))
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+		recipients[i] = recipient
+	}
+
 	root, err := filepath.Abs(*path)
 	if err != nil {
 		out.Error(err)
@@ -59,6 +83,35 @@ func (a App) runInit(ctx context.Context, out ui.Output, args []string) int {
 	if vaultName == "" {
 		vaultName = filepath.Base(root)
 	}
+	if *remote != "" && *skipGit {
+		out.Error(errors.New("--remote cannot be combined with --skip-git"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *push && *remote == "" {
+		out.Error(errors.New("--push requires --remote"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *obfuscate {
+		if len(recipients) == 0 {
+			out.Error(errors.New("--obfuscate-names requires at least one --recipient"))
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+		if _, err := os.Stat(a.Store.ConfigPath(root)); err == nil {
+			out.Error(errors.New("--obfuscate-names can only be used when creating a new vault"))
+			return 1
+		}
+		if err := settings.Save(a.Store.FS, root, settings.Settings{ObfuscateNames: true}); err != nil {
+			out.Error(err)
+			return 1
+		}
+		if err := a.openVault(root); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
 
 	if err := a.InitService.Init(ctx, services.InitOptions{
 		Root:       root,
@@ -70,6 +123,25 @@ func (a App) runInit(ctx context.Context, out ui.Output, args []string) int {
 		out.Error(err)
 		return 1
 	}
+	gitFiles, err := a.writeVaultGitFiles(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	if *remote != "" {
+		if err := a.setOrigin(ctx, root, *remote); err != nil {
+			out.Error(fmt.Errorf("vault initialized, but adding origin failed: %w", err))
+			return 1
+		}
+		if *push {
+			if err := a.pushInitial(ctx, root); err != nil {
+				out.Error(fmt.Errorf("vault initialized, but push failed: %w", err))
+				printRemoteHint(services.CheckResult{Message: classifyRemoteError(err.Error())}, out.Err)
+				return 1
+			}
+		}
+	}
 
 	warning := ""
 	if len(recipients) == 0 {
@@ -77,22 +149,44 @@ func (a App) runInit(ctx context.Context, out ui.Output, args []string) int {
 	}
 	if out.JSON {
 		data := map[string]string{"root": root}
+		if *remote != "" {
+			data["remote"] = redactRemote(*remote)
+			data["pushed"] = strconv.FormatBool(*push)
+		}
 		if warning != "" {
 			data["warning"] = warning
 		}
 		out.Success("vault initialized", data)
 		return 0
 	}
+	if out.Quiet {
+		if warning != "" {
+			fmt.Fprintln(out.Err, "warning:", warning)
+		}
+		return 0
+	}
 	fmt.Fprintln(out.Out, "vault initialized")
 	fmt.Fprintf(out.Out, "root: %s\n", root)
-	fmt.Fprintln(out.Out, "created:")
-	fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, ".gitvault"))
-	fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, "secrets"))
-	fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, "files"))
-	fmt.Fprintln(out.Out, "next:")
-	fmt.Fprintf(out.Out, "  gitvault --vault %s doctor\n", root)
-	fmt.Fprintf(out.Out, "  gitvault --vault %s keys add <age1...>\n", root)
-	fmt.Fprintf(out.Out, "  gitvault --vault %s secret set <project> <env> KEY value\n", root)
+	if *remote != "" {
+		state := "added"
+		if *push {
+			state = "pushed"
+		}
+		fmt.Fprintf(out.Out, "origin: %s (%s)\n", redactRemote(*remote), state)
+	}
+	if out.Decorate {
+		fmt.Fprintln(out.Out, "created:")
+		fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, ".gitvault"))
+		fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, "secrets"))
+		fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, "files"))
+		for _, name := range gitFiles {
+			fmt.Fprintf(out.Out, "  %s\n", filepath.Join(root, name))
+		}
+		fmt.Fprintln(out.Out, "next:")
+		fmt.Fprintf(out.Out, "  gitvault --vault %s doctor\n", root)
+		fmt.Fprintf(out.Out, "  gitvault --vault %s keys add <age1...>\n", root)
+		fmt.Fprintf(out.Out, "  gitvault --vault %s secret set <project> <env> KEY value\n", root)
+	}
 	if warning != "" {
 		fmt.Fprintln(out.Out, "note:", warning)
 	}
@@ -103,6 +197,11 @@ func (a App) runDoctor(ctx context.Context, out ui.Output, root string, args []s
 	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
 	fs.SetOutput(out.Out)
 	setDoctorUsage(fs)
+	fix := fs.Bool("fix", false, "Repair file permissions and write missing .gitattributes/.gitignore")
+	deep := fs.Bool("deep", false, "Decrypt every secret and file")
+	parallel := fs.Int("parallel", 4, "Concurrent decrypts for --deep")
+	noRemote := fs.Bool("no-remote", false, "Skip the git remote connectivity check")
+	remoteTimeout := fs.Duration("remote-timeout", defaultRemoteTimeout, "Timeout for the git remote check")
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -111,12 +210,57 @@ func (a App) runDoctor(ctx context.Context, out ui.Output, root string, args []s
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	if *parallel < 1 {
+		out.Error(errors.New("--parallel must be at least 1"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *remoteTimeout <= 0 {
+		out.Error(errors.New("--remote-timeout must be positive"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
 
 	report, err := a.DoctorService.Run(ctx, root)
 	if err != nil {
 		out.Error(err)
 		return 1
 	}
+	if check, ok := checkSopsVersion(report); ok {
+		report.Checks = append(report.Checks, check)
+	}
+	if vaultConfigLoaded(report) {
+		report.Checks = append(report.Checks, checkPermissions(root, *fix), a.checkVaultGitFiles(root, *fix), checkTempDir(), a.checkConsistency(root))
+		report.Checks = append(report.Checks, a.checkRecipients(root))
+		report.Checks = append(report.Checks, a.checkRecipientTools(root)...)
+		report.Checks = append(report.Checks, a.checkKeyGroups(root)...)
+		report.Checks = append(report.Checks, a.checkTeamRoster(root)...)
+		report.Checks = append(report.Checks, a.checkRotation(root)...)
+		report.Checks = append(report.Checks, a.checkTimestamps(ctx, root))
+		if !*noRemote {
+			report.Checks = append(report.Checks, a.checkGitRemote(ctx, root, *remoteTimeout)...)
+		}
+	}
+	identityChecks, extraIdentities := a.checkExtraIdentities()
+	report.Checks = append(report.Checks, identityChecks...)
+	report.Checks = append(report.Checks, checkKeyservices(keyserviceTimeout)...)
+	if vaultConfigLoaded(report) {
+		canDecrypt := checkPassed(report, "sops") && !checkFailed(report, "sops version")
+		if check, ok := a.checkIdentityMatch(ctx, root, canDecrypt); ok {
+			report.Checks = append(report.Checks, check)
+		}
+	}
+	if *deep {
+		if vaultConfigLoaded(report) && checkPassed(report, "sops") && !checkFailed(report, "sops version") {
+			report.Checks = append(report.Checks, a.deepChecks(ctx, out, root, *parallel)...)
+		} else {
+			report.Checks = append(report.Checks, services.CheckResult{Name: "deep decrypt", Status: services.CheckWarn, Message: "skipped: vault config or sops unavailable"})
+		}
+	}
+
+	if check, ok := checkTimings(a.Timings); ok {
+		report.Checks = append(report.Checks, check)
+	}
 
 	rows := make([][]string, 0, len(report.Checks))
 	for _, check := range report.Checks {
@@ -127,10 +271,38 @@ func (a App) runDoctor(ctx context.Context, out ui.Output, root string, args []s
 		if check.Name == "vault config" && check.Status == services.CheckFail {
 			fmt.Fprintln(out.Err, "hint: run `gitvault init --path <vault>` or pass --vault PATH")
 		}
-		if check.Name == "age identity" && check.Status != services.CheckOK {
+		if check.Name == "age identity" && check.Status != services.CheckOK && !extraIdentities {
 			fmt.Fprintln(out.Err, "hint: set SOPS_AGE_KEY_FILE or run `age-keygen -o ~/.config/sops/age/keys.txt`")
 		}
+		if check.Name == "recipients" && check.Status == services.CheckFail {
+			fmt.Fprintln(out.Err, "hint: remove malformed recipients with `gitvault keys remove <recipient>` and add the correct key")
+		}
+		if check.Name == "identity match" && check.Status == services.CheckFail {
+			fmt.Fprintln(out.Err, "hint: share your recipient from `gitvault identity list` and have a teammate run `gitvault keys add <recipient>`")
+		}
+		if check.Name == "file permissions" && check.Status == services.CheckWarn {
+			fmt.Fprintln(out.Err, "hint: run `gitvault doctor --fix` to restrict vault files to the owner")
+		}
+		if check.Name == "git hygiene" && check.Status == services.CheckWarn {
+			fmt.Fprintln(out.Err, "hint: run `gitvault doctor --fix` to add the .gitattributes and .gitignore new vaults get")
+		}
+		if check.Name == "sops version" && check.Status == services.CheckFail {
+			fmt.Fprintln(out.Err, "hint: upgrade sops from https://github.com/getsops/sops/releases")
+		}
+		if check.Name == "command timing" && check.Status == services.CheckWarn {
+			fmt.Fprintln(out.Err, "hint: slow sops calls usually mean remote KMS or key service latency, or antivirus scanning temp files; rerun with --verbose for every call")
+		}
+		if check.Name == "timestamps" && check.Status == services.CheckWarn {
+			fmt.Fprintln(out.Err, "hint: sync the clock (NTP) of the machine or CI runner that wrote these; setting a key again records a fresh time")
+		}
+		if check.Name == "index consistency" && check.Status == services.CheckWarn {
+			fmt.Fprintln(out.Err, "hint: run `gitvault fsck` to list index and storage drift")
+		}
+		if check.Name == "git remote" && check.Status == services.CheckFail {
+			printRemoteHint(check, out.Err)
+		}
 	}
+	printDeepHints(report, out.Err)
 	if report.HasFailures() {
 		return 1
 	}
@@ -149,6 +321,8 @@ func (a App) runSecret(ctx context.Context, out ui.Output, root string, args []s
 		return a.runSecretUnset(ctx, out, root, args[1:])
 	case "import-env", "import":
 		return a.runSecretImport(ctx, out, root, args[1:])
+	case "import-compose":
+		return a.runSecretImportCompose(ctx, out, root, args[1:])
 	case "export-env", "export":
 		return a.runSecretExport(ctx, out, root, args[1:])
 	case "apply-env", "apply":
@@ -157,8 +331,24 @@ func (a App) runSecret(ctx context.Context, out ui.Output, root string, args []s
 		return a.runSecretList(ctx, out, root, args[1:])
 	case "find":
 		return a.runSecretFind(ctx, out, root, args[1:])
+	case "grep":
+		return a.runSecretGrep(ctx, out, root, args[1:])
+	case "dedup-report":
+		return a.runSecretDedup(ctx, out, root, args[1:])
 	case "run":
 		return a.runSecretRun(ctx, out, root, args[1:])
+	case "status":
+		return a.runSecretStatus(ctx, out, root, args[1:])
+	case "template":
+		return a.runSecretTemplate(ctx, out, root, args[1:])
+	case "report":
+		return a.runSecretReport(ctx, out, root, args[1:])
+	case "audience":
+		return a.runSecretAudience(ctx, out, root, args[1:])
+	case "alias":
+		return a.runSecretAlias(ctx, out, root, args[1:])
+	case "deprecate":
+		return a.runSecretDeprecate(ctx, out, root, args[1:])
 	default:
 		out.Error(fmt.Errorf("unknown secret subcommand: %s", args[0]))
 		printSecretUsage(out.Err)
@@ -173,6 +363,8 @@ func (a App) runSecretSet(ctx context.Context, out ui.Output, root string, args
 	project := fs.String("project", "", "Project name")
 	env := fs.String("env", "", "Environment name")
 	stdin := fs.Bool("stdin", false, "Read value from stdin")
+	ifAbsent := fs.Bool("if-absent", false, "Skip when the key already exists, whatever its value")
+	ifChanged := fs.Bool("if-changed", false, "Only write when the value differs (the default; states it explicitly)")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -181,8 +373,17 @@ func (a App) runSecretSet(ctx context.Context, out ui.Output, root string, args
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	if *ifAbsent && *ifChanged {
+		out.Error(errors.New("--if-absent and --if-changed cannot be combined"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
 
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	trailing := 2
+	if *stdin {
+		trailing = 1
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), trailing)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -227,12 +428,56 @@ func (a App) runSecretSet(ctx context.Context, out ui.Output, root string, args
 		value = strings.TrimRight(string(data), "\n")
 	}
 
-	if err := a.SecretService.Set(ctx, root, *project, *env, key, value); err != nil {
+	// status tells provisioning scripts what happened: created, updated,
+	// unchanged, or skipped (--if-absent).
+	data := map[string]string{"project": *project, "env": *env, "key": key}
+	if *ifAbsent {
+		idx, err := a.Store.LoadIndex(root)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		if envIndex := indexEnv(idx, *project, *env); envIndex != nil && envIndex.Keys[key] != nil {
+			data["status"] = "skipped"
+			out.Success("secret exists; skipped", data)
+			return 0
+		}
+	}
+	// A matching recorded digest proves the set is a no-op without a decrypt.
+	if a.valueUnchanged(root, *project, *env, key, value) {
+		data["status"] = "unchanged"
+		out.Success("secret unchanged", data)
+		return 0
+	}
+	current, exists, err := a.currentValue(ctx, root, *project, *env, key)
+	if err != nil {
 		out.Error(err)
 		printSopsHint(err, out.Err, out.JSON)
 		return 1
 	}
-	out.Success("secret updated", map[string]string{"project": *project, "env": *env, "key": key})
+	if *ifAbsent && exists {
+		data["status"] = "skipped"
+		out.Success("secret exists; skipped", data)
+		return 0
+	}
+	message := "secret unchanged"
+	data["status"] = "unchanged"
+	if !exists || current != value {
+		message, data["status"] = "secret updated", "updated"
+		if !exists {
+			message, data["status"] = "secret created", "created"
+		}
+		if err := a.SecretService.Set(ctx, root, *project, *env, key, value); err != nil {
+			out.Error(err)
+			printSopsHint(err, out.Err, out.JSON)
+			return 1
+		}
+	}
+	if err := a.recordDigest(ctx, root, *project, *env); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success(message, data)
 	return 0
 }
 
@@ -250,7 +495,7 @@ func (a App) runSecretUnset(ctx context.Context, out ui.Output, root string, arg
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 1)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -277,6 +522,10 @@ func (a App) runSecretUnset(ctx context.Context, out ui.Output, root string, arg
 		printSopsHint(err, out.Err, out.JSON)
 		return 1
 	}
+	if err := a.recordDigest(ctx, root, *project, *env); err != nil {
+		out.Error(err)
+		return 1
+	}
 	out.Success("secret removed", map[string]string{"project": *project, "env": *env, "key": key})
 	return 0
 }
@@ -287,10 +536,13 @@ func (a App) runSecretImport(ctx context.Context, out ui.Output, root string, ar
 	setSecretImportUsage(fs)
 	project := fs.String("project", "", "Project name")
 	env := fs.String("env", "", "Environment name")
-	file := fs.String("file", ".env", "Dotenv file path")
+	file := fs.String("file", ".env", "Dotenv file path or - for stdin")
 	strategy := fs.String("strategy", string(services.MergePreferVault), "Merge strategy")
 	preserveOrder := fs.Bool("preserve-order", true, "Preserve key order from input file")
 	noPreserveOrder := fs.Bool("no-preserve-order", false, "Sort keys instead of preserving order")
+	fileTimestamp := fs.String("file-timestamp", "", "When the input was last changed, for prefer-newer (default: file mtime)")
+	withDetails := fs.Bool("details", false, "Report the action taken for each key")
+	strict := fs.Bool("strict", false, "Reject lines whose value could be read more than one way instead of guessing")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -299,7 +551,7 @@ func (a App) runSecretImport(ctx context.Context, out ui.Output, root string, ar
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -321,42 +573,131 @@ func (a App) runSecretImport(ctx context.Context, out ui.Output, root string, ar
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	requested := mergeStrategy
+	if *file == "-" && mergeStrategy == services.MergeInteractive {
+		out.Error(errors.New("--strategy interactive reads answers from stdin and cannot be combined with --file -"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *file == "-" && mergeStrategy == mergePreferNewer && *fileTimestamp == "" {
+		out.Error(errors.New("--strategy prefer-newer with --file - needs --file-timestamp"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	if *fileTimestamp != "" && mergeStrategy != mergePreferNewer {
+		out.Error(errors.New("--file-timestamp only applies to --strategy prefer-newer"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	var fileTime time.Time
+	if *fileTimestamp != "" {
+		fileTime, err = parseTimeBound(*fileTimestamp, time.Now())
+		if err != nil {
+			out.Error(fmt.Errorf("--file-timestamp: %w", err))
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+	}
 
-	data, err := os.ReadFile(*file)
+	data, err := readInputFile(*file)
 	if err != nil {
 		out.Error(err)
 		return 1
 	}
+	if *strict {
+		parsed, issues := dotenv.ParseStrict(data)
+		if hasDotenvErrors(issues) {
+			var problems []string
+			for _, issue := range issues {
+				if issue.Severity == domain.IssueError {
+					problems = append(problems, fmt.Sprintf("line %d: %s", issue.Line, issue.Message))
+				}
+			}
+			out.Error(fmt.Errorf("%s is not strict dotenv; nothing imported:\n  %s", *file, strings.Join(problems, "\n  ")))
+			return 1
+		}
+		// sealr re-parses the input; give it a form it reads exactly.
+		data = dotenv.Render(parsed.Values, parsed.Order)
+	}
 
 	var resolver services.ConflictResolver
-	if mergeStrategy == services.MergeInteractive {
-		resolver = func(key, vaultValue, fileValue string) (string, error) {
-			prompt := fmt.Sprintf("conflict for %s (vault=%s, file=%s). choose [v]ault/[f]ile: ", key, vaultValue, fileValue)
-			fmt.Fprint(out.Out, prompt)
-			reader := bufio.NewReader(os.Stdin)
-			answer, err := reader.ReadString('\n')
+	var decisions []string
+	if mergeStrategy == mergePreferNewer {
+		if fileTime.IsZero() {
+			info, err := os.Stat(*file)
 			if err != nil {
-				return "", err
+				out.Error(err)
+				return 1
 			}
-			answer = strings.ToLower(strings.TrimSpace(answer))
-			if answer == "f" {
-				return fileValue, nil
-			}
-			return vaultValue, nil
+			fileTime = info.ModTime()
+		}
+		idx, err := a.Store.LoadIndex(root)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		resolver = newerResolver(idx, *project, *env, fileTime, &decisions)
+		mergeStrategy = services.MergeInteractive
+	}
+	if mergeStrategy == services.MergeInteractive && resolver == nil {
+		resolver = interactiveResolver(os.Stdin, out.Out, out.Color)
+	}
+	var recorder *importRecorder
+	if *withDetails {
+		recorder = newImportRecorder(requested)
+		if resolver == nil {
+			resolver = fixedResolver(mergeStrategy == services.MergePreferFile)
+			mergeStrategy = services.MergeInteractive
 		}
+		resolver = recorder.wrap(resolver)
 	}
 
 	usePreserveOrder := *preserveOrder && !*noPreserveOrder
+	if parsed, issues := domain.ParseDotenv(data); !hasDotenvErrors(issues) {
+		rendered := domain.RenderDotenv(parsed.Values)
+		if usePreserveOrder {
+			rendered = domain.RenderDotenvOrdered(parsed.Values, parsed.Order)
+		}
+		if a.matchesDigest(root, *project, *env, rendered) {
+			payload := map[string]interface{}{
+				"added":     0,
+				"updated":   0,
+				"skipped":   len(parsed.Values),
+				"unchanged": true,
+			}
+			if len(issues) > 0 {
+				warnings := make([]string, 0, len(issues))
+				for _, issue := range issues {
+					warnings = append(warnings, fmt.Sprintf("line %d: %s", issue.Line, issue.Message))
+				}
+				payload["warnings"] = warnings
+			}
+			successWithDetails(out, "import complete", payload, skippedDetails("", parsed.Order, "unchanged"), *withDetails)
+			return 0
+		}
+	}
+	// Interactive imports prompt on stdout, so they get no spinner.
+	var progress *ui.Progress
+	if requested != services.MergeInteractive {
+		parsed, _ := domain.ParseDotenv(data)
+		progress = out.Progress(fmt.Sprintf("importing %d key(s)", len(parsed.Order)), 0)
+	}
 	report, err := a.SecretService.ImportEnv(ctx, root, *project, *env, data, services.ImportOptions{
 		Strategy:        mergeStrategy,
 		Resolver:        resolver,
 		NoPreserveOrder: !usePreserveOrder,
 	})
+	progress.Done()
 	if err != nil {
 		out.Error(err)
 		printSopsHint(err, out.Err, out.JSON)
 		return 1
 	}
+	if err := a.recordDigest(ctx, root, *project, *env); err != nil {
+		out.Error(err)
+		return 1
+	}
 
 	payload := map[string]interface{}{
 		"added":   report.Added,
@@ -366,7 +707,15 @@ func (a App) runSecretImport(ctx context.Context, out ui.Output, root string, ar
 	if len(report.Warnings) > 0 {
 		payload["warnings"] = report.Warnings
 	}
-	out.Success("import complete", payload)
+	if len(decisions) > 0 {
+		payload["decisions"] = decisions
+	}
+	var details []detail
+	if recorder != nil {
+		parsed, _ := domain.ParseDotenv(data)
+		details = recorder.details(parsed.Order)
+	}
+	successWithDetails(out, "import complete", payload, details, *withDetails)
 	return 0
 }
 
@@ -381,6 +730,18 @@ func (a App) runSecretExport(ctx context.Context, out ui.Output, root string, ar
 	allowGit := fs.Bool("allow-git", false, "Allow writing into git-tracked paths")
 	preserveOrder := fs.Bool("preserve-order", true, "Preserve key order from vault")
 	noPreserveOrder := fs.Bool("no-preserve-order", false, "Sort keys instead of preserving order")
+	withHeader := fs.Bool("header", false, "Start the output with a comment recording the vault, project/env, commit, and time")
+	format := fs.String("format", exportDotenv, "Output format: dotenv or json")
+	nestBy := fs.String("nest-by", "", "With --format json, split keys on this separator into nested objects")
+	audienceName := fs.String("audience", "", "Only export keys marked for this audience: ci, deploy, or human")
+	showDiff := fs.Bool("diff", false, "Show which keys would change in --out instead of writing it")
+	check := fs.Bool("check", false, "Exit 1 if --out is out of date instead of writing it")
+	showValues := fs.Bool("show-values", false, "With --diff, print old and new values")
+	yes := fs.Bool("yes", false, "Skip the --show-values confirmation prompt")
+	executable := fs.Bool("executable", false, "Write a shell file to source that refuses to load when world-readable or stale")
+	maxAge := fs.Duration("max-age", 24*time.Hour, "With --executable, refuse to load the file after this long (0 disables)")
+	forShell := fs.String("for-shell", "", "Print shell code to stdout: sh for export lines, eval for a guarded loader")
+	allowOverride := fs.Bool("allow-export-override", false, "Export even if an export policy keeps this env to secret run")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -389,7 +750,7 @@ func (a App) runSecretExport(ctx context.Context, out ui.Output, root string, ar
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -405,14 +766,179 @@ func (a App) runSecretExport(ctx context.Context, out ui.Output, root string, ar
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	if *format != exportDotenv && *format != exportJSON {
+		out.Error(fmt.Errorf("unknown --format %q (use dotenv or json)", *format))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *format != exportJSON && *nestBy != "" {
+		out.Error(errors.New("--nest-by requires --format json"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *format == exportJSON && *withHeader {
+		out.Error(errors.New("--header is only supported for dotenv output"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if (*showDiff || *check) && (*outPath == "-" || *format != exportDotenv) {
+		out.Error(errors.New("--diff and --check need a dotenv --out file"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *showValues && !*showDiff {
+		out.Error(errors.New("--show-values requires --diff"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *executable && (*outPath == "-" || *format != exportDotenv || *showDiff || *check) {
+		out.Error(errors.New("--executable needs a file --out and cannot be combined with --format json, --diff, or --check"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *maxAge < 0 {
+		out.Error(errors.New("--max-age cannot be negative"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *forShell != "" && *forShell != forShellSh && *forShell != forShellEval {
+		out.Error(fmt.Errorf("unknown --for-shell %q (use sh or eval)", *forShell))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *forShell != "" && (*outPath != "-" || *format != exportDotenv || *withHeader || *showDiff || *check || *executable) {
+		out.Error(errors.New("--for-shell writes to stdout and cannot be combined with --out, --format json, --header, --diff, --check, or --executable"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	audience := ""
+	if *audienceName != "" {
+		if audience, err = parseAudience(*audienceName); err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+	}
+
+	// --diff and --check write no values out unless --show-values prints
+	// them, so policies allow them. An eval loader's export checks again, so
+	// it alone warns of an override.
+	var policy *exportGuard
+	if (!*showDiff && !*check || *showValues) && (*forShell != forShellEval || !*allowOverride) {
+		if policy, err = a.newExportGuard(out, root, *allowOverride); err == nil {
+			err = policy.check(*project, *env)
+		}
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
 
 	usePreserveOrder := *preserveOrder && !*noPreserveOrder
-	payload, err := a.SecretService.ExportEnvWithOptions(ctx, root, *project, *env, services.ExportOptions{NoPreserveOrder: !usePreserveOrder})
+	if *forShell == forShellEval {
+		loaderArgs := []string{"--vault", root, "secret", "export-env", "--project", *project, "--env", *env, "--for-shell", forShellSh}
+		if *audienceName != "" {
+			loaderArgs = append(loaderArgs, "--audience", *audienceName)
+		}
+		if !usePreserveOrder {
+			loaderArgs = append(loaderArgs, "--no-preserve-order")
+		}
+		if *allowOverride {
+			loaderArgs = append(loaderArgs, "--allow-export-override")
+		}
+		loader, err := renderEvalLoader(loaderArgs)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		_, _ = out.Out.Write(loader)
+		return 0
+	}
+	payload, err := a.exportEnvWithOptions(ctx, root, *project, *env, services.ExportOptions{NoPreserveOrder: !usePreserveOrder})
 	if err != nil {
 		out.Error(err)
 		printSopsHint(err, out.Err, out.JSON)
 		return 1
 	}
+	defer securemem.Wipe(payload)
+	a.healEnv(ctx, root, *project, *env)
+	if payload, err = a.resolveAliases(ctx, root, *project, *env, payload, policy); err != nil {
+		out.Error(err)
+		return 1
+	}
+	// The filtered, rendered, or headed copy is wiped too.
+	defer func() { securemem.Wipe(payload) }()
+	if audience != "" {
+		meta, err := a.metaStore().Load(root)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		entry, _ := meta.Lookup(*project, *env)
+		payload = filterAudience(payload, entry, audience)
+	}
+	parsed, _ := domain.ParseDotenv(payload)
+	a.warnDeprecated(out.Err, root, *project, *env, parsed.Order)
+	if *showDiff || *check {
+		if *showValues {
+			if err := confirmValues(out, *yes); err != nil {
+				out.Error(err)
+				if errors.Is(err, errValuesNotConfirmed) {
+					return 2
+				}
+				return 1
+			}
+		}
+		rows, err := exportDiff(payload, *outPath, *showValues)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		if len(rows) == 0 {
+			out.Success("up to date", map[string]string{"path": *outPath, "project": *project, "env": *env})
+			return 0
+		}
+		headers := []string{"key", "change"}
+		if *showValues {
+			headers = append(headers, "file", "vault")
+		}
+		if *showDiff {
+			out.Table(headers, rows)
+		}
+		if *check {
+			if !*showDiff {
+				out.Error(fmt.Errorf("%s is out of date: %d key(s) differ", *outPath, len(rows)))
+			}
+			return 1
+		}
+		return 0
+	}
+	if *format == exportJSON {
+		if payload, err = renderJSON(payload, *nestBy); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if *executable {
+		if payload, err = renderShell(payload, *outPath, time.Now(), *maxAge); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if *forShell == forShellSh {
+		if payload, err = renderShellExports(payload, ""); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if *withHeader {
+		origin, err := a.newProvenance(ctx, root, *project, *env)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		payload = append(origin.header(), payload...)
+	}
 
 	if *outPath == "-" {
 		_, _ = out.Out.Write(payload)
@@ -423,10 +949,13 @@ func (a App) runSecretExport(ctx context.Context, out ui.Output, root string, ar
 		out.Error(err)
 		return 1
 	}
-	if err := writeEnvFile(*outPath, payload); err != nil {
+	if err := guard.Write(*outPath, payload); err != nil {
 		out.Error(err)
 		return 1
 	}
+	if err := a.recordExport(root, *project, *env, *outPath, payload); err != nil {
+		fmt.Fprintf(out.Err, "warning: could not record the export for `gitvault status`: %v\n", err)
+	}
 	out.Success("exported", map[string]string{"path": *outPath})
 	return 0
 }
@@ -437,9 +966,12 @@ func (a App) runSecretApply(ctx context.Context, out ui.Output, root string, arg
 	setSecretApplyUsage(fs)
 	project := fs.String("project", "", "Project name")
 	env := fs.String("env", "", "Environment name")
-	file := fs.String("file", ".env", "Dotenv file path")
+	var files stringSliceFlag
+	fs.Var(&files, "file", "Dotenv file path or glob such as 'deploy/**/.env' (repeatable, default .env)")
 	onlyExisting := fs.Bool("only-existing", false, "Only update keys already present in the file")
 	allowGit := fs.Bool("allow-git", false, "Allow updating git-tracked files")
+	withDetails := fs.Bool("details", false, "Report the action taken for each key")
+	allowOverride := fs.Bool("allow-export-override", false, "Apply even if an export policy keeps this env to secret run")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -448,7 +980,7 @@ func (a App) runSecretApply(ctx context.Context, out ui.Output, root string, arg
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -464,42 +996,137 @@ func (a App) runSecretApply(ctx context.Context, out ui.Output, root string, arg
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	if strings.TrimSpace(*file) == "" {
-		out.Error(errors.New("--file is required"))
-		printFlagUsage(fs, out.Err)
-		return 2
-	}
-	if _, err := os.Stat(*file); err != nil {
+	if err := a.checkExportPolicy(out, root, *project, *env, *allowOverride); err != nil {
 		out.Error(err)
 		return 1
 	}
-	if err := a.guardUpdatePath(ctx, root, *file, *allowGit); err != nil {
-		out.Error(err)
-		return 1
+	if len(files) == 0 {
+		files = stringSliceFlag{".env"}
 	}
-	report, err := a.SecretService.ApplyEnvFile(ctx, root, *project, *env, *file, services.ApplyOptions{OnlyExisting: *onlyExisting})
+	paths, err := expandFilePatterns(files)
 	if err != nil {
 		out.Error(err)
-		printSopsHint(err, out.Err, out.JSON)
 		return 1
 	}
-	payload := map[string]interface{}{
-		"path":    *file,
-		"updated": report.Updated,
-		"added":   report.Added,
+	options := services.ApplyOptions{OnlyExisting: *onlyExisting}
+	if len(paths) == 1 {
+		result, err := a.applyEnvFile(ctx, root, *project, *env, paths[0], *allowGit, options, *withDetails)
+		if err != nil {
+			out.Error(err)
+			printSopsHint(err, out.Err, out.JSON)
+			return 1
+		}
+		payload := map[string]interface{}{
+			"path":    result.path,
+			"updated": result.updated,
+			"added":   result.added,
+		}
+		if result.unchanged {
+			payload["unchanged"] = true
+		}
+		successWithDetails(out, "apply complete", payload, result.details, *withDetails)
+		return 0
+	}
+
+	failed := 0
+	var firstErr error
+	rows := make([][]string, 0, len(paths))
+	details := []detail{}
+	for _, path := range paths {
+		result, err := a.applyEnvFile(ctx, root, *project, *env, path, *allowGit, options, *withDetails)
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			rows = append(rows, []string{path, "", "", "error: " + err.Error()})
+			details = append(details, detail{File: path, Action: actionFailed, Reason: err.Error()})
+			continue
+		}
+		details = append(details, result.details...)
+		status := "applied"
+		if result.unchanged {
+			status = "unchanged"
+		}
+		rows = append(rows, []string{path, strconv.Itoa(result.updated), strconv.Itoa(result.added), status})
+	}
+	if *withDetails {
+		successWithDetails(out, "apply complete", map[string]interface{}{"files": len(paths), "failed": failed}, details, true)
+	} else {
+		out.Table([]string{"path", "updated", "added", "status"}, rows)
+	}
+	if failed > 0 {
+		out.Error(fmt.Errorf("%d of %d files failed", failed, len(paths)))
+		printSopsHint(firstErr, out.Err, out.JSON)
+		return 1
 	}
-	out.Success("apply complete", payload)
 	return 0
 }
 
-func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args []string) int {
-	fs := flag.NewFlagSet("secret list", flag.ContinueOnError)
-	fs.SetOutput(out.Out)
-	setSecretListUsage(fs)
-	project := fs.String("project", "", "Project name")
-	env := fs.String("env", "", "Environment name")
-	showChanged := fs.Bool("show-last-changed", false, "Show last updated time")
-	if err := parseFlagSet(fs, args); err != nil {
+type applyResult struct {
+	path      string
+	updated   int
+	added     int
+	unchanged bool
+	details   []detail
+}
+
+func (a App) applyEnvFile(ctx context.Context, root, project, env, path string, allowGit bool, options services.ApplyOptions, withDetails bool) (applyResult, error) {
+	result := applyResult{path: path}
+	if _, err := os.Stat(path); err != nil {
+		return result, err
+	}
+	if err := a.guardUpdatePath(ctx, root, path, allowGit); err != nil {
+		return result, err
+	}
+	current, err := os.ReadFile(path)
+	if err == nil && a.matchesDigest(root, project, env, current) {
+		result.unchanged = true
+		if withDetails {
+			parsed, _ := domain.ParseDotenv(current)
+			result.details = skippedDetails(path, parsed.Order, "already up to date")
+		}
+		return result, nil
+	}
+	report, err := a.SecretService.ApplyEnvFile(ctx, root, project, env, path, options)
+	if err != nil {
+		return result, err
+	}
+	result.updated, result.added = report.Updated, report.Added
+	if withDetails {
+		idx, err := a.Store.LoadIndex(root)
+		if err != nil {
+			return result, err
+		}
+		var vaultKeys map[string]*domain.KeyMetadata
+		if envIndex := indexEnv(idx, project, env); envIndex != nil {
+			vaultKeys = envIndex.Keys
+		}
+		after, err := os.ReadFile(path)
+		if err != nil {
+			return result, err
+		}
+		result.details = applyDetails(path, current, after, vaultKeys, options.OnlyExisting)
+	}
+	return result, nil
+}
+
+func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret list", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretListUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	showChanged := fs.Bool("show-last-changed", false, "Show last updated time")
+	since := fs.String("since", "", "Only keys updated at or after this date or age (e.g. 7d)")
+	before := fs.String("before", "", "Only keys updated before this date or age")
+	sortBy := fs.String("sort", "name", "Sort by name or last_updated (newest first)")
+	limit := fs.Int("limit", 0, "Show at most this many keys (0 = all)")
+	offset := fs.Int("offset", 0, "Skip this many keys")
+	showValues := fs.Bool("values", false, "Decrypt and show values")
+	yes := fs.Bool("yes", false, "Skip the --values confirmation prompt")
+	allowOverride := fs.Bool("allow-export-override", false, "Show values even if an export policy keeps an env to secret run")
+	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
 		}
@@ -507,7 +1134,7 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -518,18 +1145,56 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	filter, err := newKeyFilter(*since, *before, *sortBy, time.Now())
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	window, err := newPage(*limit, *offset)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	var values *valueReader
+	if *showValues {
+		if err := confirmValues(out, *yes); err != nil {
+			out.Error(err)
+			if errors.Is(err, errValuesNotConfirmed) {
+				return 2
+			}
+			return 1
+		}
+		policy, err := a.newExportGuard(out, root, *allowOverride)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		values = a.newValueReader(ctx, root, policy)
+	}
+	meta, err := a.metaStore().Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	withStatus := hasDeprecations(meta)
 	if *project == "" && *env == "" {
-		keys, err := a.Listing.ListAllKeys(root)
+		listed, err := a.keyPage(root, "", "", filter, window)
 		if err != nil {
 			out.Error(err)
 			return 1
 		}
-		if len(keys) == 0 {
+		keys := listed.items
+		defer printPageHint(out, listed)
+		if listed.empty() {
 			if out.JSON {
 				out.Table([]string{"ref"}, nil)
+			} else if filter.active() {
+				out.Info("no secrets match the time filter")
 			} else {
-				fmt.Fprintln(out.Out, "no secrets yet")
-				fmt.Fprintln(out.Out, "hint: add one with `gitvault secret set <project> <env> KEY value`")
+				out.Info("no secrets yet")
+				out.Info("hint: add one with `gitvault secret set <project> <env> KEY value`")
 			}
 			return 0
 		}
@@ -544,12 +1209,31 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 						row = append(row, key.LastUpdated.Format("2006-01-02T15:04:05Z"))
 					}
 				}
+				if values != nil {
+					value, err := values.value(splitKeyRef(key.Name))
+					if err != nil {
+						out.Error(err)
+						printSopsHint(err, out.Err, out.JSON)
+						return 1
+					}
+					row = append(row, value)
+				}
+				if withStatus {
+					refProject, refEnv, refKey := splitKeyRef(key.Name)
+					row = append(row, keyStatus(meta, refProject, refEnv, refKey))
+				}
 				rows = append(rows, row)
 			}
 			headers := []string{"ref"}
 			if *showChanged {
 				headers = append(headers, "last_updated")
 			}
+			if values != nil {
+				headers = append(headers, "value")
+			}
+			if withStatus {
+				headers = append(headers, "status")
+			}
 			out.Table(headers, rows)
 			return 0
 		}
@@ -564,12 +1248,30 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 					row = append(row, key.LastUpdated.Format("2006-01-02T15:04:05Z"))
 				}
 			}
+			if values != nil {
+				value, err := values.value(projectName, envName, keyName)
+				if err != nil {
+					out.Error(err)
+					printSopsHint(err, out.Err, out.JSON)
+					return 1
+				}
+				row = append(row, value)
+			}
+			if withStatus {
+				row = append(row, keyStatus(meta, projectName, envName, keyName))
+			}
 			rows = append(rows, row)
 		}
 		headers := []string{"project", "env", "key"}
 		if *showChanged {
 			headers = append(headers, "last_updated")
 		}
+		if values != nil {
+			headers = append(headers, "value")
+		}
+		if withStatus {
+			headers = append(headers, "status")
+		}
 		out.Table(headers, rows)
 		return 0
 	}
@@ -579,17 +1281,21 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 		fmt.Fprintln(out.Err, "hint: use `gitvault project list` and `gitvault env list --project <name>`")
 		return 2
 	}
-	keys, err := a.Listing.ListKeys(root, *project, *env)
+	listed, err := a.keyPage(root, *project, *env, filter, window)
 	if err != nil {
 		out.Error(err)
 		return 1
 	}
-	if len(keys) == 0 {
+	keys := listed.items
+	defer printPageHint(out, listed)
+	if listed.empty() {
 		if out.JSON {
 			out.Table([]string{"key"}, nil)
+		} else if filter.active() {
+			out.Info("no secrets match the time filter")
 		} else {
-			fmt.Fprintf(out.Out, "no secrets for %s/%s\n", *project, *env)
-			fmt.Fprintln(out.Out, "hint: add one with `gitvault secret set <project> <env> KEY value`")
+			out.Info(fmt.Sprintf("no secrets for %s/%s", *project, *env))
+			out.Info("hint: add one with `gitvault secret set <project> <env> KEY value`")
 		}
 		return 0
 	}
@@ -606,6 +1312,18 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 				row = append(row, key.LastUpdated.Format("2006-01-02T15:04:05Z"))
 			}
 		}
+		if values != nil {
+			value, err := values.value(*project, *env, key.Name)
+			if err != nil {
+				out.Error(err)
+				printSopsHint(err, out.Err, out.JSON)
+				return 1
+			}
+			row = append(row, value)
+		}
+		if withStatus {
+			row = append(row, keyStatus(meta, *project, *env, key.Name))
+		}
 		rows = append(rows, row)
 	}
 	headers := []string{"key"}
@@ -615,6 +1333,12 @@ func (a App) runSecretList(ctx context.Context, out ui.Output, root string, args
 	if *showChanged {
 		headers = append(headers, "last_updated")
 	}
+	if values != nil {
+		headers = append(headers, "value")
+	}
+	if withStatus {
+		headers = append(headers, "status")
+	}
 	out.Table(headers, rows)
 	return 0
 }
@@ -623,7 +1347,12 @@ func (a App) runSecretFind(ctx context.Context, out ui.Output, root string, args
 	fs := flag.NewFlagSet("secret find", flag.ContinueOnError)
 	fs.SetOutput(out.Out)
 	setSecretFindUsage(fs)
-	if err := fs.Parse(args); err != nil {
+	glob := fs.String("glob", "", "Match refs with a glob, e.g. 'app/*/DB_*'")
+	expr := fs.String("regex", "", "Match refs with a regular expression")
+	withFiles := fs.Bool("files", false, "Also search stored file names")
+	limit := fs.Int("limit", 0, "Show at most this many matches (0 = all)")
+	offset := fs.Int("offset", 0, "Skip this many matches")
+	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
 		}
@@ -631,20 +1360,66 @@ func (a App) runSecretFind(ctx context.Context, out ui.Output, root string, args
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	window, err := newPage(*limit, *offset)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 1 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
 	pattern := ""
 	if len(fs.Args()) > 0 {
 		pattern = fs.Args()[0]
 	}
-	matches, err := a.Listing.FindKeys(root, pattern)
+	match, err := newRefMatcher(pattern, *glob, *expr)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
 	if err != nil {
 		out.Error(err)
 		return 1
 	}
-	rows := make([][]string, 0, len(matches))
-	for _, ref := range matches {
-		rows = append(rows, []string{ref})
+	// Keys come first, then files, each in ref order; the walk stops once
+	// the page is full.
+	rows := newPageBuffer[[]string](window)
+	walkEnvs(idx, "", "", func(project, env string, envIndex *domain.EnvIndex) bool {
+		for _, name := range slices.Sorted(maps.Keys(envIndex.Keys)) {
+			ref := project + "/" + env + "/" + name
+			if !match(ref) {
+				continue
+			}
+			row := []string{ref}
+			if *withFiles {
+				row = []string{"key", ref}
+			}
+			if !rows.add(row) {
+				return false
+			}
+		}
+		return true
+	})
+	if !*withFiles {
+		out.Table([]string{"ref"}, rows.items)
+		printPageHint(out, rows)
+		return 0
 	}
-	out.Table([]string{"ref"}, rows)
+	walkEnvs(idx, "", "", func(project, env string, envIndex *domain.EnvIndex) bool {
+		for _, name := range slices.Sorted(maps.Keys(envIndex.Files)) {
+			if ref := project + "/" + env + "/" + name; match(ref) && !rows.add([]string{"file", ref}) {
+				return false
+			}
+		}
+		return true
+	})
+	out.Table([]string{"type", "ref"}, rows.items)
+	printPageHint(out, rows)
 	return 0
 }
 
@@ -654,6 +1429,12 @@ func (a App) runSecretRun(ctx context.Context, out ui.Output, root string, args
 	setSecretRunUsage(fs)
 	project := fs.String("project", "", "Project name")
 	env := fs.String("env", "", "Environment name")
+	restarts := fs.Int("restart-on-failure", 0, "Restart the command up to N times when it fails or times out")
+	timeout := fs.Duration("timeout", 0, "Stop each attempt after this long (0: no limit)")
+	refresh := fs.Bool("refresh-env", false, "Decrypt the env again before each restart")
+	strict := fs.Bool("strict", false, "Fail instead of warning when injected keys override existing environment variables")
+	var envFiles stringSliceFlag
+	fs.Var(&envFiles, "env-file", "Local dotenv file loaded beneath the vault values (repeatable; later files win)")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -662,7 +1443,12 @@ func (a App) runSecretRun(ctx context.Context, out ui.Output, root string, args
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	if *restarts < 0 || *timeout < 0 {
+		out.Error(errors.New("--restart-on-failure and --timeout cannot be negative"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -682,35 +1468,160 @@ func (a App) runSecretRun(ctx context.Context, out ui.Output, root string, args
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	payload, err := a.SecretService.ExportEnv(ctx, root, *project, *env)
+	values, err := a.runValues(ctx, root, *project, *env, envFiles, nil)
 	if err != nil {
 		out.Error(err)
 		printSopsHint(err, out.Err, out.JSON)
 		return 1
 	}
+	a.warnDeprecated(out.Err, root, *project, *env, slices.Sorted(maps.Keys(values)))
+	if collisions := envCollisions(values); len(collisions) > 0 {
+		if *strict {
+			out.Error(fmt.Errorf("injected keys would override existing environment variables: %s", strings.Join(collisions, ", ")))
+			return 1
+		}
+		fmt.Fprintf(out.Err, "warning: injected keys override existing environment variables: %s\n", strings.Join(collisions, ", "))
+	}
+
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		err := runWithEnv(ctx, out, cmdArgs, values, *timeout)
+		if err == nil {
+			return 0
+		}
+		// Only failures of the command itself are retried; a command that
+		// cannot be started will not start on the next attempt either.
+		var exitErr *exec.ExitError
+		if attempt > *restarts || (!errors.As(err, &exitErr) && !errors.Is(err, context.DeadlineExceeded)) {
+			out.Error(err)
+			return 1
+		}
+		fmt.Fprintf(out.Err, "warning: %v; restarting in %s (%d/%d)\n", err, delay, attempt, *restarts)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			out.Error(ctx.Err())
+			return 1
+		}
+		delay = min(delay*2, maxRestartDelay)
+		if *refresh {
+			if values, err = a.runValues(ctx, root, *project, *env, envFiles, nil); err != nil {
+				out.Error(err)
+				printSopsHint(err, out.Err, out.JSON)
+				return 1
+			}
+		}
+	}
+}
+
+// maxRestartDelay caps the doubling pause between secret run restarts.
+const maxRestartDelay = 30 * time.Second
+
+// exportEnv decrypts project/env as a dotenv payload.
+func (a App) exportEnv(ctx context.Context, root, project, env string) ([]byte, error) {
+	return a.exportEnvWithOptions(ctx, root, project, env, services.ExportOptions{})
+}
+
+// exportEnvWithOptions is SecretService.ExportEnvWithOptions with values
+// that sealr renders bare but any parser would trim (leading or trailing
+// non-ASCII whitespace) quoted.
+func (a App) exportEnvWithOptions(ctx context.Context, root, project, env string, options services.ExportOptions) ([]byte, error) {
+	payload, err := a.SecretService.ExportEnvWithOptions(ctx, root, project, env, options)
+	if err != nil {
+		return nil, err
+	}
+	return dotenv.Canonical(payload), nil
+}
+
+// runValues decrypts the env a command is run with and layers it over the
+// local envFiles, so vault values win over non-secret local config. policy
+// checks aliased envs when the values are written out; nil for a process.
+func (a App) runValues(ctx context.Context, root, project, env string, envFiles []string, policy *exportGuard) (map[string]string, error) {
+	values := map[string]string{}
+	for _, path := range envFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, issues := domain.ParseDotenv(data)
+		for _, issue := range issues {
+			if issue.Severity == domain.IssueError {
+				return nil, fmt.Errorf("%s: dotenv parse error: %s", path, issue.Message)
+			}
+		}
+		maps.Copy(values, parsed.Values)
+	}
+	payload, err := a.exportEnv(ctx, root, project, env)
+	if err != nil {
+		return nil, err
+	}
+	defer securemem.Wipe(payload)
+	a.healEnv(ctx, root, project, env)
+	if payload, err = a.resolveAliases(ctx, root, project, env, payload, policy); err != nil {
+		return nil, err
+	}
+	defer func() { securemem.Wipe(payload) }()
 	parsed, issues := domain.ParseDotenv(payload)
 	for _, issue := range issues {
 		if issue.Severity == domain.IssueError {
-			out.Error(fmt.Errorf("dotenv parse error: %s", issue.Message))
-			return 1
+			return nil, fmt.Errorf("dotenv parse error: %s", issue.Message)
 		}
 	}
+	maps.Copy(values, parsed.Values)
+	return values, nil
+}
+
+// envCollisions returns the sorted keys of values that are already set in
+// the environment secret run inherits.
+func envCollisions(values map[string]string) []string {
+	var collisions []string
+	for key := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			collisions = append(collisions, key)
+		}
+	}
+	slices.Sort(collisions)
+	return collisions
+}
 
+// runWithEnv runs cmdArgs once with values added to the environment. A
+// timeout interrupts the command, then kills it if it has not exited
+// within a few seconds; the error then wraps context.DeadlineExceeded.
+func runWithEnv(ctx context.Context, out ui.Output, cmdArgs []string, values map[string]string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
-	cmd.Env = append(os.Environ(), flattenEnv(parsed.Values)...)
+	cmd.Env = append(os.Environ(), flattenEnv(values)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = out.Out
-	cmd.Stderr = out.Err
-	if err := cmd.Run(); err != nil {
-		out.Error(err)
-		return 1
+	cmd.Stderr = ui.Unredacted(out.Err)
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
 	}
-	return 0
+	cmd.WaitDelay = 5 * time.Second
+	err := cmd.Run()
+	if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	return err
 }
 
 func (a App) runProject(ctx context.Context, out ui.Output, root string, args []string) int {
+	if len(args) > 0 && args[0] == "rename" {
+		return a.runProjectRename(ctx, out, root, args[1:])
+	}
+	if len(args) > 0 && args[0] == "new" {
+		return a.runProjectNew(ctx, out, root, args[1:])
+	}
 	fs := flag.NewFlagSet("project", flag.ContinueOnError)
 	fs.SetOutput(out.Out)
+	fs.Usage = func() {}
 	if len(args) > 1 && args[0] == "list" && isHelpArg(args[1]) {
 		printProjectUsage(out.Out)
 		return 0
@@ -743,8 +1654,8 @@ func (a App) runProject(ctx context.Context, out ui.Output, root string, args []
 		if out.JSON {
 			out.Table([]string{"project"}, nil)
 		} else {
-			fmt.Fprintln(out.Out, "no projects yet")
-			fmt.Fprintln(out.Out, "hint: add one with `gitvault secret set <project> <env> KEY value`")
+			out.Info("no projects yet")
+			out.Info("hint: add one with `gitvault secret set <project> <env> KEY value`")
 		}
 		return 0
 	}
@@ -757,8 +1668,15 @@ func (a App) runProject(ctx context.Context, out ui.Output, root string, args []
 }
 
 func (a App) runEnv(ctx context.Context, out ui.Output, root string, args []string) int {
+	if len(args) > 0 && args[0] == "rename" {
+		return a.runEnvRename(ctx, out, root, args[1:])
+	}
+	if len(args) > 0 && args[0] == "clone" {
+		return a.runEnvClone(ctx, out, root, args[1:])
+	}
 	fs := flag.NewFlagSet("env", flag.ContinueOnError)
 	fs.SetOutput(out.Out)
+	fs.Usage = func() {}
 	project := fs.String("project", "", "Project name")
 	if len(args) > 0 && args[0] == "list" {
 		args = args[1:]
@@ -772,6 +1690,9 @@ func (a App) runEnv(ctx context.Context, out ui.Output, root string, args []stri
 		printEnvUsage(out.Err)
 		return 2
 	}
+	if *project == "" && a.link != nil {
+		*project = a.link.project
+	}
 	if *project == "" {
 		out.Error(errors.New("--project is required"))
 		printEnvUsage(out.Err)
@@ -791,8 +1712,8 @@ func (a App) runEnv(ctx context.Context, out ui.Output, root string, args []stri
 		if out.JSON {
 			out.Table([]string{"env"}, nil)
 		} else {
-			fmt.Fprintf(out.Out, "no environments for %s yet\n", *project)
-			fmt.Fprintln(out.Out, "hint: add one with `gitvault secret set <project> <env> KEY value`")
+			out.Info(fmt.Sprintf("no environments for %s yet", *project))
+			out.Info("hint: add one with `gitvault secret set <project> <env> KEY value`")
 		}
 		return 0
 	}
@@ -812,78 +1733,438 @@ func (a App) runKeys(ctx context.Context, out ui.Output, root string, args []str
 	cmd := args[0]
 	switch cmd {
 	case "list":
-		keys, err := a.KeysService.List(root)
+		return a.runKeysList(out, root, args[1:])
+	case "add":
+		return a.runKeysAdd(ctx, out, root, args[1:])
+	case "remove":
+		return a.runKeysRemove(out, root, args[1:])
+	case "groups":
+		return a.runKeyGroups(ctx, out, root, args[1:])
+	case "rotate":
+		return a.runKeysRotate(ctx, out, root, args[1:])
+	default:
+		out.Error(fmt.Errorf("unknown keys subcommand: %s", cmd))
+		printKeysUsage(out.Err)
+		return 2
+	}
+}
+
+// runKeysList lists the configured recipients. --identity adds the local
+// identity file each one can be decrypted with, so a new teammate can see
+// whether they were added.
+func (a App) runKeysList(out ui.Output, root string, args []string) int {
+	withIdentity := false
+	for _, arg := range args {
+		switch arg {
+		case "--identity", "-identity":
+			withIdentity = true
+		case "-h", "--help", "-help":
+			printKeysUsage(out.Out)
+			return 0
+		default:
+			out.Error(fmt.Errorf("unknown list argument: %s", arg))
+			printKeysUsage(out.Err)
+			return 2
+		}
+	}
+	keys, err := a.KeysService.List(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	roster, hasRoster, err := team.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	var local map[string]string
+	if withIdentity {
+		entries, err := a.discoverIdentities()
 		if err != nil {
 			out.Error(err)
 			return 1
 		}
-		rows := make([][]string, 0, len(keys))
-		for _, key := range keys {
-			rows = append(rows, []string{key})
+		local = map[string]string{}
+		for _, entry := range entries {
+			for _, recipient := range entry.Recipients {
+				if _, ok := local[recipient]; !ok {
+					local[recipient] = entry.Path
+				}
+			}
 		}
-		out.Table([]string{"recipient"}, rows)
-		return 0
-	case "add":
-		if len(args) >= 2 && isHelpArg(args[1]) {
+	}
+	headers := []string{"recipient"}
+	if hasRoster {
+		headers = append(headers, "member")
+	}
+	if withIdentity {
+		headers = append(headers, "identity")
+	}
+	rows := make([][]string, 0, len(keys))
+	matched := 0
+	for _, key := range keys {
+		row := []string{key}
+		if hasRoster {
+			member, _ := roster.Owner(key)
+			row = append(row, member)
+		}
+		if withIdentity {
+			path, ok := local[key]
+			if ok {
+				matched++
+			}
+			row = append(row, path)
+		}
+		rows = append(rows, row)
+	}
+	out.Table(headers, rows)
+	if withIdentity && matched == 0 {
+		fmt.Fprintln(out.Err, "warning: none of your local identities is a recipient of this vault; you cannot decrypt it")
+		if len(local) > 0 {
+			fmt.Fprintf(out.Err, "hint: ask a vault member to run `gitvault keys add %s`\n", slices.Sorted(maps.Keys(local))[0])
+		} else {
+			fmt.Fprintln(out.Err, "hint: set SOPS_AGE_KEY_FILE or run `age-keygen -o ~/.config/sops/age/keys.txt`, then ask a vault member to add its public key")
+		}
+	}
+	return 0
+}
+
+func (a App) runKeysRotate(ctx context.Context, out ui.Output, root string, args []string) int {
+	rotateCtx := ctx
+	withDetails := false
+	commit := false
+	var swap *recipientSwap
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--force", "-force":
+			rotateCtx = encryption.WithFreshCiphertext(ctx)
+		case "--details", "-details":
+			withDetails = true
+		case "--replace", "-replace":
+			if i+2 >= len(args) {
+				out.Error(errors.New("--replace needs the old and the new recipient"))
+				printKeysUsage(out.Err)
+				return 2
+			}
+			swap = &recipientSwap{old: args[i+1], new: args[i+2]}
+			i += 2
+		case "--commit", "-commit":
+			commit = true
+		case "-h", "--help", "-help":
 			printKeysUsage(out.Out)
 			return 0
-		}
-		if len(args) < 2 {
-			out.Error(errors.New("recipient is required"))
+		default:
+			out.Error(fmt.Errorf("unknown rotate argument: %s", args[i]))
 			printKeysUsage(out.Err)
 			return 2
 		}
-		if err := a.KeysService.Add(root, args[1]); err != nil {
+	}
+	files, err := a.Store.ListSecretFiles(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	// A swap re-encrypts stored files too, so none stays readable by the
+	// old key alone.
+	var blobs []string
+	if swap != nil {
+		if blobs, err = a.storedFiles(root); err != nil {
 			out.Error(err)
 			return 1
 		}
-		out.Success("recipient added", map[string]string{"recipient": args[1]})
-		return 0
-	case "remove":
-		if len(args) >= 2 && isHelpArg(args[1]) {
-			printKeysUsage(out.Out)
+	}
+	paths := append(slices.Clip(files), blobs...)
+	var before map[string][]byte
+	if withDetails || swap != nil {
+		before = snapshotFiles(a.Store.FS, paths)
+	}
+	if swap != nil {
+		if err := a.swapRecipient(root, swap); err != nil {
+			if swap.saved != nil {
+				err = errors.Join(err, a.undoSwap(root, swap, nil))
+			}
+			out.Error(err)
+			return 1
+		}
+		// Whoever held the old key may have the old data keys too.
+		rotateCtx = encryption.WithFreshCiphertext(ctx)
+	}
+	keys := a.KeysService
+	progress := out.Progress("rotating", len(paths))
+	keys.Store.FS = newProgressFS(keys.Store.FS, root, paths, progress)
+	report, err := keys.Rotate(rotateCtx, root)
+	if swap != nil && errors.Is(err, os.ErrNotExist) {
+		report, err = services.RotateReport{}, nil
+	}
+	if swap != nil && err == nil {
+		a.rotateFiles(rotateCtx, keys.Store.FS, root, blobs, &report)
+	}
+	progress.Done()
+	if swap != nil && (err != nil || report.Failed > 0) {
+		if err == nil {
+			err = fmt.Errorf("%d of %d secret(s) and file(s) failed to re-encrypt: %s", report.Failed, report.Total, strings.Join(report.Errors, "; "))
+		}
+		if restoreErr := a.undoSwap(root, swap, before); restoreErr != nil {
+			out.Error(fmt.Errorf("%w; restoring the previous recipients also failed: %v", err, restoreErr))
+			return 1
+		}
+		out.Error(fmt.Errorf("%w; the previous recipients, secrets, and files were restored", err))
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			out.Success("no secrets to rotate", nil)
 			return 0
 		}
-		if len(args) < 2 {
-			out.Error(errors.New("recipient is required"))
-			printKeysUsage(out.Err)
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	payload := map[string]interface{}{
+		"total":   report.Total,
+		"rotated": report.Rotated,
+		"failed":  report.Failed,
+	}
+	if len(report.Errors) > 0 {
+		payload["errors"] = report.Errors
+	}
+	message := "rotation complete"
+	if swap != nil {
+		payload["removed"] = swap.old
+		payload["added"] = swap.new
+		if swap.member != "" {
+			payload["member"] = swap.member
+		}
+		message = "recipient replaced"
+	}
+	var details []detail
+	if withDetails {
+		details = rotateDetails(a.Store.FS, root, before, paths, report.Errors)
+	}
+	successWithDetails(out, message, payload, details, withDetails)
+	if report.Failed > 0 {
+		return 1
+	}
+	if swap != nil {
+		a.swapWarnings(out, swap)
+	}
+	if commit {
+		summary := "Re-encrypt secrets"
+		action := "rotate"
+		if swap != nil {
+			summary = fmt.Sprintf("Replace recipient %s with %s", swap.old, swap.new)
+			action = "replace-key"
+		}
+		if err := a.commitVault(ctx, root, commitInfo{action: action, summary: summary}); err != nil {
+			out.Error(fmt.Errorf("rotated, but commit failed: %w", err))
+			return 1
+		}
+	}
+	return 0
+}
+
+func (a App) runKeysAdd(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("keys add", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setKeysAddUsage(fs)
+	fromFile := fs.String("from-file", "", "Read recipients from a file (- for stdin)")
+	fromURL := fs.String("from-url", "", "Fetch recipients from an https URL, e.g. https://github.com/<user>.keys")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	sources := fs.NArg()
+	if *fromFile != "" {
+		sources++
+	}
+	if *fromURL != "" {
+		sources++
+	}
+	if sources != 1 {
+		out.Error(errors.New("exactly one of a recipient, --from-file, or --from-url is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	var recipients, skipped []string
+	if fs.NArg() == 1 {
+		recipient, err := normalizeRecipient(fs.Arg(0))
+		if err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
 			return 2
 		}
-		if err := a.KeysService.Remove(root, args[1]); err != nil {
+		recipients = []string{recipient}
+	} else {
+		data, err := readKeySource(ctx, *fromFile, *fromURL)
+		if err != nil {
 			out.Error(err)
 			return 1
 		}
-		out.Success("recipient removed", map[string]string{"recipient": args[1]})
-		return 0
-	case "rotate":
-		report, err := a.KeysService.Rotate(ctx, root)
-		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				out.Success("no secrets to rotate", nil)
-				return 0
+		recipients, skipped = parseKeyLines(data)
+		if len(recipients) == 0 {
+			out.Error(fmt.Errorf("no usable keys found (%d line(s) skipped)", len(skipped)))
+			for _, line := range skipped {
+				fmt.Fprintln(out.Err, "skipped "+line)
 			}
-			out.Error(err)
-			printSopsHint(err, out.Err, out.JSON)
 			return 1
 		}
-		payload := map[string]interface{}{
-			"total":   report.Total,
-			"rotated": report.Rotated,
-			"failed":  report.Failed,
+	}
+
+	for _, recipient := range recipients {
+		if err := a.KeysService.Add(root, recipient); err != nil {
+			out.Error(err)
+			return 1
 		}
-		if len(report.Errors) > 0 {
-			payload["errors"] = report.Errors
+	}
+	if len(recipients) == 1 && len(skipped) == 0 {
+		out.Success("recipient added", map[string]string{"recipient": recipients[0]})
+	} else {
+		out.Success(fmt.Sprintf("%d recipient(s) added", len(recipients)), map[string]interface{}{"recipients": recipients, "skipped": skipped})
+	}
+	for _, line := range skipped {
+		fmt.Fprintln(out.Err, "warning: skipped "+line)
+	}
+	if vaultSettings, err := settings.Load(a.Store.FS, root); err == nil && len(ungroupedRecipients(recipients, vaultSettings.KeyGroups)) > 0 {
+		fmt.Fprintln(out.Err, "warning: recipient is in no key group and cannot decrypt; add it with `gitvault keys groups set`")
+	}
+	if roster, ok, err := team.Load(root); err == nil && ok && len(subtractRecipients(recipients, roster.Recipients())) > 0 {
+		fmt.Fprintln(out.Err, "warning: recipient is not in the team roster and `gitvault team sync` would remove it; use `gitvault team add`")
+	}
+	return 0
+}
+
+func (a App) runKeysRemove(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("keys remove", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setKeysRemoveUsage(fs)
+	force := fs.Bool("force", false, "Remove even the last recipient or your own")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
 		}
-		out.Success("rotation complete", payload)
-		if report.Failed > 0 {
-			return 1
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 1 {
+		out.Error(errors.New("recipient is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	recipient, err := normalizeRecipient(fs.Arg(0))
+	if err != nil {
+		// Malformed recipients added before validation must stay removable.
+		if raw := strings.TrimSpace(fs.Arg(0)); slices.Contains(configured, raw) {
+			recipient, err = raw, nil
 		}
-		return 0
-	default:
-		out.Error(fmt.Errorf("unknown keys subcommand: %s", cmd))
-		printKeysUsage(out.Err)
+	}
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	warnings := a.removalWarnings(configured, []string{recipient})
+	if len(warnings) > 0 && !*force {
+		out.Error(fmt.Errorf("refusing to remove %s: %s (use --force to remove anyway)", recipient, strings.Join(warnings, "; ")))
+		return 1
+	}
+	if err := a.dropFromKeyGroups(root, recipient); err != nil {
+		out.Error(err)
+		return 1
+	}
+	if err := a.KeysService.Remove(root, recipient); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("recipient removed", map[string]string{"recipient": recipient})
+	for _, warning := range warnings {
+		fmt.Fprintln(out.Err, "warning: "+warning)
+	}
+	if roster, ok, err := team.Load(root); err == nil && ok {
+		if member, listed := roster.Owner(recipient); listed {
+			fmt.Fprintf(out.Err, "warning: %s still lists this recipient in the team roster and `gitvault team sync` would add it back; use `gitvault team remove`\n", member)
+		}
+	}
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` so existing secrets are no longer encrypted to it")
+	}
+	return 0
+}
+
+// removalWarnings explains how removing recipients from the configured ones
+// could lock people out of the vault.
+func (a App) removalWarnings(configured, removing []string) []string {
+	var warnings []string
+	gone := map[string]bool{}
+	for _, recipient := range removing {
+		gone[recipient] = true
+	}
+	left := 0
+	for _, recipient := range configured {
+		if !gone[recipient] {
+			left++
+		}
+	}
+	if left == 0 && len(configured) > 0 {
+		warnings = append(warnings, "this removes the last recipient; nobody can decrypt secrets written after it is gone")
+	}
+	for _, recipient := range removing {
+		if a.isLocalRecipient(recipient) {
+			warnings = append(warnings, recipient+" matches your local identity; you lose access after the next rotate")
+		}
+	}
+	return warnings
+}
+
+// isLocalRecipient reports whether recipient belongs to one of the age
+// identities gitvault can find on this machine.
+func (a App) isLocalRecipient(recipient string) bool {
+	entries, err := a.discoverIdentities()
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		for _, local := range entry.Recipients {
+			if local == recipient {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeRecipient validates a recipient and puts it in the form sops
+// records, so typos fail here rather than as undecryptable files and the same
+// key is never configured twice under different spellings. SSH ed25519 keys
+// are converted to their age recipient.
+func normalizeRecipient(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, encryption.PGPPrefix):
+		return encryption.NormalizePGPRecipient(value)
+	case strings.HasPrefix(value, "ssh-"):
+		return agekey.RecipientFromSSH(value)
+	case strings.HasPrefix(strings.ToUpper(value), "AGE-SECRET-KEY-"):
+		return "", errors.New("secret key; share the public key instead")
+	}
+	if _, ok := encryption.AgePlugin(value); ok {
+		return value, nil
+	}
+	if err := agekey.ValidateRecipient(value); err != nil {
+		return "", err
+	}
+	return value, nil
 }
 
 func (a App) runSync(ctx context.Context, out ui.Output, root string, args []string) int {
@@ -892,10 +2173,26 @@ func (a App) runSync(ctx context.Context, out ui.Output, root string, args []str
 		return 0
 	}
 	cmd := args[0]
+	switch cmd {
+	case "config":
+		return a.runSyncConfig(out, root, args[1:])
+	case "github-secrets":
+		return a.runSyncGitHubSecrets(ctx, out, root, args[1:])
+	case "vercel", "netlify", "heroku":
+		return a.runSyncPlatform(ctx, out, root, cmd, args[1:])
+	}
 	fs := flag.NewFlagSet("sync "+cmd, flag.ContinueOnError)
 	fs.SetOutput(out.Out)
 	setSyncUsage(fs, cmd)
 	allowDirty := fs.Bool("allow-dirty", false, "Allow dirty working tree")
+	remote := fs.String("remote", "", "Remote to sync with (default: vault setting, then upstream)")
+	branch := fs.String("branch", "", "Branch to sync (default: vault setting, then upstream)")
+	var mirrors stringSliceFlag
+	noMirror := new(bool)
+	if cmd == "push" {
+		fs.Var(&mirrors, "mirror", "Also push to this backup remote (repeatable; replaces configured mirrors)")
+		noMirror = fs.Bool("no-mirror", false, "Skip the configured mirrors")
+	}
 	if err := fs.Parse(args[1:]); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -904,6 +2201,12 @@ func (a App) runSync(ctx context.Context, out ui.Output, root string, args []str
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	if err := validateSyncTarget(*remote, *branch, mirrors); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	ctx = gitsync.WithTarget(ctx, gitsync.Target{Remote: *remote, Branch: *branch, Mirrors: mirrors, NoMirrors: *noMirror})
 	switch cmd {
 	case "pull":
 		if err := a.Sync.Pull(ctx, root, *allowDirty); err != nil {
@@ -938,6 +2241,8 @@ func (a App) runFile(ctx context.Context, out ui.Output, root string, args []str
 		return a.runFileGet(ctx, out, root, args[1:])
 	case "list":
 		return a.runFileList(ctx, out, root, args[1:])
+	case "exec":
+		return a.runFileExec(ctx, out, root, args[1:])
 	default:
 		out.Error(fmt.Errorf("unknown file subcommand: %s", args[0]))
 		printFileUsage(out.Err)
@@ -961,7 +2266,7 @@ func (a App) runFilePut(ctx context.Context, out ui.Output, root string, args []
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -988,8 +2293,12 @@ func (a App) runFilePut(ctx context.Context, out ui.Output, root string, args []
 		return 1
 	}
 	if info.IsDir() {
-		out.Error(errors.New("path must be a file"))
-		return 1
+		if strings.TrimSpace(*name) != "" {
+			out.Error(errors.New("--name cannot be used with a directory"))
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+		return a.putFileDir(ctx, out, root, *project, *env, *path)
 	}
 	if strings.TrimSpace(*name) == "" {
 		*name = filepath.Base(*path)
@@ -1016,6 +2325,50 @@ func (a App) runFilePut(ctx context.Context, out ui.Output, root string, args []
 	return 0
 }
 
+// putFileDir stores each regular file directly in dir under its base name.
+// Subdirectories are skipped, since stored file names are flat.
+func (a App) putFileDir(ctx context.Context, out ui.Output, root, project, env, dir string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		out.Error(fmt.Errorf("no files in %s", dir))
+		return 1
+	}
+	stored := make([]map[string]interface{}, 0, len(names))
+	progress := out.Progress("storing files", len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			var meta domain.FileMetadata
+			meta, err = a.FileService.Put(ctx, root, project, env, name, data)
+			stored = append(stored, map[string]interface{}{"name": name, "size": meta.Size, "sha256": meta.SHA256})
+		}
+		progress.Step(name)
+		if err != nil {
+			progress.Done()
+			out.Error(fmt.Errorf("%s: %w", name, err))
+			printSopsHint(err, out.Err, out.JSON)
+			return 1
+		}
+	}
+	progress.Done()
+	out.Success(fmt.Sprintf("%d file(s) stored", len(stored)), map[string]interface{}{
+		"project": project,
+		"env":     env,
+		"files":   stored,
+	})
+	return 0
+}
+
 func (a App) runFileGet(ctx context.Context, out ui.Output, root string, args []string) int {
 	fs := flag.NewFlagSet("file get", flag.ContinueOnError)
 	fs.SetOutput(out.Out)
@@ -1026,6 +2379,7 @@ func (a App) runFileGet(ctx context.Context, out ui.Output, root string, args []
 	outPath := fs.String("out", "-", "Output path or - for stdout")
 	force := fs.Bool("force", false, "Overwrite output file")
 	allowGit := fs.Bool("allow-git", false, "Allow writing into git-tracked paths")
+	allowOverride := fs.Bool("allow-export-override", false, "Write even if an export policy keeps this env to secret run")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -1034,7 +2388,11 @@ func (a App) runFileGet(ctx context.Context, out ui.Output, root string, args []
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	trailing := 0
+	if *name == "" {
+		trailing = 1
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), trailing)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -1059,6 +2417,10 @@ func (a App) runFileGet(ctx context.Context, out ui.Output, root string, args []
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
+	if err := a.checkExportPolicy(out, root, *project, *env, *allowOverride); err != nil {
+		out.Error(err)
+		return 1
+	}
 	payload, _, err := a.FileService.Get(ctx, root, *project, *env, *name)
 	if err != nil {
 		out.Error(err)
@@ -1073,7 +2435,7 @@ func (a App) runFileGet(ctx context.Context, out ui.Output, root string, args []
 		out.Error(err)
 		return 1
 	}
-	if err := writeBinaryFile(*outPath, payload); err != nil {
+	if err := guard.Write(*outPath, payload); err != nil {
 		out.Error(err)
 		return 1
 	}
@@ -1089,6 +2451,9 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 	env := fs.String("env", "", "Environment name")
 	showChanged := fs.Bool("show-last-changed", false, "Show last updated time")
 	showSize := fs.Bool("show-size", false, "Show file size")
+	verify := fs.Bool("verify", false, "Check each ciphertext against the index and show a status column")
+	limit := fs.Int("limit", 0, "Show at most this many files (0 = all)")
+	offset := fs.Int("offset", 0, "Skip this many files")
 	if err := parseFlagSet(fs, args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
 			return 0
@@ -1097,7 +2462,13 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	remaining, err := fillProjectEnv(project, env, fs.Args())
+	window, err := newPage(*limit, *offset)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
 	if err != nil {
 		out.Error(err)
 		printFlagUsage(fs, out.Err)
@@ -1109,17 +2480,22 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 		return 2
 	}
 	if *project == "" && *env == "" {
-		files, err := a.Listing.ListAllFiles(root)
+		listed, statuses, err := a.filePage(root, "", "", window, *verify)
 		if err != nil {
 			out.Error(err)
 			return 1
 		}
-		if len(files) == 0 {
+		if *verify {
+			defer printVerifyHint(out, statuses)
+		}
+		files := listed.items
+		defer printPageHint(out, listed)
+		if listed.empty() {
 			if out.JSON {
 				out.Table([]string{"ref"}, nil)
 			} else {
-				fmt.Fprintln(out.Out, "no files yet")
-				fmt.Fprintln(out.Out, "hint: add one with `gitvault file put <project> <env> --path <file>`")
+				out.Info("no files yet")
+				out.Info("hint: add one with `gitvault file put <project> <env> --path <file>`")
 			}
 			return 0
 		}
@@ -1137,6 +2513,9 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 						row = append(row, file.LastUpdated.Format("2006-01-02T15:04:05Z"))
 					}
 				}
+				if *verify {
+					row = append(row, statuses[file.Name])
+				}
 				rows = append(rows, row)
 			}
 			headers := []string{"ref"}
@@ -1146,8 +2525,11 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 			if *showChanged {
 				headers = append(headers, "last_updated")
 			}
+			if *verify {
+				headers = append(headers, "status")
+			}
 			out.Table(headers, rows)
-			return 0
+			return verifyExitCode(statuses)
 		}
 		rows := make([][]string, 0, len(files))
 		for _, file := range files {
@@ -1163,6 +2545,9 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 					row = append(row, file.LastUpdated.Format("2006-01-02T15:04:05Z"))
 				}
 			}
+			if *verify {
+				row = append(row, statuses[file.Name])
+			}
 			rows = append(rows, row)
 		}
 		headers := []string{"project", "env", "file"}
@@ -1172,25 +2557,33 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 		if *showChanged {
 			headers = append(headers, "last_updated")
 		}
+		if *verify {
+			headers = append(headers, "status")
+		}
 		out.Table(headers, rows)
-		return 0
+		return verifyExitCode(statuses)
 	}
 	if *project == "" || *env == "" {
 		out.Error(errors.New("--project and --env are required"))
 		printFlagUsage(fs, out.Err)
 		return 2
 	}
-	files, err := a.Listing.ListFiles(root, *project, *env)
+	listed, statuses, err := a.filePage(root, *project, *env, window, *verify)
 	if err != nil {
 		out.Error(err)
 		return 1
 	}
-	if len(files) == 0 {
+	if *verify {
+		defer printVerifyHint(out, statuses)
+	}
+	files := listed.items
+	defer printPageHint(out, listed)
+	if listed.empty() {
 		if out.JSON {
 			out.Table([]string{"file"}, nil)
 		} else {
-			fmt.Fprintf(out.Out, "no files for %s/%s\n", *project, *env)
-			fmt.Fprintln(out.Out, "hint: add one with `gitvault file put <project> <env> --path <file>`")
+			out.Info(fmt.Sprintf("no files for %s/%s", *project, *env))
+			out.Info("hint: add one with `gitvault file put <project> <env> --path <file>`")
 		}
 		return 0
 	}
@@ -1210,6 +2603,9 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 				row = append(row, file.LastUpdated.Format("2006-01-02T15:04:05Z"))
 			}
 		}
+		if *verify {
+			row = append(row, statuses[file.Name])
+		}
 		rows = append(rows, row)
 	}
 	headers := []string{"file"}
@@ -1222,97 +2618,50 @@ func (a App) runFileList(ctx context.Context, out ui.Output, root string, args [
 	if *showChanged {
 		headers = append(headers, "last_updated")
 	}
+	if *verify {
+		headers = append(headers, "status")
+	}
 	out.Table(headers, rows)
-	return 0
+	return verifyExitCode(statuses)
 }
 
+// guardOutputPath checks a path new plaintext is written to.
 func (a App) guardOutputPath(ctx context.Context, root, outPath string, allowGit bool, force bool) error {
-	absPath, err := filepath.Abs(outPath)
-	if err != nil {
-		return err
-	}
-	if isWithinRoot(root, absPath) {
-		return errors.New("refusing to write plaintext inside the vault repository")
-	}
-	tracked := false
-	if !allowGit && a.Sync.Git != nil {
-		repoRoot, err := a.Sync.Git.TopLevel(ctx, filepath.Dir(absPath))
-		if err == nil {
-			isTracked, err := a.Sync.Git.IsPathTracked(ctx, repoRoot, absPath)
-			if err == nil {
-				tracked = isTracked
-			}
-		}
-	}
-	exists := false
-	if !force {
-		if _, err := os.Stat(absPath); err == nil {
-			exists = true
-		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
-			return err
-		}
-	}
-	if tracked && !allowGit {
-		if exists && !force {
-			return errors.New("output file exists and is git-tracked; use --force and --allow-git to override")
-		}
-		return errors.New("refusing to write into git-tracked path without --allow-git")
-	}
-	if !force && exists {
-		return errors.New("output file exists; use --force to overwrite")
-	}
-	return nil
+	return guardFlags(a.guard().Output(ctx, root, outPath, guard.Policy{AllowGit: allowGit, Overwrite: force}))
 }
 
+// guardUpdatePath checks a plaintext file that is rewritten in place.
 func (a App) guardUpdatePath(ctx context.Context, root, targetPath string, allowGit bool) error {
-	absPath, err := filepath.Abs(targetPath)
-	if err != nil {
-		return err
-	}
-	if isWithinRoot(root, absPath) {
-		return errors.New("refusing to write plaintext inside the vault repository")
-	}
-	if allowGit || a.Sync.Git == nil {
-		return nil
-	}
-	repoRoot, err := a.Sync.Git.TopLevel(ctx, filepath.Dir(absPath))
-	if err != nil {
-		return nil
-	}
-	tracked, err := a.Sync.Git.IsPathTracked(ctx, repoRoot, absPath)
-	if err != nil {
-		return nil
-	}
-	if tracked {
-		return errors.New("refusing to write into git-tracked path without --allow-git")
-	}
-	return nil
+	return guardFlags(a.guard().Update(ctx, root, targetPath, guard.Policy{AllowGit: allowGit}))
 }
 
-func writeEnvFile(path string, payload []byte) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
-	}
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return err
+func (a App) guard() guard.Guard {
+	return guard.Guard{Git: a.Sync.Git}
+}
+
+// guardFlags rewords a guard refusal with the flags that override it.
+func guardFlags(err error) error {
+	exists, tracked := errors.Is(err, guard.ErrExists), errors.Is(err, guard.ErrGitTracked)
+	switch {
+	case errors.Is(err, guard.ErrInsideVault):
+		return errors.New("refusing to write plaintext inside the vault repository")
+	case exists && tracked:
+		return errors.New("output file exists and is git-tracked; use --force and --allow-git to override")
+	case tracked:
+		return errors.New("refusing to write into git-tracked path without --allow-git")
+	case exists:
+		return errors.New("output file exists; use --force to overwrite")
 	}
-	defer file.Close()
-	_, err = file.Write(payload)
 	return err
 }
 
-func writeBinaryFile(path string, payload []byte) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
-	}
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return err
+// readInputFile reads path, or standard input when path is "-", so
+// pipelines can import without a temporary plaintext file.
+func readInputFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
 	}
-	defer file.Close()
-	_, err = file.Write(payload)
-	return err
+	return os.ReadFile(path)
 }
 
 func flattenEnv(values map[string]string) []string {
@@ -1323,26 +2672,6 @@ func flattenEnv(values map[string]string) []string {
 	return pairs
 }
 
-func isWithinRoot(root, path string) bool {
-	rel, err := filepath.Rel(root, path)
-	if err != nil {
-		return false
-	}
-	return rel != "." && !strings.HasPrefix(rel, "..")
-}
-
-func fillProjectEnv(project, env *string, args []string) ([]string, error) {
-	if (*project == "") != (*env == "") {
-		return args, errors.New("--project and --env must be provided together")
-	}
-	if *project == "" && *env == "" && len(args) >= 2 {
-		*project = args[0]
-		*env = args[1]
-		return args[2:], nil
-	}
-	return args, nil
-}
-
 func splitKeyRef(ref string) (string, string, string) {
 	parts := strings.SplitN(ref, "/", 3)
 	if len(parts) == 3 {
@@ -0,0 +1,609 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/dotenv"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/services"
+)
+
+// composeFileNames are the files docker compose looks for, in its order.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// composeService is the environment block of one compose service.
+type composeService struct {
+	Name   string
+	Values map[string]string
+	Order  []string
+	// Skipped explains entries that cannot be imported as written.
+	Skipped []string
+}
+
+type composeLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parseCompose reads the environment of each service in a compose file. It
+// understands the block and single-line flow YAML compose files are written
+// in, not anchors, merge keys, or multi-line scalars; for those, import the
+// output of `docker compose config` instead.
+func parseCompose(data []byte) ([]composeService, error) {
+	lines, err := composeLines(data)
+	if err != nil {
+		return nil, err
+	}
+	start := -1
+	for i, line := range lines {
+		if line.indent != 0 {
+			continue
+		}
+		key, rest, ok := splitComposeKey(line.text)
+		if !ok || key != "services" {
+			continue
+		}
+		if rest != "" {
+			return nil, composeUnsupported(line, "services must be a block mapping")
+		}
+		start = i + 1
+		break
+	}
+	if start < 0 {
+		return nil, errors.New("no services section")
+	}
+	end := composeBlockEnd(lines, start, 0)
+	var services []composeService
+	for i := start; i < end; {
+		line := lines[i]
+		if line.indent != lines[start].indent {
+			return nil, composeUnsupported(line, "unexpected indentation")
+		}
+		name, rest, ok := splitComposeKey(line.text)
+		if !ok || rest != "" {
+			return nil, composeUnsupported(line, "expected a service name")
+		}
+		bodyEnd := composeBlockEnd(lines, i+1, line.indent)
+		service, err := parseComposeService(name, lines[i+1:bodyEnd])
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		services = append(services, service)
+		i = bodyEnd
+	}
+	return services, nil
+}
+
+func parseComposeService(name string, body []composeLine) (composeService, error) {
+	service := composeService{Name: name, Values: map[string]string{}}
+	for i := 0; i < len(body); {
+		line := body[i]
+		if line.indent != body[0].indent {
+			return service, composeUnsupported(line, "unexpected indentation")
+		}
+		key, rest, ok := splitComposeKey(line.text)
+		if !ok {
+			return service, composeUnsupported(line, "expected a key")
+		}
+		end := composeBlockEnd(body, i+1, line.indent)
+		if key == "environment" && rest == "" {
+			// Block sequences may sit at the same indentation as their key.
+			for end < len(body) && body[end].indent == line.indent && isComposeItem(body[end].text) {
+				end = composeBlockEnd(body, end+1, line.indent)
+			}
+		}
+		switch key {
+		case "<<":
+			return service, composeUnsupported(line, "merge keys")
+		case "environment":
+			if err := service.parseEnvironment(line, rest, body[i+1:end]); err != nil {
+				return service, err
+			}
+		case "env_file":
+			service.Skipped = append(service.Skipped, "env_file: not read; import those files with secret import-env")
+		}
+		i = end
+	}
+	return service, nil
+}
+
+func (s *composeService) parseEnvironment(line composeLine, rest string, items []composeLine) error {
+	switch {
+	case strings.HasPrefix(rest, "["):
+		entries, err := splitComposeFlow(line, rest, '[', ']')
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := s.addItem(line, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	case strings.HasPrefix(rest, "{"):
+		entries, err := splitComposeFlow(line, rest, '{', '}')
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := s.addPair(line, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rest != "":
+		return composeUnsupported(line, "environment must be a list or a mapping")
+	}
+	for _, item := range items {
+		if item.indent != items[0].indent {
+			return composeUnsupported(item, "multi-line values")
+		}
+		if isComposeItem(items[0].text) {
+			if !isComposeItem(item.text) {
+				return composeUnsupported(item, "expected a list item")
+			}
+			if err := s.addItem(item, strings.TrimSpace(strings.TrimPrefix(item.text, "-"))); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.addPair(item, item.text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addItem adds a list entry, KEY=value or a bare KEY.
+func (s *composeService) addItem(line composeLine, text string) error {
+	value, null, err := parseComposeScalar(line, text)
+	if err != nil {
+		return err
+	}
+	if null {
+		return composeUnsupported(line, "empty list item")
+	}
+	key, value, ok := strings.Cut(value, "=")
+	return s.add(line, key, value, ok)
+}
+
+// addPair adds a mapping entry, KEY: value or a valueless KEY:.
+func (s *composeService) addPair(line composeLine, text string) error {
+	key, rest, ok := splitComposeKey(text)
+	if !ok {
+		return composeUnsupported(line, "expected KEY: value")
+	}
+	value, null, err := parseComposeScalar(line, rest)
+	if err != nil {
+		return err
+	}
+	return s.add(line, key, value, !null)
+}
+
+func (s *composeService) add(line composeLine, key, value string, hasValue bool) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return composeUnsupported(line, "empty variable name")
+	}
+	if !hasValue {
+		s.Skipped = append(s.Skipped, key+": no value; compose passes it through from the host")
+		return nil
+	}
+	if interpolates(value) {
+		s.Skipped = append(s.Skipped, key+": value is interpolated from the host environment")
+		return nil
+	}
+	if _, ok := s.Values[key]; !ok {
+		s.Order = append(s.Order, key)
+	}
+	s.Values[key] = strings.ReplaceAll(value, "$$", "$")
+	return nil
+}
+
+// interpolates reports whether compose would substitute part of value;
+// $$ is compose's escape for a literal $.
+func interpolates(value string) bool {
+	for i := 0; i < len(value)-1; i++ {
+		if value[i] != '$' {
+			continue
+		}
+		next := value[i+1]
+		if next == '$' {
+			i++
+			continue
+		}
+		if next == '{' || next == '_' || (next >= 'A' && next <= 'Z') || (next >= 'a' && next <= 'z') {
+			return true
+		}
+	}
+	return false
+}
+
+// composeLines drops blank lines and comments and measures indentation.
+func composeLines(data []byte) ([]composeLine, error) {
+	var lines []composeLine
+	for i, raw := range strings.Split(string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		indent := len(raw) - len(text)
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+		text = strings.TrimSpace(stripComposeComment(text))
+		if text == "" || text == "---" {
+			continue
+		}
+		lines = append(lines, composeLine{num: i + 1, indent: indent, text: text})
+	}
+	return lines, nil
+}
+
+// composeBlockEnd returns the index after the lines from start that are
+// indented deeper than parent.
+func composeBlockEnd(lines []composeLine, start, parent int) int {
+	end := start
+	for end < len(lines) && lines[end].indent > parent {
+		end++
+	}
+	return end
+}
+
+func isComposeItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// stripComposeComment removes a # comment that starts the line or follows
+// whitespace outside quotes.
+func stripComposeComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t:-[{,=", rune(text[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// splitComposeKey splits "key: rest" at the first colon outside quotes
+// that ends the line or is followed by a space.
+func splitComposeKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if unquoted, null, err := parseComposeScalar(composeLine{}, key); err == nil && !null {
+				key = unquoted
+			}
+			return key, strings.TrimSpace(text[i+1:]), key != ""
+		}
+	}
+	return "", "", false
+}
+
+// splitComposeFlow splits a single-line flow sequence or mapping into its
+// entries.
+func splitComposeFlow(line composeLine, text string, open, close byte) ([]string, error) {
+	if len(text) < 2 || text[len(text)-1] != close {
+		return nil, composeUnsupported(line, "multi-line flow collections")
+	}
+	inner := text[1 : len(text)-1]
+	var entries []string
+	var quote byte
+	begin := 0
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == open || c == '[' || c == '{':
+			return nil, composeUnsupported(line, "nested flow collections")
+		case c == ',':
+			entries = append(entries, strings.TrimSpace(inner[begin:i]))
+			begin = i + 1
+		}
+	}
+	if last := strings.TrimSpace(inner[begin:]); last != "" {
+		entries = append(entries, last)
+	}
+	return entries, nil
+}
+
+// parseComposeScalar reads a plain or quoted scalar. null reports an empty
+// value, null, or ~.
+func parseComposeScalar(line composeLine, text string) (value string, null bool, err error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "" || text == "~" || text == "null" || text == "Null" || text == "NULL":
+		return "", true, nil
+	case strings.HasPrefix(text, "&") || strings.HasPrefix(text, "*"):
+		return "", false, composeUnsupported(line, "anchors and aliases")
+	case strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">"):
+		return "", false, composeUnsupported(line, "block scalars")
+	case strings.HasPrefix(text, "!"):
+		return "", false, composeUnsupported(line, "tags")
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return "", false, composeUnsupported(line, "multi-line values")
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), false, nil
+	case strings.HasPrefix(text, `"`):
+		unquoted, err := strconv.Unquote(text)
+		if err != nil {
+			return "", false, composeUnsupported(line, "this double-quoted value")
+		}
+		return unquoted, false, nil
+	}
+	return text, false, nil
+}
+
+func composeUnsupported(line composeLine, what string) error {
+	if line.num == 0 {
+		return fmt.Errorf("%s are not supported; import the output of `docker compose config` instead", what)
+	}
+	return fmt.Errorf("line %d: %s not supported; import the output of `docker compose config` instead", line.num, what)
+}
+
+// findComposeFile returns the compose file docker compose would pick in
+// the working directory.
+func findComposeFile() (string, error) {
+	for _, name := range composeFileNames {
+		if _, err := os.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no compose file found (looked for %s); pass --file", strings.Join(composeFileNames, ", "))
+}
+
+// parseServiceMappings reads --service values, name or name=project.
+func parseServiceMappings(values []string) (map[string]string, []string, error) {
+	mappings := map[string]string{}
+	var order []string
+	for _, value := range values {
+		service, project, ok := strings.Cut(value, "=")
+		service = strings.TrimSpace(service)
+		project = strings.TrimSpace(project)
+		if !ok {
+			project = service
+		}
+		if service == "" || project == "" {
+			return nil, nil, fmt.Errorf("invalid --service %q; want <service> or <service>=<project>", value)
+		}
+		if _, dup := mappings[service]; dup {
+			return nil, nil, fmt.Errorf("--service %s given more than once", service)
+		}
+		mappings[service] = project
+		order = append(order, service)
+	}
+	return mappings, order, nil
+}
+
+func (a App) runSecretImportCompose(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret import-compose", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretImportComposeUsage(fs)
+	env := fs.String("env", "", "Environment to import into")
+	file := fs.String("file", "", "Compose file (default: compose.yaml or docker-compose.yml in this directory)")
+	var serviceFlags stringSliceFlag
+	fs.Var(&serviceFlags, "service", "Import this service, into a project of the same name or <service>=<project> (repeatable; default all)")
+	strategy := fs.String("strategy", string(services.MergePreferVault), "Merge strategy")
+	withDetails := fs.Bool("details", false, "Report the action taken for each key")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *env == "" {
+		out.Error(errors.New("--env is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	mergeStrategy, err := parseStrategy(*strategy)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	mappings, selected, err := parseServiceMappings(serviceFlags)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	path := *file
+	if path == "" {
+		if path, err = findComposeFile(); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	parsed, err := parseCompose(data)
+	if err != nil {
+		out.Error(fmt.Errorf("%s: %w", path, err))
+		return 1
+	}
+	byName := make(map[string]composeService, len(parsed))
+	for _, service := range parsed {
+		byName[service.Name] = service
+	}
+	if len(selected) == 0 {
+		for _, service := range parsed {
+			if len(service.Order) > 0 {
+				mappings[service.Name] = service.Name
+				selected = append(selected, service.Name)
+			}
+		}
+		if len(selected) == 0 {
+			out.Error(fmt.Errorf("%s: no service has environment values to import", path))
+			return 1
+		}
+	}
+	for _, name := range selected {
+		if _, ok := byName[name]; !ok {
+			out.Error(fmt.Errorf("%s: no service named %s", path, name))
+			return 1
+		}
+	}
+
+	failed := 0
+	var firstErr error
+	rows := make([][]string, 0, len(selected))
+	details := []detail{}
+	for _, name := range selected {
+		service := byName[name]
+		project := mappings[name]
+		for _, skipped := range service.Skipped {
+			fmt.Fprintf(out.Err, "warning: %s: %s\n", name, skipped)
+		}
+		result, err := a.importComposeService(ctx, out, root, project, *env, service, mergeStrategy, info.ModTime(), *withDetails)
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			rows = append(rows, []string{name, project, "", "", "", "error: " + err.Error()})
+			details = append(details, detail{File: name, Action: actionFailed, Reason: err.Error()})
+			continue
+		}
+		details = append(details, result.details...)
+		rows = append(rows, []string{name, project, strconv.Itoa(result.added), strconv.Itoa(result.updated), strconv.Itoa(result.skipped), result.status})
+	}
+	if *withDetails {
+		successWithDetails(out, "import complete", map[string]interface{}{"services": len(selected), "failed": failed}, details, true)
+	} else {
+		out.Table([]string{"service", "project", "added", "updated", "skipped", "status"}, rows)
+	}
+	if failed > 0 {
+		out.Error(fmt.Errorf("%d of %d services failed", failed, len(selected)))
+		printSopsHint(firstErr, out.Err, out.JSON)
+		return 1
+	}
+	return 0
+}
+
+type composeImportResult struct {
+	added   int
+	updated int
+	skipped int
+	status  string
+	details []detail
+}
+
+// importComposeService imports one service's environment the way
+// import-env imports a dotenv file.
+func (a App) importComposeService(ctx context.Context, out ui.Output, root, project, env string, service composeService, strategy services.MergeStrategy, fileTime time.Time, withDetails bool) (composeImportResult, error) {
+	result := composeImportResult{status: "imported"}
+	if len(service.Order) == 0 {
+		result.status = "no values"
+		return result, nil
+	}
+	data := dotenv.Render(service.Values, service.Order)
+	if a.matchesDigest(root, project, env, domain.RenderDotenvOrdered(service.Values, service.Order)) {
+		result.skipped = len(service.Order)
+		result.status = "unchanged"
+		if withDetails {
+			result.details = skippedDetails(service.Name, service.Order, "unchanged")
+		}
+		return result, nil
+	}
+
+	requested := strategy
+	var resolver services.ConflictResolver
+	var decisions []string
+	if strategy == mergePreferNewer {
+		idx, err := a.Store.LoadIndex(root)
+		if err != nil {
+			return result, err
+		}
+		resolver = newerResolver(idx, project, env, fileTime, &decisions)
+		strategy = services.MergeInteractive
+	}
+	if strategy == services.MergeInteractive && resolver == nil {
+		resolver = interactiveResolver(os.Stdin, out.Out, out.Color)
+	}
+	var recorder *importRecorder
+	if withDetails {
+		recorder = newImportRecorder(requested)
+		if resolver == nil {
+			resolver = fixedResolver(strategy == services.MergePreferFile)
+			strategy = services.MergeInteractive
+		}
+		resolver = recorder.wrap(resolver)
+	}
+
+	report, err := a.SecretService.ImportEnv(ctx, root, project, env, data, services.ImportOptions{
+		Strategy: strategy,
+		Resolver: resolver,
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := a.recordDigest(ctx, root, project, env); err != nil {
+		return result, err
+	}
+	for _, decision := range decisions {
+		fmt.Fprintf(out.Err, "%s: %s\n", service.Name, decision)
+	}
+	result.added, result.updated, result.skipped = report.Added, report.Updated, report.Skipped
+	if recorder != nil {
+		for _, d := range recorder.details(service.Order) {
+			d.File = service.Name
+			result.details = append(result.details, d)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/services"
+)
+
+const (
+	reasonMissingIdentity   = "missing identity"
+	reasonRecipientMismatch = "recipient mismatch"
+	reasonCorrupt           = "corrupt"
+	reasonMissingFile       = "missing ciphertext"
+)
+
+type deepTarget struct {
+	ref    string
+	path   string
+	binary bool
+	sha256 string
+}
+
+type deepFailure struct {
+	ref    string
+	path   string
+	reason string
+	err    error
+}
+
+// deepChecks decrypts every secret env and file in the vault with up to
+// parallel sops processes at once, returning a summary check followed by
+// one failing check per path that could not be decrypted.
+func (a App) deepChecks(ctx context.Context, out ui.Output, root string, parallel int) []services.CheckResult {
+	targets, err := a.deepTargets(root)
+	if err != nil {
+		return []services.CheckResult{{Name: "deep decrypt", Status: services.CheckFail, Message: err.Error()}}
+	}
+	progress := out.Progress("decrypting", len(targets))
+	failures := a.decryptAll(ctx, root, targets, parallel, progress)
+	progress.Done()
+	summary := services.CheckResult{Name: "deep decrypt", Status: services.CheckOK}
+	switch {
+	case len(targets) == 0:
+		summary.Status = services.CheckWarn
+		summary.Message = "no secrets or files to decrypt yet"
+	case len(failures) == 0:
+		summary.Message = fmt.Sprintf("decrypted %d path(s)", len(targets))
+	default:
+		summary.Status = services.CheckFail
+		summary.Message = fmt.Sprintf("%d of %d path(s) failed to decrypt", len(failures), len(targets))
+	}
+	checks := []services.CheckResult{summary}
+	for _, failure := range failures {
+		checks = append(checks, services.CheckResult{
+			Name:    "decrypt " + failure.ref,
+			Status:  services.CheckFail,
+			Message: fmt.Sprintf("%s (%s): %v", failure.reason, failure.path, failure.err),
+		})
+	}
+	return checks
+}
+
+func (a App) deepTargets(root string) ([]deepTarget, error) {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	var targets []deepTarget
+	for project, p := range idx.Projects {
+		for env, e := range p.Envs {
+			if len(e.Keys) > 0 {
+				targets = append(targets, deepTarget{
+					ref:  project + "/" + env,
+					path: a.Store.SecretFilePath(root, project, env),
+				})
+			}
+			for name, meta := range e.Files {
+				targets = append(targets, deepTarget{
+					ref:    project + "/" + env + "/" + name,
+					path:   a.Store.FilePath(root, project, env, name),
+					binary: true,
+					sha256: meta.SHA256,
+				})
+			}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ref < targets[j].ref })
+	return targets, nil
+}
+
+func (a App) decryptAll(ctx context.Context, root string, targets []deepTarget, parallel int, progress *ui.Progress) []deepFailure {
+	jobs := make(chan deepTarget)
+	results := make(chan *deepFailure)
+	var wg sync.WaitGroup
+	for i := 0; i < min(parallel, len(targets)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				failure := a.decryptTarget(ctx, root, target)
+				progress.Step(target.ref)
+				results <- failure
+			}
+		}()
+	}
+	go func() {
+		for _, target := range targets {
+			jobs <- target
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var failures []deepFailure
+	for failure := range results {
+		if failure != nil {
+			failures = append(failures, *failure)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].ref < failures[j].ref })
+	return failures
+}
+
+func (a App) decryptTarget(ctx context.Context, root string, target deepTarget) *deepFailure {
+	rel, err := filepath.Rel(root, target.path)
+	if err != nil {
+		rel = target.path
+	}
+	fail := func(reason string, err error) *deepFailure {
+		return &deepFailure{ref: target.ref, path: filepath.ToSlash(rel), reason: reason, err: err}
+	}
+	data, err := a.Store.FS.ReadFile(target.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fail(reasonMissingFile, errors.New("file not found"))
+		}
+		return fail(reasonCorrupt, err)
+	}
+	if !target.binary {
+		if _, err := a.SecretService.Encrypter.DecryptDotenv(ctx, data); err != nil {
+			return fail(classifyDecryptError(err), err)
+		}
+		return nil
+	}
+	plaintext, err := a.FileService.Encrypter.DecryptBinary(ctx, data)
+	if err != nil {
+		return fail(classifyDecryptError(err), err)
+	}
+	if target.sha256 != "" {
+		sum := sha256.Sum256(plaintext)
+		if hex.EncodeToString(sum[:]) != target.sha256 {
+			return fail(reasonCorrupt, errors.New("sha256 does not match the index"))
+		}
+	}
+	return nil
+}
+
+// classifyDecryptError maps the sanitized sops messages to a failure reason.
+// Anything that is not a key problem means the ciphertext itself is bad.
+func classifyDecryptError(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "identity not found"):
+		return reasonMissingIdentity
+	case strings.Contains(msg, "does not match recipients"):
+		return reasonRecipientMismatch
+	default:
+		return reasonCorrupt
+	}
+}
+
+// printDeepHints prints one hint per failure reason seen in a deep check.
+func printDeepHints(report services.DoctorReport, w io.Writer) {
+	seen := map[string]bool{}
+	for _, check := range report.Checks {
+		if !strings.HasPrefix(check.Name, "decrypt ") || check.Status != services.CheckFail {
+			continue
+		}
+		reason, _, _ := strings.Cut(check.Message, " (")
+		if seen[reason] {
+			continue
+		}
+		seen[reason] = true
+		switch reason {
+		case reasonMissingIdentity:
+			fmt.Fprintln(w, "hint: set SOPS_AGE_KEY_FILE or import an identity with `gitvault identity import`")
+		case reasonRecipientMismatch:
+			fmt.Fprintln(w, "hint: ask a recipient to run `gitvault keys add <your key>` and `gitvault keys rotate`")
+		case reasonCorrupt:
+			fmt.Fprintln(w, "hint: restore corrupt paths from git history, e.g. `git checkout <rev> -- <path>`")
+		case reasonMissingFile:
+			fmt.Fprintln(w, "hint: restore missing paths from git history or remove them from the vault")
+		}
+	}
+}
+
+func checkPassed(report services.DoctorReport, name string) bool {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check.Status == services.CheckOK
+		}
+	}
+	return false
+}
+
+func checkFailed(report services.DoctorReport, name string) bool {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check.Status == services.CheckFail
+		}
+	}
+	return false
+}
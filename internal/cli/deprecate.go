@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/keymeta"
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+func (a App) runSecretDeprecate(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret deprecate", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretDeprecateUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	replacement := fs.String("replacement", "", "Key that replaces the deprecated one")
+	note := fs.String("note", "", "Note shown with the deprecation warning")
+	undo := fs.Bool("undo", false, "Remove the deprecation mark")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 1)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) < 1 {
+		out.Error(errors.New("key is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 1 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *undo && (*replacement != "" || *note != "") {
+		out.Error(errors.New("--undo cannot be combined with --replacement or --note"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	key := remaining[0]
+	if *replacement == key {
+		out.Error(errors.New("a key cannot replace itself"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	store := a.metaStore()
+	meta, err := store.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *undo {
+		if entry, ok := meta.Lookup(*project, *env); ok {
+			delete(entry.Deprecated, key)
+		}
+		if err := store.Save(root, meta); err != nil {
+			out.Error(err)
+			return 1
+		}
+		out.Success("deprecation removed", map[string]string{"project": *project, "env": *env, "key": key})
+		return 0
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	entry := meta.Env(*project, *env)
+	if envIndex := indexEnv(idx, *project, *env); (envIndex == nil || envIndex.Keys[key] == nil) && entry.Aliases[key] == "" {
+		out.Error(fmt.Errorf("key %s not found in %s/%s", key, *project, *env))
+		return 1
+	}
+	if entry.Deprecated == nil {
+		entry.Deprecated = map[string]keymeta.Deprecation{}
+	}
+	entry.Deprecated[key] = keymeta.Deprecation{Replacement: *replacement, Note: *note, Since: time.Now().UTC()}
+	if err := store.Save(root, meta); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("key deprecated", map[string]string{"project": *project, "env": *env, "key": key, "replacement": *replacement, "note": *note})
+	if *replacement != "" && !out.JSON {
+		if envIndex := indexEnv(idx, *project, *env); (envIndex == nil || envIndex.Keys[*replacement] == nil) && entry.Aliases[*replacement] == "" {
+			fmt.Fprintf(out.Err, "hint: %s is not set in %s/%s yet; add it before consumers switch\n", *replacement, *project, *env)
+		}
+	}
+	return 0
+}
+
+// deprecationStatus is how secret list shows a deprecated key.
+func deprecationStatus(d keymeta.Deprecation) string {
+	if d.Replacement == "" {
+		return "deprecated"
+	}
+	return "deprecated, use " + d.Replacement
+}
+
+// hasDeprecations reports whether any env in the vault marks a key.
+func hasDeprecations(meta keymeta.Meta) bool {
+	for _, project := range meta.Projects {
+		if project == nil {
+			continue
+		}
+		for _, env := range project.Envs {
+			if env != nil && len(env.Deprecated) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func keyStatus(meta keymeta.Meta, project, env, key string) string {
+	if entry, ok := meta.Lookup(project, env); ok {
+		if d, ok := entry.Deprecated[key]; ok {
+			return deprecationStatus(d)
+		}
+	}
+	return ""
+}
+
+// warnDeprecated writes a warning for every deprecated key among keys.
+// Exports keep those keys, so consumers keep working while they migrate.
+func (a App) warnDeprecated(w io.Writer, root, project, env string, keys []string) {
+	meta, err := a.metaStore().Load(root)
+	if err != nil {
+		return
+	}
+	entry, ok := meta.Lookup(project, env)
+	if !ok || len(entry.Deprecated) == 0 {
+		return
+	}
+	for _, key := range keys {
+		d, deprecated := entry.Deprecated[key]
+		if !deprecated {
+			continue
+		}
+		message := fmt.Sprintf("warning: %s/%s %s is deprecated", project, env, key)
+		if d.Replacement != "" {
+			message += "; use " + d.Replacement
+		}
+		if d.Note != "" {
+			message += " (" + d.Note + ")"
+		}
+		fmt.Fprintln(w, message)
+	}
+}
@@ -0,0 +1,229 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/ports"
+	"github.com/aatuh/sealr/services"
+)
+
+const (
+	actionAdded   = "added"
+	actionUpdated = "updated"
+	actionSkipped = "skipped"
+	actionFailed  = "failed"
+)
+
+// detail is one line of a --details report: what happened to a key or a
+// file, and why.
+type detail struct {
+	File   string `json:"file,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// successWithDetails prints the summary and, with --details, the per-item
+// report: inside the JSON payload, or as a table after the summary.
+func successWithDetails(out ui.Output, message string, payload map[string]interface{}, details []detail, enabled bool) {
+	if !enabled {
+		out.Success(message, payload)
+		return
+	}
+	if out.JSON {
+		payload["details"] = details
+		out.Success(message, payload)
+		return
+	}
+	out.Success(message, payload)
+	withFile, withKey := false, false
+	for _, d := range details {
+		withFile = withFile || d.File != ""
+		withKey = withKey || d.Key != ""
+	}
+	headers := []string{}
+	if withFile {
+		headers = append(headers, "file")
+	}
+	if withKey {
+		headers = append(headers, "key")
+	}
+	headers = append(headers, "action", "reason")
+	rows := make([][]string, 0, len(details))
+	for _, d := range details {
+		row := []string{}
+		if withFile {
+			row = append(row, d.File)
+		}
+		if withKey {
+			row = append(row, d.Key)
+		}
+		rows = append(rows, append(row, d.Action, d.Reason))
+	}
+	out.Table(headers, rows)
+}
+
+// importRecorder wraps a conflict resolver so import can report what it
+// decided for every key that already existed in the vault.
+type importRecorder struct {
+	reason string
+	seen   map[string]detail
+}
+
+func newImportRecorder(strategy services.MergeStrategy) *importRecorder {
+	return &importRecorder{reason: string(strategy), seen: map[string]detail{}}
+}
+
+func (r *importRecorder) wrap(resolver services.ConflictResolver) services.ConflictResolver {
+	return func(key, vaultValue, fileValue string) (string, error) {
+		resolved, err := resolver(key, vaultValue, fileValue)
+		if err != nil {
+			return resolved, err
+		}
+		switch {
+		case vaultValue == fileValue:
+			r.seen[key] = detail{Key: key, Action: actionSkipped, Reason: "unchanged"}
+		case resolved == vaultValue:
+			r.seen[key] = detail{Key: key, Action: actionSkipped, Reason: "kept vault value (" + r.reason + ")"}
+		case resolved == fileValue:
+			r.seen[key] = detail{Key: key, Action: actionUpdated, Reason: "took file value (" + r.reason + ")"}
+		default:
+			r.seen[key] = detail{Key: key, Action: actionUpdated, Reason: "edited value (" + r.reason + ")"}
+		}
+		return resolved, nil
+	}
+}
+
+// details lists every key of the input; keys the resolver never saw were
+// not in the vault yet.
+func (r *importRecorder) details(keys []string) []detail {
+	details := make([]detail, 0, len(keys))
+	for _, key := range keys {
+		if d, ok := r.seen[key]; ok {
+			details = append(details, d)
+			continue
+		}
+		details = append(details, detail{Key: key, Action: actionAdded, Reason: "new key"})
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Key < details[j].Key })
+	return details
+}
+
+// fixedResolver keeps one side, for reporting on prefer-vault and
+// prefer-file imports.
+func fixedResolver(preferFile bool) services.ConflictResolver {
+	return func(key, vaultValue, fileValue string) (string, error) {
+		if preferFile {
+			return fileValue, nil
+		}
+		return vaultValue, nil
+	}
+}
+
+func skippedDetails(file string, keys []string, reason string) []detail {
+	details := make([]detail, 0, len(keys))
+	for _, key := range keys {
+		details = append(details, detail{File: file, Key: key, Action: actionSkipped, Reason: reason})
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].Key < details[j].Key })
+	return details
+}
+
+// applyDetails compares a dotenv file before and after apply-env with the
+// key names the index has for the env.
+func applyDetails(file string, before, after []byte, vaultKeys map[string]*domain.KeyMetadata, onlyExisting bool) []detail {
+	old, _ := domain.ParseDotenv(before)
+	updated, _ := domain.ParseDotenv(after)
+	keys := map[string]struct{}{}
+	for key := range old.Values {
+		keys[key] = struct{}{}
+	}
+	for key := range vaultKeys {
+		keys[key] = struct{}{}
+	}
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	details := make([]detail, 0, len(names))
+	for _, key := range names {
+		d := detail{File: file, Key: key}
+		oldValue, inOld := old.Values[key]
+		newValue, inNew := updated.Values[key]
+		_, inVault := vaultKeys[key]
+		switch {
+		case !inVault:
+			d.Action, d.Reason = actionSkipped, "not in vault"
+		case !inOld && inNew:
+			d.Action, d.Reason = actionAdded, "missing from file"
+		case !inOld:
+			d.Action, d.Reason = actionSkipped, "not in file"
+			if onlyExisting {
+				d.Reason = "not in file (--only-existing)"
+			}
+		case oldValue != newValue:
+			d.Action, d.Reason = actionUpdated, "vault value differs"
+		default:
+			d.Action, d.Reason = actionSkipped, "already up to date"
+		}
+		details = append(details, d)
+	}
+	return details
+}
+
+// snapshotFiles reads each file through the vault's file system, which maps
+// logical paths in an obfuscated layout, so rotate can tell which
+// ciphertexts it actually rewrote.
+func snapshotFiles(fs ports.FileSystem, paths []string) map[string][]byte {
+	snapshot := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		if data, err := fs.ReadFile(path); err == nil {
+			snapshot[path] = data
+		}
+	}
+	dropReadDirs(paths)
+	return snapshot
+}
+
+// dropReadDirs removes the directories under their logical names that reads
+// of an obfuscated layout create next to each path. In a plain vault they
+// still hold the files, so removing them fails, which is fine.
+func dropReadDirs(paths []string) {
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		for _, name := range []string{dir, filepath.Dir(dir)} {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+func rotateDetails(fs ports.FileSystem, root string, before map[string][]byte, paths, errs []string) []detail {
+	details := make([]detail, 0, len(paths))
+	for _, path := range paths {
+		name := path
+		if rel, err := filepath.Rel(root, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		d := detail{File: name, Action: actionUpdated, Reason: "re-encrypted"}
+		for _, e := range errs {
+			if reason, ok := strings.CutPrefix(e, path+": "); ok {
+				d.Action, d.Reason = actionFailed, reason
+				break
+			}
+		}
+		if d.Action != actionFailed {
+			if after, err := fs.ReadFile(path); err == nil && string(after) == string(before[path]) {
+				d.Action, d.Reason = actionSkipped, "plaintext and recipients unchanged; ciphertext kept"
+			}
+		}
+		details = append(details, d)
+	}
+	dropReadDirs(paths)
+	return details
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/aatuh/gitvault/internal/keymeta"
+	"github.com/aatuh/sealr/domain"
+)
+
+func (a App) metaStore() keymeta.Store {
+	return keymeta.Store{FS: a.Store.FS}
+}
+
+// recordDigest refreshes the stored content digest of project/env after a
+// write. The plaintext normally comes from the encrypter's cache, so this
+// does not cost another SOPS call.
+func (a App) recordDigest(ctx context.Context, root, project, env string) error {
+	store := a.metaStore()
+	meta, err := store.Load(root)
+	if err != nil {
+		return err
+	}
+	data, err := a.Store.FS.ReadFile(a.Store.SecretFilePath(root, project, env))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		entry, ok := meta.Lookup(project, env)
+		if !ok {
+			return nil
+		}
+		if len(entry.Aliases) == 0 {
+			meta.RemoveEnv(project, env)
+		} else {
+			// An env of only aliases has no file but keeps its aliases.
+			entry.Digest, entry.DigestKey, entry.Ciphertext, entry.Keys = "", "", "", nil
+		}
+		return store.Save(root, meta)
+	}
+	plaintext, err := a.SecretService.Encrypter.DecryptDotenv(ctx, data)
+	if err != nil {
+		return err
+	}
+	digest, err := meta.Digest(plaintext)
+	if err != nil {
+		return err
+	}
+	keyID, err := meta.KeyID()
+	if err != nil {
+		return err
+	}
+	parsed, _ := domain.ParseDotenv(plaintext)
+	keys := make(map[string]string, len(parsed.Values))
+	for key, value := range parsed.Values {
+		if keys[key], err = meta.ValueDigest(value); err != nil {
+			return err
+		}
+	}
+	entry := meta.Env(project, env)
+	ciphertext := keymeta.CiphertextSum(data)
+	stale := false
+	for key := range entry.Audiences {
+		if _, ok := keys[key]; !ok && entry.Aliases[key] == "" {
+			delete(entry.Audiences, key)
+			stale = true
+		}
+	}
+	for key := range entry.Deprecated {
+		if _, ok := keys[key]; !ok && entry.Aliases[key] == "" {
+			delete(entry.Deprecated, key)
+			stale = true
+		}
+	}
+	// A value set directly replaces an alias of the same key.
+	for key := range entry.Aliases {
+		if _, ok := keys[key]; ok {
+			delete(entry.Aliases, key)
+			stale = true
+		}
+	}
+	if !stale && entry.Digest == digest && entry.DigestKey == keyID && entry.Ciphertext == ciphertext && len(entry.Keys) == len(keys) {
+		return nil
+	}
+	entry.Digest = digest
+	entry.DigestKey = keyID
+	entry.Ciphertext = ciphertext
+	entry.Keys = keys
+	return store.Save(root, meta)
+}
+
+// currentEntry returns the metadata of project/env while it still describes
+// the stored ciphertext under this machine's digest key. ok is false when it
+// is missing or stale, e.g. after a git pull of a teammate's write, and the
+// caller has to decrypt.
+func (a App) currentEntry(root, project, env string) (keymeta.Meta, *keymeta.Env, bool) {
+	meta, err := a.metaStore().Load(root)
+	if err != nil {
+		return meta, nil, false
+	}
+	entry, ok := meta.Lookup(project, env)
+	if !ok {
+		return meta, nil, false
+	}
+	if keyID, err := meta.KeyID(); err != nil || entry.DigestKey != keyID {
+		return meta, nil, false
+	}
+	data, err := a.Store.FS.ReadFile(a.Store.SecretFilePath(root, project, env))
+	if err != nil || keymeta.CiphertextSum(data) != entry.Ciphertext {
+		return meta, nil, false
+	}
+	return meta, entry, true
+}
+
+// valueDigests returns the recorded value digest of every key in
+// project/env, or ok false when they cannot be trusted.
+func (a App) valueDigests(root, project, env string) (keymeta.Meta, map[string]string, bool) {
+	meta, entry, ok := a.currentEntry(root, project, env)
+	if !ok || entry.Keys == nil {
+		return meta, nil, false
+	}
+	return meta, entry.Keys, true
+}
+
+// valueUnchanged reports whether key is known to already hold value,
+// without decrypting. false means unknown as well as different.
+func (a App) valueUnchanged(root, project, env, key, value string) bool {
+	meta, digests, ok := a.valueDigests(root, project, env)
+	if !ok {
+		return false
+	}
+	digest, err := meta.ValueDigest(value)
+	return err == nil && digests[key] != "" && digests[key] == digest
+}
+
+// matchesDigest reports whether one of the candidates is known to equal the
+// stored plaintext of project/env, without decrypting anything. It returns
+// false whenever the answer would need a decrypt.
+func (a App) matchesDigest(root, project, env string, candidates ...[]byte) bool {
+	meta, entry, ok := a.currentEntry(root, project, env)
+	if !ok || entry.Digest == "" {
+		return false
+	}
+	for _, candidate := range candidates {
+		digest, err := meta.Digest(candidate)
+		if err == nil && digest == entry.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+func (a App) currentValue(ctx context.Context, root, project, env, key string) (string, bool, error) {
+	plaintext, err := a.SecretService.ExportEnv(ctx, root, project, env)
+	if err != nil {
+		return "", false, err
+	}
+	parsed, _ := domain.ParseDotenv(plaintext)
+	value, ok := parsed.Values[key]
+	return value, ok, nil
+}
+
+func hasDotenvErrors(issues []domain.DotenvIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == domain.IssueError {
+			return true
+		}
+	}
+	return false
+}
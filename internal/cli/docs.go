@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+// docSubcommands lists the subcommands `docs generate` walks under each
+// command. Subcommands whose help is their parent's share the parent's page.
+var docSubcommands = map[string][]string{
+	"secret":   {"set", "unset", "import-env", "import-compose", "export-env", "apply-env", "list", "find", "grep", "dedup-report", "run", "status", "template", "report", "audience", "alias", "deprecate"},
+	"file":     {"put", "get", "list", "exec"},
+	"project":  {"list", "rename", "new"},
+	"env":      {"list", "rename", "clone"},
+	"keys":     {"list", "add", "remove", "groups", "groups set", "rotate"},
+	"team":     {"list", "add", "remove", "sync"},
+	"identity": {"list", "add", "path", "check", "import"},
+	"sync":     {"pull", "push", "config", "github-secrets", "vercel", "netlify", "heroku"},
+	"alias":    {"list", "add", "remove"},
+	"hooks":    {"list", "trust"},
+	"ci":       {"check"},
+	"docs":     {"generate"},
+}
+
+// docPage is one generated page. help is the command's own --help output,
+// so the reference never drifts from the CLI.
+type docPage struct {
+	path    []string
+	summary string
+	help    string
+	subs    []*docPage
+}
+
+func (p *docPage) name() string {
+	return strings.Join(append([]string{"gitvault"}, p.path...), "-")
+}
+
+func (p *docPage) title() string {
+	return strings.Join(append([]string{"gitvault"}, p.path...), " ")
+}
+
+type docSection struct {
+	title string
+	lines []string
+}
+
+func (a App) runDocs(ctx context.Context, out ui.Output, args []string) int {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printDocsUsage(out.Out)
+		return 0
+	}
+	if args[0] != "generate" {
+		out.Error(fmt.Errorf("unknown docs subcommand: %s", args[0]))
+		printDocsUsage(out.Err)
+		return 2
+	}
+	fs := flag.NewFlagSet("docs generate", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setDocsGenerateUsage(fs)
+	format := fs.String("format", "markdown", "Output format: man or markdown")
+	outDir := fs.String("out", "", "Directory to write the pages to")
+	if err := parseFlagSet(fs, args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *format != "man" && *format != "markdown" {
+		out.Error(fmt.Errorf("unknown --format %q (use man or markdown)", *format))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *outDir == "" {
+		out.Error(errors.New("--out is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	root := a.docTree(ctx)
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		out.Error(err)
+		return 1
+	}
+	pages := 0
+	var write func(p *docPage) error
+	write = func(p *docPage) error {
+		name, data := p.name()+".md", renderMarkdownPage(p)
+		if *format == "man" {
+			name, data = p.name()+".1", renderManPage(p)
+		}
+		if err := os.WriteFile(filepath.Join(*outDir, name), data, 0o644); err != nil {
+			return err
+		}
+		pages++
+		for _, sub := range p.subs {
+			if err := write(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(root); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success(fmt.Sprintf("generated %d %s page(s) in %s", pages, *format, *outDir), map[string]string{
+		"dir":    *outDir,
+		"format": *format,
+		"pages":  fmt.Sprint(pages),
+	})
+	return 0
+}
+
+// docTree collects the help of every command by running it with --help.
+func (a App) docTree(ctx context.Context) *docPage {
+	var usage bytes.Buffer
+	printUsage(&usage)
+	root := &docPage{summary: "Git-backed secrets vault", help: usage.String()}
+	for _, cmd := range commandSummaries {
+		page := &docPage{path: []string{cmd.name}, summary: cmd.summary, help: a.captureHelp(ctx, cmd.name)}
+		summaries := subcommandSummaries(page.help)
+		for _, sub := range docSubcommands[cmd.name] {
+			path := append([]string{cmd.name}, strings.Fields(sub)...)
+			help := a.captureHelp(ctx, path...)
+			if help == page.help || strings.TrimSpace(help) == "" {
+				continue
+			}
+			page.subs = append(page.subs, &docPage{path: path, summary: summaries[sub], help: help})
+		}
+		root.subs = append(root.subs, page)
+	}
+	return root
+}
+
+func (a App) captureHelp(ctx context.Context, path ...string) string {
+	var buf bytes.Buffer
+	quiet := a
+	quiet.Out = &buf
+	quiet.Err = io.Discard
+	quiet.Run(ctx, append(append([]string{}, path...), "--help"))
+	return buf.String()
+}
+
+// subcommandSummaries reads the "Subcommands:" list of a group's help.
+func subcommandSummaries(help string) map[string]string {
+	summaries := map[string]string{}
+	for _, section := range parseHelp(help) {
+		if section.title != "Subcommands" {
+			continue
+		}
+		for _, line := range section.lines {
+			fields := strings.Fields(line)
+			if len(fields) > 1 {
+				summaries[fields[0]] = strings.Join(fields[1:], " ")
+			}
+		}
+	}
+	return summaries
+}
+
+// parseHelp splits help output into sections. Blocks headed by a one-word
+// "Title:" line keep that title, indented blocks continue the previous
+// section, lines starting with "gitvault " are the usage, and anything else
+// is description.
+func parseHelp(help string) []docSection {
+	var sections []docSection
+	add := func(title string, lines []string) {
+		for i := range sections {
+			if sections[i].title == title {
+				sections[i].lines = append(append(sections[i].lines, ""), lines...)
+				return
+			}
+		}
+		sections = append(sections, docSection{title: title, lines: lines})
+	}
+	for _, block := range strings.Split(strings.TrimSpace(help), "\n\n") {
+		lines := strings.Split(strings.TrimRight(block, "\n"), "\n")
+		first := lines[0]
+		switch {
+		case isHelpHeading(first):
+			add(strings.TrimSuffix(first, ":"), dedent(lines[1:]))
+		case strings.HasPrefix(first, " ") && len(sections) > 0:
+			last := &sections[len(sections)-1]
+			last.lines = append(last.lines, append([]string{""}, dedent(lines)...)...)
+		case strings.HasPrefix(first, "gitvault "):
+			add("Usage", lines)
+		default:
+			add("Description", lines)
+		}
+	}
+	return sections
+}
+
+func isHelpHeading(line string) bool {
+	return strings.HasSuffix(line, ":") && !strings.ContainsAny(line, " \t")
+}
+
+func dedent(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = strings.TrimPrefix(line, "  ")
+	}
+	return out
+}
+
+func renderMarkdownPage(p *docPage) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", p.title())
+	if p.summary != "" {
+		fmt.Fprintf(&b, "\n%s\n", p.summary)
+	}
+	for _, section := range parseHelp(p.help) {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.title)
+		if section.title == "Description" {
+			fmt.Fprintln(&b, strings.Join(section.lines, "\n"))
+			continue
+		}
+		fence := "text"
+		if section.title == "Examples" || section.title == "Example" || section.title == "Usage" {
+			fence = "bash"
+		}
+		fmt.Fprintf(&b, "```%s\n%s\n```\n", fence, strings.Join(section.lines, "\n"))
+	}
+	if len(p.subs) > 0 {
+		fmt.Fprint(&b, "\n## See also\n\n")
+		for _, sub := range p.subs {
+			summary := ""
+			if sub.summary != "" {
+				summary = ": " + sub.summary
+			}
+			fmt.Fprintf(&b, "- [%s](%s.md)%s\n", sub.title(), sub.name(), summary)
+		}
+	}
+	return b.Bytes()
+}
+
+func renderManPage(p *docPage) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, ".TH %s 1 \"\" \"gitvault\" \"gitvault Manual\"\n", strings.ToUpper(p.name()))
+	fmt.Fprintf(&b, ".SH NAME\n%s", manEscape(p.name()))
+	if p.summary != "" {
+		fmt.Fprintf(&b, " \\- %s", manEscape(p.summary))
+	}
+	fmt.Fprintln(&b)
+	for _, section := range parseHelp(p.help) {
+		title := strings.ToUpper(section.title)
+		if title == "USAGE" {
+			title = "SYNOPSIS"
+		}
+		fmt.Fprintf(&b, ".SH %s\n", title)
+		if title != "DESCRIPTION" {
+			fmt.Fprintln(&b, ".nf")
+		}
+		for _, line := range section.lines {
+			if line == "" {
+				fmt.Fprintln(&b, ".sp")
+				continue
+			}
+			fmt.Fprintln(&b, manEscape(line))
+		}
+		if title != "DESCRIPTION" {
+			fmt.Fprintln(&b, ".fi")
+		}
+	}
+	if len(p.subs) > 0 {
+		refs := make([]string, 0, len(p.subs))
+		for _, sub := range p.subs {
+			refs = append(refs, manEscape(sub.name())+"(1)")
+		}
+		fmt.Fprintf(&b, ".SH SEE ALSO\n%s\n", strings.Join(refs, ", "))
+	}
+	return b.Bytes()
+}
+
+func manEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
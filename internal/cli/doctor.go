@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/identity"
+	"github.com/aatuh/gitvault/internal/timing"
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/gitvault/internal/vaultfs"
+	"github.com/aatuh/sealr/services"
+)
+
+func vaultConfigLoaded(report services.DoctorReport) bool {
+	for _, check := range report.Checks {
+		if check.Name == "vault config" {
+			return check.Status == services.CheckOK
+		}
+	}
+	return false
+}
+
+// checkSopsVersion compares the version reported by the sops check with the
+// oldest release gitvault supports.
+func checkSopsVersion(report services.DoctorReport) (services.CheckResult, bool) {
+	result := services.CheckResult{Name: "sops version"}
+	for _, check := range report.Checks {
+		if check.Name != "sops" || check.Status != services.CheckOK {
+			continue
+		}
+		version, ok := encryption.ParseSopsVersion(check.Message)
+		switch {
+		case !ok:
+			result.Status = services.CheckWarn
+			result.Message = fmt.Sprintf("cannot parse %q; need %s or newer", check.Message, encryption.MinSopsVersion)
+		case !version.AtLeast(encryption.MinSopsVersion):
+			result.Status = services.CheckFail
+			result.Message = fmt.Sprintf("%s is older than %s (required for age recipients and dotenv files)", version, encryption.MinSopsVersion)
+		default:
+			result.Status = services.CheckOK
+			result.Message = fmt.Sprintf("%s (minimum %s)", version, encryption.MinSopsVersion)
+		}
+		return result, true
+	}
+	return result, false
+}
+
+// checkRecipients re-validates the configured recipients, catching ones
+// added by hand or before gitvault validated them.
+func (a App) checkRecipients(root string) services.CheckResult {
+	result := services.CheckResult{Name: "recipients"}
+	recipients, err := a.KeysService.List(root)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	var malformed []string
+	for _, recipient := range recipients {
+		if normalized, err := normalizeRecipient(recipient); err != nil || normalized != recipient {
+			malformed = append(malformed, recipient)
+		}
+	}
+	if len(malformed) > 0 {
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%d malformed recipient(s): %s", len(malformed), strings.Join(malformed, ", "))
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("%d valid recipient(s)", len(recipients))
+	return result
+}
+
+// checkRecipientTools reports whether the tools sops needs for the
+// configured non-age recipients are installed.
+func (a App) checkRecipientTools(root string) []services.CheckResult {
+	recipients, err := a.KeysService.List(root)
+	if err != nil {
+		return nil
+	}
+	var checks []services.CheckResult
+	age, pgp := encryption.SplitRecipients(recipients)
+	if len(pgp) > 0 {
+		checks = append(checks, checkGPG())
+	}
+	for _, plugin := range encryption.AgePlugins(age) {
+		checks = append(checks, checkAgePlugin(plugin))
+	}
+	return checks
+}
+
+// checkIdentityMatch reports whether a local identity can open the vault.
+// It compares local age recipients with the configured ones offline and
+// falls back to decrypting a sample when none match, since pgp and plugin
+// keys can only be tried through sops.
+func (a App) checkIdentityMatch(ctx context.Context, root string, canDecrypt bool) (services.CheckResult, bool) {
+	result := services.CheckResult{Name: "identity match"}
+	configured, err := a.KeysService.List(root)
+	if err != nil || len(configured) == 0 {
+		return result, false
+	}
+	entries, err := a.discoverIdentities()
+	if err != nil {
+		return result, false
+	}
+	wanted := map[string]bool{}
+	for _, recipient := range configured {
+		wanted[recipient] = true
+	}
+	local := []string{}
+	for _, entry := range entries {
+		if entry.Err != nil {
+			continue
+		}
+		for _, recipient := range entry.Recipients {
+			if wanted[recipient] {
+				result.Status = services.CheckOK
+				result.Message = fmt.Sprintf("%s identity matches %s", entry.Source, recipient)
+				return result, true
+			}
+			local = append(local, recipient)
+		}
+	}
+	if canDecrypt {
+		if sample := a.decryptSample(ctx, root); sample.Status != services.CheckWarn {
+			result.Status = sample.Status
+			result.Message = sample.Message
+			if sample.Status == services.CheckFail && len(local) > 0 {
+				result.Message = fmt.Sprintf("your identity (%s) does not match any configured recipient: %s", strings.Join(local, ", "), sample.Message)
+			}
+			return result, true
+		}
+	}
+	if len(local) == 0 {
+		// Nothing to compare; the age identity check reports missing keys.
+		return result, false
+	}
+	if _, pgp := encryption.SplitRecipients(configured); len(pgp) > 0 {
+		result.Status = services.CheckWarn
+		result.Message = "no age identity matches; pgp recipients are only checked by decrypting a secret"
+		return result, true
+	}
+	result.Status = services.CheckFail
+	result.Message = fmt.Sprintf("your identity (%s) does not match any configured recipient", strings.Join(local, ", "))
+	return result, true
+}
+
+func checkAgePlugin(name string) services.CheckResult {
+	binary := "age-plugin-" + name
+	result := services.CheckResult{Name: binary}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("not found in PATH; needed for age1%s1... recipients", name)
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = path
+	return result
+}
+
+func checkGPG() services.CheckResult {
+	result := services.CheckResult{Name: "gpg"}
+	name := strings.TrimSpace(os.Getenv("SOPS_GPG_EXEC"))
+	if name == "" {
+		name = "gpg"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%s not found; needed for pgp recipients", name)
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = path
+	return result
+}
+
+func checkPermissions(root string, fix bool) services.CheckResult {
+	result := services.CheckResult{Name: "file permissions"}
+	issues, err := vaultfs.CheckPermissions(root)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(issues) == 0 {
+		result.Status = services.CheckOK
+		result.Message = fmt.Sprintf("owner-only (%s)", vaultfs.ProtectionKind)
+		return result
+	}
+	if fix {
+		if err := vaultfs.FixPermissions(issues); err != nil {
+			result.Status = services.CheckFail
+			result.Message = err.Error()
+			return result
+		}
+		result.Status = services.CheckOK
+		result.Message = fmt.Sprintf("fixed %d path(s)", len(issues))
+		return result
+	}
+	first := issues[0]
+	result.Status = services.CheckWarn
+	result.Message = fmt.Sprintf("%d path(s) too permissive (e.g. %s: %s)", len(issues), first.Path, first.Detail)
+	return result
+}
+
+// checkExtraIdentities reports identities gitvault supplies to sops beyond
+// its own lookup, and whether any of them are usable.
+func (a App) checkExtraIdentities() ([]services.CheckResult, bool) {
+	cfg, err := userconfig.Load()
+	if err != nil {
+		return []services.CheckResult{{Name: "user config", Status: services.CheckWarn, Message: err.Error()}}, false
+	}
+	checks := []services.CheckResult{}
+	usable := false
+	if files := identity.SearchFiles(cfg.Identity.Files); len(files) > 0 {
+		check := checkIdentityFiles(files)
+		checks = append(checks, check)
+		usable = usable || check.Status == services.CheckOK
+	}
+	if cfg.Identity.Keyring {
+		check := a.checkKeyringIdentity()
+		checks = append(checks, check)
+		usable = usable || check.Status == services.CheckOK
+	}
+	return checks, usable
+}
+
+func checkIdentityFiles(files []string) services.CheckResult {
+	result := services.CheckResult{Name: "identity files"}
+	found := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if _, err := identity.ParseSecretKeys(data); err != nil {
+			result.Status = services.CheckWarn
+			result.Message = fmt.Sprintf("%s: %v", path, err)
+			return result
+		}
+		found++
+	}
+	if found == 0 {
+		result.Status = services.CheckWarn
+		result.Message = fmt.Sprintf("none of %d configured identity file(s) found", len(files))
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("%d of %d configured identity file(s) found", found, len(files))
+	return result
+}
+
+func (a App) checkKeyringIdentity() services.CheckResult {
+	result := services.CheckResult{Name: "keyring identity"}
+	raw, err := a.keyring().Get()
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	keys, err := identity.ParseSecretKeys([]byte(strings.Join(strings.Fields(raw), "\n")))
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("%d identity(ies) in OS keyring", len(keys))
+	return result
+}
+
+func checkTempDir() services.CheckResult {
+	result := services.CheckResult{Name: "temp dir"}
+	dir, err := vaultfs.TempDir()
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = dir
+	if dir == os.TempDir() {
+		result.Message = fmt.Sprintf("%s (shared; plaintext temp files are owner-only)", dir)
+	}
+	return result
+}
+
+// checkTimings summarizes the sops and git calls doctor made, warning when a
+// local call was slow.
+func checkTimings(log *timing.Log) (services.CheckResult, bool) {
+	if log == nil {
+		return services.CheckResult{}, false
+	}
+	calls := log.Calls()
+	if len(calls) == 0 {
+		return services.CheckResult{}, false
+	}
+	result := services.CheckResult{Name: "command timing", Status: services.CheckOK}
+	parts := []string{}
+	slow := []string{}
+	for _, tool := range []string{"sops", "git"} {
+		count := 0
+		var slowest timing.Call
+		for _, call := range calls {
+			if call.Tool != tool {
+				continue
+			}
+			count++
+			if call.Duration > slowest.Duration {
+				slowest = call
+			}
+			if call.IsSlow() {
+				slow = append(slow, fmt.Sprintf("%s took %s", call, roundDuration(call.Duration)))
+			}
+		}
+		if count > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d call(s), slowest %s (%s)", tool, count, roundDuration(slowest.Duration), slowest.Op))
+		}
+	}
+	result.Message = strings.Join(parts, "; ")
+	if len(slow) > 0 {
+		result.Status = services.CheckWarn
+		result.Message = "slow: " + strings.Join(slow, ", ")
+	}
+	return result, true
+}
+
+// printTimings lists every recorded call for --verbose.
+func printTimings(w io.Writer, log *timing.Log) {
+	if log == nil {
+		return
+	}
+	var total time.Duration
+	for _, call := range log.Calls() {
+		total += call.Duration
+		note := ""
+		if call.Failed {
+			note = " (failed)"
+		}
+		if call.IsSlow() {
+			note += " (slow)"
+		}
+		fmt.Fprintf(w, "timing: %-24s %8s%s\n", call, roundDuration(call.Duration), note)
+	}
+	fmt.Fprintf(w, "timing: %d call(s), %s total\n", len(log.Calls()), roundDuration(total))
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Millisecond)
+}
@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+// dumpVersion is bumped whenever a field of the dump changes meaning or is
+// removed; new fields may appear without a bump.
+const dumpVersion = 1
+
+// indexDump is the document `dump-index` prints. Every list is sorted by
+// name so dumps of an unchanged vault are byte-for-byte identical.
+type indexDump struct {
+	Version  int           `json:"version"`
+	Projects []projectDump `json:"projects"`
+}
+
+type projectDump struct {
+	Name string    `json:"name"`
+	Envs []envDump `json:"envs"`
+}
+
+type envDump struct {
+	Name  string     `json:"name"`
+	Keys  []keyDump  `json:"keys"`
+	Files []fileDump `json:"files"`
+}
+
+type keyDump struct {
+	Name        string `json:"name"`
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+
+type fileDump struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	MIME        string `json:"mime,omitempty"`
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+
+func (a App) runDumpIndex(_ context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("dump-index", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setDumpIndexUsage(fs)
+	project := fs.String("project", "", "Only dump this project")
+	env := fs.String("env", "", "Only dump envs with this name")
+	since := fs.String("since", "", "Only keys and files updated at or after this time (date, RFC 3339, or age like 7d)")
+	before := fs.String("before", "", "Only keys and files updated before this time (date, RFC 3339, or age like 7d)")
+	format := fs.String("format", "json", "Output format: json or yaml")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *format != "json" && *format != "yaml" {
+		out.Error(fmt.Errorf("unknown --format %q (use json or yaml)", *format))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	filter, err := newKeyFilter(*since, *before, "", time.Now())
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	dump := buildIndexDump(idx, *project, *env, filter)
+	var data []byte
+	if *format == "yaml" {
+		data = renderDumpYAML(dump)
+	} else {
+		data, err = json.MarshalIndent(dump, "", "  ")
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		data = append(data, '\n')
+	}
+	_, _ = out.Out.Write(data)
+	return 0
+}
+
+func buildIndexDump(idx domain.Index, project, env string, filter keyFilter) indexDump {
+	dump := indexDump{Version: dumpVersion, Projects: []projectDump{}}
+	for _, p := range idx.ListProjects() {
+		if project != "" && p != project {
+			continue
+		}
+		pd := projectDump{Name: p, Envs: []envDump{}}
+		for _, e := range idx.ListEnvs(p) {
+			if env != "" && e != env {
+				continue
+			}
+			ed := envDump{Name: e, Keys: []keyDump{}, Files: []fileDump{}}
+			for _, key := range filter.apply(idx.ListKeys(p, e)) {
+				ed.Keys = append(ed.Keys, keyDump{Name: key.Name, LastUpdated: formatDumpTime(key.LastUpdated)})
+			}
+			for _, file := range idx.ListFiles(p, e) {
+				if !filter.matches(file.LastUpdated) {
+					continue
+				}
+				ed.Files = append(ed.Files, fileDump{
+					Name:        file.Name,
+					Size:        file.Size,
+					SHA256:      file.SHA256,
+					MIME:        file.MIME,
+					LastUpdated: formatDumpTime(file.LastUpdated),
+				})
+			}
+			if filter.active() && len(ed.Keys) == 0 && len(ed.Files) == 0 {
+				continue
+			}
+			pd.Envs = append(pd.Envs, ed)
+		}
+		if len(pd.Envs) > 0 || (env == "" && !filter.active()) {
+			dump.Projects = append(dump.Projects, pd)
+		}
+	}
+	return dump
+}
+
+func formatDumpTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// renderDumpYAML writes the dump as YAML. Strings are emitted as JSON
+// strings, which are valid double-quoted YAML scalars.
+func renderDumpYAML(dump indexDump) []byte {
+	var b bytes.Buffer
+	q := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	fmt.Fprintf(&b, "version: %d\n", dump.Version)
+	if len(dump.Projects) == 0 {
+		b.WriteString("projects: []\n")
+		return b.Bytes()
+	}
+	b.WriteString("projects:\n")
+	for _, p := range dump.Projects {
+		fmt.Fprintf(&b, "  - name: %s\n", q(p.Name))
+		if len(p.Envs) == 0 {
+			b.WriteString("    envs: []\n")
+			continue
+		}
+		b.WriteString("    envs:\n")
+		for _, e := range p.Envs {
+			fmt.Fprintf(&b, "      - name: %s\n", q(e.Name))
+			if len(e.Keys) == 0 {
+				b.WriteString("        keys: []\n")
+			} else {
+				b.WriteString("        keys:\n")
+				for _, key := range e.Keys {
+					fmt.Fprintf(&b, "          - name: %s\n", q(key.Name))
+					if key.LastUpdated != "" {
+						fmt.Fprintf(&b, "            lastUpdated: %s\n", q(key.LastUpdated))
+					}
+				}
+			}
+			if len(e.Files) == 0 {
+				b.WriteString("        files: []\n")
+				continue
+			}
+			b.WriteString("        files:\n")
+			for _, file := range e.Files {
+				fmt.Fprintf(&b, "          - name: %s\n", q(file.Name))
+				fmt.Fprintf(&b, "            size: %d\n", file.Size)
+				fmt.Fprintf(&b, "            sha256: %s\n", q(file.SHA256))
+				if file.MIME != "" {
+					fmt.Fprintf(&b, "            mime: %s\n", q(file.MIME))
+				}
+				if file.LastUpdated != "" {
+					fmt.Fprintf(&b, "            lastUpdated: %s\n", q(file.LastUpdated))
+				}
+			}
+		}
+	}
+	return b.Bytes()
+}
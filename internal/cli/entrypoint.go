@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/redact"
+	"github.com/aatuh/gitvault/internal/timing"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/vaultfs"
+)
+
+// entrypointSecrets are the variables docker-entrypoint reads credentials
+// from; they are dropped from the command's environment so the app never
+// sees the vault token or the age key.
+var entrypointSecrets = []string{"GITVAULT_GIT_TOKEN", "SOPS_AGE_KEY"}
+
+// runDockerEntrypoint fetches the vault, decrypts one env, and replaces
+// itself with the container command, so an image carries no secrets and
+// the command runs as PID 1 with signals delivered to it directly.
+func (a App) runDockerEntrypoint(ctx context.Context, out ui.Output, vaultPath string, args []string) int {
+	start := time.Now()
+	fs := flag.NewFlagSet("docker-entrypoint", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setDockerEntrypointUsage(fs)
+	project := fs.String("project", os.Getenv("GITVAULT_PROJECT"), "Project name (default $GITVAULT_PROJECT)")
+	env := fs.String("env", os.Getenv("GITVAULT_ENV"), "Environment name (default $GITVAULT_ENV)")
+	// Flags stop at the command: CMD arguments reach it untouched.
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	cmdArgs := fs.Args()
+	if len(cmdArgs) == 0 {
+		out.Error(errors.New("command required, e.g. `gitvault docker-entrypoint -- ./server`"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("project and env required: set GITVAULT_PROJECT and GITVAULT_ENV"))
+		return 2
+	}
+	a.scope.project, a.scope.env = *project, *env
+
+	if vaultPath == "" {
+		vaultPath = os.Getenv("GITVAULT_VAULT")
+	}
+	repo := strings.TrimSpace(os.Getenv("GITVAULT_REPO"))
+	if repo == "" && vaultPath == "" {
+		out.Error(errVaultLocation)
+		return 2
+	}
+	root, err := a.openContainerVault(ctx, vaultPath, repo)
+	if err != nil {
+		out.Error(err)
+		printVaultNotFoundHint(err, out.Err)
+		return 1
+	}
+	if repo != "" {
+		defer os.RemoveAll(root)
+	}
+
+	values, err := a.runValues(ctx, root, *project, *env, nil, nil)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	if collisions := envCollisions(values); len(collisions) > 0 {
+		fmt.Fprintf(out.Err, "warning: injected keys override existing environment variables: %s\n", strings.Join(collisions, ", "))
+	}
+	if repo != "" {
+		// The clone holds only ciphertexts, but nothing would remove it
+		// once the process is replaced.
+		_ = os.RemoveAll(root)
+	}
+	environ := slices.DeleteFunc(os.Environ(), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return slices.Contains(entrypointSecrets, name)
+	})
+	// Nothing runs after a successful exec, so telemetry is sent first.
+	a.reportTelemetry(ctx, "docker-entrypoint", start, 0)
+	return execEntrypoint(ctx, out, cmdArgs, append(environ, flattenEnv(values)...))
+}
+
+var errVaultLocation = errors.New("vault location required: set GITVAULT_REPO to a git URL or GITVAULT_VAULT to a mounted vault")
+
+// openContainerVault clones repo when set, otherwise resolves vaultPath
+// like --vault. The caller removes a clone.
+func (a App) openContainerVault(ctx context.Context, vaultPath, repo string) (string, error) {
+	if repo == "" {
+		return a.resolveRoot(vaultPath)
+	}
+	dir, err := a.cloneVault(ctx, repo, os.Getenv("GITVAULT_REF"))
+	if err != nil {
+		return "", err
+	}
+	if err := a.openVault(dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// cloneVault makes a shallow, single-branch clone of repo at ref (the
+// default branch when empty) in a private temp directory.
+func (a App) cloneVault(ctx context.Context, repo, ref string) (string, error) {
+	base, err := vaultfs.TempDir()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(base, "gitvault-clone-")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"clone", "--quiet", "--depth", "1", "--single-branch"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if err := a.runVaultGit(ctx, "clone", repo, append(args, "--", repo, dir)...); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// fetchVault moves a clone made by cloneVault to the latest commit of its
+// branch, discarding the old history so the clone stays shallow.
+func (a App) fetchVault(ctx context.Context, repo, dir string) error {
+	if err := a.runVaultGit(ctx, "fetch", repo, "-C", dir, "fetch", "--quiet", "--depth", "1", "origin"); err != nil {
+		return err
+	}
+	return a.runVaultGit(ctx, "fetch", repo, "-C", dir, "reset", "--quiet", "--hard", "FETCH_HEAD")
+}
+
+// runVaultGit runs a git network command on repo without prompting; op
+// names it in errors. A token in GITVAULT_GIT_TOKEN is sent as HTTP basic
+// auth through git's environment config, so it never shows up in the URL,
+// the process list, or the clone's .git/config.
+func (a App) runVaultGit(ctx context.Context, op, repo string, args ...string) error {
+	// The runner bounds the call by timeouts.gitNetwork; with its default,
+	// ssh gives up connecting first.
+	timeout := timing.DefaultTimeouts.GitNetwork
+	env := remoteEnv(timeout)
+	if token := os.Getenv("GITVAULT_GIT_TOKEN"); token != "" {
+		user := os.Getenv("GITVAULT_GIT_USER")
+		if user == "" {
+			user = "x-access-token"
+		}
+		redact.Add(token)
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+token)),
+		)
+	}
+	location := redactRemote(repo)
+	if _, stderr, err := a.runGit(ctx, env, nil, args...); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%s %s: %s: %w", op, location, remoteTimeout, err)
+		}
+		detail := strings.ReplaceAll(lastLine(string(stderr), err), repo, location)
+		switch reason := classifyRemoteError(string(stderr)); reason {
+		case remoteAuth, remoteUnreachable, remoteNotFound:
+			return fmt.Errorf("%s %s: %s: %s", op, location, reason, detail)
+		}
+		return fmt.Errorf("%s %s: %s", op, location, detail)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package cli
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+// execEntrypoint replaces the gitvault process with cmdArgs; it only
+// returns when the command cannot be started.
+func execEntrypoint(_ context.Context, out ui.Output, cmdArgs, environ []string) int {
+	path, err := exec.LookPath(cmdArgs[0])
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if err := syscall.Exec(path, cmdArgs, environ); err != nil {
+		out.Error(err)
+		return 1
+	}
+	return 0
+}
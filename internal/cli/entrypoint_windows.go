@@ -0,0 +1,31 @@
+//go:build windows
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+// execEntrypoint runs cmdArgs as a child and exits with its code; Windows
+// has no exec that replaces the running process.
+func execEntrypoint(ctx context.Context, out ui.Output, cmdArgs, environ []string) int {
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Env = environ
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = out.Out
+	cmd.Stderr = ui.Unredacted(out.Err)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		out.Error(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+const (
+	exportAny = "any"
+	exportRun = "run"
+)
+
+// matchExportPolicy returns the most specific policy for project/env.
+func matchExportPolicy(policies []settings.ExportPolicy, project, env string) (settings.ExportPolicy, bool) {
+	best, bestScore := settings.ExportPolicy{}, -1
+	for _, policy := range policies {
+		score := 0
+		switch {
+		case policy.Project != "" && policy.Project != project,
+			policy.Env != "" && policy.Env != env:
+			continue
+		}
+		if policy.Env != "" {
+			score += 2
+		}
+		if policy.Project != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = policy, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+func validateExportPolicies(policies []settings.ExportPolicy) error {
+	for i, policy := range policies {
+		if policy.Export != exportRun && policy.Export != exportAny {
+			return fmt.Errorf("export policy %d: export must be %q or %q, got %q", i+1, exportRun, exportAny, policy.Export)
+		}
+	}
+	return nil
+}
+
+// exportGuard applies the vault's export policies to every env a command
+// writes out in plaintext, loading them once.
+type exportGuard struct {
+	out      ui.Output
+	root     string
+	policies []settings.ExportPolicy
+	override bool
+	warned   map[string]bool
+}
+
+// newExportGuard loads the export policies. override lets run-only envs
+// through with a warning, for the rare deliberate export.
+func (a App) newExportGuard(out ui.Output, root string, override bool) (*exportGuard, error) {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		return nil, err
+	}
+	// A broken policy fails closed rather than allowing everything.
+	if err := validateExportPolicies(vaultSettings.ExportPolicies); err != nil {
+		return nil, fmt.Errorf("%s: %w", settings.Path(root), err)
+	}
+	return &exportGuard{out: out, root: root, policies: vaultSettings.ExportPolicies, override: override, warned: map[string]bool{}}, nil
+}
+
+// check refuses project/env when an export policy keeps it to `secret
+// run`. A nil guard allows everything, for the commands that only pass
+// values to a process.
+func (g *exportGuard) check(project, env string) error {
+	if g == nil {
+		return nil
+	}
+	policy, ok := matchExportPolicy(g.policies, project, env)
+	if !ok || policy.Export != exportRun {
+		return nil
+	}
+	if g.override {
+		if ref := project + "/" + env; !g.warned[ref] {
+			g.warned[ref] = true
+			fmt.Fprintf(g.out.Err, "warning: writing %s in plaintext despite its export policy\n", ref)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s/%s may only be used through `gitvault secret run` (export policy in .gitvault/settings.json); pass --allow-export-override to write it anyway", project, env)
+}
+
+// checkExportPolicy is check for a command that writes out one env.
+func (a App) checkExportPolicy(out ui.Output, root, project, env string, override bool) error {
+	guard, err := a.newExportGuard(out, root, override)
+	if err != nil {
+		return err
+	}
+	return guard.check(project, env)
+}
+
+// carryExportPolicies gives each move's target the run-only policy of its
+// source when nothing else keeps the target to `secret run`, so cloning or
+// renaming an env cannot lift its policy.
+func (a App) carryExportPolicies(root string, moves []envMove) error {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		return err
+	}
+	policies := vaultSettings.ExportPolicies
+	if err := validateExportPolicies(policies); err != nil {
+		return fmt.Errorf("%s: %w", settings.Path(root), err)
+	}
+	changed := false
+	for _, move := range moves {
+		source, ok := matchExportPolicy(policies, move.fromProject, move.fromEnv)
+		if !ok || source.Export != exportRun {
+			continue
+		}
+		if target, ok := matchExportPolicy(policies, move.toProject, move.toEnv); ok && target.Export == exportRun {
+			continue
+		}
+		policies = append(policies, settings.ExportPolicy{Project: move.toProject, Env: move.toEnv, Export: exportRun})
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	vaultSettings.ExportPolicies = policies
+	return settings.Save(a.Store.FS, root, vaultSettings)
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/exportstate"
+	"github.com/aatuh/gitvault/internal/keymeta"
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+// recordExport notes that path now holds data exported from project/env,
+// for `gitvault status`. The vault side is fingerprinted without
+// decrypting: the ciphertext hash plus the plaintext digest when current.
+func (a App) recordExport(root, project, env, path string, data []byte) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := a.Store.FS.ReadFile(a.Store.SecretFilePath(root, project, env))
+	if err != nil {
+		return err
+	}
+	export := exportstate.Export{
+		Vault:      absRoot,
+		Project:    project,
+		Env:        env,
+		Ciphertext: keymeta.CiphertextSum(ciphertext),
+		File:       contentSum(data),
+		Exported:   time.Now().UTC(),
+	}
+	if _, entry, ok := a.currentEntry(root, project, env); ok {
+		export.Digest = entry.Digest
+	}
+	return exportstate.Record(absPath, export)
+}
+
+func contentSum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// exportStatus compares a recorded export with its file and vault:
+// fresh, stale (the env changed), modified (the file was edited), missing
+// (the file is gone), or unknown (the vault cannot be read).
+func (a App) exportStatus(path string, export exportstate.Export) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "missing"
+	}
+	ciphertext, err := a.Store.FS.ReadFile(a.Store.SecretFilePath(export.Vault, export.Project, export.Env))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if _, statErr := os.Stat(export.Vault); statErr != nil {
+			return "unknown"
+		}
+		return "stale"
+	case err != nil:
+		return "unknown"
+	}
+	if keymeta.CiphertextSum(ciphertext) != export.Ciphertext {
+		// Re-encryption, e.g. by keys rotate, changes the ciphertext but
+		// not the digest.
+		_, entry, ok := a.currentEntry(export.Vault, export.Project, export.Env)
+		if !ok || export.Digest == "" || entry.Digest != export.Digest {
+			return "stale"
+		}
+	}
+	if contentSum(data) != export.File {
+		return "modified"
+	}
+	return "fresh"
+}
+
+func (a App) runStatus(out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setStatusUsage(fs)
+	onlyStale := fs.Bool("stale", false, "Only list exports that are not fresh")
+	prune := fs.Bool("prune", false, "Forget exports whose file no longer exists")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	state, err := exportstate.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	paths := make([]string, 0, len(state.Exports))
+	for path := range state.Exports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rows := [][]string{}
+	stale, pruned := 0, 0
+	for _, path := range paths {
+		export := state.Exports[path]
+		status := a.exportStatus(path, export)
+		if status == "missing" && *prune {
+			delete(state.Exports, path)
+			pruned++
+			continue
+		}
+		if status == "stale" {
+			stale++
+		}
+		if *onlyStale && status == "fresh" {
+			continue
+		}
+		rows = append(rows, []string{path, export.Vault, export.Project + "/" + export.Env, export.Exported.Format("2006-01-02T15:04:05Z"), status})
+	}
+	if pruned > 0 {
+		if err := exportstate.Save(state); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if len(rows) == 0 && !out.JSON {
+		out.Success(fmt.Sprintf("no exports to show (%d tracked)", len(state.Exports)), nil)
+	} else {
+		out.Table([]string{"path", "vault", "env", "exported", "status"}, rows)
+	}
+	if stale > 0 {
+		if !out.JSON {
+			fmt.Fprintln(out.Err, "hint: re-run `gitvault secret export-env` for stale files, or check them with `gitvault secret status --file <path>`")
+		}
+		return 1
+	}
+	return 0
+}
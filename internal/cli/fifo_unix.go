@@ -0,0 +1,51 @@
+//go:build !windows
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/aatuh/gitvault/internal/vaultfs"
+)
+
+// servePipe creates a named pipe called name in a private temp directory
+// and writes data to the first reader, so the plaintext only ever sits in
+// the kernel's pipe buffer. stop releases a writer still waiting for a
+// reader and removes the pipe.
+func servePipe(name string, data []byte) (string, func(), error) {
+	base, err := vaultfs.TempDir()
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp(base, "gitvault-pipe-")
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, filepath.Base(name))
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+	var stopped atomic.Bool
+	go func() {
+		pipe, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer pipe.Close()
+		if !stopped.Load() {
+			_, _ = pipe.Write(data)
+		}
+	}()
+	stop := func() {
+		stopped.Store(true)
+		if reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0); err == nil {
+			_ = reader.Close()
+		}
+		_ = os.RemoveAll(dir)
+	}
+	return path, stop, nil
+}
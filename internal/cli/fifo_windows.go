@@ -0,0 +1,9 @@
+//go:build windows
+
+package cli
+
+import "errors"
+
+func servePipe(string, []byte) (string, func(), error) {
+	return "", nil, errors.New("file exec needs named pipes, which are not supported on Windows")
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+func (a App) runFileExec(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("file exec", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setFileExecUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	name := fs.String("name", "", "File name to serve")
+	varName := fs.String("var", "GITVAULT_FILE", "Environment variable that receives the pipe path")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	trailing := 0
+	if *name == "" {
+		trailing = 1
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), trailing)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *name == "" && len(remaining) > 0 && remaining[0] != "--" {
+		*name = remaining[0]
+		remaining = remaining[1:]
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if strings.TrimSpace(*name) == "" {
+		out.Error(errors.New("--name is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if strings.TrimSpace(*varName) == "" {
+		out.Error(errors.New("--var must not be empty"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 0 && remaining[0] == "--" {
+		remaining = remaining[1:]
+	}
+	if len(remaining) == 0 {
+		out.Error(errors.New("command required after flags"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	data, _, err := a.FileService.Get(ctx, root, *project, *env, *name)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	defer clear(data)
+	path, stop, err := servePipe(*name, data)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	defer stop()
+
+	// "{}" in the command line stands for the pipe path, as with find -exec.
+	cmdArgs := make([]string, len(remaining))
+	for i, arg := range remaining {
+		cmdArgs[i] = strings.ReplaceAll(arg, "{}", path)
+	}
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Env = append(os.Environ(), *varName+"="+path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = out.Out
+	cmd.Stderr = ui.Unredacted(out.Err)
+	if err := cmd.Run(); err != nil {
+		out.Error(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+// keyFilter narrows and orders key listings using index metadata.
+type keyFilter struct {
+	since  time.Time
+	before time.Time
+	sortBy string
+}
+
+func newKeyFilter(since, before, sortBy string, now time.Time) (keyFilter, error) {
+	var f keyFilter
+	var err error
+	if f.since, err = parseTimeBound(since, now); err != nil {
+		return f, fmt.Errorf("invalid --since: %w", err)
+	}
+	if f.before, err = parseTimeBound(before, now); err != nil {
+		return f, fmt.Errorf("invalid --before: %w", err)
+	}
+	switch sortBy {
+	case "", "name", "last_updated":
+		f.sortBy = sortBy
+	default:
+		return f, fmt.Errorf("invalid --sort %q (use name or last_updated)", sortBy)
+	}
+	return f, nil
+}
+
+func (f keyFilter) active() bool {
+	return !f.since.IsZero() || !f.before.IsZero()
+}
+
+// matches reports whether an update time falls within the time bounds.
+func (f keyFilter) matches(updated time.Time) bool {
+	if !f.since.IsZero() && updated.Before(f.since) {
+		return false
+	}
+	return f.before.IsZero() || updated.Before(f.before)
+}
+
+func (f keyFilter) apply(keys []domain.KeyInfo) []domain.KeyInfo {
+	if f.active() {
+		filtered := keys[:0]
+		for _, key := range keys {
+			if f.matches(key.LastUpdated) {
+				filtered = append(filtered, key)
+			}
+		}
+		keys = filtered
+	}
+	if f.sortBy == "last_updated" {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].LastUpdated.After(keys[j].LastUpdated)
+		})
+	}
+	return keys
+}
+
+// parseTimeBound accepts a date (2006-01-02), an RFC 3339 timestamp, or an
+// age such as 7d, 2w, or 36h meaning that long before now.
+func parseTimeBound(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.UTC); err == nil {
+		return t, nil
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (2006-01-02) or age (7d, 2w, 36h)", value)
+	}
+	return now.Add(-age), nil
+}
+
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(count) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return d, nil
+}
+
+// newRefMatcher builds a matcher for project/env/name refs from at most one
+// of a case-insensitive substring, a glob (where * stops at /), or a regex.
+func newRefMatcher(substr, glob, expr string) (func(string) bool, error) {
+	set := 0
+	for _, v := range []string{substr, glob, expr} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("use only one of a pattern argument, --glob, or --regex")
+	}
+	switch {
+	case glob != "":
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid --glob: %w", err)
+		}
+		return func(ref string) bool {
+			ok, _ := path.Match(glob, ref)
+			return ok
+		}, nil
+	case expr != "":
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --regex: %w", err)
+		}
+		return re.MatchString, nil
+	default:
+		return func(ref string) bool {
+			return substr == "" || domain.ContainsFold(ref, substr)
+		}, nil
+	}
+}
+
+// page selects a window of a listing. A zero limit means no limit.
+type page struct {
+	limit  int
+	offset int
+}
+
+func newPage(limit, offset int) (page, error) {
+	if limit < 0 {
+		return page{}, errors.New("--limit must not be negative")
+	}
+	if offset < 0 {
+		return page{}, errors.New("--offset must not be negative")
+	}
+	return page{limit: limit, offset: offset}, nil
+}
+
+// pageBuffer collects one page of a listing while it is produced, so a
+// walk can stop once the page is full instead of loading every entry.
+type pageBuffer[T any] struct {
+	page
+	items []T
+	seen  int
+	// more is set once an entry past the page was offered.
+	more bool
+}
+
+func newPageBuffer[T any](p page) *pageBuffer[T] {
+	return &pageBuffer[T]{page: p, items: []T{}}
+}
+
+// add offers the next entry in listing order and reports whether the
+// caller should keep going.
+func (b *pageBuffer[T]) add(item T) bool {
+	if b.limit > 0 && b.seen >= b.offset+b.limit {
+		b.more = true
+		return false
+	}
+	if b.seen >= b.offset {
+		b.items = append(b.items, item)
+	}
+	b.seen++
+	return true
+}
+
+// fill offers items in order, for listings that must be loaded whole, e.g.
+// to sort them.
+func (b *pageBuffer[T]) fill(items []T) {
+	for _, item := range items {
+		if !b.add(item) {
+			return
+		}
+	}
+}
+
+// empty reports whether the listing had no entries at all, as opposed to
+// none past --offset.
+func (b *pageBuffer[T]) empty() bool {
+	return b.seen == 0
+}
+
+// printPageHint tells humans where the next page starts. JSON consumers page
+// by comparing the row count with --limit.
+func printPageHint[T any](out ui.Output, b *pageBuffer[T]) {
+	next := b.offset + len(b.items)
+	if out.JSON || out.Quiet || len(b.items) == 0 || !b.more {
+		return
+	}
+	fmt.Fprintf(out.Err, "showing %d-%d; use --offset %d for more\n", b.offset+1, next, next)
+}
+
+// refOrder sorts project or env names so that walking them yields
+// project/env/name refs in plain string order: "a-b/x" sorts before "a/x".
+func refOrder(names []string) []string {
+	sort.Slice(names, func(i, j int) bool {
+		return names[i]+"/" < names[j]+"/"
+	})
+	return names
+}
+
+// walkEnvs calls fn for every env in idx in ref order, limited to project
+// and env when they are set, until fn returns false.
+func walkEnvs(idx domain.Index, project, env string, fn func(project, env string, envIndex *domain.EnvIndex) bool) {
+	for _, p := range refOrder(idx.ListProjects()) {
+		if project != "" && p != project {
+			continue
+		}
+		for _, e := range refOrder(idx.ListEnvs(p)) {
+			if env != "" && e != env {
+				continue
+			}
+			if envIndex := indexEnv(idx, p, e); envIndex != nil && !fn(p, e, envIndex) {
+				return
+			}
+		}
+	}
+}
+
+// keyPage lists one page of the keys in project/env, or of every key as
+// project/env/KEY refs when both are empty. Sorted by name it stops reading
+// the index once the page is full; newest-first needs every key first.
+func (a App) keyPage(root, project, env string, filter keyFilter, window page) (*pageBuffer[domain.KeyInfo], error) {
+	buf := newPageBuffer[domain.KeyInfo](window)
+	if filter.sortBy == "last_updated" {
+		var keys []domain.KeyInfo
+		var err error
+		if project == "" && env == "" {
+			keys, err = a.Listing.ListAllKeys(root)
+		} else {
+			keys, err = a.Listing.ListKeys(root, project, env)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.fill(filter.apply(keys))
+		return buf, nil
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	all := project == "" && env == ""
+	walkEnvs(idx, project, env, func(p, e string, envIndex *domain.EnvIndex) bool {
+		for _, name := range slices.Sorted(maps.Keys(envIndex.Keys)) {
+			updated := envIndex.Keys[name].LastUpdated
+			if !filter.matches(updated) {
+				continue
+			}
+			if all {
+				name = p + "/" + e + "/" + name
+			}
+			if !buf.add(domain.KeyInfo{Name: name, LastUpdated: updated}) {
+				return false
+			}
+		}
+		return true
+	})
+	return buf, nil
+}
+
+// filePage is keyPage for stored files. With verify every file is checked
+// first, since the statuses include orphans the index does not list.
+func (a App) filePage(root, project, env string, window page, verify bool) (*pageBuffer[domain.FileInfo], map[string]string, error) {
+	buf := newPageBuffer[domain.FileInfo](window)
+	if verify {
+		var files []domain.FileInfo
+		var err error
+		if project == "" && env == "" {
+			files, err = a.Listing.ListAllFiles(root)
+		} else {
+			files, err = a.Listing.ListFiles(root, project, env)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		files, statuses, err := a.verifyFiles(root, project, env, files)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf.fill(files)
+		return buf, statuses, nil
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	all := project == "" && env == ""
+	walkEnvs(idx, project, env, func(p, e string, envIndex *domain.EnvIndex) bool {
+		for _, name := range slices.Sorted(maps.Keys(envIndex.Files)) {
+			meta := envIndex.Files[name]
+			if all {
+				name = p + "/" + e + "/" + name
+			}
+			if !buf.add(domain.FileInfo{Name: name, Size: meta.Size, SHA256: meta.SHA256, MIME: meta.MIME, LastUpdated: meta.LastUpdated}) {
+				return false
+			}
+		}
+		return true
+	})
+	return buf, nil, nil
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"sort"
+	"strconv"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+// findResult is one match of `gitvault find`. path is the untyped
+// project/env/name ref the pattern is matched against.
+type findResult struct {
+	kind string
+	path string
+	row  []string
+}
+
+func (a App) runFind(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setFindUsage(fs)
+	glob := fs.String("glob", "", "Match refs with a glob, e.g. 'app/*/DB_*'")
+	expr := fs.String("regex", "", "Match refs with a regular expression")
+	kind := fs.String("type", "", "Only this type of result: secret or file")
+	project := fs.String("project", "", "Only search this project")
+	env := fs.String("env", "", "Only search envs with this name")
+	limit := fs.Int("limit", 0, "Show at most this many matches (0 = all)")
+	offset := fs.Int("offset", 0, "Skip this many matches")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	window, err := newPage(*limit, *offset)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *kind != "" && *kind != "secret" && *kind != "file" {
+		out.Error(errors.New("--type must be secret or file"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 1 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	pattern := ""
+	if len(fs.Args()) > 0 {
+		pattern = fs.Args()[0]
+	}
+	match, err := newRefMatcher(pattern, *glob, *expr)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	// Matches are sorted within each env and envs are walked in ref order,
+	// so the walk stops once the page is full.
+	rows := newPageBuffer[[]string](window)
+	walkEnvs(idx, *project, *env, func(p, e string, envIndex *domain.EnvIndex) bool {
+		prefix := p + "/" + e + "/"
+		results := []findResult{}
+		if *kind != "file" {
+			for name, meta := range envIndex.Keys {
+				if match(prefix + name) {
+					updated := meta.LastUpdated.Format("2006-01-02T15:04:05Z")
+					results = append(results, findResult{"secret", prefix + name, []string{"secret:" + prefix + name, "", "", updated}})
+				}
+			}
+		}
+		if *kind != "secret" {
+			for name, meta := range envIndex.Files {
+				if match(prefix + name) {
+					updated := meta.LastUpdated.Format("2006-01-02T15:04:05Z")
+					results = append(results, findResult{"file", prefix + name, []string{"file:" + prefix + name, strconv.FormatInt(meta.Size, 10), meta.MIME, updated}})
+				}
+			}
+		}
+		sort.Slice(results, func(i, j int) bool {
+			if results[i].path != results[j].path {
+				return results[i].path < results[j].path
+			}
+			return results[i].kind > results[j].kind
+		})
+		for _, result := range results {
+			if !rows.add(result.row) {
+				return false
+			}
+		}
+		return true
+	})
+	out.Table([]string{"ref", "size", "mime", "last_updated"}, rows.items)
+	printPageHint(out, rows)
+	return 0
+}
@@ -0,0 +1,429 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/services"
+)
+
+const (
+	problemOrphan     = "orphan"
+	problemMissing    = "missing"
+	problemStaleTemp  = "stale temp"
+	problemUnexpected = "unexpected"
+)
+
+type fsckIssue struct {
+	Problem string `json:"problem"`
+	Type    string `json:"type"`
+	Ref     string `json:"ref"`
+	Path    string `json:"path"`
+	Action  string `json:"action,omitempty"`
+
+	project, env, name string
+}
+
+func (i fsckIssue) resolved() bool {
+	return i.Action == "reindexed" || i.Action == "pruned" || i.Action == "removed"
+}
+
+func (a App) runFsck(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setFsckUsage(fs)
+	fix := fs.Bool("fix", false, "Same as --reindex --prune")
+	reindex := fs.Bool("reindex", false, "Add orphaned ciphertexts to the index (decrypts them)")
+	prune := fs.Bool("prune", false, "Drop index entries whose ciphertext is missing and remove stale temp files")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	issues, err := a.scanConsistency(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *fix || *reindex || *prune {
+		if err := a.repairConsistency(ctx, root, issues, *fix || *reindex, *fix || *prune); err != nil {
+			out.Error(err)
+			printSopsHint(err, out.Err, out.JSON)
+			return 1
+		}
+	}
+	if len(issues) == 0 {
+		out.Success("index and storage are consistent", nil)
+		return 0
+	}
+
+	unresolved := 0
+	rows := make([][]string, 0, len(issues))
+	for _, issue := range issues {
+		if !issue.resolved() {
+			unresolved++
+		}
+		rows = append(rows, []string{issue.Problem, issue.Type, issue.Ref, issue.Path, issue.Action})
+	}
+	out.Table([]string{"problem", "type", "ref", "path", "action"}, rows)
+	if unresolved == 0 {
+		return 0
+	}
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault fsck --reindex` to index orphans or `gitvault fsck --prune` to drop missing entries")
+	}
+	return 1
+}
+
+// scanConsistency compares the index with the ciphertexts on disk. It only
+// looks at paths, so nothing is decrypted.
+func (a App) scanConsistency(root string) ([]fsckIssue, error) {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	var issues []fsckIssue
+
+	secrets, err := a.walkVaultDir(a.Store.SecretsDir(root))
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range secrets {
+		issue := fsckIssue{Type: "secret", Path: path.Join("secrets", rel)}
+		parts := strings.Split(rel, "/")
+		switch {
+		case strings.HasSuffix(rel, ".tmp"):
+			issue.Problem, issue.Ref = problemStaleTemp, rel
+		case len(parts) == 2 && strings.HasSuffix(parts[1], ".env"):
+			issue.project, issue.env = parts[0], strings.TrimSuffix(parts[1], ".env")
+			issue.Ref = issue.project + "/" + issue.env
+			if e := indexEnv(idx, issue.project, issue.env); e != nil && len(e.Keys) > 0 {
+				continue
+			}
+			issue.Problem = problemOrphan
+		default:
+			issue.Problem, issue.Ref = problemUnexpected, rel
+		}
+		issues = append(issues, issue)
+	}
+
+	files, err := a.walkVaultDir(a.Store.FilesDir(root))
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range files {
+		issue := fsckIssue{Type: "file", Path: path.Join("files", rel), Ref: rel}
+		parts := strings.Split(rel, "/")
+		switch {
+		case strings.HasSuffix(rel, ".tmp"):
+			issue.Problem = problemStaleTemp
+		case len(parts) == 3:
+			issue.project, issue.env, issue.name = parts[0], parts[1], parts[2]
+			if e := indexEnv(idx, issue.project, issue.env); e != nil && e.Files[issue.name] != nil {
+				continue
+			}
+			issue.Problem = problemOrphan
+		default:
+			issue.Problem = problemUnexpected
+		}
+		issues = append(issues, issue)
+	}
+
+	for project, p := range idx.Projects {
+		for env, e := range p.Envs {
+			if len(e.Keys) > 0 {
+				if missing, err := a.ciphertextMissing(a.Store.SecretFilePath(root, project, env)); err != nil {
+					return nil, err
+				} else if missing {
+					issues = append(issues, fsckIssue{
+						Problem: problemMissing, Type: "secret", Ref: project + "/" + env,
+						Path:    path.Join("secrets", project, env+".env"),
+						project: project, env: env,
+					})
+				}
+			}
+			for name := range e.Files {
+				if missing, err := a.ciphertextMissing(a.Store.FilePath(root, project, env, name)); err != nil {
+					return nil, err
+				} else if missing {
+					issues = append(issues, fsckIssue{
+						Problem: problemMissing, Type: "file", Ref: project + "/" + env + "/" + name,
+						Path:    path.Join("files", project, env, name),
+						project: project, env: env, name: name,
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues, nil
+}
+
+// repairConsistency fixes issues in place, recording what was done in each
+// issue's Action. Orphans are indexed with their file's modification time.
+func (a App) repairConsistency(ctx context.Context, root string, issues []fsckIssue, reindex, prune bool) error {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return err
+	}
+	changed := false
+	touched := map[[2]string]bool{}
+	for i := range issues {
+		issue := &issues[i]
+		switch {
+		case issue.Problem == problemOrphan && reindex:
+			if err := a.reindexOrphan(ctx, root, &idx, *issue); err != nil {
+				issue.Action = "reindex failed: " + err.Error()
+				continue
+			}
+			issue.Action = "reindexed"
+		case issue.Problem == problemMissing && prune:
+			if issue.Type == "file" {
+				idx.RemoveFile(issue.project, issue.env, issue.name)
+			} else if e := indexEnv(idx, issue.project, issue.env); e != nil {
+				for key := range e.Keys {
+					idx.RemoveKey(issue.project, issue.env, key)
+				}
+			}
+			issue.Action = "pruned"
+		case issue.Problem == problemStaleTemp && prune:
+			if err := a.Store.FS.Remove(filepath.Join(root, filepath.FromSlash(issue.Path))); err != nil && !errors.Is(err, os.ErrNotExist) {
+				issue.Action = "remove failed: " + err.Error()
+				continue
+			}
+			issue.Action = "removed"
+			continue
+		default:
+			continue
+		}
+		changed = true
+		if issue.Type == "secret" {
+			touched[[2]string{issue.project, issue.env}] = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := a.Store.SaveIndex(root, idx); err != nil {
+		return err
+	}
+	for env := range touched {
+		if err := a.recordDigest(ctx, root, env[0], env[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a App) reindexOrphan(ctx context.Context, root string, idx *domain.Index, issue fsckIssue) error {
+	if err := validateProjectEnv(issue.project, issue.env); err != nil {
+		return err
+	}
+	physical := filepath.Join(root, filepath.FromSlash(issue.Path))
+	info, err := a.Store.FS.Stat(physical)
+	if err != nil {
+		return err
+	}
+	data, err := a.Store.FS.ReadFile(physical)
+	if err != nil {
+		return err
+	}
+	if issue.Type == "file" {
+		if err := domain.ValidateIdentifier(issue.name, "file name"); err != nil {
+			return err
+		}
+		plaintext, err := a.FileService.Encrypter.DecryptBinary(ctx, data)
+		if err != nil {
+			return err
+		}
+		idx.SetFile(issue.project, issue.env, issue.name, fileMetadata(plaintext, info.ModTime()))
+		return nil
+	}
+	plaintext, err := a.SecretService.Encrypter.DecryptDotenv(ctx, data)
+	if err != nil {
+		return err
+	}
+	parsed, problems := domain.ParseDotenv(plaintext)
+	if hasDotenvErrors(problems) {
+		return errors.New("ciphertext is not a valid dotenv file")
+	}
+	if len(parsed.Values) == 0 {
+		return errors.New("no keys to index")
+	}
+	for key := range parsed.Values {
+		idx.SetKey(issue.project, issue.env, key, info.ModTime())
+	}
+	return nil
+}
+
+// fileMetadata mirrors the metadata sealr records on file put.
+func fileMetadata(data []byte, updated time.Time) domain.FileMetadata {
+	sum := sha256.Sum256(data)
+	meta := domain.FileMetadata{
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		MIME:        "application/octet-stream",
+		LastUpdated: updated,
+	}
+	if len(data) > 0 {
+		meta.MIME = http.DetectContentType(data[:min(len(data), 512)])
+	}
+	return meta
+}
+
+// walkVaultDir lists the regular files below dir as slash-separated paths
+// relative to it. A missing dir has no files.
+func (a App) walkVaultDir(dir string) ([]string, error) {
+	var files []string
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		entries, err := a.Store.FS.ReadDir(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			if rel == "" && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		for _, entry := range entries {
+			child := path.Join(rel, entry.Name())
+			if entry.IsDir() {
+				if err := walk(child); err != nil {
+					return err
+				}
+				continue
+			}
+			files = append(files, child)
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (a App) ciphertextMissing(file string) (bool, error) {
+	if _, err := a.Store.FS.Stat(file); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+func indexEnv(idx domain.Index, project, env string) *domain.EnvIndex {
+	p, ok := idx.Projects[project]
+	if !ok || p == nil {
+		return nil
+	}
+	return p.Envs[env]
+}
+
+// verifyFiles stats the ciphertext of each listed file, marking it ok,
+// missing, or truncated (smaller than its plaintext, which a SOPS file never
+// is), and adds ciphertexts the index does not know as orphans. Without a
+// project every file is listed and named project/env/name. Statuses are
+// keyed by file name as listed.
+func (a App) verifyFiles(root, project, env string, files []domain.FileInfo) ([]domain.FileInfo, map[string]string, error) {
+	statuses := map[string]string{}
+	listed := func(p, e, name string) string {
+		if project == "" {
+			return p + "/" + e + "/" + name
+		}
+		return name
+	}
+	for _, file := range files {
+		p, e, name := project, env, file.Name
+		if project == "" {
+			p, e, name = splitKeyRef(file.Name)
+		}
+		info, err := a.Store.FS.Stat(a.Store.FilePath(root, p, e, name))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			statuses[file.Name] = problemMissing
+		case err != nil:
+			return nil, nil, err
+		case info.Size() == 0 || info.Size() < file.Size:
+			statuses[file.Name] = "truncated"
+		default:
+			statuses[file.Name] = "ok"
+		}
+	}
+	stored, err := a.walkVaultDir(a.Store.FilesDir(root))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rel := range stored {
+		parts := strings.Split(rel, "/")
+		if len(parts) != 3 || strings.HasSuffix(rel, ".tmp") {
+			continue
+		}
+		if project != "" && (parts[0] != project || parts[1] != env) {
+			continue
+		}
+		name := listed(parts[0], parts[1], parts[2])
+		if _, ok := statuses[name]; !ok {
+			statuses[name] = problemOrphan
+			files = append(files, domain.FileInfo{Name: name})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, statuses, nil
+}
+
+func verifyExitCode(statuses map[string]string) int {
+	for _, status := range statuses {
+		if status != "ok" {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printVerifyHint(out ui.Output, statuses map[string]string) {
+	if verifyExitCode(statuses) != 0 && !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault fsck` for every drift between the index and storage, and `gitvault fsck --fix` to repair it")
+	}
+}
+
+// checkConsistency summarizes scanConsistency for doctor.
+func (a App) checkConsistency(root string) services.CheckResult {
+	result := services.CheckResult{Name: "index consistency"}
+	issues, err := a.scanConsistency(root)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(issues) == 0 {
+		result.Status = services.CheckOK
+		result.Message = "index matches stored ciphertexts"
+		return result
+	}
+	result.Status = services.CheckWarn
+	result.Message = fmt.Sprintf("%d problem(s) (e.g. %s %s %s)", len(issues), issues[0].Problem, issues[0].Type, issues[0].Path)
+	return result
+}
@@ -0,0 +1,333 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+// gcCandidate is a path in the vault's history that gc could drop:
+// plaintext committed outside secrets/ and files/, or an obsolete version of
+// a large blob that the current tree no longer uses.
+type gcCandidate struct {
+	path   string
+	reason string
+	bytes  int64
+	blob   string
+}
+
+// managedDirs hold ciphertext; a plaintext-looking name there is expected.
+var managedDirs = []string{"secrets/", "files/", ".gitvault/"}
+
+// looksPlaintext reports whether a path outside the managed dirs looks like
+// a secret that was committed unencrypted.
+func looksPlaintext(name string) bool {
+	for _, dir := range managedDirs {
+		if strings.HasPrefix(name, dir) {
+			return false
+		}
+	}
+	base := path.Base(name)
+	if base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env") {
+		return true
+	}
+	switch path.Ext(base) {
+	case ".pem", ".key", ".p12", ".pfx", ".keystore":
+		return true
+	}
+	return base == "id_rsa" || base == "id_ed25519" || base == "keys.txt"
+}
+
+// parseSize reads a byte count with an optional K, M, or G suffix (powers
+// of 1024).
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for suffix, factor := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if trimmed, ok := strings.CutSuffix(value, suffix); ok {
+			value, multiplier = trimmed, factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 512K, 10M)", value)
+	}
+	return n * multiplier, nil
+}
+
+// gcCandidates lists every blob in the history, then keeps plaintext-looking
+// paths and obsolete blobs of at least minSize bytes.
+func (a App) gcCandidates(ctx context.Context, root string, minSize int64) ([]gcCandidate, error) {
+	objects, err := a.vaultGitOutput(ctx, root, nil, "rev-list", "--objects", "--all", "--filter=object:type=blob")
+	if err != nil {
+		return nil, err
+	}
+	current, err := a.currentBlobs(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(objects))
+	for scanner.Scan() {
+		id, name, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || name == "" {
+			continue
+		}
+		paths[id] = name
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sizes, err := a.blobSizes(ctx, root, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []gcCandidate{}
+	plaintext := map[string]int64{}
+	for id, name := range paths {
+		if looksPlaintext(name) {
+			plaintext[name] += sizes[id]
+			continue
+		}
+		if !current[id] && sizes[id] >= minSize && sizes[id] > 0 {
+			candidates = append(candidates, gcCandidate{path: name, reason: "obsolete", bytes: sizes[id], blob: id})
+		}
+	}
+	for name, size := range plaintext {
+		candidates = append(candidates, gcCandidate{path: name, reason: "plaintext", bytes: size})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].reason != candidates[j].reason {
+			return candidates[i].reason > candidates[j].reason
+		}
+		if candidates[i].bytes != candidates[j].bytes {
+			return candidates[i].bytes > candidates[j].bytes
+		}
+		return candidates[i].path < candidates[j].path
+	})
+	return candidates, nil
+}
+
+// currentBlobs returns the blobs in the tree of HEAD and of every ref tip.
+// Candidates come from all refs, so a blob another branch or a tag still
+// uses must not count as obsolete just because HEAD dropped it.
+func (a App) currentBlobs(ctx context.Context, root string) (map[string]bool, error) {
+	refs, err := a.vaultGitOutput(ctx, root, nil, "for-each-ref", "--format=%(objectname)")
+	if err != nil {
+		return nil, err
+	}
+	tips := map[string]bool{"HEAD": true}
+	for _, tip := range strings.Fields(string(refs)) {
+		tips[tip] = true
+	}
+	current := map[string]bool{}
+	for tip := range tips {
+		// A ref to something without a tree, or an unborn HEAD, holds no
+		// current files.
+		tree, err := a.vaultGitOutput(ctx, root, nil, "ls-tree", "-r", tip)
+		if err != nil {
+			continue
+		}
+		// <mode> blob <id>\t<path>
+		for _, line := range strings.Split(string(tree), "\n") {
+			if fields := strings.Fields(line); len(fields) >= 3 {
+				current[fields[2]] = true
+			}
+		}
+	}
+	return current, nil
+}
+
+func (a App) runGC(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setGCUsage(fs)
+	largerThan := fs.String("larger-than", "1M", "Only treat obsolete blobs of at least this size as candidates")
+	var dropPaths stringSliceFlag
+	fs.Var(&dropPaths, "path", "Remove this path from all history (repeatable)")
+	pruneObsolete := fs.Bool("prune-obsolete", false, "Remove the obsolete blobs listed as candidates")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	minSize, err := parseSize(*largerThan)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if a.Sync.Git == nil {
+		out.Error(errors.New("git is not configured"))
+		return 1
+	}
+	if isRepo, err := a.Sync.Git.IsRepo(ctx, root); err != nil || !isRepo {
+		out.Error(errors.New("the vault is not a git repository"))
+		return 1
+	}
+	candidates, err := a.gcCandidates(ctx, root, minSize)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	if len(dropPaths) == 0 && !*pruneObsolete {
+		if len(candidates) == 0 && !out.JSON {
+			out.Success("nothing to collect", nil)
+			return 0
+		}
+		rows := make([][]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			rows = append(rows, []string{candidate.path, candidate.reason, strconv.FormatInt(candidate.bytes, 10)})
+		}
+		out.Table([]string{"path", "reason", "bytes"}, rows)
+		if !out.JSON {
+			fmt.Fprintln(out.Err, "hint: drop plaintext with `gitvault gc --path <path>` and old versions with `gitvault gc --prune-obsolete`; rotate any value that was committed in plaintext")
+		}
+		return 0
+	}
+
+	for _, p := range dropPaths {
+		for _, dir := range managedDirs {
+			if strings.HasPrefix(filepath.ToSlash(p), dir) {
+				out.Error(fmt.Errorf("--path %s is managed by gitvault; remove it with gitvault and use --prune-obsolete for old versions", p))
+				printFlagUsage(fs, out.Err)
+				return 2
+			}
+		}
+	}
+	if _, err := a.vaultGitOutput(ctx, root, nil, "filter-repo", "--version"); err != nil {
+		out.Error(errors.New("git filter-repo is not installed; see https://github.com/newren/git-filter-repo"))
+		return 1
+	}
+	if status, err := a.vaultGitOutput(ctx, root, nil, "status", "--porcelain"); err != nil || len(bytes.TrimSpace(status)) > 0 {
+		out.Error(errors.New("the vault has uncommitted changes; commit or stash them first"))
+		return 1
+	}
+
+	filterArgs := []string{"filter-repo", "--force"}
+	if len(dropPaths) > 0 {
+		filterArgs = append(filterArgs, "--invert-paths")
+		for _, p := range dropPaths {
+			filterArgs = append(filterArgs, "--path", filepath.ToSlash(p))
+		}
+	}
+	obsolete := 0
+	if *pruneObsolete {
+		var ids bytes.Buffer
+		for _, candidate := range candidates {
+			if candidate.blob != "" {
+				ids.WriteString(candidate.blob + "\n")
+				obsolete++
+			}
+		}
+		if obsolete > 0 {
+			idFile, err := os.CreateTemp("", "gitvault-gc-*.txt")
+			if err != nil {
+				out.Error(err)
+				return 1
+			}
+			defer os.Remove(idFile.Name())
+			if _, err := idFile.Write(ids.Bytes()); err != nil {
+				_ = idFile.Close()
+				out.Error(err)
+				return 1
+			}
+			if err := idFile.Close(); err != nil {
+				out.Error(err)
+				return 1
+			}
+			filterArgs = append(filterArgs, "--strip-blobs-with-ids", idFile.Name())
+		}
+	}
+	if len(dropPaths) == 0 && obsolete == 0 {
+		out.Success("nothing to collect", nil)
+		return 0
+	}
+
+	fmt.Fprintf(out.Err, "this rewrites every commit of %s: %d path(s) and %d obsolete blob(s) are removed, then all secrets are re-encrypted with fresh data keys\n", root, len(dropPaths), obsolete)
+	if err := confirmRewrite(out, *yes); err != nil {
+		out.Error(err)
+		if errors.Is(err, errRewriteNotConfirmed) {
+			return 2
+		}
+		return 1
+	}
+
+	// filter-repo drops origin so a rewritten repository is not pushed by
+	// accident; put it back, since the force push is the point here.
+	origin, _ := a.vaultGitOutput(ctx, root, nil, "remote", "get-url", "origin")
+	if err := a.vaultGit(ctx, root, filterArgs...); err != nil {
+		out.Error(err)
+		return 1
+	}
+	if url := strings.TrimSpace(string(origin)); url != "" {
+		if err := a.vaultGit(ctx, root, "remote", "add", "origin", url); err != nil {
+			fmt.Fprintf(out.Err, "warning: could not restore origin: %v\n", err)
+		}
+	}
+
+	// Anything the old history held may be in other clones, so nothing in
+	// the new ciphertexts may share a data key with it.
+	if code := a.runKeys(ctx, out, root, []string{"rotate", "--force"}); code != 0 {
+		fmt.Fprintln(out.Err, "hint: history was rewritten but rotation failed; fix the error and run `gitvault keys rotate --force`")
+		return code
+	}
+	if status, err := a.vaultGitOutput(ctx, root, nil, "status", "--porcelain"); err == nil && len(bytes.TrimSpace(status)) > 0 {
+		if err := a.commitVault(ctx, root, commitInfo{action: "gc", summary: "Re-encrypt secrets after history rewrite"}); err != nil {
+			out.Error(fmt.Errorf("rewritten and rotated, but commit failed: %w", err))
+			return 1
+		}
+	}
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: push with `git push --force --all`, have every teammate re-clone, and change any value that was ever committed in plaintext")
+	}
+	return 0
+}
+
+var errRewriteNotConfirmed = errors.New("rewriting history requires confirmation; rerun with --yes")
+
+// confirmRewrite asks before history is rewritten. Like confirmValues,
+// scripts and --json must pass --yes.
+func confirmRewrite(out ui.Output, yes bool) error {
+	if yes {
+		return nil
+	}
+	if out.JSON || !ui.IsTerminal(os.Stdin) {
+		return errRewriteNotConfirmed
+	}
+	fmt.Fprint(out.Err, "rewrite history? [y/N]: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return errors.New("aborted")
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New("aborted")
+}
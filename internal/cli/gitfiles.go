@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aatuh/sealr/services"
+)
+
+// vaultGitFiles are written into every new vault. Existing files are left
+// alone, so a team's own rules always win.
+var vaultGitFiles = []struct{ name, content string }{
+	{".gitattributes", `# Written by gitvault. Encrypted files must not be merged or diffed line by
+# line: a textual merge of a SOPS file breaks its MAC. Resolve conflicts with
+# gitvault instead.
+secrets/** binary
+files/** binary
+`},
+	{".gitignore", `# Written by gitvault. Leftovers of interrupted writes, and plaintext that
+# must never be committed to the vault.
+*.tmp
+/.env
+/.env.*
+`},
+}
+
+// writeVaultGitFiles creates whichever of vaultGitFiles are missing in root
+// and returns their names.
+func (a App) writeVaultGitFiles(root string) ([]string, error) {
+	var written []string
+	for _, file := range vaultGitFiles {
+		path := filepath.Join(root, file.name)
+		if _, err := a.Store.FS.Stat(path); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return written, err
+		}
+		if err := a.Store.FS.WriteFile(path, []byte(file.content), 0644); err != nil {
+			return written, err
+		}
+		written = append(written, file.name)
+	}
+	return written, nil
+}
+
+func (a App) checkVaultGitFiles(root string, fix bool) services.CheckResult {
+	result := services.CheckResult{Name: "git hygiene"}
+	var missing []string
+	for _, file := range vaultGitFiles {
+		if _, err := a.Store.FS.Stat(filepath.Join(root, file.name)); err != nil {
+			missing = append(missing, file.name)
+		}
+	}
+	if len(missing) == 0 {
+		result.Status = services.CheckOK
+		result.Message = "present"
+		return result
+	}
+	if fix {
+		written, err := a.writeVaultGitFiles(root)
+		if err != nil {
+			result.Status = services.CheckFail
+			result.Message = err.Error()
+			return result
+		}
+		result.Status = services.CheckOK
+		result.Message = "wrote " + strings.Join(written, ", ")
+		return result
+	}
+	result.Status = services.CheckWarn
+	result.Message = fmt.Sprintf("missing %s", strings.Join(missing, ", "))
+	return result
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/cmdenv"
+)
+
+// gitStats is what `stats --git` learns from the vault's history. Sizes are
+// git blob sizes, i.e. ciphertext bytes before git compresses them.
+type gitStats struct {
+	Commits       int          `json:"commits"`
+	SecretCommits int          `json:"secret_commits"`
+	RepoBytes     int64        `json:"repo_bytes"`
+	HistoryBytes  int64        `json:"history_bytes"`
+	LargestDeltas []deltaStat  `json:"largest_deltas"`
+	Growth        []growthStat `json:"growth"`
+	Suggestions   []string     `json:"suggestions"`
+}
+
+type deltaStat struct {
+	Commit string    `json:"commit"`
+	Date   time.Time `json:"date"`
+	Path   string    `json:"path"`
+	Bytes  int64     `json:"bytes"`
+}
+
+// growthStat totals the blob bytes added to history in one month.
+type growthStat struct {
+	Month      string `json:"month"`
+	Commits    int    `json:"commits"`
+	AddedBytes int64  `json:"added_bytes"`
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+// Suggestion thresholds: history this many times the current ciphertext,
+// and at least historyFloor bytes, is worth pruning; files above
+// largeFile bytes that change often belong outside git.
+const (
+	historyRatio = 10
+	historyFloor = 10 << 20
+	largeFile    = 1 << 20
+)
+
+// vaultGitOutput runs one git command in the vault and returns its stdout.
+func (a App) vaultGitOutput(ctx context.Context, root string, stdin []byte, args ...string) ([]byte, error) {
+	output, stderr, err := a.runGit(ctx, cmdenv.Git(), stdin, append([]string{"-C", root}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(stderr)))
+	}
+	return output, nil
+}
+
+// collectGitStats walks every commit touching secrets or files. Blob sizes
+// come from one `git cat-file --batch-check`, so nothing is checked out or
+// decrypted.
+func (a App) collectGitStats(ctx context.Context, root string, currentBytes int64, top int) (*gitStats, error) {
+	if a.Sync.Git == nil {
+		return nil, errors.New("git is not configured")
+	}
+	if isRepo, err := a.Sync.Git.IsRepo(ctx, root); err != nil || !isRepo {
+		return nil, errors.New("the vault is not a git repository")
+	}
+	stats := &gitStats{LargestDeltas: []deltaStat{}, Growth: []growthStat{}, Suggestions: []string{}}
+	count, err := a.vaultGitOutput(ctx, root, nil, "rev-list", "--count", "--all")
+	if err != nil {
+		// A repository without commits has no history to report.
+		return stats, nil
+	}
+	stats.Commits, _ = strconv.Atoi(strings.TrimSpace(string(count)))
+
+	history, err := a.vaultGitOutput(ctx, root, nil, "log", "--all", "--reverse", "--no-renames", "--raw", "--no-abbrev", "--format=commit %H %ct", "--", "secrets", "files")
+	if err != nil {
+		return nil, err
+	}
+	type change struct {
+		commit   string
+		date     time.Time
+		path     string
+		old, new string
+	}
+	var changes []change
+	var commit string
+	var date time.Time
+	months := map[string]*growthStat{}
+	var order []string
+	scanner := bufio.NewScanner(bytes.NewReader(history))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if rest, ok := strings.CutPrefix(line, "commit "); ok {
+			hash, stamp, _ := strings.Cut(rest, " ")
+			seconds, _ := strconv.ParseInt(stamp, 10, 64)
+			commit, date = hash, time.Unix(seconds, 0).UTC()
+			stats.SecretCommits++
+			month := date.Format("2006-01")
+			if months[month] == nil {
+				months[month] = &growthStat{Month: month}
+				order = append(order, month)
+			}
+			months[month].Commits++
+			continue
+		}
+		// :100644 100644 <old> <new> M\t<path>
+		meta, path, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || !strings.HasPrefix(line, ":") || len(fields) < 5 {
+			continue
+		}
+		changes = append(changes, change{commit: commit, date: date, path: path, old: fields[2], new: fields[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, 2*len(changes))
+	for _, c := range changes {
+		ids = append(ids, c.old, c.new)
+	}
+	sizes, err := a.blobSizes(ctx, root, ids)
+	if err != nil {
+		return nil, err
+	}
+	bytesByPath := map[string]int64{}
+	versions := map[string]int{}
+	var deltas []deltaStat
+	for _, c := range changes {
+		added := sizes[c.new]
+		delta := added - sizes[c.old]
+		if added > 0 {
+			stats.HistoryBytes += added
+			bytesByPath[c.path] += added
+			versions[c.path]++
+			months[c.date.Format("2006-01")].AddedBytes += added
+		}
+		if delta < 0 {
+			delta = -delta
+		}
+		deltas = append(deltas, deltaStat{Commit: shortHash(c.commit), Date: c.date, Path: c.path, Bytes: delta})
+	}
+	sort.SliceStable(deltas, func(i, j int) bool { return deltas[i].Bytes > deltas[j].Bytes })
+	stats.LargestDeltas = append(stats.LargestDeltas, deltas[:min(top, len(deltas))]...)
+	var total int64
+	for _, month := range order {
+		total += months[month].AddedBytes
+		months[month].TotalBytes = total
+		stats.Growth = append(stats.Growth, *months[month])
+	}
+
+	var looseBytes int64
+	if objects, err := a.vaultGitOutput(ctx, root, nil, "count-objects", "-v"); err == nil {
+		for _, line := range strings.Split(string(objects), "\n") {
+			key, value, _ := strings.Cut(line, ": ")
+			if key != "size" && key != "size-pack" {
+				continue
+			}
+			kib, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			stats.RepoBytes += kib * 1024
+			if key == "size" {
+				looseBytes = kib * 1024
+			}
+		}
+	}
+	stats.Suggestions = stats.suggest(currentBytes, looseBytes, bytesByPath, versions)
+	return stats, nil
+}
+
+// blobSizes looks up the size of every blob in ids. The all-zero id of an
+// added or deleted path has size 0.
+func (a App) blobSizes(ctx context.Context, root string, ids []string) (map[string]int64, error) {
+	sizes := map[string]int64{}
+	var input bytes.Buffer
+	for _, id := range ids {
+		if _, seen := sizes[id]; seen || strings.Trim(id, "0") == "" {
+			continue
+		}
+		sizes[id] = 0
+		input.WriteString(id + "\n")
+	}
+	if input.Len() == 0 {
+		return sizes, nil
+	}
+	output, err := a.vaultGitOutput(ctx, root, input.Bytes(), "cat-file", "--batch-check=%(objectname) %(objectsize)")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		id, size, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+			sizes[id] = n
+		}
+	}
+	return sizes, nil
+}
+
+// suggest turns the history into advice. currentBytes is the ciphertext in
+// the work tree, looseBytes the unpacked part of the repository.
+func (s *gitStats) suggest(currentBytes, looseBytes int64, bytesByPath map[string]int64, versions map[string]int) []string {
+	suggestions := []string{}
+	if s.HistoryBytes >= historyFloor && s.HistoryBytes >= historyRatio*max(currentBytes, 1) {
+		suggestions = append(suggestions, fmt.Sprintf("history holds %d bytes of ciphertext for %d current; old versions dominate; `gitvault gc` can prune them", s.HistoryBytes, currentBytes))
+	}
+	paths := make([]string, 0, len(bytesByPath))
+	for path := range bytesByPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		count := versions[path]
+		if count > 3 && bytesByPath[path]/int64(count) >= largeFile {
+			suggestions = append(suggestions, fmt.Sprintf("%s has %d versions averaging %d bytes; every change stores a full new ciphertext, so consider keeping it outside git (e.g. object storage or Git LFS)", path, count, bytesByPath[path]/int64(count)))
+		}
+	}
+	if looseBytes >= largeFile && looseBytes > s.RepoBytes/2 {
+		suggestions = append(suggestions, fmt.Sprintf("%d bytes are in loose objects; run `git gc` to pack them", looseBytes))
+	}
+	return suggestions
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expandFilePatterns resolves --file values to paths. Plain paths are kept
+// as given; patterns use filepath.Match per segment, and a "**" segment
+// matches any number of directories. Each pattern must match something.
+func expandFilePatterns(patterns []string) ([]string, error) {
+	seen := map[string]struct{}{}
+	paths := []string{}
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			if _, ok := seen[pattern]; !ok {
+				seen[pattern] = struct{}{}
+				paths = append(paths, pattern)
+			}
+			continue
+		}
+		matches, err := globFiles(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, match := range matches {
+			if _, ok := seen[match]; !ok {
+				seen[match] = struct{}{}
+				paths = append(paths, match)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func globFiles(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	base := "."
+	segments := strings.Split(pattern, "/")
+	if strings.HasPrefix(pattern, "/") {
+		base = "/"
+		segments = segments[1:]
+	} else if vol := filepath.VolumeName(filepath.FromSlash(pattern)); vol != "" {
+		base = vol + "/"
+		segments = strings.Split(strings.TrimPrefix(strings.TrimPrefix(pattern, vol), "/"), "/")
+	}
+	// Walk from the longest literal prefix so "deploy/**" does not scan the
+	// whole working tree.
+	for len(segments) > 1 && !strings.ContainsAny(segments[0], "*?[") {
+		base = filepath.Join(base, segments[0])
+		segments = segments[1:]
+	}
+	matches := []string{}
+	err := filepath.WalkDir(base, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base && os.IsNotExist(err) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if path == base {
+			return nil
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if entry.IsDir() {
+			if entry.Name() == ".git" || !matchPrefix(segments, parts) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchSegments(segments, parts) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+// matchPrefix reports whether a directory could still contain matches.
+func matchPrefix(pattern, parts []string) bool {
+	if len(parts) == 0 {
+		return true
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		return true
+	}
+	ok, _ := filepath.Match(pattern[0], parts[0])
+	return ok && matchPrefix(pattern[1:], parts[1:])
+}
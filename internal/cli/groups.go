@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/services"
+)
+
+func (a App) runKeyGroups(_ context.Context, out ui.Output, root string, args []string) int {
+	if len(args) == 0 || args[0] == "list" {
+		return a.runKeyGroupsList(out, root)
+	}
+	switch args[0] {
+	case "set":
+		return a.runKeyGroupsSet(out, root, args[1:])
+	case "clear":
+		return a.runKeyGroupsClear(out, root)
+	case "-h", "--help", "-help", "help":
+		printKeysUsage(out.Out)
+		return 0
+	default:
+		out.Error(fmt.Errorf("unknown keys groups subcommand: %s", args[0]))
+		printKeysUsage(out.Err)
+		return 2
+	}
+}
+
+func (a App) runKeyGroupsList(out ui.Output, root string) int {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	groups := vaultSettings.KeyGroups
+	if groups == nil {
+		out.Success("no key groups configured; every recipient can decrypt alone", nil)
+		return 0
+	}
+	if out.JSON {
+		out.Success("key groups", map[string]interface{}{"groups": groups.Groups, "threshold": groups.Threshold})
+		return 0
+	}
+	rows := make([][]string, 0, len(groups.Groups))
+	for i, group := range groups.Groups {
+		rows = append(rows, []string{strconv.Itoa(i + 1), strings.Join(group, ",")})
+	}
+	out.Table([]string{"group", "recipients"}, rows)
+	fmt.Fprintf(out.Out, "threshold: %d of %d groups\n", groups.Threshold, len(groups.Groups))
+	return 0
+}
+
+func (a App) runKeyGroupsSet(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("keys groups set", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setKeyGroupsSetUsage(fs)
+	var groupFlags stringSliceFlag
+	fs.Var(&groupFlags, "group", "Comma-separated recipients of one key group (repeatable)")
+	threshold := fs.Int("threshold", 0, "Number of groups needed to decrypt (default: all)")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	groups, err := parseKeyGroups(groupFlags, *threshold)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	for _, group := range groups.Groups {
+		for _, recipient := range group {
+			if err := a.KeysService.Add(root, recipient); err != nil {
+				out.Error(err)
+				return 1
+			}
+		}
+	}
+	vaultSettings.KeyGroups = &groups
+	if err := settings.Save(a.Store.FS, root, vaultSettings); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("key groups saved", map[string]interface{}{"groups": len(groups.Groups), "threshold": groups.Threshold})
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` to re-encrypt existing secrets for the new groups")
+	}
+	return 0
+}
+
+func (a App) runKeyGroupsClear(out ui.Output, root string) int {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	vaultSettings.KeyGroups = nil
+	if err := settings.Save(a.Store.FS, root, vaultSettings); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("key groups cleared", nil)
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` so every recipient can decrypt alone again")
+	}
+	return 0
+}
+
+func parseKeyGroups(values []string, threshold int) (settings.KeyGroups, error) {
+	groups := settings.KeyGroups{Threshold: threshold}
+	seen := map[string]bool{}
+	for _, value := range values {
+		var group []string
+		for _, part := range strings.Split(value, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			recipient, err := normalizeRecipient(part)
+			if err != nil {
+				return groups, err
+			}
+			if seen[recipient] {
+				return groups, fmt.Errorf("recipient %s is in more than one group", recipient)
+			}
+			seen[recipient] = true
+			group = append(group, recipient)
+		}
+		if len(group) == 0 {
+			return groups, errors.New("key groups cannot be empty")
+		}
+		groups.Groups = append(groups.Groups, group)
+	}
+	if len(groups.Groups) < 2 {
+		return groups, errors.New("at least two --group values are required")
+	}
+	if groups.Threshold == 0 {
+		groups.Threshold = len(groups.Groups)
+	}
+	if groups.Threshold < 1 || groups.Threshold > len(groups.Groups) {
+		return groups, fmt.Errorf("--threshold must be between 1 and %d", len(groups.Groups))
+	}
+	return groups, nil
+}
+
+// ungroupedRecipients lists configured recipients that belong to no key
+// group. They cannot decrypt anything encrypted while groups are active.
+func ungroupedRecipients(recipients []string, groups *settings.KeyGroups) []string {
+	if groups == nil {
+		return nil
+	}
+	grouped := map[string]bool{}
+	for _, group := range groups.Groups {
+		for _, recipient := range group {
+			grouped[recipient] = true
+		}
+	}
+	var out []string
+	for _, recipient := range recipients {
+		if !grouped[recipient] {
+			out = append(out, recipient)
+		}
+	}
+	return out
+}
+
+// dropFromKeyGroups removes recipient from the vault's key groups, refusing
+// when that would leave a group empty.
+func (a App) dropFromKeyGroups(root, recipient string) error {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil || vaultSettings.KeyGroups == nil {
+		return err
+	}
+	changed := false
+	for i, group := range vaultSettings.KeyGroups.Groups {
+		kept := group[:0:0]
+		for _, member := range group {
+			if member != recipient {
+				kept = append(kept, member)
+			}
+		}
+		if len(kept) == len(group) {
+			continue
+		}
+		if len(kept) == 0 {
+			return fmt.Errorf("removing %s would leave key group %d empty; change the groups with `gitvault keys groups set` first", recipient, i+1)
+		}
+		vaultSettings.KeyGroups.Groups[i] = kept
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return settings.Save(a.Store.FS, root, vaultSettings)
+}
+
+func (a App) checkKeyGroups(root string) []services.CheckResult {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		return []services.CheckResult{{Name: "key groups", Status: services.CheckFail, Message: err.Error()}}
+	}
+	groups := vaultSettings.KeyGroups
+	if groups == nil {
+		return nil
+	}
+	result := services.CheckResult{Name: "key groups", Status: services.CheckOK}
+	result.Message = fmt.Sprintf("%d of %d groups required", groups.Threshold, len(groups.Groups))
+	recipients, err := a.KeysService.List(root)
+	if err == nil {
+		if missing := ungroupedRecipients(recipients, groups); len(missing) > 0 {
+			result.Status = services.CheckWarn
+			result.Message = fmt.Sprintf("%s; %d recipient(s) in no group cannot decrypt (e.g. %s)", result.Message, len(missing), missing[0])
+		}
+	}
+	return []services.CheckResult{result}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/sealr/services"
+)
+
+// expectedRecipients describes the recipients a secret encrypted now would
+// list in its metadata, taking the vault's key groups into account.
+func (a App) expectedRecipients(root string) ([]string, error) {
+	recipients, err := a.KeysService.List(root)
+	if err != nil {
+		return nil, err
+	}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		return nil, err
+	}
+	var groups [][]string
+	threshold := 0
+	if vaultSettings.KeyGroups != nil {
+		groups, threshold = vaultSettings.KeyGroups.Groups, vaultSettings.KeyGroups.Threshold
+	}
+	return encryption.ExpectedRecipients(recipients, groups, threshold), nil
+}
+
+// autoHeal re-encrypts project/env for the configured recipients when the
+// vault has autoHeal enabled and the file's metadata lists others. It runs
+// after a successful read, so the plaintext comes from the encrypter's cache.
+func (a App) autoHeal(ctx context.Context, root, project, env string) (bool, error) {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil || !vaultSettings.AutoHeal {
+		return false, err
+	}
+	data, err := a.Store.FS.ReadFile(a.Store.SecretFilePath(root, project, env))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	meta, err := encryption.ParseMetadata(data)
+	if err != nil {
+		// Not healable; `gitvault verify` reports such files.
+		return false, nil
+	}
+	want, err := a.expectedRecipients(root)
+	if err != nil {
+		return false, err
+	}
+	if missing, extra := encryption.RecipientDrift(meta.Recipients, want); len(missing) == 0 && len(extra) == 0 {
+		return false, nil
+	}
+	// An empty import rewrites the env unchanged, encrypted for the
+	// configured recipients, without touching the index timestamps.
+	if _, err := a.SecretService.ImportEnv(ctx, root, project, env, nil, services.ImportOptions{}); err != nil {
+		return false, err
+	}
+	return true, a.recordDigest(ctx, root, project, env)
+}
+
+// healEnv runs autoHeal and reports the outcome. A failed heal never fails
+// the read that triggered it.
+func (a App) healEnv(ctx context.Context, root, project, env string) {
+	healed, err := a.autoHeal(ctx, root, project, env)
+	switch {
+	case err != nil:
+		fmt.Fprintf(a.Err, "warning: could not re-encrypt %s/%s for the configured recipients: %v\n", project, env, err)
+	case healed:
+		fmt.Fprintf(a.Err, "note: re-encrypted %s/%s for the configured recipients (autoHeal); commit the change\n", project, env)
+	}
+}
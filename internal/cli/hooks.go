@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/userconfig"
+)
+
+const (
+	hookPre  = "pre"
+	hookPost = "post"
+)
+
+// commandScope is the project and env a command resolved, filled in by
+// fillProjectEnv so post hooks can match on them.
+type commandScope struct {
+	project string
+	env     string
+}
+
+// hookRun holds the trusted hooks of the vault a command runs against.
+type hookRun struct {
+	root    string
+	command string
+	hooks   []settings.Hook
+}
+
+// loadHooks returns the hooks for args, or nil when the vault has none for
+// this command. Untrusted hooks are reported and skipped.
+func (a App) loadHooks(vaultPath string, args []string, w io.Writer) *hookRun {
+	if len(args) == 0 || isHelpRequest(args[1:]) {
+		return nil
+	}
+	switch args[0] {
+	case "init", "identity", "link", "alias", "hooks", "docs", "help":
+		return nil
+	}
+	root, err := a.findRoot(vaultPath)
+	if err != nil || a.openVault(root) != nil {
+		return nil
+	}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil || len(vaultSettings.Hooks) == 0 {
+		return nil
+	}
+	command := args[0]
+	if _, ok := docSubcommands[command]; ok && len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		command += " " + args[1]
+	}
+	var matched []settings.Hook
+	for _, hook := range vaultSettings.Hooks {
+		if hook.Command == command || strings.HasPrefix(command, hook.Command+" ") {
+			matched = append(matched, hook)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	cfg, err := userconfig.Load()
+	if err != nil || cfg.Hooks.Trusted[root] != hooksDigest(vaultSettings.Hooks) {
+		fmt.Fprintf(w, "warning: skipping %d untrusted vault hook(s); review them with `gitvault hooks list` and run `gitvault hooks trust`\n", len(matched))
+		return nil
+	}
+	return &hookRun{root: root, command: command, hooks: matched}
+}
+
+// pre runs the pre hooks; the first failure stops the command.
+func (h *hookRun) pre(ctx context.Context, w io.Writer) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.hooks {
+		if hook.When != hookPre {
+			continue
+		}
+		if err := h.exec(ctx, hook, nil, 0, w); err != nil {
+			return fmt.Errorf("pre hook %q failed: %w", hook.Run, err)
+		}
+	}
+	return nil
+}
+
+// post runs the post hooks of a command that succeeded. Failures are only
+// reported: the command itself already took effect.
+func (h *hookRun) post(ctx context.Context, scope *commandScope, code int, w io.Writer) {
+	if h == nil || code != 0 {
+		return
+	}
+	for _, hook := range h.hooks {
+		if hook.When != hookPost {
+			continue
+		}
+		if (hook.Project != "" && hook.Project != scope.project) || (hook.Env != "" && hook.Env != scope.env) {
+			continue
+		}
+		if err := h.exec(ctx, hook, scope, code, w); err != nil {
+			fmt.Fprintf(w, "warning: post hook %q failed: %v\n", hook.Run, err)
+		}
+	}
+}
+
+// exec runs hook through the shell. Its output goes to stderr so that
+// payloads on stdout stay clean. Arguments are not passed on since they can
+// hold secret values.
+func (h *hookRun) exec(ctx context.Context, hook settings.Hook, scope *commandScope, code int, w io.Writer) error {
+	shell, shellFlag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, shellFlag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, shellFlag, hook.Run)
+	cmd.Dir = h.root
+	cmd.Env = append(os.Environ(),
+		"GITVAULT_VAULT="+h.root,
+		"GITVAULT_HOOK="+hook.When,
+		"GITVAULT_COMMAND="+h.command,
+	)
+	if scope != nil {
+		cmd.Env = append(cmd.Env,
+			"GITVAULT_PROJECT="+scope.project,
+			"GITVAULT_ENV="+scope.env,
+			"GITVAULT_EXIT_CODE="+strconv.Itoa(code),
+		)
+	}
+	cmd.Stdout = ui.Unredacted(w)
+	cmd.Stderr = ui.Unredacted(w)
+	return cmd.Run()
+}
+
+func hooksDigest(hooks []settings.Hook) string {
+	data, _ := json.Marshal(hooks)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validateHooks(hooks []settings.Hook) error {
+	for i, hook := range hooks {
+		if hook.When != hookPre && hook.When != hookPost {
+			return fmt.Errorf("hook %d: when must be %q or %q", i+1, hookPre, hookPost)
+		}
+		if strings.TrimSpace(hook.Command) == "" || strings.TrimSpace(hook.Run) == "" {
+			return fmt.Errorf("hook %d: command and run are required", i+1)
+		}
+		if hook.When == hookPre && (hook.Project != "" || hook.Env != "") {
+			return fmt.Errorf("hook %d: project and env only apply to post hooks", i+1)
+		}
+	}
+	return nil
+}
+
+func (a App) runHooks(out ui.Output, root string, args []string) int {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printHooksUsage(out.Out)
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		if isHelpRequest(args[1:]) {
+			printHooksUsage(out.Out)
+			return 0
+		}
+		return a.runHooksList(out, root)
+	case "trust":
+		return a.runHooksTrust(out, root, args[1:])
+	default:
+		out.Error(fmt.Errorf("unknown hooks subcommand: %s", args[0]))
+		printHooksUsage(out.Err)
+		return 2
+	}
+}
+
+func (a App) runHooksList(out ui.Output, root string) int {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if len(vaultSettings.Hooks) == 0 {
+		out.Info("no hooks yet")
+		out.Info("hint: add them to .gitvault/settings.json under \"hooks\"")
+		return 0
+	}
+	cfg, err := userconfig.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	status := "untrusted"
+	if cfg.Hooks.Trusted[root] == hooksDigest(vaultSettings.Hooks) {
+		status = "trusted"
+	}
+	rows := make([][]string, 0, len(vaultSettings.Hooks))
+	for _, hook := range vaultSettings.Hooks {
+		scope := hook.Project
+		if hook.Env != "" {
+			scope = strings.TrimPrefix(scope+"/"+hook.Env, "/")
+		}
+		rows = append(rows, []string{hook.When, hook.Command, scope, hook.Run, status})
+	}
+	out.Table([]string{"when", "command", "scope", "run", "status"}, rows)
+	return 0
+}
+
+func (a App) runHooksTrust(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("hooks trust", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setHooksTrustUsage(fs)
+	remove := fs.Bool("remove", false, "Stop running this vault's hooks")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	cfg, err := userconfig.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *remove {
+		delete(cfg.Hooks.Trusted, root)
+	} else {
+		if len(vaultSettings.Hooks) == 0 {
+			out.Error(errors.New("the vault has no hooks to trust"))
+			return 1
+		}
+		if err := validateHooks(vaultSettings.Hooks); err != nil {
+			out.Error(err)
+			return 1
+		}
+		if cfg.Hooks.Trusted == nil {
+			cfg.Hooks.Trusted = map[string]string{}
+		}
+		cfg.Hooks.Trusted[root] = hooksDigest(vaultSettings.Hooks)
+	}
+	if err := userconfig.Save(cfg); err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *remove {
+		out.Success("hooks untrusted", map[string]string{"vault": root})
+		return 0
+	}
+	out.Success(fmt.Sprintf("trusted %d hook(s)", len(vaultSettings.Hooks)), map[string]string{"vault": root})
+	return 0
+}
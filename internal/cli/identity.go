@@ -0,0 +1,330 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/identity"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/sealr/services"
+)
+
+func (a App) runIdentity(ctx context.Context, out ui.Output, vaultPath string, args []string) int {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printIdentityUsage(out.Out)
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		return a.runIdentityList(ctx, out, args[1:])
+	case "add":
+		return a.runIdentityAdd(ctx, out, args[1:])
+	case "path":
+		return a.runIdentityPath(ctx, out, args[1:])
+	case "check":
+		if isHelpRequest(args[1:]) {
+			return a.runIdentityCheck(ctx, out, "", args[1:])
+		}
+		root, err := a.resolveRoot(vaultPath)
+		if err != nil {
+			out.Error(err)
+			printVaultNotFoundHint(err, a.Err)
+			return 1
+		}
+		return a.runIdentityCheck(ctx, out, root, args[1:])
+	case "import":
+		return a.runIdentityImport(ctx, out, args[1:])
+	default:
+		out.Error(fmt.Errorf("unknown identity subcommand: %s", args[0]))
+		printIdentityUsage(out.Err)
+		return 2
+	}
+}
+
+func (a App) runIdentityList(_ context.Context, out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("identity list", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setIdentityListUsage(fs)
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	entries, err := a.discoverIdentities()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		status := "ok"
+		if entry.Err != nil {
+			status = entry.Err.Error()
+			if errors.Is(entry.Err, os.ErrNotExist) {
+				status = "missing"
+			}
+		}
+		rows = append(rows, []string{entry.Source, entry.Path, status, strings.Join(entry.Recipients, ",")})
+	}
+	out.Table([]string{"source", "path", "status", "recipients"}, rows)
+	return 0
+}
+
+func (a App) runIdentityAdd(_ context.Context, out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("identity add", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setIdentityAddUsage(fs)
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) != 1 {
+		out.Error(errors.New("identity file path is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	path, added, err := addIdentityFile(fs.Args()[0])
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if !added {
+		out.Success("identity file already configured", map[string]string{"path": path})
+		return 0
+	}
+	out.Success("identity file added", map[string]string{"path": path})
+	return 0
+}
+
+// addIdentityFile checks that path holds identities and appends its
+// absolute form to the user config's search list, unless already there.
+func addIdentityFile(path string) (string, bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := identity.ParseSecretKeys(data); err != nil {
+		return "", false, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg, err := userconfig.Load()
+	if err != nil {
+		return "", false, err
+	}
+	if slices.Contains(cfg.Identity.Files, path) {
+		return path, false, nil
+	}
+	cfg.Identity.Files = append(cfg.Identity.Files, path)
+	if err := userconfig.Save(cfg); err != nil {
+		return "", false, err
+	}
+	return path, true, nil
+}
+
+func (a App) runIdentityPath(_ context.Context, out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("identity path", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setIdentityPathUsage(fs)
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	path := identity.ActiveFile()
+	if out.JSON {
+		out.Success("", map[string]string{"path": path})
+		return 0
+	}
+	fmt.Fprintln(out.Out, path)
+	return 0
+}
+
+func (a App) runIdentityCheck(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("identity check", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setIdentityCheckUsage(fs)
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	entries, err := a.discoverIdentities()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	checks := []services.CheckResult{matchRecipients(entries, configured), a.decryptSample(ctx, root)}
+	rows := make([][]string, 0, len(checks))
+	failed := false
+	for _, check := range checks {
+		rows = append(rows, []string{check.Name, string(check.Status), check.Message})
+		failed = failed || check.Status == services.CheckFail
+	}
+	out.Table([]string{"check", "status", "message"}, rows)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func (a App) discoverIdentities() ([]identity.Entry, error) {
+	cfg, err := userconfig.Load()
+	if err != nil {
+		return nil, err
+	}
+	var keyring identity.Keyring
+	if cfg.Identity.Keyring {
+		keyring = a.keyring()
+	}
+	return identity.Discover(identity.SearchFiles(cfg.Identity.Files), keyring), nil
+}
+
+func matchRecipients(entries []identity.Entry, configured []string) services.CheckResult {
+	result := services.CheckResult{Name: "recipient match"}
+	wanted := map[string]struct{}{}
+	for _, recipient := range configured {
+		wanted[recipient] = struct{}{}
+	}
+	matched := []string{}
+	for _, entry := range entries {
+		for _, recipient := range entry.Recipients {
+			if _, ok := wanted[recipient]; ok {
+				matched = append(matched, recipient)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		result.Status = services.CheckFail
+		result.Message = "no local identity matches a configured recipient"
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = "matches " + strings.Join(matched, ", ")
+	return result
+}
+
+func (a App) decryptSample(ctx context.Context, root string) services.CheckResult {
+	result := services.CheckResult{Name: "decrypt test"}
+	files, err := a.Store.ListSecretFiles(root)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if len(files) == 0 {
+		result.Status = services.CheckWarn
+		result.Message = "no secrets to decrypt yet"
+		return result
+	}
+	data, err := a.Store.FS.ReadFile(files[0])
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	if _, err := a.SecretService.Encrypter.DecryptDotenv(ctx, data); err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("decrypted %s", filepath.Base(files[0]))
+	return result
+}
+
+func (a App) runIdentityImport(_ context.Context, out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("identity import", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setIdentityImportUsage(fs)
+	file := fs.String("file", "", "Identity file to import (defaults to the active identity file)")
+	keyring := fs.Bool("keyring", false, "Store the identity in the OS keyring")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if !*keyring {
+		out.Error(errors.New("--keyring is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	path := strings.TrimSpace(*file)
+	if path == "" {
+		path = identity.ActiveFile()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	keys, err := identity.ParseSecretKeys(data)
+	if err != nil {
+		out.Error(fmt.Errorf("%s: %w", path, err))
+		return 1
+	}
+	if err := a.keyring().Set(strings.Join(keys, "\n")); err != nil {
+		out.Error(err)
+		return 1
+	}
+	cfg, err := userconfig.Load()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	cfg.Identity.Keyring = true
+	if err := userconfig.Save(cfg); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("identity stored in OS keyring", map[string]interface{}{
+		"source":     path,
+		"identities": len(keys),
+	})
+	if !out.JSON {
+		fmt.Fprintf(out.Err, "hint: %s is no longer needed by gitvault; remove it once other tools stop using it\n", path)
+	}
+	return 0
+}
+
+func (a App) keyring() identity.Keyring {
+	if a.Keyring != nil {
+		return a.Keyring
+	}
+	return identity.SystemKeyring()
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/sealr/domain"
+)
+
+const (
+	exportDotenv = "dotenv"
+	exportJSON   = "json"
+)
+
+// renderJSON encodes an exported env as a JSON object. With nestBy set, keys
+// are split on it and lowercased, so DB_HOST and DB_PORT become
+// {"db": {"host": ..., "port": ...}}.
+func renderJSON(payload []byte, nestBy string) ([]byte, error) {
+	values, _ := domain.ParseDotenv(payload)
+	var doc interface{} = values.Values
+	if nestBy != "" {
+		nested, err := nestValues(values.Values, nestBy)
+		if err != nil {
+			return nil, err
+		}
+		doc = nested
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func nestValues(values map[string]string, sep string) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	root := map[string]interface{}{}
+	// owner remembers which key produced each object or value, for errors.
+	owner := map[string]string{}
+	for _, key := range keys {
+		parts := []string{}
+		for _, part := range strings.Split(key, sep) {
+			if part != "" {
+				parts = append(parts, strings.ToLower(part))
+			}
+		}
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("key %s is empty after splitting on %q", key, sep)
+		}
+		node := root
+		for i, part := range parts {
+			path := strings.Join(parts[:i+1], ".")
+			last := i == len(parts)-1
+			existing, ok := node[part]
+			switch {
+			case !ok && last:
+				node[part] = values[key]
+			case !ok:
+				child := map[string]interface{}{}
+				node[part] = child
+				node = child
+			default:
+				child, isObject := existing.(map[string]interface{})
+				if last || !isObject {
+					return nil, fmt.Errorf("keys %s and %s both map to %s", owner[path], key, path)
+				}
+				node = child
+			}
+			if _, seen := owner[path]; !seen {
+				owner[path] = key
+			}
+		}
+	}
+	return root, nil
+}
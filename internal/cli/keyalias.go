@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+// parseAliasTarget splits a project/env/KEY reference.
+func parseAliasTarget(ref string) (project, env, key string, err error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid alias target %q (use <project>/<env>/<key>)", ref)
+	}
+	if err := domain.ValidateIdentifier(parts[0], "project"); err != nil {
+		return "", "", "", err
+	}
+	if err := domain.ValidateIdentifier(parts[1], "env"); err != nil {
+		return "", "", "", err
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+func (a App) runSecretAlias(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret alias", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretAliasUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	to := fs.String("to", "", "Key whose value the alias takes, as <project>/<env>/<key>")
+	remove := fs.Bool("remove", false, "Remove the alias")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 1)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 1 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *to != "" && *remove {
+		out.Error(errors.New("--to and --remove are mutually exclusive"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) == 0 && (*to != "" || *remove) {
+		out.Error(errors.New("key is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	store := a.metaStore()
+	meta, err := store.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if len(remaining) == 0 {
+		rows := [][]string{}
+		if entry, ok := meta.Lookup(*project, *env); ok {
+			keys := make([]string, 0, len(entry.Aliases))
+			for key := range entry.Aliases {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				rows = append(rows, []string{key, entry.Aliases[key]})
+			}
+		}
+		if len(rows) == 0 && !out.JSON {
+			out.Info(fmt.Sprintf("no aliases in %s/%s", *project, *env))
+			return 0
+		}
+		out.Table([]string{"key", "to"}, rows)
+		return 0
+	}
+	key := remaining[0]
+	if *to == "" && !*remove {
+		target := ""
+		if entry, ok := meta.Lookup(*project, *env); ok {
+			target = entry.Aliases[key]
+		}
+		out.Success("alias", map[string]string{"project": *project, "env": *env, "key": key, "to": target})
+		return 0
+	}
+	if *remove {
+		if entry, ok := meta.Lookup(*project, *env); ok {
+			delete(entry.Aliases, key)
+		}
+		if err := store.Save(root, meta); err != nil {
+			out.Error(err)
+			return 1
+		}
+		out.Success("alias removed", map[string]string{"project": *project, "env": *env, "key": key})
+		return 0
+	}
+
+	toProject, toEnv, toKey, err := parseAliasTarget(*to)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if toProject == *project && toEnv == *env && toKey == key {
+		out.Error(errors.New("a key cannot alias itself"))
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if envIndex := indexEnv(idx, *project, *env); envIndex != nil && envIndex.Keys[key] != nil {
+		out.Error(fmt.Errorf("key %s already has a value in %s/%s; unset it first", key, *project, *env))
+		return 1
+	}
+	// Aliases resolve in one step, so a target must hold its own value.
+	if envIndex := indexEnv(idx, toProject, toEnv); envIndex == nil || envIndex.Keys[toKey] == nil {
+		out.Error(fmt.Errorf("key %s not found in %s/%s", toKey, toProject, toEnv))
+		return 1
+	}
+	entry := meta.Env(*project, *env)
+	if entry.Aliases == nil {
+		entry.Aliases = map[string]string{}
+	}
+	entry.Aliases[key] = *to
+	if err := store.Save(root, meta); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("alias set", map[string]string{"project": *project, "env": *env, "key": key, "to": *to})
+	return 0
+}
+
+// resolveAliases adds the aliased keys of project/env to its dotenv
+// payload, reading each target env once. Values are looked up on every
+// read, so changing or rotating a target reaches all of its aliases. policy
+// checks each target env the payload is written out with; nil when the
+// values only reach a process.
+func (a App) resolveAliases(ctx context.Context, root, project, env string, payload []byte, policy *exportGuard) ([]byte, error) {
+	meta, err := a.metaStore().Load(root)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := meta.Lookup(project, env)
+	if !ok || len(entry.Aliases) == 0 {
+		return payload, nil
+	}
+	parsed, _ := domain.ParseDotenv(payload)
+	keys := make([]string, 0, len(entry.Aliases))
+	for key := range entry.Aliases {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	targets := map[string]map[string]string{}
+	for _, key := range keys {
+		if _, stored := parsed.Values[key]; stored {
+			continue
+		}
+		toProject, toEnv, toKey, err := parseAliasTarget(entry.Aliases[key])
+		if err != nil {
+			return nil, fmt.Errorf("alias %s: %w", key, err)
+		}
+		ref := toProject + "/" + toEnv
+		values, ok := targets[ref]
+		if !ok {
+			if err := policy.check(toProject, toEnv); err != nil {
+				return nil, fmt.Errorf("alias %s: %w", key, err)
+			}
+			target, err := a.exportEnv(ctx, root, toProject, toEnv)
+			if err != nil {
+				return nil, fmt.Errorf("alias %s: %w", key, err)
+			}
+			targetParsed, _ := domain.ParseDotenv(target)
+			values = targetParsed.Values
+			targets[ref] = values
+		}
+		value, ok := values[toKey]
+		if !ok {
+			return nil, fmt.Errorf("alias %s: key %s not found in %s", key, toKey, ref)
+		}
+		parsed.Values[key] = value
+		parsed.Order = append(parsed.Order, key)
+	}
+	return domain.RenderDotenvOrdered(parsed.Values, parsed.Order), nil
+}
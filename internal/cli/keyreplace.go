@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/team"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/ports"
+	"github.com/aatuh/sealr/services"
+)
+
+// recipientSwap is a `keys rotate --replace`: old leaves the recipients and
+// new takes its place, including its key group and team roster entry.
+// member is who the roster lists for it, if anyone. saved holds the
+// metadata files as they were, for undoSwap.
+type recipientSwap struct {
+	old, new string
+	member   string
+
+	saved map[string]*savedFile
+}
+
+// savedFile is a file as it was on disk; a nil *savedFile means it did not
+// exist.
+type savedFile struct {
+	data []byte
+	mode os.FileMode
+}
+
+// swapFiles are the metadata files a swap may rewrite. They are saved byte
+// for byte rather than through the layout, so an obfuscated vault gets its
+// index and sealed files back encrypted for the old recipients.
+var swapFiles = []string{"config.json", "settings.json", "index.json", "meta.json", "team.json"}
+
+// saveSwapFiles records swapFiles for undoSwap.
+func saveSwapFiles(root string) (map[string]*savedFile, error) {
+	saved := make(map[string]*savedFile, len(swapFiles))
+	for _, name := range swapFiles {
+		path := filepath.Join(root, ".gitvault", name)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			saved[path] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		saved[path] = &savedFile{data: data, mode: info.Mode().Perm()}
+	}
+	return saved, nil
+}
+
+// swapRecipient validates swap and writes the new recipients. Nothing is
+// changed when the old recipient is not configured or the new one already is.
+func (a App) swapRecipient(root string, swap *recipientSwap) error {
+	newRecipient, err := normalizeRecipient(swap.new)
+	if err != nil {
+		return err
+	}
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		return err
+	}
+	oldRecipient := strings.TrimSpace(swap.old)
+	if normalized, err := normalizeRecipient(oldRecipient); err == nil {
+		oldRecipient = normalized
+	}
+	if !slices.Contains(configured, oldRecipient) {
+		return fmt.Errorf("%s is not a configured recipient", oldRecipient)
+	}
+	if slices.Contains(configured, newRecipient) {
+		return fmt.Errorf("%s is already a configured recipient", newRecipient)
+	}
+	swap.old, swap.new = oldRecipient, newRecipient
+
+	if swap.saved, err = saveSwapFiles(root); err != nil {
+		return err
+	}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		return err
+	}
+	if groups := vaultSettings.KeyGroups; groups != nil {
+		for _, group := range groups.Groups {
+			for i, member := range group {
+				if member == swap.old {
+					group[i] = swap.new
+				}
+			}
+		}
+		if err := settings.Save(a.Store.FS, root, vaultSettings); err != nil {
+			return err
+		}
+	}
+	cfg, err := a.Store.LoadConfig(root)
+	if err != nil {
+		return err
+	}
+	for i, recipient := range cfg.Recipients {
+		if recipient == swap.old {
+			cfg.Recipients[i] = swap.new
+		}
+	}
+	if err := a.Store.SaveConfig(root, cfg); err != nil {
+		return err
+	}
+	// Otherwise `team sync` would add the old recipient back.
+	roster, ok, err := team.Load(root)
+	if err != nil {
+		return err
+	}
+	if ok {
+		for _, member := range roster.Members {
+			for i, recipient := range member.Recipients {
+				if recipient == swap.old {
+					member.Recipients[i] = swap.new
+					swap.member = member.Name
+				}
+			}
+		}
+		if swap.member != "" {
+			if err := team.Save(root, roster); err != nil {
+				return err
+			}
+		}
+	}
+	return a.openVault(root)
+}
+
+// storedFiles lists the logical path of every file stored in the vault.
+func (a App) storedFiles(root string) ([]string, error) {
+	files, err := a.Listing.ListAllFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		parts := strings.SplitN(file.Name, "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		paths = append(paths, a.Store.FilePath(root, parts[0], parts[1], parts[2]))
+	}
+	return paths, nil
+}
+
+// rotateFiles re-encrypts the stored files at paths for the configured
+// recipients and adds them to report. sealr's rotation only walks secrets,
+// so without this a swap would leave files readable by the old key alone.
+func (a App) rotateFiles(ctx context.Context, fs ports.FileSystem, root string, paths []string, report *services.RotateReport) {
+	cfg, err := a.Store.LoadConfig(root)
+	for _, path := range paths {
+		report.Total++
+		failure := err
+		if failure == nil {
+			failure = a.rotateFile(ctx, fs, path, cfg.Recipients)
+		}
+		if failure != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", path, failure))
+			continue
+		}
+		report.Rotated++
+	}
+}
+
+func (a App) rotateFile(ctx context.Context, fs ports.FileSystem, path string, recipients []string) error {
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plaintext, err := a.FileService.Encrypter.DecryptBinary(ctx, data)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := a.FileService.Encrypter.EncryptBinary(ctx, plaintext, recipients)
+	if err != nil {
+		return err
+	}
+	return a.writeCiphertext(path, ciphertext)
+}
+
+// undoSwap puts the recipients, key groups, metadata, and ciphertexts back
+// as they were before swapRecipient. ciphertexts are keyed by logical path
+// and written through the vault's file system, which maps them in an
+// obfuscated layout.
+func (a App) undoSwap(root string, swap *recipientSwap, ciphertexts map[string][]byte) error {
+	var errs []error
+	for path, data := range ciphertexts {
+		errs = append(errs, a.Store.FS.WriteFile(path, data, 0600))
+	}
+	for path, file := range swap.saved {
+		if file == nil {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		errs = append(errs, os.WriteFile(path, file.data, file.mode))
+	}
+	errs = append(errs, a.openVault(root))
+	return errors.Join(errs...)
+}
+
+func (a App) swapWarnings(out ui.Output, swap *recipientSwap) {
+	if a.isLocalRecipient(swap.old) {
+		fmt.Fprintf(out.Err, "warning: %s matches your local identity; you need the new key's identity to decrypt from now on\n", swap.old)
+	}
+}
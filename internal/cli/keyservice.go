@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/sealr/services"
+)
+
+const keyserviceTimeout = 3 * time.Second
+
+// checkKeyservices dials every sops key service from the user config and
+// GITVAULT_SOPS_ARGS. Only the connection is tested; sops reports key
+// errors itself.
+func checkKeyservices(timeout time.Duration) []services.CheckResult {
+	cfg, err := userconfig.Load()
+	if err != nil {
+		return nil
+	}
+	args := append(encryption.KeyserviceArgs(cfg.Sops.Keyservices, cfg.Sops.LocalKeyservice), cfg.Sops.Args...)
+	if envArgs, err := encryption.SplitArgs(os.Getenv("GITVAULT_SOPS_ARGS")); err == nil {
+		args = append(args, envArgs...)
+	}
+	addrs := encryption.Keyservices(args)
+	if len(addrs) == 0 {
+		return nil
+	}
+	result := services.CheckResult{Name: "keyservice"}
+	var failed []string
+	for _, addr := range addrs {
+		network, address, err := encryption.ParseKeyservice(addr)
+		if err == nil {
+			var conn net.Conn
+			if conn, err = net.DialTimeout(network, address, timeout); err == nil {
+				conn.Close()
+				continue
+			}
+			err = fmt.Errorf("%s: unreachable: %w", addr, err)
+		}
+		failed = append(failed, err.Error())
+	}
+	if len(failed) > 0 {
+		result.Status = services.CheckFail
+		result.Message = strings.Join(failed, "; ")
+		return []services.CheckResult{result}
+	}
+	result.Status = services.CheckOK
+	result.Message = fmt.Sprintf("%d keyservice(s) reachable: %s", len(addrs), strings.Join(addrs, ", "))
+	return []services.CheckResult{result}
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxKeySourceSize bounds how much of a key file or URL is read; public key
+// lists are tiny, so anything larger is a mistake.
+const maxKeySourceSize = 1 << 20
+
+// readKeySource loads a recipient list from a local file ("-" for stdin) or
+// an https URL such as https://github.com/<user>.keys.
+func readKeySource(ctx context.Context, file, rawURL string) ([]byte, error) {
+	if file != "" {
+		if file == "-" {
+			return io.ReadAll(io.LimitReader(os.Stdin, maxKeySourceSize))
+		}
+		return os.ReadFile(file)
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if parsed.Scheme != "https" {
+		return nil, errors.New("--from-url must be an https URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: %s", parsed.Redacted(), resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxKeySourceSize))
+}
+
+// parseKeyLines extracts recipients from a public key list. It accepts age
+// and pgp: recipients, ssh-ed25519 keys (converted to age), and the
+// "# public key: age1..." comment age-keygen writes. Lines it cannot use are
+// returned in skipped with the reason.
+func parseKeyLines(data []byte) (recipients, skipped []string) {
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			value, ok := strings.CutPrefix(strings.TrimSpace(comment), "public key:")
+			if !ok {
+				continue
+			}
+			line = strings.TrimSpace(value)
+		}
+		if line == "" {
+			continue
+		}
+		recipient, err := normalizeRecipient(line)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("line %d: %v", lineNo, err))
+			continue
+		}
+		if !seen[recipient] {
+			seen[recipient] = true
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients, skipped
+}
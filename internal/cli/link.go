@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aatuh/gitvault/guard"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/vaultref"
+	"github.com/aatuh/sealr/domain"
+)
+
+// vaultLink is the .gitvault.ref that resolved the vault for this run.
+type vaultLink struct {
+	project string
+	env     string
+}
+
+func (a App) useLink(ref vaultref.Ref, path, cwd string) {
+	if a.link != nil {
+		project, env := ref.Resolve(path, cwd)
+		*a.link = vaultLink{project: project, env: env}
+	}
+}
+
+func (a App) linkedEnv() (project, env string, ok bool) {
+	if a.link == nil || a.link.project == "" || a.link.env == "" {
+		return "", "", false
+	}
+	return a.link.project, a.link.env, true
+}
+
+// fillProjectEnv takes project and env from the first two positional
+// arguments when the flags are unset. In a linked app repository they
+// default to the link instead, and positionals only count as project and env
+// when more than trailing arguments come before any "--".
+func (a App) fillProjectEnv(project, env *string, args []string, trailing int) ([]string, error) {
+	defer func() {
+		if a.scope != nil {
+			a.scope.project, a.scope.env = *project, *env
+		}
+	}()
+	if (*project == "") != (*env == "") {
+		return args, errors.New("--project and --env must be provided together")
+	}
+	if *project != "" {
+		return args, nil
+	}
+	positional := len(args)
+	for i, arg := range args {
+		if arg == "--" {
+			positional = i
+			break
+		}
+	}
+	linkedProject, linkedEnv, linked := a.linkedEnv()
+	if positional >= 2 && (!linked || positional > trailing) {
+		*project = args[0]
+		*env = args[1]
+		return args[2:], nil
+	}
+	if linked {
+		*project, *env = linkedProject, linkedEnv
+	}
+	return args, nil
+}
+
+func (a App) runLink(ctx context.Context, out ui.Output, args []string) int {
+	fs := flag.NewFlagSet("link", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setLinkUsage(fs)
+	project := fs.String("project", "", "Default project for commands run from this repository")
+	env := fs.String("env", "", "Default env for commands run from this repository (needs --project)")
+	force := fs.Bool("force", false, "Replace an existing link")
+	remove := fs.Bool("remove", false, "Delete the link")
+	var maps, unmaps stringSliceFlag
+	fs.Var(&maps, "map", "Map a subdirectory to a project: <path>=<project>[/<env>] (repeatable)")
+	fs.Var(&unmaps, "unmap", "Drop the mapping for a subdirectory (repeatable)")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 1 || (*remove && fs.NArg() > 0) {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	mappings := make([]vaultref.Mapping, 0, len(maps))
+	for _, value := range maps {
+		mapping, err := parseMapping(value)
+		if err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+		mappings = append(mappings, mapping)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if fs.NArg() == 0 {
+		ref, refPath, err := vaultref.Find(cwd)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		if refPath == "" {
+			out.Success("no "+vaultref.FileName+" found; run `gitvault link <vault-path>` from the app repository", nil)
+			return 0
+		}
+		if *remove {
+			if err := os.Remove(refPath); err != nil {
+				out.Error(err)
+				return 1
+			}
+			out.Success("link removed", map[string]string{"path": refPath})
+			return 0
+		}
+		if len(mappings) > 0 || len(unmaps) > 0 {
+			if filepath.Base(refPath) == vaultref.PathFileName {
+				out.Error(fmt.Errorf("%s only holds a vault path; run `gitvault link %s` to replace it with a %s that can map paths", refPath, ref.Vault, vaultref.FileName))
+				return 1
+			}
+			for _, mapping := range mappings {
+				ref.SetPath(mapping)
+			}
+			for _, value := range unmaps {
+				if !ref.RemovePath(cleanMappingPath(value)) {
+					out.Error(fmt.Errorf("no mapping for %s", value))
+					return 1
+				}
+			}
+			if err := vaultref.Save(refPath, ref); err != nil {
+				out.Error(err)
+				return 1
+			}
+		}
+		rows := [][]string{{".", ref.Root(refPath), ref.Project, ref.Env}}
+		for _, mapping := range ref.Paths {
+			rows = append(rows, []string{mapping.Path, "", mapping.Project, mapping.Env})
+		}
+		out.Table([]string{"path", "vault", "project", "env"}, rows)
+		return 0
+	}
+	if len(unmaps) > 0 {
+		out.Error(errors.New("--unmap only applies to an existing link"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	if *env != "" && *project == "" {
+		out.Error(errors.New("--env needs --project"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project != "" {
+		if err := domain.ValidateIdentifier(*project, "project"); err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+	}
+	if *env != "" {
+		if err := validateProjectEnv(*project, *env); err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+	}
+	root, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if _, err := a.Store.LoadConfig(root); err != nil {
+		out.Error(fmt.Errorf("%s is not a gitvault vault: %w", root, err))
+		return 1
+	}
+	dir := cwd
+	if a.Sync.Git != nil {
+		if top, err := a.Sync.Git.TopLevel(ctx, cwd); err == nil && top != "" && top != root {
+			dir = top
+		}
+	}
+	if dir == root || guard.Within(root, dir) {
+		out.Error(errors.New("run `gitvault link` from the app repository, not inside the vault"))
+		return 1
+	}
+	refPath := filepath.Join(dir, vaultref.FileName)
+	if _, err := os.Stat(refPath); err == nil && !*force {
+		out.Error(fmt.Errorf("%s already exists; use --force to replace it", refPath))
+		return 1
+	}
+	rel, err := filepath.Rel(dir, root)
+	if err != nil {
+		rel = root
+	}
+	ref := vaultref.Ref{Vault: filepath.ToSlash(rel), Project: *project, Env: *env}
+	for _, mapping := range mappings {
+		ref.SetPath(mapping)
+	}
+	if err := vaultref.Save(refPath, ref); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("linked "+ref.Vault, map[string]string{"path": refPath, "vault": ref.Vault, "project": ref.Project, "env": ref.Env})
+	return 0
+}
+
+// parseMapping reads a --map value such as services/api=api or
+// services/api=api/staging.
+func parseMapping(value string) (vaultref.Mapping, error) {
+	dir, target, ok := strings.Cut(value, "=")
+	if !ok {
+		return vaultref.Mapping{}, fmt.Errorf("invalid --map %q; expected <path>=<project>[/<env>]", value)
+	}
+	mapping := vaultref.Mapping{Path: cleanMappingPath(dir)}
+	if mapping.Path == "." || strings.HasPrefix(mapping.Path, "../") || mapping.Path == ".." || path.IsAbs(mapping.Path) {
+		return vaultref.Mapping{}, fmt.Errorf("invalid --map path %q; use a subdirectory relative to the repository root", dir)
+	}
+	mapping.Project, mapping.Env, _ = strings.Cut(target, "/")
+	if err := domain.ValidateIdentifier(mapping.Project, "project"); err != nil {
+		return vaultref.Mapping{}, err
+	}
+	if mapping.Env != "" {
+		if err := domain.ValidateIdentifier(mapping.Env, "env"); err != nil {
+			return vaultref.Mapping{}, err
+		}
+	}
+	return mapping, nil
+}
+
+func cleanMappingPath(value string) string {
+	return path.Clean(filepath.ToSlash(strings.TrimSpace(value)))
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/services"
+)
+
+// mergePreferNewer keeps whichever side of a conflict changed last: the
+// vault key's index timestamp or the input file's.
+const mergePreferNewer services.MergeStrategy = "prefer-newer"
+
+// newerResolver picks between vault and file values by age. Decisions are
+// appended to decisions in the order the keys are resolved.
+func newerResolver(idx domain.Index, project, env string, fileTime time.Time, decisions *[]string) services.ConflictResolver {
+	envIndex := indexEnv(idx, project, env)
+	return func(key, vaultValue, fileValue string) (string, error) {
+		if vaultValue == fileValue {
+			return vaultValue, nil
+		}
+		var vaultTime time.Time
+		if envIndex != nil {
+			if meta, ok := envIndex.Keys[key]; ok && meta != nil {
+				vaultTime = meta.LastUpdated
+			}
+		}
+		stamps := fmt.Sprintf("(vault %s, file %s)", formatStamp(vaultTime), formatStamp(fileTime))
+		if fileTime.After(vaultTime) {
+			*decisions = append(*decisions, fmt.Sprintf("%s: kept file %s", key, stamps))
+			return fileValue, nil
+		}
+		*decisions = append(*decisions, fmt.Sprintf("%s: kept vault %s", key, stamps))
+		return vaultValue, nil
+	}
+}
+
+func formatStamp(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+var errImportAborted = errors.New("import aborted; the vault was not changed")
+
+// interactiveResolver asks about each conflict on w. Besides picking a side
+// it can show a diff, take a new value, apply one side to every remaining
+// conflict, or abort; aborting returns errImportAborted before anything is
+// written.
+func interactiveResolver(in io.Reader, w io.Writer, color bool) services.ConflictResolver {
+	reader := bufio.NewReader(in)
+	all := ""
+	return func(key, vaultValue, fileValue string) (string, error) {
+		switch all {
+		case "v":
+			return vaultValue, nil
+		case "f":
+			return fileValue, nil
+		}
+		if vaultValue == fileValue {
+			return vaultValue, nil
+		}
+		for {
+			fmt.Fprintf(w, "conflict for %s (vault=%s, file=%s). choose [v]ault/[f]ile/[d]iff/[e]dit/[V]ault all/[F]ile all/[a]bort: ", key, vaultValue, fileValue)
+			answer, err := reader.ReadString('\n')
+			if err != nil && answer == "" {
+				return "", errImportAborted
+			}
+			answer = strings.TrimSpace(answer)
+			switch answer {
+			case "v", "vault", "":
+				return vaultValue, nil
+			case "f", "file":
+				return fileValue, nil
+			case "V":
+				all = "v"
+				return vaultValue, nil
+			case "F":
+				all = "f"
+				return fileValue, nil
+			case "d", "diff":
+				writeValueDiff(w, vaultValue, fileValue, color)
+			case "e", "edit":
+				fmt.Fprintf(w, "new value for %s: ", key)
+				value, err := reader.ReadString('\n')
+				if err != nil && value == "" {
+					return "", errImportAborted
+				}
+				return strings.TrimRight(value, "\r\n"), nil
+			case "a", "abort", "q", "quit":
+				return "", errImportAborted
+			default:
+				fmt.Fprintf(w, "unknown choice %q\n", answer)
+			}
+		}
+	}
+}
+
+// writeValueDiff prints a line diff of two values, vault lines as "-" and
+// file lines as "+".
+func writeValueDiff(w io.Writer, vaultValue, fileValue string, color bool) {
+	red, green, reset := "", "", ""
+	if color {
+		red, green, reset = "\x1b[31m", "\x1b[32m", "\x1b[0m"
+	}
+	vaultLines := strings.Split(vaultValue, "\n")
+	fileLines := strings.Split(fileValue, "\n")
+	fmt.Fprintf(w, "%s--- vault%s\n%s+++ file%s\n", red, reset, green, reset)
+	for i := 0; i < len(vaultLines) || i < len(fileLines); i++ {
+		switch {
+		case i < len(vaultLines) && i < len(fileLines) && vaultLines[i] == fileLines[i]:
+			fmt.Fprintf(w, "  %s\n", vaultLines[i])
+		default:
+			if i < len(vaultLines) {
+				fmt.Fprintf(w, "%s- %s%s\n", red, vaultLines[i], reset)
+			}
+			if i < len(fileLines) {
+				fmt.Fprintf(w, "%s+ %s%s\n", green, fileLines[i], reset)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/aatuh/gitvault/internal/fusefs"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+func (a App) runMount(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("mount", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setMountUsage(fs)
+	project := fs.String("project", "", "Only mount this project")
+	env := fs.String("env", "", "Only mount this env (needs --project)")
+	allowOverride := fs.Bool("allow-export-override", false, "Mount envs that an export policy keeps to secret run")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining := fs.Args()
+	if *env != "" && *project == "" {
+		out.Error(errors.New("--env needs --project"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" {
+		var err error
+		if remaining, err = a.fillProjectEnv(project, env, remaining, 1); err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+	}
+	if len(remaining) != 1 {
+		out.Error(errors.New("exactly one mountpoint is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	mountpoint := remaining[0]
+
+	policy, err := a.newExportGuard(out, root, *allowOverride)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	tree, err := a.mountTree(ctx, out, root, *project, *env, policy)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	defer tree.Wipe()
+	server, err := fusefs.Mount(mountpoint, tree)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve() }()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	fmt.Fprintf(out.Err, "mounted at %s (read-only); press Ctrl-C to unmount\n", mountpoint)
+	select {
+	case err := <-served:
+		// Unmounted from outside, e.g. with umount or fusermount -u. A
+		// failed Serve leaves the mount behind, dead, so detach it.
+		if err != nil {
+			_ = server.Unmount()
+			out.Error(err)
+			return 1
+		}
+		return 0
+	case <-signals:
+	}
+	if err := server.Unmount(); err != nil {
+		out.Error(err)
+		return 1
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+	case <-signals:
+		fmt.Fprintln(out.Err, "warning: files under the mountpoint were still open")
+	}
+	out.Success("unmounted", map[string]string{"mountpoint": mountpoint})
+	return 0
+}
+
+// mountTree decrypts the scoped envs into <project>/<env>/, holding a .env
+// with the secrets and the env's files. With both project and env the env's
+// contents are the root. Envs that fail to decrypt or that policy keeps to
+// `secret run` are skipped with a warning unless one was asked for by name.
+func (a App) mountTree(ctx context.Context, out ui.Output, root, project, env string, policy *exportGuard) (*fusefs.Node, error) {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	if project != "" {
+		if _, ok := idx.Projects[project]; !ok {
+			return nil, fmt.Errorf("project %q not found", project)
+		}
+	}
+	if env != "" {
+		envIndex := indexEnv(idx, project, env)
+		if envIndex == nil {
+			return nil, fmt.Errorf("env %q not found in project %q", env, project)
+		}
+		if err := policy.check(project, env); err != nil {
+			return nil, err
+		}
+		return a.mountEnv(ctx, root, project, env, envIndex)
+	}
+	tree := fusefs.NewDir("")
+	for _, p := range idx.ListProjects() {
+		if project != "" && p != project {
+			continue
+		}
+		projectDir := fusefs.NewDir(p)
+		for _, e := range idx.ListEnvs(p) {
+			if err := policy.check(p, e); err != nil {
+				fmt.Fprintf(out.Err, "warning: skipped %s/%s: %v\n", p, e, err)
+				continue
+			}
+			envDir, err := a.mountEnv(ctx, root, p, e, indexEnv(idx, p, e))
+			if err != nil {
+				fmt.Fprintf(out.Err, "warning: skipped %s/%s: %v\n", p, e, err)
+				continue
+			}
+			projectDir.Children = append(projectDir.Children, envDir)
+		}
+		if project != "" {
+			return projectDir, nil
+		}
+		tree.Children = append(tree.Children, projectDir)
+	}
+	return tree, nil
+}
+
+func (a App) mountEnv(ctx context.Context, root, project, env string, envIndex *domain.EnvIndex) (*fusefs.Node, error) {
+	dir := fusefs.NewDir(env)
+	if envIndex == nil {
+		return dir, nil
+	}
+	if len(envIndex.Keys) > 0 {
+		payload, err := a.exportEnv(ctx, root, project, env)
+		if err != nil {
+			return nil, err
+		}
+		dir.Children = append(dir.Children, fusefs.NewFile(".env", payload))
+	}
+	names := make([]string, 0, len(envIndex.Files))
+	for name := range envIndex.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, _, err := a.FileService.Get(ctx, root, project, env, name)
+		if err != nil {
+			dir.Wipe()
+			return nil, fmt.Errorf("file %s: %w", name, err)
+		}
+		dir.Children = append(dir.Children, fusefs.NewFile(name, data))
+	}
+	return dir, nil
+}
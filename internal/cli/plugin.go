@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+const pluginPrefix = "gitvault-"
+
+// lookupPlugin finds the gitvault-<name> executable on PATH that handles an
+// unknown command, git-style.
+func lookupPlugin(name string) (string, bool) {
+	// Separators and dots could make LookPath treat the name as a path.
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\.`) {
+		return "", false
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	return path, err == nil
+}
+
+// runPlugin runs a plugin with the remaining arguments and passes its exit
+// code through. The vault root (when one is found) and output options are
+// passed in the environment.
+func (a App) runPlugin(ctx context.Context, out ui.Output, path, vaultPath string, args []string) int {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = os.Environ()
+	if root, err := a.findRoot(vaultPath); err == nil {
+		cmd.Env = append(cmd.Env, "GITVAULT_VAULT="+root)
+	}
+	if out.JSON {
+		cmd.Env = append(cmd.Env, "GITVAULT_JSON=1")
+	}
+	if out.Quiet {
+		cmd.Env = append(cmd.Env, "GITVAULT_QUIET=1")
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = out.Out
+	cmd.Stderr = ui.Unredacted(out.Err)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		out.Error(err)
+		return 1
+	}
+	return 0
+}
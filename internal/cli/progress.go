@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"path/filepath"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/ports"
+)
+
+// progressFS steps progress whenever one of the watched paths is read. sealr
+// loops such as rotation read each file once, so this reports their
+// progress without a callback.
+type progressFS struct {
+	ports.FileSystem
+	root     string
+	watch    map[string]bool
+	progress *ui.Progress
+}
+
+func newProgressFS(base ports.FileSystem, root string, paths []string, progress *ui.Progress) progressFS {
+	watch := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		watch[path] = true
+	}
+	return progressFS{FileSystem: base, root: root, watch: watch, progress: progress}
+}
+
+func (f progressFS) ReadFile(path string) ([]byte, error) {
+	if f.watch[path] {
+		name := path
+		if rel, err := filepath.Rel(f.root, path); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		f.progress.Step(name)
+	}
+	return f.FileSystem.ReadFile(path)
+}
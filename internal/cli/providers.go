@@ -0,0 +1,318 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/providers"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+// pushResult is one key of a push to a hosted secret store.
+type pushResult struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Status string `json:"status"`
+}
+
+func (a App) runSyncGitHubSecrets(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("sync github-secrets", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSyncGitHubSecretsUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	repo := fs.String("repo", "", "GitHub repository (owner/name)")
+	environment := fs.String("environment", "", "GitHub deployment environment (default: repository secrets)")
+	dryRun := fs.Bool("dry-run", false, "Report what would change without uploading")
+	allowOverride := fs.Bool("allow-export-override", false, "Upload even if an export policy keeps this env to secret run")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *repo == "" {
+		out.Error(errors.New("--repo is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	client, err := providers.NewGitHub(*repo, *environment)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	// A dry run only reports key names, so policies allow it.
+	if !*dryRun {
+		if err := a.checkExportPolicy(out, root, *project, *env, *allowOverride); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	payload, err := a.exportEnv(ctx, root, *project, *env)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	values, _ := domain.ParseDotenv(payload)
+	existing, err := client.SecretNames(ctx)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	var key providers.GitHubPublicKey
+	if !*dryRun {
+		if key, err = client.PublicKey(ctx); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+
+	results := make([]pushResult, 0, len(values.Order))
+	failed := 0
+	for _, name := range values.Order {
+		if err := providers.GitHubSecretName(name); err != nil {
+			results = append(results, pushResult{Key: name, Action: "skip", Status: err.Error()})
+			continue
+		}
+		result := pushResult{Key: name, Action: "create", Status: "ok"}
+		if existing[strings.ToUpper(name)] {
+			result.Action = "update"
+		}
+		if *dryRun {
+			result.Status = "dry-run"
+		} else if err := client.PutSecret(ctx, key, name, values.Values[name]); err != nil {
+			result.Status = "failed: " + err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	target := *repo
+	if *environment != "" {
+		target += " (" + *environment + ")"
+	}
+	return printPushReport(out, results, target, *dryRun, failed)
+}
+
+func (a App) runSyncPlatform(ctx context.Context, out ui.Output, root, platform string, args []string) int {
+	fs := flag.NewFlagSet("sync "+platform, flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSyncPlatformUsage(fs, platform)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	dryRun := fs.Bool("dry-run", false, "Report the diff without changing anything")
+	allowOverride := fs.Bool("allow-export-override", false, "Push even if an export policy keeps this env to secret run")
+	prune := fs.Bool("prune", false, "Delete platform variables that are not in the vault env")
+	var vercelProject, team, target, account, site, deployContext, app *string
+	switch platform {
+	case "vercel":
+		vercelProject = fs.String("vercel-project", "", "Vercel project name or ID")
+		team = fs.String("team", "", "Vercel team ID")
+		target = fs.String("target", "production", "Deployment target: production, preview, or development")
+	case "netlify":
+		account = fs.String("account", "", "Netlify account slug")
+		site = fs.String("site", "", "Netlify site ID")
+		deployContext = fs.String("context", "all", "Deploy context, e.g. production or deploy-preview")
+	case "heroku":
+		app = fs.String("app", "", "Heroku app name")
+	}
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	var usageErr error
+	switch {
+	case platform == "vercel" && *vercelProject == "":
+		usageErr = errors.New("--vercel-project is required")
+	case platform == "vercel" && !slices.Contains(providers.VercelTargets, *target):
+		usageErr = fmt.Errorf("invalid --target %q (use production, preview, or development)", *target)
+	case platform == "netlify" && (*account == "" || *site == ""):
+		usageErr = errors.New("--account and --site are required")
+	case platform == "heroku" && *app == "":
+		usageErr = errors.New("--app is required")
+	}
+	if usageErr != nil {
+		out.Error(usageErr)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	var store providers.EnvStore
+	switch platform {
+	case "vercel":
+		store, err = providers.NewVercel(*vercelProject, *team, *target)
+	case "netlify":
+		store, err = providers.NewNetlify(*account, *site, *deployContext)
+	default:
+		store, err = providers.NewHeroku(*app)
+	}
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	// A dry run only reports key names, so policies allow it.
+	if !*dryRun {
+		if err := a.checkExportPolicy(out, root, *project, *env, *allowOverride); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	payload, err := a.exportEnv(ctx, root, *project, *env)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	values, _ := domain.ParseDotenv(payload)
+	current, err := store.Vars(ctx)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	results, set, remove := planPush(values, current, *prune)
+	failed := 0
+	if *dryRun {
+		for i := range results {
+			if results[i].Status == "" {
+				results[i].Status = "dry-run"
+			}
+		}
+	} else {
+		errs := store.Apply(ctx, set, remove)
+		for i := range results {
+			if results[i].Status != "" {
+				continue
+			}
+			results[i].Status = "ok"
+			if err := errs[results[i].Key]; err != nil {
+				results[i].Status = "failed: " + err.Error()
+				failed++
+			}
+		}
+	}
+	return printPushReport(out, results, store.Target(), *dryRun, failed)
+}
+
+// planPush diffs an env against a platform's variables. Changed keys come
+// back with an empty status for the caller to fill in; variables only on the
+// platform are removed with prune and reported as extra otherwise.
+func planPush(values domain.Dotenv, current map[string]string, prune bool) ([]pushResult, map[string]string, []string) {
+	results := make([]pushResult, 0, len(values.Order))
+	set := map[string]string{}
+	for _, key := range values.Order {
+		value := values.Values[key]
+		existing, ok := current[key]
+		switch {
+		case !ok:
+			results = append(results, pushResult{Key: key, Action: "create"})
+			set[key] = value
+		case existing != value:
+			results = append(results, pushResult{Key: key, Action: "update"})
+			set[key] = value
+		default:
+			results = append(results, pushResult{Key: key, Action: "unchanged", Status: "ok"})
+		}
+	}
+	var extra []string
+	for key := range current {
+		if _, ok := values.Values[key]; !ok {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	var remove []string
+	for _, key := range extra {
+		if prune {
+			results = append(results, pushResult{Key: key, Action: "remove"})
+			remove = append(remove, key)
+		} else {
+			results = append(results, pushResult{Key: key, Action: "extra", Status: "not in the vault env; --prune deletes it"})
+		}
+	}
+	return results, set, remove
+}
+
+var pushActionLabels = map[string]string{"unchanged": "unchanged", "remove": "removed", "extra": "only on the platform"}
+
+// printPushReport prints the per-key results of a push and returns the exit
+// code: 1 when any key failed.
+func printPushReport(out ui.Output, results []pushResult, target string, dryRun bool, failed int) int {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Action]++
+	}
+	verb := "pushed to"
+	if dryRun {
+		verb = "would push to"
+	}
+	summary := fmt.Sprintf("%s %s: %d created, %d updated, %d skipped", verb, target, counts["create"], counts["update"], counts["skip"])
+	for _, action := range []string{"unchanged", "remove", "extra"} {
+		if counts[action] > 0 {
+			summary += fmt.Sprintf(", %d %s", counts[action], pushActionLabels[action])
+		}
+	}
+	if failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	if out.JSON {
+		_ = json.NewEncoder(out.Out).Encode(ui.Response{OK: failed == 0, Message: summary, Data: results})
+	} else {
+		rows := make([][]string, 0, len(results))
+		for _, result := range results {
+			rows = append(rows, []string{result.Key, result.Action, result.Status})
+		}
+		out.Table([]string{"key", "action", "status"}, rows)
+		fmt.Fprintln(out.Err, summary)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/services"
+)
+
+// rotationDue is a key whose rotation window ends before the cutoff.
+type rotationDue struct {
+	project, env, key string
+	updated           time.Time
+	every             string
+	due               time.Time
+}
+
+// matchRotation returns the most specific rule for project/env/key.
+func matchRotation(rules []settings.RotationRule, project, env, key string) (settings.RotationRule, bool) {
+	best, bestScore := settings.RotationRule{}, -1
+	for _, rule := range rules {
+		score := 0
+		switch {
+		case rule.Project != "" && rule.Project != project,
+			rule.Env != "" && rule.Env != env,
+			rule.Key != "" && rule.Key != key:
+			continue
+		}
+		if rule.Key != "" {
+			score += 4
+		}
+		if rule.Env != "" {
+			score += 2
+		}
+		if rule.Project != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+func validateRotation(rules []settings.RotationRule) error {
+	for i, rule := range rules {
+		every, err := parseAge(rule.RotateEvery)
+		if err != nil || every <= 0 {
+			return fmt.Errorf("rotation rule %d: rotateEvery must be a positive age such as 90d, got %q", i+1, rule.RotateEvery)
+		}
+	}
+	return nil
+}
+
+// rotationReminders lists the keys whose rotation window ends before
+// cutoff, oldest deadline first. ok is false when the vault has no rules.
+func (a App) rotationReminders(root, project, env string, cutoff time.Time) (due []rotationDue, ok bool, err error) {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(vaultSettings.Rotation) == 0 {
+		return nil, false, nil
+	}
+	if err := validateRotation(vaultSettings.Rotation); err != nil {
+		return nil, true, err
+	}
+	keys, err := a.Listing.ListAllKeys(root)
+	if err != nil {
+		return nil, true, err
+	}
+	for _, info := range keys {
+		keyProject, keyEnv, key := splitKeyRef(info.Name)
+		if project != "" && keyProject != project || env != "" && keyEnv != env {
+			continue
+		}
+		rule, matched := matchRotation(vaultSettings.Rotation, keyProject, keyEnv, key)
+		if !matched {
+			continue
+		}
+		every, _ := parseAge(rule.RotateEvery)
+		deadline := info.LastUpdated.Add(every)
+		if deadline.Before(cutoff) {
+			due = append(due, rotationDue{project: keyProject, env: keyEnv, key: key, updated: info.LastUpdated, every: rule.RotateEvery, due: deadline})
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].due.Before(due[j].due) })
+	return due, true, nil
+}
+
+func (a App) runReminders(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("reminders", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setRemindersUsage(fs)
+	project := fs.String("project", "", "Only keys of this project")
+	env := fs.String("env", "", "Only keys of this environment")
+	within := fs.String("within", "", "Also list keys due within this age (e.g. 14d)")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	now := time.Now().UTC()
+	cutoff := now
+	if *within != "" {
+		ahead, err := parseAge(*within)
+		if err != nil {
+			out.Error(fmt.Errorf("invalid --within: %w", err))
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+		cutoff = now.Add(ahead)
+	}
+	due, ok, err := a.rotationReminders(root, *project, *env, cutoff)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if !ok && !out.JSON {
+		out.Info("no rotation rules; set rotateEvery under \"rotation\" in .gitvault/settings.json")
+		return 0
+	}
+	if len(due) == 0 && !out.JSON {
+		out.Success("no keys past their rotation window", nil)
+		return 0
+	}
+	rows := make([][]string, 0, len(due))
+	overdue := 0
+	for _, d := range due {
+		status := "due"
+		if d.due.Before(now) {
+			status = "overdue"
+			overdue++
+		}
+		rows = append(rows, []string{d.project, d.env, d.key, d.updated.Format("2006-01-02T15:04:05Z"), d.every, d.due.Format("2006-01-02"), status})
+	}
+	out.Table([]string{"project", "env", "key", "last_updated", "rotate_every", "due", "status"}, rows)
+	if overdue > 0 {
+		if !out.JSON {
+			fmt.Fprintf(out.Err, "hint: %d key(s) are overdue; set new values with `gitvault secret set`\n", overdue)
+		}
+		return 1
+	}
+	return 0
+}
+
+func (a App) checkRotation(root string) []services.CheckResult {
+	due, ok, err := a.rotationReminders(root, "", "", time.Now().UTC())
+	if err != nil {
+		return []services.CheckResult{{Name: "rotation", Status: services.CheckFail, Message: err.Error()}}
+	}
+	if !ok {
+		return nil
+	}
+	if len(due) > 0 {
+		return []services.CheckResult{{Name: "rotation", Status: services.CheckWarn, Message: fmt.Sprintf("%d key(s) past their rotation window; run `gitvault reminders`", len(due))}}
+	}
+	return []services.CheckResult{{Name: "rotation", Status: services.CheckOK, Message: "all keys within their rotation window"}}
+}
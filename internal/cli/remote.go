@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/cmdenv"
+	"github.com/aatuh/sealr/services"
+)
+
+const (
+	defaultRemoteTimeout = 10 * time.Second
+
+	remoteAuth        = "authentication failed"
+	remoteUnreachable = "host unreachable"
+	remoteNotFound    = "repository not found"
+	remoteTimeout     = "timed out"
+)
+
+// checkGitRemote runs `git ls-remote origin` so auth and network problems
+// show up in doctor instead of halfway through a sync. Vaults that are not
+// git repositories get no check.
+func (a App) checkGitRemote(ctx context.Context, root string, timeout time.Duration) []services.CheckResult {
+	if a.Sync.Git == nil {
+		return nil
+	}
+	if isRepo, err := a.Sync.Git.IsRepo(ctx, root); err != nil || !isRepo {
+		return nil
+	}
+	result := services.CheckResult{Name: "git remote"}
+	remote, err := a.vaultGitOutput(ctx, root, nil, "remote", "get-url", "origin")
+	if err != nil {
+		result.Status = services.CheckWarn
+		result.Message = "no origin remote; `gitvault sync` has nowhere to pull from or push to"
+		return []services.CheckResult{result}
+	}
+	rawRemote := strings.TrimSpace(string(remote))
+	location := redactRemote(rawRemote)
+
+	lsCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, stderr, err := a.runGit(lsCtx, remoteEnv(timeout), nil, "-C", root, "ls-remote", "origin", "HEAD")
+	switch {
+	case errors.Is(lsCtx.Err(), context.DeadlineExceeded):
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%s: origin (%s) did not answer within %s", remoteTimeout, location, timeout)
+	case err != nil:
+		result.Status = services.CheckFail
+		detail := strings.ReplaceAll(lastLine(string(stderr), err), rawRemote, location)
+		result.Message = fmt.Sprintf("%s: origin (%s): %s", classifyRemoteError(string(stderr)), location, detail)
+	default:
+		result.Status = services.CheckOK
+		result.Message = "origin reachable (" + location + ")"
+	}
+	return []services.CheckResult{result}
+}
+
+// remoteEnv keeps git and ssh from prompting, so a missing credential fails
+// fast instead of hanging doctor.
+func remoteEnv(timeout time.Duration) []string {
+	env := cmdenv.Git("GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -o BatchMode=yes -o ConnectTimeout=%d", max(1, int(timeout.Seconds()))))
+	}
+	return env
+}
+
+func classifyRemoteError(stderr string) string {
+	msg := strings.ToLower(stderr)
+	switch {
+	case strings.Contains(msg, "permission denied"),
+		strings.Contains(msg, "authentication failed"),
+		strings.Contains(msg, "could not read username"),
+		strings.Contains(msg, "could not read password"),
+		strings.Contains(msg, "host key verification failed"),
+		strings.Contains(msg, "error: 403"):
+		return remoteAuth
+	case strings.Contains(msg, "could not resolve"),
+		strings.Contains(msg, "connection refused"),
+		strings.Contains(msg, "connection timed out"),
+		strings.Contains(msg, "network is unreachable"),
+		strings.Contains(msg, "failed to connect"):
+		return remoteUnreachable
+	case strings.Contains(msg, "not found"),
+		strings.Contains(msg, "does not appear to be a git repository"),
+		strings.Contains(msg, "does not exist"):
+		return remoteNotFound
+	default:
+		return "ls-remote failed"
+	}
+}
+
+func lastLine(output string, fallback error) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" && !strings.HasPrefix(line, "fatal: Could not read from remote") && !strings.HasPrefix(line, "Please make sure") && line != "and the repository exists." {
+			return strings.TrimPrefix(line, "fatal: ")
+		}
+	}
+	return fallback.Error()
+}
+
+// redactRemote drops credentials embedded in https remotes; the user part
+// is often a token.
+func redactRemote(remote string) string {
+	parsed, err := url.Parse(remote)
+	if err != nil || parsed.Scheme == "" || parsed.User == nil {
+		return remote
+	}
+	parsed.User = nil
+	return parsed.String()
+}
+
+func printRemoteHint(check services.CheckResult, w io.Writer) {
+	reason, _, _ := strings.Cut(check.Message, ":")
+	switch reason {
+	case remoteAuth:
+		fmt.Fprintln(w, "hint: check the credentials or SSH key git uses for origin, e.g. `ssh -T git@github.com`")
+	case remoteUnreachable, remoteTimeout:
+		fmt.Fprintln(w, "hint: check network access to origin, or skip the check with `gitvault doctor --no-remote`")
+	case remoteNotFound:
+		fmt.Fprintln(w, "hint: check the origin URL with `git remote -v` and that you have access to it")
+	default:
+		fmt.Fprintln(w, "hint: run `git ls-remote origin` in the vault for the full error")
+	}
+}
+
+// setOrigin points origin at url, adding the remote when it is missing. An
+// origin that already points elsewhere is reported, not replaced.
+func (a App) setOrigin(ctx context.Context, root, url string) error {
+	current, err := a.vaultGitOutput(ctx, root, nil, "remote", "get-url", "origin")
+	if err != nil {
+		return a.vaultGit(ctx, root, "remote", "add", "origin", url)
+	}
+	if existing := strings.TrimSpace(string(current)); existing != url {
+		return fmt.Errorf("origin already points to %s", redactRemote(existing))
+	}
+	return nil
+}
+
+// pushInitial commits a freshly initialized vault and pushes it with origin
+// as upstream, so plain `gitvault sync` works afterwards.
+func (a App) pushInitial(ctx context.Context, root string) error {
+	if err := a.vaultGit(ctx, root, "add", "-A", "--", ".gitvault", "secrets", "files", "README.md", ".gitattributes", ".gitignore"); err != nil {
+		return err
+	}
+	if err := a.vaultGit(ctx, root, "diff", "--cached", "--quiet"); err != nil {
+		if err := a.vaultGit(ctx, root, "commit", "-q", "-m", "Initialize gitvault vault"); err != nil {
+			return err
+		}
+	}
+	return a.vaultGit(ctx, root, "push", "-q", "-u", "origin", "HEAD")
+}
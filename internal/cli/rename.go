@@ -0,0 +1,467 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/cmdenv"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	executil "github.com/aatuh/sealr/infra/exec"
+)
+
+func (a App) runProjectRename(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("project rename", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setProjectRenameUsage(fs)
+	commit := fs.Bool("commit", false, "Commit the rename in the vault repository")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 2 {
+		out.Error(errors.New("old and new project names are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	from, to := fs.Arg(0), fs.Arg(1)
+	if err := validateRename(from, to, "project"); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	envs := idx.ListEnvs(from)
+	if len(envs) == 0 {
+		out.Error(fmt.Errorf("project %s not found", from))
+		return 1
+	}
+	if len(idx.ListEnvs(to)) > 0 {
+		out.Error(fmt.Errorf("project %s already exists", to))
+		return 1
+	}
+	moves := make([]envMove, 0, len(envs))
+	for _, env := range envs {
+		moves = append(moves, envMove{fromProject: from, fromEnv: env, toProject: to, toEnv: env})
+	}
+	if err := a.moveEnvs(root, moves); err != nil {
+		out.Error(err)
+		return 1
+	}
+	return a.finishRename(ctx, out, root, *commit, commitInfo{action: "rename-project", summary: fmt.Sprintf("Rename project %s to %s", from, to), refs: []string{from, to}},
+		map[string]string{"from": from, "to": to})
+}
+
+func (a App) runEnvRename(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("env rename", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setEnvRenameUsage(fs)
+	project := fs.String("project", "", "Project name")
+	commit := fs.Bool("commit", false, "Commit the rename in the vault repository")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" && a.link != nil {
+		*project = a.link.project
+	}
+	if *project == "" {
+		out.Error(errors.New("--project is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 2 {
+		out.Error(errors.New("old and new env names are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	from, to := fs.Arg(0), fs.Arg(1)
+	if err := validateRename(from, to, "env"); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if indexEnv(idx, *project, from) == nil {
+		out.Error(fmt.Errorf("env %s/%s not found", *project, from))
+		return 1
+	}
+	if indexEnv(idx, *project, to) != nil {
+		out.Error(fmt.Errorf("env %s/%s already exists", *project, to))
+		return 1
+	}
+	if err := a.moveEnvs(root, []envMove{{fromProject: *project, fromEnv: from, toProject: *project, toEnv: to}}); err != nil {
+		out.Error(err)
+		return 1
+	}
+	return a.finishRename(ctx, out, root, *commit, commitInfo{action: "rename-env", summary: fmt.Sprintf("Rename env %s/%s to %s/%s", *project, from, *project, to), refs: []string{*project + "/" + from, *project + "/" + to}},
+		map[string]string{"project": *project, "from": from, "to": to})
+}
+
+// runEnvClone copies an env under a new name. Recipients are vault-wide, so
+// the copy is readable by exactly the same keys and needs no re-encryption.
+func (a App) runEnvClone(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("env clone", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setEnvCloneUsage(fs)
+	project := fs.String("project", "", "Project name")
+	from := fs.String("from", "", "Env to copy")
+	to := fs.String("to", "", "New env name")
+	commit := fs.Bool("commit", false, "Commit the new env in the vault repository")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" && a.link != nil {
+		*project = a.link.project
+	}
+	if *project == "" {
+		out.Error(errors.New("--project is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *from == "" || *to == "" {
+		out.Error(errors.New("--from and --to are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if err := validateRename(*from, *to, "env"); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	source := indexEnv(idx, *project, *from)
+	if source == nil {
+		out.Error(fmt.Errorf("env %s/%s not found", *project, *from))
+		return 1
+	}
+	if indexEnv(idx, *project, *to) != nil {
+		out.Error(fmt.Errorf("env %s/%s already exists", *project, *to))
+		return 1
+	}
+	keys, files := len(source.Keys), len(source.Files)
+	if err := a.transferEnvs(root, []envMove{{fromProject: *project, fromEnv: *from, toProject: *project, toEnv: *to}}, true); err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *commit {
+		info := commitInfo{
+			action:  "clone-env",
+			summary: fmt.Sprintf("Clone env %s/%s to %s/%s", *project, *from, *project, *to),
+			refs:    []string{*project + "/" + *from, *project + "/" + *to},
+		}
+		if err := a.commitVault(ctx, root, info); err != nil {
+			out.Error(fmt.Errorf("cloned, but commit failed: %w", err))
+			return 1
+		}
+	}
+	out.Success(fmt.Sprintf("cloned %s/%s to %s/%s (%d key(s), %d file(s))", *project, *from, *project, *to, keys, files), map[string]interface{}{
+		"project":   *project,
+		"from":      *from,
+		"to":        *to,
+		"keys":      keys,
+		"files":     files,
+		"committed": *commit,
+	})
+	return 0
+}
+
+func validateRename(from, to, field string) error {
+	if err := domain.ValidateIdentifier(from, field); err != nil {
+		return err
+	}
+	if err := domain.ValidateIdentifier(to, field); err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("old and new %s names are the same", field)
+	}
+	return nil
+}
+
+type envMove struct {
+	fromProject, fromEnv string
+	toProject, toEnv     string
+}
+
+// moveEnvs moves ciphertexts, index entries, and digests to new names.
+// Ciphertexts do not depend on their path, so nothing is re-encrypted. New
+// copies are written and indexed before the old ones are removed; an
+// interrupted rename leaves orphans for `gitvault fsck`, never lost data.
+func (a App) moveEnvs(root string, moves []envMove) error {
+	return a.transferEnvs(root, moves, false)
+}
+
+// transferEnvs copies each env to its new name, along with its export
+// policy, and, unless keep is set, removes the original afterwards.
+func (a App) transferEnvs(root string, moves []envMove, keep bool) error {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return err
+	}
+	// Before any value reaches the new name.
+	if err := a.carryExportPolicies(root, moves); err != nil {
+		return err
+	}
+	store := a.metaStore()
+	meta, err := store.Load(root)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	var stale []string
+	for _, move := range moves {
+		envIndex := indexEnv(idx, move.fromProject, move.fromEnv)
+		if envIndex == nil {
+			return fmt.Errorf("env %s/%s not found", move.fromProject, move.fromEnv)
+		}
+		if len(envIndex.Keys) > 0 {
+			from := a.Store.SecretFilePath(root, move.fromProject, move.fromEnv)
+			if err := a.copyCiphertext(from, a.Store.SecretFilePath(root, move.toProject, move.toEnv)); err != nil {
+				return err
+			}
+			stale = append(stale, from)
+		}
+		for name := range envIndex.Files {
+			from := a.Store.FilePath(root, move.fromProject, move.fromEnv, name)
+			if err := a.copyCiphertext(from, a.Store.FilePath(root, move.toProject, move.toEnv, name)); err != nil {
+				return err
+			}
+			stale = append(stale, from)
+		}
+
+		moved := envIndex
+		if keep {
+			moved = cloneEnvIndex(envIndex, now)
+		} else {
+			project := idx.Projects[move.fromProject]
+			delete(project.Envs, move.fromEnv)
+			if len(project.Envs) == 0 {
+				delete(idx.Projects, move.fromProject)
+			}
+		}
+		target, ok := idx.Projects[move.toProject]
+		if !ok || target == nil {
+			target = &domain.ProjectIndex{Envs: map[string]*domain.EnvIndex{}}
+			idx.Projects[move.toProject] = target
+		}
+		target.Envs[move.toEnv] = moved
+
+		if entry, ok := meta.Lookup(move.fromProject, move.fromEnv); ok {
+			*meta.Env(move.toProject, move.toEnv) = *entry
+			if !keep {
+				meta.RemoveEnv(move.fromProject, move.fromEnv)
+			}
+		}
+	}
+	if err := a.Store.SaveIndex(root, idx); err != nil {
+		return err
+	}
+	if err := store.Save(root, meta); err != nil {
+		return err
+	}
+	if keep {
+		return nil
+	}
+	for _, path := range stale {
+		if err := a.Store.FS.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	for _, move := range moves {
+		a.removeEmptyDirs(root, move.fromProject, move.fromEnv)
+	}
+	return nil
+}
+
+// cloneEnvIndex copies an env's index entry, stamping every key and file
+// as written at now.
+func cloneEnvIndex(envIndex *domain.EnvIndex, now time.Time) *domain.EnvIndex {
+	clone := &domain.EnvIndex{Keys: map[string]*domain.KeyMetadata{}}
+	for key := range envIndex.Keys {
+		clone.Keys[key] = &domain.KeyMetadata{LastUpdated: now}
+	}
+	if len(envIndex.Files) > 0 {
+		clone.Files = map[string]*domain.FileMetadata{}
+		for name, file := range envIndex.Files {
+			copied := domain.FileMetadata{}
+			if file != nil {
+				copied = *file
+			}
+			copied.LastUpdated = now
+			clone.Files[name] = &copied
+		}
+	}
+	return clone
+}
+
+func (a App) copyCiphertext(from, to string) error {
+	data, err := a.Store.FS.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Store.FS.Stat(to); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+	return a.writeCiphertext(to, data)
+}
+
+// writeCiphertext replaces the ciphertext at the logical path. It stages
+// next to the path and renames into place, like sealr does, so an obfuscated
+// layout drops the staging directory afterwards.
+func (a App) writeCiphertext(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := a.Store.FS.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return a.Store.FS.Rename(tmp.Name(), path)
+}
+
+// removeEmptyDirs drops the directories a moved env leaves behind, both
+// where the layout stores them and under their logical names, which reads
+// of an obfuscated layout create. Removing a directory that still has
+// entries fails, which is fine.
+func (a App) removeEmptyDirs(root, project, env string) {
+	dirs := []string{
+		filepath.Dir(a.Store.FilePath(root, project, env, "x")),
+		filepath.Dir(filepath.Dir(a.Store.FilePath(root, project, env, "x"))),
+		filepath.Dir(a.Store.SecretFilePath(root, project, env)),
+	}
+	for _, dir := range dirs {
+		_ = a.Store.FS.Remove(dir)
+		_ = os.Remove(dir)
+	}
+}
+
+func (a App) finishRename(ctx context.Context, out ui.Output, root string, commit bool, info commitInfo, payload map[string]string) int {
+	if commit {
+		if err := a.commitVault(ctx, root, info); err != nil {
+			out.Error(fmt.Errorf("renamed, but commit failed: %w", err))
+			return 1
+		}
+		payload["committed"] = "true"
+	}
+	out.Success(strings.ToLower(info.summary[:1])+info.summary[1:], payload)
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: update any .gitvault.ref links and scripts that use the old name")
+	}
+	return 0
+}
+
+// commitInfo describes a commit gitvault makes. summary is the default
+// message; the vault's commit template can rearrange all three.
+type commitInfo struct {
+	action  string
+	summary string
+	refs    []string
+}
+
+// commitMessage applies the vault's commit template to info, or returns
+// the plain summary when none is set.
+func (a App) commitMessage(ctx context.Context, root string, info commitInfo) string {
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil || vaultSettings.Commit == nil || strings.TrimSpace(vaultSettings.Commit.Template) == "" {
+		return info.summary
+	}
+	template := vaultSettings.Commit.Template
+	author := ""
+	if strings.Contains(template, "{author}") {
+		// git var honours GIT_AUTHOR_NAME as well as user.name.
+		if ident, err := a.vaultGitOutput(ctx, root, nil, "var", "GIT_AUTHOR_IDENT"); err == nil {
+			author, _, _ = strings.Cut(string(ident), " <")
+			author = strings.TrimSpace(author)
+		}
+		if author == "" {
+			author = "unknown"
+		}
+	}
+	return strings.NewReplacer(
+		"{action}", info.action,
+		"{summary}", info.summary,
+		"{refs}", strings.Join(info.refs, ", "),
+		"{author}", author,
+	).Replace(template)
+}
+
+// commitVault stages the vault's tracked layout and commits it.
+func (a App) commitVault(ctx context.Context, root string, info commitInfo) error {
+	if a.Sync.Git == nil {
+		return errors.New("git is not configured")
+	}
+	if isRepo, err := a.Sync.Git.IsRepo(ctx, root); err != nil || !isRepo {
+		return errors.New("the vault is not a git repository")
+	}
+	if err := a.vaultGit(ctx, root, "add", "-A", "--", ".gitvault", "secrets", "files"); err != nil {
+		return err
+	}
+	return a.vaultGit(ctx, root, "commit", "-q", "-m", a.commitMessage(ctx, root, info))
+}
+
+// vaultGit runs one git command in the vault, folding its output into the
+// error.
+func (a App) vaultGit(ctx context.Context, root string, args ...string) error {
+	stdout, stderr, err := a.runGit(ctx, cmdenv.Git(), nil, append([]string{"-C", root}, args...)...)
+	if err != nil {
+		output := strings.TrimSpace(string(stdout) + "\n" + string(stderr))
+		return fmt.Errorf("git %s: %w: %s", args[0], err, output)
+	}
+	return nil
+}
+
+// runGit runs git through a.Runner with env as its whole environment.
+func (a App) runGit(ctx context.Context, env []string, stdin []byte, args ...string) ([]byte, []byte, error) {
+	runner := a.Runner
+	if runner == nil {
+		runner = cmdenv.Runner{Base: executil.ExecRunner{}}
+	}
+	return runner.Run(ctx, "git", args, stdin, env, "")
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/aatuh/gitvault/guard"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+func (a App) runSecretTemplate(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret template", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretTemplateUsage(fs)
+	project := fs.String("project", "", "Project name")
+	env := fs.String("env", "", "Environment name")
+	inPath := fs.String("in", "", "Template path or - for stdin")
+	outPath := fs.String("out", "-", "Output path or - for stdout")
+	force := fs.Bool("force", false, "Overwrite output file")
+	allowGit := fs.Bool("allow-git", false, "Allow writing into git-tracked paths")
+	allowOverride := fs.Bool("allow-export-override", false, "Render even if an export policy keeps this env to secret run")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *inPath == "" {
+		out.Error(errors.New("--in is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	source, err := readInputFile(*inPath)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	name := *inPath
+	if name == "-" {
+		name = "stdin"
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs(*project, *env)).Parse(string(source))
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	// Check the destination before decrypting anything.
+	policy, err := a.newExportGuard(out, root, *allowOverride)
+	if err == nil {
+		err = policy.check(*project, *env)
+	}
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if *outPath != "-" {
+		if err := a.guardOutputPath(ctx, root, *outPath, *allowGit, *force); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	payload, err := a.exportEnv(ctx, root, *project, *env)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	a.healEnv(ctx, root, *project, *env)
+	if payload, err = a.resolveAliases(ctx, root, *project, *env, payload, policy); err != nil {
+		out.Error(err)
+		return 1
+	}
+	values, _ := domain.ParseDotenv(payload)
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, values.Values); err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	if *outPath == "-" {
+		_, _ = out.Out.Write(rendered.Bytes())
+		return 0
+	}
+	if err := guard.Write(*outPath, rendered.Bytes()); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("rendered", map[string]string{"path": *outPath})
+	return 0
+}
+
+// templateFuncs are the helpers available to `secret template`, a small
+// subset of sprig's with the same names and argument order.
+func templateFuncs(project, env string) template.FuncMap {
+	return template.FuncMap{
+		"project": func() string { return project },
+		"env":     func() string { return env },
+		"default": func(fallback, value interface{}) interface{} {
+			if value == nil || value == "" {
+				return fallback
+			}
+			return value
+		},
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if value == nil || value == "" {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, parts []string) string { return strings.Join(parts, sep) },
+		"quote":      func(s string) string { return fmt.Sprintf("%q", s) },
+		"squote":     func(s string) string { return "'" + s + "'" },
+		"b64enc":     func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) (string, error) {
+			decoded, err := base64.StdEncoding.DecodeString(s)
+			return string(decoded), err
+		},
+		"indent":  indent,
+		"nindent": func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"toJson": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+}
+
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/keymeta"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+var reportHeaders = []string{"ref", "last_updated", "author", "tags", "expiry"}
+
+// runSecretReport lists key metadata for audits. It reads only the index
+// and git history, so nothing is decrypted and no value can leak into it.
+func (a App) runSecretReport(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret report", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretReportUsage(fs)
+	project := fs.String("project", "", "Only report this project")
+	env := fs.String("env", "", "Only report envs with this name")
+	format := fs.String("format", "table", "Output format: table, csv, or tsv")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *format != "table" && *format != "csv" && *format != "tsv" {
+		out.Error(fmt.Errorf("unknown --format %q (use table, csv, or tsv)", *format))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err == nil {
+		err = validateRotation(vaultSettings.Rotation)
+	}
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	meta, err := a.metaStore().Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	refs, err := a.scopedEnvs(root, *project, *env)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	inGit := a.Sync.Git != nil
+	if inGit {
+		isRepo, err := a.Sync.Git.IsRepo(ctx, root)
+		inGit = err == nil && isRepo
+	}
+	rows := [][]string{}
+	for _, ref := range refs {
+		envIndex := indexEnv(idx, ref.project, ref.env)
+		// Git history is per env file, so every key of an env shares the
+		// author of its last commit.
+		author := ""
+		if inGit {
+			if info, err := a.Sync.Git.LastCommitInfo(ctx, root, a.Store.SecretFilePath(root, ref.project, ref.env)); err == nil {
+				author = info.Author
+			}
+		}
+		entry, _ := meta.Lookup(ref.project, ref.env)
+		keys := make([]string, 0, len(envIndex.Keys))
+		for key := range envIndex.Keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			updated, expiry := "", ""
+			if meta := envIndex.Keys[key]; meta != nil && !meta.LastUpdated.IsZero() {
+				updated = meta.LastUpdated.UTC().Format(time.RFC3339)
+				// A key expires when its rotation window ends.
+				if rule, ok := matchRotation(vaultSettings.Rotation, ref.project, ref.env, key); ok {
+					every, _ := parseAge(rule.RotateEvery)
+					expiry = meta.LastUpdated.UTC().Add(every).Format("2006-01-02")
+				}
+			}
+			rows = append(rows, []string{ref.String() + "/" + key, updated, author, keyTags(entry, key), expiry})
+		}
+	}
+	if *format == "table" {
+		out.Table(reportHeaders, rows)
+		return 0
+	}
+	w := csv.NewWriter(out.Out)
+	if *format == "tsv" {
+		w.Comma = '\t'
+	}
+	_ = w.Write(reportHeaders)
+	_ = w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		out.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// keyTags lists a key's audiences and whether it is deprecated, separated
+// by semicolons so a spreadsheet keeps them in one cell.
+func keyTags(entry *keymeta.Env, key string) string {
+	if entry == nil {
+		return ""
+	}
+	tags := append([]string(nil), entry.Audiences[key]...)
+	if _, ok := entry.Deprecated[key]; ok {
+		tags = append(tags, "deprecated")
+	}
+	return strings.Join(tags, ";")
+}
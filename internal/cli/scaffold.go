@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/scaffold"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/services"
+)
+
+func (a App) runProjectNew(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("project new", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setProjectNewUsage(fs)
+	templateName := fs.String("template", "", "Template in .gitvault/templates to start from")
+	envList := fs.String("envs", "", "Comma-separated envs to create (default: the template's envs)")
+	commit := fs.Bool("commit", false, "Commit the new project in the vault repository")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 1 {
+		out.Error(errors.New("exactly one project name is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	project := fs.Arg(0)
+	if err := domain.ValidateIdentifier(project, "project"); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *templateName == "" {
+		out.Error(errors.New("--template is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	tmpl, err := scaffold.Load(root, *templateName)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	envs := tmpl.Envs
+	if *envList != "" {
+		envs = nil
+		for _, env := range strings.Split(*envList, ",") {
+			if env = strings.TrimSpace(env); env != "" {
+				envs = append(envs, env)
+			}
+		}
+	}
+	if len(envs) == 0 {
+		out.Error(fmt.Errorf("--envs is required; template %s names no envs", *templateName))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	for _, env := range envs {
+		if err := domain.ValidateIdentifier(env, "env"); err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+	}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if len(idx.ListEnvs(project)) > 0 {
+		out.Error(fmt.Errorf("project %s already exists", project))
+		return 1
+	}
+
+	for _, env := range envs {
+		values, order, err := tmpl.Values(project, env)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		data := domain.RenderDotenvOrdered(values, order)
+		if _, err := a.SecretService.ImportEnv(ctx, root, project, env, data, services.ImportOptions{Strategy: services.MergePreferVault}); err != nil {
+			out.Error(fmt.Errorf("%s/%s: %w", project, env, err))
+			printSopsHint(err, out.Err, out.JSON)
+			return 1
+		}
+		if err := a.recordDigest(ctx, root, project, env); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if *commit {
+		info := commitInfo{
+			action:  "create-project",
+			summary: fmt.Sprintf("Create project %s from template %s", project, *templateName),
+			refs:    []string{project},
+		}
+		if err := a.commitVault(ctx, root, info); err != nil {
+			out.Error(fmt.Errorf("created, but commit failed: %w", err))
+			return 1
+		}
+	}
+
+	placeholders := []string{}
+	generated := 0
+	for _, key := range tmpl.Keys {
+		if key.Generated() {
+			generated++
+		} else {
+			placeholders = append(placeholders, key.Name)
+		}
+	}
+	out.Success(fmt.Sprintf("created project %s with %d env(s) from template %s", project, len(envs), *templateName), map[string]interface{}{
+		"project":      project,
+		"template":     *templateName,
+		"envs":         envs,
+		"keys":         len(tmpl.Keys),
+		"generated":    generated,
+		"placeholders": placeholders,
+		"committed":    *commit,
+	})
+	if !out.JSON && len(placeholders) > 0 {
+		fmt.Fprintf(out.Err, "hint: replace placeholder values (%s) with `gitvault secret set %s <env> KEY value`\n", strings.Join(placeholders, ", "), project)
+	}
+	return 0
+}
@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+type envRef struct {
+	project string
+	env     string
+}
+
+func (r envRef) String() string {
+	return r.project + "/" + r.env
+}
+
+// scopedEnvs lists the indexed envs, optionally narrowed to one project
+// and/or one env name.
+func (a App) scopedEnvs(root, project, env string) ([]envRef, error) {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	refs := []envRef{}
+	for _, p := range idx.ListProjects() {
+		if project != "" && p != project {
+			continue
+		}
+		for _, e := range idx.ListEnvs(p) {
+			if env != "" && e != env {
+				continue
+			}
+			if envIndex := indexEnv(idx, p, e); envIndex != nil && len(envIndex.Keys) > 0 {
+				refs = append(refs, envRef{project: p, env: e})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// decryptEnvs calls visit with the values of each env in refs. Envs that
+// fail to decrypt are reported on stderr and counted, not fatal.
+func (a App) decryptEnvs(ctx context.Context, out ui.Output, root string, refs []envRef, visit func(envRef, domain.Dotenv)) int {
+	failed := 0
+	for _, ref := range refs {
+		payload, err := a.exportEnv(ctx, root, ref.project, ref.env)
+		if err != nil {
+			failed++
+			fmt.Fprintf(out.Err, "warning: skipped %s: %v\n", ref, err)
+			continue
+		}
+		values, _ := domain.ParseDotenv(payload)
+		visit(ref, values)
+	}
+	return failed
+}
+
+func (a App) runSecretGrep(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret grep", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretGrepUsage(fs)
+	project := fs.String("project", "", "Only search this project")
+	env := fs.String("env", "", "Only search envs with this name")
+	useRegex := fs.Bool("regex", false, "Treat the pattern as a regular expression")
+	ignoreCase := fs.Bool("ignore-case", false, "Match case-insensitively")
+	showValues := fs.Bool("show-values", false, "Print matching values")
+	yes := fs.Bool("yes", false, "Skip the --show-values confirmation prompt")
+	allowOverride := fs.Bool("allow-export-override", false, "Show values even if an export policy keeps an env to secret run")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 1 || fs.Arg(0) == "" {
+		out.Error(errors.New("exactly one pattern is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	expr := fs.Arg(0)
+	if !*useRegex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if *ignoreCase {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		out.Error(fmt.Errorf("invalid pattern: %w", err))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *showValues {
+		if err := confirmValues(out, *yes); err != nil {
+			out.Error(err)
+			if errors.Is(err, errValuesNotConfirmed) {
+				return 2
+			}
+			return 1
+		}
+	}
+	refs, err := a.scopedEnvs(root, *project, *env)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	// Envs whose values may not be printed are skipped like ones that fail
+	// to decrypt.
+	searched, failed := refs, 0
+	if *showValues {
+		policy, err := a.newExportGuard(out, root, *allowOverride)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		searched = nil
+		for _, ref := range refs {
+			if err := policy.check(ref.project, ref.env); err != nil {
+				failed++
+				fmt.Fprintf(out.Err, "warning: skipped %s: %v\n", ref, err)
+				continue
+			}
+			searched = append(searched, ref)
+		}
+	}
+	rows := [][]string{}
+	failed += a.decryptEnvs(ctx, out, root, searched, func(ref envRef, values domain.Dotenv) {
+		keys := append([]string(nil), values.Order...)
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := values.Values[key]
+			if !pattern.MatchString(value) {
+				continue
+			}
+			row := []string{ref.String() + "/" + key}
+			if *showValues {
+				row = append(row, value)
+			}
+			rows = append(rows, row)
+		}
+	})
+	headers := []string{"ref"}
+	if *showValues {
+		headers = append(headers, "value")
+	}
+	if len(rows) == 0 && !out.JSON {
+		out.Success(fmt.Sprintf("no values match in %d env(s)", len(refs)-failed), nil)
+	} else {
+		out.Table(headers, rows)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// indexedDigests groups refs' keys by their recorded value digests. Envs
+// whose digests are missing or stale are skipped with a warning and
+// counted as failed.
+func (a App) indexedDigests(out ui.Output, root string, refs []envRef, byDigest map[string][]string) int {
+	failed := 0
+	for _, ref := range refs {
+		_, digests, ok := a.valueDigests(root, ref.project, ref.env)
+		if !ok {
+			fmt.Fprintf(out.Err, "warning: skipped %s: no current value digests (run without --from-index)\n", ref)
+			failed++
+			continue
+		}
+		for key, digest := range digests {
+			byDigest[digest] = append(byDigest[digest], ref.String()+"/"+key)
+		}
+	}
+	return failed
+}
+
+func (a App) runSecretDedup(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret dedup-report", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretDedupUsage(fs)
+	project := fs.String("project", "", "Only compare keys in this project")
+	env := fs.String("env", "", "Only compare envs with this name")
+	minLength := fs.Int("min-length", 8, "Ignore values shorter than this (flags, ports, booleans)")
+	fromIndex := fs.Bool("from-index", false, "Compare recorded value digests instead of decrypting (--min-length does not apply)")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *minLength < 1 {
+		out.Error(errors.New("--min-length must be at least 1"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	refs, err := a.scopedEnvs(root, *project, *env)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	// Only digests are kept, so the report never holds more plaintext than
+	// one env at a time. They are keyed with a key that lives as long as
+	// this run and are never printed, so the report offers no dictionary
+	// check of the values.
+	byDigest := map[string][]string{}
+	var failed int
+	if *fromIndex {
+		failed = a.indexedDigests(out, root, refs, byDigest)
+	} else {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			out.Error(err)
+			return 1
+		}
+		mac := hmac.New(sha256.New, key)
+		failed = a.decryptEnvs(ctx, out, root, refs, func(ref envRef, values domain.Dotenv) {
+			for name, value := range values.Values {
+				if len(value) < *minLength {
+					continue
+				}
+				mac.Reset()
+				_, _ = mac.Write([]byte(value))
+				digest := string(mac.Sum(nil))
+				byDigest[digest] = append(byDigest[digest], ref.String()+"/"+name)
+			}
+		})
+	}
+	digests := []string{}
+	for digest, keys := range byDigest {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			digests = append(digests, digest)
+		}
+	}
+	// Largest groups first; ties by first ref for a stable order.
+	sort.Slice(digests, func(i, j int) bool {
+		a, b := byDigest[digests[i]], byDigest[digests[j]]
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a[0] < b[0]
+	})
+	rows := [][]string{}
+	for i, digest := range digests {
+		for _, ref := range byDigest[digest] {
+			rows = append(rows, []string{strconv.Itoa(i + 1), ref})
+		}
+	}
+	if len(rows) == 0 && !out.JSON {
+		out.Success(fmt.Sprintf("no shared values across %d env(s)", len(refs)-failed), nil)
+	} else {
+		out.Table([]string{"group", "ref"}, rows)
+		if !out.JSON && len(digests) > 0 {
+			fmt.Fprintf(out.Err, "hint: %d value(s) are shared; rotate each group together or consolidate them\n", len(digests))
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/agekey"
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/identity"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/vaultfs"
+	"github.com/aatuh/sealr/services"
+)
+
+// setupVersionTimeout bounds `sops --version` during setup.
+const setupVersionTimeout = 10 * time.Second
+
+// runSetup prepares a new machine: it checks for git and sops, finds,
+// imports, or generates an age identity, prints the public key to send to
+// a vault admin, and, when a vault is at hand, checks that it can be
+// decrypted. Rerunning it after the admin ran `keys add` finishes the job.
+func (a App) runSetup(ctx context.Context, out ui.Output, vaultPath string, args []string) int {
+	fs := flag.NewFlagSet("setup", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSetupUsage(fs)
+	importPath := fs.String("import", "", "Use an existing identity file instead of generating one")
+	keyPath := fs.String("out", identity.ActiveFile(), "Where to write a generated identity")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	sops := checkSetupSops(ctx)
+	identityCheck, recipient := a.setupIdentity(*importPath, *keyPath)
+	checks := []services.CheckResult{checkSetupTool("git", "git"), sops, identityCheck}
+	access := services.CheckResult{}
+	if recipient != "" {
+		access = a.setupAccess(ctx, vaultPath, recipient, sops.Status != services.CheckFail)
+		checks = append(checks, access)
+	}
+
+	rows := make([][]string, 0, len(checks))
+	failed := false
+	for _, check := range checks {
+		rows = append(rows, []string{check.Name, string(check.Status), check.Message})
+		failed = failed || check.Status == services.CheckFail
+	}
+	out.Table([]string{"step", "status", "message"}, rows)
+	for _, check := range checks {
+		if check.Status != services.CheckFail {
+			continue
+		}
+		switch check.Name {
+		case "git", "sops":
+			fmt.Fprintf(out.Err, "hint: %s\n", installHint(check.Name))
+		}
+	}
+	if recipient != "" && !out.JSON && access.Status != services.CheckOK {
+		fmt.Fprintln(out.Err, "")
+		fmt.Fprintln(out.Err, "Send your public key to a vault admin. They add you with:")
+		fmt.Fprintf(out.Err, "  gitvault keys add %s\n", recipient)
+		fmt.Fprintln(out.Err, "Then run `gitvault setup` again to check that you can decrypt.")
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkSetupTool reports whether name is on PATH.
+func checkSetupTool(check, name string) services.CheckResult {
+	result := services.CheckResult{Name: check}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%s not found in PATH", name)
+		return result
+	}
+	result.Status = services.CheckOK
+	result.Message = path
+	return result
+}
+
+// checkSetupSops finds sops like the encrypter does and checks its version.
+func checkSetupSops(ctx context.Context) services.CheckResult {
+	name := strings.TrimSpace(os.Getenv("GITVAULT_SOPS_PATH"))
+	if name == "" {
+		name = "sops"
+	}
+	result := checkSetupTool("sops", name)
+	if result.Status != services.CheckOK {
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, setupVersionTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, result.Message, "--version").Output()
+	version, ok := encryption.ParseSopsVersion(string(output))
+	switch {
+	case err != nil:
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%s --version failed: %v", result.Message, err)
+	case !ok:
+		result.Status = services.CheckWarn
+		result.Message = fmt.Sprintf("cannot parse the version of %s; need %s or newer", result.Message, encryption.MinSopsVersion)
+	case !version.AtLeast(encryption.MinSopsVersion):
+		result.Status = services.CheckFail
+		result.Message = fmt.Sprintf("%s is older than %s", version, encryption.MinSopsVersion)
+	default:
+		result.Message = fmt.Sprintf("%s (%s)", result.Message, version)
+	}
+	return result
+}
+
+func installHint(tool string) string {
+	switch tool + "/" + runtime.GOOS {
+	case "git/darwin":
+		return "install git with `xcode-select --install` or `brew install git`"
+	case "git/windows":
+		return "install git with `winget install Git.Git` or from https://git-scm.com/download/win"
+	case "git/linux":
+		return "install git with your package manager, e.g. `sudo apt install git` or `sudo dnf install git`"
+	case "sops/darwin":
+		return "install sops with `brew install sops`"
+	case "sops/windows":
+		return "install sops with `scoop install sops` or from https://github.com/getsops/sops/releases"
+	case "sops/linux":
+		return "download sops from https://github.com/getsops/sops/releases, or set GITVAULT_SOPS_PATH to an installed binary"
+	}
+	return fmt.Sprintf("install %s and make sure it is on PATH", tool)
+}
+
+// setupIdentity returns the recipient of the identity to use: the one in
+// importPath, else the first one gitvault already finds, else a new one
+// written to keyPath. Identities outside sops's own lookup are added to the
+// user config.
+func (a App) setupIdentity(importPath, keyPath string) (services.CheckResult, string) {
+	result := services.CheckResult{Name: "age identity"}
+	fail := func(err error) (services.CheckResult, string) {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result, ""
+	}
+	if importPath != "" {
+		path, _, err := addIdentityFile(importPath)
+		if err != nil {
+			return fail(err)
+		}
+		entry := identity.FileEntry("import", path)
+		if entry.Err != nil {
+			return fail(entry.Err)
+		}
+		if len(entry.Recipients) == 0 {
+			return fail(fmt.Errorf("%s: no age identity to derive a public key from", path))
+		}
+		result.Status = services.CheckOK
+		result.Message = "imported " + path
+		return result, entry.Recipients[0]
+	}
+
+	entries, err := a.discoverIdentities()
+	if err != nil {
+		return fail(err)
+	}
+	for _, entry := range entries {
+		if entry.Err == nil && len(entry.Recipients) > 0 {
+			result.Status = services.CheckOK
+			result.Message = "using " + entry.Path
+			return result, entry.Recipients[0]
+		}
+	}
+
+	if keyPath == "" {
+		return fail(errors.New("no identity path; pass --out"))
+	}
+	secret, recipient, err := agekey.Generate()
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeIdentityFile(keyPath, secret, recipient); err != nil {
+		return fail(err)
+	}
+	if keyPath != identity.ActiveFile() {
+		if _, _, err := addIdentityFile(keyPath); err != nil {
+			return fail(err)
+		}
+	}
+	result.Status = services.CheckOK
+	result.Message = "generated " + keyPath + "; back it up, it cannot be recovered"
+	return result, recipient
+}
+
+// writeIdentityFile writes a new owner-only identity file in age-keygen's
+// format, refusing to replace an existing file.
+func writeIdentityFile(path, secret, recipient string) error {
+	if err := os.MkdirAll(filepath.Dir(path), vaultfs.DirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, vaultfs.FilePerm)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s exists but holds no usable identity; fix it, pass --import, or choose another --out", path)
+		}
+		return err
+	}
+	_, err = fmt.Fprintf(file, "# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), recipient, secret)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return vaultfs.Restrict(path, false)
+}
+
+// setupAccess checks whether recipient can open the vault at vaultPath (or
+// the one found from the working directory). A missing vault or a pending
+// `keys add` is a warning: setup is done on this machine's side.
+func (a App) setupAccess(ctx context.Context, vaultPath, recipient string, canDecrypt bool) services.CheckResult {
+	result := services.CheckResult{Name: "vault access", Status: services.CheckWarn}
+	root, err := a.resolveRoot(vaultPath)
+	if err != nil {
+		result.Message = "no vault found; rerun with --vault or inside a vault checkout to check access"
+		return result
+	}
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		result.Status = services.CheckFail
+		result.Message = err.Error()
+		return result
+	}
+	member := false
+	for _, key := range configured {
+		member = member || key == recipient
+	}
+	if !member {
+		result.Message = fmt.Sprintf("%s is not a recipient of %s yet", recipient, root)
+		return result
+	}
+	if !canDecrypt {
+		result.Message = "you are a recipient; install sops to decrypt"
+		return result
+	}
+	sample := a.decryptSample(ctx, root)
+	result.Status = sample.Status
+	result.Message = sample.Message
+	if sample.Status == services.CheckWarn {
+		result.Status = services.CheckOK
+		result.Message = "you are a recipient; " + sample.Message
+	}
+	return result
+}
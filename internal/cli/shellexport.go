@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aatuh/sealr/domain"
+)
+
+// shellName matches keys that can be exported as POSIX shell variables.
+var shellName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// --for-shell formats: bare export lines, or a guard that loads them.
+const (
+	forShellSh   = "sh"
+	forShellEval = "eval"
+)
+
+// renderShell turns an exported env into a POSIX sh file meant to be
+// sourced from path. Before exporting anything it refuses to load when the
+// file is readable by other users or, with maxAge, when it was exported
+// longer ago than that, so a forgotten copy stops working on its own.
+func renderShell(payload []byte, path string, exported time.Time, maxAge time.Duration) ([]byte, error) {
+	exports, err := renderShellExports(payload, "  ")
+	if err != nil {
+		return nil, err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	file := shellQuote(absPath)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Exported by gitvault at %s. Load it with: . %s\n", exported.UTC().Format(time.RFC3339), file)
+	b.WriteString("__gitvault_load() {\n")
+	fmt.Fprintf(&b, "  if [ -n \"$(find %s -prune -perm -004 2>/dev/null)\" ]; then\n", file)
+	fmt.Fprintf(&b, "    echo %s >&2\n", shellQuote("gitvault: refusing to load "+absPath+": it is readable by other users; chmod 600 it"))
+	b.WriteString("    return 1\n  fi\n")
+	if maxAge > 0 {
+		fmt.Fprintf(&b, "  if [ $(( $(date +%%s) - %d )) -gt %d ]; then\n", exported.Unix(), int64(maxAge.Seconds()))
+		fmt.Fprintf(&b, "    echo %s >&2\n", shellQuote(fmt.Sprintf("gitvault: refusing to load %s: exported more than %s ago; export it again", absPath, maxAge)))
+		b.WriteString("    return 1\n  fi\n")
+	}
+	b.Write(exports)
+	b.WriteString("}\n")
+	b.WriteString("if __gitvault_load; then unset -f __gitvault_load; else unset -f __gitvault_load; false; fi\n")
+	return b.Bytes(), nil
+}
+
+// renderShellExports turns an exported env into export lines, each
+// prefixed with indent.
+func renderShellExports(payload []byte, indent string) ([]byte, error) {
+	parsed, _ := domain.ParseDotenv(payload)
+	var b bytes.Buffer
+	for _, key := range parsed.Order {
+		if !shellName.MatchString(key) {
+			return nil, fmt.Errorf("key %s is not a valid shell variable name", key)
+		}
+		fmt.Fprintf(&b, "%sexport %s=%s\n", indent, key, shellQuote(parsed.Values[key]))
+	}
+	return b.Bytes(), nil
+}
+
+// renderEvalLoader returns shell code for `eval "$(...)"` that holds no
+// values. It refuses under set -x or set -v, which would trace every value,
+// and when the shell's stdout is a file; otherwise it runs args, a
+// --for-shell sh export, and evals its output. Shells trace the argument of
+// eval itself, so the values cannot be part of the first eval.
+func renderEvalLoader(args []string) ([]byte, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	quoted := []string{shellQuote(exe)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	var b bytes.Buffer
+	b.WriteString("case $- in\n")
+	fmt.Fprintf(&b, "*[xv]*) echo %s >&2; false ;;\n", shellQuote("gitvault: refusing to eval with set -x or set -v on, which would print every value; run set +xv first"))
+	fmt.Fprintf(&b, "*) if [ -f /dev/stdout ]; then echo %s >&2; false\n", shellQuote("gitvault: refusing to eval with stdout redirected to a file"))
+	fmt.Fprintf(&b, "  elif __gitvault_env=$(%s); then eval \"$__gitvault_env\"; unset __gitvault_env\n", strings.Join(quoted, " "))
+	b.WriteString("  else unset __gitvault_env; false; fi ;;\n")
+	b.WriteString("esac\n")
+	return b.Bytes(), nil
+}
+
+// shellQuote single-quotes s for POSIX sh, closing and reopening the
+// quotes around each embedded quote.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
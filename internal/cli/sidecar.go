@@ -0,0 +1,366 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/dotenv"
+	"github.com/aatuh/gitvault/internal/securemem"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/gitvault/internal/vaultfs"
+)
+
+const sidecarFiles = "files"
+
+// sidecarOutput is the directory k8s-sidecar keeps in step with one env.
+// written remembers the names it wrote, so a key or file that leaves the
+// vault also leaves the directory.
+type sidecarOutput struct {
+	dir     string
+	format  string
+	keys    []string
+	files   []string
+	written map[string]bool
+	// policy also checks the envs the written keys alias into.
+	policy *exportGuard
+	// mode and gid let a workload running as another user read the files;
+	// a zero mode keeps them owner-only and a gid of -1 keeps the group.
+	mode os.FileMode
+	gid  int
+}
+
+// runK8sSidecar writes one env into a directory, typically a memory-backed
+// emptyDir shared with the workload, then pulls the vault and rewrites
+// what changed on every interval until it is stopped.
+func (a App) runK8sSidecar(ctx context.Context, out ui.Output, vaultPath string, args []string) int {
+	start := time.Now()
+	fs := flag.NewFlagSet("k8s-sidecar", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setK8sSidecarUsage(fs)
+	project := fs.String("project", os.Getenv("GITVAULT_PROJECT"), "Project name (default $GITVAULT_PROJECT)")
+	env := fs.String("env", os.Getenv("GITVAULT_ENV"), "Environment name (default $GITVAULT_ENV)")
+	outDir := fs.String("out", "", "Directory to write to, e.g. an emptyDir volume with medium: Memory")
+	var keys, files stringSliceFlag
+	fs.Var(&keys, "key", "Only write this key (repeatable)")
+	fs.Var(&files, "file", "Only write this vault file (repeatable)")
+	format := fs.String("format", exportDotenv, "Key layout: dotenv (one .env) or files (one file per key)")
+	interval := fs.Duration("interval", time.Minute, "How often to pull the vault and refresh")
+	once := fs.Bool("once", false, "Write once and exit, for an init container")
+	allowOverride := fs.Bool("allow-export-override", false, "Write even if an export policy keeps this env to secret run")
+	modeFlag := fs.String("mode", "", "File mode in octal, e.g. 0440 (default owner-only)")
+	group := fs.String("group", "", "Group name or ID to own the written files")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	var usageErr error
+	switch {
+	case fs.NArg() > 0:
+		usageErr = errors.New("unexpected extra arguments")
+	case *project == "" || *env == "":
+		usageErr = errors.New("project and env required: pass --project and --env or set GITVAULT_PROJECT and GITVAULT_ENV")
+	case *outDir == "":
+		usageErr = errors.New("--out is required")
+	case *format != exportDotenv && *format != sidecarFiles:
+		usageErr = fmt.Errorf("unknown --format %q: use dotenv or files", *format)
+	case !*once && *interval <= 0:
+		usageErr = errors.New("--interval must be positive")
+	}
+	var mode os.FileMode
+	gid := -1
+	if usageErr == nil && *modeFlag != "" {
+		mode, usageErr = parseFileMode(*modeFlag)
+	}
+	if usageErr == nil && *group != "" {
+		gid, usageErr = lookupGroup(*group)
+	}
+	if usageErr != nil {
+		out.Error(usageErr)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	a.scope.project, a.scope.env = *project, *env
+
+	if vaultPath == "" {
+		vaultPath = os.Getenv("GITVAULT_VAULT")
+	}
+	repo := strings.TrimSpace(os.Getenv("GITVAULT_REPO"))
+	if repo == "" && vaultPath == "" {
+		out.Error(errVaultLocation)
+		return 2
+	}
+	root, err := a.openContainerVault(ctx, vaultPath, repo)
+	if err != nil {
+		out.Error(err)
+		printVaultNotFoundHint(err, out.Err)
+		return 1
+	}
+	if repo != "" {
+		defer os.RemoveAll(root)
+	}
+	policy, err := a.newExportGuard(out, root, *allowOverride)
+	if err == nil {
+		err = policy.check(*project, *env)
+	}
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if err := a.guardUpdatePath(ctx, root, *outDir, false); err != nil {
+		out.Error(err)
+		return 1
+	}
+
+	target := &sidecarOutput{dir: *outDir, format: *format, keys: keys, files: files, written: map[string]bool{}, policy: policy, mode: mode, gid: gid}
+	count, err := a.writeSidecar(ctx, root, *project, *env, target)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	out.Success("secrets written", map[string]string{"out": *outDir, "files": strconv.Itoa(count)})
+	if *once {
+		return 0
+	}
+	// A sidecar runs for the life of the pod, so each refresh is reported
+	// on its own instead of one command span at exit.
+	a.reportTelemetry(ctx, "k8s-sidecar refresh", start, 0)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+		start, code := time.Now(), 0
+		changed, err := a.refreshSidecar(ctx, repo, root, *project, *env, target)
+		if err != nil {
+			code = 1
+			fmt.Fprintf(out.Err, "warning: %v; keeping the current files\n", err)
+		} else if changed > 0 {
+			fmt.Fprintf(out.Err, "%s updated %d file(s)\n", time.Now().UTC().Format(time.RFC3339), changed)
+		}
+		a.reportTelemetry(ctx, "k8s-sidecar refresh", start, code)
+	}
+}
+
+// refreshSidecar pulls a cloned vault and rewrites target. A failed refresh
+// keeps the files from the last good one, so a flaky remote never empties
+// the workload's secrets.
+func (a App) refreshSidecar(ctx context.Context, repo, root, project, env string, target *sidecarOutput) (int, error) {
+	if repo != "" {
+		if err := a.fetchVault(ctx, repo, root); err != nil {
+			return 0, err
+		}
+	}
+	// The pull may change the settings, the export policies, and an
+	// obfuscated layout's index, so reload them before reading.
+	if err := a.openVault(root); err != nil {
+		return 0, err
+	}
+	policy, err := a.newExportGuard(target.policy.out, root, target.policy.override)
+	if err == nil {
+		err = policy.check(project, env)
+	}
+	if err != nil {
+		return 0, err
+	}
+	target.policy = policy
+	return a.writeSidecar(ctx, root, project, env, target)
+}
+
+// writeSidecar decrypts project/env into target and returns how many files
+// it wrote or removed; unchanged files are left alone so watchers on the
+// directory only fire for real changes. With neither --key nor --file every
+// key and file is written.
+func (a App) writeSidecar(ctx context.Context, root, project, env string, target *sidecarOutput) (int, error) {
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return 0, err
+	}
+	envIndex := indexEnv(idx, project, env)
+	if envIndex == nil {
+		return 0, fmt.Errorf("env %q not found in project %q", env, project)
+	}
+	all := len(target.keys) == 0 && len(target.files) == 0
+
+	contents := map[string][]byte{}
+	defer func() {
+		for _, data := range contents {
+			securemem.Wipe(data)
+		}
+	}()
+	if (all && len(envIndex.Keys) > 0) || len(target.keys) > 0 {
+		values, err := a.runValues(ctx, root, project, env, nil, target.policy)
+		if err != nil {
+			return 0, err
+		}
+		if !all {
+			selected := map[string]string{}
+			for _, key := range target.keys {
+				value, ok := values[key]
+				if !ok {
+					return 0, fmt.Errorf("key %s not found in %s/%s", key, project, env)
+				}
+				selected[key] = value
+			}
+			values = selected
+		}
+		if target.format == sidecarFiles {
+			for key, value := range values {
+				contents[key] = []byte(value)
+			}
+		} else {
+			contents[".env"] = dotenv.Render(values, target.keys)
+		}
+	}
+	names := target.files
+	if all {
+		names = slices.Sorted(maps.Keys(envIndex.Files))
+	}
+	for _, name := range names {
+		if _, ok := envIndex.Files[name]; !ok {
+			return 0, fmt.Errorf("file %s not found in %s/%s", name, project, env)
+		}
+		if _, ok := contents[name]; ok {
+			return 0, fmt.Errorf("%s is both a key and a file; use --format dotenv or pick one with --key/--file", name)
+		}
+		data, _, err := a.FileService.Get(ctx, root, project, env, name)
+		if err != nil {
+			return 0, fmt.Errorf("file %s: %w", name, err)
+		}
+		contents[name] = data
+	}
+
+	if err := target.makeDir(); err != nil {
+		return 0, err
+	}
+	changed := 0
+	for name, data := range contents {
+		path := filepath.Join(target.dir, name)
+		current, err := os.ReadFile(path)
+		same := err == nil && bytes.Equal(current, data)
+		securemem.Wipe(current)
+		if same {
+			continue
+		}
+		if err := target.replaceFile(path, data); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	for name := range target.written {
+		if _, ok := contents[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(target.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return changed, err
+		}
+		changed++
+	}
+	target.written = map[string]bool{}
+	for name := range contents {
+		target.written[name] = true
+	}
+	return changed, nil
+}
+
+// makeDir creates the output directory. One it creates gets search access
+// for whoever --mode lets read the files, and the --group.
+func (target *sidecarOutput) makeDir() error {
+	if _, err := os.Stat(target.dir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(target.dir, vaultfs.DirPerm); err != nil {
+		return err
+	}
+	if target.mode != 0 {
+		// Each class that may read the files may also enter the directory.
+		if err := os.Chmod(target.dir, vaultfs.DirPerm|target.mode&0444>>2); err != nil {
+			return err
+		}
+	}
+	if target.gid >= 0 {
+		return os.Chown(target.dir, -1, target.gid)
+	}
+	return nil
+}
+
+// replaceFile writes data next to path and renames it into place, so a
+// reader sees either the old content or the new, never half. The file is
+// owner-only unless --mode or --group says otherwise.
+func (target *sidecarOutput) replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if target.mode != 0 {
+		err = os.Chmod(tmp.Name(), target.mode)
+	} else {
+		err = vaultfs.Restrict(tmp.Name(), false)
+	}
+	if err != nil {
+		return err
+	}
+	if target.gid >= 0 {
+		if err := os.Chown(tmp.Name(), -1, target.gid); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// parseFileMode parses an octal permission such as 0440. Writable or
+// executable bits are refused: the files are replaced, never edited or run.
+// The owner keeps read access so refreshes can compare the current files.
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	switch {
+	case err != nil || mode > 0777:
+		return 0, fmt.Errorf("invalid --mode %q: use octal permissions such as 0440", value)
+	case mode&0333 != 0 || mode&0400 == 0:
+		return 0, fmt.Errorf("invalid --mode %q: use read bits only, including the owner's (0400)", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// lookupGroup resolves a group name or numeric ID.
+func lookupGroup(value string) (int, error) {
+	if gid, err := strconv.Atoi(value); err == nil && gid >= 0 {
+		return gid, nil
+	}
+	group, err := user.LookupGroup(value)
+	if err != nil {
+		return -1, fmt.Errorf("invalid --group %q: %w", value, err)
+	}
+	return strconv.Atoi(group.Gid)
+}
@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+type vaultStats struct {
+	Projects        int          `json:"projects"`
+	Envs            int          `json:"envs"`
+	Keys            int          `json:"keys"`
+	Files           int          `json:"files"`
+	Recipients      int          `json:"recipients"`
+	CiphertextBytes int64        `json:"ciphertext_bytes"`
+	LargestFiles    []fileStat   `json:"largest_files"`
+	OldestSecrets   []secretStat `json:"oldest_secrets"`
+	Missing         []string     `json:"missing,omitempty"`
+	Git             *gitStats    `json:"git,omitempty"`
+}
+
+type fileStat struct {
+	Ref             string `json:"ref"`
+	Size            int64  `json:"size"`
+	CiphertextBytes int64  `json:"ciphertext_bytes"`
+}
+
+type secretStat struct {
+	Ref         string    `json:"ref"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+func (a App) runStats(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setStatsUsage(fs)
+	top := fs.Int("top", 5, "Number of largest files and oldest secrets to show")
+	withGit := fs.Bool("git", false, "Add commit counts, ciphertext deltas, and growth from git history")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(fs.Args()) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *top < 0 {
+		out.Error(errors.New("--top must not be negative"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	stats, err := a.collectStats(root, *top)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+	if *withGit {
+		if stats.Git, err = a.collectGitStats(ctx, root, stats.CiphertextBytes, *top); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if out.JSON {
+		out.Success("vault statistics", stats)
+		return 0
+	}
+	out.Success("vault statistics", map[string]interface{}{
+		"projects":         stats.Projects,
+		"envs":             stats.Envs,
+		"keys":             stats.Keys,
+		"files":            stats.Files,
+		"recipients":       stats.Recipients,
+		"ciphertext_bytes": stats.CiphertextBytes,
+	})
+	if len(stats.LargestFiles) > 0 {
+		out.Info("")
+		out.Info("largest files:")
+		rows := make([][]string, 0, len(stats.LargestFiles))
+		for _, file := range stats.LargestFiles {
+			rows = append(rows, []string{file.Ref, strconv.FormatInt(file.Size, 10), strconv.FormatInt(file.CiphertextBytes, 10)})
+		}
+		out.Table([]string{"ref", "size", "ciphertext_bytes"}, rows)
+	}
+	if len(stats.OldestSecrets) > 0 {
+		out.Info("")
+		out.Info("oldest secrets:")
+		rows := make([][]string, 0, len(stats.OldestSecrets))
+		for _, secret := range stats.OldestSecrets {
+			rows = append(rows, []string{secret.Ref, secret.LastUpdated.Format("2006-01-02T15:04:05Z")})
+		}
+		out.Table([]string{"ref", "last_updated"}, rows)
+	}
+	if stats.Git != nil {
+		printGitStats(out, stats.Git)
+	}
+	if len(stats.Missing) > 0 {
+		fmt.Fprintf(out.Err, "warning: %d indexed path(s) have no ciphertext, e.g. %s\n", len(stats.Missing), stats.Missing[0])
+	}
+	return 0
+}
+
+func printGitStats(out ui.Output, stats *gitStats) {
+	out.Info("")
+	out.Info(fmt.Sprintf("git: %d commit(s), %d touching secrets or files; %d bytes of ciphertext in history, repository %d bytes", stats.Commits, stats.SecretCommits, stats.HistoryBytes, stats.RepoBytes))
+	if len(stats.LargestDeltas) > 0 {
+		out.Info("")
+		out.Info("largest ciphertext deltas:")
+		rows := make([][]string, 0, len(stats.LargestDeltas))
+		for _, delta := range stats.LargestDeltas {
+			rows = append(rows, []string{delta.Commit, delta.Date.Format("2006-01-02"), delta.Path, strconv.FormatInt(delta.Bytes, 10)})
+		}
+		out.Table([]string{"commit", "date", "path", "bytes"}, rows)
+	}
+	if len(stats.Growth) > 0 {
+		out.Info("")
+		out.Info("growth by month:")
+		rows := make([][]string, 0, len(stats.Growth))
+		for _, month := range stats.Growth {
+			rows = append(rows, []string{month.Month, strconv.Itoa(month.Commits), strconv.FormatInt(month.AddedBytes, 10), strconv.FormatInt(month.TotalBytes, 10)})
+		}
+		out.Table([]string{"month", "commits", "added_bytes", "total_bytes"}, rows)
+	}
+	for _, suggestion := range stats.Suggestions {
+		fmt.Fprintln(out.Err, "hint:", suggestion)
+	}
+}
+
+// collectStats works from the index and file sizes only; nothing is decrypted.
+func (a App) collectStats(root string, top int) (vaultStats, error) {
+	stats := vaultStats{LargestFiles: []fileStat{}, OldestSecrets: []secretStat{}}
+	idx, err := a.Store.LoadIndex(root)
+	if err != nil {
+		return stats, err
+	}
+	recipients, err := a.KeysService.List(root)
+	if err != nil {
+		return stats, err
+	}
+	stats.Recipients = len(recipients)
+
+	var files []fileStat
+	var secrets []secretStat
+	for project, p := range idx.Projects {
+		stats.Projects++
+		for env, e := range p.Envs {
+			stats.Envs++
+			if len(e.Keys) > 0 {
+				size, err := a.ciphertextSize(a.Store.SecretFilePath(root, project, env))
+				if err != nil {
+					stats.Missing = append(stats.Missing, project+"/"+env)
+				}
+				stats.CiphertextBytes += size
+			}
+			for key, meta := range e.Keys {
+				stats.Keys++
+				secrets = append(secrets, secretStat{Ref: project + "/" + env + "/" + key, LastUpdated: meta.LastUpdated})
+			}
+			for name, meta := range e.Files {
+				stats.Files++
+				ref := project + "/" + env + "/" + name
+				size, err := a.ciphertextSize(a.Store.FilePath(root, project, env, name))
+				if err != nil {
+					stats.Missing = append(stats.Missing, ref)
+				}
+				stats.CiphertextBytes += size
+				files = append(files, fileStat{Ref: ref, Size: meta.Size, CiphertextBytes: size})
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].CiphertextBytes != files[j].CiphertextBytes {
+			return files[i].CiphertextBytes > files[j].CiphertextBytes
+		}
+		return files[i].Ref < files[j].Ref
+	})
+	sort.Slice(secrets, func(i, j int) bool {
+		if !secrets[i].LastUpdated.Equal(secrets[j].LastUpdated) {
+			return secrets[i].LastUpdated.Before(secrets[j].LastUpdated)
+		}
+		return secrets[i].Ref < secrets[j].Ref
+	})
+	sort.Strings(stats.Missing)
+	stats.LargestFiles = append(stats.LargestFiles, files[:min(top, len(files))]...)
+	stats.OldestSecrets = append(stats.OldestSecrets, secrets[:min(top, len(secrets))]...)
+	return stats, nil
+}
+
+func (a App) ciphertextSize(path string) (int64, error) {
+	info, err := a.Store.FS.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+const provenancePrefix = "# gitvault-export:"
+
+// provenance is the header `export-env --header` writes above the values so
+// a .env file can later be traced back to the vault state it came from.
+type provenance struct {
+	Vault    string
+	Project  string
+	Env      string
+	Commit   string
+	Exported time.Time
+}
+
+func (p provenance) header() []byte {
+	fields := []string{provenancePrefix, "vault=" + p.Vault, "project=" + p.Project, "env=" + p.Env}
+	if p.Commit != "" {
+		fields = append(fields, "commit="+p.Commit)
+	}
+	fields = append(fields, "exported="+p.Exported.UTC().Format(time.RFC3339))
+	return []byte(strings.Join(fields, " ") + "\n")
+}
+
+// readProvenance finds the export header in a dotenv file, if there is one.
+func readProvenance(data []byte) (provenance, bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, provenancePrefix) {
+			continue
+		}
+		var p provenance
+		for _, field := range strings.Fields(strings.TrimPrefix(line, provenancePrefix)) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "vault":
+				p.Vault = value
+			case "project":
+				p.Project = value
+			case "env":
+				p.Env = value
+			case "commit":
+				p.Commit = value
+			case "exported":
+				p.Exported, _ = time.Parse(time.RFC3339, value)
+			}
+		}
+		return p, true
+	}
+	return provenance{}, false
+}
+
+// vaultCommit returns the vault's HEAD commit, or "" outside git.
+func (a App) vaultCommit(ctx context.Context, root string) string {
+	if a.Sync.Git == nil {
+		return ""
+	}
+	if isRepo, err := a.Sync.Git.IsRepo(ctx, root); err != nil || !isRepo {
+		return ""
+	}
+	info, err := a.Sync.Git.LastCommitInfo(ctx, root, root)
+	if err != nil {
+		return ""
+	}
+	return info.Hash
+}
+
+func (a App) newProvenance(ctx context.Context, root, project, env string) (provenance, error) {
+	cfg, err := a.Store.LoadConfig(root)
+	if err != nil {
+		return provenance{}, err
+	}
+	return provenance{
+		Vault:    cfg.Name,
+		Project:  project,
+		Env:      env,
+		Commit:   a.vaultCommit(ctx, root),
+		Exported: time.Now(),
+	}, nil
+}
+
+func (a App) runSecretStatus(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("secret status", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSecretStatusUsage(fs)
+	project := fs.String("project", "", "Project name (default: from the file's export header)")
+	env := fs.String("env", "", "Environment name (default: from the file's export header)")
+	file := fs.String("file", ".env", "Dotenv file to compare")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	remaining, err := a.fillProjectEnv(project, env, fs.Args(), 0)
+	if err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if len(remaining) > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	header, hasHeader := readProvenance(data)
+	if *project == "" && hasHeader {
+		*project, *env = header.Project, header.Env
+	}
+	if *project == "" || *env == "" {
+		out.Error(errors.New("--project and --env are required when the file has no export header"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	local, _ := domain.ParseDotenv(data)
+	drift, err := a.statusDrift(ctx, root, *project, *env, local.Values)
+	if err != nil {
+		out.Error(err)
+		printSopsHint(err, out.Err, out.JSON)
+		return 1
+	}
+
+	commit := a.vaultCommit(ctx, root)
+	if hasHeader && header.Commit != "" && commit != "" && header.Commit != commit && !out.JSON {
+		fmt.Fprintf(out.Err, "note: %s was exported at commit %s; the vault is now at %s\n", *file, shortHash(header.Commit), shortHash(commit))
+	}
+	if len(drift) == 0 {
+		out.Success("up to date", map[string]string{"path": *file, "project": *project, "env": *env})
+		return 0
+	}
+	out.Table([]string{"key", "status"}, drift)
+	if !out.JSON {
+		fmt.Fprintf(out.Err, "hint: run `gitvault secret export-env %s %s --out %s --force` or `gitvault secret apply-env %s %s --file %s` to refresh it\n", *project, *env, *file, *project, *env, *file)
+	}
+	return 1
+}
+
+// statusDrift compares local against project/env. Current value digests
+// are compared when recorded, so no decrypt (or identity) is needed.
+func (a App) statusDrift(ctx context.Context, root, project, env string, local map[string]string) ([][]string, error) {
+	if meta, digests, ok := a.valueDigests(root, project, env); ok {
+		hashed := make(map[string]string, len(local))
+		for key, value := range local {
+			digest, err := meta.ValueDigest(value)
+			if err != nil {
+				return nil, err
+			}
+			hashed[key] = digest
+		}
+		return diffDotenv(digests, hashed), nil
+	}
+	payload, err := a.exportEnv(ctx, root, project, env)
+	if err != nil {
+		return nil, err
+	}
+	vault, _ := domain.ParseDotenv(payload)
+	return diffDotenv(vault.Values, local), nil
+}
+
+// diffDotenv lists keys whose values differ between the vault and a local
+// file: missing locally, changed, or only present locally.
+func diffDotenv(vault, local map[string]string) [][]string {
+	keys := make([]string, 0, len(vault)+len(local))
+	for key := range vault {
+		keys = append(keys, key)
+	}
+	for key := range local {
+		if _, ok := vault[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	rows := [][]string{}
+	for _, key := range keys {
+		want, inVault := vault[key]
+		got, inLocal := local[key]
+		switch {
+		case !inLocal:
+			rows = append(rows, []string{key, "missing"})
+		case !inVault:
+			rows = append(rows, []string{key, "extra"})
+		case want != got:
+			rows = append(rows, []string{key, "changed"})
+		}
+	}
+	return rows
+}
+
+// exportDiff compares an export payload with the dotenv file at path, as
+// rows of key and added, removed, or changed. A missing file counts as
+// empty. Values are appended only when showValues is set.
+func exportDiff(payload []byte, path string, showValues bool) ([][]string, error) {
+	local := domain.Dotenv{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		local, _ = domain.ParseDotenv(data)
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	vault, _ := domain.ParseDotenv(payload)
+	changes := map[string]string{"missing": "added", "extra": "removed", "changed": "changed"}
+	rows := diffDotenv(vault.Values, local.Values)
+	for i, row := range rows {
+		row[1] = changes[row[1]]
+		if showValues {
+			row = append(row, local.Values[row[0]], vault.Values[row[0]])
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/gitsync"
+	"github.com/aatuh/gitvault/internal/settings"
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+func (a App) runSyncConfig(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("sync config", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setSyncConfigUsage(fs)
+	remote := fs.String("remote", "", "Default remote")
+	branch := fs.String("branch", "", "Default branch")
+	var mirrors stringSliceFlag
+	fs.Var(&mirrors, "mirror", "Backup remote every push is repeated to (repeatable)")
+	clearDefaults := fs.Bool("clear", false, "Remove all sync defaults")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if err := validateSyncTarget(*remote, *branch, mirrors); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	vaultSettings, err := settings.Load(a.Store.FS, root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	changed := *clearDefaults || *remote != "" || *branch != "" || len(mirrors) > 0
+	if changed {
+		defaults := settings.Sync{}
+		if vaultSettings.Sync != nil && !*clearDefaults {
+			defaults = *vaultSettings.Sync
+		}
+		if *remote != "" {
+			defaults.Remote = *remote
+		}
+		if *branch != "" {
+			defaults.Branch = *branch
+		}
+		if len(mirrors) > 0 {
+			defaults.Mirrors = mirrors
+		}
+		vaultSettings.Sync = &defaults
+		if defaults.Remote == "" && defaults.Branch == "" && len(defaults.Mirrors) == 0 {
+			vaultSettings.Sync = nil
+		}
+		if err := settings.Save(a.Store.FS, root, vaultSettings); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	defaults := settings.Sync{}
+	if vaultSettings.Sync != nil {
+		defaults = *vaultSettings.Sync
+	}
+	if out.JSON {
+		out.Success("sync defaults", map[string]interface{}{"remote": defaults.Remote, "branch": defaults.Branch, "mirrors": defaults.Mirrors})
+		return 0
+	}
+	out.Table([]string{"setting", "value"}, [][]string{
+		{"remote", valueOr(defaults.Remote, "(upstream)")},
+		{"branch", valueOr(defaults.Branch, "(upstream)")},
+		{"mirrors", valueOr(strings.Join(defaults.Mirrors, ","), "(none)")},
+	})
+	return 0
+}
+
+func validateSyncTarget(remote, branch string, mirrors []string) error {
+	if err := gitsync.ValidateName(remote, "remote"); err != nil {
+		return err
+	}
+	if err := gitsync.ValidateName(branch, "branch"); err != nil {
+		return err
+	}
+	for _, mirror := range mirrors {
+		if err := gitsync.ValidateName(mirror, "mirror"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/team"
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/services"
+)
+
+func (a App) runTeam(ctx context.Context, out ui.Output, root string, args []string) int {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		printTeamUsage(out.Out)
+		return 0
+	}
+	switch args[0] {
+	case "list":
+		if isHelpRequest(args[1:]) {
+			printTeamUsage(out.Out)
+			return 0
+		}
+		return a.runTeamList(out, root)
+	case "add":
+		return a.runTeamAdd(ctx, out, root, args[1:])
+	case "remove":
+		return a.runTeamRemove(out, root, args[1:])
+	case "sync":
+		return a.runTeamSync(out, root, args[1:])
+	default:
+		out.Error(fmt.Errorf("unknown team subcommand: %s", args[0]))
+		printTeamUsage(out.Err)
+		return 2
+	}
+}
+
+func (a App) runTeamList(out ui.Output, root string) int {
+	roster, ok, err := team.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if !ok {
+		out.Success("no team roster; add members with `gitvault team add`", nil)
+		return 0
+	}
+	rows := [][]string{}
+	for _, member := range roster.Members {
+		for _, recipient := range member.Recipients {
+			rows = append(rows, []string{member.Name, recipient})
+		}
+	}
+	out.Table([]string{"member", "recipient"}, rows)
+	return 0
+}
+
+func (a App) runTeamAdd(ctx context.Context, out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("team add", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setTeamAddUsage(fs)
+	fromFile := fs.String("from-file", "", "Read the member's recipients from a file (- for stdin)")
+	fromURL := fs.String("from-url", "", "Fetch the member's recipients from an https URL")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		out.Error(errors.New("member name is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if *fromFile != "" && *fromURL != "" {
+		out.Error(errors.New("--from-file and --from-url cannot be combined"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	name := fs.Arg(0)
+	if err := domain.ValidateIdentifier(name, "member name"); err != nil {
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	var recipients, skipped []string
+	for _, arg := range fs.Args()[1:] {
+		recipient, err := normalizeRecipient(arg)
+		if err != nil {
+			out.Error(err)
+			printFlagUsage(fs, out.Err)
+			return 2
+		}
+		recipients = append(recipients, recipient)
+	}
+	if *fromFile != "" || *fromURL != "" {
+		data, err := readKeySource(ctx, *fromFile, *fromURL)
+		if err != nil {
+			out.Error(err)
+			return 1
+		}
+		var found []string
+		found, skipped = parseKeyLines(data)
+		recipients = append(recipients, found...)
+	}
+	if len(recipients) == 0 {
+		out.Error(errors.New("at least one recipient is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+
+	roster, existed, err := team.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	i := roster.Find(name)
+	if i < 0 {
+		roster.Members = append(roster.Members, team.Member{Name: name})
+		i = len(roster.Members) - 1
+	}
+	member := &roster.Members[i]
+	for _, recipient := range recipients {
+		if owner, ok := roster.Owner(recipient); ok {
+			if owner != name {
+				out.Error(fmt.Errorf("recipient %s already belongs to %s", recipient, owner))
+				return 1
+			}
+			continue
+		}
+		member.Recipients = append(member.Recipients, recipient)
+	}
+	if err := team.Save(root, roster); err != nil {
+		out.Error(err)
+		return 1
+	}
+	for _, recipient := range recipients {
+		if err := a.KeysService.Add(root, recipient); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	out.Success("team member saved", map[string]interface{}{"name": name, "recipients": recipients})
+	for _, line := range skipped {
+		fmt.Fprintln(out.Err, "warning: skipped "+line)
+	}
+	if !existed {
+		if configured, err := a.KeysService.List(root); err == nil {
+			if unnamed := subtractRecipients(configured, roster.Recipients()); len(unnamed) > 0 {
+				fmt.Fprintf(out.Err, "warning: %d configured recipient(s) are not in the new roster; add them with `gitvault team add` before running `gitvault team sync`\n", len(unnamed))
+			}
+		}
+	}
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` to re-encrypt existing secrets for the new recipients")
+	}
+	return 0
+}
+
+func (a App) runTeamRemove(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("team remove", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setTeamRemoveUsage(fs)
+	force := fs.Bool("force", false, "Remove even the last recipient or your own")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() != 1 {
+		out.Error(errors.New("member name is required"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	name := fs.Arg(0)
+	roster, ok, err := team.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	i := roster.Find(name)
+	if !ok || i < 0 {
+		out.Error(fmt.Errorf("no team member named %s", name))
+		return 1
+	}
+	removing := roster.Members[i].Recipients
+	roster.Members = append(roster.Members[:i], roster.Members[i+1:]...)
+
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	warnings := a.removalWarnings(configured, removing)
+	if len(warnings) > 0 && !*force {
+		out.Error(fmt.Errorf("refusing to remove %s: %s (use --force to remove anyway)", name, strings.Join(warnings, "; ")))
+		return 1
+	}
+	if err := a.dropRecipients(root, removing); err != nil {
+		out.Error(err)
+		return 1
+	}
+	if err := team.Save(root, roster); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Success("team member removed", map[string]interface{}{"name": name, "recipients": removing})
+	for _, warning := range warnings {
+		fmt.Fprintln(out.Err, "warning: "+warning)
+	}
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` so existing secrets are no longer encrypted to them")
+	}
+	return 0
+}
+
+func (a App) runTeamSync(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("team sync", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setTeamSyncUsage(fs)
+	force := fs.Bool("force", false, "Remove even the last recipient or your own")
+	dryRun := fs.Bool("dry-run", false, "Show the changes without applying them")
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	roster, ok, err := team.Load(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if !ok {
+		out.Error(errors.New("no team roster; add members with `gitvault team add`"))
+		return 1
+	}
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	adding := subtractRecipients(roster.Recipients(), configured)
+	removing := subtractRecipients(configured, roster.Recipients())
+	if len(adding) == 0 && len(removing) == 0 {
+		out.Success("recipients match the team roster", nil)
+		return 0
+	}
+	rows := make([][]string, 0, len(adding)+len(removing))
+	for _, recipient := range adding {
+		owner, _ := roster.Owner(recipient)
+		rows = append(rows, []string{"add", recipient, owner})
+	}
+	for _, recipient := range removing {
+		rows = append(rows, []string{"remove", recipient, ""})
+	}
+	if *dryRun {
+		out.Table([]string{"action", "recipient", "member"}, rows)
+		return 0
+	}
+
+	warnings := a.removalWarnings(configured, removing)
+	if len(warnings) > 0 && !*force {
+		out.Error(fmt.Errorf("refusing to sync: %s (use --force to sync anyway)", strings.Join(warnings, "; ")))
+		return 1
+	}
+	for _, recipient := range adding {
+		if err := a.KeysService.Add(root, recipient); err != nil {
+			out.Error(err)
+			return 1
+		}
+	}
+	if err := a.dropRecipients(root, removing); err != nil {
+		out.Error(err)
+		return 1
+	}
+	out.Table([]string{"action", "recipient", "member"}, rows)
+	for _, warning := range warnings {
+		fmt.Fprintln(out.Err, "warning: "+warning)
+	}
+	if !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` to re-encrypt existing secrets for the new recipients")
+	}
+	return 0
+}
+
+// dropRecipients removes recipients from the key groups and the vault config.
+func (a App) dropRecipients(root string, recipients []string) error {
+	for _, recipient := range recipients {
+		if err := a.dropFromKeyGroups(root, recipient); err != nil {
+			return err
+		}
+		if err := a.KeysService.Remove(root, recipient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subtractRecipients returns the recipients that are not in exclude.
+func subtractRecipients(recipients, exclude []string) []string {
+	skip := map[string]bool{}
+	for _, recipient := range exclude {
+		skip[recipient] = true
+	}
+	var out []string
+	for _, recipient := range recipients {
+		if !skip[recipient] {
+			out = append(out, recipient)
+		}
+	}
+	return out
+}
+
+// checkTeamRoster reports drift between the roster and the vault recipients.
+func (a App) checkTeamRoster(root string) []services.CheckResult {
+	roster, ok, err := team.Load(root)
+	if err != nil {
+		return []services.CheckResult{{Name: "team roster", Status: services.CheckFail, Message: err.Error()}}
+	}
+	if !ok {
+		return nil
+	}
+	configured, err := a.KeysService.List(root)
+	if err != nil {
+		return []services.CheckResult{{Name: "team roster", Status: services.CheckFail, Message: err.Error()}}
+	}
+	unnamed := subtractRecipients(configured, roster.Recipients())
+	missing := subtractRecipients(roster.Recipients(), configured)
+	result := services.CheckResult{Name: "team roster", Status: services.CheckOK}
+	if len(unnamed) == 0 && len(missing) == 0 {
+		result.Message = fmt.Sprintf("%d member(s) match the recipients", len(roster.Members))
+		return []services.CheckResult{result}
+	}
+	result.Status = services.CheckWarn
+	result.Message = fmt.Sprintf("%d recipient(s) not in the roster, %d roster recipient(s) not configured; run `gitvault team sync`", len(unnamed), len(missing))
+	return []services.CheckResult{result}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// telemetryTimeout bounds the export after each command, so an unreachable
+// collector delays gitvault by at most this much.
+const telemetryTimeout = 3 * time.Second
+
+// telemetryName names a command for telemetry: the command and, for
+// commands with subcommands, a known subcommand. Other arguments are never
+// included, since they can be project, env, or key names.
+func telemetryName(args []string) string {
+	name := args[0]
+	if !isCommand(name) {
+		return "unknown"
+	}
+	if subs, ok := docSubcommands[name]; ok && len(args) > 1 && slices.Contains(subs, args[1]) {
+		name += " " + args[1]
+	}
+	return name
+}
+
+// reportTelemetry records a finished command and sends it; a collector
+// that cannot be reached is a warning, never a failure.
+func (a App) reportTelemetry(ctx context.Context, name string, start time.Time, code int) {
+	if a.Telemetry == nil {
+		return
+	}
+	var attrs map[string]string
+	if a.Telemetry.IncludeNames && a.scope != nil && a.scope.project != "" {
+		attrs = map[string]string{"gitvault.project": a.scope.project, "gitvault.env": a.scope.env}
+	}
+	a.Telemetry.Command(name, start, code, attrs, a.Timings)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), telemetryTimeout)
+	defer cancel()
+	if err := a.Telemetry.Flush(ctx); err != nil {
+		fmt.Fprintf(a.Err, "warning: telemetry: %v\n", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"strings"
 
+	"github.com/aatuh/gitvault/internal/vaultfs"
 	"github.com/aatuh/sealr/services"
 )
 
@@ -34,19 +35,48 @@ func isHelpRequest(args []string) bool {
 	return false
 }
 
+// commandSummaries is the top-level command list shared by help output and
+// `docs generate`.
+var commandSummaries = []struct{ name, summary string }{
+	{"setup", "Prepare a new machine: tools, age identity, and vault access"},
+	{"init", "Initialize a vault repository"},
+	{"doctor", "Verify prerequisites and key access"},
+	{"secret", "Manage secrets (set/unset/import/export/list/find/run)"},
+	{"file", "Store and retrieve binary files"},
+	{"project", "List, create, and rename projects"},
+	{"env", "List, clone, and rename environments"},
+	{"keys", "Manage recipients"},
+	{"team", "Manage the named team roster recipients derive from"},
+	{"identity", "Manage local age identities"},
+	{"find", "Search secret and file refs across the whole vault"},
+	{"stats", "Summarize vault contents and sizes"},
+	{"status", "List exported files on this machine that are out of date"},
+	{"fsck", "Find drift between the index and stored ciphertexts"},
+	{"reminders", "List keys past their rotation window"},
+	{"gc", "Rewrite vault history to drop committed plaintext or old large blobs"},
+	{"verify", "Check ciphertext recipients against the config without decrypting"},
+	{"ci", "Guard a vault repository in its CI pipeline"},
+	{"docker-entrypoint", "Fetch the vault and exec a container command with secrets injected"},
+	{"k8s-sidecar", "Keep a directory (e.g. an emptyDir) in step with one env"},
+	{"batch", "Run newline-delimited JSON operations in one process"},
+	{"mount", "Serve decrypted secrets and files as a read-only filesystem"},
+	{"dump-index", "Print the vault structure as JSON or YAML, without values"},
+	{"sync", "Git pull/push wrappers and pushes to hosting platforms"},
+	{"link", "Point an app repository at its vault via .gitvault.ref"},
+	{"alias", "Manage command shortcuts in the user config"},
+	{"hooks", "List and trust the vault's pre/post command hooks"},
+	{"docs", "Generate man pages or a markdown reference"},
+}
+
 func printUsage(w io.Writer) {
-	fmt.Fprintln(w, "gitvault [--vault PATH] [--json] <command> [args]")
+	fmt.Fprintln(w, "gitvault [--vault PATH] [--json] [--quiet] [--no-color] [--verbose] <command> [args]")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Commands:")
-	fmt.Fprintln(w, "  init           Initialize a vault repository")
-	fmt.Fprintln(w, "  doctor         Verify prerequisites and key access")
-	fmt.Fprintln(w, "  secret         Manage secrets (set/unset/import/export/list/find/run)")
-	fmt.Fprintln(w, "  file           Store and retrieve binary files")
-	fmt.Fprintln(w, "  project        List projects")
-	fmt.Fprintln(w, "  env            List environments")
-	fmt.Fprintln(w, "  keys           Manage recipients")
-	fmt.Fprintln(w, "  sync           Git pull/push wrappers")
+	for _, cmd := range commandSummaries {
+		fmt.Fprintf(w, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
 	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Other commands run a gitvault-<command> executable from PATH, git-style.")
 	fmt.Fprintln(w, "Run `gitvault <command> --help` for details.")
 }
 
@@ -54,14 +84,23 @@ func printSecretUsage(w io.Writer) {
 	fmt.Fprintln(w, "gitvault secret <subcommand> [args]")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Subcommands:")
-	fmt.Fprintln(w, "  set         Set a key value")
-	fmt.Fprintln(w, "  unset       Remove a key")
-	fmt.Fprintln(w, "  import-env  Import dotenv file (alias: import)")
-	fmt.Fprintln(w, "  export-env  Export dotenv file (alias: export)")
-	fmt.Fprintln(w, "  apply-env   Update a dotenv file in-place (alias: apply)")
-	fmt.Fprintln(w, "  list        List keys")
-	fmt.Fprintln(w, "  find        Search keys")
-	fmt.Fprintln(w, "  run         Run a command with env injected")
+	fmt.Fprintln(w, "  set             Set a key value")
+	fmt.Fprintln(w, "  unset           Remove a key")
+	fmt.Fprintln(w, "  import-env      Import dotenv file (alias: import)")
+	fmt.Fprintln(w, "  import-compose  Import environment blocks from a docker compose file")
+	fmt.Fprintln(w, "  export-env      Export dotenv file (alias: export)")
+	fmt.Fprintln(w, "  apply-env       Update a dotenv file in-place (alias: apply)")
+	fmt.Fprintln(w, "  list            List keys")
+	fmt.Fprintln(w, "  find            Search keys")
+	fmt.Fprintln(w, "  grep            Search decrypted values")
+	fmt.Fprintln(w, "  dedup-report    List values reused across keys, envs, and projects")
+	fmt.Fprintln(w, "  run             Run a command with env injected")
+	fmt.Fprintln(w, "  status          Compare a dotenv file with the vault")
+	fmt.Fprintln(w, "  template        Render a text/template file with secrets")
+	fmt.Fprintln(w, "  report          Export key metadata (no values) as a table, CSV, or TSV")
+	fmt.Fprintln(w, "  audience        Mark who a key is for (ci, deploy, human)")
+	fmt.Fprintln(w, "  alias           Make a key take its value from another key")
+	fmt.Fprintln(w, "  deprecate       Mark a key as deprecated, with its replacement")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Project/env can be passed with --project/--env or as positional arguments.")
 	fmt.Fprintln(w, "Flags may appear before or after positional arguments.")
@@ -71,14 +110,19 @@ func printSecretUsage(w io.Writer) {
 
 func printProjectUsage(w io.Writer) {
 	fmt.Fprintln(w, "gitvault project list")
+	fmt.Fprintln(w, "gitvault project rename [--commit] <old> <new>")
+	fmt.Fprintln(w, "gitvault project new --template <name> [--envs a,b] [--commit] <project>")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Projects are inferred from stored secrets.")
 	fmt.Fprintln(w, "Create one by setting a secret, e.g.:")
 	fmt.Fprintln(w, "  gitvault secret set <project> <env> API_KEY value")
+	fmt.Fprintln(w, "or from a template in .gitvault/templates with `project new`.")
 }
 
 func printEnvUsage(w io.Writer) {
 	fmt.Fprintln(w, "gitvault env list --project <name>")
+	fmt.Fprintln(w, "gitvault env rename --project <name> [--commit] <old> <new>")
+	fmt.Fprintln(w, "gitvault env clone --project <name> --from <env> --to <env> [--commit]")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Environments are inferred from stored secrets.")
 	fmt.Fprintln(w, "Create one by setting a secret, e.g.:")
@@ -86,15 +130,47 @@ func printEnvUsage(w io.Writer) {
 }
 
 func printKeysUsage(w io.Writer) {
-	fmt.Fprintln(w, "gitvault keys <list|add|remove|rotate> [args]")
+	fmt.Fprintln(w, "gitvault keys <list|add|remove|groups|rotate> [args]")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Examples:")
-	fmt.Fprintln(w, "  gitvault keys list")
+	fmt.Fprintln(w, "  gitvault keys list [--identity]")
 	fmt.Fprintln(w, "  gitvault keys add age1...")
-	fmt.Fprintln(w, "  gitvault keys remove age1...")
-	fmt.Fprintln(w, "  gitvault keys rotate")
+	fmt.Fprintln(w, "  gitvault keys add pgp:85D77543B3D624B63CEA9E6DBC17301B491B3F21")
+	fmt.Fprintln(w, "  gitvault keys add --from-file teammate.pub")
+	fmt.Fprintln(w, "  gitvault keys add --from-url https://github.com/<user>.keys")
+	fmt.Fprintln(w, "  gitvault keys remove [--force] age1...")
+	fmt.Fprintln(w, "  gitvault keys groups [list|clear]")
+	fmt.Fprintln(w, "  gitvault keys groups set --threshold 2 --group age1a...,age1b... --group age1c... --group pgp:...")
+	fmt.Fprintln(w, "  gitvault keys rotate [--force] [--details] [--commit]")
+	fmt.Fprintln(w, "  gitvault keys rotate --replace age1old... age1new... [--commit]")
 	fmt.Fprintln(w, "")
-	fmt.Fprintln(w, "Recipients must be age public keys (start with 'age1').")
+	fmt.Fprintln(w, "Recipients are age public keys (start with 'age1') or PGP fingerprints")
+	fmt.Fprintln(w, "prefixed with 'pgp:'; PGP decryption needs gpg and the secret key in its keyring.")
+	fmt.Fprintln(w, "list --identity shows the local identity file each recipient can be decrypted")
+	fmt.Fprintln(w, "with (age identities only) and warns when none is yours.")
+	fmt.Fprintln(w, "groups splits recipients into key groups of which --threshold must cooperate to")
+	fmt.Fprintln(w, "decrypt (SOPS Shamir secret sharing); run rotate afterwards to apply them.")
+	fmt.Fprintln(w, "rotate keeps files already encrypted for the current recipients byte-for-byte;")
+	fmt.Fprintln(w, "--force re-encrypts everything with fresh data keys; --details reports each file.")
+	fmt.Fprintln(w, "--replace swaps one recipient for another (keeping its key group and roster entry)")
+	fmt.Fprintln(w, "and re-encrypts secrets and files with fresh data keys in one step; if any of")
+	fmt.Fprintln(w, "them fails, everything is restored.")
+	fmt.Fprintln(w, "--commit commits the result to the vault's git repository.")
+}
+
+func printTeamUsage(w io.Writer) {
+	fmt.Fprintln(w, "gitvault team <list|add|remove|sync> [args]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Examples:")
+	fmt.Fprintln(w, "  gitvault team list")
+	fmt.Fprintln(w, "  gitvault team add alice age1...")
+	fmt.Fprintln(w, "  gitvault team add bob --from-url https://github.com/bob.keys")
+	fmt.Fprintln(w, "  gitvault team remove [--force] alice")
+	fmt.Fprintln(w, "  gitvault team sync [--dry-run] [--force]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "The roster lives in .gitvault/team.json and maps names to recipients, so key")
+	fmt.Fprintln(w, "changes are reviewable with a name attached. add and remove update the vault")
+	fmt.Fprintln(w, "recipients too; sync makes them match the roster after it was edited by hand.")
 }
 
 func printFileUsage(w io.Writer) {
@@ -104,6 +180,7 @@ func printFileUsage(w io.Writer) {
 	fmt.Fprintln(w, "  put    Store a binary file")
 	fmt.Fprintln(w, "  get    Retrieve a binary file")
 	fmt.Fprintln(w, "  list   List stored files")
+	fmt.Fprintln(w, "  exec   Run a command that reads a file from a named pipe")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "Project/env can be passed with --project/--env or as positional arguments.")
 	fmt.Fprintln(w, "Flags may appear before or after positional arguments.")
@@ -114,38 +191,84 @@ func printFileUsage(w io.Writer) {
 	fmt.Fprintln(w, "Run `gitvault file <subcommand> --help` for details.")
 }
 
+func printIdentityUsage(w io.Writer) {
+	fmt.Fprintln(w, "gitvault identity <subcommand> [args]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Subcommands:")
+	fmt.Fprintln(w, "  list     List discovered identities and their recipients")
+	fmt.Fprintln(w, "  add      Add an identity file to the user config")
+	fmt.Fprintln(w, "  path     Print the active identity file path")
+	fmt.Fprintln(w, "  check    Verify local identities can decrypt the vault")
+	fmt.Fprintln(w, "  import   Store an age identity in the OS keyring")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run `gitvault identity <subcommand> --help` for details.")
+}
+
 func printSyncUsage(w io.Writer) {
-	fmt.Fprintln(w, "gitvault sync pull [--allow-dirty]")
-	fmt.Fprintln(w, "gitvault sync push [--allow-dirty]")
+	fmt.Fprintln(w, "gitvault sync pull [--allow-dirty] [--remote <name>] [--branch <name>]")
+	fmt.Fprintln(w, "gitvault sync push [--allow-dirty] [--remote <name>] [--branch <name>] [--mirror <remote>]... [--no-mirror]")
+	fmt.Fprintln(w, "gitvault sync config [--remote <name>] [--branch <name>] [--mirror <remote>]... [--clear]")
+	fmt.Fprintln(w, "gitvault sync github-secrets [<project> <env>] --repo <owner/name> [--environment <name>] [--dry-run] [--allow-export-override]")
+	for _, platform := range []string{"vercel", "netlify", "heroku"} {
+		fmt.Fprintln(w, syncPlatformUsageLine(platform))
+	}
 }
 
 func setInitUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault init [--path <dir>] [--name <name>] [--recipient <age1...>] [--force] [--skip-git]",
-		[]string{"Initializes a vault repository layout."},
-		[]string{"gitvault init --path ./vault --name my-vault --recipient age1..."},
+		"gitvault init [--path <dir>] [--name <name>] [--recipient <age1...>] [--force] [--skip-git] [--obfuscate-names] [--remote <url> [--push]]",
+		[]string{
+			"Initializes a vault repository layout, plus a .gitattributes that keeps git",
+			"from merging encrypted files line by line and a .gitignore for temp files",
+			"and stray plaintext. Existing files are kept.",
+			"--obfuscate-names hashes project, env, and file names on disk and encrypts the index.",
+			"--remote adds origin; --push also commits the new vault and pushes it upstream.",
+		},
+		[]string{
+			"gitvault init --path ./vault --name my-vault --recipient age1...",
+			"gitvault init --path ./vault --recipient age1... --remote git@github.com:team/vault.git --push",
+		},
 	)
 }
 
 func setDoctorUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault doctor",
-		[]string{"Verifies SOPS availability, key access, and decryptability."},
-		nil,
+		"gitvault doctor [--fix] [--deep [--parallel N]] [--no-remote] [--remote-timeout 10s]",
+		[]string{
+			"Verifies SOPS availability, key access, and decryptability.",
+			"Local identities are matched against the vault's recipients (decrypting",
+			"one secret when none match), so a missing key shows up before a command",
+			"needs it.",
+			"Vault files should be 0600 and directories 0700; --fix repairs them, and",
+			"writes the .gitattributes and .gitignore `gitvault init` creates if missing.",
+			"--deep decrypts every secret and file and reports each path that fails,",
+			"classified as missing identity, recipient mismatch, or corrupt.",
+			"Git vaults also get `git ls-remote origin` within --remote-timeout, so auth",
+			"and network problems show up before a sync; --no-remote skips it.",
+			"Every sops and git call is timed; local calls slower than 2s are flagged,",
+			"which usually points at KMS latency or antivirus scanning temp files.",
+		},
+		[]string{
+			"gitvault doctor --deep --parallel 8",
+			"gitvault doctor --remote-timeout 30s",
+		},
 	)
 }
 
 func setSecretSetUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret set [--project <name> --env <name>] [--stdin] <project> <env> <key> <value>",
+		"gitvault secret set [--project <name> --env <name>] [--stdin] [--if-absent|--if-changed] <project> <env> <key> <value>",
 		[]string{
 			"Use --stdin to read the value from standard input.",
+			"--if-absent skips keys that already exist; values are only written when they",
+			"differ (--if-changed states this explicitly), so reruns leave git clean.",
 			"Project/env can be passed with flags or positionally.",
 			"Requires at least one recipient; add with `gitvault keys add age1...`.",
 		},
 		[]string{
 			"gitvault secret set myapp dev API_KEY value",
 			"gitvault secret set --project myapp --env dev API_KEY value",
+			"gitvault secret set myapp prod DB_PASSWORD generated --if-absent",
 		},
 	)
 }
@@ -161,43 +284,203 @@ func setSecretUnsetUsage(fs *flag.FlagSet) {
 	)
 }
 
+func setSecretImportComposeUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret import-compose --env <name> [--file <path>] [--service <name>[=<project>]]... [--strategy <prefer-vault|prefer-file|prefer-newer|interactive>] [--details]",
+		[]string{
+			"Imports the environment: entries of each compose service into a project",
+			"named after the service, or the one given with --service <name>=<project>.",
+			"Without --service, every service with environment values is imported.",
+			"Entries without a value, and values compose would interpolate (${VAR}),",
+			"are skipped with a warning; $$ becomes $. For anchors, merge keys, or",
+			"multi-line values, import the output of `docker compose config` instead.",
+			"Strategies work as in import-env; prefer-newer uses the compose file's mtime.",
+		},
+		[]string{
+			"gitvault secret import-compose --env dev",
+			"gitvault secret import-compose --env dev --file deploy/docker-compose.yml --service api --service worker=jobs",
+			"docker compose config > resolved.yml && gitvault secret import-compose --env prod --file resolved.yml",
+		},
+	)
+}
+
 func setSecretImportUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret import-env [--project <name> --env <name>] [--file <path>] [--strategy <prefer-vault|prefer-file|interactive>] [--preserve-order|--no-preserve-order] [<project> <env>]",
+		"gitvault secret import-env [--project <name> --env <name>] [--file <path>] [--strategy <prefer-vault|prefer-file|prefer-newer|interactive>] [--file-timestamp <when>] [--preserve-order|--no-preserve-order] [--details] [--strict] [<project> <env>]",
 		[]string{
 			"Alias: gitvault secret import",
 			"Project/env can be passed with flags or positionally.",
 			"Preserve order keeps key order from the input file.",
+			"Use --file - to read from stdin.",
+			"prefer-newer keeps the vault value unless the file (its mtime, or",
+			"--file-timestamp as a date, RFC 3339 time, or age like 2d) changed after the",
+			"key was last updated in the vault, and reports the decision for each key.",
+			"interactive prompts per conflict: keep a side, diff, edit, apply a side to",
+			"all remaining conflicts, or abort without changing the vault.",
+			"--details lists each key with the action taken (added/updated/skipped) and why.",
+			"--strict rejects lines the default parser would guess at (unquoted values with",
+			"\" #\" or surrounding whitespace, unknown escapes) instead of importing them.",
 		},
 		[]string{
 			"gitvault secret import-env --project myapp --env dev --file .env",
 			"gitvault secret import-env myapp dev --file .env",
+			"gitvault secret import-env myapp dev --file .env --strategy prefer-newer",
+			"op inject -i .env.tpl | gitvault secret import-env myapp dev --file -",
 		},
 	)
 }
 
 func setSecretExportUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret export-env [--project <name> --env <name>] [--out <path|->] [--force] [--allow-git] [--preserve-order|--no-preserve-order] [<project> <env>]",
+		"gitvault secret export-env [--project <name> --env <name>] [--out <path|->] [--force] [--allow-git] [--preserve-order|--no-preserve-order] [--header] [--format dotenv|json [--nest-by <sep>]] [--audience <name>] [--diff [--show-values [--yes]]] [--check] [--executable [--max-age <duration>]] [--for-shell sh|eval] [--allow-export-override] [<project> <env>]",
 		[]string{
 			"Alias: gitvault secret export",
 			"Project/env can be passed with flags or positionally.",
 			"Use --out - to write to stdout.",
 			"Untracked files inside a git repo are allowed; tracked paths require --allow-git.",
 			"Preserve order keeps key order from the vault file.",
+			"--header adds a comment naming the vault, project/env, commit, and export time,",
+			"which `gitvault secret status` reads later.",
+			"--format json writes a JSON object; --nest-by _ turns DB_HOST and DB_PORT",
+			"into {\"db\": {\"host\": ..., \"port\": ...}}.",
+			"--audience ci keeps only keys marked with `gitvault secret audience`;",
+			"unmarked keys are left out.",
+			"--diff lists the keys that would be added, removed, or changed in --out",
+			"without writing it; values stay hidden unless --show-values. --check",
+			"exits 1 when --out is out of date, for scripts and CI.",
+			"--executable writes a shell file to load with `. <file>`; it refuses to load",
+			"when other users can read it or after --max-age (default 24h, 0 disables).",
+			"--for-shell sh prints export lines. --for-shell eval prints a loader for",
+			"`eval \"$(...)\"` that refuses under set -x or set -v or when stdout is a",
+			"file, and only then fetches the values, so shell traces never show them.",
+			"Envs under a \"run\" export policy in .gitvault/settings.json refuse to",
+			"export (and every other command that prints, writes, mounts, or uploads",
+			"values refuses them) unless --allow-export-override is passed.",
 		},
 		[]string{
 			"gitvault secret export-env --project myapp --env dev --out .env --force",
-			"gitvault secret export-env myapp dev --out .env --force",
+			"gitvault secret export-env myapp dev --out .env --force --header",
+			"gitvault secret export-env myapp dev --format json --nest-by _ --out config.json",
+			"gitvault secret export-env myapp dev --executable --max-age 8h --out dev.sh",
+			"eval \"$(gitvault secret export-env myapp dev --for-shell eval)\"",
+			"gitvault secret export-env myapp prod --audience ci --out ci.env",
+			"gitvault secret export-env myapp dev --out .env --diff",
+		},
+	)
+}
+
+func setSecretAudienceUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret audience [--project <name> --env <name>] [--set <list> | --clear] [<project> <env>] <key>",
+		[]string{
+			"Project/env can be passed with flags or positionally.",
+			"Audiences are ci, deploy, and human; ci-only and human-only are accepted too.",
+			"They are stored in .gitvault/meta.json and used by `secret export-env --audience`.",
+			"Without --set or --clear, prints the key's current audiences.",
+		},
+		[]string{
+			"gitvault secret audience myapp prod DEPLOY_TOKEN --set ci,deploy",
+			"gitvault secret audience myapp prod DEBUG_PASSWORD --set human-only",
+			"gitvault secret audience myapp prod DEPLOY_TOKEN",
+		},
+	)
+}
+
+func setSecretAliasUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret alias [--project <name> --env <name>] [--to <project>/<env>/<key> | --remove] [<project> <env>] [<key>]",
+		[]string{
+			"Project/env can be passed with flags or positionally.",
+			"An alias stores no value: export-env, run, and template read the target",
+			"key each time, so changing or rotating it reaches every alias.",
+			"The target must hold its own value. Setting the key directly replaces the alias.",
+			"Without --to or --remove, prints the key's target, or all aliases of the env.",
+		},
+		[]string{
+			"gitvault secret alias app staging DB_URL --to app/dev/DB_URL",
+			"gitvault secret alias app staging",
+			"gitvault secret alias app staging DB_URL --remove",
+		},
+	)
+}
+
+func setSecretDeprecateUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret deprecate [--project <name> --env <name>] [--replacement <key>] [--note <text> | --undo] [<project> <env>] <key>",
+		[]string{
+			"Project/env can be passed with flags or positionally.",
+			"Deprecated keys are still exported, but export-env and run print a warning",
+			"naming the replacement, and secret list shows their status. The mark is stored",
+			"in .gitvault/meta.json and dropped when the key is unset.",
+		},
+		[]string{
+			"gitvault secret deprecate app prod DB_PASS --replacement DB_PASSWORD --note \"remove after the 2.0 release\"",
+			"gitvault secret deprecate app prod DB_PASS --undo",
+		},
+	)
+}
+
+func setSecretTemplateUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret template [--project <name> --env <name>] --in <path|-> [--out <path|->] [--force] [--allow-git] [--allow-export-override] [<project> <env>]",
+		[]string{
+			"Renders a Go text/template with the env's secrets as data: {{ .API_KEY }}.",
+			"Referencing a missing key is an error. Helpers: project, env, default,",
+			"required, upper, lower, trim, trimPrefix, trimSuffix, replace, contains,",
+			"hasPrefix, hasSuffix, split, join, quote, squote, b64enc, b64dec, indent,",
+			"nindent, toJson (sprig names and argument order).",
+			"Output follows export-env's rules: never inside the vault, tracked paths",
+			"require --allow-git, existing files require --force.",
+		},
+		[]string{
+			"gitvault secret template myapp prod --in config.tmpl --out config.yaml",
+			"gitvault secret template myapp dev --in - <<< 'url: {{ .DATABASE_URL | quote }}'",
+		},
+	)
+}
+
+func setSecretReportUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret report [--project <name>] [--env <name>] [--format table|csv|tsv]",
+		[]string{
+			"Lists every key with columns ref, last_updated, author, tags, expiry for",
+			"audits. Reads the index, metadata, settings, and git history only; no values",
+			"are decrypted. author is the last committer of the key's env file. tags",
+			"holds the key's audiences and \"deprecated\", separated by semicolons.",
+			"expiry is the end of the key's rotation window (see reminders) and empty",
+			"without a rule.",
+		},
+		[]string{"gitvault secret report --env prod --format csv > secrets-audit.csv"},
+	)
+}
+
+func setSecretStatusUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret status [--project <name> --env <name>] [--file <path>] [<project> <env>]",
+		[]string{
+			"Compares a dotenv file with the vault and lists keys that are missing,",
+			"changed, or only present in the file. Exits 1 when the file has drifted.",
+			"Project/env default to the file's export header (see export-env --header).",
+			"Values are compared by the digests in .gitvault/meta.json when they are",
+			"current, so no identity is needed; otherwise the env is decrypted.",
+		},
+		[]string{
+			"gitvault secret status --file .env",
+			"gitvault secret status myapp dev --file .env.local",
 		},
 	)
 }
 
 func setSecretListUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret list [--project <name> --env <name>] [--show-last-changed] [<project> <env>]",
+		"gitvault secret list [--project <name> --env <name>] [--show-last-changed] [--since <when>] [--before <when>] [--sort name|last_updated] [--limit <n>] [--offset <n>] [--values [--yes] [--allow-export-override]] [<project> <env>]",
 		[]string{
 			"Lists keys without printing values.",
+			"--since/--before take a date (2024-01-01), a timestamp, or an age (7d, 2w, 36h).",
+			"--limit/--offset page through large vaults.",
+			"--values decrypts and prints values after a confirmation prompt;",
+			"JSON output and non-interactive use require --yes. Envs under a \"run\"",
+			"export policy refuse unless --allow-export-override is passed.",
 			"Project/env can be passed with flags or positionally.",
 			"If no project/env is provided, lists all secret refs.",
 		},
@@ -205,58 +488,123 @@ func setSecretListUsage(fs *flag.FlagSet) {
 			"gitvault secret list --project myapp --env dev",
 			"gitvault secret list myapp dev",
 			"gitvault secret list",
+			"gitvault secret list --since 14d --sort last_updated --show-last-changed",
+			"gitvault secret list myapp prod --values",
 		},
 	)
 }
 
 func setSecretFindUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret find [pattern]",
-		nil,
-		[]string{"gitvault secret find API"},
+		"gitvault secret find [pattern | --glob <glob> | --regex <expr>] [--files] [--limit <n>] [--offset <n>]",
+		[]string{
+			"Searches project/env/key refs; a plain pattern is a case-insensitive substring.",
+			"In globs, * does not cross /. --files also searches stored file names.",
+		},
+		[]string{
+			"gitvault secret find API",
+			"gitvault secret find --glob 'app/*/DB_*'",
+			"gitvault secret find --regex '^app/prod/' --files",
+		},
+	)
+}
+
+func setSecretGrepUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret grep [--project <name>] [--env <name>] [--regex] [--ignore-case] [--show-values [--yes] [--allow-export-override]] <pattern>",
+		[]string{
+			"Decrypts envs and lists the keys whose value contains pattern (a literal",
+			"substring unless --regex). Only refs are printed unless --show-values,",
+			"which skips envs under a \"run\" export policy unless --allow-export-override.",
+			"Use it to find every place a leaked credential was reused.",
+		},
+		[]string{
+			"gitvault secret grep sk_live_",
+			"gitvault secret grep --project billing --regex '^postgres://.*@old-db'",
+		},
+	)
+}
+
+func setSecretDedupUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault secret dedup-report [--project <name>] [--env <name>] [--min-length <n>] [--from-index]",
+		[]string{
+			"Decrypts envs and groups keys that hold identical values, compared by a digest",
+			"keyed for this run only, so shared credentials can be consolidated or rotated",
+			"together. Only group numbers and refs are printed; short values are ignored",
+			"(--min-length, default 8).",
+			"--from-index compares the keyed value digests in .gitvault/meta.json",
+			"instead, without decrypting; envs without current digests (including",
+			"ones last written on another machine) are skipped.",
+		},
+		[]string{
+			"gitvault secret dedup-report",
+			"gitvault secret dedup-report --from-index",
+			"gitvault secret dedup-report --env prod --min-length 16",
+		},
 	)
 }
 
 func setSecretRunUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret run [--project <name> --env <name>] [<project> <env>] -- <cmd> [args...]",
+		"gitvault secret run [--project <name> --env <name>] [--restart-on-failure N [--refresh-env]] [--timeout 0] [--strict] [--env-file <path>]... [<project> <env>] -- <cmd> [args...]",
 		[]string{
 			"Runs a command with env injected without writing a file.",
 			"Project/env can be passed with flags or positionally.",
+			"--restart-on-failure restarts a command that exits non-zero or times out,",
+			"pausing 1s, 2s, 4s, ... (at most 30s) between attempts; --refresh-env",
+			"decrypts the env again first so rotated credentials are picked up.",
+			"--timeout interrupts each attempt after the given duration.",
+			"--env-file loads local, non-secret dotenv files beneath the vault values;",
+			"a key in both comes from the vault. --refresh-env re-reads them too.",
+			"Injected keys that override variables already in the environment are",
+			"listed as a warning; --strict fails instead.",
 		},
 		[]string{
 			"gitvault secret run --project myapp --env dev -- ./run-server",
 			"gitvault secret run myapp dev -- ./run-server",
+			"gitvault secret run myapp dev --restart-on-failure 5 --refresh-env -- ./worker",
+			"gitvault secret run myapp dev --env-file .env.local -- ./run-server",
 		},
 	)
 }
 
 func setSecretApplyUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault secret apply-env [--project <name> --env <name>] [--file <path>] [--only-existing] [--allow-git] [<project> <env>]",
+		"gitvault secret apply-env [--project <name> --env <name>] [--file <path|glob>]... [--only-existing] [--allow-git] [--details] [--allow-export-override] [<project> <env>]",
 		[]string{
 			"Alias: gitvault secret apply",
-			"Updates a dotenv file in-place using vault secrets.",
+			"Updates dotenv files in-place using vault secrets.",
 			"Project/env can be passed with flags or positionally.",
+			"Repeat --file or pass a glob (quote it; ** matches any depth) to update",
+			"several files at once with a report per file.",
+			"--details lists each key with the action taken (added/updated/skipped/failed) and why.",
+		},
+		[]string{
+			"gitvault secret apply-env --project myapp --env dev --file .env",
+			"gitvault secret apply-env myapp dev --file 'deploy/**/.env'",
 		},
-		[]string{"gitvault secret apply-env --project myapp --env dev --file .env"},
 	)
 }
 
 func setFilePutUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault file put [--project <name> --env <name>] --path <file> [--name <name>] [<project> <env>]",
+		"gitvault file put [--project <name> --env <name>] --path <file|dir> [--name <name>] [<project> <env>]",
 		[]string{
-			"Stores the file contents encrypted in the vault.",
+			"Stores the file contents encrypted in the vault. With a directory, stores",
+			"each file directly in it under its own name (subdirectories are skipped).",
 			"Project/env can be passed with flags or positionally.",
 		},
-		[]string{"gitvault file put --project myapp --env dev --path ./photo.jpg"},
+		[]string{
+			"gitvault file put --project myapp --env dev --path ./photo.jpg",
+			"gitvault file put myapp prod --path ./certs",
+		},
 	)
 }
 
 func setFileGetUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault file get [--project <name> --env <name>] --name <name> [--out <path|->] [--force] [--allow-git] [<project> <env> <name>]",
+		"gitvault file get [--project <name> --env <name>] --name <name> [--out <path|->] [--force] [--allow-git] [--allow-export-override] [<project> <env> <name>]",
 		[]string{
 			"Retrieves the file and writes to --out (or stdout with -).",
 			"Project/env can be passed with flags or positionally.",
@@ -265,28 +613,619 @@ func setFileGetUsage(fs *flag.FlagSet) {
 	)
 }
 
+func setFileExecUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault file exec [--project <name> --env <name>] [--name <name>] [--var <NAME>] [<project> <env> <name>] -- <cmd> [args...]",
+		[]string{
+			"Runs a command that gets the decrypted file through a named pipe instead of",
+			"a file on disk. The pipe path replaces {} in the command line and is set in",
+			"$GITVAULT_FILE (or --var). The pipe can be read once and is removed when the",
+			"command exits. Not available on Windows.",
+		},
+		[]string{
+			"gitvault file exec app prod tls.key -- ./server --tls-key {}",
+			"gitvault file exec app prod sa.json --var GOOGLE_APPLICATION_CREDENTIALS -- ./job",
+		},
+	)
+}
+
+func setFsckUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault fsck [--reindex] [--prune] [--fix]",
+		[]string{
+			"Finds ciphertexts with no index entry (orphans), index entries whose ciphertext",
+			"is missing, and temp files left behind by interrupted writes.",
+			"--reindex decrypts orphans and adds their keys or files to the index;",
+			"--prune drops missing entries and removes stale temp files. --fix does both.",
+		},
+		[]string{
+			"gitvault fsck",
+			"gitvault fsck --fix",
+		},
+	)
+}
+
+func setKeysAddUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault keys add <recipient> | --from-file <path> | --from-url <https-url>",
+		[]string{
+			"Adds recipients. Files and URLs may list age1..., pgp:... and ssh-ed25519",
+			"keys, one per line; SSH keys are converted to age recipients the way",
+			"ssh-to-age does. Run `gitvault keys rotate` afterwards.",
+		},
+		[]string{
+			"gitvault keys add age1...",
+			"gitvault keys add --from-file teammate.pub",
+			"gitvault keys add --from-url https://github.com/octocat.keys",
+		},
+	)
+}
+
+func setTeamAddUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault team add <name> [recipient...] [--from-file <path> | --from-url <https-url>]",
+		[]string{
+			"Adds a member to the team roster, or more recipients to an existing member,",
+			"and adds the recipients to the vault. Key files and URLs are read like",
+			"`gitvault keys add`.",
+		},
+		[]string{
+			"gitvault team add alice age1...",
+			"gitvault team add bob --from-url https://github.com/bob.keys",
+		},
+	)
+}
+
+func setTeamRemoveUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault team remove [--force] <name>",
+		[]string{
+			"Removes a member and their recipients. Like `gitvault keys remove`, refuses",
+			"to remove the last recipient or your own without --force.",
+		},
+		[]string{"gitvault team remove alice"},
+	)
+}
+
+func setTeamSyncUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault team sync [--dry-run] [--force]",
+		[]string{
+			"Adds roster recipients missing from the vault and removes vault recipients",
+			"no member owns. Run `gitvault keys rotate` afterwards.",
+		},
+		[]string{"gitvault team sync --dry-run"},
+	)
+}
+
+func setLinkUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault link [<vault-path> [--project <name> [--env <name>]] [--force] | --remove] [--map <path>=<project>[/<env>]] [--unmap <path>]",
+		[]string{
+			"Run from an app repository to record where its vault lives (a git submodule",
+			"or sibling checkout) in .gitvault.ref at the repository root. Commands run",
+			"anywhere in the app repository then use that vault, and the linked project",
+			"and env unless others are given. Without arguments, shows the current link.",
+			"In a monorepo, --map gives a subdirectory its own project (and env); the",
+			"longest matching path wins.",
+			"A .gitvault-path file holding just a vault path (relative, absolute, or",
+			"~/...) is found the same way, for checkouts that only need the location.",
+		},
+		[]string{
+			"gitvault link ./secrets --project myapp --env dev",
+			"gitvault link --map services/api=api --map services/web=web/staging",
+			"gitvault secret set API_KEY value",
+			"gitvault link --remove",
+		},
+	)
+}
+
+func setProjectRenameUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault project rename [--commit] <old> <new>",
+		[]string{
+			"Moves every env and file of a project, with its index and digest entries,",
+			"to a new name without re-encrypting. --commit commits the result.",
+		},
+		[]string{"gitvault project rename billing payments --commit"},
+	)
+}
+
+func setProjectNewUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault project new --template <name> [--envs a,b] [--commit] <project>",
+		[]string{
+			"Creates a project whose envs hold the keys listed in",
+			".gitvault/templates/<name>.json, with placeholder or generated values.",
+			"Generated values differ per env.",
+		},
+		[]string{"gitvault project new myapp --envs dev,staging,prod --template web-service"},
+	)
+}
+
+func setEnvRenameUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault env rename --project <name> [--commit] <old> <new>",
+		[]string{
+			"Moves an env's secrets and files, with its index and digest entries, to a",
+			"new name without re-encrypting. --commit commits the result.",
+		},
+		[]string{"gitvault env rename --project myapp stage staging"},
+	)
+}
+
+func setEnvCloneUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault env clone --project <name> --from <env> --to <env> [--commit]",
+		[]string{
+			"Copies every secret and file of an env into a new env. Recipients are",
+			"vault-wide, so the copy is readable by the same keys. --commit commits it.",
+		},
+		[]string{"gitvault env clone --project myapp --from staging --to staging-eu"},
+	)
+}
+
+func setKeysRemoveUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault keys remove [--force] <recipient>",
+		[]string{
+			"Removes a recipient. Refuses to remove the last recipient or the one matching",
+			"your local age identity, since either can lock people out after a rotate;",
+			"--force overrides. Run `gitvault keys rotate` afterwards.",
+		},
+		[]string{"gitvault keys remove age1..."},
+	)
+}
+
+func setKeyGroupsSetUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault keys groups set --group <recipients> --group <recipients> [--threshold <n>]",
+		[]string{
+			"Replaces the vault's key groups. Each --group takes comma-separated recipients;",
+			"members are added as vault recipients. --threshold defaults to all groups.",
+		},
+		[]string{
+			"gitvault keys groups set --threshold 2 --group age1a...,age1b... --group age1c... --group pgp:85D7...",
+		},
+	)
+}
+
+func setFindUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault find [pattern | --glob <glob> | --regex <expr>] [--type secret|file] [--project <name>] [--env <name>] [--limit <n>] [--offset <n>]",
+		[]string{
+			"Searches secrets and files together and prints typed refs, e.g.",
+			"secret:app/dev/KEY or file:app/dev/cert.pem, with size, MIME type, and",
+			"last update. Patterns match the ref without its type, as in secret find;",
+			"a plain pattern is a case-insensitive substring. Nothing is decrypted.",
+		},
+		[]string{
+			"gitvault find stripe",
+			"gitvault find --glob 'app/prod/*' --type file",
+			"gitvault --json find --regex 'TOKEN$'",
+		},
+	)
+}
+
+func setStatsUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault stats [--top <n>] [--git]",
+		[]string{
+			"Counts projects, envs, keys, files, and recipients, and totals ciphertext size.",
+			"Also lists the largest files and the secrets that have gone longest without an update.",
+			"Only the index and file sizes are read; nothing is decrypted.",
+			"--git adds history: commits touching secrets or files, the largest ciphertext",
+			"changes, bytes added per month, repository size, and suggestions such as",
+			"pruning old file versions.",
+		},
+		[]string{
+			"gitvault stats",
+			"gitvault --json stats --top 10",
+			"gitvault stats --git",
+		},
+	)
+}
+
+func setStatusUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault status [--stale] [--prune]",
+		[]string{
+			"Lists every file written by `secret export-env --out`, from any vault or",
+			"checkout on this machine, with its status: fresh, stale (the env changed",
+			"since), modified (the file was edited), missing, or unknown (the vault is",
+			"gone). Exits 1 when an export is stale. Nothing is decrypted.",
+			"Exports are tracked in exports.json next to the user config.",
+			"--prune forgets exports whose file no longer exists.",
+		},
+		[]string{
+			"gitvault status",
+			"gitvault status --stale",
+			"gitvault status --prune",
+		},
+	)
+}
+
+func setRemindersUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault reminders [--project <name>] [--env <name>] [--within 14d]",
+		[]string{
+			"Lists keys whose last update is older than their rotateEvery, from the",
+			"\"rotation\" rules in .gitvault/settings.json. A rule matches a project, env,",
+			"and/or key; the most specific one wins. --within also lists keys due soon.",
+			"Exits 1 when a key is overdue, so CI can fail on --json output.",
+		},
+		[]string{
+			"gitvault reminders",
+			"gitvault reminders --project myapp --env prod --within 14d",
+			"gitvault --json reminders",
+		},
+	)
+}
+
+func setGCUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault gc [--larger-than 1M] [--path <path>]... [--prune-obsolete] [--yes]",
+		[]string{
+			"Without --path or --prune-obsolete, lists candidates in the vault's git history:",
+			"plaintext-looking files (.env, *.pem, *.key, ...) outside secrets/ and files/,",
+			"and obsolete blobs of at least --larger-than that no branch or tag tip uses.",
+			"--path removes a path from every commit; --prune-obsolete removes the listed",
+			"obsolete blobs. Both rewrite history with git filter-repo after a confirmation",
+			"(--yes for scripts), then re-encrypt every secret with fresh data keys",
+			"(`keys rotate --force`) and commit. Push with --force afterwards and have",
+			"teammates re-clone; values that were committed in plaintext must be changed.",
+		},
+		[]string{
+			"gitvault gc",
+			"gitvault gc --path .env.production",
+			"gitvault gc --prune-obsolete --larger-than 5M",
+		},
+	)
+}
+
 func setFileListUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		"gitvault file list [--project <name> --env <name>] [--show-size] [--show-last-changed] [<project> <env>]",
+		"gitvault file list [--project <name> --env <name>] [--show-size] [--show-last-changed] [--verify] [--limit <n>] [--offset <n>] [<project> <env>]",
 		[]string{
 			"Lists stored file names without decrypting contents.",
+			"--verify stats each ciphertext and adds a status column: ok, missing,",
+			"truncated, or orphan (stored but not indexed); it exits 1 on any drift.",
+			"--limit/--offset page through large vaults.",
 			"Project/env can be passed with flags or positionally.",
 		},
 		[]string{
 			"gitvault file list --project myapp --env dev",
 			"gitvault file list",
+			"gitvault file list --verify",
 		},
 	)
 }
 
-func setSyncUsage(fs *flag.FlagSet, cmd string) {
+func setIdentityListUsage(fs *flag.FlagSet) {
 	setUsage(fs,
-		fmt.Sprintf("gitvault sync %s [--allow-dirty]", cmd),
+		"gitvault identity list",
+		[]string{
+			"Lists SOPS_AGE_KEY_FILE, the default keys.txt, configured extra files,",
+			"and the OS keyring identity, with the recipients they correspond to.",
+		},
 		nil,
+	)
+}
+
+func setIdentityAddUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault identity add <path>",
+		[]string{
+			"Adds an age identity file to the per-user search list.",
+			"Every file in the list is passed to sops alongside SOPS_AGE_KEY_FILE and the default path.",
+		},
+		[]string{"gitvault identity add ~/work/keys.txt"},
+	)
+}
+
+func setIdentityPathUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault identity path",
+		[]string{"Prints the identity file sops reads (SOPS_AGE_KEY_FILE or the default path)."},
 		nil,
 	)
 }
 
+func setIdentityCheckUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault identity check",
+		[]string{"Verifies a local identity matches a configured recipient and can decrypt the vault."},
+		[]string{"gitvault --vault ./vault identity check"},
+	)
+}
+
+func setIdentityImportUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault identity import --keyring [--file <path>]",
+		[]string{
+			"Stores the age identity in the OS keyring (macOS Keychain or Secret Service).",
+			"Once imported, gitvault passes it to sops at runtime via SOPS_AGE_KEY.",
+			"Defaults to SOPS_AGE_KEY_FILE or ~/.config/sops/age/keys.txt.",
+		},
+		[]string{"gitvault identity import --keyring --file ./keys.txt"},
+	)
+}
+
+func setSyncUsage(fs *flag.FlagSet, cmd string) {
+	usageLine := fmt.Sprintf("gitvault sync %s [--allow-dirty] [--remote <name>] [--branch <name>]", cmd)
+	if cmd == "push" {
+		usageLine += " [--mirror <remote>]... [--no-mirror]"
+	}
+	setUsage(fs,
+		usageLine,
+		[]string{
+			"Without --remote/--branch (or vault defaults from `gitvault sync config`),",
+			"git's upstream tracking decides where to sync.",
+		},
+		[]string{fmt.Sprintf("gitvault sync %s --remote origin --branch main", cmd)},
+	)
+}
+
+func setSyncConfigUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault sync config [--remote <name>] [--branch <name>] [--mirror <remote>]... [--clear]",
+		[]string{
+			"Shows or sets the vault's sync defaults, stored in .gitvault/settings.json.",
+			"Pushes are repeated to every mirror (a remote name or URL) as a backup;",
+			"--mirror replaces the configured list.",
+		},
+		[]string{
+			"gitvault sync config --remote origin --branch main --mirror backup",
+			"gitvault sync config --clear",
+		},
+	)
+}
+
+func setSyncGitHubSecretsUsage(fs *flag.FlagSet) {
+	setUsage(fs,
+		"gitvault sync github-secrets [<project> <env>] --repo <owner/name> [--environment <name>] [--dry-run] [--allow-export-override]",
+		[]string{
+			"Uploads an env's secrets as GitHub Actions secrets, creating or updating each key.",
+			"Needs GITHUB_TOKEN or GH_TOKEN; GITHUB_API_URL points at GitHub Enterprise Server.",
+			"--environment targets a deployment environment instead of repository secrets.",
+			"Keys GitHub does not allow (GITHUB_ prefix, leading digit) are skipped.",
+		},
+		[]string{
+			"gitvault sync github-secrets app prod --repo org/app --environment production",
+			"gitvault sync github-secrets --project app --env prod --repo org/app --dry-run",
+		},
+	)
+}
+
+func syncPlatformUsageLine(platform string) string {
+	flags := map[string]string{
+		"vercel":  "--vercel-project <name|id> [--team <id>] [--target production|preview|development]",
+		"netlify": "--account <slug> --site <id> [--context <name>]",
+		"heroku":  "--app <name>",
+	}
+	return fmt.Sprintf("gitvault sync %s [<project> <env>] %s [--dry-run] [--prune] [--allow-export-override]", platform, flags[platform])
+}
+
+func setSyncPlatformUsage(fs *flag.FlagSet, platform string) {
+	tokens := map[string]string{"vercel": "VERCEL_TOKEN", "netlify": "NETLIFY_AUTH_TOKEN", "heroku": "HEROKU_API_KEY"}
+	examples := map[string]string{
+		"vercel":  "gitvault sync vercel web prod --vercel-project web --target production --dry-run",
+		"netlify": "gitvault sync netlify web prod --account acme --site 1a2b3c --context production",
+		"heroku":  "gitvault sync heroku api prod --app acme-api --prune",
+	}
+	setUsage(fs,
+		syncPlatformUsageLine(platform),
+		[]string{
+			"Diffs an env against the platform's env vars, then creates and updates the",
+			"keys that differ. Variables only on the platform are reported; --prune deletes them.",
+			fmt.Sprintf("Needs %s in the environment.", tokens[platform]),
+		},
+		[]string{examples[platform]},
+	)
+}
+
+func setBatchUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault batch [--file <path|->] [--keep-going] [--commit [--message <msg>]]", []string{
+		"Reads one JSON operation per line and runs them all in one process, saving",
+		"the index once. Operations:",
+		`  {"op": "set", "project": "p", "env": "e", "key": "K", "value": "v"}`,
+		`  {"op": "unset", "project": "p", "env": "e", "key": "K"}`,
+		`  {"op": "file-put", "project": "p", "env": "e", "path": "cert.pem", "name": "tls.pem"}`,
+		"project and env default to the linked ones. The first failure skips the rest",
+		"unless --keep-going; results list every line with its status, never values.",
+		"--commit makes one git commit when every operation succeeded; a commit",
+		"template in .gitvault/settings.json can reformat --message as {summary}.",
+	}, []string{
+		"gitvault batch --commit < provision.ndjson",
+		"generate-secrets | gitvault --json batch --keep-going",
+	})
+}
+
+func setVerifyUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault verify", []string{
+		"Reads the SOPS metadata of every stored secret and file, without decrypting,",
+		"and reports files that are not valid SOPS ciphertext or whose recipients",
+		"differ from the configured ones (or key groups). No identity is needed, so",
+		"it can run in CI on every push to the vault repository. Exits 1 on problems.",
+	}, []string{
+		"gitvault verify",
+		"gitvault --json verify",
+	})
+}
+
+func setMountUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault mount [--project <name> [--env <name>]] [--allow-export-override] <mountpoint>", []string{
+		"Decrypts into memory and serves the vault read-only over FUSE (Linux) until",
+		"Ctrl-C, then unmounts. Each env is a <project>/<env>/ directory holding a .env",
+		"with its secrets plus its files; with --project and --env the env itself is",
+		"the root. Only the mounting user can read it, and nothing is written to disk.",
+		"Envs under a \"run\" export policy are left out unless --allow-export-override.",
+	}, []string{
+		"gitvault mount --project app --env dev ./config",
+		"gitvault mount /mnt/vault",
+	})
+}
+
+func printCIUsage(w io.Writer) {
+	fmt.Fprintln(w, "gitvault ci check [--strict]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Examples:")
+	fmt.Fprintln(w, "  gitvault ci check")
+	fmt.Fprintln(w, "  gitvault --json ci check --strict")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Checks meant for the vault repository's own pipeline; none needs a key.")
+}
+
+func setCICheckUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault ci check [--strict]", []string{
+		"Checks, without decrypting, that the config and settings are valid, every",
+		"file under secrets/ and files/ is SOPS ciphertext for the configured",
+		"recipients, the index matches them, key groups and the team roster agree",
+		"with the recipients, and no private key or dotenv file sits in plaintext.",
+		"Exits 1 when a check fails (or warns, with --strict); --json prints",
+		"{\"ok\": ..., \"data\": [{\"check\", \"status\", \"message\"}]}.",
+	}, []string{
+		"gitvault ci check",
+		"gitvault --json ci check --strict",
+	})
+}
+
+func setDockerEntrypointUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault docker-entrypoint [--project <name>] [--env <name>] [--] <cmd> [args...]", []string{
+		"Container entrypoint: clones the vault from $GITVAULT_REPO (shallow, at",
+		"$GITVAULT_REF or the default branch) or opens the vault at $GITVAULT_VAULT,",
+		"decrypts $GITVAULT_PROJECT/$GITVAULT_ENV, removes the clone, and execs the",
+		"command with the values in its environment, so images carry no secrets.",
+		"$GITVAULT_GIT_TOKEN is sent as HTTPS basic auth (user $GITVAULT_GIT_USER,",
+		"default x-access-token); use a read-only deploy token. The age key comes",
+		"from SOPS_AGE_KEY_FILE or SOPS_AGE_KEY as usual. GITVAULT_GIT_TOKEN and",
+		"SOPS_AGE_KEY are removed from the command's environment.",
+		"Flags end at the command, so CMD arguments are passed through untouched.",
+	}, []string{
+		"gitvault docker-entrypoint -- ./server",
+		"GITVAULT_PROJECT=api GITVAULT_ENV=prod gitvault docker-entrypoint node app.js",
+	})
+}
+
+func setSetupUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault setup [--import <file>] [--out <path>]", []string{
+		"First run on a new machine. Checks that git and sops are installed (with",
+		"install hints when not), then uses the age identity gitvault already finds,",
+		"imports one with --import, or generates one at --out (default: the sops key",
+		"file). Prints the public key to send to a vault admin, and inside a vault (or",
+		"with --vault) checks whether you can decrypt it. Rerun it once you were added.",
+	}, []string{
+		"gitvault setup",
+		"gitvault setup --import ~/backup/keys.txt",
+		"gitvault --vault ./vault setup",
+	})
+}
+
+func setK8sSidecarUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault k8s-sidecar --out <dir> [--project <name>] [--env <name>] [--key <name>]... [--file <name>]... [--format dotenv|files] [--interval 1m] [--once] [--mode 0440] [--group <name|gid>] [--allow-export-override]", []string{
+		"Kubernetes init container or sidecar: fetches the vault like",
+		"docker-entrypoint ($GITVAULT_REPO, $GITVAULT_REF, $GITVAULT_GIT_TOKEN, or a",
+		"vault at $GITVAULT_VAULT), writes the env's keys to <dir>/.env (or one file",
+		"per key with --format files) and its files to <dir>/<name>, then pulls and",
+		"rewrites changed files every --interval until SIGTERM. --once writes and",
+		"exits. --key and --file limit what is written; without either, everything is.",
+		"Files are replaced atomically and owner-only; for a workload running as",
+		"another user, --mode sets read bits (e.g. 0440) and --group the owning",
+		"group, and a <dir> gitvault creates gets matching search access. Mount <dir>",
+		"as an emptyDir with medium: Memory to keep it in RAM. Each refresh rereads",
+		"the vault settings; a failed one prints a warning and keeps the previous files.",
+	}, []string{
+		"gitvault k8s-sidecar --project app --env prod --out /secrets",
+		"gitvault k8s-sidecar --once --format files --key DATABASE_URL --out /secrets",
+		"gitvault k8s-sidecar --project app --env prod --out /secrets --mode 0440 --group 2000",
+	})
+}
+
+func setDumpIndexUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault dump-index [--project <name>] [--env <name>] [--since <time>] [--before <time>] [--format json|yaml]", []string{
+		"Prints every project, env, key, and file with its index metadata for",
+		"dashboards and inventory tools. Values are never decrypted or printed.",
+		"Lists are sorted by name, so an unchanged vault always dumps the same bytes.",
+		"The filters match the listing commands; with --since or --before, envs",
+		"without a matching key or file are left out.",
+	}, []string{
+		"gitvault dump-index > inventory.json",
+		"gitvault dump-index --project app --format yaml",
+		"gitvault dump-index --since 30d",
+	})
+}
+
+func printAliasUsage(w io.Writer) {
+	fmt.Fprintln(w, "gitvault alias <list|add|remove> [args]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Examples:")
+	fmt.Fprintln(w, "  gitvault alias list")
+	fmt.Fprintln(w, "  gitvault alias add prodrun secret run app prod --")
+	fmt.Fprintln(w, "  gitvault prodrun ./server")
+	fmt.Fprintln(w, "  gitvault alias remove prodrun")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Aliases live in the user config and expand before the command runs; extra")
+	fmt.Fprintln(w, "arguments are appended. They cannot shadow built-in commands.")
+}
+
+func setAliasAddUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault alias add [--force] <name> <command> [args...]", []string{
+		"Saves a shortcut in the user config. Everything after the name is the",
+		"command line, flags and a trailing -- included; it must start with a",
+		"gitvault command. Quote it as one string to keep shell variables unexpanded.",
+	}, []string{
+		"gitvault alias add prodrun secret run app prod --",
+		"gitvault alias add devenv 'secret export-env app dev --out .env --force'",
+	})
+}
+
+func setAliasRemoveUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault alias remove <name>", nil, []string{
+		"gitvault alias remove prodrun",
+	})
+}
+
+func printHooksUsage(w io.Writer) {
+	fmt.Fprintln(w, "gitvault hooks <list|trust> [args]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Examples:")
+	fmt.Fprintln(w, "  gitvault hooks list")
+	fmt.Fprintln(w, "  gitvault hooks trust")
+	fmt.Fprintln(w, "  gitvault hooks trust --remove")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Hooks live in .gitvault/settings.json and run a shell command in the vault")
+	fmt.Fprintln(w, "root before (\"pre\") or after (\"post\") a command. A failing pre hook stops")
+	fmt.Fprintln(w, "the command. Hooks run only after you trust them, and again after any change.")
+}
+
+func setHooksTrustUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault hooks trust [--remove]", []string{
+		"Allows this vault's hooks, as they are now, to run on this machine.",
+		"Review them with `gitvault hooks list` first; any later change to them",
+		"(e.g. from a pull) needs another trust.",
+	}, []string{
+		"gitvault hooks trust",
+		"gitvault hooks trust --remove",
+	})
+}
+
+func printDocsUsage(w io.Writer) {
+	fmt.Fprintln(w, "gitvault docs generate [--format man|markdown] --out <dir>")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Writes a reference page per command, built from the same help text as --help.")
+}
+
+func setDocsGenerateUsage(fs *flag.FlagSet) {
+	setUsage(fs, "gitvault docs generate [--format man|markdown] --out <dir>", []string{
+		"Writes one page per command and subcommand from their --help output, so the",
+		"reference never drifts from the CLI. man pages are named like git's",
+		"(gitvault-secret-set.1); markdown pages link to their subcommands.",
+	}, []string{
+		"gitvault docs generate --format man --out ./man/man1",
+		"gitvault docs generate --out ./docs/reference",
+	})
+}
+
 func setUsage(fs *flag.FlagSet, usageLine string, description []string, examples []string) {
 	fs.Usage = func() {
 		w := fs.Output()
@@ -336,6 +1275,12 @@ func printSopsHint(err error, w io.Writer, json bool) {
 	if json {
 		return
 	}
+	var renameErr *vaultfs.RenameError
+	if errors.As(err, &renameErr) {
+		fmt.Fprintln(w, "hint: another process (a sync client, scanner, or editor) may hold the file; pause it and retry")
+		fmt.Fprintln(w, `hint: on network or synced storage, set "storage": {"fsync": true} in the gitvault user config`)
+		return
+	}
 	msg := strings.ToLower(err.Error())
 	if !strings.Contains(msg, "sops") && !strings.Contains(msg, "age") {
 		return
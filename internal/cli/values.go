@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/ui"
+	"github.com/aatuh/sealr/domain"
+)
+
+var errValuesNotConfirmed = errors.New("printing values requires confirmation; rerun with --yes")
+
+// confirmValues asks before secret values are printed in clear text. JSON
+// output and non-interactive sessions must opt in with --yes.
+func confirmValues(out ui.Output, yes bool) error {
+	if yes {
+		return nil
+	}
+	if out.JSON || !ui.IsTerminal(os.Stdin) {
+		return errValuesNotConfirmed
+	}
+	fmt.Fprint(out.Err, "this prints secret values in clear text; continue? [y/N]: ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return errValuesNotConfirmed
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errors.New("aborted")
+}
+
+// valueReader decrypts each project/env at most once, for printing, so each
+// must pass policy first.
+type valueReader struct {
+	app    App
+	ctx    context.Context
+	root   string
+	policy *exportGuard
+	cache  map[string]map[string]string
+}
+
+func (a App) newValueReader(ctx context.Context, root string, policy *exportGuard) *valueReader {
+	return &valueReader{app: a, ctx: ctx, root: root, policy: policy, cache: map[string]map[string]string{}}
+}
+
+func (r *valueReader) value(project, env, key string) (string, error) {
+	ref := project + "/" + env
+	values, ok := r.cache[ref]
+	if !ok {
+		if err := r.policy.check(project, env); err != nil {
+			return "", err
+		}
+		payload, err := r.app.exportEnv(r.ctx, r.root, project, env)
+		if err != nil {
+			return "", err
+		}
+		r.app.healEnv(r.ctx, r.root, project, env)
+		if payload, err = r.app.resolveAliases(r.ctx, r.root, project, env, payload, r.policy); err != nil {
+			return "", err
+		}
+		parsed, _ := domain.ParseDotenv(payload)
+		values = parsed.Values
+		r.cache[ref] = values
+	}
+	return values[key], nil
+}
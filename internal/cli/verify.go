@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/encryption"
+	"github.com/aatuh/gitvault/internal/ui"
+)
+
+const (
+	verifyInvalid = "invalid"
+	verifyDrift   = "drift"
+)
+
+type verifyIssue struct {
+	path    string
+	problem string
+	detail  string
+}
+
+// runVerify checks every ciphertext against the configured recipients by
+// reading SOPS metadata only: no identity is needed, so it runs in CI.
+func (a App) runVerify(out ui.Output, root string, args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(out.Out)
+	setVerifyUsage(fs)
+	if err := parseFlagSet(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		out.Error(err)
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		out.Error(errors.New("unexpected extra arguments"))
+		printFlagUsage(fs, out.Err)
+		return 2
+	}
+	progress := out.Progress("verifying", 0)
+	verified, issues, err := a.verifyCiphertexts(root, progress)
+	progress.Done()
+	if err != nil {
+		out.Error(err)
+		return 1
+	}
+	if len(issues) == 0 {
+		out.Success(fmt.Sprintf("%d ciphertext(s) match the configured recipients", verified), map[string]int{"verified": verified})
+		return 0
+	}
+	rows := make([][]string, 0, len(issues))
+	drift := false
+	for _, issue := range issues {
+		rows = append(rows, []string{issue.path, issue.problem, issue.detail})
+		drift = drift || issue.problem == verifyDrift
+	}
+	out.Table([]string{"path", "problem", "detail"}, rows)
+	if drift && !out.JSON {
+		fmt.Fprintln(out.Err, "hint: run `gitvault keys rotate` to re-encrypt secrets, and `gitvault file put` again for drifted files")
+	}
+	return 1
+}
+
+// verifyCiphertexts checks each stored ciphertext and returns how many it
+// read along with the ones that have problems.
+func (a App) verifyCiphertexts(root string, progress *ui.Progress) (int, []verifyIssue, error) {
+	want, err := a.expectedRecipients(root)
+	if err != nil {
+		return 0, nil, err
+	}
+	paths, err := ciphertextPaths(root)
+	if err != nil {
+		return 0, nil, err
+	}
+	var issues []verifyIssue
+	for _, path := range paths {
+		if issue := verifyCiphertext(root, path, want); issue != nil {
+			issues = append(issues, *issue)
+		}
+		progress.Step(path)
+	}
+	return len(paths), issues, nil
+}
+
+// ciphertextPaths lists the stored secrets and files relative to root. It
+// reads the directories directly, so obfuscated vaults are listed by their
+// hashed names without decrypting the layout.
+func ciphertextPaths(root string) ([]string, error) {
+	var paths []string
+	for _, dir := range []string{"secrets", "files"} {
+		err := filepath.WalkDir(filepath.Join(root, dir), func(path string, entry os.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			// Stale temp files are fsck's concern.
+			if entry.IsDir() || strings.HasSuffix(path, ".tmp") {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func verifyCiphertext(root, path string, want []string) *verifyIssue {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if err != nil {
+		return &verifyIssue{path: path, problem: verifyInvalid, detail: err.Error()}
+	}
+	meta, err := encryption.ParseMetadata(data)
+	if err != nil {
+		return &verifyIssue{path: path, problem: verifyInvalid, detail: err.Error()}
+	}
+	missing, extra := encryption.RecipientDrift(meta.Recipients, want)
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	var details []string
+	if len(missing) > 0 {
+		details = append(details, "missing "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		details = append(details, "extra "+strings.Join(extra, ", "))
+	}
+	return &verifyIssue{path: path, problem: verifyDrift, detail: strings.Join(details, "; ")}
+}
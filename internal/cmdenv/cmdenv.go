@@ -0,0 +1,99 @@
+// Package cmdenv builds the environment for the sops and git processes
+// gitvault starts, so they get what they need to find keys, credentials,
+// and config, but not the rest of the caller's shell (tokens, values
+// exported by `secret run`, ...).
+package cmdenv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	executil "github.com/aatuh/sealr/infra/exec"
+)
+
+// Patterns are matched case-insensitively, since Windows variable names are;
+// a trailing * matches a prefix.
+var common = []string{
+	"PATH", "PATHEXT", "HOME", "USER", "LOGNAME", "USERNAME", "SHELL",
+	"LANG", "LANGUAGE", "LC_*", "TZ", "TERM",
+	"TMPDIR", "TEMP", "TMP", "XDG_*",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY", "SSL_CERT_FILE", "SSL_CERT_DIR",
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+	"PROGRAMDATA", "PROGRAMFILES", "HOMEDRIVE", "HOMEPATH",
+	"GITVAULT_*",
+}
+
+var sopsVars = []string{
+	"SOPS_*", "AGE_*", "GNUPGHOME", "GPG_*",
+	"AWS_*", "GOOGLE_*", "CLOUDSDK_*", "AZURE_*", "IDENTITY_ENDPOINT", "IDENTITY_HEADER", "MSI_*",
+	"VAULT_*", "SSH_AUTH_SOCK",
+}
+
+var gitVars = []string{
+	"GIT_*", "SSH_*", "GCM_*", "GNUPGHOME", "GPG_TTY",
+	"DISPLAY", "WAYLAND_DISPLAY", "DBUS_SESSION_BUS_ADDRESS", "CURL_CA_BUNDLE",
+}
+
+// Sops returns the environment for sops, with extra (KEY=VALUE) last so it
+// wins over inherited values.
+func Sops(extra ...string) []string {
+	return build(sopsVars, extra)
+}
+
+// Git returns the environment for git, with extra last.
+func Git(extra ...string) []string {
+	return build(gitVars, extra)
+}
+
+// For returns the environment for the named tool; tools other than sops and
+// git get only the common variables.
+func For(tool string) []string {
+	switch tool {
+	case "sops":
+		return Sops()
+	case "git":
+		return Git()
+	}
+	return build(nil, nil)
+}
+
+func build(tool, extra []string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, ok := strings.Cut(kv, "=")
+		if ok && name != "" && (matches(common, name) || matches(tool, name)) {
+			env = append(env, kv)
+		}
+	}
+	return append(env, extra...)
+}
+
+func matches(patterns []string, name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Runner gives every command an explicit environment: the caller's env when
+// it passes one, otherwise the sanitized one for the tool. Base must use env
+// as the whole environment, as executil.ExecRunner does.
+type Runner struct {
+	Base executil.Runner
+}
+
+func (r Runner) Run(ctx context.Context, name string, args []string, input []byte, env []string, dir string) ([]byte, []byte, error) {
+	if env == nil {
+		env = For(strings.TrimSuffix(filepath.Base(name), ".exe"))
+	}
+	return r.Base.Run(ctx, name, args, input, env, dir)
+}
@@ -0,0 +1,216 @@
+// Package dotenv renders and strictly parses dotenv files so values survive
+// a round trip through sealr's more forgiving parser: that parser trims
+// unquoted values, drops inline comments, and reads unknown escapes as the
+// escaped character, so some values come back different from what was
+// written.
+package dotenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/sealr/domain"
+)
+
+// MaxLine is the longest line sealr can read back; a longer one ends its
+// parse and every key after it is lost.
+const MaxLine = bufio.MaxScanTokenSize - 1
+
+// Quote formats value so domain.ParseDotenv reads it back unchanged: bare
+// when that is safe, otherwise double-quoted with \n, \r, \t, \\ and \"
+// escaped.
+func Quote(value string) string {
+	if !strings.ContainsAny(value, " \t\n\r#\"'\\") && strings.TrimSpace(value) == value {
+		return value
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Render writes values as KEY=value lines, keys in order first and any
+// others sorted after them.
+func Render(values map[string]string, order []string) []byte {
+	keys := make([]string, 0, len(values))
+	seen := map[string]bool{}
+	for _, key := range order {
+		if _, ok := values[key]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	var rest []string
+	for key := range values {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	var b bytes.Buffer
+	for _, key := range append(keys, rest...) {
+		b.WriteString(key + "=" + Quote(values[key]) + "\n")
+	}
+	return b.Bytes()
+}
+
+// Canonical requotes the bare values in a payload rendered by sealr that
+// its own parser would not read back as written, such as values with
+// leading or trailing non-ASCII whitespace. Other lines are kept as is.
+func Canonical(payload []byte) []byte {
+	lines := bytes.SplitAfter(payload, []byte("\n"))
+	changed := false
+	for i, line := range lines {
+		text := strings.TrimSuffix(string(line), "\n")
+		key, raw, ok := strings.Cut(text, "=")
+		if !ok || raw == "" || raw[0] == '"' || raw[0] == '\'' || strings.TrimSpace(raw) == raw {
+			continue
+		}
+		lines[i] = []byte(key + "=" + Quote(raw) + strings.TrimPrefix(string(line), text))
+		changed = true
+	}
+	if !changed {
+		return payload
+	}
+	return bytes.Join(lines, nil)
+}
+
+// ParseStrict parses data like domain.ParseDotenv, but reports as errors the
+// lines sealr would read differently from how they look: unquoted values
+// with a " #" inside or whitespace around them, unknown escapes, text after
+// a closing quote other than a comment, and lines too long to store. Quoted
+// values may be followed by a comment. Leading spaces after "=" are
+// formatting and are dropped.
+func ParseStrict(data []byte) (domain.Dotenv, []domain.DotenvIssue) {
+	result := domain.Dotenv{Values: map[string]string{}, Order: []string{}}
+	var issues []domain.DotenvIssue
+	issue := func(line int, severity domain.IssueSeverity, format string, args ...any) {
+		issues = append(issues, domain.DotenvIssue{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(strings.TrimLeft(line, " \t"), "export "); ok {
+			issue(lineNum, domain.IssueWarning, "line uses export; removed prefix")
+			line = rest
+		}
+		name, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			issue(lineNum, domain.IssueError, "missing '=' separator")
+			continue
+		}
+		key := strings.TrimSpace(name)
+		if !domain.IsValidEnvKey(key) {
+			issue(lineNum, domain.IssueError, "invalid key '%s'", key)
+			continue
+		}
+		value, err := strictValue(strings.TrimLeft(raw, " \t"))
+		if err != nil {
+			issue(lineNum, domain.IssueError, "%s: %v", key, err)
+			continue
+		}
+		if len(key)+1+len(Quote(value)) > MaxLine {
+			issue(lineNum, domain.IssueError, "%s: value too long to store (lines are limited to %d bytes)", key, MaxLine)
+			continue
+		}
+		if _, ok := result.Values[key]; ok {
+			issue(lineNum, domain.IssueWarning, "duplicate key '%s', last value wins", key)
+		} else {
+			result.Order = append(result.Order, key)
+		}
+		result.Values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		issue(lineNum, domain.IssueError, "%v", err)
+	}
+	return result, issues
+}
+
+func strictValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '"':
+		return strictQuoted(raw)
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return raw[1 : end+1], afterQuote(raw[end+2:])
+	}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && (i == 0 || raw[i-1] == ' ' || raw[i-1] == '\t') {
+			return "", fmt.Errorf("unquoted value contains a comment marker ' #'; quote the value, or put the comment on its own line")
+		}
+	}
+	if strings.TrimSpace(raw) != raw {
+		return "", fmt.Errorf("unquoted value has leading or trailing whitespace; quote the value to keep it")
+	}
+	return raw, nil
+}
+
+func strictQuoted(raw string) (string, error) {
+	var b strings.Builder
+	for i := 1; i < len(raw); i++ {
+		switch ch := raw[i]; ch {
+		case '"':
+			return b.String(), afterQuote(raw[i+1:])
+		case '\\':
+			if i+1 == len(raw) {
+				return "", fmt.Errorf("unterminated quoted value")
+			}
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"':
+				b.WriteByte(raw[i])
+			default:
+				return "", fmt.Errorf("unknown escape \\%c; write \\\\ for a backslash", raw[i])
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted value")
+}
+
+func afterQuote(rest string) error {
+	rest = strings.TrimLeft(rest, " \t")
+	if rest == "" || strings.HasPrefix(rest, "#") {
+		return nil
+	}
+	return fmt.Errorf("unexpected text after closing quote")
+}
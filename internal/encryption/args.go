@@ -0,0 +1,81 @@
+package encryption
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// reservedArgs are set by gitvault itself; passing them again would change
+// what is encrypted, for whom, or where the output goes.
+var reservedArgs = map[string]bool{
+	"-e": true, "--encrypt": true,
+	"-d": true, "--decrypt": true,
+	"-i": true, "--in-place": true,
+	"--input-type":  true,
+	"--output-type": true,
+	"--output":      true,
+	"--age":         true,
+	"--config":      true,
+}
+
+// ValidateExtraArgs rejects arguments that gitvault manages itself.
+func ValidateExtraArgs(args []string) error {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		if reservedArgs[name] {
+			return fmt.Errorf("sops argument %s is managed by gitvault", name)
+		}
+	}
+	return nil
+}
+
+// SplitArgs splits s on whitespace, keeping single- or double-quoted runs
+// together, so GITVAULT_SOPS_ARGS and command aliases can carry values that
+// contain spaces.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// EnvList renders env as sorted KEY=VALUE pairs.
+func EnvList(env map[string]string) []string {
+	out := make([]string, 0, len(env))
+	for key, value := range env {
+		out = append(out, key+"="+value)
+	}
+	sort.Strings(out)
+	return out
+}
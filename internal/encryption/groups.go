@@ -0,0 +1,40 @@
+package encryption
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// groupsConfig renders a sops config whose only creation rule encrypts to
+// the given key groups. The sops CLI has no flags for key groups, so they
+// reach it through --config. JSON is valid YAML.
+func groupsConfig(groups [][]string, threshold int) ([]byte, error) {
+	type keyGroup struct {
+		Age []string `json:"age,omitempty"`
+		PGP []string `json:"pgp,omitempty"`
+	}
+	type rule struct {
+		KeyGroups       []keyGroup `json:"key_groups"`
+		ShamirThreshold int        `json:"shamir_threshold"`
+	}
+	r := rule{ShamirThreshold: threshold}
+	for _, group := range groups {
+		age, pgp := SplitRecipients(group)
+		r.KeyGroups = append(r.KeyGroups, keyGroup{Age: age, PGP: pgp})
+	}
+	return json.Marshal(map[string][]rule{"creation_rules": {r}})
+}
+
+// groupedRecipients describes key groups in the form ciphertextRecipients
+// reads them back from SOPS metadata: one "group<N>:<recipient>" entry per
+// member plus "threshold:<N>".
+func groupedRecipients(groups [][]string, threshold int) []string {
+	var out []string
+	for i, group := range groups {
+		for _, recipient := range group {
+			out = append(out, fmt.Sprintf("group%d:%s", i, strings.TrimSpace(recipient)))
+		}
+	}
+	return append(out, fmt.Sprintf("threshold:%d", threshold))
+}
@@ -0,0 +1,64 @@
+package encryption
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// KeyserviceArgs renders sops flags that route data key operations to
+// remote key services. local=false also stops sops from using keys on
+// this machine, so every operation goes through the listed services.
+func KeyserviceArgs(addrs []string, local *bool) []string {
+	var args []string
+	for _, addr := range addrs {
+		args = append(args, "--keyservice", addr)
+	}
+	if local != nil && !*local {
+		args = append(args, "--enable-local-keyservice=false")
+	}
+	return args
+}
+
+// Keyservices returns the --keyservice addresses in args.
+func Keyservices(args []string) []string {
+	var addrs []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--keyservice" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				break
+			}
+			i++
+			value = args[i]
+		}
+		addrs = append(addrs, value)
+	}
+	return addrs
+}
+
+// ParseKeyservice splits a sops key service address (tcp://host:port or
+// unix:///path) into a network and address for net.Dial.
+func ParseKeyservice(addr string) (string, string, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("keyservice %q: %w", addr, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" || u.Port() == "" {
+			return "", "", fmt.Errorf("keyservice %q: want tcp://host:port", addr)
+		}
+		return "tcp", u.Host, nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("keyservice %q: want unix:///path/to/socket", addr)
+		}
+		return "unix", u.Path, nil
+	default:
+		return "", "", fmt.Errorf("keyservice %q: scheme must be tcp or unix", addr)
+	}
+}
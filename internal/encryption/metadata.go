@@ -0,0 +1,120 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Metadata is what a SOPS file says about itself without being decrypted.
+type Metadata struct {
+	Version string
+	// Recipients are reported the way ciphertextRecipients reads them.
+	Recipients []string
+}
+
+// ParseMetadata reads the SOPS metadata of a dotenv or JSON (binary)
+// ciphertext. It fails when the data is not SOPS output: metadata is
+// missing, or a value is stored in plaintext.
+func ParseMetadata(ciphertext []byte) (Metadata, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(ciphertext, &doc); err == nil {
+		return parseJSONMetadata(doc, ciphertext)
+	}
+	var meta Metadata
+	hasMAC := false
+	scanner := bufio.NewScanner(bytes.NewReader(ciphertext))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return meta, errors.New("not a dotenv file")
+		}
+		switch {
+		case name == "sops_version":
+			meta.Version = value
+		case name == "sops_mac":
+			hasMAC = true
+		case strings.HasPrefix(name, "sops_"):
+		case !isEncryptedValue(value):
+			return meta, errors.New("value of " + name + " is not encrypted")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return meta, err
+	}
+	if meta.Version == "" || !hasMAC {
+		return meta, errors.New("no sops metadata")
+	}
+	meta.Recipients = ciphertextRecipients(ciphertext)
+	return meta, nil
+}
+
+func parseJSONMetadata(doc map[string]json.RawMessage, ciphertext []byte) (Metadata, error) {
+	var meta Metadata
+	var sops struct {
+		Version string `json:"version"`
+		MAC     string `json:"mac"`
+	}
+	if raw, ok := doc["sops"]; !ok || json.Unmarshal(raw, &sops) != nil || sops.Version == "" || sops.MAC == "" {
+		return meta, errors.New("no sops metadata")
+	}
+	for name, raw := range doc {
+		if name == "sops" {
+			continue
+		}
+		var value string
+		if json.Unmarshal(raw, &value) != nil || !isEncryptedValue(value) {
+			return meta, errors.New("value of " + name + " is not encrypted")
+		}
+	}
+	meta.Version = sops.Version
+	meta.Recipients = ciphertextRecipients(ciphertext)
+	return meta, nil
+}
+
+func isEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, "ENC[") && strings.HasSuffix(value, "]")
+}
+
+// ExpectedRecipients describes the recipients a file encrypted now would
+// list in its metadata: the key groups when the vault has them, otherwise
+// the configured recipients.
+func ExpectedRecipients(recipients []string, groups [][]string, threshold int) []string {
+	if len(groups) > 0 {
+		return groupedRecipients(groups, threshold)
+	}
+	return sortedTrimmed(recipients)
+}
+
+// RecipientDrift lists the expected recipients a ciphertext lacks and the
+// ones it has beyond them.
+func RecipientDrift(got, want []string) (missing, extra []string) {
+	have := map[string]bool{}
+	for _, recipient := range got {
+		have[strings.TrimSpace(recipient)] = true
+	}
+	wanted := map[string]bool{}
+	for _, recipient := range want {
+		recipient = strings.TrimSpace(recipient)
+		wanted[recipient] = true
+		if !have[recipient] {
+			missing = append(missing, recipient)
+		}
+	}
+	for recipient := range have {
+		if !wanted[recipient] {
+			extra = append(extra, recipient)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
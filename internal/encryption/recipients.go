@@ -0,0 +1,71 @@
+package encryption
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/agekey"
+)
+
+// PGPPrefix marks a recipient as a PGP key fingerprint rather than an age
+// recipient, e.g. pgp:85D77543B3D624B63CEA9E6DBC17301B491B3F21.
+const PGPPrefix = "pgp:"
+
+// SplitRecipients separates configured recipients into the age recipients
+// and PGP fingerprints sops expects in --age and --pgp.
+func SplitRecipients(recipients []string) (age, pgp []string) {
+	for _, recipient := range recipients {
+		recipient = strings.TrimSpace(recipient)
+		if fingerprint, ok := strings.CutPrefix(recipient, PGPPrefix); ok {
+			pgp = append(pgp, fingerprint)
+			continue
+		}
+		age = append(age, recipient)
+	}
+	return age, pgp
+}
+
+// NormalizePGPRecipient validates a pgp:<fingerprint> recipient and returns
+// it with the fingerprint upper-cased and spaces removed, the form sops
+// records in its metadata.
+func NormalizePGPRecipient(value string) (string, error) {
+	fingerprint, ok := strings.CutPrefix(strings.TrimSpace(value), PGPPrefix)
+	if !ok {
+		return "", errors.New("pgp recipient must start with pgp:")
+	}
+	fingerprint = strings.ToUpper(strings.ReplaceAll(fingerprint, " ", ""))
+	if len(fingerprint) != 40 && len(fingerprint) != 64 {
+		return "", errors.New("pgp fingerprint must be 40 or 64 hex characters")
+	}
+	for _, r := range fingerprint {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'F') {
+			return "", errors.New("pgp fingerprint must be hexadecimal")
+		}
+	}
+	return PGPPrefix + fingerprint, nil
+}
+
+// AgePlugin returns the plugin name of an age plugin recipient such as
+// age1yubikey1..., whose bech32 prefix is "age1" followed by the name.
+// Native X25519 recipients (prefix "age") are not plugins.
+func AgePlugin(recipient string) (string, bool) {
+	hrp, _, err := agekey.Decode(strings.TrimSpace(recipient))
+	if err != nil {
+		return "", false
+	}
+	name, ok := strings.CutPrefix(hrp, "age1")
+	return name, ok && name != ""
+}
+
+// AgePlugins lists the distinct plugin names used by recipients.
+func AgePlugins(recipients []string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, recipient := range recipients {
+		if name, ok := AgePlugin(recipient); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,280 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aatuh/gitvault/internal/cmdenv"
+	"github.com/aatuh/gitvault/internal/identity"
+	"github.com/aatuh/gitvault/internal/redact"
+	"github.com/aatuh/gitvault/internal/vaultfs"
+	sealrenc "github.com/aatuh/sealr/infra/encryption"
+	executil "github.com/aatuh/sealr/infra/exec"
+)
+
+// Sops extends the sealr SOPS encrypter, whose Runner, Path, and Version it
+// reuses. Its own encrypt and decrypt keep plaintext temp files in a
+// per-user, owner-only location and add identities, key groups, and
+// version-specific arguments.
+type Sops struct {
+	sealrenc.Sops
+	Identities *identity.Source
+	// ExtraArgs and ExtraEnv (KEY=VALUE) are added to every encrypt and
+	// decrypt, after gitvault's own arguments.
+	ExtraArgs []string
+	ExtraEnv  []string
+	// KeyGroups, when set, replace the flat recipient list: Threshold of the
+	// groups must cooperate to decrypt.
+	KeyGroups [][]string
+	Threshold int
+
+	probe *versionProbe
+}
+
+func NewSops(runner executil.Runner) Sops {
+	return Sops{Sops: sealrenc.NewSops(runner), probe: &versionProbe{}}
+}
+
+func (s Sops) EncryptDotenv(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	return s.encrypt(ctx, "dotenv", plaintext, recipients)
+}
+
+func (s Sops) DecryptDotenv(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return s.decrypt(ctx, "dotenv", ciphertext)
+}
+
+func (s Sops) EncryptBinary(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	return s.encrypt(ctx, "binary", plaintext, recipients)
+}
+
+func (s Sops) DecryptBinary(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return s.decrypt(ctx, "binary", ciphertext)
+}
+
+func (s Sops) encrypt(ctx context.Context, format string, plaintext []byte, recipients []string) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients provided")
+	}
+	if format == "dotenv" {
+		redact.Dotenv(plaintext)
+	}
+	version, known, err := s.detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := append(operation("encrypt", version, known), "--input-type", format, "--output-type", format)
+	if len(s.KeyGroups) > 0 {
+		recipients = nil
+		for _, group := range s.KeyGroups {
+			recipients = append(recipients, group...)
+		}
+	}
+	age, pgp := SplitRecipients(recipients)
+	if plugins := AgePlugins(age); len(plugins) > 0 && known && !version.AtLeast(AgePluginVersion) {
+		return nil, fmt.Errorf("age plugin recipients (%s) need sops %s or newer, found %s", strings.Join(plugins, ", "), AgePluginVersion, version)
+	}
+	if len(s.KeyGroups) > 0 {
+		config, err := groupsConfig(s.KeyGroups, s.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		configFile, cleanupConfig, err := s.tempFile(config)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanupConfig()
+		args = append(args, "--config", configFile)
+	} else {
+		if len(age) > 0 {
+			args = append(args, "--age", strings.Join(age, ","))
+		}
+		if len(pgp) > 0 {
+			args = append(args, "--pgp", strings.Join(pgp, ","))
+		}
+	}
+	file, cleanup, err := s.tempFile(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args = append(append(args, s.ExtraArgs...), file)
+	stdout, stderr, err := s.Runner.Run(ctx, s.Path, args, nil, s.environ(nil), "")
+	if err != nil {
+		return nil, sopsError("encrypt", err, stderr, false)
+	}
+	return stdout, nil
+}
+
+func (s Sops) decrypt(ctx context.Context, format string, ciphertext []byte) ([]byte, error) {
+	version, known, err := s.detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := append(operation("decrypt", version, known), "--input-type", format, "--output-type", format)
+	keys, err := s.Identities.AgeKeys()
+	if err != nil {
+		return nil, fmt.Errorf("load age identity: %w", err)
+	}
+	var env []string
+	if keys != "" {
+		if known && !version.AtLeast(ageKeyEnvVersion) {
+			// Older sops reads only SOPS_AGE_KEY_FILE, which the temp file
+			// replaces, so it carries the user's own key file too.
+			contents := keys + "\n"
+			if own, err := os.ReadFile(identity.ActiveFile()); err == nil {
+				contents += string(own) + "\n"
+			}
+			keyFile, cleanupKeys, err := s.tempFile([]byte(contents))
+			if err != nil {
+				return nil, err
+			}
+			defer cleanupKeys()
+			env = append(env, "SOPS_AGE_KEY_FILE="+keyFile)
+		} else {
+			// Keep identities the user already passes in SOPS_AGE_KEY.
+			merged := keys
+			if own := strings.TrimSpace(os.Getenv("SOPS_AGE_KEY")); own != "" {
+				merged = own + "\n" + keys
+			}
+			env = append(env, "SOPS_AGE_KEY="+merged)
+		}
+	}
+	file, cleanup, err := s.tempFile(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args = append(append(args, s.ExtraArgs...), file)
+	stdout, stderr, err := s.Runner.Run(ctx, s.Path, args, nil, s.environ(env), "")
+	if err != nil {
+		return nil, sopsError("decrypt", err, stderr, keys != "" || ageIdentityAvailable())
+	}
+	if format == "dotenv" {
+		redact.Dotenv(stdout)
+	}
+	return stdout, nil
+}
+
+// expectedRecipients is what ciphertextRecipients reports for a file this
+// adapter encrypts to recipients.
+func (s Sops) expectedRecipients(recipients []string) []string {
+	if len(s.KeyGroups) == 0 {
+		return recipients
+	}
+	return groupedRecipients(s.KeyGroups, s.Threshold)
+}
+
+// environ returns the sanitized sops environment plus ExtraEnv; gitvault's
+// own variables come last so they win over ExtraEnv.
+func (s Sops) environ(own []string) []string {
+	return cmdenv.Sops(append(append([]string(nil), s.ExtraEnv...), own...)...)
+}
+
+// operation returns the leading arguments for op ("encrypt" or "decrypt"):
+// the subcommand on releases that have it, the legacy flag otherwise.
+func operation(op string, version SopsVersion, known bool) []string {
+	if known && version.AtLeast(subcommandVersion) {
+		return []string{op}
+	}
+	return []string{"--" + op}
+}
+
+// tempFile hands data to sops as a file: an unnamed one on Linux, otherwise
+// an owner-only temp file that cleanup shreds.
+func (s Sops) tempFile(data []byte) (string, func(), error) {
+	dir, err := vaultfs.TempDir()
+	if err != nil {
+		return "", nil, err
+	}
+	if path, cleanup, err := vaultfs.UnnamedFile(dir, data); err == nil {
+		return path, cleanup, nil
+	}
+	file, err := os.CreateTemp(dir, "gitvault-plaintext")
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Clean(file.Name())
+	cleanup := func() { _ = vaultfs.Shred(path) }
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if err := vaultfs.Restrict(path, false); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if err := os.WriteFile(path, data, vaultfs.FilePerm); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+func sopsError(op string, err error, stderr []byte, identityAvailable bool) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	msg := sanitizeSopsError(op, stderr, identityAvailable)
+	if msg == "" {
+		return fmt.Errorf("sops %s failed: %w", op, err)
+	}
+	return fmt.Errorf("sops %s failed: %s", op, msg)
+}
+
+func sanitizeSopsError(op string, stderr []byte, identityAvailable bool) string {
+	msg := strings.TrimSpace(string(stderr))
+	if msg == "" {
+		return ""
+	}
+	lower := strings.ToLower(msg)
+	if op == "decrypt" {
+		if strings.Contains(lower, "failed to open") && strings.Contains(lower, "keys.txt") {
+			return "age identity not found"
+		}
+		if strings.Contains(lower, "no identities matched") ||
+			strings.Contains(lower, "no identity matched") ||
+			strings.Contains(lower, "no identity found") ||
+			strings.Contains(lower, "failed to decrypt data key") ||
+			strings.Contains(lower, "no matching keys") ||
+			strings.Contains(lower, "no matching key") ||
+			strings.Contains(lower, "no keys found") {
+			if identityAvailable {
+				return "age identity does not match recipients"
+			}
+			return "age identity not found"
+		}
+		if strings.Contains(lower, "no identity") || strings.Contains(lower, "age identity") {
+			if identityAvailable {
+				return "age identity does not match recipients"
+			}
+			return "age identity not found"
+		}
+	}
+	if idx := strings.Index(msg, "\n"); idx >= 0 {
+		return strings.TrimSpace(msg[:idx])
+	}
+	return msg
+}
+
+func ageIdentityAvailable() bool {
+	path := identity.ActiveFile()
+	if path == "" {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aatuh/gitvault/internal/dotenv"
+	"github.com/aatuh/gitvault/internal/securemem"
+	"github.com/aatuh/sealr/ports"
+)
+
+type freshKey struct{}
+
+// WithFreshCiphertext disables ciphertext reuse for calls made with the
+// returned context, e.g. when a rotation must produce new data keys.
+func WithFreshCiphertext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshKey{}, true)
+}
+
+func wantsFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshKey{}).(bool)
+	return fresh
+}
+
+// Stable avoids git churn: SOPS produces a new ciphertext on every encrypt,
+// so when a plaintext that was just decrypted is encrypted again for the same
+// recipients, the original ciphertext is returned instead. Decrypts are
+// memoized too, which lets callers read a file more than once per command
+// without another SOPS round trip.
+type Stable struct {
+	Base ports.Encrypter
+	// Admit, when set, is asked before every decrypt that needs sops, and
+	// its error is returned instead of decrypting.
+	Admit func(ciphertext []byte) error
+
+	mu          sync.Mutex
+	ciphertexts map[[sha256.Size]byte][]byte
+	plaintexts  map[[sha256.Size]byte][]byte
+}
+
+func NewStable(base ports.Encrypter) *Stable {
+	return &Stable{
+		Base:        base,
+		ciphertexts: map[[sha256.Size]byte][]byte{},
+		plaintexts:  map[[sha256.Size]byte][]byte{},
+	}
+}
+
+// EncryptDotenv stores plaintext in canonical form, so values sealr
+// renders bare but would read back trimmed keep their whitespace.
+func (s *Stable) EncryptDotenv(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	return s.encrypt(ctx, "dotenv", dotenv.Canonical(plaintext), recipients, s.Base.EncryptDotenv)
+}
+
+func (s *Stable) DecryptDotenv(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return s.decrypt(ctx, "dotenv", ciphertext, s.Base.DecryptDotenv)
+}
+
+func (s *Stable) EncryptBinary(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	return s.encrypt(ctx, "binary", plaintext, recipients, s.Base.EncryptBinary)
+}
+
+func (s *Stable) DecryptBinary(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	return s.decrypt(ctx, "binary", ciphertext, s.Base.DecryptBinary)
+}
+
+func (s *Stable) Version(ctx context.Context) (string, error) {
+	return s.Base.Version(ctx)
+}
+
+type encryptFunc func(context.Context, []byte, []string) ([]byte, error)
+
+type decryptFunc func(context.Context, []byte) ([]byte, error)
+
+func (s *Stable) encrypt(ctx context.Context, format string, plaintext []byte, recipients []string, fn encryptFunc) ([]byte, error) {
+	key := digest(format, plaintext)
+	if !wantsFresh(ctx) {
+		s.mu.Lock()
+		previous, ok := s.ciphertexts[key]
+		s.mu.Unlock()
+		if ok && sameRecipients(ciphertextRecipients(previous), s.expectedRecipients(recipients)) {
+			return append([]byte(nil), previous...), nil
+		}
+	}
+	ciphertext, err := fn(ctx, plaintext, recipients)
+	if err != nil {
+		return nil, err
+	}
+	s.remember(format, append([]byte(nil), plaintext...), ciphertext)
+	return ciphertext, nil
+}
+
+func (s *Stable) decrypt(ctx context.Context, format string, ciphertext []byte, fn decryptFunc) ([]byte, error) {
+	s.mu.Lock()
+	plaintext, ok := s.plaintexts[digest(format, ciphertext)]
+	s.mu.Unlock()
+	if ok {
+		return append([]byte(nil), plaintext...), nil
+	}
+	if s.Admit != nil {
+		if err := s.Admit(ciphertext); err != nil {
+			return nil, err
+		}
+	}
+	plaintext, err := fn(ctx, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.remember(format, plaintext, ciphertext)
+	return append([]byte(nil), plaintext...), nil
+}
+
+// remember memoizes plaintext, which it takes ownership of: Wipe zeroes
+// that very buffer.
+func (s *Stable) remember(format string, plaintext, ciphertext []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ciphertexts == nil {
+		s.ciphertexts = map[[sha256.Size]byte][]byte{}
+		s.plaintexts = map[[sha256.Size]byte][]byte{}
+	}
+	s.ciphertexts[digest(format, plaintext)] = append([]byte(nil), ciphertext...)
+	key := digest(format, ciphertext)
+	securemem.Wipe(s.plaintexts[key])
+	securemem.Lock(plaintext)
+	s.plaintexts[key] = plaintext
+}
+
+// Wipe zeroes the memoized plaintexts. The command must be finished with
+// the vault: later reads decrypt again.
+func (s *Stable) Wipe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, plaintext := range s.plaintexts {
+		securemem.Wipe(plaintext)
+		delete(s.plaintexts, key)
+	}
+}
+
+// expectedRecipients lets the base encrypter describe recipients the way
+// they will appear in its output, e.g. when it applies key groups.
+func (s *Stable) expectedRecipients(recipients []string) []string {
+	if base, ok := s.Base.(interface{ expectedRecipients([]string) []string }); ok {
+		return base.expectedRecipients(recipients)
+	}
+	return recipients
+}
+
+func digest(format string, data []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(format))
+	h.Write([]byte{0})
+	h.Write(data)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+type sopsKeys struct {
+	Age []struct {
+		Recipient string `json:"recipient"`
+	} `json:"age"`
+	PGP []struct {
+		Fingerprint string `json:"fp"`
+	} `json:"pgp"`
+}
+
+func (k sopsKeys) recipients(prefix string) []string {
+	var out []string
+	for _, age := range k.Age {
+		out = append(out, prefix+age.Recipient)
+	}
+	for _, pgp := range k.PGP {
+		out = append(out, prefix+PGPPrefix+pgp.Fingerprint)
+	}
+	return out
+}
+
+var groupKeyPattern = regexp.MustCompile(`^sops_key_groups__list_(\d+)__map_(age__list_\d+__map_recipient|pgp__list_\d+__map_fp)$`)
+
+// ciphertextRecipients reads the age recipients and PGP fingerprints (as
+// pgp:<fp>) from SOPS metadata in either the dotenv or the JSON (binary)
+// file format. Files with several key groups are described as
+// groupedRecipients does.
+func ciphertextRecipients(ciphertext []byte) []string {
+	var doc struct {
+		Sops struct {
+			sopsKeys
+			KeyGroups []sopsKeys `json:"key_groups"`
+			Threshold int        `json:"shamir_threshold"`
+		} `json:"sops"`
+	}
+	if err := json.Unmarshal(ciphertext, &doc); err == nil {
+		if len(doc.Sops.KeyGroups) == 0 {
+			return doc.Sops.recipients("")
+		}
+		var out []string
+		for i, group := range doc.Sops.KeyGroups {
+			out = append(out, group.recipients(fmt.Sprintf("group%d:", i))...)
+		}
+		return append(out, fmt.Sprintf("threshold:%d", doc.Sops.Threshold))
+	}
+	var out []string
+	threshold := ""
+	grouped := false
+	scanner := bufio.NewScanner(bytes.NewReader(ciphertext))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if match := groupKeyPattern.FindStringSubmatch(name); match != nil {
+			grouped = true
+			if strings.HasPrefix(match[2], "pgp") {
+				value = PGPPrefix + value
+			}
+			out = append(out, "group"+match[1]+":"+value)
+			continue
+		}
+		switch {
+		case name == "sops_shamir_threshold":
+			threshold = value
+		case strings.HasPrefix(name, "sops_age__list_") && strings.HasSuffix(name, "__map_recipient"):
+			out = append(out, value)
+		case strings.HasPrefix(name, "sops_pgp__list_") && strings.HasSuffix(name, "__map_fp"):
+			out = append(out, PGPPrefix+value)
+		}
+	}
+	if grouped {
+		out = append(out, "threshold:"+threshold)
+	}
+	return out
+}
+
+func sameRecipients(a, b []string) bool {
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+	a, b = sortedTrimmed(a), sortedTrimmed(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedTrimmed(values []string) []string {
+	out := make([]string, len(values))
+	for i, value := range values {
+		out[i] = strings.TrimSpace(value)
+	}
+	sort.Strings(out)
+	return out
+}
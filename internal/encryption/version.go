@@ -0,0 +1,83 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// SopsVersion is a parsed `sops --version` release number.
+type SopsVersion struct {
+	Major, Minor, Patch int
+}
+
+var (
+	// MinSopsVersion is the oldest release gitvault supports: age recipients
+	// and the dotenv format are both required.
+	MinSopsVersion = SopsVersion{3, 7, 0}
+	// subcommandVersion introduced `sops encrypt` and `sops decrypt`, which
+	// replace the older --encrypt and --decrypt flags.
+	subcommandVersion = SopsVersion{3, 9, 0}
+	// ageKeyEnvVersion is the first release gitvault trusts to read identities
+	// from SOPS_AGE_KEY; older ones get a key file instead.
+	ageKeyEnvVersion = SopsVersion{3, 8, 0}
+	// AgePluginVersion is the first release that hands age plugin recipients
+	// (e.g. age1yubikey1...) to the matching age-plugin-* binary.
+	AgePluginVersion = SopsVersion{3, 10, 0}
+)
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+func ParseSopsVersion(output string) (SopsVersion, bool) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return SopsVersion{}, false
+	}
+	var v SopsVersion
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	v.Patch, _ = strconv.Atoi(match[3])
+	return v, true
+}
+
+func (v SopsVersion) AtLeast(other SopsVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+func (v SopsVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// versionProbe runs `sops --version` at most once per process.
+type versionProbe struct {
+	once    sync.Once
+	version SopsVersion
+	known   bool
+}
+
+// detect returns the installed sops version. known is false when the output
+// cannot be parsed, in which case callers keep the long-standing arguments.
+func (s Sops) detect(ctx context.Context) (version SopsVersion, known bool, err error) {
+	if s.probe == nil {
+		return SopsVersion{}, false, nil
+	}
+	s.probe.once.Do(func() {
+		output, versionErr := s.Version(ctx)
+		if versionErr != nil {
+			return
+		}
+		s.probe.version, s.probe.known = ParseSopsVersion(output)
+	})
+	if s.probe.known && !s.probe.version.AtLeast(MinSopsVersion) {
+		return s.probe.version, true, fmt.Errorf("sops %s is older than the minimum supported %s", s.probe.version, MinSopsVersion)
+	}
+	return s.probe.version, s.probe.known, nil
+}
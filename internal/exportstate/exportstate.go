@@ -0,0 +1,91 @@
+package exportstate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/userconfig"
+)
+
+const fileName = "exports.json"
+
+// State records every file exported from any vault on this machine, so
+// `gitvault status` can find copies left behind by later vault changes.
+type State struct {
+	// Exports is keyed by the absolute path of the exported file.
+	Exports map[string]Export `json:"exports,omitempty"`
+}
+
+type Export struct {
+	Vault   string `json:"vault"`
+	Project string `json:"project"`
+	Env     string `json:"env"`
+	// Ciphertext is the SHA-256 of the env's encrypted file at export time.
+	Ciphertext string `json:"ciphertext"`
+	// Digest is the env's keyed plaintext digest from .gitvault/meta.json,
+	// when it was current. It tells a re-encryption apart from a change.
+	Digest string `json:"digest,omitempty"`
+	// File is the SHA-256 of what was written, to notice local edits.
+	File     string    `json:"file"`
+	Exported time.Time `json:"exported"`
+}
+
+// Path keeps the state next to the user config, so GITVAULT_CONFIG moves
+// both.
+func Path() (string, error) {
+	config, err := userconfig.Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(config), fileName), nil
+}
+
+func Load() (State, error) {
+	path, err := Path()
+	if err != nil {
+		return State{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return State{Exports: map[string]Export{}}, nil
+		}
+		return State{}, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, err
+	}
+	if state.Exports == nil {
+		state.Exports = map[string]Export{}
+	}
+	return state, nil
+}
+
+func Save(state State) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Record adds or replaces the entry for path, which must be absolute.
+func Record(path string, export Export) error {
+	state, err := Load()
+	if err != nil {
+		return err
+	}
+	state.Exports[path] = export
+	return Save(state)
+}
@@ -0,0 +1,30 @@
+// Package fusefs serves a fixed in-memory tree as a read-only FUSE
+// filesystem, so decrypted content can be read by path without ever being
+// written to disk.
+package fusefs
+
+// Node is a file or directory of the served tree.
+type Node struct {
+	Name     string
+	Dir      bool
+	Data     []byte
+	Children []*Node
+}
+
+// NewDir returns a directory holding children.
+func NewDir(name string, children ...*Node) *Node {
+	return &Node{Name: name, Dir: true, Children: children}
+}
+
+// NewFile returns a file with data as its content.
+func NewFile(name string, data []byte) *Node {
+	return &Node{Name: name, Data: data}
+}
+
+// Wipe overwrites every file's content with zeros.
+func (n *Node) Wipe() {
+	clear(n.Data)
+	for _, child := range n.Children {
+		child.Wipe()
+	}
+}
@@ -0,0 +1,418 @@
+//go:build linux
+
+package fusefs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Opcodes and struct sizes from the kernel's include/uapi/linux/fuse.h.
+const (
+	opLookup      = 1
+	opForget      = 2
+	opGetattr     = 3
+	opSetattr     = 4
+	opSymlink     = 6
+	opMknod       = 8
+	opMkdir       = 9
+	opUnlink      = 10
+	opRmdir       = 11
+	opRename      = 12
+	opLink        = 13
+	opOpen        = 14
+	opRead        = 15
+	opWrite       = 16
+	opStatfs      = 17
+	opRelease     = 18
+	opSetxattr    = 21
+	opRemovexattr = 24
+	opFlush       = 25
+	opInit        = 26
+	opOpendir     = 27
+	opReaddir     = 28
+	opReleasedir  = 29
+	opAccess      = 34
+	opCreate      = 35
+	opInterrupt   = 36
+	opDestroy     = 38
+	opBatchForget = 42
+	opFallocate   = 43
+	opRename2     = 45
+
+	inHeaderSize  = 40
+	outHeaderSize = 16
+	attrSize      = 88
+	entryOutSize  = 40 + attrSize
+	attrOutSize   = 16 + attrSize
+	openOutSize   = 16
+	statfsOutSize = 80
+	initOutSize   = 64
+
+	rootID   = 1
+	maxWrite = 128 << 10
+	// cacheTTL is how long the kernel may cache entries and attributes;
+	// the tree never changes while mounted.
+	cacheTTL = 3600
+)
+
+var le = binary.LittleEndian
+
+// Server answers the kernel's FUSE requests for one mounted tree.
+type Server struct {
+	dev        *os.File
+	mountpoint string
+	// fusermount is the helper that mounted the tree, used again to
+	// unmount it; empty when the mount syscall was allowed directly.
+	fusermount string
+	nodes      []*inode
+	uid, gid   uint32
+	mtime      uint64
+}
+
+type inode struct {
+	node     *Node
+	parent   uint64
+	children map[string]uint64
+	order    []uint64
+}
+
+// Mount mounts root read-only at mountpoint, an existing directory. Call
+// Serve to answer requests and Unmount to detach it.
+func Mount(mountpoint string, root *Node) (*Server, error) {
+	abs, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", mountpoint)
+	}
+	s := &Server{
+		mountpoint: abs,
+		uid:        uint32(os.Getuid()),
+		gid:        uint32(os.Getgid()),
+		mtime:      uint64(time.Now().Unix()),
+	}
+	s.add(root, rootID)
+	if err := s.mount(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Server) add(node *Node, parent uint64) uint64 {
+	id := uint64(len(s.nodes) + 1)
+	in := &inode{node: node, parent: parent, children: map[string]uint64{}}
+	s.nodes = append(s.nodes, in)
+	for _, child := range node.Children {
+		if _, dup := in.children[child.Name]; dup {
+			continue
+		}
+		childID := s.add(child, id)
+		in.children[child.Name] = childID
+		in.order = append(in.order, childID)
+	}
+	return id
+}
+
+func (s *Server) mount() error {
+	// os.OpenFile would put the descriptor in the runtime poller, whose
+	// nonblocking reads /dev/fuse answers with EAGAIN; Serve needs blocking
+	// reads.
+	fd, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err == nil {
+		dev := os.NewFile(uintptr(fd), "/dev/fuse")
+		opts := fmt.Sprintf("fd=%d,rootmode=40000,user_id=%d,group_id=%d,default_permissions", fd, s.uid, s.gid)
+		err = syscall.Mount("gitvault", s.mountpoint, "fuse.gitvault", syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, opts)
+		if err == nil {
+			s.dev = dev
+			return nil
+		}
+		dev.Close()
+	}
+	// Without CAP_SYS_ADMIN, mount through the setuid fusermount helper.
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if helper, lookErr := exec.LookPath(name); lookErr == nil {
+			return s.mountWithHelper(helper)
+		}
+	}
+	return fmt.Errorf("mount %s: %w (install fuse3 for an unprivileged fusermount3)", s.mountpoint, err)
+}
+
+// mountWithHelper runs fusermount, which mounts the filesystem and passes
+// the /dev/fuse descriptor back over a socket named by _FUSE_COMMFD.
+func (s *Server) mountWithHelper(helper string) error {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fds[0])
+	remote := os.NewFile(uintptr(fds[1]), "fusermount-socket")
+	var stderr bytes.Buffer
+	cmd := exec.Command(helper, "-o", "ro,nosuid,nodev,default_permissions,fsname=gitvault,subtype=gitvault", "--", s.mountpoint)
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.Stderr = &stderr
+	err = cmd.Start()
+	remote.Close()
+	if err != nil {
+		return err
+	}
+	dev, recvErr := receiveFD(fds[0])
+	if err := cmd.Wait(); err != nil {
+		if dev != nil {
+			dev.Close()
+		}
+		return fmt.Errorf("%s: %v: %s", filepath.Base(helper), err, strings.TrimSpace(stderr.String()))
+	}
+	if recvErr != nil {
+		return recvErr
+	}
+	s.dev = dev
+	s.fusermount = helper
+	return nil
+}
+
+func receiveFD(socket int) (*os.File, error) {
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(socket, buf, oob, 0)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("fusermount passed no file descriptor")
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fds[0]), "/dev/fuse"), nil
+}
+
+// Unmount detaches the filesystem, lazily if it is still in use; Serve
+// returns once the kernel lets go.
+func (s *Server) Unmount() error {
+	if s.fusermount != "" {
+		output, err := exec.Command(s.fusermount, "-u", "-z", s.mountpoint).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s -u: %v: %s", filepath.Base(s.fusermount), err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	err := syscall.Unmount(s.mountpoint, 0)
+	if errors.Is(err, syscall.EBUSY) {
+		err = syscall.Unmount(s.mountpoint, syscall.MNT_DETACH)
+	}
+	return err
+}
+
+// Serve answers requests until the filesystem is unmounted.
+func (s *Server) Serve() error {
+	defer s.dev.Close()
+	buf := make([]byte, maxWrite+4096)
+	for {
+		n, err := s.dev.Read(buf)
+		switch {
+		case err == nil:
+		case errors.Is(err, syscall.ENODEV), errors.Is(err, io.EOF):
+			return nil
+		case errors.Is(err, syscall.EINTR), errors.Is(err, syscall.ENOENT), errors.Is(err, syscall.EAGAIN):
+			continue
+		default:
+			return err
+		}
+		if n < inHeaderSize {
+			return fmt.Errorf("short fuse request (%d bytes)", n)
+		}
+		req := buf[:n]
+		opcode := le.Uint32(req[4:])
+		unique := le.Uint64(req[8:])
+		switch opcode {
+		case opForget, opBatchForget, opInterrupt:
+			// The kernel expects no reply; nodes live as long as the mount.
+			continue
+		case opDestroy:
+			s.reply(unique, nil, 0)
+			return nil
+		}
+		data, errno := s.dispatch(opcode, le.Uint64(req[16:]), req[inHeaderSize:])
+		s.reply(unique, data, errno)
+	}
+}
+
+func (s *Server) reply(unique uint64, data []byte, errno syscall.Errno) {
+	if errno != 0 {
+		data = nil
+	}
+	out := make([]byte, outHeaderSize+len(data))
+	le.PutUint32(out[0:], uint32(len(out)))
+	le.PutUint32(out[4:], uint32(-int32(errno)))
+	le.PutUint64(out[8:], unique)
+	copy(out[outHeaderSize:], data)
+	// A write fails with ENOENT when the request was interrupted meanwhile;
+	// there is nobody left to tell.
+	_, _ = s.dev.Write(out)
+}
+
+func (s *Server) dispatch(opcode uint32, nodeID uint64, body []byte) ([]byte, syscall.Errno) {
+	if opcode == opInit {
+		return initReply(body)
+	}
+	if nodeID < rootID || nodeID > uint64(len(s.nodes)) {
+		return nil, syscall.ENOENT
+	}
+	in := s.nodes[nodeID-1]
+	switch opcode {
+	case opLookup:
+		childID, ok := in.children[string(bytes.TrimRight(body, "\x00"))]
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+		out := make([]byte, entryOutSize)
+		le.PutUint64(out[0:], childID)
+		le.PutUint64(out[16:], cacheTTL)
+		le.PutUint64(out[24:], cacheTTL)
+		s.putAttr(out[40:], childID)
+		return out, 0
+	case opGetattr:
+		out := make([]byte, attrOutSize)
+		le.PutUint64(out[0:], cacheTTL)
+		s.putAttr(out[16:], nodeID)
+		return out, 0
+	case opOpen:
+		if in.node.Dir {
+			return nil, syscall.EISDIR
+		}
+		if le.Uint32(body)&syscall.O_ACCMODE != syscall.O_RDONLY {
+			return nil, syscall.EROFS
+		}
+		return make([]byte, openOutSize), 0
+	case opOpendir:
+		if !in.node.Dir {
+			return nil, syscall.ENOTDIR
+		}
+		return make([]byte, openOutSize), 0
+	case opRead:
+		offset, size := le.Uint64(body[8:]), uint64(le.Uint32(body[16:]))
+		data := in.node.Data
+		if offset >= uint64(len(data)) {
+			return nil, 0
+		}
+		return data[offset:min(offset+size, uint64(len(data)))], 0
+	case opReaddir:
+		return s.readdir(in, nodeID, le.Uint64(body[8:]), int(le.Uint32(body[16:]))), 0
+	case opRelease, opReleasedir, opFlush:
+		return nil, 0
+	case opAccess:
+		const writeOK = 2
+		if le.Uint32(body)&writeOK != 0 {
+			return nil, syscall.EROFS
+		}
+		return nil, 0
+	case opStatfs:
+		out := make([]byte, statfsOutSize)
+		le.PutUint64(out[24:], uint64(len(s.nodes)))
+		le.PutUint32(out[40:], 4096)
+		le.PutUint32(out[44:], 255)
+		le.PutUint32(out[48:], 4096)
+		return out, 0
+	case opSetattr, opSymlink, opMknod, opMkdir, opUnlink, opRmdir, opRename, opLink,
+		opWrite, opSetxattr, opRemovexattr, opCreate, opFallocate, opRename2:
+		return nil, syscall.EROFS
+	default:
+		return nil, syscall.ENOSYS
+	}
+}
+
+// initReply accepts protocol 7.12 and later, answering with at most 7.31.
+func initReply(body []byte) ([]byte, syscall.Errno) {
+	major, minor := le.Uint32(body[0:]), le.Uint32(body[4:])
+	if major < 7 || (major == 7 && minor < 12) {
+		return nil, syscall.EPROTO
+	}
+	if major > 7 {
+		minor = 31
+	}
+	out := make([]byte, initOutSize)
+	le.PutUint32(out[0:], 7)
+	le.PutUint32(out[4:], min(minor, 31))
+	le.PutUint32(out[8:], le.Uint32(body[8:]))
+	le.PutUint16(out[16:], 16)
+	le.PutUint16(out[18:], 12)
+	le.PutUint32(out[20:], maxWrite)
+	le.PutUint32(out[24:], 1)
+	return out, 0
+}
+
+// putAttr fills a struct fuse_attr. Files are 0400 and directories 0500,
+// owned by the user who mounted them.
+func (s *Server) putAttr(out []byte, id uint64) {
+	node := s.nodes[id-1].node
+	mode, nlink := uint32(syscall.S_IFREG|0o400), uint32(1)
+	if node.Dir {
+		mode, nlink = syscall.S_IFDIR|0o500, 2
+	}
+	size := uint64(len(node.Data))
+	le.PutUint64(out[0:], id)
+	le.PutUint64(out[8:], size)
+	le.PutUint64(out[16:], (size+511)/512)
+	le.PutUint64(out[24:], s.mtime)
+	le.PutUint64(out[32:], s.mtime)
+	le.PutUint64(out[40:], s.mtime)
+	le.PutUint32(out[60:], mode)
+	le.PutUint32(out[64:], nlink)
+	le.PutUint32(out[68:], s.uid)
+	le.PutUint32(out[72:], s.gid)
+	le.PutUint32(out[80:], 4096)
+}
+
+// readdir returns the fuse_dirent records from offset on that fit in size.
+// Offsets are entry positions, with "." and ".." first.
+func (s *Server) readdir(in *inode, id, offset uint64, size int) []byte {
+	type dirent struct {
+		name string
+		id   uint64
+	}
+	entries := []dirent{{".", id}, {"..", in.parent}}
+	for _, childID := range in.order {
+		entries = append(entries, dirent{s.nodes[childID-1].node.Name, childID})
+	}
+	var out []byte
+	for i := offset; i < uint64(len(entries)); i++ {
+		entry := entries[i]
+		recordSize := (24 + len(entry.name) + 7) &^ 7
+		if len(out)+recordSize > size {
+			break
+		}
+		record := make([]byte, recordSize)
+		le.PutUint64(record[0:], entry.id)
+		le.PutUint64(record[8:], i+1)
+		le.PutUint32(record[16:], uint32(len(entry.name)))
+		direntType := uint32(syscall.DT_REG)
+		if s.nodes[entry.id-1].node.Dir {
+			direntType = syscall.DT_DIR
+		}
+		le.PutUint32(record[20:], direntType)
+		copy(record[24:], entry.name)
+		out = append(out, record...)
+	}
+	return out
+}
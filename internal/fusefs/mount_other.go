@@ -0,0 +1,16 @@
+//go:build !linux
+
+package fusefs
+
+import "errors"
+
+// Server is unavailable outside Linux.
+type Server struct{}
+
+// Mount reports that FUSE mounts are only supported on Linux.
+func Mount(string, *Node) (*Server, error) {
+	return nil, errors.New("mount is only supported on Linux")
+}
+
+func (s *Server) Serve() error   { return nil }
+func (s *Server) Unmount() error { return nil }
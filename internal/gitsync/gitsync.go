@@ -0,0 +1,142 @@
+package gitsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	executil "github.com/aatuh/sealr/infra/exec"
+	"github.com/aatuh/sealr/ports"
+)
+
+const defaultRemote = "origin"
+
+// Target selects the remote and branch a sync talks to. Empty fields fall
+// back to the vault defaults, then to git's upstream tracking.
+type Target struct {
+	Remote  string
+	Branch  string
+	Mirrors []string
+	// NoMirrors skips the configured mirrors for one push.
+	NoMirrors bool
+}
+
+type targetKey struct{}
+
+// WithTarget overrides the configured target for one Pull or Push.
+func WithTarget(ctx context.Context, target Target) context.Context {
+	return context.WithValue(ctx, targetKey{}, target)
+}
+
+// Git wraps sealr's git adapter so pull and push honour an explicit remote
+// and branch, and so pushes are repeated to backup mirrors.
+type Git struct {
+	ports.Git
+	Runner executil.Runner
+	// Defaults come from the vault settings.
+	Defaults Target
+}
+
+// MirrorError reports a mirror that could not be updated after the primary
+// push succeeded.
+type MirrorError struct {
+	Mirror string
+	Err    error
+}
+
+func (e *MirrorError) Error() string {
+	return fmt.Sprintf("pushed, but mirror %s failed: %v", e.Mirror, e.Err)
+}
+
+func (e *MirrorError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateName rejects remote and branch names git would read as options.
+func ValidateName(value, field string) error {
+	if value == "" {
+		return nil
+	}
+	if strings.HasPrefix(value, "-") || strings.ContainsAny(value, " \t\r\n") {
+		return fmt.Errorf("invalid %s %q", field, value)
+	}
+	return nil
+}
+
+func (g Git) resolve(ctx context.Context) Target {
+	target := g.Defaults
+	if override, ok := ctx.Value(targetKey{}).(Target); ok {
+		if override.Remote != "" {
+			target.Remote = override.Remote
+		}
+		if override.Branch != "" {
+			target.Branch = override.Branch
+		}
+		if len(override.Mirrors) > 0 {
+			target.Mirrors = override.Mirrors
+		}
+		if override.NoMirrors {
+			target.Mirrors = nil
+		}
+	}
+	return target
+}
+
+func (g Git) Pull(ctx context.Context, repoRoot string) error {
+	target := g.resolve(ctx)
+	if target.Remote == "" && target.Branch == "" {
+		return g.Git.Pull(ctx, repoRoot)
+	}
+	args := []string{"-C", repoRoot, "pull", "--rebase", remoteOrDefault(target.Remote)}
+	if target.Branch != "" {
+		args = append(args, target.Branch)
+	}
+	if err := g.run(ctx, args); err != nil {
+		return fmt.Errorf("git pull failed: %w", err)
+	}
+	return nil
+}
+
+func (g Git) Push(ctx context.Context, repoRoot string) error {
+	target := g.resolve(ctx)
+	if target.Remote == "" && target.Branch == "" {
+		if err := g.Git.Push(ctx, repoRoot); err != nil {
+			return err
+		}
+	} else if err := g.run(ctx, pushArgs(repoRoot, remoteOrDefault(target.Remote), target.Branch)); err != nil {
+		return fmt.Errorf("git push failed: %w", err)
+	}
+	for _, mirror := range target.Mirrors {
+		if err := g.run(ctx, pushArgs(repoRoot, mirror, target.Branch)); err != nil {
+			return &MirrorError{Mirror: mirror, Err: err}
+		}
+	}
+	return nil
+}
+
+func pushArgs(repoRoot, remote, branch string) []string {
+	refspec := "HEAD"
+	if branch != "" {
+		refspec = "HEAD:refs/heads/" + branch
+	}
+	return []string{"-C", repoRoot, "push", remote, refspec}
+}
+
+func remoteOrDefault(remote string) string {
+	if remote == "" {
+		return defaultRemote
+	}
+	return remote
+}
+
+func (g Git) run(ctx context.Context, args []string) error {
+	if g.Runner == nil {
+		return errors.New("git runner is not configured")
+	}
+	_, stderr, err := g.Runner.Run(ctx, "git", args, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(stderr)))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aatuh/gitvault/internal/agekey"
+)
+
+const (
+	secretKeyPrefix = "AGE-SECRET-KEY-"
+	// pluginKeyPrefix marks identities handled by an age plugin, e.g. a
+	// YubiKey. sops passes them to the age-plugin-* binary.
+	pluginKeyPrefix = "AGE-PLUGIN-"
+)
+
+// ErrNoIdentities is returned by ParseSecretKeys for data without identities.
+var ErrNoIdentities = errors.New("no AGE-SECRET-KEY or AGE-PLUGIN entries found")
+
+// Source resolves age identities that are not visible to sops through its
+// own lookup (SOPS_AGE_KEY_FILE and the default keys.txt).
+type Source struct {
+	Files      []string
+	Keyring    Keyring
+	UseKeyring bool
+
+	once sync.Once
+	keys string
+	err  error
+}
+
+// AgeKeys returns identities to pass to sops via SOPS_AGE_KEY. The result is
+// resolved once per process.
+func (s *Source) AgeKeys() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	s.once.Do(func() {
+		keys := []string{}
+		for _, path := range s.Files {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				s.err = err
+				return
+			}
+			parsed, err := ParseSecretKeys(data)
+			if errors.Is(err, ErrNoIdentities) {
+				// An empty or placeholder file adds nothing; it must not
+				// stop identities found elsewhere from working.
+				continue
+			}
+			if err != nil {
+				s.err = fmt.Errorf("%s: %w", path, err)
+				return
+			}
+			keys = append(keys, parsed...)
+		}
+		if s.UseKeyring && s.Keyring != nil {
+			raw, err := s.Keyring.Get()
+			if err != nil {
+				s.err = err
+				return
+			}
+			keys = append(keys, strings.Fields(raw)...)
+		}
+		s.keys = strings.Join(keys, "\n")
+	})
+	return s.keys, s.err
+}
+
+// SearchFiles returns the configured identity search list followed by any
+// paths from GITVAULT_AGE_KEY_FILES.
+func SearchFiles(configured []string) []string {
+	files := append([]string{}, configured...)
+	for _, path := range filepath.SplitList(os.Getenv("GITVAULT_AGE_KEY_FILES")) {
+		if path = strings.TrimSpace(path); path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+func DefaultFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "sops", "age", "keys.txt")
+}
+
+// ActiveFile returns SOPS_AGE_KEY_FILE when set, otherwise the default path.
+func ActiveFile() string {
+	if path := strings.TrimSpace(os.Getenv("SOPS_AGE_KEY_FILE")); path != "" {
+		return path
+	}
+	return DefaultFile()
+}
+
+// ParseSecretKeys extracts AGE-SECRET-KEY and AGE-PLUGIN identity lines
+// from an identity file.
+func ParseSecretKeys(data []byte) ([]string, error) {
+	keys := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, secretKeyPrefix) || strings.HasPrefix(line, pluginKeyPrefix) {
+			keys = append(keys, line)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoIdentities
+	}
+	return keys, nil
+}
+
+type Entry struct {
+	Source     string
+	Path       string
+	Recipients []string
+	Err        error
+}
+
+// Discover lists every identity location gitvault knows about: the
+// SOPS_AGE_KEY_FILE override, the default keys.txt, extra files from the user
+// config, and the OS keyring when configured.
+func Discover(extraFiles []string, keyring Keyring) []Entry {
+	entries := []Entry{}
+	if path := strings.TrimSpace(os.Getenv("SOPS_AGE_KEY_FILE")); path != "" {
+		entries = append(entries, FileEntry("SOPS_AGE_KEY_FILE", path))
+	}
+	if path := DefaultFile(); path != "" {
+		entries = append(entries, FileEntry("default", path))
+	}
+	for _, path := range extraFiles {
+		entries = append(entries, FileEntry("config", path))
+	}
+	if keyring != nil {
+		entry := Entry{Source: "keyring", Path: keyringService + "/" + keyringAccount}
+		raw, err := keyring.Get()
+		if err != nil {
+			entry.Err = err
+		} else {
+			entry.Recipients, entry.Err = recipientsFor([]byte(strings.Join(strings.Fields(raw), "\n")))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// FileEntry reads the identities in path, labelled with source.
+func FileEntry(source, path string) Entry {
+	entry := Entry{Source: source, Path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		entry.Err = err
+		return entry
+	}
+	entry.Recipients, entry.Err = recipientsFor(data)
+	return entry
+}
+
+func recipientsFor(data []byte) ([]string, error) {
+	keys, err := ParseSecretKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, pluginKeyPrefix) {
+			continue
+		}
+		recipient, err := agekey.RecipientFromIdentity(key)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	// Plugin identities cannot be converted offline; their tools write the
+	// recipient into a comment instead.
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, value, ok := strings.Cut(line, "Recipient:"); ok {
+			if value = strings.TrimSpace(value); strings.HasPrefix(value, "age1") {
+				recipients = append(recipients, value)
+			}
+		}
+	}
+	return recipients, nil
+}
@@ -0,0 +1,86 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const (
+	keyringService = "gitvault"
+	keyringAccount = "age-identity"
+)
+
+var ErrKeyringUnsupported = errors.New("OS keyring is not supported on this platform")
+
+type Keyring interface {
+	Set(secret string) error
+	Get() (string, error)
+}
+
+// SystemKeyring returns the keyring backend for the current OS: the macOS
+// Keychain via `security`, or the Secret Service via `secret-tool`.
+func SystemKeyring() Keyring {
+	switch runtime.GOOS {
+	case "darwin":
+		return keychain{}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return secretService{}
+	default:
+		return unsupportedKeyring{}
+	}
+}
+
+type keychain struct{}
+
+// Set uses interactive mode so the identity never appears in process args.
+func (keychain) Set(secret string) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w \"%s\"\n", keyringService, keyringAccount, strings.Join(strings.Fields(secret), " "))
+	return runKeyring([]byte(command), "security", "-i")
+}
+
+func (keychain) Get() (string, error) {
+	output, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w").Output()
+	if err != nil {
+		return "", fmt.Errorf("keychain lookup failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+type secretService struct{}
+
+func (secretService) Set(secret string) error {
+	return runKeyring([]byte(secret), "secret-tool", "store", "--label=gitvault age identity", "service", keyringService, "account", keyringAccount)
+}
+
+func (secretService) Get() (string, error) {
+	output, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount).Output()
+	if err != nil {
+		return "", fmt.Errorf("secret service lookup failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+type unsupportedKeyring struct{}
+
+func (unsupportedKeyring) Set(string) error {
+	return ErrKeyringUnsupported
+}
+
+func (unsupportedKeyring) Get() (string, error) {
+	return "", ErrKeyringUnsupported
+}
+
+func runKeyring(input []byte, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if input != nil {
+		cmd.Stdin = strings.NewReader(string(input))
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package keymeta
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/sealr/ports"
+)
+
+const (
+	fileName    = "meta.json"
+	keyFileName = "digest.key"
+	keySize     = 32
+	version     = 1
+)
+
+// Meta holds gitvault's per-env and per-key metadata. sealr's index has a
+// fixed schema, so these fields live in a sidecar next to it.
+type Meta struct {
+	Version  int                 `json:"version"`
+	Projects map[string]*Project `json:"projects,omitempty"`
+
+	// key is this machine's digest key, read on first use.
+	key []byte
+}
+
+type Project struct {
+	Envs map[string]*Env `json:"envs,omitempty"`
+}
+
+type Env struct {
+	// Digest is a keyed hash of the env's dotenv plaintext, used to detect
+	// no-op writes without decrypting.
+	Digest string `json:"digest,omitempty"`
+	// DigestKey is the KeyID of the key Digest and Keys were taken with.
+	// Digests from another machine's key cannot be compared with this one's.
+	DigestKey string `json:"digestKey,omitempty"`
+	// Ciphertext is the SHA-256 of the encrypted file Digest was taken from.
+	// A mismatch means the file changed behind gitvault's back and Digest
+	// must not be trusted.
+	Ciphertext string `json:"ciphertext,omitempty"`
+	// Keys maps each key to ValueDigest of its value, taken from the same
+	// ciphertext, so single values can be compared without decrypting.
+	Keys map[string]string `json:"keys,omitempty"`
+	// Audiences lists who each key is meant for, such as ci or deploy.
+	// Unlike the digests it is set by hand and survives rewrites.
+	Audiences map[string][]string `json:"audiences,omitempty"`
+	// Aliases maps keys that hold no value of their own to the
+	// project/env/KEY they take it from, so a shared value is stored once.
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Deprecated marks keys being phased out, e.g. during a staged rename.
+	// They are still exported, with a warning.
+	Deprecated map[string]Deprecation `json:"deprecated,omitempty"`
+}
+
+type Deprecation struct {
+	Replacement string    `json:"replacement,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	Since       time.Time `json:"since"`
+}
+
+type Store struct {
+	FS ports.FileSystem
+}
+
+func Path(root string) string {
+	return filepath.Join(root, ".gitvault", fileName)
+}
+
+func New() Meta {
+	return Meta{Version: version, Projects: map[string]*Project{}}
+}
+
+func (s Store) Load(root string) (Meta, error) {
+	data, err := s.FS.ReadFile(Path(root))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return New(), nil
+		}
+		return Meta{}, err
+	}
+	var m Meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Meta{}, err
+	}
+	if m.Version <= 0 {
+		m.Version = version
+	}
+	if m.Projects == nil {
+		m.Projects = map[string]*Project{}
+	}
+	return m, nil
+}
+
+func (s Store) Save(root string, m Meta) error {
+	m.prune()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.FS, Path(root), append(data, '\n'))
+}
+
+// Env returns the entry for project/env, creating it when missing.
+func (m *Meta) Env(project, env string) *Env {
+	if m.Projects == nil {
+		m.Projects = map[string]*Project{}
+	}
+	p, ok := m.Projects[project]
+	if !ok {
+		p = &Project{}
+		m.Projects[project] = p
+	}
+	if p.Envs == nil {
+		p.Envs = map[string]*Env{}
+	}
+	e, ok := p.Envs[env]
+	if !ok {
+		e = &Env{}
+		p.Envs[env] = e
+	}
+	return e
+}
+
+func (m Meta) Lookup(project, env string) (*Env, bool) {
+	p, ok := m.Projects[project]
+	if !ok || p == nil {
+		return nil, false
+	}
+	e, ok := p.Envs[env]
+	return e, ok && e != nil
+}
+
+func (m *Meta) RemoveEnv(project, env string) {
+	p, ok := m.Projects[project]
+	if !ok || p == nil {
+		return
+	}
+	delete(p.Envs, env)
+	if len(p.Envs) == 0 {
+		delete(m.Projects, project)
+	}
+}
+
+// Digest hashes plaintext with this machine's digest key. meta.json is
+// committed, so the key stays out of the vault: anyone holding it could test
+// guessed values against every digest.
+func (m *Meta) Digest(plaintext []byte) (string, error) {
+	if err := m.ensureKey(); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write(plaintext)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// KeyID names the digest key without revealing it, for Env.DigestKey.
+func (m *Meta) KeyID() (string, error) {
+	if err := m.ensureKey(); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte("key-id"))
+	return hex.EncodeToString(mac.Sum(nil)[:8]), nil
+}
+
+// ValueDigest hashes one secret value. It is domain-separated from Digest,
+// so a value can never match the digest of a whole env.
+func (m *Meta) ValueDigest(value string) (string, error) {
+	return m.Digest(append([]byte("value\x00"), value...))
+}
+
+func (m *Meta) ensureKey() error {
+	if m.key != nil {
+		return nil
+	}
+	key, err := loadKey()
+	if err != nil {
+		return fmt.Errorf("digest key: %w", err)
+	}
+	m.key = key
+	return nil
+}
+
+// KeyPath keeps the digest key next to the user config, so GITVAULT_CONFIG
+// moves both.
+func KeyPath() (string, error) {
+	config, err := userconfig.Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(config), keyFileName), nil
+}
+
+// loadKey reads the digest key, creating it on first use. A new key is
+// linked into place so that concurrent first uses agree on one.
+func loadKey() ([]byte, error) {
+	path, err := KeyPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := createKey(path); err != nil && !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("%s is not a valid digest key", path)
+	}
+	return key, nil
+}
+
+func createKey(path string) error {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), keyFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Link(tmp.Name(), path)
+}
+
+func (e Env) empty() bool {
+	return e.Digest == "" && len(e.Keys) == 0 && len(e.Audiences) == 0 && len(e.Aliases) == 0 && len(e.Deprecated) == 0
+}
+
+func CiphertextSum(ciphertext []byte) string {
+	sum := sha256.Sum256(ciphertext)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (m *Meta) prune() {
+	for name, p := range m.Projects {
+		if p == nil {
+			delete(m.Projects, name)
+			continue
+		}
+		for env, e := range p.Envs {
+			if e != nil && e.DigestKey == "" {
+				// Digests of older versions were keyed with a salt kept in
+				// this file; drop them rather than keep them guessable.
+				e.Digest, e.Ciphertext, e.Keys = "", "", nil
+			}
+			if e == nil || e.empty() {
+				delete(p.Envs, env)
+			}
+		}
+		if len(p.Envs) == 0 {
+			delete(m.Projects, name)
+		}
+	}
+}
+
+func writeFileAtomic(fs ports.FileSystem, path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return fs.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,43 @@
+package opaque
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aatuh/sealr/ports"
+)
+
+// Encrypter stores dotenv payloads as opaque binary blobs while the layout is
+// enabled. sops' dotenv format keeps key names in clear text, which would
+// reveal what each obfuscated file contains.
+type Encrypter struct {
+	ports.Encrypter
+	Layout *FS
+}
+
+func (e Encrypter) EncryptDotenv(ctx context.Context, plaintext []byte, recipients []string) ([]byte, error) {
+	if e.Layout.Enabled() {
+		return e.Encrypter.EncryptBinary(ctx, plaintext, recipients)
+	}
+	return e.Encrypter.EncryptDotenv(ctx, plaintext, recipients)
+}
+
+func (e Encrypter) DecryptDotenv(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if isBinaryDocument(ciphertext) {
+		return e.Encrypter.DecryptBinary(ctx, ciphertext)
+	}
+	return e.Encrypter.DecryptDotenv(ctx, ciphertext)
+}
+
+// isBinaryDocument reports whether ciphertext is a sops binary-format file,
+// which is a JSON object with "data" and "sops" members.
+func isBinaryDocument(ciphertext []byte) bool {
+	var doc struct {
+		Data *string         `json:"data"`
+		Sops json.RawMessage `json:"sops"`
+	}
+	if err := json.Unmarshal(ciphertext, &doc); err != nil {
+		return false
+	}
+	return doc.Data != nil && len(doc.Sops) > 0
+}
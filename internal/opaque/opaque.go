@@ -0,0 +1,497 @@
+// Package opaque implements the obfuscated vault layout. Project, env, and file
+// names under secrets/ and files/ are replaced by keyed hashes, and the index
+// (which holds the only copy of the real names and the hash key) is stored
+// encrypted. sealr keeps working with logical paths; FS translates them.
+package opaque
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aatuh/sealr/domain"
+	"github.com/aatuh/sealr/ports"
+)
+
+const (
+	secretsDir  = "secrets"
+	filesDir    = "files"
+	envSuffix   = ".env"
+	saltSize    = 32
+	hashedBytes = 16
+)
+
+// sealedFiles are other metadata files under .gitvault that mention names
+// and are therefore stored encrypted as a whole. One written before the vault
+// had recipients stays plaintext until its next write.
+var sealedFiles = []string{"meta.json", "settings.json"}
+
+var ErrNoRecipients = errors.New("obfuscated vaults need at least one recipient to encrypt the index")
+
+// sealedIndex is the plaintext stored (encrypted) in .gitvault/index.json.
+type sealedIndex struct {
+	Salt  string          `json:"salt"`
+	Index json.RawMessage `json:"index,omitempty"`
+}
+
+type FS struct {
+	Base      ports.FileSystem
+	Encrypter ports.Encrypter
+
+	mu      sync.Mutex
+	root    string
+	loaded  bool
+	salt    []byte
+	index   []byte
+	reverse map[string]string
+}
+
+// Enable switches the layout on for the vault at root. Paths outside root are
+// passed through unchanged. Enabling it again drops the cached index, so a
+// vault pulled since is read afresh.
+func (f *FS) Enable(root string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.root = root
+	f.loaded = false
+}
+
+func (f *FS) Enabled() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.root != ""
+}
+
+func (f *FS) ReadFile(path string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.isIndex(path) {
+		if err := f.load(); err != nil {
+			return nil, err
+		}
+		if f.index == nil {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		return append([]byte(nil), f.index...), nil
+	}
+	if f.isSealed(path) {
+		return f.unseal(path)
+	}
+	physical, mapped, err := f.physical(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.Base.ReadFile(physical)
+	if err != nil || !mapped {
+		return data, err
+	}
+	// sealr stages rewrites next to the logical path, so make sure that
+	// directory exists before a read-modify-write such as rotation.
+	if err := f.Base.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (f *FS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.isIndex(path) {
+		return f.writeIndex(data)
+	}
+	if f.isSealed(path) {
+		return f.seal(path, data)
+	}
+	physical, _, err := f.physical(path)
+	if err != nil {
+		return err
+	}
+	return f.Base.WriteFile(physical, data, perm)
+}
+
+func (f *FS) MkdirAll(path string, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	physical, mapped, err := f.physical(path)
+	if err != nil {
+		return err
+	}
+	if mapped {
+		if err := f.Base.MkdirAll(path, perm); err != nil {
+			return err
+		}
+	}
+	return f.Base.MkdirAll(physical, perm)
+}
+
+func (f *FS) Remove(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	physical, _, err := f.physical(path)
+	if err != nil {
+		return err
+	}
+	return f.Base.Remove(physical)
+}
+
+func (f *FS) RemoveAll(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	physical, _, err := f.physical(path)
+	if err != nil {
+		return err
+	}
+	return f.Base.RemoveAll(physical)
+}
+
+func (f *FS) Stat(path string) (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	physical, _, err := f.physical(path)
+	if err != nil {
+		return nil, err
+	}
+	return f.Base.Stat(physical)
+}
+
+func (f *FS) ReadDir(path string) ([]os.DirEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	physical, _, err := f.physical(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.Base.ReadDir(physical)
+	if err != nil || !f.inLayout(path) {
+		return entries, err
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	out := make([]os.DirEntry, 0, len(entries))
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		name, ok := f.reverse[entry.Name()]
+		if !ok {
+			name = entry.Name()
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, renamedEntry{DirEntry: entry, name: name})
+	}
+	return out, nil
+}
+
+func (f *FS) Rename(oldpath, newpath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.isIndex(newpath) || f.isSealed(newpath) {
+		data, err := f.Base.ReadFile(oldpath)
+		if err != nil {
+			return err
+		}
+		if f.isIndex(newpath) {
+			err = f.writeIndex(data)
+		} else {
+			err = f.seal(newpath, data)
+		}
+		if err != nil {
+			return err
+		}
+		return f.Base.Remove(oldpath)
+	}
+	physical, mapped, err := f.physical(newpath)
+	if err != nil {
+		return err
+	}
+	if err := f.Base.Rename(oldpath, physical); err != nil {
+		return err
+	}
+	if mapped {
+		f.dropStaging(filepath.Dir(newpath))
+	}
+	if f.isConfig(newpath) {
+		return f.reseal()
+	}
+	return nil
+}
+
+func (f *FS) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	physical, _, err := f.physical(path)
+	if err != nil {
+		return nil, err
+	}
+	return f.Base.OpenFile(physical, flag, perm)
+}
+
+func (f *FS) isIndex(path string) bool {
+	return f.root != "" && path == filepath.Join(f.root, ".gitvault", "index.json")
+}
+
+func (f *FS) isSealed(path string) bool {
+	if f.root == "" {
+		return false
+	}
+	for _, name := range sealedFiles {
+		if path == filepath.Join(f.root, ".gitvault", name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FS) isConfig(path string) bool {
+	return f.root != "" && path == filepath.Join(f.root, ".gitvault", "config.json")
+}
+
+func (f *FS) inLayout(path string) bool {
+	parts := f.relParts(path)
+	return len(parts) > 0 && (parts[0] == secretsDir || parts[0] == filesDir)
+}
+
+func (f *FS) relParts(path string) []string {
+	if f.root == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// physical maps a logical vault path to its on-disk location. mapped reports
+// whether the two differ.
+func (f *FS) physical(path string) (string, bool, error) {
+	parts := f.relParts(path)
+	if len(parts) < 2 {
+		return path, false, nil
+	}
+	secret := parts[0] == secretsDir && (len(parts) == 2 || len(parts) == 3 && strings.HasSuffix(parts[2], envSuffix))
+	file := parts[0] == filesDir && len(parts) <= 4
+	if !secret && !file {
+		return path, false, nil
+	}
+	if err := f.load(); err != nil {
+		return "", false, err
+	}
+	out := []string{f.root, parts[0], f.hash("project", parts[1])}
+	switch {
+	case secret && len(parts) == 3:
+		env := strings.TrimSuffix(parts[2], envSuffix)
+		out = append(out, f.hash("env", parts[1], env)+envSuffix)
+	case file && len(parts) >= 3:
+		out = append(out, f.hash("env", parts[1], parts[2]))
+		if len(parts) == 4 {
+			out = append(out, f.hash("file", parts[1], parts[2], parts[3]))
+		}
+	}
+	return filepath.Join(out...), true, nil
+}
+
+func (f *FS) hash(kind string, names ...string) string {
+	mac := hmac.New(sha256.New, f.salt)
+	mac.Write([]byte(kind))
+	for _, name := range names {
+		mac.Write([]byte{0})
+		mac.Write([]byte(name))
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:hashedBytes])
+}
+
+// dropStaging removes the logical directories sealr wrote its temp file into,
+// so real names never linger in the working tree. Non-empty dirs are kept.
+func (f *FS) dropStaging(dir string) {
+	for f.inLayout(dir) && len(f.relParts(dir)) > 1 {
+		if err := f.Base.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (f *FS) load() error {
+	if f.loaded {
+		return nil
+	}
+	path := filepath.Join(f.root, ".gitvault", "index.json")
+	data, err := f.Base.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		f.salt, f.index = salt, nil
+		f.buildReverse()
+		f.loaded = true
+		return nil
+	}
+	plaintext, err := f.Encrypter.DecryptBinary(context.Background(), data)
+	if err != nil {
+		return fmt.Errorf("decrypt vault index: %w", err)
+	}
+	var sealed sealedIndex
+	if err := json.Unmarshal(plaintext, &sealed); err != nil {
+		return fmt.Errorf("parse vault index: %w", err)
+	}
+	salt, err := base64.StdEncoding.DecodeString(sealed.Salt)
+	if err != nil || len(salt) == 0 {
+		return errors.New("vault index has no valid name salt")
+	}
+	f.salt = salt
+	f.index = nil
+	if len(sealed.Index) > 0 {
+		f.index = []byte(sealed.Index)
+	}
+	f.buildReverse()
+	f.loaded = true
+	return nil
+}
+
+func (f *FS) writeIndex(data []byte) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(sealedIndex{
+		Salt:  base64.StdEncoding.EncodeToString(f.salt),
+		Index: json.RawMessage(bytes.TrimSpace(data)),
+	})
+	if err != nil {
+		return err
+	}
+	if err := f.seal(filepath.Join(f.root, ".gitvault", "index.json"), payload); err != nil {
+		return err
+	}
+	f.index = append([]byte(nil), data...)
+	f.buildReverse()
+	return nil
+}
+
+func (f *FS) seal(path string, plaintext []byte) error {
+	cfgData, err := f.Base.ReadFile(filepath.Join(f.root, ".gitvault", "config.json"))
+	if err != nil {
+		return err
+	}
+	var cfg domain.Config
+	if err := json.Unmarshal(cfgData, &cfg); err != nil {
+		return err
+	}
+	if len(cfg.Recipients) == 0 {
+		return ErrNoRecipients
+	}
+	ciphertext, err := f.Encrypter.EncryptBinary(context.Background(), plaintext, cfg.Recipients)
+	if err != nil {
+		return err
+	}
+	return f.Base.WriteFile(path, ciphertext, 0600)
+}
+
+func (f *FS) unseal(path string) ([]byte, error) {
+	data, err := f.Base.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !Sealed(data) {
+		return data, nil
+	}
+	plaintext, err := f.Encrypter.DecryptBinary(context.Background(), data)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", filepath.Base(path), err)
+	}
+	return plaintext, nil
+}
+
+// Sealed reports whether data read from a sealed file is encrypted rather
+// than plaintext JSON.
+func Sealed(data []byte) bool {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return true
+	}
+	_, ok := doc["sops"]
+	return ok
+}
+
+// reseal re-encrypts the index and sealed files after a recipient change.
+func (f *FS) reseal() error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	if f.index != nil {
+		if err := f.writeIndex(f.index); err != nil {
+			return err
+		}
+	}
+	for _, name := range sealedFiles {
+		path := filepath.Join(f.root, ".gitvault", name)
+		plaintext, err := f.unseal(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err := f.seal(path, plaintext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FS) buildReverse() {
+	f.reverse = map[string]string{}
+	if f.index == nil {
+		return
+	}
+	var idx domain.Index
+	if err := json.Unmarshal(f.index, &idx); err != nil {
+		return
+	}
+	for project, p := range idx.Projects {
+		f.reverse[f.hash("project", project)] = project
+		if p == nil {
+			continue
+		}
+		for env, e := range p.Envs {
+			hashed := f.hash("env", project, env)
+			f.reverse[hashed] = env
+			f.reverse[hashed+envSuffix] = env + envSuffix
+			if e == nil {
+				continue
+			}
+			for name := range e.Files {
+				f.reverse[f.hash("file", project, env, name)] = name
+			}
+		}
+	}
+}
+
+type renamedEntry struct {
+	os.DirEntry
+	name string
+}
+
+func (e renamedEntry) Name() string {
+	return e.name
+}
@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxResponseSize bounds how much of an API response is read.
+const maxResponseSize = 4 << 20
+
+// api is a JSON REST endpoint with fixed headers.
+type api struct {
+	name    string
+	baseURL string
+	header  http.Header
+	client  *http.Client
+}
+
+// newAPI reads the base URL from urlEnv, falling back to defaultURL; the
+// override is for enterprise installs and proxies.
+func newAPI(name, urlEnv, defaultURL string, header http.Header) api {
+	baseURL := strings.TrimRight(os.Getenv(urlEnv), "/")
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+	return api{name: name, baseURL: baseURL, header: header, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// firstEnv returns the first of names that is set, or "".
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (c api) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s %s: %s", c.name, method, strings.SplitN(path, "?", 2)[0], apiErrorMessage(resp.Status, data))
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// apiErrorMessage adds the provider's error text to status. GitHub, Heroku,
+// and Netlify send {"message"}; Vercel nests it under "error".
+func apiErrorMessage(status string, data []byte) string {
+	var apiErr struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &apiErr) != nil {
+		return status
+	}
+	if apiErr.Message != "" {
+		return status + ": " + apiErr.Message
+	}
+	if apiErr.Error.Message != "" {
+		return status + ": " + apiErr.Error.Message
+	}
+	return status
+}
@@ -0,0 +1,261 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// EnvStore is a platform's env vars for one app and deployment target.
+type EnvStore interface {
+	// Target names the app and deployment target for reports.
+	Target() string
+	// Vars returns the current variables. Values the platform will not
+	// reveal come back empty.
+	Vars(ctx context.Context) (map[string]string, error)
+	// Apply sets and deletes variables and returns the error of each key
+	// that failed. Vars must be called first.
+	Apply(ctx context.Context, set map[string]string, remove []string) map[string]error
+}
+
+// VercelTargets are the deployment targets a Vercel variable applies to.
+var VercelTargets = []string{"production", "preview", "development"}
+
+// Vercel holds the variables of a Vercel project for one target.
+type Vercel struct {
+	Project string
+	Team    string
+	Env     string
+	api     api
+	ids     map[string]string
+}
+
+// NewVercel authenticates with VERCEL_TOKEN; VERCEL_API_URL overrides the
+// endpoint.
+func NewVercel(project, team, target string) (*Vercel, error) {
+	token := firstEnv("VERCEL_TOKEN")
+	if token == "" {
+		return nil, errors.New("VERCEL_TOKEN must be set")
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return &Vercel{Project: project, Team: team, Env: target, api: newAPI("vercel", "VERCEL_API_URL", "https://api.vercel.com", header)}, nil
+}
+
+func (v *Vercel) Target() string {
+	return fmt.Sprintf("vercel %s (%s)", v.Project, v.Env)
+}
+
+func (v *Vercel) Vars(ctx context.Context) (map[string]string, error) {
+	var resp struct {
+		Envs []struct {
+			ID     string   `json:"id"`
+			Key    string   `json:"key"`
+			Value  string   `json:"value"`
+			Type   string   `json:"type"`
+			Target []string `json:"target"`
+		} `json:"envs"`
+	}
+	if err := v.api.do(ctx, http.MethodGet, v.path("/v9", "")+v.query(url.Values{"decrypt": {"true"}}), nil, &resp); err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	v.ids = map[string]string{}
+	for _, env := range resp.Envs {
+		if !slices.Contains(env.Target, v.Env) {
+			continue
+		}
+		v.ids[env.Key] = env.ID
+		vars[env.Key] = env.Value
+		if env.Type == "sensitive" {
+			vars[env.Key] = ""
+		}
+	}
+	return vars, nil
+}
+
+func (v *Vercel) Apply(ctx context.Context, set map[string]string, remove []string) map[string]error {
+	errs := map[string]error{}
+	for key, value := range set {
+		var err error
+		if id, ok := v.ids[key]; ok {
+			err = v.api.do(ctx, http.MethodPatch, v.path("/v9", id)+v.query(url.Values{}), map[string]string{"value": value}, nil)
+		} else {
+			body := map[string]any{"key": key, "value": value, "type": "encrypted", "target": []string{v.Env}}
+			err = v.api.do(ctx, http.MethodPost, v.path("/v10", "")+v.query(url.Values{}), body, nil)
+		}
+		if err != nil {
+			errs[key] = err
+		}
+	}
+	for _, key := range remove {
+		if err := v.api.do(ctx, http.MethodDelete, v.path("/v9", v.ids[key])+v.query(url.Values{}), nil, nil); err != nil {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+func (v *Vercel) path(version, id string) string {
+	path := version + "/projects/" + url.PathEscape(v.Project) + "/env"
+	if id != "" {
+		path += "/" + url.PathEscape(id)
+	}
+	return path
+}
+
+func (v *Vercel) query(values url.Values) string {
+	if v.Team != "" {
+		values.Set("teamId", v.Team)
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+// Netlify holds the variables of a Netlify site for one deploy context
+// ("all" unless set).
+type Netlify struct {
+	Account string
+	Site    string
+	Context string
+	api     api
+	values  map[string]string
+}
+
+// NewNetlify authenticates with NETLIFY_AUTH_TOKEN; NETLIFY_API_URL
+// overrides the endpoint.
+func NewNetlify(account, site, deployContext string) (*Netlify, error) {
+	token := firstEnv("NETLIFY_AUTH_TOKEN")
+	if token == "" {
+		return nil, errors.New("NETLIFY_AUTH_TOKEN must be set")
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return &Netlify{Account: account, Site: site, Context: deployContext, api: newAPI("netlify", "NETLIFY_API_URL", "https://api.netlify.com/api/v1", header)}, nil
+}
+
+func (n *Netlify) Target() string {
+	return fmt.Sprintf("netlify %s (%s)", n.Site, n.Context)
+}
+
+func (n *Netlify) Vars(ctx context.Context) (map[string]string, error) {
+	var resp []struct {
+		Key    string `json:"key"`
+		Values []struct {
+			ID      string `json:"id"`
+			Value   string `json:"value"`
+			Context string `json:"context"`
+		} `json:"values"`
+	}
+	if err := n.api.do(ctx, http.MethodGet, n.path("")+"?site_id="+url.QueryEscape(n.Site), nil, &resp); err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	n.values = map[string]string{}
+	for _, env := range resp {
+		for _, value := range env.Values {
+			if value.Context == n.Context {
+				vars[env.Key] = value.Value
+				n.values[env.Key] = value.ID
+			}
+		}
+	}
+	return vars, nil
+}
+
+func (n *Netlify) Apply(ctx context.Context, set map[string]string, remove []string) map[string]error {
+	errs := map[string]error{}
+	site := "?site_id=" + url.QueryEscape(n.Site)
+	for key, value := range set {
+		var err error
+		if _, ok := n.values[key]; ok {
+			err = n.api.do(ctx, http.MethodPatch, n.path(key)+site, map[string]string{"context": n.Context, "value": value}, nil)
+		} else {
+			body := []map[string]any{{"key": key, "values": []map[string]string{{"context": n.Context, "value": value}}}}
+			err = n.api.do(ctx, http.MethodPost, n.path("")+site, body, nil)
+		}
+		if err != nil {
+			errs[key] = err
+		}
+	}
+	for _, key := range remove {
+		path := n.path(key)
+		if n.Context != "all" {
+			path += "/value/" + url.PathEscape(n.values[key])
+		}
+		if err := n.api.do(ctx, http.MethodDelete, path+site, nil, nil); err != nil {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+func (n *Netlify) path(key string) string {
+	path := "/accounts/" + url.PathEscape(n.Account) + "/env"
+	if key != "" {
+		path += "/" + url.PathEscape(key)
+	}
+	return path
+}
+
+// Heroku holds the config vars of a Heroku app.
+type Heroku struct {
+	App string
+	api api
+}
+
+// NewHeroku authenticates with HEROKU_API_KEY; HEROKU_API_URL overrides the
+// endpoint.
+func NewHeroku(app string) (*Heroku, error) {
+	token := firstEnv("HEROKU_API_KEY")
+	if token == "" {
+		return nil, errors.New("HEROKU_API_KEY must be set")
+	}
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.heroku+json; version=3")
+	header.Set("Authorization", "Bearer "+token)
+	return &Heroku{App: app, api: newAPI("heroku", "HEROKU_API_URL", "https://api.heroku.com", header)}, nil
+}
+
+func (h *Heroku) Target() string {
+	return "heroku " + h.App
+}
+
+func (h *Heroku) Vars(ctx context.Context) (map[string]string, error) {
+	vars := map[string]string{}
+	if err := h.api.do(ctx, http.MethodGet, h.path(), nil, &vars); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// Apply sends every change in one request, so the app restarts once; a
+// failure fails every key.
+func (h *Heroku) Apply(ctx context.Context, set map[string]string, remove []string) map[string]error {
+	body := map[string]*string{}
+	for key, value := range set {
+		body[key] = &value
+	}
+	for _, key := range remove {
+		body[key] = nil
+	}
+	errs := map[string]error{}
+	if len(body) == 0 {
+		return errs
+	}
+	if err := h.api.do(ctx, http.MethodPatch, h.path(), body, nil); err != nil {
+		for key := range body {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+func (h *Heroku) path() string {
+	return "/apps/" + url.PathEscape(h.App) + "/config-vars"
+}
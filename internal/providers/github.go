@@ -0,0 +1,133 @@
+// Package providers talks to the hosted secret stores and platform env-var
+// APIs gitvault can push an env to.
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+var (
+	githubRepoPattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+	githubSecretPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// GitHub manages the Actions secrets of one repository, or of one of its
+// deployment environments when Environment is set.
+type GitHub struct {
+	Repo        string
+	Environment string
+	api         api
+}
+
+// NewGitHub returns a client for repo ("owner/name") authenticated with
+// GITHUB_TOKEN or GH_TOKEN. GITHUB_API_URL overrides the API endpoint for
+// GitHub Enterprise Server.
+func NewGitHub(repo, environment string) (*GitHub, error) {
+	if !githubRepoPattern.MatchString(repo) {
+		return nil, fmt.Errorf("invalid repository %q (want owner/name)", repo)
+	}
+	token := firstEnv("GITHUB_TOKEN", "GH_TOKEN")
+	if token == "" {
+		return nil, errors.New("GITHUB_TOKEN or GH_TOKEN must be set")
+	}
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return &GitHub{
+		Repo:        repo,
+		Environment: environment,
+		api:         newAPI("github", "GITHUB_API_URL", "https://api.github.com", header),
+	}, nil
+}
+
+// GitHubSecretName reports why name cannot be an Actions secret, or nil.
+func GitHubSecretName(name string) error {
+	switch {
+	case !githubSecretPattern.MatchString(name):
+		return errors.New("only letters, digits, and underscores allowed, not starting with a digit")
+	case strings.HasPrefix(strings.ToUpper(name), "GITHUB_"):
+		return errors.New("the GITHUB_ prefix is reserved")
+	}
+	return nil
+}
+
+// GitHubPublicKey is the key secrets must be sealed to before upload.
+type GitHubPublicKey struct {
+	ID  string `json:"key_id"`
+	Key string `json:"key"`
+}
+
+// SecretNames lists the existing secrets. GitHub never returns values, and
+// names are case-insensitive, so they come back upper-cased.
+func (g *GitHub) SecretNames(ctx context.Context) (map[string]bool, error) {
+	names := map[string]bool{}
+	for page := 1; ; page++ {
+		var resp struct {
+			TotalCount int `json:"total_count"`
+			Secrets    []struct {
+				Name string `json:"name"`
+			} `json:"secrets"`
+		}
+		path := fmt.Sprintf("%s?per_page=100&page=%d", g.secretsPath(), page)
+		if err := g.api.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, secret := range resp.Secrets {
+			names[strings.ToUpper(secret.Name)] = true
+		}
+		if len(resp.Secrets) < 100 || len(names) >= resp.TotalCount {
+			return names, nil
+		}
+	}
+}
+
+// PublicKey fetches the key secrets are sealed to.
+func (g *GitHub) PublicKey(ctx context.Context) (GitHubPublicKey, error) {
+	var key GitHubPublicKey
+	if err := g.api.do(ctx, http.MethodGet, g.secretsPath()+"/public-key", nil, &key); err != nil {
+		return key, err
+	}
+	if key.ID == "" || key.Key == "" {
+		return key, errors.New("github returned an empty public key")
+	}
+	return key, nil
+}
+
+// PutSecret creates or replaces one secret, sealing value to key.
+func (g *GitHub) PutSecret(ctx context.Context, key GitHubPublicKey, name, value string) error {
+	publicKey, err := base64.StdEncoding.DecodeString(key.Key)
+	if err != nil {
+		return fmt.Errorf("decode github public key: %w", err)
+	}
+	if len(publicKey) != 32 {
+		return fmt.Errorf("github public key is %d bytes, want 32", len(publicKey))
+	}
+	sealed, err := box.SealAnonymous(nil, []byte(value), (*[32]byte)(publicKey), rand.Reader)
+	if err != nil {
+		return err
+	}
+	body := map[string]string{
+		"encrypted_value": base64.StdEncoding.EncodeToString(sealed),
+		"key_id":          key.ID,
+	}
+	return g.api.do(ctx, http.MethodPut, g.secretsPath()+"/"+url.PathEscape(name), body, nil)
+}
+
+func (g *GitHub) secretsPath() string {
+	path := "/repos/" + g.Repo
+	if g.Environment != "" {
+		path += "/environments/" + url.PathEscape(g.Environment)
+	}
+	return path + "/actions/secrets"
+}
@@ -0,0 +1,240 @@
+// Package ratelimit keeps a per-user log of recent decryptions, shared by
+// every gitvault process, so a compromised local process that decrypts the
+// vault in bulk is slowed down and reported.
+package ratelimit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/userconfig"
+	"github.com/aatuh/sealr/domain"
+)
+
+// Window is the span decryptions are counted over.
+const Window = time.Minute
+
+const (
+	fileName    = "decrypts.log"
+	anomalyFile = "anomalies.log"
+	// pruneAfter is how many expired lines the log may hold before it is
+	// rewritten with only the current window.
+	pruneAfter = 1000
+	// alertTimeout bounds the alert command.
+	alertTimeout = 10 * time.Second
+)
+
+// ErrLimited is returned when a decryption would exceed the limit.
+var ErrLimited = errors.New("decryption rate limit reached")
+
+// Limiter admits decryptions against the shared log, kept next to the user
+// config. Only sops round trips count; a command rereading what it already
+// decrypted does not.
+type Limiter struct {
+	// PerMinute refuses decryptions past this many in the window; 0
+	// means no limit.
+	PerMinute int
+	// WarnDistinct reports an anomaly once this many different
+	// ciphertexts (envs and files) were decrypted in the window; 0 turns
+	// it off.
+	WarnDistinct int
+	// WarnEvery reports an anomaly once every env and file of the vault
+	// was decrypted in the window, for vaults with at least three.
+	WarnEvery bool
+	// Total is how many envs and files the open vault holds.
+	Total int
+	// Alert is a command run on an anomaly, with the warning in
+	// GITVAULT_ALERT.
+	Alert []string
+	// Warn receives the anomaly warning.
+	Warn io.Writer
+
+	mu     sync.Mutex
+	warned bool
+}
+
+// Active reports whether any limit or warning is configured; an inactive
+// Limiter keeps no log.
+func (l *Limiter) Active() bool {
+	return l != nil && (l.PerMinute > 0 || l.WarnDistinct > 0 || l.WarnEvery)
+}
+
+// Allow records a decryption of ciphertext, or refuses it with ErrLimited.
+// Failing to read or write the log never blocks a decryption.
+func (l *Limiter) Allow(ciphertext []byte) error {
+	if !l.Active() {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	path, err := l.path(fileName)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	recent, expired := readLog(path, now.Add(-Window))
+	if l.PerMinute > 0 && len(recent) >= l.PerMinute {
+		wait := recent[len(recent)-l.PerMinute].at.Add(Window).Sub(now).Round(time.Second)
+		return fmt.Errorf("%w: %d decryptions in the last minute (limits.decryptsPerMinute in the user config); try again in %s", ErrLimited, len(recent), max(wait, time.Second))
+	}
+	sum := sha256.Sum256(ciphertext)
+	current := event{at: now, id: hex.EncodeToString(sum[:8])}
+	recent = append(recent, current)
+	if expired > pruneAfter {
+		_ = writeLog(path, recent)
+	} else {
+		_ = appendLog(path, current)
+	}
+
+	distinct := map[string]bool{}
+	for _, e := range recent {
+		distinct[e.id] = true
+	}
+	switch {
+	case l.warned:
+	case l.WarnDistinct > 0 && len(distinct) >= l.WarnDistinct,
+		l.WarnEvery && l.Total >= 3 && len(distinct) >= l.Total:
+		l.warned = true
+		l.report(now, len(distinct))
+	}
+	return nil
+}
+
+// report warns about an anomaly, keeps it in anomalies.log, and runs the
+// alert command.
+func (l *Limiter) report(now time.Time, distinct int) {
+	message := fmt.Sprintf("%d different envs and files were decrypted within a minute; if that was not you, a local process may be copying the vault", distinct)
+	if l.Warn != nil {
+		fmt.Fprintln(l.Warn, "warning:", message)
+	}
+	if path, err := l.path(anomalyFile); err == nil {
+		if file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err == nil {
+			fmt.Fprintf(file, "%s pid=%d %s\n", now.UTC().Format(time.RFC3339), os.Getpid(), message)
+			_ = file.Close()
+		}
+	}
+	if len(l.Alert) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, l.Alert[0], l.Alert[1:]...)
+	cmd.Env = append(os.Environ(), "GITVAULT_ALERT="+message)
+	if err := cmd.Run(); err != nil && l.Warn != nil {
+		fmt.Fprintf(l.Warn, "warning: alert command: %v\n", err)
+	}
+}
+
+// Ciphertexts counts the envs with keys and the files in idx, the
+// ciphertexts WarnEvery compares against.
+func Ciphertexts(idx domain.Index) int {
+	total := 0
+	for _, project := range idx.Projects {
+		if project == nil {
+			continue
+		}
+		for _, env := range project.Envs {
+			if env == nil {
+				continue
+			}
+			if len(env.Keys) > 0 {
+				total++
+			}
+			total += len(env.Files)
+		}
+	}
+	return total
+}
+
+func (*Limiter) path(name string) (string, error) {
+	config, err := userconfig.Path()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(config)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// event is one line of the log: when, and a short hash of the ciphertext
+// so repeats of the same env can be told apart from new ones without
+// recording any names.
+type event struct {
+	at time.Time
+	id string
+}
+
+// readLog returns the events after cutoff, oldest first, and how many
+// lines were older.
+func readLog(path string, cutoff time.Time) ([]event, int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0
+	}
+	var events []event
+	expired := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		stamp, id, ok := strings.Cut(scanner.Text(), " ")
+		nanos, err := strconv.ParseInt(stamp, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		at := time.Unix(0, nanos)
+		if !at.After(cutoff) {
+			expired++
+			continue
+		}
+		events = append(events, event{at: at, id: id})
+	}
+	return events, expired
+}
+
+func appendLog(path string, e event) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	// One short write per event, so concurrent processes never interleave
+	// within a line.
+	if _, err := fmt.Fprintf(file, "%d %s\n", e.at.UnixNano(), e.id); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeLog(path string, events []event) error {
+	var b bytes.Buffer
+	for _, e := range events {
+		fmt.Fprintf(&b, "%d %s\n", e.at.UnixNano(), e.id)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), fileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
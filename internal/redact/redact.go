@@ -0,0 +1,122 @@
+// Package redact remembers the secret values gitvault has handled in this
+// process so messages can be scrubbed of them before they are printed.
+// ui masks everything written to stderr with it; code that builds messages
+// from decrypted data does not need to remember to.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aatuh/sealr/domain"
+)
+
+// Mask replaces a recorded value in messages.
+const Mask = "[redacted]"
+
+// minLen skips values too short to tell apart from ordinary words, such as
+// "true" or an env name.
+const minLen = 5
+
+// fingerprint is a truncated HMAC of a value under a per-process key. Only
+// fingerprints are kept, so the registry holds no plaintext for a memory
+// dump or core file to reveal.
+type fingerprint [16]byte
+
+var (
+	mu      sync.Mutex
+	mac     hash.Hash
+	values  = map[fingerprint]bool{}
+	lengths []int // distinct lengths of recorded values, longest first
+)
+
+// sum fingerprints value; the caller holds mu.
+func sum(value string) fingerprint {
+	if mac == nil {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic("redact: " + err.Error())
+		}
+		mac = hmac.New(sha256.New, key)
+	}
+	mac.Reset()
+	_, _ = mac.Write([]byte(value))
+	var fp fingerprint
+	var buf [sha256.Size]byte
+	copy(fp[:], mac.Sum(buf[:0]))
+	return fp
+}
+
+// Add records values that must not appear in messages.
+func Add(secrets ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range secrets {
+		value = strings.TrimSpace(value)
+		if len(value) < minLen {
+			continue
+		}
+		fp := sum(value)
+		if values[fp] {
+			continue
+		}
+		values[fp] = true
+		if i := sort.Search(len(lengths), func(i int) bool { return lengths[i] <= len(value) }); i == len(lengths) || lengths[i] != len(value) {
+			lengths = append(lengths, 0)
+			copy(lengths[i+1:], lengths[i:])
+			lengths[i] = len(value)
+		}
+	}
+}
+
+// Dotenv records every value in a dotenv payload, both as written and as
+// parsed, so quoted and escaped forms are masked alike.
+func Dotenv(payload []byte) {
+	parsed, _ := domain.ParseDotenv(payload)
+	for _, value := range parsed.Values {
+		Add(value)
+	}
+	for _, line := range strings.Split(string(payload), "\n") {
+		if _, raw, ok := strings.Cut(line, "="); ok {
+			Add(raw)
+		}
+	}
+}
+
+// String masks every recorded value in s. At each position the longest
+// match wins, so a value containing another is masked whole.
+func String(s string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	if len(values) == 0 || len(s) < lengths[len(lengths)-1] {
+		return s
+	}
+	var out strings.Builder
+	masked := false
+	for i := 0; i < len(s); {
+		matched := 0
+		for _, n := range lengths {
+			if i+n <= len(s) && values[sum(s[i:i+n])] {
+				matched = n
+				break
+			}
+		}
+		if matched == 0 {
+			out.WriteByte(s[i])
+			i++
+			continue
+		}
+		out.WriteString(Mask)
+		masked = true
+		i += matched
+	}
+	if !masked {
+		return s
+	}
+	return out.String()
+}
@@ -0,0 +1,214 @@
+// Package scaffold reads project templates from .gitvault/templates. A
+// template lists the keys every env of a new project starts with, each with a
+// placeholder value or a generated random one.
+package scaffold
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aatuh/sealr/domain"
+)
+
+const (
+	dirName       = "templates"
+	fileSuffix    = ".json"
+	defaultLength = 32
+	alnum         = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Generators lists the supported values of Key.Generate.
+var Generators = []string{"alnum", "base64", "hex"}
+
+type Template struct {
+	Description string `json:"description,omitempty"`
+	// Envs are created when `project new` is not given --envs.
+	Envs []string `json:"envs,omitempty"`
+	Keys []Key    `json:"keys"`
+}
+
+// Key is one required key. Value may use {project} and {env}; Generate
+// instead produces a fresh random value of Length characters per env.
+type Key struct {
+	Name     string `json:"name"`
+	Value    string `json:"value,omitempty"`
+	Generate string `json:"generate,omitempty"`
+	Length   int    `json:"length,omitempty"`
+}
+
+func Dir(root string) string {
+	return filepath.Join(root, ".gitvault", dirName)
+}
+
+func Path(root, name string) string {
+	return filepath.Join(Dir(root), name+fileSuffix)
+}
+
+// List returns the names of the vault's templates.
+func List(root string) ([]string, error) {
+	entries, err := os.ReadDir(Dir(root))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), fileSuffix) {
+			names = append(names, strings.TrimSuffix(entry.Name(), fileSuffix))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func Load(root, name string) (Template, error) {
+	if err := domain.ValidateIdentifier(name, "template"); err != nil {
+		return Template{}, err
+	}
+	data, err := os.ReadFile(Path(root, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			available, _ := List(root)
+			if len(available) == 0 {
+				return Template{}, fmt.Errorf("template %s not found; add it as %s", name, filepath.Join(".gitvault", dirName, name+fileSuffix))
+			}
+			return Template{}, fmt.Errorf("template %s not found (available: %s)", name, strings.Join(available, ", "))
+		}
+		return Template{}, err
+	}
+	var t Template
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Template{}, fmt.Errorf("parse template %s: %w", name, err)
+	}
+	if err := t.Validate(); err != nil {
+		return Template{}, fmt.Errorf("template %s: %w", name, err)
+	}
+	return t, nil
+}
+
+func (t Template) Validate() error {
+	if len(t.Keys) == 0 {
+		return errors.New("no keys defined")
+	}
+	seen := map[string]bool{}
+	for _, key := range t.Keys {
+		if err := validateKeyName(key.Name); err != nil {
+			return err
+		}
+		if seen[key.Name] {
+			return fmt.Errorf("key %s is defined twice", key.Name)
+		}
+		seen[key.Name] = true
+		if key.Generate == "" {
+			continue
+		}
+		if key.Value != "" {
+			return fmt.Errorf("key %s sets both value and generate", key.Name)
+		}
+		if !knownGenerator(key.Generate) {
+			return fmt.Errorf("key %s: unknown generator %q (use %s)", key.Name, key.Generate, strings.Join(Generators, ", "))
+		}
+		if key.Length < 0 {
+			return fmt.Errorf("key %s: length must be positive", key.Name)
+		}
+	}
+	for _, env := range t.Envs {
+		if err := domain.ValidateIdentifier(env, "env"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Values returns the keys for one env, in template order, with placeholders
+// expanded and generated values filled in.
+func (t Template) Values(project, env string) (map[string]string, []string, error) {
+	replacer := strings.NewReplacer("{project}", project, "{env}", env)
+	values := make(map[string]string, len(t.Keys))
+	order := make([]string, 0, len(t.Keys))
+	for _, key := range t.Keys {
+		value := replacer.Replace(key.Value)
+		if key.Generate != "" {
+			generated, err := generate(key.Generate, key.Length)
+			if err != nil {
+				return nil, nil, fmt.Errorf("generate %s: %w", key.Name, err)
+			}
+			value = generated
+		}
+		values[key.Name] = value
+		order = append(order, key.Name)
+	}
+	return values, order, nil
+}
+
+// Generated reports whether the key's value is random.
+func (k Key) Generated() bool {
+	return k.Generate != ""
+}
+
+func generate(kind string, length int) (string, error) {
+	if length == 0 {
+		length = defaultLength
+	}
+	switch kind {
+	case "hex":
+		buf := make([]byte, (length+1)/2)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(buf)[:length], nil
+	case "base64":
+		buf := make([]byte, length)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(buf)[:length], nil
+	case "alnum":
+		out := make([]byte, length)
+		limit := big.NewInt(int64(len(alnum)))
+		for i := range out {
+			n, err := rand.Int(rand.Reader, limit)
+			if err != nil {
+				return "", err
+			}
+			out[i] = alnum[n.Int64()]
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("unknown generator %q", kind)
+}
+
+func knownGenerator(kind string) bool {
+	for _, known := range Generators {
+		if kind == known {
+			return true
+		}
+	}
+	return false
+}
+
+func validateKeyName(name string) error {
+	if name == "" {
+		return errors.New("key name cannot be empty")
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf("key %q is not a valid env var name", name)
+		}
+	}
+	return nil
+}
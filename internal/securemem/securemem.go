@@ -0,0 +1,21 @@
+// Package securemem keeps decrypted data out of swap where the platform
+// allows it and clears it once gitvault is done with it. Both are best
+// effort: locking fails quietly past RLIMIT_MEMLOCK, and copies made by the
+// Go runtime or by string conversions are out of reach.
+package securemem
+
+// Lock asks the OS to keep b in RAM.
+func Lock(b []byte) {
+	if len(b) > 0 {
+		_ = lock(b)
+	}
+}
+
+// Wipe zeroes b and releases a Lock on it.
+func Wipe(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	clear(b)
+	_ = unlock(b)
+}
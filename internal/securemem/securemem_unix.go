@@ -0,0 +1,13 @@
+//go:build !windows
+
+package securemem
+
+import "syscall"
+
+func lock(b []byte) error {
+	return syscall.Mlock(b)
+}
+
+func unlock(b []byte) error {
+	return syscall.Munlock(b)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package securemem
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func lock(b []byte) error {
+	return syscall.VirtualLock(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+}
+
+func unlock(b []byte) error {
+	return syscall.VirtualUnlock(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+}
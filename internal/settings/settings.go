@@ -0,0 +1,124 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/aatuh/gitvault/internal/opaque"
+	"github.com/aatuh/sealr/ports"
+)
+
+const fileName = "settings.json"
+
+// Settings holds gitvault-specific vault options. They live next to the sealr
+// config so that config rewrites never drop them.
+type Settings struct {
+	ObfuscateNames bool       `json:"obfuscateNames,omitempty"`
+	KeyGroups      *KeyGroups `json:"keyGroups,omitempty"`
+	Sync           *Sync      `json:"sync,omitempty"`
+	Hooks          []Hook     `json:"hooks,omitempty"`
+	Commit         *Commit    `json:"commit,omitempty"`
+	// AutoHeal re-encrypts a secret read with a recipient list that differs
+	// from the configured one, so the vault converges without keys rotate.
+	AutoHeal bool `json:"autoHeal,omitempty"`
+	// Rotation says how often secrets must be changed, for `gitvault
+	// reminders` and doctor.
+	Rotation []RotationRule `json:"rotation,omitempty"`
+	// ExportPolicies limit which envs may be written out in plaintext.
+	ExportPolicies []ExportPolicy `json:"exportPolicies,omitempty"`
+}
+
+// RotationRule applies RotateEvery (e.g. 90d) to the keys it matches. An
+// empty Project, Env, or Key matches any; for each key the most specific
+// rule wins, a key match before an env match before a project match.
+type RotationRule struct {
+	Project     string `json:"project,omitempty"`
+	Env         string `json:"env,omitempty"`
+	Key         string `json:"key,omitempty"`
+	RotateEvery string `json:"rotateEvery"`
+}
+
+// ExportPolicy says how the envs it matches may be consumed: "run" keeps
+// their values inside processes started by `secret run` (or
+// docker-entrypoint), so commands that write them to a file or stdout refuse
+// without --allow-export-override; "any" lifts a broader policy. An empty
+// Project or Env matches any; the most specific policy wins.
+type ExportPolicy struct {
+	Project string `json:"project,omitempty"`
+	Env     string `json:"env,omitempty"`
+	Export  string `json:"export"`
+}
+
+// KeyGroups splits the recipients into groups of which Threshold must
+// cooperate to decrypt (SOPS Shamir secret sharing).
+type KeyGroups struct {
+	Groups    [][]string `json:"groups"`
+	Threshold int        `json:"threshold"`
+}
+
+// Sync holds the defaults for `gitvault sync`. Mirrors are remotes (names
+// or URLs) every push is repeated to as a backup.
+type Sync struct {
+	Remote  string   `json:"remote,omitempty"`
+	Branch  string   `json:"branch,omitempty"`
+	Mirrors []string `json:"mirrors,omitempty"`
+}
+
+// Hook runs a shell command in the vault root before or after a gitvault
+// command, e.g. to notify a channel after `secret set` in prod. Command is a
+// command ("secret") or subcommand ("secret set"); Project and Env narrow
+// post hooks to commands on that project or env.
+type Hook struct {
+	When    string `json:"when"`
+	Command string `json:"command"`
+	Project string `json:"project,omitempty"`
+	Env     string `json:"env,omitempty"`
+	Run     string `json:"run"`
+}
+
+// Commit shapes the messages of commits gitvault makes, so vault history
+// can follow a team's conventions, e.g. "chore(vault): {summary}". Template
+// may use {action}, {summary}, {refs}, and {author}.
+type Commit struct {
+	Template string `json:"template,omitempty"`
+}
+
+func Path(root string) string {
+	return filepath.Join(root, ".gitvault", fileName)
+}
+
+// Load reads the settings through fsys, the vault's layout, which unseals
+// them in obfuscated vaults. Read before that layout is on, sealed settings
+// say only that the vault is obfuscated.
+func Load(fsys ports.FileSystem, root string) (Settings, error) {
+	data, err := fsys.ReadFile(Path(root))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Settings{}, nil
+		}
+		return Settings{}, err
+	}
+	if opaque.Sealed(data) {
+		return Settings{ObfuscateNames: true}, nil
+	}
+	var s Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// Save writes the settings through fsys, sealing them in obfuscated vaults.
+func Save(fsys ports.FileSystem, root string, s Settings) error {
+	path := Path(root)
+	if err := fsys.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsys.WriteFile(path, append(data, '\n'), 0600)
+}
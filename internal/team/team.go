@@ -0,0 +1,95 @@
+package team
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const fileName = "team.json"
+
+// Roster names the people behind the vault's recipients. When it exists it
+// is the source the recipient list is derived from, so key changes show up
+// in review with a name attached.
+type Roster struct {
+	Members []Member `json:"members"`
+}
+
+type Member struct {
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"`
+}
+
+func Path(root string) string {
+	return filepath.Join(root, ".gitvault", fileName)
+}
+
+// Load reads the roster. ok is false when the vault has none.
+func Load(root string) (roster Roster, ok bool, err error) {
+	data, err := os.ReadFile(Path(root))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Roster{}, false, nil
+		}
+		return Roster{}, false, err
+	}
+	if err := json.Unmarshal(data, &roster); err != nil {
+		return Roster{}, false, err
+	}
+	return roster, true, nil
+}
+
+func Save(root string, r Roster) error {
+	path := Path(root)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if r.Members == nil {
+		r.Members = []Member{}
+	}
+	sort.Slice(r.Members, func(i, j int) bool { return r.Members[i].Name < r.Members[j].Name })
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Find returns the index of the member called name, or -1.
+func (r Roster) Find(name string) int {
+	for i, member := range r.Members {
+		if member.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Owner returns the name of the member a recipient belongs to.
+func (r Roster) Owner(recipient string) (string, bool) {
+	for _, member := range r.Members {
+		for _, candidate := range member.Recipients {
+			if candidate == recipient {
+				return member.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Recipients lists every member's recipients, without duplicates.
+func (r Roster) Recipients() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, member := range r.Members {
+		for _, recipient := range member.Recipients {
+			if !seen[recipient] {
+				seen[recipient] = true
+				out = append(out, recipient)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,363 @@
+// Package telemetry exports what gitvault did, never what it handled:
+// command and sops/git call durations, outcomes, and failure types, as
+// OpenTelemetry traces and metrics over OTLP/HTTP with JSON encoding. It
+// is only used when the user opts in.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aatuh/gitvault/internal/timing"
+)
+
+// DefaultEndpoint is the OTLP/HTTP collector address from the OpenTelemetry
+// spec, used when neither the config nor OTEL_EXPORTER_OTLP_ENDPOINT names one.
+const DefaultEndpoint = "http://localhost:4318"
+
+// bounds are the histogram buckets, in seconds, for command and call
+// durations.
+var bounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Recorder buffers spans and durations until Flush sends them. A nil
+// Recorder records nothing, so callers need no checks.
+type Recorder struct {
+	// IncludeNames attaches project and env names to command spans. Key
+	// names and values are never attached.
+	IncludeNames bool
+
+	tracesURL  string
+	metricsURL string
+	headers    map[string]string
+	resource   []attribute
+	client     *http.Client
+
+	mu       sync.Mutex
+	spans    []span
+	points   []point
+	consumed int
+	since    time.Time
+}
+
+// New returns a Recorder for the OTLP/HTTP collector at endpoint (a base
+// URL such as http://collector:4318). An empty endpoint falls back to the
+// standard OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// and OTEL_EXPORTER_OTLP_METRICS_ENDPOINT variables. headers are sent
+// after those in OTEL_EXPORTER_OTLP_HEADERS.
+func New(endpoint string, headers map[string]string) (*Recorder, error) {
+	r := &Recorder{
+		headers: parsePairs(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		client:  &http.Client{Timeout: 3 * time.Second},
+		since:   time.Now(),
+	}
+	maps.Copy(r.headers, headers)
+	base := strings.TrimSpace(endpoint)
+	if base == "" {
+		base = strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+		r.tracesURL = strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"))
+		r.metricsURL = strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"))
+	}
+	if base == "" {
+		base = DefaultEndpoint
+	}
+	base = strings.TrimSuffix(base, "/")
+	if r.tracesURL == "" {
+		r.tracesURL = base + "/v1/traces"
+	}
+	if r.metricsURL == "" {
+		r.metricsURL = base + "/v1/metrics"
+	}
+	for _, target := range []string{r.tracesURL, r.metricsURL} {
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("telemetry endpoint %q: want an http:// or https:// URL", target)
+		}
+	}
+
+	resource := parsePairs(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	resource["service.name"] = "gitvault"
+	if name := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME")); name != "" {
+		resource["service.name"] = name
+	}
+	for _, name := range slices.Sorted(maps.Keys(resource)) {
+		r.resource = append(r.resource, stringAttr(name, resource[name]))
+	}
+	return r, nil
+}
+
+// Command records one command run: a span covering start until now, with
+// a child span for each sops and git call in log since the last Command.
+// code is the exit code; attrs are extra span attributes.
+func (r *Recorder) Command(name string, start time.Time, code int, attrs map[string]string, log *timing.Log) {
+	if r == nil {
+		return
+	}
+	end := time.Now()
+	var calls []timing.Call
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if log != nil {
+		all := log.Calls()
+		calls = all[min(r.consumed, len(all)):]
+		r.consumed = len(all)
+	}
+
+	traceID, parentID := newID(16), newID(8)
+	errorType := commandError(code, calls)
+	spanAttrs := []attribute{stringAttr("gitvault.command", name), intAttr("process.exit.code", code)}
+	for _, key := range slices.Sorted(maps.Keys(attrs)) {
+		spanAttrs = append(spanAttrs, stringAttr(key, attrs[key]))
+	}
+	metricAttrs := []attribute{stringAttr("gitvault.command", name)}
+	if errorType != "" {
+		spanAttrs = append(spanAttrs, stringAttr("error.type", errorType))
+		metricAttrs = append(metricAttrs, stringAttr("error.type", errorType))
+	}
+	r.spans = append(r.spans, span{
+		TraceID: traceID, SpanID: parentID, Name: "gitvault " + name, Kind: spanKindInternal,
+		Start: nanos(start), End: nanos(end), Attributes: spanAttrs, Status: spanStatus(errorType),
+	})
+	r.points = append(r.points, point{metric: "gitvault.command.duration", attrs: metricAttrs, seconds: end.Sub(start).Seconds()})
+
+	for _, call := range calls {
+		callAttrs := []attribute{stringAttr("gitvault.tool", call.Tool), stringAttr("gitvault.op", call.Op)}
+		if call.Failed {
+			callAttrs = append(callAttrs, stringAttr("error.type", call.Failure))
+		}
+		callStart := call.Start
+		if callStart.IsZero() {
+			callStart = start
+		}
+		r.spans = append(r.spans, span{
+			TraceID: traceID, SpanID: newID(8), ParentSpanID: parentID, Name: call.String(), Kind: spanKindClient,
+			Start: nanos(callStart), End: nanos(callStart.Add(call.Duration)), Attributes: callAttrs, Status: spanStatus(call.Failure),
+		})
+		r.points = append(r.points, point{metric: "gitvault.call.duration", attrs: callAttrs, seconds: call.Duration.Seconds()})
+	}
+}
+
+// commandError classifies a failed command: usage for exit code 2, the
+// tool and failure of its last failed call (e.g. sops.timeout), or error.
+func commandError(code int, calls []timing.Call) string {
+	switch code {
+	case 0:
+		return ""
+	case 2:
+		return "usage"
+	}
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].Failed {
+			return calls[i].Tool + "." + calls[i].Failure
+		}
+	}
+	return "error"
+}
+
+// Flush sends everything recorded since the last Flush. What was recorded
+// is dropped even when sending fails, so a dead collector never makes
+// gitvault hold on to more than one command's worth.
+func (r *Recorder) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	spans, points, since := r.spans, r.points, r.since
+	r.spans, r.points, r.since = nil, nil, time.Now()
+	r.mu.Unlock()
+	if len(spans) == 0 && len(points) == 0 {
+		return nil
+	}
+	scope := map[string]any{"name": "github.com/aatuh/gitvault"}
+	resource := map[string]any{"attributes": r.resource}
+	traces := map[string]any{"resourceSpans": []any{map[string]any{
+		"resource":   resource,
+		"scopeSpans": []any{map[string]any{"scope": scope, "spans": spans}},
+	}}}
+	if err := r.post(ctx, r.tracesURL, traces); err != nil {
+		return err
+	}
+	metrics := map[string]any{"resourceMetrics": []any{map[string]any{
+		"resource":     resource,
+		"scopeMetrics": []any{map[string]any{"scope": scope, "metrics": histograms(points, since, time.Now())}},
+	}}}
+	return r.post(ctx, r.metricsURL, metrics)
+}
+
+func (r *Recorder) post(ctx context.Context, target string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range r.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export to %s: %s", target, resp.Status)
+	}
+	return nil
+}
+
+// point is one duration observation of a histogram metric.
+type point struct {
+	metric  string
+	attrs   []attribute
+	seconds float64
+}
+
+// histograms aggregates points into delta histograms over [since, now],
+// one data point per distinct attribute set.
+func histograms(points []point, since, now time.Time) []any {
+	type series struct {
+		attrs   []attribute
+		count   uint64
+		sum     float64
+		buckets []uint64
+	}
+	byMetric := map[string]map[string]*series{}
+	for _, p := range points {
+		key, _ := json.Marshal(p.attrs)
+		if byMetric[p.metric] == nil {
+			byMetric[p.metric] = map[string]*series{}
+		}
+		s := byMetric[p.metric][string(key)]
+		if s == nil {
+			s = &series{attrs: p.attrs, buckets: make([]uint64, len(bounds)+1)}
+			byMetric[p.metric][string(key)] = s
+		}
+		s.count++
+		s.sum += p.seconds
+		i, _ := slices.BinarySearch(bounds, p.seconds)
+		s.buckets[i]++
+	}
+	var metrics []any
+	for _, name := range slices.Sorted(maps.Keys(byMetric)) {
+		var dataPoints []any
+		for _, key := range slices.Sorted(maps.Keys(byMetric[name])) {
+			s := byMetric[name][key]
+			counts := make([]string, len(s.buckets))
+			for i, n := range s.buckets {
+				counts[i] = strconv.FormatUint(n, 10)
+			}
+			dataPoints = append(dataPoints, map[string]any{
+				"attributes":        s.attrs,
+				"startTimeUnixNano": nanos(since),
+				"timeUnixNano":      nanos(now),
+				"count":             strconv.FormatUint(s.count, 10),
+				"sum":               s.sum,
+				"bucketCounts":      counts,
+				"explicitBounds":    bounds,
+			})
+		}
+		metrics = append(metrics, map[string]any{
+			"name": name,
+			"unit": "s",
+			"histogram": map[string]any{
+				"dataPoints":             dataPoints,
+				"aggregationTemporality": aggregationDelta,
+			},
+		})
+	}
+	return metrics
+}
+
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	statusError      = 2
+	aggregationDelta = 1
+)
+
+type span struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        string      `json:"startTimeUnixNano"`
+	End          string      `json:"endTimeUnixNano"`
+	Attributes   []attribute `json:"attributes"`
+	Status       *status     `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func spanStatus(errorType string) *status {
+	if errorType == "" {
+		return nil
+	}
+	return &status{Code: statusError, Message: errorType}
+}
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+type attributeValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+}
+
+func stringAttr(key, value string) attribute {
+	return attribute{Key: key, Value: attributeValue{String: &value}}
+}
+
+func intAttr(key string, value int) attribute {
+	text := strconv.Itoa(value)
+	return attribute{Key: key, Value: attributeValue{Int: &text}}
+}
+
+// nanos formats t the way OTLP/JSON encodes 64-bit integers: as a string.
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func newID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// parsePairs reads the key1=value1,key2=value2 lists of the OTEL_*
+// variables; values are URL-decoded.
+func parsePairs(list string) map[string]string {
+	pairs := map[string]string{}
+	for _, item := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		pairs[key] = strings.TrimSpace(value)
+	}
+	return pairs
+}
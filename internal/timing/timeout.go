@@ -0,0 +1,117 @@
+package timing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	executil "github.com/aatuh/sealr/infra/exec"
+)
+
+// killGrace is how long Limited waits for a killed command to return. git
+// can leave ssh holding its output open, which would block Run forever.
+const killGrace = 2 * time.Second
+
+// Timeouts bounds each kind of external command; zero means no limit. sops
+// calls other than encrypt (e.g. --version) use Decrypt.
+type Timeouts struct {
+	Encrypt    time.Duration
+	Decrypt    time.Duration
+	Git        time.Duration
+	GitNetwork time.Duration
+}
+
+// DefaultTimeouts are generous enough for remote KMS keys and slow remotes
+// while still ending a hung sops or git.
+var DefaultTimeouts = Timeouts{
+	Encrypt:    2 * time.Minute,
+	Decrypt:    2 * time.Minute,
+	Git:        time.Minute,
+	GitNetwork: 5 * time.Minute,
+}
+
+// limit returns the timeout for a call and the user config setting that
+// controls it.
+func (t Timeouts) limit(tool, op string) (time.Duration, string) {
+	switch {
+	case tool == "sops" && op == "encrypt":
+		return t.Encrypt, "encrypt"
+	case tool == "sops":
+		return t.Decrypt, "decrypt"
+	case tool == "git" && networkOps[op]:
+		return t.GitNetwork, "gitNetwork"
+	case tool == "git":
+		return t.Git, "git"
+	}
+	return 0, ""
+}
+
+// Limited stops commands run through Base once their timeout passes or ctx
+// is canceled, and reports which one it was.
+type Limited struct {
+	Base     executil.Runner
+	Timeouts Timeouts
+}
+
+type runResult struct {
+	stdout, stderr []byte
+	err            error
+}
+
+func (r Limited) Run(ctx context.Context, name string, args []string, input []byte, env []string, dir string) ([]byte, []byte, error) {
+	tool, op := toolName(name), operation(args)
+	limit, setting := r.Timeouts.limit(tool, op)
+	runCtx := ctx
+	if limit > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+	}
+
+	done := make(chan runResult, 1)
+	go func() {
+		stdout, stderr, err := r.Base.Run(runCtx, name, args, input, env, dir)
+		done <- runResult{stdout, stderr, err}
+	}()
+	var res runResult
+	select {
+	case res = <-done:
+	case <-runCtx.Done():
+		select {
+		case res = <-done:
+		case <-time.After(killGrace):
+			res.err = runCtx.Err()
+		}
+	}
+	if res.err == nil || runCtx.Err() == nil {
+		return res.stdout, res.stderr, res.err
+	}
+	if err := ctx.Err(); err != nil {
+		return res.stdout, res.stderr, fmt.Errorf("%s %s canceled: %w", tool, op, err)
+	}
+	return res.stdout, res.stderr, fmt.Errorf("%s %s timed out after %s (timeouts.%s in the user config): %w", tool, op, limit, setting, context.DeadlineExceeded)
+}
+
+// ParseTimeouts applies settings (e.g. "decrypt": "5m") from the user
+// config on top of DefaultTimeouts.
+func ParseTimeouts(settings map[string]string) (Timeouts, error) {
+	t := DefaultTimeouts
+	fields := map[string]*time.Duration{
+		"encrypt":    &t.Encrypt,
+		"decrypt":    &t.Decrypt,
+		"git":        &t.Git,
+		"gitNetwork": &t.GitNetwork,
+	}
+	for name, value := range settings {
+		field, ok := fields[name]
+		if !ok {
+			return Timeouts{}, fmt.Errorf("unknown timeout %q (want encrypt, decrypt, git, or gitNetwork)", name)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return Timeouts{}, fmt.Errorf("timeout %s: invalid duration %q", name, value)
+		}
+		*field = d
+	}
+	return t, nil
+}
@@ -0,0 +1,114 @@
+// Package timing records how long external commands (sops, git) take, so
+// doctor and --verbose can point at slow setups such as remote KMS keys or
+// antivirus scanning sops's temp files.
+package timing
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	executil "github.com/aatuh/sealr/infra/exec"
+)
+
+// Slow is how long a local call to each tool may take before it is flagged.
+// Network operations (fetch, pull, push, ls-remote) are never flagged.
+var Slow = map[string]time.Duration{
+	"sops": 2 * time.Second,
+	"git":  2 * time.Second,
+}
+
+var networkOps = map[string]bool{"fetch": true, "pull": true, "push": true, "ls-remote": true, "clone": true}
+
+// Call is one finished command.
+type Call struct {
+	Tool     string        `json:"tool"`
+	Op       string        `json:"op"`
+	Start    time.Time     `json:"-"`
+	Duration time.Duration `json:"duration"`
+	Failed   bool          `json:"failed,omitempty"`
+	// Failure says how a failed call failed: timeout, canceled, exit_status
+	// (the tool ran and exited non-zero), or start (it could not be run).
+	Failure string `json:"failure,omitempty"`
+}
+
+// IsSlow reports whether c took longer than its tool's Slow threshold.
+func (c Call) IsSlow() bool {
+	limit, ok := Slow[c.Tool]
+	return ok && !networkOps[c.Op] && c.Duration > limit
+}
+
+func (c Call) String() string {
+	return c.Tool + " " + c.Op
+}
+
+// Log collects calls; it is safe for concurrent use.
+type Log struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Calls returns the calls recorded so far, in the order they finished.
+func (l *Log) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Call(nil), l.calls...)
+}
+
+func (l *Log) add(call Call) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+// Runner times every command run through Base into Log.
+type Runner struct {
+	Base executil.Runner
+	Log  *Log
+}
+
+func (r Runner) Run(ctx context.Context, name string, args []string, input []byte, env []string, dir string) ([]byte, []byte, error) {
+	start := time.Now()
+	stdout, stderr, err := r.Base.Run(ctx, name, args, input, env, dir)
+	r.Log.add(Call{Tool: toolName(name), Op: operation(args), Start: start, Duration: time.Since(start), Failed: err != nil, Failure: failure(err)})
+	return stdout, stderr, err
+}
+
+func failure(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &exitErr):
+		return "exit_status"
+	}
+	return "start"
+}
+
+func toolName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".exe")
+}
+
+// operation names a call by its subcommand, skipping git's -C/-c options;
+// sops's older flag form ("--decrypt") is reported like its subcommand.
+func operation(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-C" || arg == "-c":
+			i++
+		case strings.HasPrefix(arg, "--"):
+			return strings.TrimPrefix(arg, "--")
+		case !strings.HasPrefix(arg, "-"):
+			return arg
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"io"
+	"os"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// statusColors colors the cells of "status" and "action" table columns.
+var statusColors = map[string]string{
+	"ok":      ansiGreen,
+	"added":   ansiGreen,
+	"warn":    ansiYellow,
+	"changed": ansiYellow,
+	"updated": ansiYellow,
+	"fail":    ansiRed,
+	"failed":  ansiRed,
+	"missing": ansiRed,
+	"removed": ansiRed,
+}
+
+// IsTerminal reports whether w is a character device such as a TTY.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// ColorEnabled decides whether output to w gets ANSI colors. --no-color and
+// NO_COLOR (https://no-color.org) always win; CLICOLOR_FORCE forces colors
+// into pipes; CLICOLOR=0 and TERM=dumb turn them off; otherwise colors
+// follow whether w is a terminal.
+func ColorEnabled(w io.Writer, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	if os.Getenv("CLICOLOR") == "0" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return IsTerminal(w)
+}
+
+// Paint wraps s in the color when o.Color is set.
+func (o Output) Paint(color, s string) string {
+	if !o.Color || color == "" || s == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// Red, Green, and Yellow color s for o.
+func (o Output) Red(s string) string    { return o.Paint(ansiRed, s) }
+func (o Output) Green(s string) string  { return o.Paint(ansiGreen, s) }
+func (o Output) Yellow(s string) string { return o.Paint(ansiYellow, s) }
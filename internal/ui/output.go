@@ -6,12 +6,21 @@ import (
 	"io"
 	"sort"
 	"strings"
+
+	"github.com/aatuh/gitvault/internal/redact"
 )
 
 type Output struct {
 	JSON bool
-	Out  io.Writer
-	Err  io.Writer
+	// Quiet limits text output to results: payloads and table rows on
+	// stdout, errors and warnings on stderr.
+	Quiet bool
+	// Color enables ANSI colors. Decorate enables purely visual extras, such
+	// as the rule under table headers; both are off when output is piped.
+	Color    bool
+	Decorate bool
+	Out      io.Writer
+	Err      io.Writer
 }
 
 type Response struct {
@@ -25,20 +34,34 @@ func (o Output) Success(message string, data interface{}) {
 		_ = json.NewEncoder(o.Out).Encode(Response{OK: true, Message: message, Data: data})
 		return
 	}
+	if o.Quiet {
+		return
+	}
 	if message != "" {
 		fmt.Fprintln(o.Out, message)
 	}
 	if data != nil {
-		printData(o.Out, data)
+		o.printData(data)
 	}
 }
 
+// Info prints a line meant for people, such as an empty-result notice.
+func (o Output) Info(line string) {
+	if o.JSON || o.Quiet {
+		return
+	}
+	fmt.Fprintln(o.Out, line)
+}
+
+// Error prints err with any recorded secret values masked; JSON escaping
+// would otherwise hide them from the stderr writer.
 func (o Output) Error(err error) {
+	message := redact.String(err.Error())
 	if o.JSON {
-		_ = json.NewEncoder(o.Err).Encode(Response{OK: false, Message: err.Error()})
+		_ = json.NewEncoder(o.Err).Encode(Response{OK: false, Message: message})
 		return
 	}
-	fmt.Fprintln(o.Err, "error:", err.Error())
+	fmt.Fprintln(o.Err, "error:", message)
 }
 
 func (o Output) Table(headers []string, rows [][]string) {
@@ -57,47 +80,71 @@ func (o Output) Table(headers []string, rows [][]string) {
 			}
 		}
 	}
-	if len(headers) > 0 {
-		fmt.Fprintln(o.Out, formatRow(headers, widths))
-		separator := make([]string, len(headers))
-		for i := range headers {
-			separator[i] = strings.Repeat("-", widths[i])
-		}
-		fmt.Fprintln(o.Out, formatRow(separator, widths))
+	colored := map[int]bool{}
+	for i, h := range headers {
+		colored[i] = h == "status" || h == "action"
+	}
+	if len(headers) > 0 && !o.Quiet {
+		o.printHeader(headers, widths)
 	}
 	for _, row := range rows {
-		fmt.Fprintln(o.Out, formatRow(row, widths))
+		fmt.Fprintln(o.Out, formatRow(row, widths, func(i int, cell string) string {
+			if !colored[i] {
+				return cell
+			}
+			return o.Paint(statusColors[row[i]], cell)
+		}))
+	}
+}
+
+func (o Output) printHeader(headers []string, widths []int) {
+	fmt.Fprintln(o.Out, formatRow(headers, widths, func(_ int, cell string) string {
+		return o.Paint(ansiBold, cell)
+	}))
+	if !o.Decorate {
+		return
 	}
+	separator := make([]string, len(headers))
+	for i := range headers {
+		separator[i] = strings.Repeat("-", widths[i])
+	}
+	fmt.Fprintln(o.Out, formatRow(separator, widths, nil))
 }
 
-func formatRow(cols []string, widths []int) string {
+// formatRow pads each column to its width. paint, if set, styles a cell
+// after padding so escape codes do not throw off the alignment.
+func formatRow(cols []string, widths []int, paint func(i int, cell string) string) string {
 	parts := make([]string, len(cols))
 	for i, col := range cols {
 		pad := widths[i] - len(col)
 		if pad < 0 {
 			pad = 0
 		}
-		parts[i] = col + strings.Repeat(" ", pad)
+		parts[i] = col
+		if paint != nil {
+			parts[i] = paint(i, col)
+		}
+		parts[i] += strings.Repeat(" ", pad)
 	}
 	return strings.Join(parts, "  ")
 }
 
-func printData(w io.Writer, data interface{}) {
+func (o Output) printData(data interface{}) {
 	switch value := data.(type) {
 	case map[string]string:
-		printStringMap(w, value)
+		o.printStringMap(value)
 	case map[string]interface{}:
-		printInterfaceMap(w, value)
+		o.printInterfaceMap(value)
 	case []string:
 		for _, item := range value {
-			fmt.Fprintln(w, item)
+			fmt.Fprintln(o.Out, item)
 		}
 	default:
-		fmt.Fprintln(w, data)
+		fmt.Fprintln(o.Out, data)
 	}
 }
 
-func printStringMap(w io.Writer, data map[string]string) {
+func (o Output) printStringMap(data map[string]string) {
 	keys := make([]string, 0, len(data))
 	for key := range data {
 		keys = append(keys, key)
@@ -113,14 +160,13 @@ func printStringMap(w io.Writer, data map[string]string) {
 			widths[1] = len(data[key])
 		}
 	}
-	fmt.Fprintln(w, formatRow(headers, widths))
-	fmt.Fprintln(w, formatRow([]string{strings.Repeat("-", widths[0]), strings.Repeat("-", widths[1])}, widths))
+	o.printHeader(headers, widths)
 	for _, key := range keys {
-		fmt.Fprintln(w, formatRow([]string{key, data[key]}, widths))
+		fmt.Fprintln(o.Out, formatRow([]string{key, data[key]}, widths, nil))
 	}
 }
 
-func printInterfaceMap(w io.Writer, data map[string]interface{}) {
+func (o Output) printInterfaceMap(data map[string]interface{}) {
 	keys := make([]string, 0, len(data))
 	for key := range data {
 		keys = append(keys, key)
@@ -139,10 +185,9 @@ func printInterfaceMap(w io.Writer, data map[string]interface{}) {
 			widths[1] = len(value)
 		}
 	}
-	fmt.Fprintln(w, formatRow(headers, widths))
-	fmt.Fprintln(w, formatRow([]string{strings.Repeat("-", widths[0]), strings.Repeat("-", widths[1])}, widths))
+	o.printHeader(headers, widths)
 	for i, key := range keys {
-		fmt.Fprintln(w, formatRow([]string{key, formatted[i]}, widths))
+		fmt.Fprintln(o.Out, formatRow([]string{key, formatted[i]}, widths, nil))
 	}
 }
 
@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressWidth = 24
+	progressTick  = 100 * time.Millisecond
+	lineWidth     = 78
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// Progress draws a one-line progress bar (or a spinner, when the total is
+// unknown) on stderr. It only draws on a terminal and never in JSON mode, so
+// piped and scripted output stay byte-for-byte unchanged. Methods are safe
+// for concurrent use and on a nil *Progress.
+type Progress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	label string
+	total int
+	done  int
+	item  string
+	frame int
+	start time.Time
+	stop  chan struct{}
+	ended bool
+}
+
+// Progress starts a bar for total steps. With total 0 it shows a spinner
+// and the elapsed time until Done.
+func (o Output) Progress(label string, total int) *Progress {
+	if o.JSON || o.Quiet || !IsTerminal(o.Err) {
+		return nil
+	}
+	p := &Progress{w: o.Err, label: label, total: total, start: time.Now(), stop: make(chan struct{})}
+	go p.tick()
+	return p
+}
+
+// Step records one finished item; item is shown as the current path.
+func (p *Progress) Step(item string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.item = item
+	p.draw()
+}
+
+// Done clears the line. Call it before printing anything else.
+func (p *Progress) Done() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ended = true
+	fmt.Fprint(p.w, "\r\x1b[K")
+}
+
+func (p *Progress) tick() {
+	ticker := time.NewTicker(progressTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *Progress) draw() {
+	if p.ended {
+		return
+	}
+	var line string
+	if p.total > 0 {
+		filled := min(progressWidth, progressWidth*p.done/p.total)
+		bar := strings.Repeat("#", filled) + strings.Repeat(".", progressWidth-filled)
+		line = fmt.Sprintf("%s [%s] %d/%d %s", p.label, bar, p.done, p.total, p.item)
+	} else {
+		elapsed := time.Since(p.start).Truncate(time.Second)
+		line = fmt.Sprintf("%s %s %s", spinnerFrames[p.frame%len(spinnerFrames)], p.label, elapsed)
+		if p.done > 0 {
+			line += fmt.Sprintf(" (%d done) %s", p.done, p.item)
+		}
+	}
+	if len(line) > lineWidth {
+		line = line[:lineWidth-3] + "..."
+	}
+	fmt.Fprint(p.w, "\r\x1b[K"+line)
+}
@@ -0,0 +1,28 @@
+package ui
+
+import (
+	"bytes"
+	"io"
+)
+
+// quietPrefixes start the advisory stderr lines that --quiet drops.
+var quietPrefixes = [][]byte{[]byte("hint: "), []byte("note: ")}
+
+type quietWriter struct {
+	w io.Writer
+}
+
+// QuietWriter drops hint and note lines written to w, keeping errors and
+// warnings. Each line is expected in a single Write, as fmt.Fprintln does.
+func QuietWriter(w io.Writer) io.Writer {
+	return quietWriter{w: w}
+}
+
+func (q quietWriter) Write(p []byte) (int, error) {
+	for _, prefix := range quietPrefixes {
+		if bytes.HasPrefix(p, prefix) {
+			return len(p), nil
+		}
+	}
+	return q.w.Write(p)
+}
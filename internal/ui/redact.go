@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"io"
+
+	"github.com/aatuh/gitvault/internal/redact"
+)
+
+type redactWriter struct {
+	w io.Writer
+}
+
+// RedactWriter masks recorded secret values in everything written to w. Like
+// QuietWriter it expects each message in a single Write.
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w: w}
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redact.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Unredacted returns the writer under a RedactWriter, for child processes
+// that own their output and may need a terminal.
+func Unredacted(w io.Writer) io.Writer {
+	if r, ok := w.(redactWriter); ok {
+		return r.w
+	}
+	return w
+}
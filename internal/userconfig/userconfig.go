@@ -0,0 +1,130 @@
+package userconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config holds per-user settings that apply across vaults.
+type Config struct {
+	Identity Identity `json:"identity"`
+	Sops     Sops     `json:"sops,omitzero"`
+	// Aliases maps a shortcut name to the command line it stands for, e.g.
+	// "prodrun": "secret run app prod --".
+	Aliases map[string]string `json:"aliases,omitempty"`
+	Hooks   Hooks             `json:"hooks,omitzero"`
+	Storage Storage           `json:"storage,omitzero"`
+	// Timeouts bound sops and git calls by kind (encrypt, decrypt, git,
+	// gitNetwork) as Go durations; "0" removes the limit.
+	Timeouts  map[string]string `json:"timeouts,omitempty"`
+	Telemetry Telemetry         `json:"telemetry,omitzero"`
+	Limits    Limits            `json:"limits,omitzero"`
+}
+
+// Limits slow down and report bulk decryption by a compromised local
+// process. They count sops decryptions by all of this user's gitvault
+// processes over the last minute. DecryptsPerMinute refuses decryptions
+// past that many; WarnDistinct warns once that many different envs and
+// files were decrypted, WarnEveryEnv once all of a vault's were. Alert is
+// a command run on a warning, with the message in GITVAULT_ALERT.
+type Limits struct {
+	DecryptsPerMinute int      `json:"decryptsPerMinute,omitempty"`
+	WarnDistinct      int      `json:"warnDistinct,omitempty"`
+	WarnEveryEnv      bool     `json:"warnEveryEnv,omitempty"`
+	Alert             []string `json:"alert,omitempty"`
+}
+
+// Telemetry opts in to OpenTelemetry traces and metrics of command and
+// sops/git call durations and failures, sent over OTLP/HTTP to Endpoint
+// (default: the OTEL_EXPORTER_OTLP_* variables). IncludeNames adds project
+// and env names; key names and values are never sent.
+type Telemetry struct {
+	Enabled      bool              `json:"enabled,omitempty"`
+	Endpoint     string            `json:"endpoint,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	IncludeNames bool              `json:"includeNames,omitempty"`
+}
+
+// Storage tunes how vault files are written. Fsync flushes every replaced
+// file and its directory, for vaults on Dropbox, NFS, or other storage
+// where a crash or sync conflict could otherwise leave a file truncated.
+type Storage struct {
+	Fsync bool `json:"fsync,omitempty"`
+}
+
+// Hooks records which vaults may run their hooks here. Trusted maps a vault
+// root to the digest of the hooks that were reviewed, so hooks changed by a
+// pull stay off until trusted again.
+type Hooks struct {
+	Trusted map[string]string `json:"trusted,omitempty"`
+}
+
+type Identity struct {
+	Keyring bool     `json:"keyring,omitempty"`
+	Files   []string `json:"files,omitempty"`
+}
+
+// Sops holds extra arguments and environment passed to every sops
+// encrypt and decrypt, e.g. --aws-profile. They are
+// per-user on purpose: a vault must not be able to redirect key operations.
+type Sops struct {
+	Args []string          `json:"args,omitempty"`
+	Env  map[string]string `json:"env,omitempty"`
+	// Keyservices are sops key service addresses (tcp://host:port or
+	// unix:///path). LocalKeyservice false keeps sops from using local keys,
+	// for setups where keys never leave a central server.
+	Keyservices     []string `json:"keyservices,omitempty"`
+	LocalKeyservice *bool    `json:"localKeyservice,omitempty"`
+}
+
+func Path() (string, error) {
+	if path := strings.TrimSpace(os.Getenv("GITVAULT_CONFIG")); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gitvault", "config.json"), nil
+}
+
+// Load reads the config. A missing file, or no config directory at all (as
+// in a minimal container without $HOME), is an empty config; a file that
+// does not parse is an error.
+func Load() (Config, error) {
+	path, err := Path()
+	if err != nil {
+		return Config{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Config{}, nil
+		}
+		return Config{}, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func Save(cfg Config) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,61 @@
+package vaultfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var protectedDirs = []string{".gitvault", "secrets", "files"}
+
+type PermIssue struct {
+	Path   string
+	Dir    bool
+	Detail string
+}
+
+// CheckPermissions reports vault metadata and ciphertext paths that are
+// accessible to users other than the owner.
+func CheckPermissions(root string) ([]PermIssue, error) {
+	issues := []PermIssue{}
+	for _, name := range protectedDirs {
+		dir := filepath.Join(root, name)
+		if _, err := os.Stat(dir); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			detail, ok, err := inspect(path, info)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				issues = append(issues, PermIssue{Path: path, Dir: entry.IsDir(), Detail: detail})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return issues, nil
+}
+
+func FixPermissions(issues []PermIssue) error {
+	for _, issue := range issues {
+		if err := Restrict(issue.Path, issue.Dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
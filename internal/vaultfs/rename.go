@@ -0,0 +1,82 @@
+package vaultfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Rename retries follow this backoff: 10ms, 20ms, 40ms, ... Sync clients
+// (Dropbox, OneDrive) and virus scanners briefly hold files open, which
+// fails a rename on Windows, and NFS can report stale handles.
+var (
+	renameAttempts = 6
+	renameBackoff  = 10 * time.Millisecond
+)
+
+// RenameError reports a rename that still failed after retrying. The
+// target is left as it was; the source (usually a temp file) is not removed.
+type RenameError struct {
+	Old      string
+	New      string
+	Attempts int
+	Err      error
+}
+
+func (e *RenameError) Error() string {
+	return fmt.Sprintf("replace %s failed after %d attempt(s): %v", e.New, e.Attempts, e.Err)
+}
+
+func (e *RenameError) Unwrap() error {
+	return e.Err
+}
+
+// renameRetry renames oldpath over newpath, retrying transient failures.
+// With fsync the data is flushed before the rename and the directory entry
+// after it, so a crash cannot leave a truncated or missing file.
+func renameRetry(rename func(string, string) error, oldpath, newpath string, fsync bool) error {
+	if fsync {
+		if err := syncFile(oldpath); err != nil {
+			return err
+		}
+	}
+	var err error
+	delay := renameBackoff
+	for attempt := 1; ; attempt++ {
+		if err = rename(oldpath, newpath); err == nil {
+			break
+		}
+		if attempt == renameAttempts || !transient(err) {
+			return &RenameError{Old: oldpath, New: newpath, Attempts: attempt, Err: err}
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if fsync {
+		return syncDir(filepath.Dir(newpath))
+	}
+	return nil
+}
+
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func isErrno(err error, codes ...error) bool {
+	for _, code := range codes {
+		if errors.Is(err, code) {
+			return true
+		}
+	}
+	return false
+}
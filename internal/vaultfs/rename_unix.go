@@ -0,0 +1,21 @@
+//go:build !windows
+
+package vaultfs
+
+import (
+	"os"
+	"syscall"
+)
+
+func transient(err error) bool {
+	return isErrno(err, syscall.EBUSY, syscall.EAGAIN, syscall.EINTR, syscall.ESTALE, syscall.ETXTBSY)
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package vaultfs
+
+import "syscall"
+
+// Access denied, sharing violation, and lock violation are what another
+// process holding the file open looks like.
+func transient(err error) bool {
+	return isErrno(err, syscall.Errno(5), syscall.Errno(32), syscall.Errno(33))
+}
+
+// syncDir is a no-op: a directory cannot be opened for flushing on
+// Windows. The file itself is still flushed before the rename.
+func syncDir(string) error {
+	return nil
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package vaultfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const ProtectionKind = "mode"
+
+// Restrict limits path to its owner.
+func Restrict(path string, dir bool) error {
+	if dir {
+		return os.Chmod(path, DirPerm)
+	}
+	return os.Chmod(path, FilePerm)
+}
+
+func inspect(_ string, info os.FileInfo) (string, bool, error) {
+	want := FilePerm
+	if info.IsDir() {
+		want = DirPerm
+	}
+	mode := info.Mode().Perm()
+	if mode&0077 == 0 {
+		return "", true, nil
+	}
+	return fmt.Sprintf("mode %04o, want %04o", mode, want), false, nil
+}
+
+// TempDir returns the directory used for short-lived plaintext files,
+// preferring the per-user runtime directory when one is available.
+func TempDir() (string, error) {
+	runtimeDir := strings.TrimSpace(os.Getenv("XDG_RUNTIME_DIR"))
+	if runtimeDir == "" {
+		return os.TempDir(), nil
+	}
+	dir := filepath.Join(runtimeDir, "gitvault")
+	if err := os.MkdirAll(dir, DirPerm); err != nil {
+		return os.TempDir(), nil
+	}
+	return dir, nil
+}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package vaultfs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const ProtectionKind = "acl"
+
+var broadPrincipals = []string{"everyone", "builtin\\users", "authenticated users", "nt authority\\authenticated users"}
+
+// Restrict removes inherited ACL entries from path and grants full control
+// to the current user only.
+func Restrict(path string, dir bool) error {
+	current, err := user.Current()
+	if err != nil {
+		return err
+	}
+	grant := current.Username + ":(F)"
+	if dir {
+		grant = current.Username + ":(OI)(CI)(F)"
+	}
+	output, err := exec.Command("icacls", path, "/inheritance:r", "/grant:r", grant).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("icacls failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func inspect(path string, _ os.FileInfo) (string, bool, error) {
+	output, err := exec.Command("icacls", path).CombinedOutput()
+	if err != nil {
+		return "", false, fmt.Errorf("icacls failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	lower := strings.ToLower(string(output))
+	for _, principal := range broadPrincipals {
+		if strings.Contains(lower, principal+":") {
+			return fmt.Sprintf("ACL grants access to %s", principal), false, nil
+		}
+	}
+	return "", true, nil
+}
+
+// TempDir returns a per-user directory for short-lived plaintext files,
+// restricted to the current user.
+func TempDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return os.TempDir(), nil
+	}
+	dir := filepath.Join(base, "gitvault", "tmp")
+	if err := os.MkdirAll(dir, DirPerm); err != nil {
+		return "", err
+	}
+	if err := Restrict(dir, true); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,51 @@
+package vaultfs
+
+import (
+	"errors"
+	"os"
+)
+
+// Overwrite zeroes the contents of the regular file at path in place and
+// flushes them, so data later truncated or unlinked is not left readable on
+// disk. Files on copy-on-write or RAM-backed filesystems, where rewriting
+// does not reach the old blocks, are left alone, as are missing files and
+// anything that is not a regular file.
+func Overwrite(path string) error {
+	// Stat first: opening a FIFO for writing would block.
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return overwriteFile(file)
+}
+
+func overwriteFile(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || !overwriteReaches(file) {
+		return err
+	}
+	zeros := make([]byte, 32*1024)
+	for offset := int64(0); offset < info.Size(); offset += int64(len(zeros)) {
+		chunk := min(info.Size()-offset, int64(len(zeros)))
+		if _, err := file.WriteAt(zeros[:chunk], offset); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+// Shred overwrites the file at path, then removes it.
+func Shred(path string) error {
+	overwriteErr := Overwrite(path)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return overwriteErr
+}
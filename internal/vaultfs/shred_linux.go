@@ -0,0 +1,24 @@
+package vaultfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Filesystems where overwriting in place writes new blocks (btrfs, zfs,
+// bcachefs) or where there are no disk blocks at all (tmpfs, ramfs).
+var noOverwrite = map[uint32]bool{
+	0x9123683e: true, // btrfs
+	0x2fc12fc1: true, // zfs
+	0xca451a4e: true, // bcachefs
+	0x01021994: true, // tmpfs
+	0x858458f6: true, // ramfs
+}
+
+func overwriteReaches(file *os.File) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(file.Fd()), &st); err != nil {
+		return true
+	}
+	return !noOverwrite[uint32(st.Type)]
+}
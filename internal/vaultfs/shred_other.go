@@ -0,0 +1,9 @@
+//go:build !linux
+
+package vaultfs
+
+import "os"
+
+func overwriteReaches(*os.File) bool {
+	return true
+}
@@ -0,0 +1,30 @@
+package vaultfs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// oTmpfile is O_TMPFILE, which package syscall does not define.
+const oTmpfile = 0o20000000 | syscall.O_DIRECTORY
+
+// UnnamedFile writes data to a file in dir that never gets a name, so
+// nothing is left behind even if gitvault is killed. The returned path
+// reaches it through /proc for as long as cleanup has not run; cleanup
+// zeroes and closes it.
+func UnnamedFile(dir string, data []byte) (string, func(), error) {
+	file, err := os.OpenFile(dir, os.O_RDWR|oTmpfile, FilePerm)
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		_ = overwriteFile(file)
+		_ = file.Close()
+	}
+	if _, err := file.Write(data); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), file.Fd()), cleanup, nil
+}
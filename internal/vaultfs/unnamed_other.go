@@ -0,0 +1,11 @@
+//go:build !linux
+
+package vaultfs
+
+import "errors"
+
+// UnnamedFile is only available on Linux; callers fall back to a named
+// temp file.
+func UnnamedFile(string, []byte) (string, func(), error) {
+	return "", nil, errors.ErrUnsupported
+}
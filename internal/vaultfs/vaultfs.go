@@ -0,0 +1,70 @@
+package vaultfs
+
+import (
+	"os"
+
+	"github.com/aatuh/sealr/ports"
+)
+
+const (
+	FilePerm os.FileMode = 0600
+	DirPerm  os.FileMode = 0700
+)
+
+// SecureFS wraps a FileSystem and enforces owner-only permissions on
+// everything it creates or replaces. Renames, which is how every vault file
+// is replaced, are retried on transient failures; Fsync also flushes them
+// to disk.
+type SecureFS struct {
+	Base  ports.FileSystem
+	Fsync bool
+}
+
+func (f SecureFS) ReadFile(path string) ([]byte, error) {
+	return f.Base.ReadFile(path)
+}
+
+func (f SecureFS) WriteFile(path string, data []byte, _ os.FileMode) error {
+	if err := f.Base.WriteFile(path, data, FilePerm); err != nil {
+		return err
+	}
+	return Restrict(path, false)
+}
+
+func (f SecureFS) MkdirAll(path string, _ os.FileMode) error {
+	return f.Base.MkdirAll(path, DirPerm)
+}
+
+func (f SecureFS) Remove(path string) error {
+	return f.Base.Remove(path)
+}
+
+func (f SecureFS) RemoveAll(path string) error {
+	return f.Base.RemoveAll(path)
+}
+
+func (f SecureFS) Stat(path string) (os.FileInfo, error) {
+	return f.Base.Stat(path)
+}
+
+func (f SecureFS) ReadDir(path string) ([]os.DirEntry, error) {
+	return f.Base.ReadDir(path)
+}
+
+func (f SecureFS) Rename(oldpath, newpath string) error {
+	if err := renameRetry(f.Base.Rename, oldpath, newpath, f.Fsync); err != nil {
+		return err
+	}
+	info, err := f.Base.Stat(newpath)
+	if err != nil {
+		return err
+	}
+	return Restrict(newpath, info.IsDir())
+}
+
+func (f SecureFS) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if flag&os.O_CREATE != 0 {
+		perm = FilePerm
+	}
+	return f.Base.OpenFile(path, flag, perm)
+}
@@ -0,0 +1,175 @@
+package vaultref
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileName is the link an app repository keeps at its root to point at the
+// vault it uses, e.g. a git submodule or a sibling checkout.
+const FileName = ".gitvault.ref"
+
+// PathFileName is a plain-text alternative to a ref for repositories that
+// only need to find a vault kept elsewhere, e.g. a sibling directory. Its
+// first line that is not blank or a # comment is the vault path: relative to
+// the file's directory, absolute, or starting with ~/.
+const PathFileName = ".gitvault-path"
+
+// Ref is the content of a .gitvault.ref file.
+type Ref struct {
+	// Vault is the vault root relative to the directory holding the ref,
+	// slash-separated so the file can be committed from any OS.
+	Vault   string `json:"vault"`
+	Project string `json:"project,omitempty"`
+	Env     string `json:"env,omitempty"`
+	// Paths maps subdirectories of a monorepo to their own project and env.
+	Paths []Mapping `json:"paths,omitempty"`
+}
+
+// Mapping applies a project, and optionally an env, to commands run in Path
+// or below it. Path is slash-separated and relative to the ref's directory.
+type Mapping struct {
+	Path    string `json:"path"`
+	Project string `json:"project"`
+	Env     string `json:"env,omitempty"`
+}
+
+// Find walks up from start looking for a ref. It stops at the first vault
+// root, so commands run inside a vault never follow a link. path is empty
+// when no ref was found.
+func Find(start string) (ref Ref, path string, err error) {
+	current := start
+	for {
+		if _, err := os.Stat(filepath.Join(current, ".gitvault", "config.json")); err == nil {
+			return Ref{}, "", nil
+		}
+		candidate := filepath.Join(current, FileName)
+		if _, err := os.Stat(candidate); err == nil {
+			ref, err := Load(candidate)
+			return ref, candidate, err
+		}
+		candidate = filepath.Join(current, PathFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			ref, err := LoadPath(candidate)
+			return ref, candidate, err
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return Ref{}, "", nil
+		}
+		current = parent
+	}
+}
+
+func Load(path string) (Ref, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Ref{}, err
+	}
+	var ref Ref
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return Ref{}, err
+	}
+	if ref.Vault == "" {
+		return Ref{}, errors.New(FileName + ": vault is required")
+	}
+	return ref, nil
+}
+
+// LoadPath reads a .gitvault-path pointer as a ref without a project or
+// env.
+func LoadPath(path string) (Ref, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Ref{}, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "~"); ok && (rest == "" || rest[0] == '/' || rest[0] == filepath.Separator) {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return Ref{}, fmt.Errorf("%s: %w", path, err)
+			}
+			line = filepath.Join(home, rest)
+		}
+		return Ref{Vault: filepath.ToSlash(line)}, nil
+	}
+	return Ref{}, errors.New(PathFileName + ": vault path is required")
+}
+
+func Save(path string, ref Ref) error {
+	data, err := json.MarshalIndent(ref, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Root returns the absolute vault root a ref stored at path points to.
+func (r Ref) Root(path string) string {
+	vault := filepath.FromSlash(r.Vault)
+	if filepath.IsAbs(vault) {
+		return filepath.Clean(vault)
+	}
+	return filepath.Join(filepath.Dir(path), vault)
+}
+
+// Resolve returns the project and env for commands run in dir. The longest
+// path mapping containing dir wins; the ref's own values fill the gaps.
+func (r Ref) Resolve(path, dir string) (project, env string) {
+	project, env = r.Project, r.Env
+	rel, err := filepath.Rel(filepath.Dir(path), dir)
+	if err != nil {
+		return project, env
+	}
+	rel = filepath.ToSlash(rel)
+	best := -1
+	for i, mapping := range r.Paths {
+		if rel != mapping.Path && !strings.HasPrefix(rel, mapping.Path+"/") {
+			continue
+		}
+		if best < 0 || len(mapping.Path) > len(r.Paths[best].Path) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return project, env
+	}
+	mapping := r.Paths[best]
+	project = mapping.Project
+	if mapping.Env != "" {
+		env = mapping.Env
+	}
+	return project, env
+}
+
+// SetPath adds or replaces the mapping for mapping.Path.
+func (r *Ref) SetPath(mapping Mapping) {
+	for i := range r.Paths {
+		if r.Paths[i].Path == mapping.Path {
+			r.Paths[i] = mapping
+			return
+		}
+	}
+	r.Paths = append(r.Paths, mapping)
+	sort.Slice(r.Paths, func(i, j int) bool { return r.Paths[i].Path < r.Paths[j].Path })
+}
+
+// RemovePath drops the mapping for path and reports whether there was one.
+func (r *Ref) RemovePath(path string) bool {
+	for i := range r.Paths {
+		if r.Paths[i].Path == path {
+			r.Paths = append(r.Paths[:i], r.Paths[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
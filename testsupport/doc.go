@@ -0,0 +1,9 @@
+// Package testsupport provides in-memory fakes of the sealr ports, so tests
+// of code built on gitvault and sealr need neither the disk nor the git and
+// sops binaries.
+//
+// sealr's services replace vault files by renaming a temp file created with
+// os.CreateTemp, which always lands on disk. Code that writes through those
+// services still needs a real directory; MemFS covers everything that goes
+// through ports.FileSystem.
+package testsupport
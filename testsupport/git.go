@@ -0,0 +1,104 @@
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/aatuh/sealr/ports"
+)
+
+var _ ports.Git = (*Git)(nil)
+
+// Git is a ports.Git that never runs git. Repos holds the repository roots,
+// Tracked the tracked file paths, and Dirty the roots with uncommitted
+// changes. PullErr and PushErr are returned by Pull and Push. Every call is
+// recorded in Calls as "<method> <path>".
+type Git struct {
+	mu      sync.Mutex
+	Repos   map[string]bool
+	Tracked map[string]bool
+	Dirty   map[string]bool
+	Commit  ports.CommitInfo
+	PullErr error
+	PushErr error
+	Calls   []string
+}
+
+func (g *Git) IsRepo(_ context.Context, path string) (bool, error) {
+	g.record("is-repo", path)
+	_, ok := g.topLevel(path)
+	return ok, nil
+}
+
+func (g *Git) InitRepo(_ context.Context, path string) error {
+	g.record("init", path)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.Repos == nil {
+		g.Repos = map[string]bool{}
+	}
+	g.Repos[filepath.Clean(path)] = true
+	return nil
+}
+
+func (g *Git) TopLevel(_ context.Context, path string) (string, error) {
+	g.record("top-level", path)
+	root, ok := g.topLevel(path)
+	if !ok {
+		return "", fmt.Errorf("%s is not in a git repository", path)
+	}
+	return root, nil
+}
+
+func (g *Git) IsPathTracked(_ context.Context, _, path string) (bool, error) {
+	g.record("is-tracked", path)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Tracked[filepath.Clean(path)], nil
+}
+
+func (g *Git) IsDirty(_ context.Context, repoRoot string) (bool, error) {
+	g.record("is-dirty", repoRoot)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Dirty[filepath.Clean(repoRoot)], nil
+}
+
+func (g *Git) LastCommitInfo(_ context.Context, _, path string) (ports.CommitInfo, error) {
+	g.record("last-commit", path)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Commit, nil
+}
+
+func (g *Git) Pull(_ context.Context, repoRoot string) error {
+	g.record("pull", repoRoot)
+	return g.PullErr
+}
+
+func (g *Git) Push(_ context.Context, repoRoot string) error {
+	g.record("push", repoRoot)
+	return g.PushErr
+}
+
+func (g *Git) record(method, path string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Calls = append(g.Calls, method+" "+path)
+}
+
+// topLevel finds the nearest repository root at or above path.
+func (g *Git) topLevel(path string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if g.Repos[dir] {
+			return dir, true
+		}
+		if isRoot(dir) {
+			return "", false
+		}
+	}
+}
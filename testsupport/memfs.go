@@ -0,0 +1,279 @@
+package testsupport
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aatuh/sealr/ports"
+)
+
+var _ ports.FileSystem = (*MemFS)(nil)
+
+// MemFS is a ports.FileSystem held in memory. Paths are cleaned, so
+// "a/../b" and "b" are the same file; the root and "." always exist. The
+// zero value is ready to use and safe for concurrent use.
+type MemFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (n *memNode) dir() bool {
+	return n.mode.IsDir()
+}
+
+// NewMemFS returns a MemFS holding files, keyed by path. Parent directories
+// are created as needed.
+func NewMemFS(files map[string][]byte) *MemFS {
+	m := &MemFS{}
+	for path, data := range files {
+		if err := m.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			panic(err)
+		}
+		if err := m.WriteFile(path, data, 0600); err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// Files returns a copy of every file's content, keyed by cleaned path.
+func (m *MemFS) Files() map[string][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := map[string][]byte{}
+	for path, node := range m.nodes {
+		if !node.dir() {
+			files[path] = append([]byte(nil), node.data...)
+		}
+	}
+	return files
+}
+
+func (m *MemFS) ReadFile(path string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup("open", path)
+	if err != nil {
+		return nil, err
+	}
+	if node.dir() {
+		return nil, pathError("read", path, errors.New("is a directory"))
+	}
+	return append([]byte(nil), node.data...), nil
+}
+
+func (m *MemFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if err := m.parentExists("open", path); err != nil {
+		return err
+	}
+	if node, ok := m.nodes[path]; ok {
+		if node.dir() {
+			return pathError("open", path, errors.New("is a directory"))
+		}
+		node.data = append([]byte(nil), data...)
+		node.modTime = time.Now()
+		return nil
+	}
+	m.put(path, &memNode{data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()})
+	return nil
+}
+
+func (m *MemFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	for dir := path; !isRoot(dir); dir = filepath.Dir(dir) {
+		if node, ok := m.nodes[dir]; ok && !node.dir() {
+			return pathError("mkdir", dir, errors.New("not a directory"))
+		}
+	}
+	for dir := path; !isRoot(dir); dir = filepath.Dir(dir) {
+		if _, ok := m.nodes[dir]; !ok {
+			m.put(dir, &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()})
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.lookup("remove", path)
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if node.dir() && len(m.children(path)) > 0 {
+		return pathError("remove", path, errors.New("directory not empty"))
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	for name := range m.nodes {
+		if within(name, path) {
+			delete(m.nodes, name)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Stat(path string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if isRoot(path) {
+		return memInfo{name: filepath.Base(path), node: &memNode{mode: fs.ModeDir | 0700}}, nil
+	}
+	node, err := m.lookup("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	return memInfo{name: filepath.Base(path), node: node}, nil
+}
+
+func (m *MemFS) ReadDir(path string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if !isRoot(path) {
+		node, err := m.lookup("open", path)
+		if err != nil {
+			return nil, err
+		}
+		if !node.dir() {
+			return nil, pathError("readdirent", path, errors.New("not a directory"))
+		}
+	}
+	names := m.children(path)
+	sort.Strings(names)
+	entries := make([]os.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(name), node: m.nodes[name]}))
+	}
+	return entries, nil
+}
+
+// Rename moves a file, or a directory with everything under it, replacing
+// a file at newpath like os.Rename does.
+func (m *MemFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	node, err := m.lookup("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	if err := m.parentExists("rename", newpath); err != nil {
+		return err
+	}
+	if target, ok := m.nodes[newpath]; ok && target.dir() != node.dir() {
+		return pathError("rename", newpath, errors.New("file exists"))
+	} else if ok && target.dir() && oldpath != newpath && len(m.children(newpath)) > 0 {
+		return pathError("rename", newpath, errors.New("directory not empty"))
+	}
+	if oldpath == newpath {
+		return nil
+	}
+	if node.dir() && within(newpath, oldpath) {
+		return pathError("rename", newpath, errors.New("cannot move a directory into itself"))
+	}
+	for name, n := range m.nodes {
+		if within(name, oldpath) {
+			delete(m.nodes, name)
+			m.put(newpath+strings.TrimPrefix(name, oldpath), n)
+		}
+	}
+	return nil
+}
+
+// OpenFile is unsupported: ports.FileSystem returns an *os.File, which only
+// a real file can back.
+func (m *MemFS) OpenFile(path string, _ int, _ os.FileMode) (*os.File, error) {
+	return nil, pathError("open", path, errors.ErrUnsupported)
+}
+
+func (m *MemFS) put(path string, node *memNode) {
+	if m.nodes == nil {
+		m.nodes = map[string]*memNode{}
+	}
+	m.nodes[path] = node
+}
+
+func (m *MemFS) lookup(op, path string) (*memNode, error) {
+	node, ok := m.nodes[filepath.Clean(path)]
+	if !ok {
+		return nil, pathError(op, path, fs.ErrNotExist)
+	}
+	return node, nil
+}
+
+func (m *MemFS) parentExists(op, path string) error {
+	parent := filepath.Dir(path)
+	if isRoot(parent) {
+		return nil
+	}
+	node, ok := m.nodes[parent]
+	if !ok {
+		return pathError(op, path, fs.ErrNotExist)
+	}
+	if !node.dir() {
+		return pathError(op, path, errors.New("not a directory"))
+	}
+	return nil
+}
+
+// children lists the paths directly under dir.
+func (m *MemFS) children(dir string) []string {
+	names := []string{}
+	for name := range m.nodes {
+		if name != dir && filepath.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isRoot(path string) bool {
+	return path == "." || path == filepath.Dir(path)
+}
+
+// within reports whether path is dir or lies under it.
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func pathError(op, path string, err error) error {
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
+
+type memInfo struct {
+	name string
+	node *memNode
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i memInfo) Mode() os.FileMode  { return i.node.mode }
+func (i memInfo) ModTime() time.Time { return i.node.modTime }
+func (i memInfo) IsDir() bool        { return i.node.dir() }
+func (i memInfo) Sys() any           { return nil }
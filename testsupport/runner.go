@@ -0,0 +1,41 @@
+package testsupport
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	executil "github.com/aatuh/sealr/infra/exec"
+)
+
+var _ executil.Runner = (*Runner)(nil)
+
+// Call is one command a Runner was asked to run.
+type Call struct {
+	Name  string
+	Args  []string
+	Input []byte
+	Env   []string
+	Dir   string
+}
+
+// Runner is an executil.Runner that answers with Handle instead of running
+// a binary; without Handle every call succeeds with no output. Calls records
+// each invocation in order.
+type Runner struct {
+	mu     sync.Mutex
+	Handle func(call Call) (stdout, stderr []byte, err error)
+	Calls  []Call
+}
+
+func (r *Runner) Run(_ context.Context, name string, args []string, input []byte, env []string, dir string) ([]byte, []byte, error) {
+	call := Call{Name: name, Args: slices.Clone(args), Input: slices.Clone(input), Env: slices.Clone(env), Dir: dir}
+	r.mu.Lock()
+	r.Calls = append(r.Calls, call)
+	handle := r.Handle
+	r.mu.Unlock()
+	if handle == nil {
+		return nil, nil, nil
+	}
+	return handle(call)
+}